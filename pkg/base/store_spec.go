@@ -47,6 +47,9 @@ type StoreSpec struct {
 	SizePercent float64
 	InMemory    bool
 	Attributes  roachpb.Attributes
+	// Ephemeral stores only hold non-essential data; the allocator never
+	// places replicas on them.
+	Ephemeral bool
 }
 
 // String returns a fully parsable version of the store spec.
@@ -74,6 +77,9 @@ func (ss StoreSpec) String() string {
 		}
 		fmt.Fprintf(&buffer, ",")
 	}
+	if ss.Ephemeral {
+		fmt.Fprint(&buffer, "ephemeral=true,")
+	}
 	// Trim the extra comma from the end if it exists.
 	if l := buffer.Len(); l > 0 {
 		buffer.Truncate(l - 1)
@@ -83,7 +89,7 @@ func (ss StoreSpec) String() string {
 
 // newStoreSpec parses the string passed into a --store flag and returns a
 // StoreSpec if it is correctly parsed.
-// There are four possible fields that can be passed in, comma separated:
+// There are five possible fields that can be passed in, comma separated:
 // - path=xxx The directory in which to the rocks db instance should be
 //   located, required unless using a in memory storage.
 // - type=mem This specifies that the store is an in memory storage instead of
@@ -97,6 +103,8 @@ func (ss StoreSpec) String() string {
 //   - 20%             -> 20% of the available space
 //   - 0.2             -> 20% of the available space
 // - attrs=xxx:yyy:zzz A colon separated list of optional attributes.
+// - ephemeral=true Marks the store as only holding non-essential data, such
+//   as temporary files. The allocator never places replicas on such a store.
 // Note that commas are forbidden within any field name or value.
 func newStoreSpec(value string) (StoreSpec, error) {
 	if len(value) == 0 {
@@ -190,6 +198,11 @@ func newStoreSpec(value string) (StoreSpec, error) {
 				ss.Attributes.Attrs = append(ss.Attributes.Attrs, attribute)
 			}
 			sort.Strings(ss.Attributes.Attrs)
+		case "ephemeral":
+			var err error
+			if ss.Ephemeral, err = strconv.ParseBool(value); err != nil {
+				return StoreSpec{}, fmt.Errorf("could not parse ephemeral (%s) %s", value, err)
+			}
 		case "type":
 			if value == "mem" {
 				ss.InMemory = true
@@ -68,8 +68,13 @@ func runBackup(cmd *cobra.Command, args []string) error {
 var backupCmd = &cobra.Command{
 	Use:   "backup [options] <basepath>",
 	Short: "backup all SQL tables",
-	Long:  "Exports a consistent snapshot of all SQL tables to storage.",
-	RunE:  maybeDecorateGRPCError(runBackup),
+	Long: `
+Exports a consistent snapshot of all SQL tables to storage. The basepath is a
+local (or NFS) directory or a URI: file:///path, http://host/path,
+s3://bucket/path?AWS_ACCESS_KEY_ID=...&AWS_SECRET_ACCESS_KEY=... or
+gs://bucket/path?GS_HMAC_ACCESS_KEY=...&GS_HMAC_SECRET=...
+`,
+	RunE: maybeDecorateGRPCError(runBackup),
 }
 
 func runRestore(cmd *cobra.Command, args []string) error {
@@ -104,6 +109,9 @@ func runRestore(cmd *cobra.Command, args []string) error {
 var restoreCmd = &cobra.Command{
 	Use:   "restore [options] <basepath>",
 	Short: "restore SQL tables from a backup",
-	Long:  "Imports one or all SQL tables, restoring them to a previously snapshotted state.",
-	RunE:  maybeDecorateGRPCError(runRestore),
+	Long: `
+Imports one or all SQL tables, restoring them to a previously snapshotted
+state. The basepath is given in any of the forms accepted by backup.
+`,
+	RunE: maybeDecorateGRPCError(runRestore),
 }
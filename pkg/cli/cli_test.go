@@ -169,6 +169,7 @@ func (c cliTest) RunWithArgs(a []string) {
 	sqlCtx.execStmts = nil
 	zoneConfig = ""
 	zoneDisableReplication = false
+	zoneAllowUnsafeReplication = false
 
 	var args []string
 	args = append(args, a[0])
@@ -81,6 +81,14 @@ Disable replication in the zone by setting the desired replica count to 1.
 Equivalent to setting 'num_replicas: 1' via -f.`,
 	}
 
+	ZoneAllowUnsafeReplication = FlagInfo{
+		Name: "allow-unsafe-replication",
+		Description: `
+Allow lowering the replica count of the zone even if its ranges would then be
+left with fewer than 3 replicas, and fewer than they can have on the live nodes
+of the cluster.`,
+	}
+
 	Background = FlagInfo{
 		Name: "background",
 		Description: `
@@ -228,6 +236,13 @@ server to listen on an external address in insecure mode.`,
 		Description: `Define the maximum number of results that will be retrieved.`,
 	}
 
+	SplitExpireAfter = FlagInfo{
+		Name: "expire-after",
+		Description: `
+Manual splits are sticky: the split key is not removed by a merge. If
+non-zero, the split stops being sticky once this duration has passed.`,
+	}
+
 	Password = FlagInfo{
 		Name:   "password",
 		EnvVar: "COCKROACH_PASSWORD",
@@ -317,6 +332,15 @@ memory that the store may consume, for example:
   --store=type=mem,size=20GiB
   --store=type=mem,size=90%
 
+</PRE>
+A store can be marked as ephemeral by setting the "ephemeral" field to "true".
+Ephemeral stores only hold non-essential data, and the allocator never places
+replicas on them. This allows fast but non-durable devices to be used alongside
+durable ones. The first store can't be ephemeral, for example:
+<PRE>
+
+  --store=/mnt/hda1 --store=path=/mnt/nvme01,ephemeral=true
+
 </PRE>
 Commas are forbidden in all values, since they are used to separate fields.
 Also, if you use equal signs in the file path to a store, you must use the
@@ -371,6 +395,46 @@ The resolution of the Raft timer; other raft timeouts are
 defined in terms of multiples of this value.`,
 	}
 
+	RaftSchedulerWorkers = FlagInfo{
+		Name: "raft-scheduler-workers",
+		Description: `
+The number of goroutines each store of the node uses to process Raft ticks,
+messages and ready state. Zero uses the COCKROACH_SCHEDULER_CONCURRENCY
+environment variable, which defaults to twice the number of CPUs.`,
+	}
+
+	RaftTickBatchSize = FlagInfo{
+		Name: "raft-tick-batch-size",
+		Description: `
+The number of ranges whose Raft ticks are queued at a time, so that processing
+the first ranges overlaps with queueing the rest. Zero uses the
+COCKROACH_RAFT_TICK_BATCH_SIZE environment variable, which by default queues
+all of a store's ranges at once.`,
+	}
+
+	MaxReplicasPerStore = FlagInfo{
+		Name: "max-replicas-per-store",
+		Description: `
+The maximum number of replicas each store of the node will hold. Once reached,
+a store declines new replicas and advertises itself as full so that they are
+placed elsewhere. Zero means unlimited, unless the
+COCKROACH_MAX_REPLICAS_PER_STORE environment variable sets a limit.`,
+	}
+
+	DisableQueues = FlagInfo{
+		Name: "disable-queues",
+		Description: `
+A comma-separated list of the store queues to disable on all the stores of the
+node, which freezes the corresponding automatic activity (e.g. replica
+movement) until the node is restarted. Valid queues are gc, split, replicate,
+replicagc, raftlog, tsmaintenance and consistency; the replica scanner can be
+disabled as scanner. Queues can also be disabled cluster-wide at runtime
+through the kv.<queue>.enabled cluster settings. For example:
+<PRE>
+
+  --disable-queues=replicate,gc`,
+	}
+
 	UndoFreezeCluster = FlagInfo{
 		Name:        "undo",
 		Description: `Attempt to undo an earlier attempt to freeze the cluster.`,
@@ -286,6 +286,9 @@ func tryRangeIDKey(kv engine.MVCCKeyValue) (string, error) {
 	case bytes.Equal(suffix, keys.LocalRaftTruncatedStateSuffix):
 		msg = &roachpb.RaftTruncatedState{}
 
+	case bytes.Equal(suffix, keys.LocalRangeAppliedStateSuffix):
+		msg = &storagebase.RangeAppliedState{}
+
 	case bytes.Equal(suffix, keys.LocalRangeLeaseSuffix):
 		msg = &roachpb.Lease{}
 
@@ -626,6 +629,14 @@ func runDebugCheckStoreCmd(cmd *cobra.Command, args []string) error {
 					return false, err
 				}
 				getReplicaInfo(rangeID).truncatedIndex = trunc.Index
+			case bytes.Equal(suffix, keys.LocalRangeAppliedStateSuffix):
+				var state storagebase.RangeAppliedState
+				if err := kv.Value.GetProto(&state); err != nil {
+					return false, err
+				}
+				ri := getReplicaInfo(rangeID)
+				ri.truncatedIndex = state.TruncatedState.Index
+				ri.appliedIndex = state.RaftAppliedIndex
 			case bytes.Equal(suffix, keys.LocalRaftAppliedIndexSuffix):
 				idx, err := kv.Value.GetInt()
 				if err != nil {
@@ -763,6 +774,7 @@ var debugCmds = []*cobra.Command{
 	debugCheckStoreCmd,
 	debugCompactCmd,
 	debugSSTablesCmd,
+	debugAllocatorCmd,
 	kvCmd,
 	rangeCmd,
 	debugEnvCmd,
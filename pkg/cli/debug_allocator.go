@@ -0,0 +1,318 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chzyer/readline"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/cockroachdb/cockroach/pkg/config"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/util"
+)
+
+var debugAllocatorCmd = &cobra.Command{
+	Use:   "allocator [stores.json] [zone.yaml]",
+	Short: "run the replica allocator offline",
+	Long: `
+Runs the replica allocator against the state of the stores of a cluster, as
+exported by the /_status/stores-pool endpoint of one of its nodes, and
+optionally a zone config in the format used by "zone set". Commands read
+from the standard input ask where the allocator would place, remove or move
+replicas, and can change the zone config and the state of the stores to see
+how the decisions change. Type "help" for the list of commands.
+
+Nothing is sent to the cluster.
+`,
+	RunE: runDebugAllocator,
+}
+
+const allocatorShellHelp = `Replicas are given as the IDs of the stores holding them. When a command
+needs a leaseholder, the lease is held by the first replica listed.
+
+  stores                    list the stores
+  zone                      show the zone config
+  constraints [c...]        set the constraints of the zone config, e.g. +ssd
+  replicas <n>              set the number of replicas of the zone config
+  action <replicas>         show what the replicate queue would do
+  allocate <replicas>       show where a new replica would be added
+  remove <replicas>         show which replica would be removed
+  rebalance <replicas>      show where a replica would be moved to
+  dead|throttled|live <s>   change the state of store s
+  help                      show this message
+  quit                      exit
+`
+
+func runDebugAllocator(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return usageAndError(cmd)
+	}
+	stores, err := readStorePoolState(args[0])
+	if err != nil {
+		return err
+	}
+	zone := config.DefaultZoneConfig()
+	if len(args) == 2 {
+		if zone, err = readAllocatorZone(args[1]); err != nil {
+			return err
+		}
+	}
+
+	da := storage.NewDebugAllocator(stores)
+	defer da.Close()
+	shell := &allocatorShell{da: da, zone: zone}
+
+	ins, err := readline.NewEx(&readline.Config{Prompt: "allocator> "})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = ins.Close() }()
+	if isInteractive {
+		fmt.Printf("# Loaded %d stores. Type \"help\" for the list of commands.\n", len(stores))
+	}
+
+	for {
+		l, err := ins.Readline()
+		if err == readline.ErrInterrupt || err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		exit, err := shell.exec(os.Stdout, l)
+		if err != nil {
+			if !isInteractive {
+				return err
+			}
+			fmt.Fprintf(osStderr, "error: %s\n", err)
+		}
+		if exit {
+			return nil
+		}
+	}
+}
+
+// readStorePoolState reads the stores from a file holding the response of
+// the /_status/stores-pool endpoint.
+func readStorePoolState(path string) ([]storage.StoreHealth, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var resp serverpb.StorePoolResponse
+	if err := (&util.JSONPb{}).Unmarshal(data, &resp); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse %s", path)
+	}
+	stores := make([]storage.StoreHealth, 0, len(resp.Stores))
+	for _, store := range resp.Stores {
+		if store.Desc.StoreID != store.StoreID {
+			return nil, errors.Errorf("store %d has no descriptor; "+
+				"the state must be exported by a node which includes it", store.StoreID)
+		}
+		stores = append(stores, storage.StoreHealth{
+			Desc:      store.Desc,
+			Dead:      store.Dead,
+			Throttled: store.Throttled,
+		})
+	}
+	return stores, nil
+}
+
+// readAllocatorZone reads a zone config from a YAML file. Fields missing
+// from the file keep their default values.
+func readAllocatorZone(path string) (config.ZoneConfig, error) {
+	zone := config.DefaultZoneConfig()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return zone, err
+	}
+	if err := yaml.Unmarshal(data, &zone); err != nil {
+		return zone, errors.Wrapf(err, "unable to parse %s", path)
+	}
+	return zone, zone.Validate()
+}
+
+// allocatorShell executes the commands of the debug allocator command.
+type allocatorShell struct {
+	da   *storage.DebugAllocator
+	zone config.ZoneConfig
+}
+
+// exec executes a single command, writing its output to w. It returns true
+// if the shell should exit.
+func (s *allocatorShell) exec(w io.Writer, line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return false, nil
+	}
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case "quit", "exit":
+		return true, nil
+	case "help":
+		fmt.Fprint(w, allocatorShellHelp)
+	case "stores":
+		s.printStores(w)
+	case "zone":
+		res, err := yaml.Marshal(s.zone)
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprint(w, string(res))
+	case "constraints":
+		constraints := make([]config.Constraint, len(args))
+		for i, arg := range args {
+			if err := constraints[i].FromString(arg); err != nil {
+				return false, err
+			}
+		}
+		s.zone.Constraints.Constraints = constraints
+	case "replicas":
+		if len(args) != 1 {
+			return false, errors.New("usage: replicas <n>")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return false, err
+		}
+		zone := s.zone
+		zone.NumReplicas = int32(n)
+		if err := zone.Validate(); err != nil {
+			return false, err
+		}
+		s.zone = zone
+	case "action", "allocate", "remove", "rebalance":
+		replicas, err := s.parseReplicas(args)
+		if err != nil {
+			return false, err
+		}
+		return false, s.allocate(w, cmd, replicas)
+	case "dead", "throttled", "live":
+		if len(args) != 1 {
+			return false, errors.Errorf("usage: %s <store>", cmd)
+		}
+		storeID, err := parseStoreID(args[0])
+		if err != nil {
+			return false, err
+		}
+		store, ok := s.da.Store(storeID)
+		if !ok {
+			return false, errors.Errorf("unknown store %d", storeID)
+		}
+		store.Dead = cmd == "dead"
+		store.Throttled = cmd == "throttled"
+		s.da.SetStore(store)
+	default:
+		return false, errors.Errorf("unknown command %q; type \"help\" for the list of commands", cmd)
+	}
+	return false, nil
+}
+
+// allocate runs the allocator for the action, allocate, remove and rebalance
+// commands.
+func (s *allocatorShell) allocate(
+	w io.Writer, cmd string, replicas []roachpb.ReplicaDescriptor,
+) error {
+	leaseStoreID := replicas[0].StoreID
+	constraints := s.zone.Constraints
+	switch cmd {
+	case "action":
+		desc := &roachpb.RangeDescriptor{Replicas: replicas}
+		action, priority := s.da.ComputeAction(s.zone, desc)
+		fmt.Fprintf(w, "%s (priority %.2f)\n", action, priority)
+	case "allocate":
+		target, err := s.da.AllocateTarget(constraints, replicas, true /* relaxConstraints */)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "add a replica to store %d\n", target.StoreID)
+	case "remove":
+		target, err := s.da.RemoveTarget(replicas, leaseStoreID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "remove the replica from store %d\n", target.StoreID)
+	case "rebalance":
+		target := s.da.RebalanceTarget(constraints, replicas, leaseStoreID)
+		if target == nil {
+			fmt.Fprintln(w, "no rebalance target")
+			return nil
+		}
+		fmt.Fprintf(w, "add a replica to store %d, then remove one\n", target.StoreID)
+	}
+	return nil
+}
+
+// parseReplicas parses the store IDs of the replicas of a range.
+func (s *allocatorShell) parseReplicas(args []string) ([]roachpb.ReplicaDescriptor, error) {
+	if len(args) == 0 {
+		return nil, errors.New("at least one replica is required")
+	}
+	replicas := make([]roachpb.ReplicaDescriptor, len(args))
+	for i, arg := range args {
+		storeID, err := parseStoreID(arg)
+		if err != nil {
+			return nil, err
+		}
+		store, ok := s.da.Store(storeID)
+		if !ok {
+			return nil, errors.Errorf("unknown store %d", storeID)
+		}
+		replicas[i] = roachpb.ReplicaDescriptor{
+			NodeID:    store.Desc.Node.NodeID,
+			StoreID:   storeID,
+			ReplicaID: roachpb.ReplicaID(i + 1),
+		}
+	}
+	return replicas, nil
+}
+
+func (s *allocatorShell) printStores(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 2, 1, 2, ' ', 0)
+	fmt.Fprintln(tw, "store\tnode\tstate\tranges\tleases\tused\tattrs\tlocality")
+	for _, store := range s.da.Stores() {
+		desc := store.Desc
+		state := "live"
+		if store.Dead {
+			state = "dead"
+		} else if store.Throttled {
+			state = "throttled"
+		}
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%d\t%.0f%%\t%s\t%s\n",
+			desc.StoreID, desc.Node.NodeID, state, desc.Capacity.RangeCount,
+			desc.Capacity.LeaseCount, desc.Capacity.FractionUsed()*100,
+			desc.CombinedAttrs(), desc.Node.Locality)
+	}
+	_ = tw.Flush()
+}
+
+func parseStoreID(arg string) (roachpb.StoreID, error) {
+	storeID, err := strconv.ParseInt(arg, 10, 32)
+	if err != nil {
+		return 0, errors.Errorf("invalid store ID %q", arg)
+	}
+	return roachpb.StoreID(storeID), nil
+}
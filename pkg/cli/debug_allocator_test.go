@@ -0,0 +1,79 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/config"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestAllocatorShell(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var stores []storage.StoreHealth
+	for i, attr := range []string{"hdd", "hdd", "ssd", "hdd"} {
+		stores = append(stores, storage.StoreHealth{Desc: roachpb.StoreDescriptor{
+			StoreID:  roachpb.StoreID(i + 1),
+			Attrs:    roachpb.Attributes{Attrs: []string{attr}},
+			Node:     roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i + 1)},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, RangeCount: int32(i)},
+		}})
+	}
+	da := storage.NewDebugAllocator(stores)
+	defer da.Close()
+	shell := &allocatorShell{da: da, zone: config.DefaultZoneConfig()}
+
+	testCases := []struct {
+		cmd      string
+		expected string
+		err      string
+	}{
+		{"allocate 1 2", "add a replica to store 3\n", ""},
+		{"constraints +hdd", "", ""},
+		{"allocate 1 2", "add a replica to store 4\n", ""},
+		{"dead 4", "", ""},
+		{"action 1 2 4", "remove dead (priority 10000.00)\n", ""},
+		{"remove 1 2 4", "remove the replica from store 4\n", ""},
+		{"replicas 0", "", "at least one replica"},
+		{"allocate 5", "", "unknown store 5"},
+		{"frobnicate", "", "unknown command"},
+	}
+	for _, tc := range testCases {
+		var buf bytes.Buffer
+		exit, err := shell.exec(&buf, tc.cmd)
+		if exit {
+			t.Fatalf("%s: unexpected exit", tc.cmd)
+		}
+		if tc.err == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %s", tc.cmd, err)
+			}
+		} else if !testutils.IsError(err, tc.err) {
+			t.Fatalf("%s: expected error %q, got %v", tc.cmd, tc.err, err)
+		}
+		if buf.String() != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.cmd, tc.expected, buf.String())
+		}
+	}
+	if exit, _ := shell.exec(&bytes.Buffer{}, "quit"); !exit {
+		t.Errorf("expected quit to exit")
+	}
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/cli/cliflags"
 	"github.com/cockroachdb/cockroach/pkg/security"
 	"github.com/cockroachdb/cockroach/pkg/server"
+	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
@@ -40,10 +41,11 @@ import (
 )
 
 var maxResults int64
+var splitExpireAfter time.Duration
 
 var connURL, connUser, connHost, connPort, advertiseHost string
 var httpHost, httpPort, connDBName, zoneConfig string
-var zoneDisableReplication bool
+var zoneDisableReplication, zoneAllowUnsafeReplication bool
 var startBackground bool
 var undoFreezeCluster bool
 
@@ -145,6 +147,32 @@ func (b *bytesValue) String() string {
 	return humanizeutil.IBytes(*b.val)
 }
 
+// queuesValue is a comma-separated list of store queues.
+type queuesValue struct {
+	val *[]string
+}
+
+func newQueuesValue(val *[]string) *queuesValue {
+	return &queuesValue{val: val}
+}
+
+func (q *queuesValue) Set(s string) error {
+	names, err := storage.ParseDisabledQueues(s)
+	if err != nil {
+		return err
+	}
+	*q.val = names
+	return nil
+}
+
+func (q *queuesValue) Type() string {
+	return "queues"
+}
+
+func (q *queuesValue) String() string {
+	return strings.Join(*q.val, ",")
+}
+
 type insecureValue struct {
 	ctx   *base.Config
 	isSet bool
@@ -299,6 +327,10 @@ func init() {
 
 		varFlag(f, &serverCfg.Stores, cliflags.Store)
 		durationFlag(f, &serverCfg.RaftTickInterval, cliflags.RaftTickInterval, base.DefaultRaftTickInterval)
+		varFlag(f, newQueuesValue(&serverCfg.DisabledQueues), cliflags.DisableQueues)
+		intFlag(f, &serverCfg.RaftSchedulerWorkers, cliflags.RaftSchedulerWorkers, 0)
+		intFlag(f, &serverCfg.RaftTickBatchSize, cliflags.RaftTickBatchSize, 0)
+		intFlag(f, &serverCfg.MaxReplicasPerStore, cliflags.MaxReplicasPerStore, 0)
 		boolFlag(f, &startBackground, cliflags.Background, false)
 
 		// Usage for the unix socket is odd as we use a real file, whereas
@@ -369,6 +401,7 @@ func init() {
 	zf := setZoneCmd.Flags()
 	stringFlag(zf, &zoneConfig, cliflags.ZoneConfig, "")
 	boolFlag(zf, &zoneDisableReplication, cliflags.ZoneDisableReplication, false)
+	boolFlag(zf, &zoneAllowUnsafeReplication, cliflags.ZoneAllowUnsafeReplication, false)
 
 	varFlag(sqlShellCmd.Flags(), &sqlCtx.execStmts, cliflags.Execute)
 
@@ -403,6 +436,8 @@ func init() {
 		int64Flag(f, &maxResults, cliflags.MaxResults, 1000)
 	}
 
+	durationFlag(splitRangeCmd.Flags(), &splitExpireAfter, cliflags.SplitExpireAfter, 0)
+
 	// Debug commands.
 	{
 		f := debugKeysCmd.Flags()
@@ -93,6 +93,53 @@ func TestRaftTickIntervalFlagValue(t *testing.T) {
 	}
 }
 
+func TestRaftSchedulerFlagValues(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	f := startCmd.Flags()
+	testData := []struct {
+		args               []string
+		workers, batchSize int
+	}{
+		{nil, 0, 0},
+		{[]string{"--raft-scheduler-workers", "8", "--raft-tick-batch-size", "100"}, 8, 100},
+	}
+
+	for i, td := range testData {
+		if err := f.Parse(td.args); err != nil {
+			t.Fatal(err)
+		}
+		if td.workers != serverCfg.RaftSchedulerWorkers {
+			t.Errorf("%d. RaftSchedulerWorkers expected %d, but got %d", i, td.workers, serverCfg.RaftSchedulerWorkers)
+		}
+		if td.batchSize != serverCfg.RaftTickBatchSize {
+			t.Errorf("%d. RaftTickBatchSize expected %d, but got %d", i, td.batchSize, serverCfg.RaftTickBatchSize)
+		}
+	}
+}
+
+func TestMaxReplicasPerStoreFlagValue(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	f := startCmd.Flags()
+	testData := []struct {
+		args     []string
+		expected int
+	}{
+		{nil, 0},
+		{[]string{"--max-replicas-per-store", "1000"}, 1000},
+	}
+
+	for i, td := range testData {
+		if err := f.Parse(td.args); err != nil {
+			t.Fatal(err)
+		}
+		if td.expected != serverCfg.MaxReplicasPerStore {
+			t.Errorf("%d. MaxReplicasPerStore expected %d, but got %d", i, td.expected, serverCfg.MaxReplicasPerStore)
+		}
+	}
+}
+
 func TestHttpHostFlagValue(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
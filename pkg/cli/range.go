@@ -23,6 +23,8 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
@@ -88,7 +90,10 @@ var splitRangeCmd = &cobra.Command{
 	Use:   "split [options] <key>",
 	Short: "splits a range",
 	Long: `
-Splits the range containing <key> at <key>.
+Splits the range containing <key> at <key>. The split is sticky: it is not
+undone by a merge, unless it was made with --expire-after and has expired. If a
+range already starts at <key>, the existing split is made sticky unless it
+already is.
 `,
 	SilenceUsage: true,
 	RunE:         maybeDecorateGRPCError(runSplitRange),
@@ -106,7 +111,11 @@ func runSplitRange(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	defer stopper.Stop()
-	return errors.Wrap(kvDB.AdminSplit(context.Background(), key), "split failed")
+	var expiration hlc.Timestamp
+	if splitExpireAfter > 0 {
+		expiration.WallTime = timeutil.Now().Add(splitExpireAfter).UnixNano()
+	}
+	return errors.Wrap(kvDB.AdminStickySplit(context.Background(), key, expiration), "split failed")
 }
 
 var rangeCmds = []*cobra.Command{
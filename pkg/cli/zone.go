@@ -30,8 +30,11 @@ import (
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 
+	"github.com/cockroachdb/cockroach/pkg/cli/cliflags"
 	"github.com/cockroachdb/cockroach/pkg/config"
 	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/parser"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
@@ -164,8 +167,15 @@ func queryNamespace(conn *sqlConn, parentID sqlbase.ID, name string) (sqlbase.ID
 	}
 }
 
+// timeseriesZoneName is the name under which the zone config for the internal
+// timeseries data is displayed and modified. The zone has no descriptor.
+const timeseriesZoneName = ".timeseries"
+
 func queryDescriptorIDPath(conn *sqlConn, names []string) ([]sqlbase.ID, error) {
 	path := []sqlbase.ID{keys.RootNamespaceID}
+	if len(names) == 1 && names[0] == timeseriesZoneName {
+		return append(path, keys.TimeseriesRangesID), nil
+	}
 	for _, name := range names {
 		id, err := queryNamespace(conn, path[len(path)-1], name)
 		if err != nil {
@@ -177,8 +187,11 @@ func queryDescriptorIDPath(conn *sqlConn, names []string) ([]sqlbase.ID, error)
 }
 
 func parseZoneName(s string) ([]string, error) {
-	if strings.ToLower(s) == ".default" {
+	switch strings.ToLower(s) {
+	case ".default":
 		return nil, nil
+	case timeseriesZoneName:
+		return []string{timeseriesZoneName}, nil
 	}
 	// TODO(knz): we are passing a name that might not be escaped correctly.
 	// See #8389.
@@ -306,8 +319,8 @@ func runLsZones(cmd *cobra.Command, args []string) error {
 	// the corresponding descriptor.
 	var output []string
 	for id := range zones {
-		if id == 0 {
-			// We handle the default zone below.
+		if id == 0 || id == keys.TimeseriesRangesID {
+			// We handle the default and timeseries zones below.
 			continue
 		}
 		desc, ok := descs[id]
@@ -327,10 +340,14 @@ func runLsZones(cmd *cobra.Command, args []string) error {
 	}
 
 	sort.Strings(output)
-	// Ensure the default zone is always printed first.
+	// Ensure the default zone is always printed first, followed by the
+	// timeseries zone.
 	if _, ok := zones[0]; ok {
 		fmt.Println(".default")
 	}
+	if _, ok := zones[keys.TimeseriesRangesID]; ok {
+		fmt.Println(timeseriesZoneName)
+	}
 	for _, o := range output {
 		fmt.Println(o)
 	}
@@ -411,8 +428,21 @@ num_replicas: 3
 constraints: [ssd, -mem]
 EOF
 
+The zone config for the internal timeseries data can be set by specifying
+.timeseries instead of a database or table. For example, to store the
+timeseries data with fewer replicas and a short GC TTL, run:
+$ cockroach zone set .timeseries -f - << EOF
+num_replicas: 1
+gc:
+  ttlseconds: 3600
+EOF
+
 Note that the specified zone config is merged with the existing zone config for
 the database or table.
+
+Lowering the replica count of a zone below 3 is refused if the ranges of the
+zone would then have fewer replicas than they can have on the live nodes of the
+cluster, unless --allow-unsafe-replication is specified.
 `,
 	SilenceUsage: true,
 	RunE:         maybeDecorateGRPCError(runSetZone),
@@ -472,6 +502,7 @@ func runSetZone(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	oldReplicas := zone.NumReplicas
 	// Convert it to proto and marshal it again to put into the table. This is a
 	// bit more tedious than taking protos directly, but yaml is a more widely
 	// understood format.
@@ -488,6 +519,11 @@ func runSetZone(cmd *cobra.Command, args []string) error {
 	if err := zone.Validate(); err != nil {
 		return err
 	}
+	if !zoneAllowUnsafeReplication {
+		if err := checkReplicationSafety(oldReplicas, zone.NumReplicas); err != nil {
+			return err
+		}
+	}
 
 	buf, err := protoutil.Marshal(&zone)
 	if err != nil {
@@ -513,6 +549,61 @@ func runSetZone(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// minSafeReplicas is the number of replicas a range needs to survive the
+// failure of a node.
+const minSafeReplicas = 3
+
+// checkReplicationSafety returns an error if lowering the replica count of a
+// zone from oldReplicas to newReplicas is unsafe given the live stores known
+// to the StorePool of the node the command is connected to; see
+// replicationSafetyError.
+func checkReplicationSafety(oldReplicas, newReplicas int32) error {
+	if newReplicas >= oldReplicas || newReplicas >= minSafeReplicas {
+		return nil
+	}
+	c, stopper, err := getStatusClient()
+	if err != nil {
+		return err
+	}
+	defer stopper.Stop()
+	resp, err := c.StorePool(stopperContext(stopper), &serverpb.StorePoolRequest{})
+	if err != nil {
+		return fmt.Errorf("unable to retrieve the live stores to check the new replica count: %s", err)
+	}
+	return replicationSafetyError(oldReplicas, newReplicas, resp.Stores)
+}
+
+// replicationSafetyError returns an error if lowering the replica count of
+// a zone from oldReplicas to newReplicas would leave its ranges with fewer
+// than minSafeReplicas replicas, and fewer than they can have now. Ranges
+// can have at most one replica on each node with a live store, so lowering
+// the replica count of a zone below the number of live nodes doesn't
+// matter if it is already above it.
+func replicationSafetyError(
+	oldReplicas, newReplicas int32, stores []serverpb.StorePoolStore,
+) error {
+	liveNodes := make(map[roachpb.NodeID]struct{})
+	for _, store := range stores {
+		if !store.Dead {
+			liveNodes[store.NodeID] = struct{}{}
+		}
+	}
+	achievable := func(replicas int32) int {
+		if int(replicas) < len(liveNodes) {
+			return int(replicas)
+		}
+		return len(liveNodes)
+	}
+	if newAchievable := achievable(newReplicas); newAchievable < minSafeReplicas &&
+		newAchievable < achievable(oldReplicas) {
+		return fmt.Errorf("lowering num_replicas from %d to %d would leave the ranges of the zone "+
+			"with %d replica(s) instead of %d on the %d live nodes; use --%s to override",
+			oldReplicas, newReplicas, newAchievable, achievable(oldReplicas), len(liveNodes),
+			cliflags.ZoneAllowUnsafeReplication.Name)
+	}
+	return nil
+}
+
 var zoneCmds = []*cobra.Command{
 	getZoneCmd,
 	lsZonesCmd,
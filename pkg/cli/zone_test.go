@@ -0,0 +1,58 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cli
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestReplicationSafetyError(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// Three live nodes, one of which has two stores, and a dead node.
+	stores := []serverpb.StorePoolStore{
+		{StoreID: 1, NodeID: 1},
+		{StoreID: 2, NodeID: 2},
+		{StoreID: 3, NodeID: 3},
+		{StoreID: 4, NodeID: 3},
+		{StoreID: 5, NodeID: 4, Dead: true},
+	}
+	testCases := []struct {
+		oldReplicas, newReplicas int32
+		stores                   []serverpb.StorePoolStore
+		err                      string
+	}{
+		{5, 3, stores, ""},
+		{3, 1, stores, "from 3 to 1 would leave the ranges of the zone with 1 replica"},
+		{5, 1, stores, "with 1 replica\\(s\\) instead of 3 on the 3 live nodes"},
+		// A single node cluster can't do better than one replica.
+		{3, 1, stores[:1], ""},
+		{3, 1, stores[1:3], "with 1 replica\\(s\\) instead of 2 on the 2 live nodes"},
+	}
+	for _, tc := range testCases {
+		err := replicationSafetyError(tc.oldReplicas, tc.newReplicas, tc.stores)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%d -> %d: unexpected error: %s", tc.oldReplicas, tc.newReplicas, err)
+			}
+		} else if !testutils.IsError(err, tc.err) {
+			t.Errorf("%d -> %d: expected error %q, got %v", tc.oldReplicas, tc.newReplicas, tc.err, err)
+		}
+	}
+}
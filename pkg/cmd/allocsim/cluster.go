@@ -0,0 +1,320 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/config"
+	"github.com/cockroachdb/cockroach/pkg/gossip"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/testutils/gossiputil"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+// simStore is a simulated store. Its capacity is derived from the ranges
+// which have a replica on it whenever it is gossiped.
+type simStore struct {
+	desc     roachpb.StoreDescriptor
+	capacity int64
+}
+
+// simRange is a simulated range. The first replica holds the range lease.
+type simRange struct {
+	rangeID         roachpb.RangeID
+	replicas        []roachpb.ReplicaDescriptor
+	writesPerSecond float64
+}
+
+func (r *simRange) leaseStoreID() roachpb.StoreID {
+	return r.replicas[0].StoreID
+}
+
+// epochStats summarizes the balance of the cluster at the end of an epoch.
+type epochStats struct {
+	moves                            int
+	minRanges, maxRanges             int32
+	meanRanges, stddevRanges         float64
+	meanWrites, stddevWrites         float64
+	minFractionUsed, maxFractionUsed float64
+}
+
+// cluster drives a StorePool and an Allocator against a set of simulated
+// stores and ranges. No replica data is moved: the simulation only tracks
+// which stores hold replicas of which ranges.
+type cluster struct {
+	gossip        *gossip.Gossip
+	storePool     *storage.StorePool
+	allocator     storage.Allocator
+	storeGossiper *gossiputil.StoreGossiper
+	zone          config.ZoneConfig
+	rangeBytes    int64
+	stores        []*simStore // sorted by StoreID
+	storeIDs      []roachpb.StoreID
+	ranges        []*simRange // sorted by RangeID
+	unplaced      int
+	epoch         int
+}
+
+// newCluster creates a simulated cluster from the given description.
+func newCluster(stopper *stop.Stopper, cfg clusterConfig) *cluster {
+	clock := hlc.NewClock(hlc.UnixNano)
+	rpcContext := rpc.NewContext(log.AmbientContext{}, &base.Config{Insecure: true}, clock, stopper)
+	server := rpc.NewServer(rpcContext)
+	g := gossip.New(log.AmbientContext{}, rpcContext, server, nil, stopper, metric.NewRegistry())
+	// NodeID is required for Gossip, so set it to -1 for the cluster Gossip
+	// instance to prevent conflicts with real NodeIDs.
+	g.SetNodeID(-1)
+	storePool := storage.NewStorePool(
+		context.TODO(),
+		g,
+		clock,
+		rpcContext,
+		nil, /* nodeLivenessFn */
+		settings.TestingDurationSetting(storage.TestTimeUntilStoreDeadOff),
+		stopper,
+	)
+	c := &cluster{
+		gossip:    g,
+		storePool: storePool,
+		allocator: storage.MakeAllocator(storePool, storage.AllocatorOptions{
+			AllowRebalance: true,
+			Deterministic:  true,
+		}),
+		storeGossiper: gossiputil.NewStoreGossiper(g),
+		zone:          config.DefaultZoneConfig(),
+		rangeBytes:    cfg.RangeBytes,
+	}
+	c.zone.NumReplicas = int32(cfg.ReplicationFactor)
+
+	var desired []int
+	var nodes []roachpb.NodeID
+	var writes []float64
+	var nextNodeID roachpb.NodeID
+	for _, sc := range cfg.Stores {
+		if sc.Node > nextNodeID {
+			nextNodeID = sc.Node
+		}
+	}
+	for _, sc := range cfg.Stores {
+		var locality roachpb.Locality
+		if sc.Locality != "" {
+			// The locality has already been validated by loadConfig.
+			_ = locality.Set(sc.Locality)
+		}
+		for i := 0; i < sc.Count; i++ {
+			nodeID := sc.Node
+			if nodeID == 0 {
+				nextNodeID++
+				nodeID = nextNodeID
+			}
+			storeID := roachpb.StoreID(len(c.stores) + 1)
+			c.stores = append(c.stores, &simStore{
+				desc: roachpb.StoreDescriptor{
+					StoreID: storeID,
+					Node: roachpb.NodeDescriptor{
+						NodeID:   nodeID,
+						Locality: locality,
+					},
+				},
+				capacity: sc.Capacity,
+			})
+			c.storeIDs = append(c.storeIDs, storeID)
+			desired = append(desired, sc.Ranges)
+			nodes = append(nodes, nodeID)
+			writes = append(writes, sc.WritesPerSecond)
+		}
+	}
+
+	placements, unplaced := placeRanges(desired, nodes, cfg.ReplicationFactor)
+	c.unplaced = unplaced
+	for _, stores := range placements {
+		r := &simRange{
+			rangeID:         roachpb.RangeID(len(c.ranges) + 1),
+			writesPerSecond: writes[stores[0]],
+		}
+		for _, i := range stores {
+			r.replicas = append(r.replicas, roachpb.ReplicaDescriptor{
+				NodeID:  nodes[i],
+				StoreID: c.stores[i].desc.StoreID,
+			})
+		}
+		c.ranges = append(c.ranges, r)
+	}
+	return c
+}
+
+// storeDescriptors returns the current descriptors of all stores, with their
+// capacities computed from the replicas they hold.
+func (c *cluster) storeDescriptors() []roachpb.StoreDescriptor {
+	descs := make([]roachpb.StoreDescriptor, len(c.stores))
+	indexes := make(map[roachpb.StoreID]int, len(c.stores))
+	for i, s := range c.stores {
+		descs[i] = s.desc
+		descs[i].Capacity = roachpb.StoreCapacity{
+			Capacity:  s.capacity,
+			Available: s.capacity,
+		}
+		indexes[s.desc.StoreID] = i
+	}
+	for _, r := range c.ranges {
+		for j, repl := range r.replicas {
+			capacity := &descs[indexes[repl.StoreID]].Capacity
+			capacity.RangeCount++
+			capacity.Available -= c.rangeBytes
+			capacity.WritesPerSecond += r.writesPerSecond
+			if j == 0 {
+				capacity.LeaseCount++
+			}
+		}
+	}
+	for i := range descs {
+		if descs[i].Capacity.Available < 0 {
+			descs[i].Capacity.Available = 0
+		}
+	}
+	return descs
+}
+
+// gossipStores gossips the current descriptors of all stores and waits for
+// the store pool to receive them.
+func (c *cluster) gossipStores() {
+	descs := c.storeDescriptors()
+	c.storeGossiper.GossipWithFunction(c.storeIDs, func() {
+		for i := range descs {
+			if err := c.gossip.AddInfoProto(gossip.MakeStoreKey(descs[i].StoreID), &descs[i], 0); err != nil {
+				log.Fatal(context.TODO(), err)
+			}
+		}
+	})
+}
+
+// runEpoch simulates a single pass of the replicate queue on every store.
+// The store descriptors are gossiped once at the start of the epoch, so the
+// allocator works off of information which is stale by up to an epoch, as it
+// does in a real cluster. Each store then rebalances at most one of the
+// ranges for which it holds the lease. Returns the number of replicas moved.
+func (c *cluster) runEpoch() int {
+	c.epoch++
+	c.gossipStores()
+
+	var moves int
+	for _, storeID := range c.storeIDs {
+		for _, r := range c.ranges {
+			if r.leaseStoreID() == storeID && c.rebalance(r) {
+				moves++
+				break
+			}
+		}
+	}
+	return moves
+}
+
+// rebalance asks the allocator for a rebalance target for the range and, if
+// one is found, adds a replica on it and then removes the replica chosen by
+// the allocator. Returns true if the range's replicas changed.
+func (c *cluster) rebalance(r *simRange) bool {
+	target := c.allocator.RebalanceTarget(c.zone.Constraints, r.replicas, r.leaseStoreID())
+	if target == nil {
+		return false
+	}
+	replicas := append(append([]roachpb.ReplicaDescriptor(nil), r.replicas...),
+		roachpb.ReplicaDescriptor{
+			NodeID:  target.Node.NodeID,
+			StoreID: target.StoreID,
+		})
+	remove, err := c.allocator.RemoveTarget(replicas, r.leaseStoreID())
+	if err != nil || remove.StoreID == target.StoreID {
+		return false
+	}
+	for i, repl := range replicas {
+		if repl.StoreID == remove.StoreID {
+			replicas = append(replicas[:i], replicas[i+1:]...)
+			break
+		}
+	}
+	r.replicas = replicas
+	return true
+}
+
+// stats computes the balance statistics of the cluster.
+func (c *cluster) stats(moves int) epochStats {
+	descs := c.storeDescriptors()
+	s := epochStats{
+		moves:           moves,
+		minRanges:       math.MaxInt32,
+		minFractionUsed: math.MaxFloat64,
+	}
+	for _, desc := range descs {
+		if desc.Capacity.RangeCount < s.minRanges {
+			s.minRanges = desc.Capacity.RangeCount
+		}
+		if desc.Capacity.RangeCount > s.maxRanges {
+			s.maxRanges = desc.Capacity.RangeCount
+		}
+		s.minFractionUsed = math.Min(s.minFractionUsed, desc.Capacity.FractionUsed())
+		s.maxFractionUsed = math.Max(s.maxFractionUsed, desc.Capacity.FractionUsed())
+		s.meanRanges += float64(desc.Capacity.RangeCount)
+		s.meanWrites += desc.Capacity.WritesPerSecond
+	}
+	n := float64(len(descs))
+	s.meanRanges /= n
+	s.meanWrites /= n
+	for _, desc := range descs {
+		d := float64(desc.Capacity.RangeCount) - s.meanRanges
+		s.stddevRanges += d * d
+		d = desc.Capacity.WritesPerSecond - s.meanWrites
+		s.stddevWrites += d * d
+	}
+	s.stddevRanges = math.Sqrt(s.stddevRanges / n)
+	s.stddevWrites = math.Sqrt(s.stddevWrites / n)
+	return s
+}
+
+// printEpochHeader writes the column names of the per-epoch output.
+func printEpochHeader(w *tabwriter.Writer) {
+	fmt.Fprintf(w, "epoch\tmoves\tranges(min/max)\tranges(mean)\tranges(stddev)\twrites(mean)\twrites(stddev)\tused(min/max)\n")
+}
+
+// printEpoch writes the statistics of a single epoch.
+func printEpoch(w *tabwriter.Writer, epoch int, s epochStats) {
+	fmt.Fprintf(w, "%d\t%d\t%d/%d\t%.1f\t%.2f\t%.1f\t%.2f\t%.0f%%/%.0f%%\n",
+		epoch, s.moves, s.minRanges, s.maxRanges, s.meanRanges, s.stddevRanges,
+		s.meanWrites, s.stddevWrites, s.minFractionUsed*100, s.maxFractionUsed*100)
+}
+
+// printStores writes the final state of every store.
+func (c *cluster) printStores(out io.Writer) {
+	w := tabwriter.NewWriter(out, 8, 1, 2, ' ', 0)
+	fmt.Fprintf(w, "store\tnode\tlocality\tranges\tleases\twrites\tused\n")
+	for _, desc := range c.storeDescriptors() {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%d\t%d\t%.1f\t%.0f%%\n",
+			desc.StoreID, desc.Node.NodeID, desc.Node.Locality, desc.Capacity.RangeCount,
+			desc.Capacity.LeaseCount, desc.Capacity.WritesPerSecond, desc.Capacity.FractionUsed()*100)
+	}
+	_ = w.Flush()
+}
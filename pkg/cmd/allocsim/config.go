@@ -0,0 +1,153 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+)
+
+const defaultRangeBytes = 64 << 20 // 64 MiB
+
+// storeConfig describes one or more identical stores of the simulated
+// cluster.
+type storeConfig struct {
+	// Count is the number of stores described by this entry. Defaults to 1.
+	Count int `json:"count"`
+	// Node places the stores on the given node. When zero, each store is
+	// placed on a node of its own.
+	Node roachpb.NodeID `json:"node"`
+	// Locality is the locality of the stores' node, in the same format as the
+	// --locality flag (e.g. "region=us,zone=a").
+	Locality string `json:"locality"`
+	// Capacity is the capacity of each store in bytes.
+	Capacity int64 `json:"capacity"`
+	// Ranges is the number of replicas initially placed on each store.
+	Ranges int `json:"ranges"`
+	// WritesPerSecond is the write load of each range that starts out with a
+	// replica on these stores. The load follows the range as it is moved.
+	WritesPerSecond float64 `json:"writes_per_second"`
+}
+
+// clusterConfig is the synthetic cluster description read by allocsim.
+type clusterConfig struct {
+	// ReplicationFactor is the number of replicas of each range. Defaults to
+	// 3.
+	ReplicationFactor int `json:"replication_factor"`
+	// RangeBytes is the size of every range. Defaults to 64 MiB.
+	RangeBytes int64 `json:"range_bytes"`
+	// Stores lists the stores of the cluster.
+	Stores []storeConfig `json:"stores"`
+}
+
+// loadConfig reads and validates a cluster description from the given file.
+func loadConfig(path string) (clusterConfig, error) {
+	var cfg clusterConfig
+	f, err := os.Open(path)
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return cfg, errors.Wrapf(err, "unable to parse %s", path)
+	}
+
+	if cfg.ReplicationFactor == 0 {
+		cfg.ReplicationFactor = 3
+	}
+	if cfg.RangeBytes == 0 {
+		cfg.RangeBytes = defaultRangeBytes
+	}
+	if len(cfg.Stores) == 0 {
+		return cfg, errors.Errorf("%s: no stores specified", path)
+	}
+	for i := range cfg.Stores {
+		s := &cfg.Stores[i]
+		if s.Count == 0 {
+			s.Count = 1
+		}
+		if s.Count < 0 || s.Capacity <= 0 || s.Ranges < 0 || s.WritesPerSecond < 0 {
+			return cfg, errors.Errorf("%s: invalid store entry %d: %+v", path, i, *s)
+		}
+		if s.Locality != "" {
+			var l roachpb.Locality
+			if err := l.Set(s.Locality); err != nil {
+				return cfg, errors.Wrapf(err, "%s: store entry %d", path, i)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// placeRanges groups the desired replica counts of the stores into ranges of
+// factor replicas each. Replicas of a range are placed on distinct nodes,
+// always preferring the stores with the most replicas left to place. It
+// returns the stores of each range, as indexes into desired, along with the
+// number of replicas which could not be placed.
+func placeRanges(desired []int, nodes []roachpb.NodeID, factor int) ([][]int, int) {
+	remaining := append([]int(nil), desired...)
+	order := make([]int, len(remaining))
+	var placements [][]int
+	for {
+		for i := range order {
+			order[i] = i
+		}
+		sort.Stable(byRemaining{order: order, remaining: remaining})
+
+		var stores []int
+		used := make(map[roachpb.NodeID]struct{}, factor)
+		for _, i := range order {
+			if len(stores) == factor || remaining[i] == 0 {
+				break
+			}
+			if _, ok := used[nodes[i]]; ok {
+				continue
+			}
+			used[nodes[i]] = struct{}{}
+			stores = append(stores, i)
+		}
+		if len(stores) < factor {
+			break
+		}
+		for _, i := range stores {
+			remaining[i]--
+		}
+		placements = append(placements, stores)
+	}
+
+	var unplaced int
+	for _, n := range remaining {
+		unplaced += n
+	}
+	return placements, unplaced
+}
+
+// byRemaining sorts store indexes by their number of replicas left to place,
+// in descending order.
+type byRemaining struct {
+	order     []int
+	remaining []int
+}
+
+func (b byRemaining) Len() int      { return len(b.order) }
+func (b byRemaining) Swap(i, j int) { b.order[i], b.order[j] = b.order[j], b.order[i] }
+func (b byRemaining) Less(i, j int) bool {
+	return b.remaining[b.order[i]] > b.remaining[b.order[j]]
+}
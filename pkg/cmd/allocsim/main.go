@@ -0,0 +1,117 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+/*
+Command allocsim drives the replica Allocator and StorePool against a
+synthetic cluster in order to evaluate rebalancing heuristics without
+starting real nodes.
+
+The cluster is described by a JSON file listing its stores along with their
+localities, capacities and initial replica counts. The ranges are given a
+write load which follows them as they are rebalanced. For example:
+
+    {
+      "replication_factor": 3,
+      "range_bytes": 67108864,
+      "stores": [
+        {"count": 3, "locality": "region=us", "capacity": 68719476736, "ranges": 200},
+        {"count": 2, "locality": "region=eu", "capacity": 68719476736, "ranges": 50, "writes_per_second": 10}
+      ]
+    }
+
+The simulation proceeds in epochs. At the start of each epoch every store is
+gossiped, after which each store asks the allocator for a rebalance target
+for the ranges it holds the lease for and moves at most one replica. The
+balance of the cluster is printed after each epoch and the simulation stops
+once an epoch passes without any replica being moved.
+
+To run:
+
+    go install github.com/cockroachdb/cockroach/pkg/cmd/allocsim
+    allocsim -config=pkg/cmd/allocsim/example.json
+
+The allocator balances range counts by default. Set
+COCKROACH_REBALANCE_MODE=write-load to balance write load instead.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+var configFile = flag.String("config", "", "JSON file describing the simulated cluster.")
+var maxEpoch = flag.Int("maxEpoch", 1000, "Maximum epoch to simulate.")
+var printStores = flag.Bool("stores", true, "Print the final state of each store.")
+
+func main() {
+	flag.Parse()
+	if *configFile == "" {
+		fmt.Fprintf(os.Stderr, "usage: allocsim -config=<file>\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	c := newCluster(stopper, cfg)
+	fmt.Printf("Simulating %d stores and %d ranges with %d replicas each.\n",
+		len(c.stores), len(c.ranges), cfg.ReplicationFactor)
+	if c.unplaced > 0 {
+		fmt.Printf("Unable to place %d replicas on distinct nodes.\n", c.unplaced)
+	}
+	if len(c.ranges) == 0 {
+		return
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 8, 1, 2, ' ', 0)
+	printEpochHeader(w)
+	printEpoch(w, 0, c.stats(0))
+	var totalMoves int
+	converged := false
+	for c.epoch < *maxEpoch {
+		moves := c.runEpoch()
+		totalMoves += moves
+		printEpoch(w, c.epoch, c.stats(moves))
+		_ = w.Flush()
+		if moves == 0 {
+			converged = true
+			break
+		}
+	}
+	_ = w.Flush()
+
+	fmt.Println()
+	if converged {
+		fmt.Printf("Converged after %d epochs and %d replica moves.\n", c.epoch-1, totalMoves)
+	} else {
+		fmt.Printf("Did not converge within %d epochs; %d replica moves.\n", *maxEpoch, totalMoves)
+	}
+	if *printStores {
+		fmt.Println()
+		c.printStores(os.Stdout)
+	}
+}
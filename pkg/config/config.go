@@ -172,6 +172,14 @@ func (z ZoneConfig) Validate() error {
 		return fmt.Errorf("RangeMinBytes %d is greater than or equal to RangeMaxBytes %d",
 			z.RangeMinBytes, z.RangeMaxBytes)
 	}
+	for i, preference := range z.LeasePreferences {
+		if len(preference.Constraints) == 0 {
+			return fmt.Errorf("lease preference %d must specify at least one constraint", i)
+		}
+	}
+	if z.SnapshotMaxRate < 0 {
+		return fmt.Errorf("SnapshotMaxRate %d must not be negative", z.SnapshotMaxRate)
+	}
 	return nil
 }
 
@@ -334,9 +342,31 @@ func (s SystemConfig) GetLargestObjectID(maxID uint32) (uint32, error) {
 	return uint32(id), nil
 }
 
+// hasZoneConfig returns whether a zone config has been set for the object
+// with 'id' itself, as opposed to being inherited.
+func (s SystemConfig) hasZoneConfig(id uint32) bool {
+	return s.GetValue(keys.MakeZoneKey(id)) != nil
+}
+
+// isTimeseriesKey returns whether 'key' is part of the internal timeseries
+// data.
+func isTimeseriesKey(key roachpb.RKey) bool {
+	return !key.Less(tsStartKey) && key.Less(tsEndKey)
+}
+
+var (
+	tsStartKey = roachpb.RKey(keys.TimeseriesPrefix)
+	tsEndKey   = roachpb.RKey(keys.TimeseriesPrefix.PrefixEnd())
+)
+
 // GetZoneConfigForKey looks up the zone config for the range containing 'key'.
 // It is the caller's responsibility to ensure that the range does not need to be split.
 func (s SystemConfig) GetZoneConfigForKey(key roachpb.RKey) (ZoneConfig, error) {
+	if isTimeseriesKey(key) {
+		// The timeseries data inherits the default zone config unless it
+		// has been given its own.
+		return s.getZoneConfigForID(keys.TimeseriesRangesID)
+	}
 	objectID, ok := ObjectIDForKey(key)
 	if !ok {
 		// Not in the structured data namespace.
@@ -362,12 +392,22 @@ func (s SystemConfig) getZoneConfigForID(id uint32) (ZoneConfig, error) {
 
 // ComputeSplitKeys takes a start and end key and returns an array of keys
 // at which to split the span [start, end).
-// The only required splits are at each user table prefix.
+// The required splits are at each user table prefix and, if the timeseries
+// data has a zone config of its own, around the timeseries data.
 func (s SystemConfig) ComputeSplitKeys(startKey, endKey roachpb.RKey) []roachpb.RKey {
+	var splitKeys []roachpb.RKey
+	if s.hasZoneConfig(keys.TimeseriesRangesID) {
+		for _, key := range []roachpb.RKey{tsStartKey, tsEndKey} {
+			if startKey.Less(key) && key.Less(endKey) {
+				splitKeys = append(splitKeys, key)
+			}
+		}
+	}
+
 	tableStart := roachpb.RKey(keys.SystemConfigTableDataMax)
 	if !tableStart.Less(endKey) {
-		// This range is before the user tables span: no required splits.
-		return nil
+		// This range is before the user tables span: no further splits.
+		return splitKeys
 	}
 
 	startID, ok := ObjectIDForKey(startKey)
@@ -388,7 +428,6 @@ func (s SystemConfig) ComputeSplitKeys(startKey, endKey roachpb.RKey) []roachpb.
 	// that there are two disjoint sets of sequential keys: non-system reserved
 	// tables have sequential IDs, as do user tables, but the two ranges contain a
 	// gap.
-	var splitKeys []roachpb.RKey
 	var key roachpb.RKey
 
 	// appendSplitKeys generates all possible split keys between the given range
@@ -415,7 +454,7 @@ func (s SystemConfig) ComputeSplitKeys(startKey, endKey roachpb.RKey) []roachpb.
 		endID, err := s.GetLargestObjectID(keys.MaxReservedDescID)
 		if err != nil {
 			log.Errorf(context.TODO(), "unable to determine largest reserved object ID from system config: %s", err)
-			return nil
+			return splitKeys
 		}
 		appendSplitKeys(startID, endID)
 		startID = keys.MaxReservedDescID + 1
@@ -425,7 +464,7 @@ func (s SystemConfig) ComputeSplitKeys(startKey, endKey roachpb.RKey) []roachpb.
 	endID, err := s.GetLargestObjectID(0)
 	if err != nil {
 		log.Errorf(context.TODO(), "unable to determine largest object ID from system config: %s", err)
-		return nil
+		return splitKeys
 	}
 	appendSplitKeys(startID, endID)
 
@@ -31,6 +31,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util/encoding"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
 )
 
 func plainKV(k, v string) roachpb.KeyValue {
@@ -302,6 +303,85 @@ func TestComputeSplits(t *testing.T) {
 	}
 }
 
+func TestComputeSplitsTimeseries(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	tsStart := roachpb.RKey(keys.TimeseriesPrefix)
+	tsEnd := roachpb.RKey(keys.TimeseriesPrefix.PrefixEnd())
+	tsZone := kv(sqlbase.MakeZoneKey(keys.TimeseriesRangesID), nil)
+	systemEnd := roachpb.RKey(keys.SystemConfigTableDataMax)
+
+	testCases := []struct {
+		values     []roachpb.KeyValue
+		start, end roachpb.RKey
+		splits     []roachpb.RKey
+	}{
+		// Without a timeseries zone config, no splits are required.
+		{nil, roachpb.RKeyMin, systemEnd, nil},
+		// With one, the timeseries data is split into ranges of its own.
+		{[]roachpb.KeyValue{tsZone}, roachpb.RKeyMin, systemEnd, []roachpb.RKey{tsStart, tsEnd}},
+		{[]roachpb.KeyValue{tsZone}, tsStart, systemEnd, []roachpb.RKey{tsEnd}},
+		{[]roachpb.KeyValue{tsZone}, roachpb.RKeyMin, tsEnd, []roachpb.RKey{tsStart}},
+		{[]roachpb.KeyValue{tsZone}, tsStart, tsEnd, nil},
+		{[]roachpb.KeyValue{tsZone}, keys.MakeTablePrefix(keys.MaxReservedDescID + 1), roachpb.RKeyMax, nil},
+	}
+
+	cfg := config.SystemConfig{}
+	for tcNum, tc := range testCases {
+		cfg.Values = tc.values
+		splits := cfg.ComputeSplitKeys(tc.start, tc.end)
+		if !reflect.DeepEqual(splits, tc.splits) {
+			t.Errorf("#%d: bad splits:\ngot: %v\nexpected: %v", tcNum, splits, tc.splits)
+		}
+	}
+}
+
+func TestGetZoneConfigForTimeseriesKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	config.TestingSetupZoneConfigHook(stopper)
+
+	defaultZone := config.DefaultZoneConfig()
+	config.TestingSetZoneConfig(keys.RootNamespaceID, defaultZone)
+
+	tsKey := testutils.MakeKey(keys.TimeseriesPrefix, roachpb.Key("foo"))
+
+	cfg := config.SystemConfig{}
+	zone, err := cfg.GetZoneConfigForKey(roachpb.RKey(tsKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&zone, &defaultZone) {
+		t.Fatalf("expected the default zone config, got %+v", zone)
+	}
+	if splits := cfg.ComputeSplitKeys(roachpb.RKeyMin, roachpb.RKey(keys.SystemConfigTableDataMax)); splits != nil {
+		t.Fatalf("unexpected splits %v", splits)
+	}
+
+	tsZone := defaultZone
+	tsZone.NumReplicas = 1
+	tsZone.GC.TTLSeconds = 3600
+	config.TestingSetZoneConfig(keys.TimeseriesRangesID, tsZone)
+
+	zone, err = cfg.GetZoneConfigForKey(roachpb.RKey(tsKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&zone, &tsZone) {
+		t.Fatalf("expected the timeseries zone config %+v, got %+v", tsZone, zone)
+	}
+	// Keys outside of the timeseries data are unaffected.
+	zone, err = cfg.GetZoneConfigForKey(roachpb.RKey(keys.SystemConfigTableDataMax))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(&zone, &defaultZone) {
+		t.Fatalf("expected the default zone config, got %+v", zone)
+	}
+}
+
 func TestZoneConfigValidate(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -340,6 +420,14 @@ func TestZoneConfigValidate(t *testing.T) {
 			},
 			"is greater than or equal to RangeMaxBytes",
 		},
+		{
+			config.ZoneConfig{
+				NumReplicas:     1,
+				RangeMaxBytes:   config.DefaultZoneConfig().RangeMaxBytes,
+				SnapshotMaxRate: -1,
+			},
+			"SnapshotMaxRate -1 must not be negative",
+		},
 	}
 	for i, c := range testCases {
 		err := c.cfg.Validate()
@@ -409,3 +497,46 @@ constraints: [foo, +duck=foo, -duck=foo]
 		t.Errorf("yaml.Unmarshal(%q) = %+v; not %+v", body, unmarshaled, original)
 	}
 }
+
+// TestZoneConfigLeasePreferencesYAML makes sure that lease preferences are
+// correctly marshaled to YAML and back.
+func TestZoneConfigLeasePreferencesYAML(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	original := config.ZoneConfig{
+		NumReplicas: 3,
+		LeasePreferences: []config.Constraints{
+			{Constraints: []config.Constraint{
+				{Type: config.Constraint_REQUIRED, Key: "region", Value: "us"},
+			}},
+			{Constraints: []config.Constraint{
+				{Type: config.Constraint_POSITIVE, Value: "ssd"},
+			}},
+		},
+	}
+
+	expected := `range_min_bytes: 0
+range_max_bytes: 0
+gc:
+  ttlseconds: 0
+num_replicas: 3
+constraints: []
+lease_preferences: [[+region=us], [ssd]]
+`
+
+	body, err := yaml.Marshal(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != expected {
+		t.Fatalf("yaml.Marshal(%+v) = %s; not %s", original, body, expected)
+	}
+
+	var unmarshaled config.ZoneConfig
+	if err := yaml.Unmarshal(body, &unmarshaled); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(unmarshaled.LeasePreferences, original.LeasePreferences) {
+		t.Errorf("yaml.Unmarshal(%q) = %+v; not %+v", body, unmarshaled, original)
+	}
+}
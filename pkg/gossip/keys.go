@@ -72,6 +72,10 @@ const (
 	// The value if a config.SystemConfig which holds all key/value
 	// pairs in the system DB span.
 	KeySystemConfig = "system-db"
+
+	// KeySettingPrefix is the key prefix for gossiping cluster settings. The
+	// suffix is the name of the setting and the value is its encoded value.
+	KeySettingPrefix = "setting"
 )
 
 // MakeKey creates a canonical key under which to gossip a piece of
@@ -108,3 +112,8 @@ func MakeStoreKey(storeID roachpb.StoreID) string {
 func MakeDeadReplicasKey(storeID roachpb.StoreID) string {
 	return MakeKey(KeyDeadReplicasPrefix, storeID.String())
 }
+
+// MakeSettingKey returns the gossip key for the given cluster setting.
+func MakeSettingKey(name string) string {
+	return MakeKey(KeySettingPrefix, name)
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 )
 
 const (
@@ -244,6 +245,7 @@ func (b *Batch) fillResults() error {
 			case *roachpb.EndTransactionRequest:
 			case *roachpb.AdminMergeRequest:
 			case *roachpb.AdminSplitRequest:
+			case *roachpb.AdminUnsplitRequest:
 			case *roachpb.AdminTransferLeaseRequest:
 			case *roachpb.HeartbeatTxnRequest:
 			case *roachpb.GCRequest:
@@ -256,6 +258,7 @@ func (b *Batch) fillResults() error {
 			case *roachpb.RequestLeaseRequest:
 			case *roachpb.CheckConsistencyRequest:
 			case *roachpb.ChangeFrozenRequest:
+			case *roachpb.ClearRangeRequest:
 			}
 			// Fill up the resume span.
 			if result.Err == nil && reply != nil && reply.Header().ResumeSpan != nil {
@@ -548,6 +551,23 @@ func (b *Batch) DelRange(s, e interface{}, returnKeys bool) {
 	b.initResult(1, 0, notRaw, nil)
 }
 
+// clearRange is only exported on DB. It is here for symmetry with the
+// other operations.
+func (b *Batch) clearRange(s, e interface{}) {
+	begin, err := marshalKey(s)
+	if err != nil {
+		b.initResult(0, 0, notRaw, err)
+		return
+	}
+	end, err := marshalKey(e)
+	if err != nil {
+		b.initResult(0, 0, notRaw, err)
+		return
+	}
+	b.appendReqs(roachpb.NewClearRange(begin, end))
+	b.initResult(1, 0, notRaw, nil)
+}
+
 // adminMerge is only exported on DB. It is here for symmetry with the
 // other operations.
 func (b *Batch) adminMerge(key interface{}) {
@@ -567,7 +587,7 @@ func (b *Batch) adminMerge(key interface{}) {
 
 // adminSplit is only exported on DB. It is here for symmetry with the
 // other operations.
-func (b *Batch) adminSplit(splitKey interface{}) {
+func (b *Batch) adminSplit(splitKey interface{}, sticky bool, expiration hlc.Timestamp) {
 	k, err := marshalKey(splitKey)
 	if err != nil {
 		b.initResult(0, 0, notRaw, err)
@@ -577,12 +597,31 @@ func (b *Batch) adminSplit(splitKey interface{}) {
 		Span: roachpb.Span{
 			Key: k,
 		},
+		Sticky:         sticky,
+		ExpirationTime: expiration,
 	}
 	req.SplitKey = k
 	b.appendReqs(req)
 	b.initResult(1, 0, notRaw, nil)
 }
 
+// adminUnsplit is only exported on DB. It is here for symmetry with the
+// other operations.
+func (b *Batch) adminUnsplit(splitKey interface{}) {
+	k, err := marshalKey(splitKey)
+	if err != nil {
+		b.initResult(0, 0, notRaw, err)
+		return
+	}
+	req := &roachpb.AdminUnsplitRequest{
+		Span: roachpb.Span{
+			Key: k,
+		},
+	}
+	b.appendReqs(req)
+	b.initResult(1, 0, notRaw, nil)
+}
+
 // adminTransferLease is only exported on DB. It is here for symmetry with the
 // other operations.
 func (b *Batch) adminTransferLease(key interface{}, target roachpb.StoreID) {
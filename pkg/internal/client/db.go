@@ -25,6 +25,7 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/retry"
 	"github.com/cockroachdb/cockroach/pkg/util/tracing"
@@ -348,6 +349,19 @@ func (db *DB) DelRange(ctx context.Context, begin, end interface{}) error {
 	return getOneErr(db.Run(ctx, b), b)
 }
 
+// ClearRange removes all the keys between begin (inclusive) and end
+// (exclusive), and their history, without a transaction. Unlike DelRange, it
+// doesn't leave deletion tombstones behind and is meant for dropping large
+// amounts of data nobody reads any more. It fails if the span contains
+// intents of any transaction.
+//
+// key can be either a byte slice or a string.
+func (db *DB) ClearRange(ctx context.Context, begin, end interface{}) error {
+	b := &Batch{}
+	b.clearRange(begin, end)
+	return getOneErr(db.Run(ctx, b), b)
+}
+
 // AdminMerge merges the range containing key and the subsequent
 // range. After the merge operation is complete, the range containing
 // key will contain all of the key/value pairs of the subsequent range
@@ -365,7 +379,33 @@ func (db *DB) AdminMerge(ctx context.Context, key interface{}) error {
 // key can be either a byte slice or a string.
 func (db *DB) AdminSplit(ctx context.Context, splitKey interface{}) error {
 	b := &Batch{}
-	b.adminSplit(splitKey)
+	b.adminSplit(splitKey, false /* sticky */, hlc.ZeroTimestamp)
+	return getOneErr(db.Run(ctx, b), b)
+}
+
+// AdminStickySplit splits the range at splitkey like AdminSplit, and marks
+// the split as intended by an operator: the split key is not removed by a
+// merge until the expiration, or ever if the expiration is zero. If a range
+// already starts at splitKey, the existing split is marked instead, unless it
+// already is sticky for at least as long.
+//
+// key can be either a byte slice or a string.
+func (db *DB) AdminStickySplit(
+	ctx context.Context, splitKey interface{}, expiration hlc.Timestamp,
+) error {
+	b := &Batch{}
+	b.adminSplit(splitKey, true /* sticky */, expiration)
+	return getOneErr(db.Run(ctx, b), b)
+}
+
+// AdminUnsplit removes the sticky bit of the split point at splitKey, which
+// allows the split to be removed by a merge again. It fails if no range
+// starts at splitKey.
+//
+// key can be either a byte slice or a string.
+func (db *DB) AdminUnsplit(ctx context.Context, splitKey interface{}) error {
+	b := &Batch{}
+	b.adminUnsplit(splitKey)
 	return getOneErr(db.Run(ctx, b), b)
 }
 
@@ -370,6 +370,8 @@ func TestCommonMethods(t *testing.T) {
 		key{batchType, "MustPErr"}:             {},
 		key{dbType, "AdminMerge"}:              {},
 		key{dbType, "AdminSplit"}:              {},
+		key{dbType, "AdminStickySplit"}:        {},
+		key{dbType, "AdminUnsplit"}:            {},
 		key{dbType, "AdminTransferLease"}:      {},
 		key{dbType, "CheckConsistency"}:        {},
 		key{dbType, "Run"}:                     {},
@@ -17,9 +17,12 @@
 package client
 
 import (
+	"time"
+
 	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
 
 // Sender is the interface used to call into a Cockroach instance.
@@ -77,3 +80,22 @@ func Wrap(sender Sender, f func(roachpb.BatchRequest) roachpb.BatchRequest) Send
 		return sender.Send(ctx, f(ba))
 	})
 }
+
+// WaitForThrottledRetry waits for the backoff suggested by a ThrottledError
+// before the throttled batch is sent again. It returns false without waiting
+// if the context's deadline expires before the backoff does, and returns
+// false as well if the context is canceled while waiting.
+func WaitForThrottledRetry(ctx context.Context, tErr *roachpb.ThrottledError) bool {
+	backoff := tErr.RetryAfter()
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(timeutil.Now().Add(backoff)) {
+		return false
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
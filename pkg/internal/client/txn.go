@@ -694,6 +694,16 @@ func (txn *Txn) send(ba roachpb.BatchRequest) (*roachpb.BatchResponse, *roachpb.
 	}
 
 	br, pErr := txn.sendInternal(ba)
+	// A throttled batch was rejected by an overloaded store before being
+	// evaluated, so it is resent as is once the suggested backoff has passed.
+	for pErr != nil {
+		tErr, ok := pErr.GetDetail().(*roachpb.ThrottledError)
+		if !ok || !WaitForThrottledRetry(txn.Context, tErr) {
+			break
+		}
+		log.VEventf(txn.Context, 2, "resending throttled batch: %s", tErr.Reason)
+		br, pErr = txn.sendInternal(ba)
+	}
 	if elideEndTxn && pErr == nil {
 		// Check that read only transactions do not violate their deadline. This can NOT
 		// happen since the txn deadline is normally updated when it is about to expire
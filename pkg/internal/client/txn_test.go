@@ -29,6 +29,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
 
@@ -376,6 +377,50 @@ func TestCommitTransactionOnce(t *testing.T) {
 	}
 }
 
+// TestTxnResendsThrottledBatch verifies that a batch rejected with a
+// ThrottledError is resent once the suggested backoff has passed, unless the
+// transaction's context expires first.
+func TestTxnResendsThrottledBatch(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	const retryAfter = 10 * time.Millisecond
+	count := 0
+	db := NewDB(newTestSender(func(ba roachpb.BatchRequest) (*roachpb.BatchResponse, *roachpb.Error) {
+		count++
+		if count <= 2 {
+			return nil, roachpb.NewError(roachpb.NewThrottledError(retryAfter, "test"))
+		}
+		return ba.CreateReply(), nil
+	}, nil))
+
+	start := timeutil.Now()
+	if err := db.Txn(context.TODO(), func(txn *Txn) error {
+		return txn.Put("a", "b")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Two throttled attempts, the successful put and the commit.
+	if count != 4 {
+		t.Errorf("expected 4 sent batches, got %d", count)
+	}
+	if elapsed := timeutil.Since(start); elapsed < 2*retryAfter {
+		t.Errorf("expected the txn to back off for at least %s, took %s", 2*retryAfter, elapsed)
+	}
+
+	// A context expiring before the backoff returns the error right away.
+	count = 0
+	ctx, cancel := context.WithTimeout(context.Background(), retryAfter/2)
+	defer cancel()
+	err := db.Txn(ctx, func(txn *Txn) error {
+		return txn.Put("a", "b")
+	})
+	if _, ok := err.(*roachpb.ThrottledError); !ok {
+		t.Errorf("expected a ThrottledError, got %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected a single sent batch, got %d", count)
+	}
+}
+
 // TestAbortReadOnlyTransaction verifies that aborting a read-only
 // transaction does not prompt an EndTransaction call.
 func TestAbortReadOnlyTransaction(t *testing.T) {
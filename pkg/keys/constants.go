@@ -106,6 +106,10 @@ var (
 	LocalRangeFrozenStatusSuffix = []byte("fzn-")
 	// localRangeLastGCSuffix is the suffix for the last GC.
 	LocalRangeLastGCSuffix = []byte("lgc-")
+	// LocalRangeAppliedStateSuffix is the suffix for the range applied state
+	// key, which supersedes the raft applied index, lease applied index and
+	// raft truncated state keys.
+	LocalRangeAppliedStateSuffix = []byte("rask")
 	// LocalRaftAppliedIndexSuffix is the suffix for the raft applied index.
 	LocalRaftAppliedIndexSuffix = []byte("rfta")
 	// localRaftTombstoneSuffix is the suffix for the raft tombstone.
@@ -144,6 +148,9 @@ var (
 	// LocalRangeReplicaDestroyedErrorSuffix is the suffix for a range's replica
 	// destroyed error (for marking replicas as dead).
 	LocalRangeReplicaDestroyedErrorSuffix = []byte("rrde")
+	// LocalRangePoisonedEntrySuffix is the suffix for the raft entry a
+	// range's replica is halted on, or which was discarded by an operator.
+	LocalRangePoisonedEntrySuffix = []byte("rpse")
 
 	// LocalRangePrefix is the prefix identifying per-range data indexed
 	// by range key (either start key, or some key in the range). The
@@ -222,6 +229,10 @@ var (
 	UpdateCheckPrefix  = roachpb.Key(makeKey(SystemPrefix, roachpb.RKey("update-")))
 	UpdateCheckCluster = roachpb.Key(makeKey(UpdateCheckPrefix, roachpb.RKey("cluster")))
 
+	// SettingPrefix is the key prefix for the values of cluster settings
+	// changed at runtime.
+	SettingPrefix = roachpb.Key(makeKey(SystemPrefix, roachpb.RKey("setting-")))
+
 	// TableDataMin is the start of the range of table data keys.
 	TableDataMin = roachpb.Key(encoding.EncodeVarintAscending(nil, math.MinInt64))
 	// TableDataMin is the end of the range of table data keys.
@@ -274,4 +285,16 @@ const (
 	EventLogTableID   = 12
 	RangeEventTableID = 13
 	UITableID         = 14
+
+	// TimeseriesRangesID is the pseudo-ID under which the zone config for
+	// the internal timeseries data (TimeseriesPrefix) is stored. There is no
+	// descriptor with this ID.
+	// NOTE: IDs must be <= MaxReservedDescID.
+	TimeseriesRangesID = 15
+
+	// ZonesTablePrimaryIndexID and ZonesTableConfigColumnID are the IDs of
+	// the primary index and the config column of the system.zones table,
+	// which the packages below sql need to look up zone configs.
+	ZonesTablePrimaryIndexID = 1
+	ZonesTableConfigColumnID = 2
 )
@@ -76,6 +76,11 @@ func NodeLastUsageReportKey(nodeID roachpb.NodeID) roachpb.Key {
 	return encoding.EncodeUvarintAscending(prefix, uint64(nodeID))
 }
 
+// SettingKey returns the key for the value of the named cluster setting.
+func SettingKey(name string) roachpb.Key {
+	return roachpb.Key(makeKey(SettingPrefix, roachpb.RKey(name)))
+}
+
 func makePrefixWithRangeID(prefix []byte, rangeID roachpb.RangeID, infix roachpb.RKey) roachpb.Key {
 	// Size the key buffer so that it is large enough for most callers.
 	key := make(roachpb.Key, 0, 32)
@@ -172,6 +177,12 @@ func RaftTombstoneKey(rangeID roachpb.RangeID) roachpb.Key {
 	return MakeRangeIDReplicatedKey(rangeID, LocalRaftTombstoneSuffix, nil)
 }
 
+// RangeAppliedStateKey returns a system-local key for the range applied
+// state key.
+func RangeAppliedStateKey(rangeID roachpb.RangeID) roachpb.Key {
+	return MakeRangeIDReplicatedKey(rangeID, LocalRangeAppliedStateSuffix, nil)
+}
+
 // RaftAppliedIndexKey returns a system-local key for a raft applied index.
 func RaftAppliedIndexKey(rangeID roachpb.RangeID) roachpb.Key {
 	return MakeRangeIDReplicatedKey(rangeID, LocalRaftAppliedIndexSuffix, nil)
@@ -277,6 +288,12 @@ func RangeReplicaDestroyedErrorKey(rangeID roachpb.RangeID) roachpb.Key {
 	return MakeRangeIDUnreplicatedKey(rangeID, LocalRangeReplicaDestroyedErrorSuffix, nil)
 }
 
+// RangePoisonedEntryKey returns a range-local key for the poisoned raft
+// entry of the range's replica.
+func RangePoisonedEntryKey(rangeID roachpb.RangeID) roachpb.Key {
+	return MakeRangeIDUnreplicatedKey(rangeID, LocalRangePoisonedEntrySuffix, nil)
+}
+
 // MakeRangeKey creates a range-local key based on the range
 // start key, metadata key suffix, and optional detail (e.g. the
 // transaction ID for a txn record, etc.).
@@ -546,6 +563,14 @@ func MakeTablePrefix(tableID uint32) []byte {
 	return encoding.EncodeUvarintAscending(nil, uint64(tableID))
 }
 
+// MakeZoneKey returns the key for 'id's entry in the system.zones table.
+func MakeZoneKey(id uint32) roachpb.Key {
+	k := MakeTablePrefix(ZonesTableID)
+	k = encoding.EncodeUvarintAscending(k, ZonesTablePrimaryIndexID)
+	k = encoding.EncodeUvarintAscending(k, uint64(id))
+	return MakeFamilyKey(k, ZonesTableConfigColumnID)
+}
+
 // DecodeTablePrefix validates that the given key has a table prefix, returning
 // the remainder of the key (with the prefix removed) and the decoded descriptor
 // ID of the table.
@@ -38,12 +38,14 @@ var allExternalMethods = [...]roachpb.Request{
 	roachpb.Increment:          &roachpb.IncrementRequest{},
 	roachpb.Delete:             &roachpb.DeleteRequest{},
 	roachpb.DeleteRange:        &roachpb.DeleteRangeRequest{},
+	roachpb.ClearRange:         &roachpb.ClearRangeRequest{},
 	roachpb.Scan:               &roachpb.ScanRequest{},
 	roachpb.ReverseScan:        &roachpb.ReverseScanRequest{},
 	roachpb.BeginTransaction:   &roachpb.BeginTransactionRequest{},
 	roachpb.EndTransaction:     &roachpb.EndTransactionRequest{},
 	roachpb.AdminSplit:         &roachpb.AdminSplitRequest{},
 	roachpb.AdminMerge:         &roachpb.AdminMergeRequest{},
+	roachpb.AdminUnsplit:       &roachpb.AdminUnsplitRequest{},
 	roachpb.AdminTransferLease: &roachpb.AdminTransferLeaseRequest{},
 	roachpb.CheckConsistency:   &roachpb.CheckConsistencyRequest{},
 	roachpb.RangeLookup:        &roachpb.RangeLookupRequest{},
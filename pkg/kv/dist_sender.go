@@ -31,6 +31,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/retry"
@@ -96,6 +97,10 @@ type DistSender struct {
 	rpcContext       *rpc.Context
 	rpcRetryOptions  retry.Options
 	sendNextTimeout  time.Duration
+	// readUncommittedRangeLookups, if set, makes the DistSender re-resolve
+	// descriptors with READ_UNCOMMITTED range lookups after a
+	// RangeKeyMismatchError.
+	readUncommittedRangeLookups bool
 }
 
 var _ client.Sender = &DistSender{}
@@ -128,6 +133,14 @@ type DistSenderConfig struct {
 	RPCContext        *rpc.Context
 	RangeDescriptorDB RangeDescriptorDB
 	SendNextTimeout   time.Duration
+	// ReadUncommittedRangeLookups makes the DistSender re-resolve a stale
+	// range descriptor with a READ_UNCOMMITTED range lookup when it suspects
+	// an in-progress split, i.e. after a RangeKeyMismatchError which didn't
+	// carry a usable replacement descriptor. Such lookups return the
+	// descriptor written by the split's intent on the meta record, shortening
+	// the window in which requests bounce between the two halves of a split
+	// until the split's intents are resolved.
+	ReadUncommittedRangeLookups bool
 }
 
 // NewDistSender returns a batch.Sender instance which connects to the
@@ -197,6 +210,7 @@ func NewDistSender(cfg *DistSenderConfig, g *gossip.Gossip) *DistSender {
 	} else {
 		ds.sendNextTimeout = defaultSendNextTimeout
 	}
+	ds.readUncommittedRangeLookups = cfg.ReadUncommittedRangeLookups
 
 	if g != nil {
 		g.RegisterCallback(gossip.KeyFirstRangeDescriptor,
@@ -230,10 +244,17 @@ func NewDistSender(cfg *DistSenderConfig, g *gossip.Gossip) *DistSender {
 // retry logic here; this is not an issue since the lookup performs a
 // single inconsistent read only.
 func (ds *DistSender) RangeLookup(
-	ctx context.Context, key roachpb.RKey, desc *roachpb.RangeDescriptor, useReverseScan bool,
+	ctx context.Context,
+	key roachpb.RKey,
+	desc *roachpb.RangeDescriptor,
+	useReverseScan bool,
+	readUncommitted bool,
 ) ([]roachpb.RangeDescriptor, []roachpb.RangeDescriptor, *roachpb.Error) {
 	ba := roachpb.BatchRequest{}
 	ba.ReadConsistency = roachpb.INCONSISTENT
+	if readUncommitted {
+		ba.ReadConsistency = roachpb.READ_UNCOMMITTED
+	}
 	ba.Add(&roachpb.RangeLookupRequest{
 		Span: roachpb.Span{
 			// We can interpret the RKey as a Key here since it's a metadata
@@ -272,31 +293,16 @@ func (ds *DistSender) FirstRange() (*roachpb.RangeDescriptor, error) {
 
 // optimizeReplicaOrder sorts the replicas in the order in which they are to be
 // used for sending RPCs (meaning in the order in which they'll be probed for
-// the lease). "Closer" replicas (matching in more attributes) are ordered
-// first. Replicas matching in the same number of attributes are shuffled
-// randomly.
-// If the current node is a replica, then it'll be the first one.
+// the lease). If the current node is a replica, then it'll be the first one.
+// "Closer" replicas (sharing more locality tiers, then more attributes) are
+// ordered next, with ties broken by the latency measured by the RPC
+// heartbeats. Replicas which can't be told apart are shuffled randomly.
 func (ds *DistSender) optimizeReplicaOrder(replicas ReplicaSlice) {
-	// TODO(spencer): going to need to also sort by affinity; closest
-	// ping time should win. Makes sense to have the rpc client/server
-	// heartbeat measure ping times. With a bit of seasoning, each
-	// node will be able to order the healthy replicas based on latency.
-
-	// Unless we know better, send the RPCs randomly.
-	nodeDesc := ds.getNodeDescriptor()
-	// If we don't know which node we're on, don't optimize anything.
-	if nodeDesc == nil {
-		replicas.Shuffle()
-		return
-	}
-	// Sort replicas by attribute affinity (if any), which we treat as a stand-in
-	// for proximity (for now).
-	replicas.SortByCommonAttributePrefix(nodeDesc.Attrs.Attrs)
-
-	// If there is a replica in local node, move it to the front.
-	if i := replicas.FindReplicaByNodeID(nodeDesc.NodeID); i > 0 {
-		replicas.MoveToFront(i)
+	var latencyFn LatencyFunc
+	if ds.rpcContext != nil {
+		latencyFn = ds.rpcContext.RemoteClocks.Latency
 	}
+	replicas.OptimizeReplicaOrder(ds.getNodeDescriptor(), latencyFn)
 }
 
 // getNodeDescriptor returns ds.nodeDescriptor, but makes an attempt to load
@@ -430,18 +436,21 @@ func (ds *DistSender) sendSingleRange(
 	// Try to send the call.
 	replicas := newReplicaSlice(ds.gossip, desc)
 
-	// Rearrange the replicas so that those replicas with long common
-	// prefix of attributes end up first. If there's no prefix, this is a
-	// no-op.
+	// Rearrange the replicas so that the nearest ones end up first.
 	ds.optimizeReplicaOrder(replicas)
 
 	// If this request needs to go to a lease holder and we know who that is, move
-	// it to the front.
-	if !(ba.IsReadOnly() && ba.ReadConsistency == roachpb.INCONSISTENT) {
+	// it to the front. Absent a cached lease holder, fall back to the hint from
+	// the range's meta addressing record, if any.
+	if !(ba.IsReadOnly() && ba.ReadConsistency.IsInconsistent()) {
 		if leaseHolder, ok := ds.leaseHolderCache.Lookup(desc.RangeID); ok {
 			if i := replicas.FindReplica(leaseHolder.StoreID); i >= 0 {
 				replicas.MoveToFront(i)
 			}
+		} else if hint := desc.LeaseHolderHint; hint != nil {
+			if i := replicas.FindReplica(hint.StoreID); i >= 0 {
+				replicas.MoveToFront(i)
+			}
 		}
 	}
 
@@ -482,10 +491,17 @@ func (ds *DistSender) Send(
 
 	// In the event that timestamp isn't set and read consistency isn't
 	// required, set the timestamp using the local clock.
-	if ba.ReadConsistency == roachpb.INCONSISTENT && ba.Timestamp.Equal(hlc.ZeroTimestamp) {
+	if ba.ReadConsistency.IsInconsistent() && ba.Timestamp.Equal(hlc.ZeroTimestamp) {
 		ba.Timestamp = ds.clock.Now()
 	}
 
+	// Let the ranges account for the locality their traffic comes from.
+	if ba.GatewayNodeID == 0 {
+		if nDesc := ds.getNodeDescriptor(); nDesc != nil {
+			ba.GatewayNodeID = nDesc.NodeID
+		}
+	}
+
 	if ba.Txn != nil {
 		// Make a copy here since the code below modifies it in different places.
 		// TODO(tschottdorf): be smarter about this - no need to do it for
@@ -556,6 +572,16 @@ func (ds *DistSender) Send(
 		// Such a batch should never need splitting.
 		panic("batch with MaxSpanRequestKeys needs splitting")
 	}
+	if maxSize := storagebase.MaxCommandSize.Get(); maxSize > 0 && ba.IsWrite() &&
+		int64(ba.Size()) > maxSize {
+		// A write batch this large would result in a Raft command exceeding
+		// the maximum size, so it is sent in several chunks. This is only
+		// atomic within a transaction.
+		if ba.Txn == nil && ba.IsPossibleTransaction() {
+			return nil, roachpb.NewError(&roachpb.OpRequiresTxnError{})
+		}
+		parts = splitBySize(parts, maxSize-int64(ba.Header.Size())-commandSizeOverhead)
+	}
 	for len(parts) > 0 {
 		part := parts[0]
 		ba.Requests = part
@@ -592,6 +618,33 @@ func (ds *DistSender) Send(
 	return reply, nil
 }
 
+// commandSizeOverhead is an upper bound on the size a Raft command adds to
+// that of the batch it contains.
+const commandSizeOverhead = 1 << 10
+
+// splitBySize subdivides the parts of a batch further so that the requests in
+// each part have a combined size of at most maxSize. Requests keep their
+// order, so an EndTransaction stays in the last part. A single request larger
+// than maxSize forms a part of its own; the replica will refuse to propose it.
+func splitBySize(parts [][]roachpb.RequestUnion, maxSize int64) [][]roachpb.RequestUnion {
+	var result [][]roachpb.RequestUnion
+	for _, part := range parts {
+		start := 0
+		var size int64
+		for i := range part {
+			// Account for the field tag and length prefix of the request.
+			reqSize := int64(part[i].Size()) + 10
+			if i > start && size+reqSize > maxSize {
+				result = append(result, part[start:i])
+				start, size = i, 0
+			}
+			size += reqSize
+		}
+		result = append(result, part[start:])
+	}
+	return result
+}
+
 // sendChunk is in charge of sending an "admissible" piece of batch, i.e. one
 // which doesn't need to be subdivided further before going to a range (so no
 // mixing of forward and reverse scans, etc). The parameters and return values
@@ -670,7 +723,7 @@ func (ds *DistSender) sendChunk(
 				// case where we don't need to re-run is if the read
 				// consistency is not required.
 				if ba.Txn == nil && ba.IsPossibleTransaction() &&
-					ba.ReadConsistency != roachpb.INCONSISTENT {
+					!ba.ReadConsistency.IsInconsistent() {
 					return nil, roachpb.NewError(&roachpb.OpRequiresTxnError{}), false
 				}
 				// If the request is more than but ends with EndTransaction, we
@@ -767,6 +820,12 @@ func (ds *DistSender) sendChunk(
 
 					}
 				}
+				// Without a replacement for the front of the span, the range
+				// is likely in the middle of a split whose intent on the
+				// meta record hasn't been resolved yet.
+				if ds.readUncommittedRangeLookups && len(replacements) == 0 {
+					evictToken.SuspectSplit()
+				}
 				// Same as Evict() if replacements is empty.
 				if err := evictToken.EvictAndReplace(ctx, replacements...); err != nil {
 					return nil, roachpb.NewError(err), false
@@ -777,6 +836,21 @@ func (ds *DistSender) sendChunk(
 					log.Warning(ctx, tErr)
 				}
 				continue
+			case *roachpb.ThrottledError:
+				// The store is shedding load. Transactional batches are
+				// handed back, so that the TxnCoordSender records the intents
+				// the batch may already have written on other ranges before
+				// client.Txn resends it.
+				if ba.Txn != nil {
+					break
+				}
+				log.VEventf(ctx, 1, "throttled, retrying after %s: %s", tErr.RetryAfter(), tErr.Reason)
+				if !client.WaitForThrottledRetry(ctx, tErr) {
+					break
+				}
+				// The store suggested the backoff; don't add ours on top of it.
+				r.Reset()
+				continue
 			}
 			break
 		}
@@ -35,7 +35,9 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
 	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
@@ -43,6 +45,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/metric"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
@@ -374,15 +377,81 @@ func TestSendRPCOrder(t *testing.T) {
 	}
 }
 
+// TestSendRPCLeaseHolderHint verifies that requests which need to go to the
+// lease holder are sent to the replica hinted at by the range descriptor
+// unless a lease holder is cached.
+func TestSendRPCLeaseHolderHint(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	g := makeGossip(t, stopper)
+	rangeID := roachpb.RangeID(99)
+	descriptor := roachpb.RangeDescriptor{
+		StartKey: roachpb.RKeyMin,
+		EndKey:   roachpb.RKeyMax,
+		RangeID:  rangeID,
+	}
+	for i := 1; i <= 3; i++ {
+		nd := &roachpb.NodeDescriptor{
+			NodeID:  roachpb.NodeID(i),
+			Address: util.MakeUnresolvedAddr("tcp", fmt.Sprintf("node%d:1", i)),
+		}
+		if err := g.AddInfoProto(gossip.MakeNodeIDKey(nd.NodeID), nd, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		descriptor.Replicas = append(descriptor.Replicas, roachpb.ReplicaDescriptor{
+			NodeID:  roachpb.NodeID(i),
+			StoreID: roachpb.StoreID(i),
+		})
+	}
+	hint := descriptor.Replicas[2]
+	descriptor.LeaseHolderHint = &hint
+
+	var first roachpb.NodeID
+	var testFn rpcSendFn = func(_ SendOptions, replicas ReplicaSlice,
+		args roachpb.BatchRequest, _ *rpc.Context) (*roachpb.BatchResponse, error) {
+		first = replicas[0].NodeID
+		return args.CreateReply(), nil
+	}
+	cfg := &DistSenderConfig{
+		TransportFactory: adaptLegacyTransport(testFn),
+		RangeDescriptorDB: MockRangeDescriptorDB(func(roachpb.RKey, bool) ([]roachpb.RangeDescriptor, []roachpb.RangeDescriptor, *roachpb.Error) {
+			return []roachpb.RangeDescriptor{descriptor}, nil, nil
+		}),
+	}
+	ds := NewDistSender(cfg, g)
+
+	for i, tc := range []struct {
+		leaseHolder roachpb.ReplicaDescriptor
+		expFirst    roachpb.NodeID
+	}{
+		// Without a cached lease holder, the hint is used.
+		{roachpb.ReplicaDescriptor{}, 3},
+		// A cached lease holder takes precedence over the hint.
+		{descriptor.Replicas[1], 2},
+	} {
+		ds.leaseHolderCache.Update(rangeID, tc.leaseHolder)
+		put := roachpb.NewPut(roachpb.Key("a"), roachpb.MakeValueFromString("value"))
+		if _, pErr := client.SendWrapped(context.Background(), ds, put); pErr != nil {
+			t.Fatalf("%d: %s", i, pErr)
+		}
+		if first != tc.expFirst {
+			t.Errorf("%d: expected request to be sent to node %d first, got node %d",
+				i, tc.expFirst, first)
+		}
+	}
+}
+
 type MockRangeDescriptorDB func(roachpb.RKey, bool) ([]roachpb.RangeDescriptor, []roachpb.RangeDescriptor, *roachpb.Error)
 
 func (mdb MockRangeDescriptorDB) RangeLookup(
-	_ context.Context, key roachpb.RKey, _ *roachpb.RangeDescriptor, useReverseScan bool,
+	_ context.Context, key roachpb.RKey, _ *roachpb.RangeDescriptor, useReverseScan bool, _ bool,
 ) ([]roachpb.RangeDescriptor, []roachpb.RangeDescriptor, *roachpb.Error) {
 	return mdb(stripMeta(key), useReverseScan)
 }
 func (mdb MockRangeDescriptorDB) FirstRange() (*roachpb.RangeDescriptor, error) {
-	rs, _, err := mdb.RangeLookup(context.Background(), nil, nil, false /* useReverseScan */)
+	rs, _, err := mdb.RangeLookup(context.Background(), nil, nil, false /* useReverseScan */, false /* readUncommitted */)
 	if err != nil || len(rs) == 0 {
 		return nil, err.GoError()
 	}
@@ -535,6 +604,57 @@ func TestRetryOnNotLeaseHolderError(t *testing.T) {
 	}
 }
 
+// TestRetryOnThrottledError verifies that the DistSender resends a
+// non-transactional batch rejected with a ThrottledError after the suggested
+// backoff, and hands transactional batches back to the client.
+func TestRetryOnThrottledError(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	g := makeGossip(t, stopper)
+	const retryAfter = 10 * time.Millisecond
+	var attempts int32
+
+	var testFn rpcSendFn = func(_ SendOptions, _ ReplicaSlice,
+		args roachpb.BatchRequest, _ *rpc.Context) (*roachpb.BatchResponse, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			reply := &roachpb.BatchResponse{}
+			reply.Error = roachpb.NewError(roachpb.NewThrottledError(retryAfter, "test"))
+			return reply, nil
+		}
+		return args.CreateReply(), nil
+	}
+
+	cfg := &DistSenderConfig{
+		TransportFactory:  adaptLegacyTransport(testFn),
+		RangeDescriptorDB: defaultMockRangeDescriptorDB,
+	}
+	ds := NewDistSender(cfg, g)
+	put := roachpb.NewPut(roachpb.Key("a"), roachpb.MakeValueFromString("value"))
+	start := timeutil.Now()
+	if _, pErr := client.SendWrapped(context.Background(), ds, put); pErr != nil {
+		t.Fatalf("put encountered error: %s", pErr)
+	}
+	if a := atomic.LoadInt32(&attempts); a != 2 {
+		t.Errorf("expected 2 attempts, got %d", a)
+	}
+	if elapsed := timeutil.Since(start); elapsed < retryAfter {
+		t.Errorf("expected the put to back off for at least %s, took %s", retryAfter, elapsed)
+	}
+
+	atomic.StoreInt32(&attempts, 0)
+	txn := roachpb.NewTransaction("test", roachpb.Key("a"), roachpb.NormalUserPriority,
+		enginepb.SERIALIZABLE, hlc.Timestamp{WallTime: 1}, 0)
+	_, pErr := client.SendWrappedWith(context.Background(), ds, roachpb.Header{Txn: txn}, put)
+	if _, ok := pErr.GetDetail().(*roachpb.ThrottledError); !ok {
+		t.Errorf("expected a ThrottledError, got %v", pErr)
+	}
+	if a := atomic.LoadInt32(&attempts); a != 1 {
+		t.Errorf("expected a single attempt, got %d", a)
+	}
+}
+
 // TestRetryOnDescriptorLookupError verifies that the DistSender retries a descriptor
 // lookup on any error.
 func TestRetryOnDescriptorLookupError(t *testing.T) {
@@ -905,6 +1025,80 @@ func TestRetryOnWrongReplicaErrorWithSuggestion(t *testing.T) {
 	}
 }
 
+// TestRetryOnWrongReplicaErrorReadUncommitted verifies that a DistSender
+// configured with ReadUncommittedRangeLookups re-resolves a descriptor which
+// is suspected to be in the middle of a split with a READ_UNCOMMITTED range
+// lookup, and then uses the descriptor from the split's intent.
+func TestRetryOnWrongReplicaErrorReadUncommitted(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	g := makeGossip(t, stopper)
+	if err := g.AddInfoProto(gossip.KeyFirstRangeDescriptor, &testRangeDescriptor, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// The range starts splitting at "m" right after the DistSender first
+	// looked up its descriptor. The committed meta record still holds the
+	// pre-split descriptor while an intent holds the right-hand side's.
+	committedDesc := testRangeDescriptor
+	intentDesc := testRangeDescriptor
+	intentDesc.RangeID = 3
+	intentDesc.StartKey = roachpb.RKey("m")
+
+	var lookups, uncommittedLookups int
+	var testFn rpcSendFn = func(_ SendOptions, _ ReplicaSlice,
+		ba roachpb.BatchRequest, _ *rpc.Context) (*roachpb.BatchResponse, error) {
+		rs, err := keys.Range(ba)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := ba.GetArg(roachpb.RangeLookup); ok {
+			br := &roachpb.BatchResponse{}
+			r := &roachpb.RangeLookupResponse{}
+			switch {
+			case bytes.HasPrefix(rs.Key, keys.Meta1Prefix):
+				r.Ranges = append(r.Ranges, testMetaRangeDescriptor)
+			case ba.ReadConsistency == roachpb.READ_UNCOMMITTED:
+				uncommittedLookups++
+				r.Ranges = append(r.Ranges, intentDesc, committedDesc)
+			default:
+				lookups++
+				r.Ranges = append(r.Ranges, committedDesc)
+				if lookups > 1 {
+					r.Ranges = append(r.Ranges, intentDesc)
+				}
+			}
+			br.Add(r)
+			return br, nil
+		}
+		// The split has been applied, so the pre-split range no longer
+		// serves the scanned keys.
+		if ba.RangeID == committedDesc.RangeID {
+			return nil, &roachpb.RangeKeyMismatchError{
+				RequestStartKey: rs.Key.AsRawKey(),
+				RequestEndKey:   rs.EndKey.AsRawKey(),
+			}
+		}
+		return ba.CreateReply(), nil
+	}
+
+	cfg := &DistSenderConfig{
+		TransportFactory:            adaptLegacyTransport(testFn),
+		ReadUncommittedRangeLookups: true,
+	}
+	ds := NewDistSender(cfg, g)
+	scan := roachpb.NewScan(roachpb.Key("n"), roachpb.Key("p"))
+	if _, err := client.SendWrapped(context.Background(), ds, scan); err != nil {
+		t.Fatalf("scan encountered error: %s", err)
+	}
+	if lookups != 1 || uncommittedLookups != 1 {
+		t.Fatalf("expected 1 inconsistent and 1 READ_UNCOMMITTED lookup, got %d and %d",
+			lookups, uncommittedLookups)
+	}
+}
+
 func TestGetFirstRangeDescriptor(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	stopper := stop.NewStopper()
@@ -1731,6 +1925,114 @@ func TestMultiRangeSplitEndTransaction(t *testing.T) {
 	}
 }
 
+// TestSplitOversizedBatch verifies that write batches which would exceed the
+// maximum Raft command size are sent in several chunks within a transaction,
+// and need to be retried in a transaction otherwise.
+func TestSplitOversizedBatch(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	g := makeGossip(t, stopper)
+	var act [][]roachpb.Method
+	var testFn rpcSendFn = func(_ SendOptions, _ ReplicaSlice,
+		ba roachpb.BatchRequest, _ *rpc.Context) (*roachpb.BatchResponse, error) {
+		var cur []roachpb.Method
+		for _, union := range ba.Requests {
+			cur = append(cur, union.GetInner().Method())
+		}
+		act = append(act, cur)
+		return ba.CreateReply(), nil
+	}
+	cfg := &DistSenderConfig{
+		TransportFactory:  adaptLegacyTransport(testFn),
+		RangeDescriptorDB: defaultMockRangeDescriptorDB,
+	}
+	ds := NewDistSender(cfg, g)
+
+	// Each put is large enough to exceed the maximum size together with
+	// another one.
+	const maxSize = 8 << 10
+	defer settings.TestingSetInt(storagebase.MaxCommandSize, maxSize)()
+	makeBatch := func(txn *roachpb.Transaction) roachpb.BatchRequest {
+		var ba roachpb.BatchRequest
+		ba.Txn = txn
+		val := roachpb.MakeValueFromBytes(make([]byte, maxSize/2))
+		for _, key := range []string{"a", "b", "c"} {
+			ba.Add(roachpb.NewPut(roachpb.Key(key), val))
+		}
+		if txn != nil {
+			ba.Add(&roachpb.EndTransactionRequest{Span: roachpb.Span{Key: roachpb.Key("a")}})
+		}
+		return ba
+	}
+
+	_, pErr := ds.Send(context.Background(), makeBatch(nil))
+	if _, ok := pErr.GetDetail().(*roachpb.OpRequiresTxnError); !ok {
+		t.Fatalf("expected OpRequiresTxnError, got %v", pErr)
+	}
+	if len(act) != 0 {
+		t.Fatalf("expected nothing to be sent, got %v", act)
+	}
+
+	if _, pErr := ds.Send(context.Background(), makeBatch(&roachpb.Transaction{Name: "test"})); pErr != nil {
+		t.Fatal(pErr)
+	}
+	exp := [][]roachpb.Method{
+		{roachpb.Put},
+		{roachpb.Put},
+		{roachpb.Put, roachpb.EndTransaction},
+	}
+	if !reflect.DeepEqual(exp, act) {
+		t.Fatalf("expected %v, got %v", exp, act)
+	}
+}
+
+func TestSplitBySize(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	put := func(size int) roachpb.RequestUnion {
+		var union roachpb.RequestUnion
+		union.MustSetInner(roachpb.NewPut(roachpb.Key("a"), roachpb.MakeValueFromBytes(make([]byte, size))))
+		return union
+	}
+	small, large := put(10), put(1000)
+	sizes := func(parts [][]roachpb.RequestUnion) [][]int {
+		var result [][]int
+		for _, part := range parts {
+			var cur []int
+			for _, union := range part {
+				cur = append(cur, len(union.GetInner().(*roachpb.PutRequest).Value.RawBytes))
+			}
+			result = append(result, cur)
+		}
+		return result
+	}
+
+	testCases := []struct {
+		parts [][]roachpb.RequestUnion
+		exp   [][]roachpb.RequestUnion
+	}{
+		{
+			[][]roachpb.RequestUnion{{small, small, small}},
+			[][]roachpb.RequestUnion{{small, small, small}},
+		},
+		{
+			[][]roachpb.RequestUnion{{small, large, small, small}},
+			[][]roachpb.RequestUnion{{small}, {large}, {small, small}},
+		},
+		{
+			[][]roachpb.RequestUnion{{large, large}, {small}},
+			[][]roachpb.RequestUnion{{large}, {large}, {small}},
+		},
+	}
+	for i, test := range testCases {
+		if a, e := sizes(splitBySize(test.parts, 500)), sizes(test.exp); !reflect.DeepEqual(a, e) {
+			t.Errorf("%d: expected %v, got %v", i, e, a)
+		}
+	}
+}
+
 func TestCountRanges(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	stopper := stop.NewStopper()
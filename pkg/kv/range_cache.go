@@ -58,12 +58,14 @@ type RangeDescriptorDB interface {
 	// of the range believed to hold the meta key. Two slices of range
 	// descriptors are returned. The first of these slices holds descriptors
 	// which contain the given key (possibly from intents), and the second holds
-	// prefetched adjacent descriptors.
+	// prefetched adjacent descriptors. If readUncommitted is true, a
+	// descriptor from an intent is returned ahead of the committed one.
 	RangeLookup(
 		ctx context.Context,
 		key roachpb.RKey,
 		desc *roachpb.RangeDescriptor,
 		useReverseScan bool,
+		readUncommitted bool,
 	) ([]roachpb.RangeDescriptor, []roachpb.RangeDescriptor, *roachpb.Error)
 	// FirstRange returns the descriptor for the first Range. This is the
 	// Range containing all \x00\x00meta1 entries.
@@ -110,8 +112,9 @@ type lookupResult struct {
 }
 
 type lookupRequestKey struct {
-	key            string
-	useReverseScan bool
+	key             string
+	useReverseScan  bool
+	readUncommitted bool
 }
 
 // makeLookupRequestKey constructs a lookupRequestKey with the goal of
@@ -156,8 +159,9 @@ func makeLookupRequestKey(
 		}
 	}
 	return lookupRequestKey{
-		key:            string(key),
-		useReverseScan: useReverseScan,
+		key:             string(key),
+		useReverseScan:  useReverseScan,
+		readUncommitted: evictToken != nil && evictToken.suspectSplit,
 	}
 }
 
@@ -195,6 +199,12 @@ func (rdc *rangeDescriptorCache) stringLocked() string {
 // evictionToken holds eviction state between calls to LookupRangeDescriptor.
 type evictionToken struct {
 	prevDesc *roachpb.RangeDescriptor
+	// suspectSplit is set when prevDesc is suspected to be in the process of
+	// being replaced, e.g. by a split. The lookup which follows the eviction
+	// then reads the meta records with READ_UNCOMMITTED consistency, so that
+	// it returns the descriptor written by the split's intent first.
+	// Protected by doLocker.
+	suspectSplit bool
 
 	doOnce    sync.Once                                 // assures that do and doReplace are run up to once.
 	doLocker  sync.Locker                               // protects do and doReplace.
@@ -213,6 +223,15 @@ func (rdc *rangeDescriptorCache) makeEvictionToken(
 	}
 }
 
+// SuspectSplit records that the RangeDescriptor the evictionToken was created
+// with is suspected to be in the process of being split, so that the lookup
+// which follows its eviction prefers descriptors from intents.
+func (et *evictionToken) SuspectSplit() {
+	et.doLocker.Lock()
+	et.suspectSplit = true
+	et.doLocker.Unlock()
+}
+
 // Evict instructs the evictionToken to evict the RangeDescriptor it was created
 // with from the rangeDescriptorCache.
 func (et *evictionToken) Evict(ctx context.Context) error {
@@ -324,7 +343,7 @@ func (rdc *rangeDescriptorCache) lookupRangeDescriptorInternal(
 		rdc.rangeCache.RUnlock()
 		doneWg()
 
-		rs, preRs, err := rdc.performRangeLookup(ctx, key, useReverseScan)
+		rs, preRs, err := rdc.performRangeLookup(ctx, key, useReverseScan, requestKey.readUncommitted)
 		if err != nil {
 			res = lookupResult{err: err}
 		} else {
@@ -366,6 +385,11 @@ func (rdc *rangeDescriptorCache) lookupRangeDescriptorInternal(
 			if err := rdc.insertRangeDescriptorsLocked(preRs...); err != nil {
 				log.Warningf(ctx, "range cache inserting prefetched descriptors failed: %v", err)
 			}
+			if requestKey.readUncommitted {
+				// The committed descriptor overlaps the one from the intent
+				// we're about to return; caching it would evict the latter.
+				rs = rs[:1]
+			}
 			if err := rdc.insertRangeDescriptorsLocked(rs...); err != nil {
 				res = lookupResult{err: err}
 			}
@@ -401,7 +425,7 @@ func (rdc *rangeDescriptorCache) lookupRangeDescriptorInternal(
 // performRangeLookup handles delegating the range lookup to the cache's
 // RangeDescriptorDB.
 func (rdc *rangeDescriptorCache) performRangeLookup(
-	ctx context.Context, key roachpb.RKey, useReverseScan bool,
+	ctx context.Context, key roachpb.RKey, useReverseScan bool, readUncommitted bool,
 ) ([]roachpb.RangeDescriptor, []roachpb.RangeDescriptor, error) {
 	// metadataKey is sent to RangeLookup to find the RangeDescriptor
 	// which contains key.
@@ -440,7 +464,7 @@ func (rdc *rangeDescriptorCache) performRangeLookup(
 	}
 	// Tag inner operations.
 	ctx = log.WithLogTag(ctx, "range-lookup", nil)
-	descs, prefetched, pErr := rdc.db.RangeLookup(ctx, metadataKey, desc, useReverseScan)
+	descs, prefetched, pErr := rdc.db.RangeLookup(ctx, metadataKey, desc, useReverseScan, readUncommitted)
 	return descs, prefetched, pErr.GoError()
 }
 
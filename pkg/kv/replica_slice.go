@@ -19,6 +19,8 @@ package kv
 
 import (
 	"math/rand"
+	"sort"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -32,6 +34,9 @@ import (
 type ReplicaInfo struct {
 	roachpb.ReplicaDescriptor
 	NodeDesc *roachpb.NodeDescriptor
+	// Overloaded is whether the replica's store was last gossiped as
+	// overloaded (see roachpb.StoreCapacity.Overloaded).
+	Overloaded bool
 }
 
 func (i ReplicaInfo) attrs() []string {
@@ -43,23 +48,28 @@ type ReplicaSlice []ReplicaInfo
 
 // newReplicaSlice creates a ReplicaSlice from the replicas listed in the range
 // descriptor and using gossip to lookup node descriptors. Replicas on nodes
-// that are not gossiped are omitted from the result.
-func newReplicaSlice(gossip *gossip.Gossip, desc *roachpb.RangeDescriptor) ReplicaSlice {
-	if gossip == nil {
+// that are not gossiped are omitted from the result. The gossiped store
+// descriptors tell which replicas are on overloaded stores.
+func newReplicaSlice(g *gossip.Gossip, desc *roachpb.RangeDescriptor) ReplicaSlice {
+	if g == nil {
 		return nil
 	}
 	replicas := make(ReplicaSlice, 0, len(desc.Replicas))
 	for _, r := range desc.Replicas {
-		nd, err := gossip.GetNodeDescriptor(r.NodeID)
+		nd, err := g.GetNodeDescriptor(r.NodeID)
 		if err != nil {
 			if log.V(1) {
 				log.Infof(context.TODO(), "node %d is not gossiped: %v", r.NodeID, err)
 			}
 			continue
 		}
+		var storeDesc roachpb.StoreDescriptor
+		overloaded := g.GetInfoProto(gossip.MakeStoreKey(r.StoreID), &storeDesc) == nil &&
+			storeDesc.Capacity.Overloaded()
 		replicas = append(replicas, ReplicaInfo{
 			ReplicaDescriptor: r,
 			NodeDesc:          nd,
+			Overloaded:        overloaded,
 		})
 	}
 	return replicas
@@ -126,6 +136,126 @@ func (rs ReplicaSlice) SortByCommonAttributePrefix(attrs []string) int {
 	return len(attrs)
 }
 
+// LatencyFunc returns the latency measured to the node at the given address,
+// and whether any latency has been measured to it at all.
+type LatencyFunc func(addr string) (time.Duration, bool)
+
+// OptimizeReplicaOrder sorts the replicas in the order in which they should be
+// tried when sending a request from the given node, nearest first. Replicas on
+// overloaded stores sort last, so that requests (and their retries) only go
+// to them once the other replicas have been tried. Otherwise, a replica on the
+// node itself sorts first, followed by replicas whose localities share
+// more leading tiers with the node's, then by replicas sharing a longer prefix
+// of attributes, and finally by lower measured latency (replicas with a
+// latency measurement sort before those without). Replicas which can't be told
+// apart by any of these are ordered randomly. If nodeDesc is nil, the replicas
+// are simply shuffled. latencyFn may be nil.
+func (rs ReplicaSlice) OptimizeReplicaOrder(
+	nodeDesc *roachpb.NodeDescriptor, latencyFn LatencyFunc,
+) {
+	// Shuffle first, so that the stable sort below leaves replicas which
+	// compare equal in random order.
+	rs.Shuffle()
+	if nodeDesc == nil {
+		return
+	}
+	p := replicaProximities{
+		rs:   rs,
+		prox: make([]replicaProximity, len(rs)),
+	}
+	for i := range rs {
+		p.prox[i] = makeReplicaProximity(nodeDesc, rs[i], latencyFn)
+	}
+	sort.Stable(p)
+}
+
+// replicaProximity captures how close a replica is to the node sending the
+// request.
+type replicaProximity struct {
+	overloaded bool
+	local      bool
+	tiers      int
+	attrs      int
+	latency    time.Duration
+	hasLatency bool
+}
+
+func makeReplicaProximity(
+	nodeDesc *roachpb.NodeDescriptor, replica ReplicaInfo, latencyFn LatencyFunc,
+) replicaProximity {
+	p := replicaProximity{
+		overloaded: replica.Overloaded,
+		local:      replica.NodeID == nodeDesc.NodeID,
+		tiers:      commonTierPrefix(nodeDesc.Locality, replica.NodeDesc.Locality),
+		attrs:      commonAttributePrefix(nodeDesc.Attrs.Attrs, replica.attrs()),
+	}
+	if latencyFn != nil {
+		p.latency, p.hasLatency = latencyFn(replica.NodeDesc.Address.String())
+	}
+	return p
+}
+
+// less returns whether the replica described by p should be tried before the
+// one described by o.
+func (p replicaProximity) less(o replicaProximity) bool {
+	if p.overloaded != o.overloaded {
+		return !p.overloaded
+	}
+	if p.local != o.local {
+		return p.local
+	}
+	if p.tiers != o.tiers {
+		return p.tiers > o.tiers
+	}
+	if p.attrs != o.attrs {
+		return p.attrs > o.attrs
+	}
+	if p.hasLatency != o.hasLatency {
+		return p.hasLatency
+	}
+	return p.latency < o.latency
+}
+
+// replicaProximities implements sort.Interface, sorting a ReplicaSlice by the
+// precomputed proximity of its replicas.
+type replicaProximities struct {
+	rs   ReplicaSlice
+	prox []replicaProximity
+}
+
+func (p replicaProximities) Len() int { return len(p.rs) }
+
+func (p replicaProximities) Less(i, j int) bool { return p.prox[i].less(p.prox[j]) }
+
+func (p replicaProximities) Swap(i, j int) {
+	p.rs.Swap(i, j)
+	p.prox[i], p.prox[j] = p.prox[j], p.prox[i]
+}
+
+// commonTierPrefix returns the number of leading locality tiers which are
+// equal in both localities.
+func commonTierPrefix(a, b roachpb.Locality) int {
+	i := 0
+	for ; i < len(a.Tiers) && i < len(b.Tiers); i++ {
+		if a.Tiers[i] != b.Tiers[i] {
+			break
+		}
+	}
+	return i
+}
+
+// commonAttributePrefix returns the number of leading attributes which are
+// equal in both lists.
+func commonAttributePrefix(a, b []string) int {
+	i := 0
+	for ; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			break
+		}
+	}
+	return i
+}
+
 // MoveToFront moves the replica at the given index to the front
 // of the slice, keeping the order of the remaining elements stable.
 // The function will panic when invoked with an invalid index.
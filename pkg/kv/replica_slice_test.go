@@ -20,8 +20,10 @@ import (
 	"math/rand"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 )
 
@@ -133,3 +135,124 @@ func TestReplicaSetRandPerm(t *testing.T) {
 	verifyRandPermOrdering(1, 3, []roachpb.StoreID{1, 4, 2, 3, 5}, t)
 	verifyRandPermOrdering(0, 4, []roachpb.StoreID{3, 5, 2, 1, 4}, t)
 }
+
+func TestReplicaSetOptimizeReplicaOrder(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	locality := func(s string) roachpb.Locality {
+		var l roachpb.Locality
+		if s != "" {
+			if err := l.Set(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return l
+	}
+	replica := func(nodeID int, loc string, attrs ...string) ReplicaInfo {
+		return ReplicaInfo{
+			ReplicaDescriptor: roachpb.ReplicaDescriptor{
+				NodeID:  roachpb.NodeID(nodeID),
+				StoreID: roachpb.StoreID(nodeID),
+			},
+			NodeDesc: &roachpb.NodeDescriptor{
+				NodeID:   roachpb.NodeID(nodeID),
+				Address:  util.MakeUnresolvedAddr("tcp", roachpb.NodeID(nodeID).String()),
+				Locality: locality(loc),
+				Attrs:    roachpb.Attributes{Attrs: attrs},
+			},
+		}
+	}
+	overloaded := func(r ReplicaInfo) ReplicaInfo {
+		r.Overloaded = true
+		return r
+	}
+	latencies := map[string]time.Duration{
+		"2": 30 * time.Millisecond,
+		"3": 10 * time.Millisecond,
+		"4": 20 * time.Millisecond,
+	}
+	latencyFn := func(addr string) (time.Duration, bool) {
+		l, ok := latencies[addr]
+		return l, ok
+	}
+
+	testCases := []struct {
+		name      string
+		node      ReplicaInfo
+		latencyFn LatencyFunc
+		replicas  ReplicaSlice
+		expected  []roachpb.StoreID
+	}{
+		{
+			name: "local first",
+			node: replica(1, "region=us,zone=a"),
+			replicas: ReplicaSlice{
+				replica(2, "region=us,zone=a"),
+				replica(1, "region=eu,zone=a"),
+			},
+			expected: []roachpb.StoreID{1, 2},
+		},
+		{
+			name: "locality",
+			node: replica(1, "region=us,zone=a"),
+			replicas: ReplicaSlice{
+				replica(2, "region=eu,zone=a"),
+				replica(3, "region=us,zone=b"),
+				replica(4, "region=us,zone=a"),
+			},
+			expected: []roachpb.StoreID{4, 3, 2},
+		},
+		{
+			name: "locality before attributes",
+			node: replica(1, "region=us", "ssd"),
+			replicas: ReplicaSlice{
+				replica(2, "region=eu", "ssd"),
+				replica(3, "region=us", "hdd"),
+				replica(4, "region=us", "ssd"),
+			},
+			expected: []roachpb.StoreID{4, 3, 2},
+		},
+		{
+			name:      "latency",
+			node:      replica(1, "region=us"),
+			latencyFn: latencyFn,
+			replicas: ReplicaSlice{
+				replica(5, "region=us"),
+				replica(2, "region=us"),
+				replica(4, "region=us"),
+				replica(3, "region=us"),
+			},
+			expected: []roachpb.StoreID{3, 4, 2, 5},
+		},
+		{
+			name:      "locality before latency",
+			node:      replica(1, "region=us"),
+			latencyFn: latencyFn,
+			replicas: ReplicaSlice{
+				replica(3, "region=eu"),
+				replica(2, "region=us"),
+			},
+			expected: []roachpb.StoreID{2, 3},
+		},
+		{
+			name: "overloaded last",
+			node: replica(1, "region=us,zone=a"),
+			replicas: ReplicaSlice{
+				overloaded(replica(1, "region=us,zone=a")),
+				replica(2, "region=eu,zone=a"),
+				replica(3, "region=us,zone=a"),
+			},
+			expected: []roachpb.StoreID{3, 2, 1},
+		},
+	}
+	for _, tc := range testCases {
+		// The replicas are shuffled before sorting, so repeat to make sure the
+		// outcome doesn't depend on the initial order.
+		for i := 0; i < 10; i++ {
+			tc.replicas.OptimizeReplicaOrder(tc.node.NodeDesc, tc.latencyFn)
+			if stores := getStores(tc.replicas); !reflect.DeepEqual(stores, tc.expected) {
+				t.Errorf("%s: expected order %s, got %s", tc.name, tc.expected, stores)
+			}
+		}
+	}
+}
@@ -72,6 +72,13 @@ func (r RangeIDSlice) Len() int           { return len(r) }
 func (r RangeIDSlice) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
 func (r RangeIDSlice) Less(i, j int) bool { return r[i] < r[j] }
 
+// IsInconsistent returns whether reads at the given consistency level are
+// served without the range lease and without synchronizing with concurrent
+// commands, i.e. whether they may observe stale or uncommitted data.
+func (rc ReadConsistencyType) IsInconsistent() bool {
+	return rc == INCONSISTENT || rc == READ_UNCOMMITTED
+}
+
 const (
 	isAdmin    = 1 << iota // admin cmds don't go through raft, but run on lease holder
 	isRead                 // read-only cmds don't go through raft, but may run on lease holder
@@ -232,6 +239,19 @@ func (cc *CheckConsistencyResponse) combine(c combinable) error {
 
 var _ combinable = &CheckConsistencyResponse{}
 
+// Combine implements the combinable interface.
+func (cr *ClearRangeResponse) combine(c combinable) error {
+	if cr != nil {
+		otherCR := c.(*ClearRangeResponse)
+		if err := cr.ResponseHeader.combine(otherCR.Header()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var _ combinable = &ClearRangeResponse{}
+
 // Combine implements the combinable interface.
 func (af *ChangeFrozenResponse) combine(c combinable) error {
 	if af != nil {
@@ -390,6 +410,12 @@ func (*CheckConsistencyRequest) Method() Method { return CheckConsistency }
 // Method implements the Request interface.
 func (*ChangeFrozenRequest) Method() Method { return ChangeFrozen }
 
+// Method implements the Request interface.
+func (*ClearRangeRequest) Method() Method { return ClearRange }
+
+// Method implements the Request interface.
+func (*RecomputeStatsRequest) Method() Method { return RecomputeStats }
+
 // Method implements the Request interface.
 func (*BeginTransactionRequest) Method() Method { return BeginTransaction }
 
@@ -402,6 +428,9 @@ func (*AdminSplitRequest) Method() Method { return AdminSplit }
 // Method implements the Request interface.
 func (*AdminMergeRequest) Method() Method { return AdminMerge }
 
+// Method implements the Request interface.
+func (*AdminUnsplitRequest) Method() Method { return AdminUnsplit }
+
 // Method implements the Request interface.
 func (*AdminTransferLeaseRequest) Method() Method { return AdminTransferLease }
 
@@ -513,6 +542,18 @@ func (afr *ChangeFrozenRequest) ShallowCopy() Request {
 	return &shallowCopy
 }
 
+// ShallowCopy implements the Request interface.
+func (crr *ClearRangeRequest) ShallowCopy() Request {
+	shallowCopy := *crr
+	return &shallowCopy
+}
+
+// ShallowCopy implements the Request interface.
+func (rsr *RecomputeStatsRequest) ShallowCopy() Request {
+	shallowCopy := *rsr
+	return &shallowCopy
+}
+
 // ShallowCopy implements the Request interface.
 func (btr *BeginTransactionRequest) ShallowCopy() Request {
 	shallowCopy := *btr
@@ -537,6 +578,12 @@ func (amr *AdminMergeRequest) ShallowCopy() Request {
 	return &shallowCopy
 }
 
+// ShallowCopy implements the Request interface.
+func (aur *AdminUnsplitRequest) ShallowCopy() Request {
+	shallowCopy := *aur
+	return &shallowCopy
+}
+
 // ShallowCopy implements the Request interface.
 func (atlr *AdminTransferLeaseRequest) ShallowCopy() Request {
 	shallowCopy := *atlr
@@ -748,6 +795,27 @@ func NewChangeFrozen(key, endKey Key, frozen bool, mustVersion string) Request {
 	}
 }
 
+// NewClearRange returns a Request initialized to clear the values in the
+// given key range (excluding the endpoint).
+func NewClearRange(key, endKey Key) Request {
+	return &ClearRangeRequest{
+		Span: Span{
+			Key:    key,
+			EndKey: endKey,
+		},
+	}
+}
+
+// NewRecomputeStats returns a Request initialized to recompute the MVCC
+// stats of the range containing key.
+func NewRecomputeStats(key Key) Request {
+	return &RecomputeStatsRequest{
+		Span: Span{
+			Key: key,
+		},
+	}
+}
+
 // NewCheckConsistency returns a Request initialized to scan from start to end keys.
 func NewCheckConsistency(key, endKey Key, withDiff bool) Request {
 	return &CheckConsistencyRequest{
@@ -783,6 +851,7 @@ func (*BeginTransactionRequest) flags() int   { return isWrite | isTxn }
 func (*EndTransactionRequest) flags() int     { return isWrite | isTxn | isAlone }
 func (*AdminSplitRequest) flags() int         { return isAdmin | isAlone }
 func (*AdminMergeRequest) flags() int         { return isAdmin | isAlone }
+func (*AdminUnsplitRequest) flags() int       { return isAdmin | isAlone }
 func (*AdminTransferLeaseRequest) flags() int { return isAdmin | isAlone }
 func (*HeartbeatTxnRequest) flags() int       { return isWrite | isTxn }
 func (*GCRequest) flags() int                 { return isWrite | isRange }
@@ -820,3 +889,5 @@ func (*ComputeChecksumRequest) flags() int          { return isWrite | isNonKV |
 func (*DeprecatedVerifyChecksumRequest) flags() int { return isWrite }
 func (*CheckConsistencyRequest) flags() int         { return isAdmin | isRange }
 func (*ChangeFrozenRequest) flags() int             { return isWrite | isRange | isNonKV }
+func (*ClearRangeRequest) flags() int               { return isWrite | isRange | isAlone }
+func (*RecomputeStatsRequest) flags() int           { return isWrite | isAlone | isNonKV }
@@ -7,7 +7,7 @@ import (
 	"fmt"
 )
 
-type reqCounts [30]int32
+type reqCounts [33]int32
 
 // getReqCounts returns the number of times each
 // request type appears in the batch.
@@ -75,6 +75,12 @@ func (ba *BatchRequest) getReqCounts() reqCounts {
 			counts[28]++
 		case r.LeaseInfo != nil:
 			counts[29]++
+		case r.ClearRange != nil:
+			counts[30]++
+		case r.RecomputeStats != nil:
+			counts[31]++
+		case r.AdminUnsplit != nil:
+			counts[32]++
 		default:
 			panic(fmt.Sprintf("unsupported request: %+v", r))
 		}
@@ -113,6 +119,9 @@ var requestNames = []string{
 	"ChangeFrozen",
 	"TransferLease",
 	"LeaseInfo",
+	"ClearRng",
+	"RecomputeStats",
+	"AdmUnsplit",
 }
 
 // Summary prints a short summary of the requests in a batch.
@@ -172,6 +181,9 @@ func (ba *BatchRequest) CreateReply() *BatchResponse {
 	var buf27 []ChangeFrozenResponse
 	var buf28 []RequestLeaseResponse
 	var buf29 []LeaseInfoResponse
+	var buf30 []ClearRangeResponse
+	var buf31 []RecomputeStatsResponse
+	var buf32 []AdminUnsplitResponse
 
 	for i, r := range ba.Requests {
 		switch {
@@ -355,6 +367,24 @@ func (ba *BatchRequest) CreateReply() *BatchResponse {
 			}
 			br.Responses[i].LeaseInfo = &buf29[0]
 			buf29 = buf29[1:]
+		case r.ClearRange != nil:
+			if buf30 == nil {
+				buf30 = make([]ClearRangeResponse, counts[30])
+			}
+			br.Responses[i].ClearRange = &buf30[0]
+			buf30 = buf30[1:]
+		case r.RecomputeStats != nil:
+			if buf31 == nil {
+				buf31 = make([]RecomputeStatsResponse, counts[31])
+			}
+			br.Responses[i].RecomputeStats = &buf31[0]
+			buf31 = buf31[1:]
+		case r.AdminUnsplit != nil:
+			if buf32 == nil {
+				buf32 = make([]AdminUnsplitResponse, counts[32])
+			}
+			br.Responses[i].AdminUnsplit = &buf32[0]
+			buf32 = buf32[1:]
 		default:
 			panic(fmt.Sprintf("unsupported request: %+v", r))
 		}
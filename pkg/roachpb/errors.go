@@ -18,6 +18,7 @@ package roachpb
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/util/caller"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
@@ -336,6 +337,59 @@ func (e *RangeFrozenError) message(_ *Error) string {
 
 var _ ErrorDetailInterface = &RangeFrozenError{}
 
+// NewCommandTooLargeError initializes a new CommandTooLargeError.
+func NewCommandTooLargeError(size, maxSize int64) *CommandTooLargeError {
+	return &CommandTooLargeError{Size_: size, MaxSize: maxSize}
+}
+
+func (e *CommandTooLargeError) Error() string {
+	return e.message(nil)
+}
+
+func (e *CommandTooLargeError) message(_ *Error) string {
+	return fmt.Sprintf("command of %d bytes exceeds the maximum command size of %d bytes",
+		e.Size_, e.MaxSize)
+}
+
+var _ ErrorDetailInterface = &CommandTooLargeError{}
+
+// NewMalformedCommandError initializes a new MalformedCommandError.
+func NewMalformedCommandError(format string, args ...interface{}) *MalformedCommandError {
+	return &MalformedCommandError{Reason: fmt.Sprintf(format, args...)}
+}
+
+func (e *MalformedCommandError) Error() string {
+	return e.message(nil)
+}
+
+func (e *MalformedCommandError) message(_ *Error) string {
+	return fmt.Sprintf("malformed command: %s", e.Reason)
+}
+
+var _ ErrorDetailInterface = &MalformedCommandError{}
+
+// NewThrottledError initializes a new ThrottledError suggesting that the
+// batch be retried after the given duration.
+func NewThrottledError(retryAfter time.Duration, reason string) *ThrottledError {
+	return &ThrottledError{RetryAfterNanos: retryAfter.Nanoseconds(), Reason: reason}
+}
+
+// RetryAfter returns the time the client should wait before retrying the
+// throttled batch.
+func (e *ThrottledError) RetryAfter() time.Duration {
+	return time.Duration(e.RetryAfterNanos)
+}
+
+func (e *ThrottledError) Error() string {
+	return e.message(nil)
+}
+
+func (e *ThrottledError) message(_ *Error) string {
+	return fmt.Sprintf("throttled (retry after %s): %s", e.RetryAfter(), e.Reason)
+}
+
+var _ ErrorDetailInterface = &ThrottledError{}
+
 func (e *TransactionAbortedError) Error() string {
 	return "txn aborted"
 }
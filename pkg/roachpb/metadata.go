@@ -24,6 +24,8 @@ import (
 	"strings"
 
 	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 )
 
 // NodeID is a custom type for a cockroach node ID. (not a raft node ID)
@@ -149,6 +151,12 @@ func (r RangeDescriptor) IsInitialized() bool {
 	return len(r.EndKey) != 0
 }
 
+// IsStickyAt returns whether the start key of the range is a sticky split
+// point at the given time, which a merge must not remove.
+func (r RangeDescriptor) IsStickyAt(now hlc.Timestamp) bool {
+	return r.StickyBit != nil && now.Less(*r.StickyBit)
+}
+
 // Validate performs some basic validation of the contents of a range descriptor.
 func (r RangeDescriptor) Validate() error {
 	if r.NextReplicaID == 0 {
@@ -193,6 +201,39 @@ func (sc StoreCapacity) FractionUsed() float64 {
 	return float64(sc.Capacity-sc.Available) / float64(sc.Capacity)
 }
 
+// AtMaxRangeCount returns whether the store holds at least as many replicas
+// as its configured maximum. Stores without a maximum are never full.
+func (sc StoreCapacity) AtMaxRangeCount() bool {
+	return sc.MaxRangeCount > 0 && sc.RangeCount >= sc.MaxRangeCount
+}
+
+// Overloaded returns whether the store is overloaded, meaning that at least
+// one of the resources accounted for by its overload score is saturated. The
+// allocator, the lease rebalancer and the DistSender all steer load away from
+// overloaded stores.
+func (sc StoreCapacity) Overloaded() bool {
+	return sc.Overload >= 1
+}
+
+// RemoteQueryFraction returns the fraction of the batches served by the
+// store which were sent by gateways in other regions. Multiplied by the
+// inter-region round trip time, it estimates the latency the store's clients
+// would save if its leases moved to their region.
+func (sc StoreCapacity) RemoteQueryFraction() float64 {
+	if sc.QueriesPerSecond <= 0 {
+		return 0
+	}
+	return sc.RemoteQueriesPerSecond / sc.QueriesPerSecond
+}
+
+// ReservationsExhausted returns whether the store has used up its budget of
+// snapshot reservations, either in number or in bytes, and so declines new
+// snapshots until some of the outstanding ones are applied.
+func (sc StoreCapacity) ReservationsExhausted() bool {
+	return (sc.MaxReservations > 0 && sc.Reservations >= sc.MaxReservations) ||
+		(sc.MaxReservedBytes > 0 && sc.ReservedBytes >= sc.MaxReservedBytes)
+}
+
 // CombinedAttrs returns the full list of attributes for the store, including
 // both the node and store attributes.
 func (s StoreDescriptor) CombinedAttrs() *Attributes {
@@ -254,3 +295,21 @@ func (l *Locality) Set(value string) error {
 	l.Tiers = tiers
 	return nil
 }
+
+// DiversityScore returns a score in the interval [0, 1] describing how
+// different two localities are. Tiers are compared from the most general to
+// the most specific, so localities which differ in an earlier tier (e.g. the
+// region) score higher than localities which only differ in a later one (e.g.
+// the rack). Identical localities, and localities without tiers, score 0.
+func (l Locality) DiversityScore(other Locality) float64 {
+	length := len(l.Tiers)
+	if len(other.Tiers) < length {
+		length = len(other.Tiers)
+	}
+	for i := 0; i < length; i++ {
+		if l.Tiers[i].Value != other.Tiers[i].Value {
+			return float64(length-i) / float64(length)
+		}
+	}
+	return 0
+}
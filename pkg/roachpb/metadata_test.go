@@ -22,6 +22,8 @@ import (
 	"testing"
 
 	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 )
 
 func TestAttributesIsSubset(t *testing.T) {
@@ -140,3 +142,61 @@ func TestLocalityConversions(t *testing.T) {
 		}
 	}
 }
+
+func TestLocalityDiversityScore(t *testing.T) {
+	var region1Zone1, region1Zone2, region2Zone1, region1 Locality
+	for _, c := range []struct {
+		l *Locality
+		s string
+	}{
+		{&region1Zone1, "region=1,zone=1"},
+		{&region1Zone2, "region=1,zone=2"},
+		{&region2Zone1, "region=2,zone=1"},
+		{&region1, "region=1"},
+	} {
+		if err := c.l.Set(c.s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		a, b     Locality
+		expected float64
+	}{
+		{region1Zone1, region1Zone1, 0},
+		{region1Zone1, region1Zone2, 0.5},
+		{region1Zone1, region2Zone1, 1},
+		{region1Zone1, region1, 0},
+		{region2Zone1, region1, 1},
+		{region1Zone1, Locality{}, 0},
+	}
+	for i, tc := range testCases {
+		if score := tc.a.DiversityScore(tc.b); score != tc.expected {
+			t.Errorf("%d: %s vs %s: expected %.2f, got %.2f", i, tc.a, tc.b, tc.expected, score)
+		}
+		if score := tc.b.DiversityScore(tc.a); score != tc.expected {
+			t.Errorf("%d: %s vs %s: expected %.2f, got %.2f", i, tc.b, tc.a, tc.expected, score)
+		}
+	}
+}
+
+func TestRangeDescriptorIsStickyAt(t *testing.T) {
+	expiration := hlc.Timestamp{WallTime: 10}
+	testCases := []struct {
+		stickyBit *hlc.Timestamp
+		now       hlc.Timestamp
+		expected  bool
+	}{
+		{nil, hlc.Timestamp{WallTime: 1}, false},
+		{&expiration, hlc.Timestamp{WallTime: 9}, true},
+		{&expiration, expiration, false},
+		{&expiration, hlc.Timestamp{WallTime: 11}, false},
+		{&hlc.MaxTimestamp, hlc.Timestamp{WallTime: 11}, true},
+	}
+	for i, tc := range testCases {
+		desc := RangeDescriptor{StickyBit: tc.stickyBit}
+		if sticky := desc.IsStickyAt(tc.now); sticky != tc.expected {
+			t.Errorf("%d: expected IsStickyAt(%s) to be %t, got %t", i, tc.now, tc.expected, sticky)
+		}
+	}
+}
@@ -121,4 +121,14 @@ const (
 	// ChangeFrozen freezes or unfreezes all Ranges with StartKey in a given
 	// key span.
 	ChangeFrozen
+	// ClearRange removes all values (including all of their versions) for keys
+	// which fall between args.RequestHeader.Key and args.RequestHeader.EndKey,
+	// without a transaction.
+	ClearRange
+	// RecomputeStats recomputes the MVCC stats of the range containing
+	// args.RequestHeader.Key and corrects the persisted stats accordingly.
+	RecomputeStats
+	// AdminUnsplit is called to remove the sticky bit of a manual split
+	// point, which makes the range starting at it eligible for merging.
+	AdminUnsplit
 )
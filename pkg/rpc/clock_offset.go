@@ -39,8 +39,14 @@ var (
 	metaClusterOffsetUpperBound = metric.Metadata{Name: "clock-offset.upper-bound-nanos"}
 )
 
+// avgLatencyAge is the number of heartbeats over which the latency to a
+// remote node is averaged: the weight of a new measurement in the moving
+// average is 2/(avgLatencyAge+1).
+const avgLatencyAge = 20
+
 // RemoteClockMonitor keeps track of the most recent measurements of remote
-// offsets from this node to connected nodes.
+// offsets from this node to connected nodes, and of the round-trip latencies
+// to them.
 type RemoteClockMonitor struct {
 	ctx       context.Context
 	clock     *hlc.Clock
@@ -48,7 +54,8 @@ type RemoteClockMonitor struct {
 
 	mu struct {
 		syncutil.Mutex
-		offsets map[string]RemoteOffset
+		offsets        map[string]RemoteOffset
+		latenciesNanos map[string]float64
 	}
 
 	metrics RemoteClockMetrics
@@ -64,6 +71,7 @@ func newRemoteClockMonitor(
 		offsetTTL: offsetTTL,
 	}
 	r.mu.offsets = make(map[string]RemoteOffset)
+	r.mu.latenciesNanos = make(map[string]float64)
 	r.metrics = RemoteClockMetrics{
 		ClusterOffsetLowerBound: metric.NewGauge(metaClusterOffsetLowerBound),
 		ClusterOffsetUpperBound: metric.NewGauge(metaClusterOffsetUpperBound),
@@ -117,6 +125,45 @@ func (r *RemoteClockMonitor) UpdateOffset(addr string, offset RemoteOffset) {
 	}
 }
 
+// UpdateLatency folds a round-trip latency measured to addr into the moving
+// average of the latencies to it.
+func (r *RemoteClockMonitor) UpdateLatency(addr string, latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if avg, ok := r.mu.latenciesNanos[addr]; ok {
+		const alpha = 2.0 / (avgLatencyAge + 1)
+		r.mu.latenciesNanos[addr] = avg + alpha*(float64(latency.Nanoseconds())-avg)
+	} else {
+		r.mu.latenciesNanos[addr] = float64(latency.Nanoseconds())
+	}
+}
+
+// Latency returns the average round-trip latency to addr, and whether any
+// latency has been measured to it.
+func (r *RemoteClockMonitor) Latency(addr string) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	avg, ok := r.mu.latenciesNanos[addr]
+	return time.Duration(avg), ok
+}
+
+// AllOffsets returns the most recent offsets measured to the remote nodes,
+// keyed by address. Stale measurements are omitted.
+func (r *RemoteClockMonitor) AllOffsets() map[string]RemoteOffset {
+	now := r.clock.PhysicalTime()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	offsets := make(map[string]RemoteOffset, len(r.mu.offsets))
+	for addr, offset := range r.mu.offsets {
+		if !offset.isStale(r.offsetTTL, now) {
+			offsets[addr] = offset
+		}
+	}
+	return offsets
+}
+
 // VerifyClockOffset calculates the number of nodes to which the known offset
 // is healthy (as defined by RemoteOffset.isHealthy). It returns nil iff more
 // than half the known offsets are healthy, and an error otherwise. A non-nil
@@ -18,6 +18,7 @@ package rpc
 
 import (
 	"math"
+	"reflect"
 	"strconv"
 	"testing"
 	"time"
@@ -97,6 +98,56 @@ func TestUpdateOffset(t *testing.T) {
 	monitor.mu.Unlock()
 }
 
+func TestAllOffsets(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	monitor := newRemoteClockMonitor(
+		context.TODO(), hlc.NewClock(hlc.NewManualClock(123).UnixNano), time.Hour)
+
+	now := monitor.clock.PhysicalTime()
+	fresh := RemoteOffset{Offset: 10, Uncertainty: 5, MeasuredAt: now.UnixNano()}
+	stale := RemoteOffset{
+		Offset:      20,
+		Uncertainty: 5,
+		MeasuredAt:  now.Add(-(monitor.offsetTTL + 1)).UnixNano(),
+	}
+	monitor.UpdateOffset("fresh", fresh)
+	monitor.UpdateOffset("stale", stale)
+
+	offsets := monitor.AllOffsets()
+	if e := map[string]RemoteOffset{"fresh": fresh}; !reflect.DeepEqual(offsets, e) {
+		t.Errorf("expected offsets %v, got %v", e, offsets)
+	}
+	// The returned map is a copy.
+	delete(offsets, "fresh")
+	if len(monitor.AllOffsets()) != 1 {
+		t.Error("modifying the returned offsets modified the monitor")
+	}
+}
+
+func TestLatency(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	monitor := newRemoteClockMonitor(
+		context.TODO(), hlc.NewClock(hlc.NewManualClock(123).UnixNano), time.Hour)
+
+	if _, ok := monitor.Latency("a"); ok {
+		t.Fatal("expected no latency before any measurement")
+	}
+	// The first measurement is taken as is, later ones are averaged in.
+	monitor.UpdateLatency("a", 10*time.Millisecond)
+	if l, ok := monitor.Latency("a"); !ok || l != 10*time.Millisecond {
+		t.Errorf("expected latency 10ms, got %s (%t)", l, ok)
+	}
+	for i := 0; i < 100; i++ {
+		monitor.UpdateLatency("a", 20*time.Millisecond)
+	}
+	if l, _ := monitor.Latency("a"); l <= 19*time.Millisecond || l > 20*time.Millisecond {
+		t.Errorf("expected latency to converge to 20ms, got %s", l)
+	}
+	if _, ok := monitor.Latency("b"); ok {
+		t.Error("expected no latency for an address never measured")
+	}
+}
+
 func TestVerifyClockOffset(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
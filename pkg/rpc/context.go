@@ -310,10 +310,12 @@ func (ctx *Context) runHeartbeat(cc *grpc.ClientConn, remoteAddr string) error {
 		ctx.setConnHealthy(remoteAddr, err == nil)
 		if err == nil {
 			receiveTime := ctx.localClock.PhysicalTime()
+			pingDuration := receiveTime.Sub(sendTime)
+			ctx.RemoteClocks.UpdateLatency(remoteAddr, pingDuration)
 
 			// Only update the clock offset measurement if we actually got a
 			// successful response from the server.
-			if pingDuration := receiveTime.Sub(sendTime); pingDuration > maximumPingDurationMult*ctx.localClock.MaxOffset() {
+			if pingDuration > maximumPingDurationMult*ctx.localClock.MaxOffset() {
 				request.Offset.Reset()
 			} else {
 				// Offset and error are measured using the remote clock reading
@@ -0,0 +1,111 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
+	"github.com/cockroachdb/cockroach/pkg/server/status"
+)
+
+// clockEndpoint shows the clocks of all nodes in the cluster, as of their
+// last status records, to help correlate timestamp anomalies with skewed
+// nodes.
+const clockEndpoint = "/debug/clock"
+
+// handleClock serves clockEndpoint.
+func (s *Server) handleClock(w http.ResponseWriter, r *http.Request) {
+	ctx := s.AnnotateCtx(r.Context())
+	resp, err := s.status.Nodes(ctx, &serverpb.NodesRequest{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writeClockReport(w, resp.Nodes)
+}
+
+// offsetRange is the range of a set of clock offsets.
+type offsetRange struct {
+	count    int
+	min, max time.Duration
+}
+
+func (r *offsetRange) add(offset time.Duration) {
+	if r.count == 0 || offset < r.min {
+		r.min = offset
+	}
+	if r.count == 0 || offset > r.max {
+		r.max = offset
+	}
+	r.count++
+}
+
+func (r offsetRange) String() string {
+	if r.count == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("[%s, %s]", r.min, r.max)
+}
+
+// writeClockReport writes a report of the clocks of the given nodes. For
+// each node, it lists its HLC timestamp and how far that was ahead of its
+// physical clock when the status was recorded, the range of the offsets the
+// node measured to its peers, and the range of the offsets its peers measured
+// to it. A node whose clock is skewed stands out by the offsets its peers
+// measured to it all being far from zero, while the HLC of a node which
+// received timestamps from a node with a fast clock runs ahead of its physical
+// clock.
+func writeClockReport(w io.Writer, nodes []status.NodeStatus) {
+	// The offsets peers measured to each node, keyed by its address.
+	measuredByPeers := make(map[string]*offsetRange, len(nodes))
+	for _, node := range nodes {
+		measuredByPeers[node.Desc.Address.AddressField] = &offsetRange{}
+	}
+	for _, node := range nodes {
+		for _, offset := range node.ClockOffsets {
+			if r, ok := measuredByPeers[offset.Address]; ok {
+				r.add(time.Duration(offset.Offset))
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 2, 1, 2, ' ', 0)
+	fmt.Fprintln(tw, "node\taddress\tupdated\thlc\thlc ahead\tpeer offsets\toffset seen by peers")
+	for _, node := range nodes {
+		var measured offsetRange
+		for _, offset := range node.ClockOffsets {
+			measured.add(time.Duration(offset.Offset))
+		}
+		updated := time.Unix(0, node.UpdatedAt).UTC()
+		var hlc, ahead string
+		if node.HLCTimestamp.WallTime == 0 {
+			// The status was recorded by a node which doesn't report its clock.
+			hlc, ahead = "-", "-"
+		} else {
+			hlc = node.HLCTimestamp.String()
+			ahead = time.Duration(node.HLCTimestamp.WallTime - node.UpdatedAt).String()
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			node.Desc.NodeID, node.Desc.Address.AddressField, updated.Format(time.RFC3339Nano),
+			hlc, ahead, measured, measuredByPeers[node.Desc.Address.AddressField])
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/server/status"
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestWriteClockReport(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	node := func(
+		id roachpb.NodeID, addr string, ahead time.Duration, offsets ...status.ClockOffset,
+	) status.NodeStatus {
+		updatedAt := time.Unix(100, 0).UnixNano()
+		return status.NodeStatus{
+			Desc: roachpb.NodeDescriptor{
+				NodeID:  id,
+				Address: util.MakeUnresolvedAddr("tcp", addr),
+			},
+			UpdatedAt:    updatedAt,
+			HLCTimestamp: hlc.Timestamp{WallTime: updatedAt + ahead.Nanoseconds()},
+			ClockOffsets: offsets,
+		}
+	}
+	// Node 3's clock is 100ms ahead, and node 2 received a timestamp from it.
+	nodes := []status.NodeStatus{
+		node(1, "a:1", 0,
+			status.ClockOffset{Address: "b:2", Offset: int64(time.Millisecond)},
+			status.ClockOffset{Address: "c:3", Offset: int64(100 * time.Millisecond)}),
+		node(2, "b:2", 50*time.Millisecond,
+			status.ClockOffset{Address: "a:1", Offset: -int64(time.Millisecond)},
+			status.ClockOffset{Address: "c:3", Offset: int64(99 * time.Millisecond)}),
+		node(3, "c:3", 0,
+			status.ClockOffset{Address: "a:1", Offset: -int64(100 * time.Millisecond)},
+			status.ClockOffset{Address: "b:2", Offset: -int64(99 * time.Millisecond)}),
+		// A node which doesn't report its clock.
+		{Desc: roachpb.NodeDescriptor{NodeID: 4, Address: util.MakeUnresolvedAddr("tcp", "d:4")}},
+	}
+
+	var buf bytes.Buffer
+	writeClockReport(&buf, nodes)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(nodes)+1 {
+		t.Fatalf("expected %d lines, got:\n%s", len(nodes)+1, buf.String())
+	}
+	for i, expected := range [][]string{
+		{"1", "a:1", " 0s ", "[1ms, 100ms]", "[-100ms, -1ms]"},
+		{"2", "b:2", " 50ms ", "[-1ms, 99ms]", "[-99ms, 1ms]"},
+		{"3", "c:3", " 0s ", "[-100ms, -99ms]", "[99ms, 100ms]"},
+		{"4", "d:4", " - ", " -"},
+	} {
+		line := lines[i+1]
+		if !strings.HasPrefix(line, expected[0]+" ") {
+			t.Errorf("expected line %q to be for node %s", line, expected[0])
+		}
+		for _, s := range expected[1:] {
+			if !strings.Contains(line, s) {
+				t.Errorf("expected line %q to contain %q", line, s)
+			}
+		}
+	}
+}
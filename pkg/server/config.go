@@ -49,8 +49,8 @@ const (
 	defaultScanInterval             = 10 * time.Minute
 	defaultConsistencyCheckInterval = 24 * time.Hour
 	defaultScanMaxIdleTime          = 5 * time.Second
+	defaultScanMinIdleTime          = 10 * time.Millisecond
 	defaultMetricsSampleInterval    = 10 * time.Second
-	defaultTimeUntilStoreDead       = 5 * time.Minute
 	defaultStorePath                = "cockroach-data"
 	defaultEventLogEnabled          = true
 
@@ -90,6 +90,9 @@ type Config struct {
 	// Engines is the storage instances specified by Stores.
 	Engines []engine.Engine
 
+	// EphemeralEngines is the subset of Engines whose stores are ephemeral.
+	EphemeralEngines map[engine.Engine]struct{}
+
 	// NodeAttributes is the parsed representation of Attrs.
 	NodeAttributes roachpb.Attributes
 
@@ -106,6 +109,12 @@ type Config struct {
 	// Environment Variable: COCKROACH_LINEARIZABLE
 	Linearizable bool
 
+	// ReadUncommittedRangeLookups makes the node's DistSender re-resolve
+	// range descriptors which are suspected to be in the middle of a split
+	// with READ_UNCOMMITTED range lookups, which observe the split's intents.
+	// Environment Variable: COCKROACH_READ_UNCOMMITTED_RANGE_LOOKUPS
+	ReadUncommittedRangeLookups bool
+
 	// Maximum clock offset for the cluster.
 	// Environment Variable: COCKROACH_MAX_OFFSET
 	MaxOffset time.Duration
@@ -113,6 +122,19 @@ type Config struct {
 	// RaftTickInterval is the resolution of the Raft timer.
 	RaftTickInterval time.Duration
 
+	// DisabledQueues names the store queues which are disabled on all the
+	// stores of the node. See storage.QueueNames for the valid names.
+	DisabledQueues []string
+
+	// RaftSchedulerWorkers and RaftTickBatchSize configure the Raft scheduler
+	// of each store of the node. Zero leaves them to the store's defaults.
+	RaftSchedulerWorkers int
+	RaftTickBatchSize    int
+
+	// MaxReplicasPerStore is the maximum number of replicas each store of
+	// the node will hold. Zero leaves the limit to the store's default.
+	MaxReplicasPerStore int
+
 	// RaftElectionTimeoutTicks is the number of raft ticks before the
 	// previous election expires. This value is inherited by individual
 	// stores unless overridden.
@@ -134,6 +156,12 @@ type Config struct {
 	// Environment Variable: COCKROACH_SCAN_MAX_IDLE_TIME
 	ScanMaxIdleTime time.Duration
 
+	// ScanMinIdleTime is the minimum time the scanner will be idle between
+	// ranges, which keeps it from busy looping on small stores once it has
+	// fallen behind. It doesn't override ScanMaxIdleTime.
+	// Environment Variable: COCKROACH_SCAN_MIN_IDLE_TIME
+	ScanMinIdleTime time.Duration
+
 	// ConsistencyCheckInterval determines the time between range consistency checks.
 	// Set to 0 to disable.
 	// Environment Variable: COCKROACH_CONSISTENCY_CHECK_INTERVAL
@@ -143,11 +171,6 @@ type Config struct {
 	// replication consistency check failure.
 	ConsistencyCheckPanicOnFailure bool
 
-	// TimeUntilStoreDead is the time after which if there is no new gossiped
-	// information about a store, it is considered dead.
-	// Environment Variable: COCKROACH_TIME_UNTIL_STORE_DEAD
-	TimeUntilStoreDead time.Duration
-
 	// TestingKnobs is used for internal test controls only.
 	TestingKnobs base.TestingKnobs
 
@@ -329,9 +352,9 @@ func MakeConfig() Config {
 		CacheSize:                defaultCacheSize,
 		ScanInterval:             defaultScanInterval,
 		ScanMaxIdleTime:          defaultScanMaxIdleTime,
+		ScanMinIdleTime:          defaultScanMinIdleTime,
 		ConsistencyCheckInterval: defaultConsistencyCheckInterval,
 		MetricsSampleInterval:    defaultMetricsSampleInterval,
-		TimeUntilStoreDead:       defaultTimeUntilStoreDead,
 		EventLogEnabled:          defaultEventLogEnabled,
 		Stores: base.StoreSpecList{
 			Specs: []base.StoreSpec{{Path: defaultStorePath}},
@@ -357,6 +380,12 @@ func (cfg *Config) InitStores(stopper *stop.Stopper) error {
 		return err
 	}
 
+	// The first store is the one a new cluster is bootstrapped on, and it must
+	// be able to hold replicas.
+	if len(cfg.Stores.Specs) > 0 && cfg.Stores.Specs[0].Ephemeral {
+		return fmt.Errorf("the first store (%s) can't be ephemeral", cfg.Stores.Specs[0])
+	}
+
 	for _, spec := range cfg.Stores.Specs {
 		var sizeInBytes = spec.SizeInBytes
 		if spec.InMemory {
@@ -396,6 +425,12 @@ func (cfg *Config) InitStores(stopper *stop.Stopper) error {
 				),
 			)
 		}
+		if spec.Ephemeral {
+			if cfg.EphemeralEngines == nil {
+				cfg.EphemeralEngines = make(map[engine.Engine]struct{})
+			}
+			cfg.EphemeralEngines[cfg.Engines[len(cfg.Engines)-1]] = struct{}{}
+		}
 	}
 
 	if len(cfg.Engines) == 1 {
@@ -432,12 +467,13 @@ func (cfg *Config) InitNode() error {
 func (cfg *Config) readEnvironmentVariables() {
 	// cockroach-linearizable
 	cfg.Linearizable = envutil.EnvOrDefaultBool("COCKROACH_LINEARIZABLE", cfg.Linearizable)
+	cfg.ReadUncommittedRangeLookups = envutil.EnvOrDefaultBool("COCKROACH_READ_UNCOMMITTED_RANGE_LOOKUPS", cfg.ReadUncommittedRangeLookups)
 	cfg.ConsistencyCheckPanicOnFailure = envutil.EnvOrDefaultBool("COCKROACH_CONSISTENCY_CHECK_PANIC_ON_FAILURE", cfg.ConsistencyCheckPanicOnFailure)
 	cfg.MaxOffset = envutil.EnvOrDefaultDuration("COCKROACH_MAX_OFFSET", cfg.MaxOffset)
 	cfg.MetricsSampleInterval = envutil.EnvOrDefaultDuration("COCKROACH_METRICS_SAMPLE_INTERVAL", cfg.MetricsSampleInterval)
 	cfg.ScanInterval = envutil.EnvOrDefaultDuration("COCKROACH_SCAN_INTERVAL", cfg.ScanInterval)
 	cfg.ScanMaxIdleTime = envutil.EnvOrDefaultDuration("COCKROACH_SCAN_MAX_IDLE_TIME", cfg.ScanMaxIdleTime)
-	cfg.TimeUntilStoreDead = envutil.EnvOrDefaultDuration("COCKROACH_TIME_UNTIL_STORE_DEAD", cfg.TimeUntilStoreDead)
+	cfg.ScanMinIdleTime = envutil.EnvOrDefaultDuration("COCKROACH_SCAN_MIN_IDLE_TIME", cfg.ScanMinIdleTime)
 	cfg.ConsistencyCheckInterval = envutil.EnvOrDefaultDuration("COCKROACH_CONSISTENCY_CHECK_INTERVAL", cfg.ConsistencyCheckInterval)
 }
 
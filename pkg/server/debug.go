@@ -105,6 +105,10 @@ table tr td {
 </td>
 </tr>
 <tr>
+<td>clocks</td>
+<td><a href="./clock">all nodes</a></td>
+</tr>
+<tr>
 <td>raft</td>
 <td><a href="/_status/raft">raft</a></td>
 </tr>
@@ -121,6 +125,13 @@ table tr td {
 </td>
 </tr>
 <tr>
+<td>cluster settings</td>
+<td>
+<a href="./settings">current values</a><br />
+post key=&lt;setting&gt;&amp;value=&lt;value&gt; to /debug/settings to change a setting on all nodes.
+</td>
+</tr>
+<tr>
 <td>change vmodule</td>
 <td>
 get /debug/vmodule/<your_vmodule_here><br />For example, <code>*=1</code> or <code>raft=3,storage=2</code>. Empty string disables vmodule logging.
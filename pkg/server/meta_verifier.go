@@ -0,0 +1,248 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// metaVerificationInterval is the interval at which the meta2 range
+// descriptors are verified against the replicas reported by the stores.
+var metaVerificationInterval = settings.RegisterDurationSetting(
+	"server.meta_verification.interval",
+	"interval at which the meta2 range descriptors are verified against the replicas "+
+		"reported by the stores; 0 disables the verification",
+	10*time.Minute,
+)
+
+// metaVerifier periodically cross-checks the meta2 range descriptors against
+// the replicas reported by the stores, so that drift between the two shows
+// up in the replication report rather than when something breaks because of
+// it. Only the node holding the lease on the first range runs the
+// verification, which keeps it to one node per cluster.
+type metaVerifier struct {
+	status *statusServer
+
+	mu struct {
+		syncutil.Mutex
+		report serverpb.ReplicationReportResponse
+	}
+}
+
+func newMetaVerifier(status *statusServer) *metaVerifier {
+	return &metaVerifier{status: status}
+}
+
+// start runs the verification loop until the stopper quiesces.
+func (v *metaVerifier) start(stopper *stop.Stopper) {
+	stopper.RunWorker(func() {
+		ctx := v.status.AnnotateCtx(context.Background())
+		var timer timeutil.Timer
+		defer timer.Stop()
+		for {
+			interval := metaVerificationInterval.Get()
+			if interval <= 0 {
+				// Check again later whether the verification was enabled.
+				interval = time.Minute
+			}
+			timer.Reset(interval)
+			select {
+			case <-timer.C:
+				timer.Read = true
+				if metaVerificationInterval.Get() <= 0 || !v.holdsFirstRangeLease() {
+					continue
+				}
+				if err := v.verify(ctx); err != nil {
+					log.Warningf(ctx, "unable to verify meta records: %s", err)
+				}
+			case <-stopper.ShouldStop():
+				return
+			}
+		}
+	})
+}
+
+// holdsFirstRangeLease returns whether one of the node's stores holds a
+// valid lease on the first range.
+func (v *metaVerifier) holdsFirstRangeLease() bool {
+	var holds bool
+	_ = v.status.stores.VisitStores(func(s *storage.Store) error {
+		if repl := s.LookupReplica(roachpb.RKeyMin, nil); repl != nil &&
+			repl.OwnsValidLease(s.Clock().Now()) {
+			holds = true
+		}
+		return nil
+	})
+	return holds
+}
+
+// verify lists the stores of the cluster and the replicas on each node,
+// cross-checks the meta2 range descriptors against them, and records the
+// outcome as the node's replication report.
+func (v *metaVerifier) verify(ctx context.Context) error {
+	nodes, err := v.status.Nodes(ctx, nil)
+	if err != nil {
+		return err
+	}
+	stores := make(map[roachpb.StoreID]roachpb.NodeID)
+	replicas := make(map[roachpb.NodeID]map[roachpb.RangeID]struct{})
+	var unreachable int32
+	for _, node := range nodes.Nodes {
+		nodeID := node.Desc.NodeID
+		for _, store := range node.StoreStatuses {
+			stores[store.Desc.StoreID] = nodeID
+		}
+		ranges, err := v.status.Ranges(ctx, &serverpb.RangesRequest{NodeId: nodeID.String()})
+		if err != nil {
+			log.Warningf(ctx, "unable to list the replicas of node %d: %s", nodeID, err)
+			unreachable++
+			continue
+		}
+		rangeIDs := make(map[roachpb.RangeID]struct{}, len(ranges.Ranges))
+		for _, r := range ranges.Ranges {
+			rangeIDs[r.State.Desc.RangeID] = struct{}{}
+		}
+		replicas[nodeID] = rangeIDs
+	}
+
+	rows, err := v.status.db.Scan(ctx, keys.Meta2Prefix, keys.MetaMax, 0)
+	if err != nil {
+		return err
+	}
+	descs := make([]roachpb.RangeDescriptor, len(rows))
+	for i, row := range rows {
+		if err := row.ValueProto(&descs[i]); err != nil {
+			return err
+		}
+	}
+
+	mismatches := findMetaMismatches(descs, stores, replicas)
+	for _, m := range mismatches {
+		log.Warningf(ctx, "r%d: meta record mismatch on n%d,s%d: %s",
+			m.RangeID, m.NodeID, m.StoreID, m.Reason)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.mu.report = serverpb.ReplicationReportResponse{
+		VerifiedAtNanos:  timeutil.Now().UnixNano(),
+		RangesVerified:   int32(len(descs)),
+		Mismatches:       mismatches,
+		UnreachableNodes: unreachable,
+	}
+	return nil
+}
+
+// report returns the outcome of the last verification.
+func (v *metaVerifier) report() serverpb.ReplicationReportResponse {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	report := v.mu.report
+	report.Mismatches = append([]serverpb.MetaMismatch(nil), report.Mismatches...)
+	return report
+}
+
+type metaMismatchesByRange []serverpb.MetaMismatch
+
+func (m metaMismatchesByRange) Len() int      { return len(m) }
+func (m metaMismatchesByRange) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m metaMismatchesByRange) Less(i, j int) bool {
+	if m[i].RangeID != m[j].RangeID {
+		return m[i].RangeID < m[j].RangeID
+	}
+	return m[i].StoreID < m[j].StoreID
+}
+
+// findMetaMismatches returns the replicas of the given range descriptors
+// which point at stores that don't exist, or which aren't reported by their
+// node. The stores map the store IDs of the cluster to their node, and
+// replicas holds the IDs of the ranges each node reported a replica of;
+// nodes which couldn't be reached are left out, and their replicas aren't
+// reported missing. A range in the middle of a replication change can show
+// up until the change completes.
+func findMetaMismatches(
+	descs []roachpb.RangeDescriptor,
+	stores map[roachpb.StoreID]roachpb.NodeID,
+	replicas map[roachpb.NodeID]map[roachpb.RangeID]struct{},
+) []serverpb.MetaMismatch {
+	var mismatches []serverpb.MetaMismatch
+	for _, desc := range descs {
+		for _, repl := range desc.Replicas {
+			var reason string
+			if nodeID, ok := stores[repl.StoreID]; !ok {
+				reason = "descriptor points at a non-existent store"
+			} else if nodeID != repl.NodeID {
+				reason = fmt.Sprintf("descriptor places the store on n%d rather than n%d",
+					repl.NodeID, nodeID)
+			} else if rangeIDs, ok := replicas[repl.NodeID]; ok {
+				if _, ok := rangeIDs[desc.RangeID]; !ok {
+					reason = "replica is missing from its store"
+				}
+			}
+			if reason == "" {
+				continue
+			}
+			mismatches = append(mismatches, serverpb.MetaMismatch{
+				RangeID: desc.RangeID,
+				NodeID:  repl.NodeID,
+				StoreID: repl.StoreID,
+				Reason:  reason,
+			})
+		}
+	}
+	sort.Sort(metaMismatchesByRange(mismatches))
+	return mismatches
+}
+
+// ReplicationReport returns the outcome of the node's last verification of
+// the meta2 range descriptors. Only the node holding the lease on the first
+// range verifies them, so the report of other nodes may be empty or stale.
+func (s *statusServer) ReplicationReport(
+	ctx context.Context, req *serverpb.ReplicationReportRequest,
+) (*serverpb.ReplicationReportResponse, error) {
+	ctx = s.AnnotateCtx(ctx)
+	nodeID, local, err := s.parseNodeID(req.NodeId)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	if !local {
+		status, err := s.dialNode(nodeID)
+		if err != nil {
+			return nil, err
+		}
+		return status.ReplicationReport(ctx, req)
+	}
+
+	report := s.metaVerifier.report()
+	report.NodeID = s.gossip.GetNodeID()
+	return &report, nil
+}
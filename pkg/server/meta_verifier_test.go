@@ -0,0 +1,76 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestFindMetaMismatches(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	desc := func(rangeID roachpb.RangeID, storeIDs ...roachpb.StoreID) roachpb.RangeDescriptor {
+		d := roachpb.RangeDescriptor{RangeID: rangeID}
+		for _, storeID := range storeIDs {
+			// Stores 1-3 are on nodes 1-3, store 4 is on node 3 as well.
+			nodeID := roachpb.NodeID(storeID)
+			if storeID == 4 {
+				nodeID = 3
+			}
+			d.Replicas = append(d.Replicas, roachpb.ReplicaDescriptor{
+				NodeID: nodeID, StoreID: storeID,
+			})
+		}
+		return d
+	}
+	ranges := func(rangeIDs ...roachpb.RangeID) map[roachpb.RangeID]struct{} {
+		m := make(map[roachpb.RangeID]struct{})
+		for _, rangeID := range rangeIDs {
+			m[rangeID] = struct{}{}
+		}
+		return m
+	}
+
+	stores := map[roachpb.StoreID]roachpb.NodeID{1: 1, 2: 2, 3: 3, 4: 3}
+	// Node 2 is unreachable, so its replicas aren't reported missing.
+	replicas := map[roachpb.NodeID]map[roachpb.RangeID]struct{}{
+		1: ranges(1, 2),
+		3: ranges(1, 3),
+	}
+	descs := []roachpb.RangeDescriptor{
+		desc(1, 1, 2, 3),
+		desc(2, 1, 2, 4),
+		desc(3, 5, 2, 3),
+		desc(4, 1, 2),
+	}
+	// The descriptor of r4 places s2 on the wrong node.
+	descs[3].Replicas[1].NodeID = 1
+
+	mismatches := findMetaMismatches(descs, stores, replicas)
+	expected := []serverpb.MetaMismatch{
+		{RangeID: 2, NodeID: 3, StoreID: 4, Reason: "replica is missing from its store"},
+		{RangeID: 3, NodeID: 5, StoreID: 5, Reason: "descriptor points at a non-existent store"},
+		{RangeID: 4, NodeID: 1, StoreID: 1, Reason: "replica is missing from its store"},
+		{RangeID: 4, NodeID: 1, StoreID: 2, Reason: "descriptor places the store on n1 rather than n2"},
+	}
+	if !reflect.DeepEqual(mismatches, expected) {
+		t.Errorf("expected mismatches\n%+v\ngot\n%+v", expected, mismatches)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+)
+
+// ProblemRanges returns the ranges of this node's stores which have replicas
+// on dead stores. A range with replicas on several of the node's stores is
+// reported once.
+func (s *statusServer) ProblemRanges(
+	ctx context.Context, req *serverpb.ProblemRangesRequest,
+) (*serverpb.ProblemRangesResponse, error) {
+	resp := &serverpb.ProblemRangesResponse{
+		NodeID: s.gossip.GetNodeID(),
+	}
+	seen := make(map[roachpb.RangeID]struct{})
+	if err := s.stores.VisitStores(func(store *storage.Store) error {
+		for _, r := range store.ProblemRanges() {
+			if _, ok := seen[r.RangeID]; ok {
+				continue
+			}
+			seen[r.RangeID] = struct{}{}
+			resp.Ranges = append(resp.Ranges, serverpb.ProblemRange{
+				RangeID:                r.RangeID,
+				Replicas:               int32(r.Replicas),
+				DeadReplicas:           r.DeadReplicas,
+				CorrelatedDeadReplicas: int32(r.CorrelatedDeadReplicas),
+				Unavailable:            r.Unavailable,
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, grpc.Errorf(codes.Internal, err.Error())
+	}
+	return resp, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// ReplicaMovements returns the snapshots being streamed by and to the stores
+// of the requested node, or of every node of the cluster if none is
+// requested.
+func (s *statusServer) ReplicaMovements(
+	ctx context.Context, req *serverpb.ReplicaMovementsRequest,
+) (*serverpb.ReplicaMovementsResponse, error) {
+	ctx = s.AnnotateCtx(ctx)
+	if req.NodeId == "" {
+		return s.clusterReplicaMovements(ctx)
+	}
+	nodeID, local, err := s.parseNodeID(req.NodeId)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, err.Error())
+	}
+
+	if !local {
+		status, err := s.dialNode(nodeID)
+		if err != nil {
+			return nil, err
+		}
+		return status.ReplicaMovements(ctx, req)
+	}
+
+	resp := &serverpb.ReplicaMovementsResponse{}
+	now := timeutil.Now()
+	if err := s.stores.VisitStores(func(store *storage.Store) error {
+		resp.Movements = append(resp.Movements,
+			replicaMovements(nodeID, store.ReplicaMovements(), now)...)
+		return nil
+	}); err != nil {
+		return nil, grpc.Errorf(codes.Internal, err.Error())
+	}
+	sort.Sort(replicaMovementsByRange(resp.Movements))
+	return resp, nil
+}
+
+// clusterReplicaMovements collects the snapshots being streamed by the
+// stores of every node of the cluster.
+func (s *statusServer) clusterReplicaMovements(
+	ctx context.Context,
+) (*serverpb.ReplicaMovementsResponse, error) {
+	nodes, err := s.Nodes(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp := &serverpb.ReplicaMovementsResponse{}
+	for _, node := range nodes.Nodes {
+		nodeID := node.Desc.NodeID
+		nodeResp, err := s.ReplicaMovements(ctx, &serverpb.ReplicaMovementsRequest{
+			NodeId: nodeID.String(),
+		})
+		if err != nil {
+			log.Warningf(ctx, "unable to list the replica movements of node %d: %s", nodeID, err)
+			resp.UnreachableNodes++
+			continue
+		}
+		resp.Movements = append(resp.Movements, nodeResp.Movements...)
+	}
+	sort.Sort(replicaMovementsByRange(resp.Movements))
+	return resp, nil
+}
+
+// replicaMovements converts the snapshots being streamed by and to a store
+// into their status representation, one per recipient.
+func replicaMovements(
+	nodeID roachpb.NodeID, movements []storage.ReplicaMovement, now time.Time,
+) []serverpb.ReplicaMovement {
+	var result []serverpb.ReplicaMovement
+	for _, m := range movements {
+		for _, to := range m.To {
+			result = append(result, serverpb.ReplicaMovement{
+				RangeID:      m.RangeID,
+				NodeID:       nodeID,
+				FromStoreID:  m.From,
+				ToStoreID:    to,
+				Type:         m.Type.String(),
+				Bytes:        m.Bytes,
+				SentBytes:    m.SentBytes,
+				Rate:         m.Rate(now),
+				EtaNanos:     m.ETA(now).Nanoseconds(),
+				StartedNanos: unixNanos(m.Started),
+				Incoming:     m.Incoming,
+			})
+		}
+	}
+	return result
+}
+
+type replicaMovementsByRange []serverpb.ReplicaMovement
+
+func (m replicaMovementsByRange) Len() int      { return len(m) }
+func (m replicaMovementsByRange) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m replicaMovementsByRange) Less(i, j int) bool {
+	if m[i].RangeID != m[j].RangeID {
+		return m[i].RangeID < m[j].RangeID
+	}
+	if m[i].ToStoreID != m[j].ToStoreID {
+		return m[i].ToStoreID < m[j].ToStoreID
+	}
+	// The sender's report of a snapshot goes before the recipient's.
+	return !m[i].Incoming && m[j].Incoming
+}
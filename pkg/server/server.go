@@ -167,15 +167,6 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 	s.gossip = gossip.New(
 		s.cfg.AmbientCtx, s.rpcContext, s.grpc, s.cfg.GossipBootstrapResolvers, s.stopper, s.registry,
 	)
-	s.storePool = storage.NewStorePool(
-		ctx,
-		s.gossip,
-		s.clock,
-		s.rpcContext,
-		cfg.TimeUntilStoreDead,
-		s.stopper,
-	)
-
 	// A custom RetryOptions is created which uses stopper.ShouldQuiesce() as
 	// the Closer. This prevents infinite retry loops from occurring during
 	// graceful server shutdown
@@ -190,10 +181,11 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 	retryOpts := base.DefaultRetryOptions()
 	retryOpts.Closer = s.stopper.ShouldQuiesce()
 	distSenderCfg := kv.DistSenderConfig{
-		Ctx:             ctx,
-		Clock:           s.clock,
-		RPCContext:      s.rpcContext,
-		RPCRetryOptions: &retryOpts,
+		Ctx:                         ctx,
+		Clock:                       s.clock,
+		RPCContext:                  s.rpcContext,
+		RPCRetryOptions:             &retryOpts,
+		ReadUncommittedRangeLookups: cfg.ReadUncommittedRangeLookups,
 	}
 	s.distSender = kv.NewDistSender(&distSenderCfg, s.gossip)
 
@@ -212,6 +204,19 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 	)
 	s.registry.AddMetricStruct(s.nodeLiveness.Metrics())
 
+	s.storePool = storage.NewStorePool(
+		ctx,
+		s.gossip,
+		s.clock,
+		s.rpcContext,
+		s.nodeLiveness.GetLiveness,
+		storage.TimeUntilStoreDead,
+		s.stopper,
+	)
+	// The StorePool is shared by all of the node's stores, so its metrics are
+	// node-level ones.
+	s.registry.AddMetricStruct(s.storePool.Metrics())
+
 	s.raftTransport = storage.NewRaftTransport(
 		ctx, storage.GossipAddressResolver(s.gossip), s.grpc, s.rpcContext)
 
@@ -277,8 +282,13 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 		RaftTickInterval:               s.cfg.RaftTickInterval,
 		ScanInterval:                   s.cfg.ScanInterval,
 		ScanMaxIdleTime:                s.cfg.ScanMaxIdleTime,
+		ScanMinIdleTime:                s.cfg.ScanMinIdleTime,
 		ConsistencyCheckInterval:       s.cfg.ConsistencyCheckInterval,
 		ConsistencyCheckPanicOnFailure: s.cfg.ConsistencyCheckPanicOnFailure,
+		DisabledQueues:                 s.cfg.DisabledQueues,
+		RaftSchedulerWorkers:           s.cfg.RaftSchedulerWorkers,
+		RaftTickBatchSize:              s.cfg.RaftTickBatchSize,
+		MaxReplicas:                    s.cfg.MaxReplicasPerStore,
 		MetricsSampleInterval:          s.cfg.MetricsSampleInterval,
 		StorePool:                      s.storePool,
 		SQLExecutor: sql.InternalExecutor{
@@ -291,12 +301,13 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 		RangeLeaseActiveDuration:  active,
 		RangeLeaseRenewalDuration: renewal,
 		TimeSeriesDataStore:       s.tsDB,
+		EphemeralEngines:          s.cfg.EphemeralEngines,
 	}
 	if cfg.TestingKnobs.Store != nil {
 		storeCfg.TestingKnobs = *cfg.TestingKnobs.Store.(*storage.StoreTestingKnobs)
 	}
 
-	s.recorder = status.NewMetricsRecorder(s.clock)
+	s.recorder = status.NewMetricsRecorder(s.clock, s.rpcContext.RemoteClocks)
 	s.registry.AddMetricStruct(s.rpcContext.RemoteClocks.Metrics())
 
 	s.runtime = status.MakeRuntimeStatSampler(s.clock)
@@ -306,10 +317,15 @@ func NewServer(cfg Config, stopper *stop.Stopper) (*Server, error) {
 	roachpb.RegisterInternalServer(s.grpc, s.node)
 	storage.RegisterConsistencyServer(s.grpc, s.node.storesServer)
 	storage.RegisterFreezeServer(s.grpc, s.node.storesServer)
+	storage.RegisterStoreJobsServer(s.grpc, s.node.storesServer)
+	storage.RegisterStoreAttributesServer(s.grpc, s.node.storesServer)
+	storage.RegisterRaftRepairServer(s.grpc, s.node.storesServer)
+	storage.RegisterStoreQueuesServer(s.grpc, s.node.storesServer)
 
 	s.admin = makeAdminServer(s)
 	s.status = newStatusServer(
 		s.cfg.AmbientCtx, s.db, s.gossip, s.recorder, s.rpcContext, s.node.stores,
+		s.storePool, s.nodeLiveness,
 	)
 	for _, gw := range []grpcGatewayServer{&s.admin, s.status, &s.tsServer} {
 		gw.RegisterService(s.grpc)
@@ -515,7 +531,10 @@ func (s *Server) Start(ctx context.Context) error {
 	// TODO(marc): when cookie-based authentication exists,
 	// apply it for all web endpoints.
 	s.mux.HandleFunc(debugEndpoint, http.HandlerFunc(handleDebug))
+	s.mux.HandleFunc(settingsEndpoint, http.HandlerFunc(s.handleSettings))
+	s.mux.HandleFunc(clockEndpoint, http.HandlerFunc(s.handleClock))
 
+	s.registerSettingsCallback()
 	s.gossip.Start(unresolvedAdvertAddr)
 	log.Event(ctx, "started gossip")
 
@@ -531,6 +550,10 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 	log.Event(ctx, "started node")
 
+	if err := s.loadSettings(ctx); err != nil {
+		log.Warningf(ctx, "unable to load persisted settings: %s", err)
+	}
+
 	s.nodeLiveness.StartHeartbeat(ctx, s.stopper)
 
 	// Set the NodeID in the base context (which was inherited by the
@@ -551,6 +574,9 @@ func (s *Server) Start(ctx context.Context) error {
 	// Begin recording status summaries.
 	s.node.startWriteSummaries(s.cfg.MetricsSampleInterval)
 
+	// Begin verifying the meta records against the replicas of the stores.
+	s.status.metaVerifier.start(s.stopper)
+
 	s.sqlExecutor.SetNodeID(s.node.Descriptor.NodeID)
 
 	// Create and start the schema change manager only after a NodeID
@@ -0,0 +1,142 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/gossip"
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/security"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+)
+
+// settingsEndpoint lists the cluster settings and their current values on
+// this node. POSTing a "key" and a "value" to it changes a setting
+// cluster-wide; in secure mode, this requires a root or node client
+// certificate.
+const settingsEndpoint = "/debug/settings"
+
+// registerSettingsCallback applies cluster settings gossiped by any node to
+// the local settings registry.
+func (s *Server) registerSettingsCallback() {
+	prefix := gossip.MakeSettingKey("")
+	s.gossip.RegisterCallback(gossip.MakePrefixPattern(gossip.KeySettingPrefix),
+		func(key string, content roachpb.Value) {
+			ctx := s.AnnotateCtx(context.TODO())
+			name := strings.TrimPrefix(key, prefix)
+			encoded, err := content.GetBytes()
+			if err != nil {
+				log.Warningf(ctx, "unable to decode setting %s: %s", name, err)
+				return
+			}
+			if err := settings.Set(name, string(encoded)); err != nil {
+				log.Warningf(ctx, "unable to apply setting: %s", err)
+				return
+			}
+			log.Infof(ctx, "setting %s changed to %s", name, encoded)
+		})
+}
+
+// loadSettings applies the cluster settings persisted by handleSettings,
+// which the rest of the cluster may no longer be gossiping if it restarted.
+func (s *Server) loadSettings(ctx context.Context) error {
+	kvs, err := s.db.Scan(ctx, keys.SettingPrefix, keys.SettingPrefix.PrefixEnd(), 0)
+	if err != nil {
+		return err
+	}
+	for _, kv := range kvs {
+		name := strings.TrimPrefix(string(kv.Key), string(keys.SettingPrefix))
+		encoded, err := kv.Value.GetBytes()
+		if err != nil {
+			log.Warningf(ctx, "unable to decode setting %s: %s", name, err)
+			continue
+		}
+		if err := settings.Set(name, string(encoded)); err != nil {
+			log.Warningf(ctx, "unable to apply setting: %s", err)
+		}
+	}
+	return nil
+}
+
+// authorizeSettingsChange returns an error unless the request may change
+// cluster settings.
+func (s *Server) authorizeSettingsChange(r *http.Request) error {
+	if s.cfg.Insecure {
+		return nil
+	}
+	certUser, err := security.GetCertificateUser(r.TLS)
+	if err != nil {
+		return err
+	}
+	if certUser != security.RootUser && certUser != security.NodeUser {
+		return errors.Errorf("user %s is not allowed to change settings", certUser)
+	}
+	return nil
+}
+
+// handleSettings serves settingsEndpoint. A new value is validated and
+// persisted before it is applied locally and gossiped to the rest of the
+// cluster, so that a node never runs with a value the cluster didn't store.
+func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	switch r.Method {
+	case http.MethodGet:
+		for _, key := range settings.Keys() {
+			setting, _ := settings.Lookup(key)
+			fmt.Fprintf(w, "%s = %s (%s): %s\n", key, setting, setting.Typ(), setting.Description())
+		}
+	case http.MethodPost:
+		if err := s.authorizeSettingsChange(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		key, value := r.PostFormValue("key"), r.PostFormValue("value")
+		if key == "" {
+			http.Error(w, "missing setting key", http.StatusBadRequest)
+			return
+		}
+		if err := settings.Validate(key, value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s.node.Descriptor.NodeID == 0 {
+			http.Error(w, "node not yet initialized", http.StatusServiceUnavailable)
+			return
+		}
+		if err := s.db.Put(s.AnnotateCtx(context.TODO()), keys.SettingKey(key), []byte(value)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := settings.Set(key, value); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := s.gossip.AddInfo(gossip.MakeSettingKey(key), []byte(value), 0); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "ok: %s = %s\n", key, value)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -81,6 +81,9 @@ type statusServer struct {
 	metricSource metricMarshaler
 	rpcCtx       *rpc.Context
 	stores       *storage.Stores
+	storePool    *storage.StorePool
+	nodeLiveness *storage.NodeLiveness
+	metaVerifier *metaVerifier
 }
 
 // newStatusServer allocates and returns a statusServer.
@@ -91,6 +94,8 @@ func newStatusServer(
 	metricSource metricMarshaler,
 	rpcCtx *rpc.Context,
 	stores *storage.Stores,
+	storePool *storage.StorePool,
+	nodeLiveness *storage.NodeLiveness,
 ) *statusServer {
 	ambient.AddLogTag("status", nil)
 	server := &statusServer{
@@ -100,7 +105,10 @@ func newStatusServer(
 		metricSource:   metricSource,
 		rpcCtx:         rpcCtx,
 		stores:         stores,
+		storePool:      storePool,
+		nodeLiveness:   nodeLiveness,
 	}
+	server.metaVerifier = newMetaVerifier(server)
 
 	return server
 }
@@ -20,12 +20,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 
 	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/pkg/build"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/rpc"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/ts/tspb"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
@@ -93,6 +95,10 @@ type MetricsRecorder struct {
 		clock           *hlc.Clock
 		stores          map[roachpb.StoreID]storeMetrics
 
+		// remoteClocks provides the clock offsets to the node's peers which are
+		// included in status summaries. It may be nil.
+		remoteClocks *rpc.RemoteClockMonitor
+
 		// prometheusExporter merges metrics into families and generates the
 		// prometheus text format.
 		prometheusExporter metric.PrometheusExporter
@@ -106,13 +112,15 @@ type MetricsRecorder struct {
 }
 
 // NewMetricsRecorder initializes a new MetricsRecorder object that uses the
-// given clock.
-func NewMetricsRecorder(clock *hlc.Clock) *MetricsRecorder {
+// given clock. If remoteClocks is non-nil, status summaries include the clock
+// offsets it has measured.
+func NewMetricsRecorder(clock *hlc.Clock, remoteClocks *rpc.RemoteClockMonitor) *MetricsRecorder {
 	mr := &MetricsRecorder{}
 	mr.mu.storeRegistries = make(map[roachpb.StoreID]*metric.Registry)
 	mr.mu.stores = make(map[roachpb.StoreID]storeMetrics)
 	mr.mu.prometheusExporter = metric.MakePrometheusExporter()
 	mr.mu.clock = clock
+	mr.mu.remoteClocks = remoteClocks
 	return mr
 }
 
@@ -252,6 +260,8 @@ func (mr *MetricsRecorder) GetStatusSummary() *NodeStatus {
 		StartedAt:     mr.mu.startedAt,
 		StoreStatuses: make([]StoreStatus, 0, mr.mu.lastSummaryCount),
 		Metrics:       make(map[string]float64, mr.mu.lastNodeMetricCount),
+		HLCTimestamp:  mr.mu.clock.Now(),
+		ClockOffsets:  mr.clockOffsets(),
 	}
 
 	eachRecordableValue(mr.mu.nodeRegistry, func(name string, val float64) {
@@ -285,6 +295,31 @@ func (mr *MetricsRecorder) GetStatusSummary() *NodeStatus {
 	return nodeStat
 }
 
+// clockOffsets returns the clock offsets to the node's peers, sorted by
+// address.
+func (mr *MetricsRecorder) clockOffsets() []ClockOffset {
+	if mr.mu.remoteClocks == nil {
+		return nil
+	}
+	offsets := mr.mu.remoteClocks.AllOffsets()
+	addrs := make([]string, 0, len(offsets))
+	for addr := range offsets {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	result := make([]ClockOffset, 0, len(addrs))
+	for _, addr := range addrs {
+		offset := offsets[addr]
+		result = append(result, ClockOffset{
+			Address:     addr,
+			Offset:      offset.Offset,
+			Uncertainty: offset.Uncertainty,
+			MeasuredAt:  offset.MeasuredAt,
+		})
+	}
+	return result
+}
+
 // registryRecorder is a helper class for recording time series datapoints
 // from a metrics Registry.
 type registryRecorder struct {
@@ -144,7 +144,7 @@ func TestMetricsRecorder(t *testing.T) {
 		registry: metric.NewRegistry(),
 	}
 	manual := hlc.NewManualClock(100)
-	recorder := NewMetricsRecorder(hlc.NewClock(manual.UnixNano))
+	recorder := NewMetricsRecorder(hlc.NewClock(manual.UnixNano), nil)
 	recorder.AddStore(store1)
 	recorder.AddStore(store2)
 	recorder.AddNode(reg1, nodeDesc, 50)
@@ -312,11 +312,12 @@ func TestMetricsRecorder(t *testing.T) {
 	// Verify node summary generation
 	// ========================================
 	expectedNodeSummary := &NodeStatus{
-		Desc:      nodeDesc,
-		BuildInfo: build.GetInfo(),
-		StartedAt: 50,
-		UpdatedAt: 100,
-		Metrics:   expectedNodeSummaryMetrics,
+		Desc:         nodeDesc,
+		BuildInfo:    build.GetInfo(),
+		StartedAt:    50,
+		UpdatedAt:    100,
+		Metrics:      expectedNodeSummaryMetrics,
+		HLCTimestamp: hlc.Timestamp{WallTime: 100},
 		StoreStatuses: []StoreStatus{
 			{
 				Desc:    storeDesc1,
@@ -0,0 +1,128 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+)
+
+// StorePool returns the state of every store known to this node's StorePool.
+func (s *statusServer) StorePool(
+	ctx context.Context, req *serverpb.StorePoolRequest,
+) (*serverpb.StorePoolResponse, error) {
+	return &serverpb.StorePoolResponse{
+		Stores:    storePoolStores(s.storePool.GetStores()),
+		Rebalance: rebalanceProgress(s.storePool.GetRebalanceProgress()),
+	}, nil
+}
+
+// PurgeStorePool makes this node's StorePool forget the stores which were
+// found dead without ever being gossiped.
+func (s *statusServer) PurgeStorePool(
+	ctx context.Context, req *serverpb.PurgeStorePoolRequest,
+) (*serverpb.PurgeStorePoolResponse, error) {
+	resp := &serverpb.PurgeStorePoolResponse{}
+	for _, storeID := range s.storePool.PurgeUnknownStores(req.StoreID) {
+		resp.Stores = append(resp.Stores, serverpb.PurgedStore{StoreID: storeID})
+	}
+	log.Infof(ctx, "purged %d unknown stores from the store pool", len(resp.Stores))
+	return resp, nil
+}
+
+// unixNanos returns t in nanoseconds since the Unix epoch, or zero if t is
+// unset.
+func unixNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// storePoolStores converts the StorePool's view of the stores into their
+// status representation.
+func storePoolStores(stores []storage.StoreHealth) []serverpb.StorePoolStore {
+	result := make([]serverpb.StorePoolStore, 0, len(stores))
+	for _, store := range stores {
+		desc := store.Desc
+		result = append(result, serverpb.StorePoolStore{
+			StoreID:             desc.StoreID,
+			NodeID:              desc.Node.NodeID,
+			Dead:                store.Dead,
+			TimesDied:           int32(store.TimesDied),
+			Throttled:           store.Throttled,
+			ThrottledUntilNanos: unixNanos(store.ThrottledUntil),
+			LastUpdatedNanos:    store.LastUpdated.WallTime,
+			DeadAsOfNanos:       unixNanos(store.DeadAsOf),
+			DeadReplicas:        int32(store.DeadReplicas),
+			TotalDeadReplicas:   int32(store.TotalDeadReplicas),
+			Capacity:            desc.Capacity.Capacity,
+			Available:           desc.Capacity.Available,
+			RangeCount:          desc.Capacity.RangeCount,
+			LeaseCount:          desc.Capacity.LeaseCount,
+			Desc:                desc,
+			Recovery:            storeRecovery(store.Recovery),
+		})
+	}
+	return result
+}
+
+// storeRecovery converts the StorePool's RecoveryEstimate of a dead store
+// into its status representation.
+func storeRecovery(e *storage.RecoveryEstimate) *serverpb.StoreRecovery {
+	if e == nil {
+		return nil
+	}
+	return &serverpb.StoreRecovery{
+		Ranges:            e.Ranges,
+		Bytes:             e.Bytes,
+		RecoveredBytes:    e.RecoveredBytes,
+		FractionCompleted: e.FractionCompleted,
+		Rate:              e.Rate,
+		EtaNanos:          e.ETA.Nanoseconds(),
+	}
+}
+
+// rebalanceProgress converts the StorePool's RebalanceProgress into its
+// status representation.
+func rebalanceProgress(p storage.RebalanceProgress) serverpb.RebalanceProgress {
+	result := serverpb.RebalanceProgress{
+		Stores:          int32(p.Stores),
+		MeanRangeCount:  p.MeanRangeCount,
+		MeanLeaseCount:  p.MeanLeaseCount,
+		RangeImbalance:  p.RangeImbalance,
+		LeaseImbalance:  p.LeaseImbalance,
+		ExcessReplicas:  p.ExcessReplicas,
+		ConvergenceRate: p.ConvergenceRate,
+		EtaNanos:        p.ETA.Nanoseconds(),
+		Operations:      make([]serverpb.RebalanceOperation, 0, len(p.Operations)),
+	}
+	for _, op := range p.Operations {
+		result.Operations = append(result.Operations, serverpb.RebalanceOperation{
+			RangeID:           op.RangeID,
+			FromStoreID:       op.From,
+			ToStoreID:         op.To,
+			StartedNanos:      unixNanos(op.Started),
+			CompletedNanos:    unixNanos(op.Completed),
+			FractionCompleted: op.FractionCompleted(),
+		})
+	}
+	return result
+}
@@ -0,0 +1,198 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/testutils/serverutils"
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestStorePoolStores(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	throttledUntil := time.Unix(100, 0)
+	deadAsOf := time.Unix(200, 0)
+	desc1 := roachpb.StoreDescriptor{
+		StoreID: 1,
+		Node:    roachpb.NodeDescriptor{NodeID: 2},
+		Capacity: roachpb.StoreCapacity{
+			Capacity: 100, Available: 50, RangeCount: 10, LeaseCount: 5,
+		},
+	}
+	desc2 := roachpb.StoreDescriptor{StoreID: 2, Node: roachpb.NodeDescriptor{NodeID: 3}}
+	stores := storePoolStores([]storage.StoreHealth{
+		{
+			Desc:              desc1,
+			Dead:              true,
+			TimesDied:         3,
+			Throttled:         true,
+			ThrottledUntil:    throttledUntil,
+			LastUpdated:       hlc.Timestamp{WallTime: 150},
+			DeadAsOf:          deadAsOf,
+			DeadReplicas:      4,
+			TotalDeadReplicas: 6,
+			Recovery: &storage.RecoveryEstimate{
+				Ranges:            10,
+				Bytes:             1000,
+				RecoveredBytes:    250,
+				FractionCompleted: 0.25,
+				Rate:              100,
+				ETA:               7500 * time.Millisecond,
+			},
+		},
+		{
+			Desc: desc2,
+		},
+	})
+
+	expected := []serverpb.StorePoolStore{
+		{
+			StoreID:             1,
+			NodeID:              2,
+			Dead:                true,
+			TimesDied:           3,
+			Throttled:           true,
+			ThrottledUntilNanos: throttledUntil.UnixNano(),
+			LastUpdatedNanos:    150,
+			DeadAsOfNanos:       deadAsOf.UnixNano(),
+			DeadReplicas:        4,
+			TotalDeadReplicas:   6,
+			Capacity:            100,
+			Available:           50,
+			RangeCount:          10,
+			LeaseCount:          5,
+			Desc:                desc1,
+			Recovery: &serverpb.StoreRecovery{
+				Ranges:            10,
+				Bytes:             1000,
+				RecoveredBytes:    250,
+				FractionCompleted: 0.25,
+				Rate:              100,
+				EtaNanos:          (7500 * time.Millisecond).Nanoseconds(),
+			},
+		},
+		// Unset times are reported as zero.
+		{StoreID: 2, NodeID: 3, Desc: desc2},
+	}
+	if len(stores) != len(expected) {
+		t.Fatalf("expected %d stores, got %+v", len(expected), stores)
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(stores[i], expected[i]) {
+			t.Errorf("%d: expected %+v, got %+v", i, expected[i], stores[i])
+		}
+	}
+}
+
+func TestStorePoolRebalanceProgress(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	started := time.Unix(100, 0)
+	completed := time.Unix(200, 0)
+	progress := rebalanceProgress(storage.RebalanceProgress{
+		ClusterBalance: storage.ClusterBalance{
+			Stores:         3,
+			MeanRangeCount: 20,
+			MeanLeaseCount: 10,
+			RangeImbalance: 0.5,
+			LeaseImbalance: 0.1,
+			ExcessReplicas: 9,
+		},
+		ConvergenceRate: 0.5,
+		ETA:             18 * time.Second,
+		Operations: []storage.RebalanceOperation{
+			{RangeID: 1, From: 1, To: 2, Started: started, Completed: completed},
+			{RangeID: 2, To: 3, Started: started},
+		},
+	})
+
+	expected := serverpb.RebalanceProgress{
+		Stores:          3,
+		MeanRangeCount:  20,
+		MeanLeaseCount:  10,
+		RangeImbalance:  0.5,
+		LeaseImbalance:  0.1,
+		ExcessReplicas:  9,
+		ConvergenceRate: 0.5,
+		EtaNanos:        (18 * time.Second).Nanoseconds(),
+		Operations: []serverpb.RebalanceOperation{
+			{
+				RangeID:           1,
+				FromStoreID:       1,
+				ToStoreID:         2,
+				StartedNanos:      started.UnixNano(),
+				CompletedNanos:    completed.UnixNano(),
+				FractionCompleted: 1,
+			},
+			// A move which hasn't completed is half done.
+			{RangeID: 2, ToStoreID: 3, StartedNanos: started.UnixNano(), FractionCompleted: 0.5},
+		},
+	}
+	if !reflect.DeepEqual(progress, expected) {
+		t.Errorf("expected %+v, got %+v", expected, progress)
+	}
+}
+
+// TestStorePoolResponse verifies that the /_status/stores-pool endpoint
+// reports the stores of a single node cluster.
+func TestStorePoolResponse(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ts := startServer(t)
+	defer ts.Stopper().Stop()
+
+	util.SucceedsSoon(t, func() error {
+		var response serverpb.StorePoolResponse
+		if err := getStatusJSONProto(ts, "stores-pool", &response); err != nil {
+			return err
+		}
+		if len(response.Stores) != 3 {
+			return errors.Errorf("expected 3 stores, got %+v", response.Stores)
+		}
+		for _, s := range response.Stores {
+			if s.NodeID != ts.node.Descriptor.NodeID || s.Dead || s.LastUpdatedNanos == 0 {
+				return errors.Errorf("unexpected store %+v", s)
+			}
+		}
+		return nil
+	})
+}
+
+func TestPurgeStorePoolResponse(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ts := startServer(t)
+	defer ts.Stopper().Stop()
+
+	// All the stores of the server are gossiped, so none is purged.
+	var response serverpb.PurgeStorePoolResponse
+	if err := serverutils.PostJSONProto(
+		ts, statusPrefix+"stores-pool/purge", &serverpb.PurgeStorePoolRequest{}, &response,
+	); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Stores) != 0 {
+		t.Fatalf("expected no purged stores, got %+v", response.Stores)
+	}
+}
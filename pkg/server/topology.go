@@ -0,0 +1,124 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+)
+
+// Topology returns the cluster's locality tree as seen by this node's
+// StorePool and node liveness.
+func (s *statusServer) Topology(
+	ctx context.Context, req *serverpb.TopologyRequest,
+) (*serverpb.TopologyResponse, error) {
+	return &serverpb.TopologyResponse{
+		Root: buildTopology(s.storePool.GetStores(), s.nodeLiveness.IsLive),
+	}, nil
+}
+
+// addTopologyStats adds the stats in o to s.
+func addTopologyStats(s *serverpb.TopologyStats, o serverpb.TopologyStats) {
+	s.Capacity += o.Capacity
+	s.Available += o.Available
+	s.RangeCount += o.RangeCount
+	s.LeaseCount += o.LeaseCount
+	s.LiveNodes += o.LiveNodes
+	s.DeadNodes += o.DeadNodes
+	s.LiveStores += o.LiveStores
+	s.DeadStores += o.DeadStores
+}
+
+// buildTopology arranges the given stores into a tree of localities, in
+// which each node appears at the level of its most specific locality tier.
+// The liveness of a node is determined by isLive; nodes without a liveness
+// record are considered live if any of their stores is.
+func buildTopology(
+	stores []storage.StoreHealth, isLive func(roachpb.NodeID) (bool, error),
+) serverpb.TopologyLocality {
+	nodes := make(map[roachpb.NodeID]*serverpb.TopologyNode)
+	localities := make(map[roachpb.NodeID]roachpb.Locality)
+	var nodeIDs []roachpb.NodeID
+	for _, store := range stores {
+		desc := store.Desc
+		node, ok := nodes[desc.Node.NodeID]
+		if !ok {
+			node = &serverpb.TopologyNode{
+				NodeID:  desc.Node.NodeID,
+				Address: desc.Node.Address,
+			}
+			nodes[desc.Node.NodeID] = node
+			localities[desc.Node.NodeID] = desc.Node.Locality
+			nodeIDs = append(nodeIDs, desc.Node.NodeID)
+		}
+		s := serverpb.TopologyStore{
+			StoreID: desc.StoreID,
+			Live:    !store.Dead,
+			Stats: serverpb.TopologyStats{
+				Capacity:   desc.Capacity.Capacity,
+				Available:  desc.Capacity.Available,
+				RangeCount: desc.Capacity.RangeCount,
+				LeaseCount: desc.Capacity.LeaseCount,
+			},
+		}
+		if s.Live {
+			s.Stats.LiveStores = 1
+			node.Live = true
+		} else {
+			s.Stats.DeadStores = 1
+		}
+		node.Stores = append(node.Stores, s)
+		addTopologyStats(&node.Stats, s.Stats)
+	}
+
+	var root serverpb.TopologyLocality
+	for _, nodeID := range nodeIDs {
+		node := nodes[nodeID]
+		if live, err := isLive(nodeID); err == nil {
+			node.Live = live
+		}
+		if node.Live {
+			node.Stats.LiveNodes = 1
+		} else {
+			node.Stats.DeadNodes = 1
+		}
+
+		level := &root
+		addTopologyStats(&level.Stats, node.Stats)
+		for _, tier := range localities[nodeID].Tiers {
+			var child *serverpb.TopologyLocality
+			for i := range level.Children {
+				if c := &level.Children[i]; c.Key == tier.Key && c.Value == tier.Value {
+					child = c
+					break
+				}
+			}
+			if child == nil {
+				level.Children = append(level.Children, serverpb.TopologyLocality{
+					Key:   tier.Key,
+					Value: tier.Value,
+				})
+				child = &level.Children[len(level.Children)-1]
+			}
+			level = child
+			addTopologyStats(&level.Stats, node.Stats)
+		}
+		level.Nodes = append(level.Nodes, *node)
+	}
+	return root
+}
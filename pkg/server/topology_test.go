@@ -0,0 +1,142 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package server
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/server/serverpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestBuildTopology(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	locality := func(region, zone string) roachpb.Locality {
+		return roachpb.Locality{Tiers: []roachpb.Tier{
+			{Key: "region", Value: region},
+			{Key: "zone", Value: zone},
+		}}
+	}
+	store := func(
+		storeID roachpb.StoreID, nodeID roachpb.NodeID, l roachpb.Locality, ranges int32, dead bool,
+	) storage.StoreHealth {
+		return storage.StoreHealth{
+			Desc: roachpb.StoreDescriptor{
+				StoreID: storeID,
+				Node:    roachpb.NodeDescriptor{NodeID: nodeID, Locality: l},
+				Capacity: roachpb.StoreCapacity{
+					Capacity: 100, Available: 50, RangeCount: ranges, LeaseCount: ranges / 2,
+				},
+			},
+			Dead: dead,
+		}
+	}
+	stores := []storage.StoreHealth{
+		store(1, 1, locality("us", "a"), 10, false),
+		store(2, 1, locality("us", "a"), 20, false),
+		store(3, 2, locality("us", "b"), 30, false),
+		store(4, 3, locality("eu", "a"), 40, true),
+		// Node 4 has no locality and no liveness record.
+		store(5, 4, roachpb.Locality{}, 50, false),
+	}
+	isLive := func(nodeID roachpb.NodeID) (bool, error) {
+		switch nodeID {
+		case 2:
+			return false, nil
+		case 4:
+			return false, errors.New("no liveness record")
+		}
+		return true, nil
+	}
+
+	root := buildTopology(stores, isLive)
+
+	expRoot := serverpb.TopologyStats{
+		Capacity: 500, Available: 250, RangeCount: 150, LeaseCount: 75,
+		LiveNodes: 3, DeadNodes: 1, LiveStores: 4, DeadStores: 1,
+	}
+	if root.Stats != expRoot {
+		t.Errorf("expected root stats %+v, got %+v", expRoot, root.Stats)
+	}
+	if len(root.Nodes) != 1 || root.Nodes[0].NodeID != 4 || !root.Nodes[0].Live {
+		t.Errorf("expected live node 4 at the root, got %+v", root.Nodes)
+	}
+	if len(root.Children) != 2 {
+		t.Fatalf("expected 2 regions, got %+v", root.Children)
+	}
+
+	us := root.Children[0]
+	if us.Key != "region" || us.Value != "us" {
+		t.Fatalf("expected region us first, got %s=%s", us.Key, us.Value)
+	}
+	expUS := serverpb.TopologyStats{
+		Capacity: 300, Available: 150, RangeCount: 60, LeaseCount: 30,
+		LiveNodes: 1, DeadNodes: 1, LiveStores: 3,
+	}
+	if us.Stats != expUS {
+		t.Errorf("expected region us stats %+v, got %+v", expUS, us.Stats)
+	}
+	if len(us.Children) != 2 {
+		t.Fatalf("expected 2 zones in region us, got %+v", us.Children)
+	}
+	zoneA := us.Children[0]
+	if len(zoneA.Nodes) != 1 || len(zoneA.Nodes[0].Stores) != 2 {
+		t.Fatalf("expected a single node with 2 stores in zone us/a, got %+v", zoneA.Nodes)
+	}
+	if n := zoneA.Nodes[0]; n.NodeID != 1 || !n.Live || n.Stats.RangeCount != 30 {
+		t.Errorf("unexpected node in zone us/a: %+v", n)
+	}
+	// Node 2's liveness record overrides the liveness of its stores.
+	if n := us.Children[1].Nodes[0]; n.NodeID != 2 || n.Live || n.Stats.DeadNodes != 1 {
+		t.Errorf("expected dead node 2 in zone us/b, got %+v", n)
+	}
+
+	eu := root.Children[1]
+	if eu.Value != "eu" || eu.Stats.DeadStores != 1 || eu.Stats.LiveStores != 0 {
+		t.Errorf("unexpected region eu: %+v", eu)
+	}
+	if s := eu.Children[0].Nodes[0].Stores[0]; s.StoreID != 4 || s.Live {
+		t.Errorf("expected dead store 4 in zone eu/a, got %+v", s)
+	}
+}
+
+// TestTopologyResponse verifies that the /_status/topology endpoint reports
+// the stores of a single node cluster.
+func TestTopologyResponse(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ts := startServer(t)
+	defer ts.Stopper().Stop()
+
+	util.SucceedsSoon(t, func() error {
+		var response serverpb.TopologyResponse
+		if err := getStatusJSONProto(ts, "topology", &response); err != nil {
+			return err
+		}
+		if response.Root.Stats.LiveStores != 3 {
+			return errors.Errorf("expected 3 live stores, got %+v", response.Root.Stats)
+		}
+		if len(response.Root.Nodes) != 1 || response.Root.Nodes[0].NodeID != ts.node.Descriptor.NodeID {
+			return errors.Errorf("expected node %d at the root, got %+v",
+				ts.node.Descriptor.NodeID, response.Root.Nodes)
+		}
+		return nil
+	})
+}
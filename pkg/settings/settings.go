@@ -0,0 +1,371 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package settings implements a registry of cluster settings: named, typed
+// tunables which, unlike environment variables, can be changed while the
+// process is running. Settings are registered at init time by the packages
+// consuming them and read through their Get method, which is cheap enough to
+// be called on every use. The server propagates changes through gossip and
+// applies them via Set.
+package settings
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// Setting is the interface implemented by all registered settings.
+type Setting interface {
+	// Typ returns a short name for the type of the setting.
+	Typ() string
+	// Description returns the description the setting was registered with.
+	Description() string
+	// String returns the encoded current value of the setting.
+	String() string
+
+	validate(encoded string) error
+	set(encoded string) error
+	reset()
+}
+
+var registry struct {
+	syncutil.Mutex
+	settings map[string]Setting
+}
+
+func register(key string, s Setting) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.settings == nil {
+		registry.settings = make(map[string]Setting)
+	}
+	if _, ok := registry.settings[key]; ok {
+		panic(fmt.Sprintf("setting already defined: %s", key))
+	}
+	registry.settings[key] = s
+}
+
+// Lookup returns the setting registered under the given key.
+func Lookup(key string) (Setting, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+	s, ok := registry.settings[key]
+	return s, ok
+}
+
+// Keys returns the sorted keys of all registered settings.
+func Keys() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	keys := make([]string, 0, len(registry.settings))
+	for k := range registry.settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Validate returns an error unless the encoded value could be applied to the
+// setting registered under the given key. The setting is left unchanged.
+func Validate(key, encoded string) error {
+	s, ok := Lookup(key)
+	if !ok {
+		return errors.Errorf("unknown setting: %s", key)
+	}
+	if err := s.validate(encoded); err != nil {
+		return errors.Wrapf(err, "invalid value for %s (%s)", key, s.Typ())
+	}
+	return nil
+}
+
+// Set parses the encoded value and applies it to the setting registered
+// under the given key.
+func Set(key, encoded string) error {
+	s, ok := Lookup(key)
+	if !ok {
+		return errors.Errorf("unknown setting: %s", key)
+	}
+	if err := s.set(encoded); err != nil {
+		return errors.Wrapf(err, "invalid value for %s (%s)", key, s.Typ())
+	}
+	return nil
+}
+
+// Reset restores the setting registered under the given key to its default
+// value.
+func Reset(key string) error {
+	s, ok := Lookup(key)
+	if !ok {
+		return errors.Errorf("unknown setting: %s", key)
+	}
+	s.reset()
+	return nil
+}
+
+// TestingSetBool sets a bool setting for the duration of a test, returning a
+// function which restores the previous value.
+func TestingSetBool(s *BoolSetting, v bool) func() {
+	prev := s.Get()
+	s.setValue(v)
+	return func() { s.setValue(prev) }
+}
+
+// TestingSetFloat sets a float setting for the duration of a test, returning
+// a function which restores the previous value.
+func TestingSetFloat(s *FloatSetting, v float64) func() {
+	prev := s.Get()
+	s.setValue(v)
+	return func() { s.setValue(prev) }
+}
+
+// TestingSetInt sets an int setting for the duration of a test, returning a
+// function which restores the previous value.
+func TestingSetInt(s *IntSetting, v int64) func() {
+	prev := s.Get()
+	s.setValue(v)
+	return func() { s.setValue(prev) }
+}
+
+// TestingSetDuration sets a duration setting for the duration of a test,
+// returning a function which restores the previous value.
+func TestingSetDuration(s *DurationSetting, v time.Duration) func() {
+	prev := s.Get()
+	s.setValue(v)
+	return func() { s.setValue(prev) }
+}
+
+// TestingDurationSetting returns a DurationSetting holding v which is not
+// registered, so that a test can give a component its own value for a
+// setting the component otherwise reads from the registry.
+func TestingDurationSetting(v time.Duration) *DurationSetting {
+	return &DurationSetting{defaultValue: v, v: int64(v)}
+}
+
+// FloatSetting is a setting holding a float64.
+type FloatSetting struct {
+	bits         uint64 // accessed atomically; must be 64-bit aligned
+	desc         string
+	defaultValue float64
+}
+
+var _ Setting = &FloatSetting{}
+
+// RegisterFloatSetting defines a new float setting.
+func RegisterFloatSetting(key, desc string, defaultValue float64) *FloatSetting {
+	s := &FloatSetting{desc: desc, defaultValue: defaultValue}
+	s.reset()
+	register(key, s)
+	return s
+}
+
+// Get returns the current value of the setting.
+func (s *FloatSetting) Get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.bits))
+}
+
+func (s *FloatSetting) setValue(v float64) {
+	atomic.StoreUint64(&s.bits, math.Float64bits(v))
+}
+
+// Typ implements the Setting interface.
+func (*FloatSetting) Typ() string { return "float" }
+
+// Description implements the Setting interface.
+func (s *FloatSetting) Description() string { return s.desc }
+
+func (s *FloatSetting) String() string {
+	return strconv.FormatFloat(s.Get(), 'g', -1, 64)
+}
+
+func (*FloatSetting) validate(encoded string) error {
+	_, err := strconv.ParseFloat(encoded, 64)
+	return err
+}
+
+func (s *FloatSetting) set(encoded string) error {
+	v, err := strconv.ParseFloat(encoded, 64)
+	if err != nil {
+		return err
+	}
+	s.setValue(v)
+	return nil
+}
+
+func (s *FloatSetting) reset() { s.setValue(s.defaultValue) }
+
+// IntSetting is a setting holding an int64.
+type IntSetting struct {
+	v            int64 // accessed atomically; must be 64-bit aligned
+	desc         string
+	defaultValue int64
+}
+
+var _ Setting = &IntSetting{}
+
+// RegisterIntSetting defines a new int setting.
+func RegisterIntSetting(key, desc string, defaultValue int64) *IntSetting {
+	s := &IntSetting{desc: desc, defaultValue: defaultValue, v: defaultValue}
+	register(key, s)
+	return s
+}
+
+// Get returns the current value of the setting.
+func (s *IntSetting) Get() int64 {
+	return atomic.LoadInt64(&s.v)
+}
+
+// Typ implements the Setting interface.
+func (*IntSetting) Typ() string { return "int" }
+
+// Description implements the Setting interface.
+func (s *IntSetting) Description() string { return s.desc }
+
+func (s *IntSetting) String() string {
+	return strconv.FormatInt(s.Get(), 10)
+}
+
+func (s *IntSetting) setValue(v int64) {
+	atomic.StoreInt64(&s.v, v)
+}
+
+func (*IntSetting) validate(encoded string) error {
+	_, err := strconv.ParseInt(encoded, 10, 64)
+	return err
+}
+
+func (s *IntSetting) set(encoded string) error {
+	v, err := strconv.ParseInt(encoded, 10, 64)
+	if err != nil {
+		return err
+	}
+	s.setValue(v)
+	return nil
+}
+
+func (s *IntSetting) reset() { s.setValue(s.defaultValue) }
+
+// BoolSetting is a setting holding a bool.
+type BoolSetting struct {
+	desc         string
+	defaultValue bool
+	v            int32
+}
+
+var _ Setting = &BoolSetting{}
+
+// RegisterBoolSetting defines a new bool setting.
+func RegisterBoolSetting(key, desc string, defaultValue bool) *BoolSetting {
+	s := &BoolSetting{desc: desc, defaultValue: defaultValue}
+	s.reset()
+	register(key, s)
+	return s
+}
+
+// Get returns the current value of the setting.
+func (s *BoolSetting) Get() bool {
+	return atomic.LoadInt32(&s.v) != 0
+}
+
+func (s *BoolSetting) setValue(v bool) {
+	var i int32
+	if v {
+		i = 1
+	}
+	atomic.StoreInt32(&s.v, i)
+}
+
+// Typ implements the Setting interface.
+func (*BoolSetting) Typ() string { return "bool" }
+
+// Description implements the Setting interface.
+func (s *BoolSetting) Description() string { return s.desc }
+
+func (s *BoolSetting) String() string {
+	return strconv.FormatBool(s.Get())
+}
+
+func (*BoolSetting) validate(encoded string) error {
+	_, err := strconv.ParseBool(encoded)
+	return err
+}
+
+func (s *BoolSetting) set(encoded string) error {
+	v, err := strconv.ParseBool(encoded)
+	if err != nil {
+		return err
+	}
+	s.setValue(v)
+	return nil
+}
+
+func (s *BoolSetting) reset() { s.setValue(s.defaultValue) }
+
+// DurationSetting is a setting holding a time.Duration.
+type DurationSetting struct {
+	v            int64 // accessed atomically; must be 64-bit aligned
+	desc         string
+	defaultValue time.Duration
+}
+
+var _ Setting = &DurationSetting{}
+
+// RegisterDurationSetting defines a new duration setting.
+func RegisterDurationSetting(key, desc string, defaultValue time.Duration) *DurationSetting {
+	s := &DurationSetting{desc: desc, defaultValue: defaultValue, v: int64(defaultValue)}
+	register(key, s)
+	return s
+}
+
+// Get returns the current value of the setting.
+func (s *DurationSetting) Get() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.v))
+}
+
+// Typ implements the Setting interface.
+func (*DurationSetting) Typ() string { return "duration" }
+
+// Description implements the Setting interface.
+func (s *DurationSetting) Description() string { return s.desc }
+
+func (s *DurationSetting) String() string {
+	return s.Get().String()
+}
+
+func (s *DurationSetting) setValue(v time.Duration) {
+	atomic.StoreInt64(&s.v, int64(v))
+}
+
+func (*DurationSetting) validate(encoded string) error {
+	_, err := time.ParseDuration(encoded)
+	return err
+}
+
+func (s *DurationSetting) set(encoded string) error {
+	v, err := time.ParseDuration(encoded)
+	if err != nil {
+		return err
+	}
+	s.setValue(v)
+	return nil
+}
+
+func (s *DurationSetting) reset() { s.setValue(s.defaultValue) }
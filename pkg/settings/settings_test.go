@@ -0,0 +1,118 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package settings
+
+import (
+	"testing"
+	"time"
+)
+
+var (
+	testFloat    = RegisterFloatSetting("test.float", "a float", 1.5)
+	testInt      = RegisterIntSetting("test.int", "an int", 2)
+	testBool     = RegisterBoolSetting("test.bool", "a bool", true)
+	testDuration = RegisterDurationSetting("test.duration", "a duration", time.Second)
+)
+
+func TestSettingsDefaults(t *testing.T) {
+	if v := testFloat.Get(); v != 1.5 {
+		t.Errorf("expected 1.5, got %v", v)
+	}
+	if v := testInt.Get(); v != 2 {
+		t.Errorf("expected 2, got %v", v)
+	}
+	if v := testBool.Get(); !v {
+		t.Errorf("expected true, got %v", v)
+	}
+	if v := testDuration.Get(); v != time.Second {
+		t.Errorf("expected 1s, got %v", v)
+	}
+}
+
+func TestSettingsSetAndReset(t *testing.T) {
+	testCases := []struct {
+		key, value string
+		s          Setting
+	}{
+		{"test.float", "0.25", testFloat},
+		{"test.int", "-7", testInt},
+		{"test.bool", "false", testBool},
+		{"test.duration", "1m0s", testDuration},
+	}
+	for _, c := range testCases {
+		def := c.s.String()
+		if err := Set(c.key, c.value); err != nil {
+			t.Fatal(err)
+		}
+		if v := c.s.String(); v != c.value {
+			t.Errorf("%s: expected %s, got %s", c.key, c.value, v)
+		}
+		if err := Set(c.key, "garbage"); err == nil {
+			t.Errorf("%s: expected error setting invalid value", c.key)
+		}
+		if v := c.s.String(); v != c.value {
+			t.Errorf("%s: invalid value changed setting to %s", c.key, v)
+		}
+		if err := Reset(c.key); err != nil {
+			t.Fatal(err)
+		}
+		if v := c.s.String(); v != def {
+			t.Errorf("%s: expected reset to %s, got %s", c.key, def, v)
+		}
+	}
+
+	if err := Set("test.unknown", "1"); err == nil {
+		t.Error("expected error setting unknown setting")
+	}
+}
+
+func TestSettingsValidate(t *testing.T) {
+	if err := Validate("test.int", "7"); err != nil {
+		t.Fatal(err)
+	}
+	if v := testInt.Get(); v != 2 {
+		t.Errorf("validating changed the setting to %d", v)
+	}
+	if err := Validate("test.int", "garbage"); err == nil {
+		t.Error("expected error validating invalid value")
+	}
+	if err := Validate("test.unknown", "1"); err == nil {
+		t.Error("expected error validating unknown setting")
+	}
+}
+
+func TestSettingsKeys(t *testing.T) {
+	keys := Keys()
+	expected := []string{"test.bool", "test.duration", "test.float", "test.int"}
+	if len(keys) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, keys)
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, keys)
+		}
+	}
+}
+
+func TestTestingSetFloat(t *testing.T) {
+	restore := TestingSetFloat(testFloat, 3)
+	if v := testFloat.Get(); v != 3 {
+		t.Errorf("expected 3, got %v", v)
+	}
+	restore()
+	if v := testFloat.Get(); v != 1.5 {
+		t.Errorf("expected 1.5, got %v", v)
+	}
+}
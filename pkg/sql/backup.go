@@ -23,8 +23,11 @@ import (
 	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"golang.org/x/net/context"
@@ -36,6 +39,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/util/encoding"
+	"github.com/cockroachdb/cockroach/pkg/util/extstorage"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
@@ -86,7 +90,7 @@ func allSQLDescriptors(txn *client.Txn) ([]sqlbase.Descriptor, error) {
 //
 // The output is an sstable per range with files in the following locations:
 // - /<base>/<node_id>/<key_range>/data.sst
-// - <base> is given by the user and is expected to eventually be cloud storage
+// - <base> is a URI given by the user, see extstorage.FromURI
 // - The <key_range>s are non-overlapping.
 //
 // TODO(dan): Bikeshed this directory structure and naming.
@@ -94,10 +98,27 @@ func Backup(
 	ctx context.Context, db client.DB, base string, endTime hlc.Timestamp,
 ) (desc sqlbase.BackupDescriptor, retErr error) {
 	// TODO(dan): Optionally take a start time for an incremental backup.
-	// TODO(dan): Take a uri for the path prefix and support various cloud storages.
 	// TODO(dan): Figure out how permissions should work. #6713 is tracking this
 	// for grpc.
 
+	es, err := extstorage.FromURI(base, nil /* metrics */)
+	if err != nil {
+		return sqlbase.BackupDescriptor{}, err
+	}
+	defer es.Close()
+
+	// The sstables are written locally before being copied to the external
+	// storage.
+	tmpDir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		return sqlbase.BackupDescriptor{}, err
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			log.Warningf(ctx, "unable to remove temporary directory %s: %s", tmpDir, err)
+		}
+	}()
+
 	var rangeDescs []roachpb.RangeDescriptor
 	var sqlDescs []sqlbase.Descriptor
 
@@ -139,11 +160,8 @@ func Backup(
 		}
 
 		nodeID := 0
-		dir := filepath.Join(base, fmt.Sprintf("%03d", nodeID))
-		dir = filepath.Join(dir, fmt.Sprintf("%x-%x", rangeDesc.StartKey, rangeDesc.EndKey))
-		if err := os.MkdirAll(dir, 0700); err != nil {
-			return sqlbase.BackupDescriptor{}, err
-		}
+		dir := path.Join(fmt.Sprintf("%03d", nodeID),
+			fmt.Sprintf("%x-%x", rangeDesc.StartKey, rangeDesc.EndKey))
 
 		var kvs []client.KeyValue
 
@@ -167,13 +185,14 @@ func Backup(
 			continue
 		}
 
-		backupDescs[i].Path = filepath.Join(dir, dataSSTableName)
+		backupDescs[i].Path = path.Join(dir, dataSSTableName)
+		localPath := filepath.Join(tmpDir, fmt.Sprintf("%d.sst", i))
 
 		writeSST := func() (writeSSTErr error) {
 			// This is a function so the defered Close (and resultant flush) is
 			// called before the checksum is computed.
 			sst := engine.MakeRocksDBSstFileWriter()
-			if err := sst.Open(backupDescs[i].Path); err != nil {
+			if err := sst.Open(localPath); err != nil {
 				return err
 			}
 			defer func() {
@@ -199,12 +218,20 @@ func Backup(
 		}
 
 		crc.Reset()
-		f, err := os.Open(backupDescs[i].Path)
-		if err != nil {
-			return sqlbase.BackupDescriptor{}, err
-		}
-		defer f.Close()
-		if _, err := io.Copy(crc, f); err != nil {
+		if err := func() error {
+			f, err := os.Open(localPath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if _, err := io.Copy(crc, f); err != nil {
+				return err
+			}
+			if err := es.WriteFile(ctx, backupDescs[i].Path, f); err != nil {
+				return err
+			}
+			return os.Remove(localPath)
+		}(); err != nil {
 			return sqlbase.BackupDescriptor{}, err
 		}
 		backupDescs[i].CRC = crc.Sum32()
@@ -221,20 +248,49 @@ func Backup(
 	if err != nil {
 		return sqlbase.BackupDescriptor{}, err
 	}
-	if err = ioutil.WriteFile(filepath.Join(base, backupDescriptorName), descBuf, 0600); err != nil {
+	if err := es.WriteFile(ctx, backupDescriptorName, bytes.NewReader(descBuf)); err != nil {
 		return sqlbase.BackupDescriptor{}, err
 	}
 
 	return desc, nil
 }
 
-// Ingest loads some data in an sstable into an empty range. Only the keys
-// between startKey and endKey are loaded. If newTableID is non-zero, every
-// row's key is rewritten to be for that table.
+// fetchSST copies the named sstable from the external storage into a local
+// file, verifies its checksum and returns the path of the local file. The
+// caller must remove it.
+func fetchSST(
+	ctx context.Context, es extstorage.ExternalStorage, basename string, checksum uint32,
+) (string, error) {
+	r, err := es.ReadFile(ctx, basename)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	f, err := ioutil.TempFile("", "restore")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	if _, err := io.Copy(io.MultiWriter(f, crc), r); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	if c := crc.Sum32(); c != checksum {
+		_ = os.Remove(f.Name())
+		return "", errors.Errorf("%s: checksum mismatch got %d expected %d", basename, c, checksum)
+	}
+	return f.Name(), nil
+}
+
+// Ingest loads some data in an sstable on the external storage into an empty
+// range. Only the keys between startKey and endKey are loaded. If newTableID
+// is non-zero, every row's key is rewritten to be for that table.
 func Ingest(
 	ctx context.Context,
 	txn *client.Txn,
-	path string,
+	es extstorage.ExternalStorage,
+	basename string,
 	checksum uint32,
 	startKey, endKey roachpb.Key,
 	newTableID sqlbase.ID,
@@ -246,25 +302,22 @@ func Ingest(
 	// TODO(dan): Check if the range being ingested into is empty. If newTableID
 	// is non-zero, it'll have to be derived from startKey and endKey.
 
-	f, err := os.Open(path)
+	localPath, err := fetchSST(ctx, es, basename, checksum)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	crc := crc32.New(crc32.MakeTable(crc32.Castagnoli))
-	if _, err := io.Copy(crc, f); err != nil {
-		return nil
-	}
-	if c := crc.Sum32(); c != checksum {
-		return errors.Errorf("%s: checksum mismatch got %d expected %d", path, c, checksum)
-	}
+	defer func() {
+		if err := os.Remove(localPath); err != nil {
+			log.Warningf(ctx, "unable to remove %s: %s", localPath, err)
+		}
+	}()
 
 	sst, err := engine.MakeRocksDBSstFileReader()
 	if err != nil {
 		return err
 	}
 	defer sst.Close()
-	if err := sst.AddFile(path); err != nil {
+	if err := sst.AddFile(localPath); err != nil {
 		return err
 	}
 
@@ -335,6 +388,7 @@ func getDescriptorID(txn *client.Txn, key sqlbase.DescriptorKey) (sqlbase.ID, er
 func restoreTable(
 	ctx context.Context,
 	db client.DB,
+	es extstorage.ExternalStorage,
 	database sqlbase.DatabaseDescriptor,
 	table *sqlbase.TableDescriptor,
 	ranges []sqlbase.BackupRangeDescriptor,
@@ -391,7 +445,7 @@ func restoreTable(
 			wg.Add(1)
 			go func(r sqlbase.BackupRangeDescriptor) {
 				if err := db.Txn(ctx, func(txn *client.Txn) error {
-					return Ingest(ctx, txn, r.Path, r.CRC, intersectBegin, intersectEnd, newTableID)
+					return Ingest(ctx, txn, es, r.Path, r.CRC, intersectBegin, intersectEnd, newTableID)
 				}); err != nil {
 					log.Error(ctx, err)
 					result.Lock()
@@ -513,6 +567,41 @@ func userTablesAndDBsMatchingName(
 	return matches, nil
 }
 
+// readFile returns the contents of the named file on the external storage.
+func readFile(
+	ctx context.Context, es extstorage.ExternalStorage, basename string,
+) ([]byte, error) {
+	r, err := es.ReadFile(ctx, basename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// backupFileBasename returns the basename on the external storage of an
+// sstable referenced by a backup descriptor. Backups written before they were
+// stored on an external storage referenced their sstables by local paths
+// which include the base directory of the backup, while newer backups use
+// paths relative to the base.
+func backupFileBasename(base, p string) (string, error) {
+	dir := base
+	if u, err := url.Parse(base); err == nil && u.Scheme == "file" {
+		dir = u.Path
+	} else if err != nil || u.Scheme != "" {
+		// Only local backups predate the external storage.
+		return p, nil
+	}
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+	if strings.HasPrefix(p, prefix) {
+		return filepath.ToSlash(strings.TrimPrefix(p, prefix)), nil
+	}
+	if filepath.IsAbs(p) {
+		return "", errors.Errorf("backup file %s is not in %s", p, dir)
+	}
+	return p, nil
+}
+
 // Restore imports a SQL table (or tables) from a set of non-overlapping sstable
 // files.
 func Restore(
@@ -521,7 +610,13 @@ func Restore(
 	// TODO(dan): It's currently impossible to restore two interleaved tables
 	// because one of them won't be to an empty range.
 
-	descBytes, err := ioutil.ReadFile(filepath.Join(base, backupDescriptorName))
+	es, err := extstorage.FromURI(base, nil /* metrics */)
+	if err != nil {
+		return nil, err
+	}
+	defer es.Close()
+
+	descBytes, err := readFile(ctx, es, backupDescriptorName)
 	if err != nil {
 		return nil, err
 	}
@@ -529,6 +624,12 @@ func Restore(
 	if err := backupDesc.Unmarshal(descBytes); err != nil {
 		return nil, err
 	}
+	for i := range backupDesc.Ranges {
+		r := &backupDesc.Ranges[i]
+		if r.Path, err = backupFileBasename(base, r.Path); err != nil {
+			return nil, err
+		}
+	}
 
 	matches, err := userTablesAndDBsMatchingName(backupDesc.SQL, table)
 	if err != nil {
@@ -552,7 +653,7 @@ func Restore(
 			if !ok {
 				return nil, errors.Wrapf(err, "no database with ID %d", table.ParentID)
 			}
-			if err := restoreTable(ctx, db, *database, &table, backupDesc.Ranges); err != nil {
+			if err := restoreTable(ctx, db, es, *database, &table, backupDesc.Ranges); err != nil {
 				return nil, err
 			}
 			restored = append(restored, table)
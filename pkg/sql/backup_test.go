@@ -36,6 +36,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql"
 	"github.com/cockroachdb/cockroach/pkg/sql/parser"
+	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/testutils/sqlutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/testcluster"
@@ -266,6 +267,64 @@ func TestBackupRestoreOnce(t *testing.T) {
 	}
 }
 
+// TestRestoreLegacyBackupPaths checks that backups whose descriptor
+// references the sstables by their local paths, as backups did before they
+// were written to an external storage, can still be restored.
+func TestRestoreLegacyBackupPaths(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	// TODO(dan): Actually invalidate the descriptor cache and delete this line.
+	defer sql.TestDisableTableLeases()()
+	const numAccounts = 100
+
+	ctx, dir, tc, kvDB, _, cleanupFn := backupRestoreTestSetup(t, numAccounts)
+	defer cleanupFn()
+
+	if _, err := sql.Backup(ctx, *kvDB, dir, tc.Server(0).Clock().Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewrite the descriptor in the old format.
+	descPath := filepath.Join(dir, "BACKUP")
+	descBytes, err := ioutil.ReadFile(descPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var desc sqlbase.BackupDescriptor
+	if err := desc.Unmarshal(descBytes); err != nil {
+		t.Fatal(err)
+	}
+	for i := range desc.Ranges {
+		if desc.Ranges[i].Path != "" {
+			desc.Ranges[i].Path = filepath.Join(dir, filepath.FromSlash(desc.Ranges[i].Path))
+		}
+	}
+	if descBytes, err = desc.Marshal(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(descPath, descBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tcRestore := testcluster.StartTestCluster(t, backupRestoreClusterSize, base.TestClusterArgs{})
+	defer tcRestore.Stopper().Stop()
+	sqlDBRestore := sqlutils.MakeSQLRunner(t, tcRestore.Conns[0])
+	kvDBRestore := tcRestore.Server(0).KVClient().(*client.DB)
+
+	// Restore assumes the database exists.
+	sqlDBRestore.Exec(bankCreateDatabase)
+
+	table := parser.TableName{DatabaseName: "bench", TableName: "bank"}
+	if _, err := sql.Restore(ctx, *kvDBRestore, dir, table); err != nil {
+		t.Fatal(err)
+	}
+
+	var rowCount int
+	sqlDBRestore.QueryRow(`SELECT COUNT(*) FROM bench.bank`).Scan(&rowCount)
+	if rowCount != numAccounts {
+		t.Fatalf("expected %d rows but found %d", numAccounts, rowCount)
+	}
+}
+
 func startBankTransfers(t testing.TB, stopper *stop.Stopper, sqlDB *gosql.DB, numAccounts int) {
 	const maxTransfer = 999
 	for {
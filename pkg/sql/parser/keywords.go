@@ -240,6 +240,7 @@ var keywords = map[string]int{
 	"UNION":             UNION,
 	"UNIQUE":            UNIQUE,
 	"UNKNOWN":           UNKNOWN,
+	"UNSPLIT":           UNSPLIT,
 	"UPDATE":            UPDATE,
 	"UPSERT":            UPSERT,
 	"USER":              USER,
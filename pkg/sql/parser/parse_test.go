@@ -572,6 +572,10 @@ func TestParse(t *testing.T) {
 		{`ALTER TABLE d.a SPLIT AT ('b', 2)`},
 		{`ALTER INDEX a@i SPLIT AT (1)`},
 		{`ALTER INDEX d.a@i SPLIT AT (2)`},
+		{`ALTER TABLE a UNSPLIT AT (1)`},
+		{`ALTER TABLE d.a UNSPLIT AT ('b', 2)`},
+		{`ALTER INDEX a@i UNSPLIT AT (1)`},
+		{`ALTER INDEX d.a@i UNSPLIT AT (2)`},
 	}
 	for _, d := range testData {
 		stmts, err := parseTraditional(d.sql)
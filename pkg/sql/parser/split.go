@@ -39,3 +39,25 @@ func (node *Split) Format(buf *bytes.Buffer, f FmtFlags) {
 	FormatNode(buf, f, node.Exprs)
 	buf.WriteString(")")
 }
+
+// Unsplit represents an UNSPLIT statement.
+type Unsplit struct {
+	Table NormalizableTableName
+	Index *TableNameWithIndex
+	Exprs Exprs
+}
+
+// Format implements the NodeFormatter interface.
+func (node *Unsplit) Format(buf *bytes.Buffer, f FmtFlags) {
+	buf.WriteString("ALTER ")
+	if node.Index != nil {
+		buf.WriteString("INDEX ")
+		FormatNode(buf, f, node.Index)
+	} else {
+		buf.WriteString("TABLE ")
+		FormatNode(buf, f, node.Table)
+	}
+	buf.WriteString(" UNSPLIT AT (")
+	FormatNode(buf, f, node.Exprs)
+	buf.WriteString(")")
+}
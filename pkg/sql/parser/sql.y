@@ -624,7 +624,7 @@ func (u *sqlSymUnion) window() Window {
 %token <str>   TIME TIMESTAMP TIMESTAMPTZ TO TRAILING TRANSACTION TREAT TRIM TRUE
 %token <str>   TRUNCATE TYPE
 
-%token <str>   UNBOUNDED UNCOMMITTED UNION UNIQUE UNKNOWN
+%token <str>   UNBOUNDED UNCOMMITTED UNION UNIQUE UNKNOWN UNSPLIT
 %token <str>   UPDATE UPSERT USER USING
 
 %token <str>   VALID VALIDATE VALUE VALUES VARCHAR VARIADIC VIEW VARYING
@@ -1544,6 +1544,14 @@ split_stmt:
   {
     $$.val = &Split{Index: $3.tableWithIdx(), Exprs: $7.exprs()}
   }
+| ALTER TABLE qualified_name UNSPLIT AT '(' expr_list ')'
+  {
+    $$.val = &Unsplit{Table: $3.normalizableTableName(), Exprs: $7.exprs()}
+  }
+| ALTER INDEX table_name_with_index UNSPLIT AT '(' expr_list ')'
+  {
+    $$.val = &Unsplit{Index: $3.tableWithIdx(), Exprs: $7.exprs()}
+  }
 
 // CREATE TABLE relname
 create_table_stmt:
@@ -4675,6 +4683,7 @@ unreserved_keyword:
 | UNBOUNDED
 | UNCOMMITTED
 | UNKNOWN
+| UNSPLIT
 | UPDATE
 | UPSERT
 | VALID
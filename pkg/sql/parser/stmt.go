@@ -361,6 +361,12 @@ func (*Split) StatementType() StatementType { return Rows }
 // StatementTag returns a short string identifying the type of statement.
 func (*Split) StatementTag() string { return "SPLIT" }
 
+// StatementType implements the Statement interface.
+func (*Unsplit) StatementType() StatementType { return Rows }
+
+// StatementTag returns a short string identifying the type of statement.
+func (*Unsplit) StatementTag() string { return "UNSPLIT" }
+
 // StatementType implements the Statement interface.
 func (*Truncate) StatementType() StatementType { return Ack }
 
@@ -441,5 +447,6 @@ func (n *Split) String() string                    { return AsString(n) }
 func (l StatementList) String() string             { return AsString(l) }
 func (n *Truncate) String() string                 { return AsString(n) }
 func (n *UnionClause) String() string              { return AsString(n) }
+func (n *Unsplit) String() string                  { return AsString(n) }
 func (n *Update) String() string                   { return AsString(n) }
 func (n *ValuesClause) String() string             { return AsString(n) }
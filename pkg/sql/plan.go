@@ -321,6 +321,8 @@ func (p *planner) newPlan(
 		return p.ShowTables(n)
 	case *parser.Split:
 		return p.Split(n)
+	case *parser.Unsplit:
+		return p.Unsplit(n)
 	case *parser.Truncate:
 		return p.Truncate(n)
 	case *parser.UnionClause:
@@ -366,6 +368,8 @@ func (p *planner) prepare(stmt parser.Statement) (planNode, error) {
 		return p.ShowTables(n)
 	case *parser.Split:
 		return p.Split(n)
+	case *parser.Unsplit:
+		return p.Unsplit(n)
 	case *parser.Update:
 		return p.Update(n, nil, false)
 	default:
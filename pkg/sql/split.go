@@ -28,6 +28,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/privilege"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/retry"
 	"github.com/pkg/errors"
 )
@@ -37,11 +38,34 @@ const maxSplitRetries = 4
 // Split executes a KV split.
 // Privileges: INSERT on table.
 func (p *planner) Split(n *parser.Split) (planNode, error) {
+	return p.newSplitNode(n.Table, n.Index, n.Exprs, false /* unsplit */)
+}
+
+// Unsplit removes the sticky bit of a KV split point, which allows the split
+// to be removed by a merge again.
+// Privileges: INSERT on table.
+func (p *planner) Unsplit(n *parser.Unsplit) (planNode, error) {
+	return p.newSplitNode(n.Table, n.Index, n.Exprs, true /* unsplit */)
+}
+
+// newSplitNode resolves the index and split key expressions of a SPLIT AT or
+// UNSPLIT AT statement.
+func (p *planner) newSplitNode(
+	table parser.NormalizableTableName,
+	tableWithIndex *parser.TableNameWithIndex,
+	exprs parser.Exprs,
+	unsplit bool,
+) (planNode, error) {
+	op := "SPLIT AT"
+	if unsplit {
+		op = "UNSPLIT AT"
+	}
+
 	var tableName parser.NormalizableTableName
-	if n.Index == nil {
-		tableName = n.Table
+	if tableWithIndex == nil {
+		tableName = table
 	} else {
-		tableName = n.Index.Table
+		tableName = tableWithIndex.Table
 	}
 
 	// Check that the table exists and that the user has permission.
@@ -62,10 +86,10 @@ func (p *planner) Split(n *parser.Split) (planNode, error) {
 
 	// Determine which index to use.
 	var index sqlbase.IndexDescriptor
-	if n.Index == nil {
+	if tableWithIndex == nil {
 		index = tableDesc.PrimaryIndex
 	} else {
-		normIdxName := sqlbase.NormalizeName(n.Index.Index)
+		normIdxName := sqlbase.NormalizeName(tableWithIndex.Index)
 		status, i, err := tableDesc.FindIndexByNormalizedName(normIdxName)
 		if err != nil {
 			return nil, err
@@ -77,17 +101,17 @@ func (p *planner) Split(n *parser.Split) (planNode, error) {
 	}
 
 	// Determine how to use the remaining argument expressions.
-	if len(index.ColumnIDs) != len(n.Exprs) {
-		return nil, errors.Errorf("expected %d expressions, got %d", len(index.ColumnIDs), len(n.Exprs))
+	if len(index.ColumnIDs) != len(exprs) {
+		return nil, errors.Errorf("expected %d expressions, got %d", len(index.ColumnIDs), len(exprs))
 	}
-	typedExprs := make([]parser.TypedExpr, len(n.Exprs))
-	for i, expr := range n.Exprs {
+	typedExprs := make([]parser.TypedExpr, len(exprs))
+	for i, expr := range exprs {
 		c, err := tableDesc.FindColumnByID(index.ColumnIDs[i])
 		if err != nil {
 			return nil, err
 		}
 		desired := c.Type.ToDatumType()
-		typedExpr, err := p.analyzeExpr(expr, nil, parser.IndexedVarHelper{}, desired, true, "SPLIT AT")
+		typedExpr, err := p.analyzeExpr(expr, nil, parser.IndexedVarHelper{}, desired, true, op)
 		if err != nil {
 			return nil, err
 		}
@@ -99,6 +123,7 @@ func (p *planner) Split(n *parser.Split) (planNode, error) {
 		tableDesc: tableDesc,
 		index:     index,
 		exprs:     typedExprs,
+		unsplit:   unsplit,
 	}, nil
 }
 
@@ -107,7 +132,10 @@ type splitNode struct {
 	tableDesc *sqlbase.TableDescriptor
 	index     sqlbase.IndexDescriptor
 	exprs     []parser.TypedExpr
-	key       []byte
+	// unsplit is set if the node removes the sticky bit of the split point
+	// instead of splitting.
+	unsplit bool
+	key     []byte
 }
 
 func (n *splitNode) Start() error {
@@ -140,7 +168,14 @@ func (n *splitNode) Start() error {
 	// TODO(radu): we should find a way to prevent this error, like waiting for
 	// whatever condition we need to wait.
 	for r := retry.Start(retry.Options{MaxRetries: maxSplitRetries}); ; {
-		err := n.p.execCfg.DB.AdminSplit(context.TODO(), n.key)
+		var err error
+		if n.unsplit {
+			err = n.p.execCfg.DB.AdminUnsplit(context.TODO(), n.key)
+		} else {
+			// Splits requested through SQL are intended by the operator, so
+			// they are sticky.
+			err = n.p.execCfg.DB.AdminStickySplit(context.TODO(), n.key, hlc.ZeroTimestamp)
+		}
 		if err != nil &&
 			strings.Contains(err.Error(), storage.ErrMsgConflictUpdatingRangeDesc) &&
 			r.Next() {
@@ -199,6 +234,9 @@ func (n *splitNode) ExplainPlan(_ bool) (name, description string, children []pl
 		e.Format(&buf, parser.FmtSimple)
 		children = n.p.collectSubqueryPlans(e, children)
 	}
+	if n.unsplit {
+		return "unsplit", buf.String(), children
+	}
 	return "split", buf.String(), children
 }
 
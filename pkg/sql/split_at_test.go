@@ -139,3 +139,74 @@ func TestSplitAt(t *testing.T) {
 		}
 	}
 }
+
+func TestUnsplitAt(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	params, _ := createTestServerParams()
+	s, db, _ := serverutils.StartServer(t, params)
+	defer s.Stopper().Stop()
+
+	r := sqlutils.MakeSQLRunner(t, db)
+
+	r.Exec("CREATE DATABASE d")
+	r.Exec(`CREATE TABLE d.t (k INT PRIMARY KEY)`)
+
+	var key roachpb.Key
+	var pretty string
+	if err := db.QueryRow("ALTER TABLE d.t SPLIT AT (5)").Scan(&key, &pretty); err != nil {
+		t.Fatal(err)
+	}
+	rng, err := serverutils.LookupRange(s.DistSender(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rng.StickyBit == nil {
+		t.Fatalf("expected split at %s to be sticky", pretty)
+	}
+
+	tests := []struct {
+		in    string
+		error string
+	}{
+		{
+			in:    "ALTER TABLE d.t UNSPLIT AT (6)",
+			error: "is not the start of a range",
+		},
+		{
+			in:    "ALTER TABLE d.t UNSPLIT AT ('a')",
+			error: "argument of UNSPLIT AT must be type int, not type string",
+		},
+		{
+			in: "ALTER TABLE d.t UNSPLIT AT (5)",
+		},
+		{
+			// Unsplitting a split point which isn't sticky is a no-op.
+			in: "ALTER TABLE d.t UNSPLIT AT (5)",
+		},
+	}
+
+	for _, tt := range tests {
+		var unsplitKey roachpb.Key
+		err := db.QueryRow(tt.in).Scan(&unsplitKey, &pretty)
+		if err != nil && tt.error == "" {
+			t.Fatalf("%s: unexpected error: %s", tt.in, err)
+		} else if tt.error != "" && err == nil {
+			t.Fatalf("%s: expected error: %s", tt.in, tt.error)
+		} else if err != nil && tt.error != "" {
+			if !strings.Contains(err.Error(), tt.error) {
+				t.Fatalf("%s: unexpected error: %s", tt.in, err)
+			}
+		} else if !unsplitKey.Equal(key) {
+			t.Fatalf("%s: expected key %s, got %s", tt.in, key, unsplitKey)
+		}
+	}
+
+	rng, err = serverutils.LookupRange(s.DistSender(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rng.StickyBit != nil {
+		t.Fatalf("expected the sticky bit of the split at %s to be removed", pretty)
+	}
+}
@@ -124,8 +124,5 @@ func MakeDescMetadataKey(descID ID) roachpb.Key {
 
 // MakeZoneKey returns the key for 'id's entry in the system.zones table.
 func MakeZoneKey(id ID) roachpb.Key {
-	k := keys.MakeTablePrefix(uint32(ZonesTable.ID))
-	k = encoding.EncodeUvarintAscending(k, uint64(ZonesTable.PrimaryIndex.ID))
-	k = encoding.EncodeUvarintAscending(k, uint64(id))
-	return keys.MakeFamilyKey(k, uint32(ZonesTable.Columns[1].ID))
+	return keys.MakeZoneKey(uint32(id))
 }
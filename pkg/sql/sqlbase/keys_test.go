@@ -66,3 +66,13 @@ func TestKeyAddress(t *testing.T) {
 		lastKey = result
 	}
 }
+
+func TestZonesTableKeyConstants(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	if id := ZonesTable.PrimaryIndex.ID; id != keys.ZonesTablePrimaryIndexID {
+		t.Errorf("expected keys.ZonesTablePrimaryIndexID to be %d, got %d", id, keys.ZonesTablePrimaryIndexID)
+	}
+	if id := ZonesTable.Columns[1].ID; id != keys.ZonesTableConfigColumnID {
+		t.Errorf("expected keys.ZonesTableConfigColumnID to be %d, got %d", id, keys.ZonesTableConfigColumnID)
+	}
+}
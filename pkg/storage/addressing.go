@@ -19,10 +19,12 @@ package storage
 import (
 	"bytes"
 
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
-	"github.com/pkg/errors"
 )
 
 type metaAction func(*client.Batch, roachpb.Key, *roachpb.RangeDescriptor)
@@ -103,3 +105,58 @@ func rangeAddressing(b *client.Batch, desc *roachpb.RangeDescriptor, action meta
 	}
 	return nil
 }
+
+// updateLeaseHolderHint sets the lease holder hint of the meta addressing
+// records for the range specified by desc. Records which no longer match
+// desc, because the range has since been split, merged or had its replicas
+// changed, and records which already carry the hint are left alone. The
+// records are updated with conditional puts, so that a concurrent update of
+// the addressing records is never overwritten.
+func updateLeaseHolderHint(
+	ctx context.Context,
+	db *client.DB,
+	desc *roachpb.RangeDescriptor,
+	leaseHolder roachpb.ReplicaDescriptor,
+) error {
+	var metaKeys []roachpb.Key
+	if err := rangeAddressing(nil, desc,
+		func(_ *client.Batch, key roachpb.Key, _ *roachpb.RangeDescriptor) {
+			metaKeys = append(metaKeys, key)
+		}); err != nil {
+		return err
+	}
+	return db.Txn(ctx, func(txn *client.Txn) error {
+		b := txn.NewBatch()
+		var updates int
+		for _, key := range metaKeys {
+			kv, err := txn.Get(key)
+			if err != nil {
+				return err
+			}
+			if kv.Value == nil {
+				continue
+			}
+			var metaDesc roachpb.RangeDescriptor
+			if err := kv.ValueProto(&metaDesc); err != nil {
+				return err
+			}
+			if metaDesc.RangeID != desc.RangeID ||
+				!metaDesc.StartKey.Equal(desc.StartKey) ||
+				!metaDesc.EndKey.Equal(desc.EndKey) ||
+				!replicaSetsEqual(metaDesc.Replicas, desc.Replicas) {
+				continue
+			}
+			if hint := metaDesc.LeaseHolderHint; hint != nil && *hint == leaseHolder {
+				continue
+			}
+			hint := leaseHolder
+			metaDesc.LeaseHolderHint = &hint
+			b.CPut(key, &metaDesc, kv.Value)
+			updates++
+		}
+		if updates == 0 {
+			return nil
+		}
+		return txn.Run(b)
+	})
+}
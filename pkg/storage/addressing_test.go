@@ -221,3 +221,44 @@ func TestUpdateRangeAddressingSplitMeta1(t *testing.T) {
 		t.Error("expected failure trying to update addressing records for meta1 split")
 	}
 }
+
+// TestUpdateLeaseHolderHint verifies that the lease holder hint is recorded
+// in the meta addressing records of a range, and that records which don't
+// match the descriptor are left alone.
+func TestUpdateLeaseHolderHint(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	ctx := context.Background()
+
+	desc := store.LookupReplica(roachpb.RKeyMin, nil).Desc()
+	verifyHint := func(exp roachpb.ReplicaDescriptor) {
+		for _, key := range []roachpb.Key{keys.Meta1KeyMax, keys.RangeMetaKey(roachpb.RKeyMax)} {
+			var metaDesc roachpb.RangeDescriptor
+			if err := store.DB().GetProto(ctx, key, &metaDesc); err != nil {
+				t.Fatal(err)
+			}
+			if metaDesc.LeaseHolderHint == nil || *metaDesc.LeaseHolderHint != exp {
+				t.Errorf("%s: expected lease holder hint %+v, got %+v", key, exp, metaDesc.LeaseHolderHint)
+			}
+			if metaDesc.RangeID != desc.RangeID || !replicaSetsEqual(metaDesc.Replicas, desc.Replicas) {
+				t.Errorf("%s: expected descriptor %+v, got %+v", key, desc, metaDesc)
+			}
+		}
+	}
+
+	hint := desc.Replicas[0]
+	if err := updateLeaseHolderHint(ctx, store.DB(), desc, hint); err != nil {
+		t.Fatal(err)
+	}
+	verifyHint(hint)
+
+	// A descriptor whose replicas don't match the records doesn't update them.
+	stale := *desc
+	stale.Replicas = append([]roachpb.ReplicaDescriptor{{NodeID: 2, StoreID: 2, ReplicaID: 2}},
+		desc.Replicas...)
+	if err := updateLeaseHolderHint(ctx, store.DB(), &stale, stale.Replicas[0]); err != nil {
+		t.Fatal(err)
+	}
+	verifyHint(hint)
+}
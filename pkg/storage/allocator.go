@@ -20,29 +20,50 @@ package storage
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 
 	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/pkg/config"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/pkg/errors"
 )
 
-const (
-	// maxFractionUsedThreshold: if the fraction used of a store descriptor
-	// capacity is greater than this value, it will never be used as a rebalance
-	// target and it will always be eligible to rebalance replicas to other
-	// stores.
-	maxFractionUsedThreshold = 0.95
+// maxFractionUsedThreshold: if the fraction used of a store descriptor
+// capacity is greater than this value, it will never be used as a target for
+// new replicas and it will always be eligible to rebalance replicas to other
+// stores.
+var maxFractionUsedThreshold = settings.RegisterFloatSetting(
+	"kv.allocator.max_fraction_used",
+	"fraction of a store's capacity above which it no longer receives new replicas",
+	0.95,
+)
 
+// leaseSheddingEnabled controls whether an overloaded store sheds its leases
+// to other replicas, to limit the impact of degraded hardware.
+var leaseSheddingEnabled = settings.RegisterBoolSetting(
+	"kv.allocator.lease_shedding.enabled",
+	"if set, an overloaded store sheds its leases to replicas on stores which aren't overloaded",
+	true,
+)
+
+const (
 	// priorities for various repair operations.
 	removeDeadReplicaPriority  float64 = 10000
 	addMissingReplicaPriority  float64 = 1000
 	removeExtraReplicaPriority float64 = 100
+
+	// quorumAtRiskPriority is added to the priority of the repair of a range
+	// which would lose its quorum to one more failure, so that it is repaired
+	// before ranges which are further below their replication factor but can
+	// still tolerate a failure.
+	quorumAtRiskPriority float64 = 50
 )
 
 // AllocatorAction enumerates the various replication adjustments that may be
@@ -95,10 +116,29 @@ func (ae *allocatorError) Error() string {
 		anyAll, ae.required, auxInfo)
 }
 
-func (*allocatorError) purgatoryErrorMarker() {}
+func (*allocatorError) purgatoryClass() purgatoryClass {
+	return purgatoryNoTarget
+}
 
 var _ purgatoryError = &allocatorError{}
 
+// throttledStoresError indicates that the only stores which could receive a
+// replica are throttled. It sends replicas into purgatory so that they are
+// retried once the stores are likely to be available again.
+type throttledStoresError struct {
+	throttledStoreCount int
+}
+
+func (e *throttledStoresError) Error() string {
+	return fmt.Sprintf("%d matching stores are currently throttled", e.throttledStoreCount)
+}
+
+func (*throttledStoresError) purgatoryClass() purgatoryClass {
+	return purgatoryStoreThrottled
+}
+
+var _ purgatoryError = &throttledStoresError{}
+
 // allocatorRand pairs a rand.Rand with a mutex.
 // TODO: Allocator is typically only accessed from a single thread (the
 // replication queue), but this assumption is broken in tests which force
@@ -129,31 +169,101 @@ type AllocatorOptions struct {
 	// will have random behavior. This flag is intended to be set for testing
 	// purposes only.
 	Deterministic bool
+
+	// RandSeed, if non-zero, seeds the allocator's random number generator,
+	// so that its placement decisions can be replayed given the same cluster
+	// statistics. Otherwise, the seed is fixed if Deterministic is set and
+	// picked at random if it isn't.
+	RandSeed int64
 }
 
+// storeView is the view of the stores in the cluster against which the
+// allocator makes its decisions. It is implemented by StorePool, which is
+// kept up to date by gossip, and by storePoolSnapshot, which isn't.
+type storeView interface {
+	getStoreList(
+		constraints config.Constraints,
+		existing []roachpb.ReplicaDescriptor,
+		filter storeFilter,
+		deterministic bool,
+	) (StoreList, int, int)
+	getStoreDescriptor(storeID roachpb.StoreID) (roachpb.StoreDescriptor, bool)
+	diversityScore(store roachpb.StoreDescriptor, existing []roachpb.ReplicaDescriptor) float64
+	deadReplicas(rangeID roachpb.RangeID, repls []roachpb.ReplicaDescriptor) []roachpb.ReplicaDescriptor
+	replicaStatuses(repls []roachpb.ReplicaDescriptor) []storeStatus
+	storeMatches(storeID roachpb.StoreID, constraints config.Constraints) bool
+}
+
+var _ storeView = &StorePool{}
+var _ storeView = &storePoolSnapshot{}
+
 // Allocator tries to spread replicas as evenly as possible across the stores
 // in the cluster.
 type Allocator struct {
 	storePool *StorePool
-	randGen   allocatorRand
-	options   AllocatorOptions
+	// snapshot, if set, is used for all decisions instead of storePool; see
+	// withSnapshot.
+	snapshot *storePoolSnapshot
+	randGen  allocatorRand
+	// randSeed is the seed of randGen.
+	randSeed int64
+	options  AllocatorOptions
+	// rangeID, if set, is the range the allocator's decisions are made for;
+	// see forRange.
+	rangeID roachpb.RangeID
 }
 
 // MakeAllocator creates a new allocator using the specified StorePool.
 func MakeAllocator(storePool *StorePool, options AllocatorOptions) Allocator {
-	var randSource rand.Source
-	if options.Deterministic {
-		randSource = rand.NewSource(777)
-	} else {
-		randSource = rand.NewSource(rand.Int63())
+	seed := options.RandSeed
+	if seed == 0 {
+		if options.Deterministic {
+			seed = 777
+		} else {
+			seed = rand.Int63()
+		}
 	}
 	return Allocator{
 		storePool: storePool,
 		options:   options,
-		randGen:   makeAllocatorRand(randSource),
+		randGen:   makeAllocatorRand(rand.NewSource(seed)),
+		randSeed:  seed,
 	}
 }
 
+// withSnapshot returns a copy of the allocator which makes all its decisions
+// against the given snapshot of its StorePool.
+func (a Allocator) withSnapshot(snap *storePoolSnapshot) Allocator {
+	a.snapshot = snap
+	return a
+}
+
+// forRange returns a copy of the allocator which makes its decisions for the
+// given range, refusing to reverse the range's recent rebalancing moves.
+func (a Allocator) forRange(rangeID roachpb.RangeID) Allocator {
+	a.rangeID = rangeID
+	return a
+}
+
+// recentMove returns the rebalancing move of the allocator's range made
+// within the last rebalanceReversalWindow, if any.
+func (a Allocator) recentMove() (rebalanceMove, bool) {
+	if a.rangeID == 0 || a.storePool == nil {
+		return rebalanceMove{}, false
+	}
+	return a.storePool.rebalanceHistory.recent(
+		a.rangeID, a.storePool.clock.Now().GoTime(), rebalanceReversalWindow.Get())
+}
+
+// stores returns the view of the stores the allocator's decisions are made
+// against.
+func (a *Allocator) stores() storeView {
+	if a.snapshot != nil {
+		return a.snapshot
+	}
+	return a.storePool
+}
+
 // ComputeAction determines the exact operation needed to repair the supplied
 // range, as governed by the supplied zone configuration. It returns the
 // required action that should be taken and a replica on which the action should
@@ -161,29 +271,44 @@ func MakeAllocator(storePool *StorePool, options AllocatorOptions) Allocator {
 func (a *Allocator) ComputeAction(
 	zone config.ZoneConfig, desc *roachpb.RangeDescriptor,
 ) (AllocatorAction, float64) {
-	if a.storePool == nil {
+	if a.storePool == nil && a.snapshot == nil {
 		// Do nothing if storePool is nil for some unittests.
 		return AllocatorNoop, 0
 	}
 
-	deadReplicas := a.storePool.deadReplicas(desc.RangeID, desc.Replicas)
+	// TODO(mrtracy): Handle non-homogeneous and mismatched attribute sets.
+	need := int(zone.NumReplicas)
+	deadReplicas := a.stores().deadReplicas(desc.RangeID, desc.Replicas)
 	if len(deadReplicas) > 0 {
 		// The range has dead replicas, which should be removed immediately.
-		// Adjust the priority by the number of dead replicas the range has.
+		// Adjust the priority by the number of dead replicas the range has,
+		// further by those lost together to the failure of a node with
+		// several stores, and by how far below the zone's replication factor
+		// the live replicas are.
 		quorum := computeQuorum(len(desc.Replicas))
 		liveReplicas := len(desc.Replicas) - len(deadReplicas)
-		return AllocatorRemoveDead, removeDeadReplicaPriority + float64(quorum-liveReplicas)
+		priority := removeDeadReplicaPriority + float64(quorum-liveReplicas) +
+			float64(correlatedDeadReplicas(deadReplicas))
+		if liveReplicas < need {
+			priority += float64(need - liveReplicas)
+		}
+		if liveReplicas <= quorum {
+			priority += quorumAtRiskPriority
+		}
+		return AllocatorRemoveDead, priority
 	}
 
-	// TODO(mrtracy): Handle non-homogeneous and mismatched attribute sets.
-	need := int(zone.NumReplicas)
 	have := len(desc.Replicas)
 	if have < need {
 		// Range is under-replicated, and should add an additional replica.
 		// Priority is adjusted by the difference between the current replica
 		// count and the quorum of the desired replica count.
 		neededQuorum := computeQuorum(need)
-		return AllocatorAdd, addMissingReplicaPriority + float64(neededQuorum-have)
+		priority := addMissingReplicaPriority + float64(neededQuorum-have)
+		if have <= computeQuorum(have) {
+			priority += quorumAtRiskPriority
+		}
+		return AllocatorAdd, priority
 	}
 	if have > need {
 		// Range is over-replicated, and should remove a replica.
@@ -196,6 +321,50 @@ func (a *Allocator) ComputeAction(
 	return AllocatorNoop, 0
 }
 
+// correlatedDeadReplicas returns the number of the given dead replicas which
+// are on the same node as another one of them. A node with several stores
+// fails as a whole, so such replicas were lost together, and the range is
+// more at risk than its number of dead replicas alone suggests until they
+// are replaced.
+func correlatedDeadReplicas(deadReplicas []roachpb.ReplicaDescriptor) int {
+	perNode := make(map[roachpb.NodeID]int, len(deadReplicas))
+	for _, repl := range deadReplicas {
+		perNode[repl.NodeID]++
+	}
+	var correlated int
+	for _, n := range perNode {
+		if n > 1 {
+			correlated += n
+		}
+	}
+	return correlated
+}
+
+// ReplaceDeadTarget returns a store on which a replacement for one of the
+// range's dead replicas should be added before the dead replica is removed,
+// or nil if the dead replica should simply be removed. Adding first means
+// the range goes up to N+1 replicas rather than down to N-1, so it doesn't
+// sit closer to losing its quorum while the replacement catches up. This is
+// only done if the range would otherwise be left below its replication
+// factor, if the larger group still has a quorum of live replicas, and if a
+// live store is available to hold the replacement.
+func (a *Allocator) ReplaceDeadTarget(
+	zone config.ZoneConfig, existing, deadReplicas []roachpb.ReplicaDescriptor,
+) *roachpb.StoreDescriptor {
+	liveReplicas := len(existing) - len(deadReplicas)
+	if len(deadReplicas) == 0 || liveReplicas >= int(zone.NumReplicas) {
+		return nil
+	}
+	if liveReplicas+1 < computeQuorum(len(existing)+1) {
+		return nil
+	}
+	target, err := a.AllocateTarget(zone.Constraints, existing, true)
+	if err != nil {
+		return nil
+	}
+	return target
+}
+
 // AllocateTarget returns a suitable store for a new allocation with the
 // required attributes. Nodes already accommodating existing replicas are ruled
 // out as targets. If relaxConstraints is true, then the required attributes
@@ -213,18 +382,21 @@ func (a *Allocator) AllocateTarget(
 	// matching here is lenient, and tries to find a target by relaxing an
 	// attribute constraint, from last attribute to first.
 	for attrs := append([]config.Constraint(nil), constraints.Constraints...); ; attrs = attrs[:len(attrs)-1] {
-		sl, aliveStoreCount, throttledStoreCount := a.storePool.getStoreList(
+		sl, aliveStoreCount, throttledStoreCount := a.stores().getStoreList(
 			config.Constraints{Constraints: attrs},
+			existing,
+			storeFilterThrottled,
 			a.options.Deterministic,
 		)
-		if target := a.selectGood(sl, existingNodes); target != nil {
+		if target := a.selectGood(a.mostDiverse(sl, existingNodes), existingNodes); target != nil {
 			return target, nil
 		}
 
-		// When there are throttled stores that do match, we shouldn't send
-		// the replica to purgatory or even consider relaxing the constraints.
+		// When there are throttled stores that do match, we shouldn't consider
+		// relaxing the constraints; the replica waits in purgatory for the
+		// stores to become available again.
 		if throttledStoreCount > 0 {
-			return nil, errors.Errorf("%d matching stores are currently throttled", throttledStoreCount)
+			return nil, &throttledStoresError{throttledStoreCount: throttledStoreCount}
 		}
 		if len(attrs) == 0 || !relaxConstraints {
 			return nil, &allocatorError{
@@ -241,6 +413,13 @@ func (a *Allocator) AllocateTarget(
 // candidate for removal. It also will exclude any replica that belongs to the
 // range lease holder's store ID.
 //
+// Replicas on dead stores are removed first, followed by those on suspect
+// and then throttled stores (see storeStatus). Only among the replicas on
+// the least desirable kind of store present does the choice come down to
+// diversity and load. If the allocator was made for a range (see forRange),
+// the replica the range was recently rebalanced to is only removed if it is
+// the sole candidate.
+//
 // TODO(mrtracy): removeTarget eventually needs to accept the attributes from
 // the zone config associated with the provided replicas. This will allow it to
 // make correct decisions in the case of ranges with heterogeneous replica
@@ -252,20 +431,49 @@ func (a Allocator) RemoveTarget(
 		return roachpb.ReplicaDescriptor{}, errors.Errorf("must supply at least one replica to allocator.RemoveTarget()")
 	}
 
-	// Retrieve store descriptors for the provided replicas from the StorePool.
-	sl := StoreList{}
-	for _, exist := range existing {
-		if exist.StoreID == leaseStoreID {
-			continue
+	statuses := a.stores().replicaStatuses(existing)
+	worst := storeStatusLive
+	for i, exist := range existing {
+		if exist.StoreID != leaseStoreID && statuses[i] < worst {
+			worst = statuses[i]
+		}
+	}
+	var candidates []roachpb.ReplicaDescriptor
+	for i, exist := range existing {
+		if exist.StoreID != leaseStoreID && statuses[i] == worst {
+			candidates = append(candidates, exist)
+		}
+	}
+	if move, ok := a.recentMove(); ok && len(candidates) > 1 {
+		// Removing the replica the range was recently moved to would undo
+		// the move.
+		for i, exist := range candidates {
+			if exist.StoreID == move.to {
+				candidates = append(candidates[:i], candidates[i+1:]...)
+				break
+			}
 		}
-		desc, ok := a.storePool.getStoreDescriptor(exist.StoreID)
+	}
+	if len(candidates) > 0 && (worst == storeStatusDead || worst == storeStatusSuspect) {
+		// There's nothing to gain from weighing the stores against each
+		// other: their replicas are the ones not serving the range.
+		if log.V(2) {
+			log.Infof(context.TODO(), "removing replica %+v on %s store", candidates[0], worst)
+		}
+		return candidates[0], nil
+	}
+
+	// Retrieve store descriptors for the candidates from the StorePool.
+	sl := StoreList{}
+	for _, exist := range candidates {
+		desc, ok := a.stores().getStoreDescriptor(exist.StoreID)
 		if !ok {
 			continue
 		}
 		sl.add(desc)
 	}
 
-	if bad := a.selectBad(sl); bad != nil {
+	if bad := a.selectBad(a.leastDiverse(sl, existing)); bad != nil {
 		for _, exist := range existing {
 			if exist.StoreID == bad.StoreID {
 				return exist, nil
@@ -293,6 +501,9 @@ func (a Allocator) RemoveTarget(
 // other stores in the cluster will also be doing their probabilistic best to
 // rebalance. This helps prevent a stampeding herd targeting an abnormally
 // under-utilized store.
+//
+// If the allocator was made for a range (see forRange), the store the range
+// was recently rebalanced away from is not a candidate.
 func (a Allocator) RebalanceTarget(
 	constraints config.Constraints,
 	existing []roachpb.ReplicaDescriptor,
@@ -302,7 +513,8 @@ func (a Allocator) RebalanceTarget(
 		return nil
 	}
 
-	sl, _, _ := a.storePool.getStoreList(constraints, a.options.Deterministic)
+	sl, _, _ := a.stores().getStoreList(
+		constraints, existing, storeFilterThrottled, a.options.Deterministic)
 	if log.V(3) {
 		log.Infof(context.TODO(), "rebalance-target (lease-holder=%d):\n%s", leaseStoreID, sl)
 	}
@@ -312,7 +524,7 @@ func (a Allocator) RebalanceTarget(
 		if leaseStoreID == repl.StoreID {
 			continue
 		}
-		storeDesc, ok := a.storePool.getStoreDescriptor(repl.StoreID)
+		storeDesc, ok := a.stores().getStoreDescriptor(repl.StoreID)
 		if ok && a.shouldRebalance(storeDesc, sl) {
 			shouldRebalance = true
 			break
@@ -322,11 +534,292 @@ func (a Allocator) RebalanceTarget(
 		return nil
 	}
 
+	if move, ok := a.recentMove(); ok && move.from != 0 {
+		// Moving a replica back to the store the range was recently moved
+		// away from would undo the move.
+		var stores []roachpb.StoreDescriptor
+		for _, desc := range sl.stores {
+			if desc.StoreID != move.from {
+				stores = append(stores, desc)
+			}
+		}
+		sl.stores = stores
+	}
+
 	existingNodes := make(nodeIDSet, len(existing))
 	for _, repl := range existing {
 		existingNodes[repl.NodeID] = struct{}{}
 	}
-	return a.improve(sl, existingNodes)
+	return a.improve(a.mostDiverse(sl, existingNodes), existingNodes)
+}
+
+// mostDiverse narrows the stores in sl down to those, on nodes other than the
+// excluded ones, with enough free space and not overloaded, whose locality
+// is the most diverse relative to the existing replicas the list was made
+// for. Locality
+// diversity is the primary criterion when choosing among candidate stores;
+// the balancer only chooses among the stores returned here. The aggregate
+// statistics of sl are left untouched so that balancing decisions remain
+// relative to all candidate stores.
+func (a Allocator) mostDiverse(sl StoreList, excluded nodeIDSet) StoreList {
+	best := -1.0
+	var stores []roachpb.StoreDescriptor
+	for _, desc := range sl.stores {
+		if _, ok := excluded[desc.Node.NodeID]; ok {
+			continue
+		}
+		if desc.Capacity.FractionUsed() > maxFractionUsedThreshold.Get() {
+			continue
+		}
+		// Overloaded stores can't take on the work of another replica.
+		if desc.Capacity.Overloaded() {
+			continue
+		}
+		score := sl.diversityScore(desc)
+		if score > best {
+			best = score
+			stores = stores[:0]
+		}
+		if score == best {
+			stores = append(stores, desc)
+		}
+	}
+	if log.V(3) {
+		log.Infof(context.TODO(), "most diverse stores (score=%.2f): %s",
+			best, formatCandidates(nil, stores))
+	}
+	sl.stores = stores
+	return sl
+}
+
+// leastDiverse narrows the stores in sl down to those whose locality is the
+// least diverse relative to the other existing replicas. These are the
+// replicas whose removal costs the range the least locality diversity. As
+// with mostDiverse, the aggregate statistics of sl are left untouched.
+func (a Allocator) leastDiverse(sl StoreList, existing []roachpb.ReplicaDescriptor) StoreList {
+	worst := math.MaxFloat64
+	var stores []roachpb.StoreDescriptor
+	for _, desc := range sl.stores {
+		score := a.stores().diversityScore(desc, existing)
+		if score < worst {
+			worst = score
+			stores = stores[:0]
+		}
+		if score == worst {
+			stores = append(stores, desc)
+		}
+	}
+	sl.stores = stores
+	return sl
+}
+
+// EnableLeaseRebalancing controls whether the replicate queue transfers range
+// leases away from stores holding considerably more leases than the mean.
+// Zone lease preferences are honored regardless.
+var EnableLeaseRebalancing = envutil.EnvOrDefaultBool("COCKROACH_ENABLE_LEASE_REBALANCING", true)
+
+// TransferLeaseTarget returns a suitable replica to transfer the range lease
+// to from the provided list of existing replicas, or nil if the lease should
+// stay where it is.
+//
+// If the zone specifies lease preferences and the lease-holder's store
+// doesn't satisfy the most preferred set of constraints that any live replica
+// satisfies, the lease is moved to the preferred replica whose store holds
+// the fewest leases. Otherwise, a transfer is only suggested when the
+// lease-holder's store holds more than mean*(1+RebalanceThreshold) leases; the
+// target is then the (preferred) replica whose store holds the fewest leases,
+// provided that store is below the mean.
+func (a Allocator) TransferLeaseTarget(
+	zone config.ZoneConfig, existing []roachpb.ReplicaDescriptor, leaseStoreID roachpb.StoreID,
+) *roachpb.ReplicaDescriptor {
+	if !a.options.AllowRebalance {
+		return nil
+	}
+
+	sl, _, _ := a.stores().getStoreList(zone.Constraints, nil, storeFilterSuspect, a.options.Deterministic)
+	candidates := make(map[roachpb.StoreID]*roachpb.StoreDescriptor, len(sl.stores))
+	for i := range sl.stores {
+		candidates[sl.stores[i].StoreID] = &sl.stores[i]
+	}
+
+	// leastLoaded returns the replica among repls (other than the
+	// lease-holder) whose store holds the fewest leases. Replicas on
+	// overloaded stores aren't considered.
+	leastLoaded := func(repls []roachpb.ReplicaDescriptor) (*roachpb.ReplicaDescriptor, int32) {
+		var target *roachpb.ReplicaDescriptor
+		var targetLeases int32
+		for i := range repls {
+			repl := &repls[i]
+			if repl.StoreID == leaseStoreID {
+				continue
+			}
+			desc, ok := candidates[repl.StoreID]
+			if !ok || desc.Capacity.Overloaded() {
+				continue
+			}
+			if target == nil || desc.Capacity.LeaseCount < targetLeases {
+				target = repl
+				targetLeases = desc.Capacity.LeaseCount
+			}
+		}
+		return target, targetLeases
+	}
+
+	preferred := a.preferredLeaseholders(zone, existing)
+	if len(preferred) > 0 {
+		leaseholderPreferred := false
+		for _, repl := range preferred {
+			if repl.StoreID == leaseStoreID {
+				leaseholderPreferred = true
+				break
+			}
+		}
+		if !leaseholderPreferred {
+			if target, _ := leastLoaded(preferred); target != nil {
+				if log.V(2) {
+					log.Infof(context.TODO(), "transferring lease from s%d to preferred s%d",
+						leaseStoreID, target.StoreID)
+				}
+				return target
+			}
+		}
+		// Only balance leases among the preferred replicas.
+		existing = preferred
+	}
+
+	if !EnableLeaseRebalancing {
+		return nil
+	}
+	source, ok := a.stores().getStoreDescriptor(leaseStoreID)
+	if !ok {
+		return nil
+	}
+	mean := sl.candidateLeases.mean
+	overfullThreshold := int32(math.Ceil(mean * (1 + RebalanceThreshold.Get())))
+	if source.Capacity.LeaseCount <= overfullThreshold {
+		return nil
+	}
+
+	target, targetLeases := leastLoaded(existing)
+	if target == nil || float64(targetLeases) >= mean {
+		if log.V(2) {
+			log.Infof(context.TODO(), "not transferring lease: no replica below the mean lease count %.1f", mean)
+		}
+		return nil
+	}
+	if log.V(2) {
+		log.Infof(context.TODO(), "transferring lease from s%d (%d leases) to s%d (%d leases): mean=%.1f",
+			leaseStoreID, source.Capacity.LeaseCount, target.StoreID, targetLeases, mean)
+	}
+	return target
+}
+
+// ShedLeaseTarget returns a replica to transfer the range lease to if the
+// lease-holder's store is overloaded (see roachpb.StoreCapacity.Overloaded),
+// or nil if the lease should stay. The target is the replica, on a store
+// which isn't itself overloaded, whose store holds the fewest leases;
+// replicas satisfying the zone's lease preferences come first.
+func (a Allocator) ShedLeaseTarget(
+	zone config.ZoneConfig, existing []roachpb.ReplicaDescriptor, leaseStoreID roachpb.StoreID,
+) *roachpb.ReplicaDescriptor {
+	if !a.options.AllowRebalance || !leaseSheddingEnabled.Get() {
+		return nil
+	}
+	source, ok := a.stores().getStoreDescriptor(leaseStoreID)
+	if !ok || !source.Capacity.Overloaded() {
+		return nil
+	}
+
+	target := a.leastLoadedLeaseTarget(zone, existing, leaseStoreID)
+	if target != nil && log.V(2) {
+		log.Infof(context.TODO(), "shedding lease from s%d (overload %.2f) to s%d",
+			leaseStoreID, source.Capacity.Overload, target.StoreID)
+	}
+	return target
+}
+
+// DrainLeaseTarget returns the replica to transfer the range lease to from
+// the provided list of existing replicas when the lease-holder's store is
+// draining, or nil if none of them can take it. The lease goes to the
+// (preferred) replica whose store holds the fewest leases, as when it is
+// shed; see ShedLeaseTarget.
+func (a Allocator) DrainLeaseTarget(
+	zone config.ZoneConfig, existing []roachpb.ReplicaDescriptor, leaseStoreID roachpb.StoreID,
+) *roachpb.ReplicaDescriptor {
+	return a.leastLoadedLeaseTarget(zone, existing, leaseStoreID)
+}
+
+// leastLoadedLeaseTarget returns the replica other than the lease-holder
+// whose store holds the fewest leases, among the preferred lease-holders if
+// any of them qualifies and among all the replicas otherwise. Replicas on
+// suspect or overloaded stores aren't considered.
+func (a Allocator) leastLoadedLeaseTarget(
+	zone config.ZoneConfig, existing []roachpb.ReplicaDescriptor, leaseStoreID roachpb.StoreID,
+) *roachpb.ReplicaDescriptor {
+	sl, _, _ := a.stores().getStoreList(config.Constraints{}, nil, storeFilterSuspect, a.options.Deterministic)
+	candidates := make(map[roachpb.StoreID]*roachpb.StoreDescriptor, len(sl.stores))
+	for i := range sl.stores {
+		candidates[sl.stores[i].StoreID] = &sl.stores[i]
+	}
+	leastLoaded := func(repls []roachpb.ReplicaDescriptor) *roachpb.ReplicaDescriptor {
+		var target *roachpb.ReplicaDescriptor
+		var targetLeases int32
+		for i := range repls {
+			repl := &repls[i]
+			if repl.StoreID == leaseStoreID {
+				continue
+			}
+			desc, ok := candidates[repl.StoreID]
+			if !ok || desc.Capacity.Overloaded() {
+				continue
+			}
+			if target == nil || desc.Capacity.LeaseCount < targetLeases {
+				target = repl
+				targetLeases = desc.Capacity.LeaseCount
+			}
+		}
+		return target
+	}
+
+	if target := leastLoaded(a.preferredLeaseholders(zone, existing)); target != nil {
+		return target
+	}
+	return leastLoaded(existing)
+}
+
+// preferredLeaseholders returns the replicas whose stores satisfy the first of
+// the zone's lease preferences that is satisfied by any live replica. It
+// returns nil if the zone has no lease preferences or none of them can be
+// satisfied.
+func (a Allocator) preferredLeaseholders(
+	zone config.ZoneConfig, existing []roachpb.ReplicaDescriptor,
+) []roachpb.ReplicaDescriptor {
+	for _, preference := range zone.LeasePreferences {
+		var preferred []roachpb.ReplicaDescriptor
+		for _, repl := range existing {
+			if a.stores().storeMatches(repl.StoreID, preference) {
+				preferred = append(preferred, repl)
+			}
+		}
+		if len(preferred) > 0 {
+			return preferred
+		}
+	}
+	return nil
+}
+
+// balancer returns the balancer implementing the RebalanceMode selected by
+// kv.allocator.rebalance_mode.
+func (a Allocator) balancer() balancer {
+	rcb := rangeCountBalancer{a.randGen}
+	switch RebalanceMode(rebalanceMode.Get()) {
+	case RebalanceByWriteLoad:
+		return loadBalancer{rcb, writeLoadDimension}
+	case RebalanceByLogicalBytes:
+		return loadBalancer{rcb, logicalBytesDimension}
+	default:
+		return rcb
+	}
 }
 
 // selectGood attempts to select a store from the supplied store list that it
@@ -334,16 +827,14 @@ func (a Allocator) RebalanceTarget(
 // in the supplied 'exclude' list will be disqualified from selection. Returns
 // the selected store or nil if no such store can be found.
 func (a Allocator) selectGood(sl StoreList, excluded nodeIDSet) *roachpb.StoreDescriptor {
-	rcb := rangeCountBalancer{a.randGen}
-	return rcb.selectGood(sl, excluded)
+	return a.balancer().selectGood(sl, excluded)
 }
 
 // selectBad attempts to select a store from the supplied store list that it
 // considers to be 'Bad' relative to the other stores in the list. Returns the
 // selected store or nil if no such store can be found.
 func (a Allocator) selectBad(sl StoreList) *roachpb.StoreDescriptor {
-	rcb := rangeCountBalancer{a.randGen}
-	return rcb.selectBad(sl)
+	return a.balancer().selectBad(sl)
 }
 
 // improve attempts to select an improvement over the given store from the
@@ -351,15 +842,13 @@ func (a Allocator) selectBad(sl StoreList) *roachpb.StoreDescriptor {
 // will be disqualified from selection. Returns the selected store, or nil if
 // no such store can be found.
 func (a Allocator) improve(sl StoreList, excluded nodeIDSet) *roachpb.StoreDescriptor {
-	rcb := rangeCountBalancer{a.randGen}
-	return rcb.improve(sl, excluded)
+	return a.balancer().improve(sl, excluded)
 }
 
 // shouldRebalance returns whether the specified store is a candidate for
 // having a replica removed from it given the candidate store list.
 func (a Allocator) shouldRebalance(store roachpb.StoreDescriptor, sl StoreList) bool {
-	rcb := rangeCountBalancer{a.randGen}
-	return rcb.shouldRebalance(store, sl)
+	return a.balancer().shouldRebalance(store, sl)
 }
 
 // computeQuorum computes the quorum value for the given number of nodes.
@@ -0,0 +1,122 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/gossip"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+// DebugAllocator runs the allocator offline against a fixed view of the
+// stores of a cluster, such as the one exported by the StorePool of one of
+// its nodes. The stores are neither gossiped nor aged: they stay as they
+// were given until they are replaced with SetStore, and the clock of the
+// underlying StorePool does not advance. This makes it possible to ask what
+// the allocator would decide, and how the decision changes with the zone
+// config or the state of the stores, without affecting the cluster.
+type DebugAllocator struct {
+	Allocator
+
+	stopper   *stop.Stopper
+	storePool *StorePool
+}
+
+// NewDebugAllocator returns a DebugAllocator for the given stores. It must
+// be closed with Close.
+func NewDebugAllocator(stores []StoreHealth) *DebugAllocator {
+	stopper := stop.NewStopper()
+	clock := hlc.NewClock(hlc.NewManualClock(hlc.UnixNano()).UnixNano)
+	rpcContext := rpc.NewContext(log.AmbientContext{}, &base.Config{Insecure: true}, clock, stopper)
+	server := rpc.NewServer(rpcContext) // never started
+	g := gossip.New(log.AmbientContext{}, rpcContext, server, nil, stopper, metric.NewRegistry())
+	storePool := NewStorePool(
+		context.TODO(),
+		g,
+		clock,
+		rpcContext,
+		nil, /* nodeLivenessFn */
+		settings.TestingDurationSetting(TestTimeUntilStoreDeadOff),
+		stopper,
+	)
+	da := &DebugAllocator{
+		Allocator: MakeAllocator(storePool, AllocatorOptions{
+			AllowRebalance: true,
+			Deterministic:  true,
+		}),
+		stopper:   stopper,
+		storePool: storePool,
+	}
+	for _, store := range stores {
+		da.SetStore(store)
+	}
+	return da
+}
+
+// SetStore adds the given store, or replaces the store with the same ID.
+// Of the store's health, only whether it is dead or throttled is taken into
+// account.
+func (da *DebugAllocator) SetStore(store StoreHealth) {
+	sp := da.storePool
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	desc := store.Desc
+	detail := sp.getStoreDetailLocked(desc.StoreID)
+	if detail.desc != nil {
+		sp.mu.attrIndex.remove(desc.StoreID, detail.desc.CombinedAttrs())
+	}
+	sp.mu.attrIndex.add(desc.StoreID, desc.CombinedAttrs())
+	now := sp.clock.Now()
+	// The clock doesn't advance, so the moving averages would ignore the
+	// new values.
+	detail.rangeCount, detail.fractionUsed = ewma{}, ewma{}
+	detail.markAlive(now, &desc)
+	// Stores are marked dead directly rather than through markDead: no
+	// store is going offline.
+	detail.dead = store.Dead
+	detail.throttledUntil = now.GoTime()
+	if store.Throttled {
+		detail.throttledUntil = detail.throttledUntil.Add(sp.declinedReservationsTimeout)
+	}
+}
+
+// Store returns the given store, if it is known.
+func (da *DebugAllocator) Store(storeID roachpb.StoreID) (StoreHealth, bool) {
+	for _, store := range da.Stores() {
+		if store.Desc.StoreID == storeID {
+			return store, true
+		}
+	}
+	return StoreHealth{}, false
+}
+
+// Stores returns every store, sorted by store ID.
+func (da *DebugAllocator) Stores() []StoreHealth {
+	return da.storePool.GetStores()
+}
+
+// Close releases the resources of the DebugAllocator.
+func (da *DebugAllocator) Close() {
+	da.stopper.Stop()
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/config"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestDebugAllocator(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	store := func(storeID roachpb.StoreID, rangeCount int32) StoreHealth {
+		return StoreHealth{Desc: roachpb.StoreDescriptor{
+			StoreID:  storeID,
+			Node:     roachpb.NodeDescriptor{NodeID: roachpb.NodeID(storeID)},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, RangeCount: rangeCount},
+		}}
+	}
+	// Store 1 is the emptiest store, but it is dead and store 2 is throttled.
+	dead := store(1, 0)
+	dead.Dead = true
+	throttled := store(2, 1)
+	throttled.Throttled = true
+	da := NewDebugAllocator([]StoreHealth{dead, throttled, store(3, 10)})
+	defer da.Close()
+
+	if stores := da.Stores(); len(stores) != 3 {
+		t.Fatalf("expected 3 stores, got %+v", stores)
+	}
+	if s, ok := da.Store(1); !ok || !s.Dead {
+		t.Errorf("expected store 1 to be dead, got %+v", s)
+	}
+
+	expectTarget := func(e roachpb.StoreID) {
+		target, err := da.AllocateTarget(config.Constraints{}, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if target.StoreID != e {
+			t.Errorf("expected s%d, got s%d", e, target.StoreID)
+		}
+	}
+	expectTarget(3)
+
+	// Once the store is revived, it is the preferred target.
+	da.SetStore(store(1, 0))
+	expectTarget(1)
+}
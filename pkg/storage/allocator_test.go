@@ -35,6 +35,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/testutils/gossiputil"
 	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
@@ -205,6 +206,7 @@ func mockStorePool(
 			detail.deadReplicas[replica.RangeID] = append(detail.deadReplicas[replica.RangeID], replica.Replica)
 		}
 	}
+	storePool.invalidateStoreListsLocked()
 }
 
 func TestAllocatorSimpleRetrieval(t *testing.T) {
@@ -297,6 +299,37 @@ func TestAllocatorExistingReplica(t *testing.T) {
 	}
 }
 
+// TestAllocatorOverloadedStores verifies that overloaded stores aren't
+// chosen as targets for new replicas.
+func TestAllocatorOverloadedStores(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, a, _ := createTestAllocator()
+	defer stopper.Stop()
+
+	var stores []*roachpb.StoreDescriptor
+	for i, overload := range []float64{2, 1, 0.5} {
+		stores = append(stores, &roachpb.StoreDescriptor{
+			StoreID:  roachpb.StoreID(i + 1),
+			Node:     roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i + 1)},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, Overload: overload},
+		})
+	}
+	gossiputil.NewStoreGossiper(g).GossipStores(stores, t)
+
+	result, err := a.AllocateTarget(config.Constraints{}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.StoreID != 3 {
+		t.Errorf("expected store 3, got %d", result.StoreID)
+	}
+	if result, err := a.AllocateTarget(config.Constraints{}, []roachpb.ReplicaDescriptor{
+		{NodeID: 3, StoreID: 3},
+	}, false); err == nil {
+		t.Errorf("expected no overloaded store to be chosen, got %d", result.StoreID)
+	}
+}
+
 // TestAllocatorRelaxConstraints verifies that attribute constraints
 // will be relaxed in order to match nodes lacking required attributes,
 // if necessary to find an allocation target.
@@ -370,7 +403,7 @@ func TestAllocatorRebalance(t *testing.T) {
 			Node:    roachpb.NodeDescriptor{NodeID: 3},
 			Capacity: roachpb.StoreCapacity{
 				Capacity:   100,
-				Available:  100 - int64(100*maxFractionUsedThreshold),
+				Available:  100 - int64(100*maxFractionUsedThreshold.Get()),
 				RangeCount: 5,
 			},
 		},
@@ -380,7 +413,7 @@ func TestAllocatorRebalance(t *testing.T) {
 			Node:    roachpb.NodeDescriptor{NodeID: 4},
 			Capacity: roachpb.StoreCapacity{
 				Capacity:   100,
-				Available:  (100 - int64(100*maxFractionUsedThreshold)) / 2,
+				Available:  (100 - int64(100*maxFractionUsedThreshold.Get())) / 2,
 				RangeCount: 10,
 			},
 		},
@@ -409,6 +442,15 @@ func TestAllocatorRebalance(t *testing.T) {
 		}
 	}
 
+	// Stores which are too full to receive replicas remain removal candidates.
+	remove, err := a.RemoveTarget([]roachpb.ReplicaDescriptor{{StoreID: 1}, {StoreID: 4}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remove.StoreID != 4 {
+		t.Errorf("expected to remove replica on store 4; got %d", remove.StoreID)
+	}
+
 	// Verify shouldRebalance results.
 	a.options.Deterministic = true
 	for i, store := range stores {
@@ -416,7 +458,7 @@ func TestAllocatorRebalance(t *testing.T) {
 		if !ok {
 			t.Fatalf("%d: unable to get store %d descriptor", i, store.StoreID)
 		}
-		sl, _, _ := a.storePool.getStoreList(config.Constraints{}, true)
+		sl, _, _ := a.storePool.getStoreList(config.Constraints{}, nil, storeFilterNone, true)
 		result := a.shouldRebalance(desc, sl)
 		if expResult := (i >= 2); expResult != result {
 			t.Errorf("%d: expected rebalance %t; got %t", i, expResult, result)
@@ -424,6 +466,69 @@ func TestAllocatorRebalance(t *testing.T) {
 	}
 }
 
+// TestRangeCountRebalanceSettings verifies that changes to the rebalance
+// threshold and the range count deviation settings take effect.
+func TestRangeCountRebalanceSettings(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var sl StoreList
+	for i, rangeCount := range []int32{8, 10, 10, 12} {
+		sl.add(roachpb.StoreDescriptor{
+			StoreID:  roachpb.StoreID(i + 1),
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, RangeCount: rangeCount},
+		})
+	}
+	overfull := sl.stores[3]
+
+	testCases := []struct {
+		threshold, deviation float64
+		expected             bool
+	}{
+		{threshold: 0.05, deviation: 0.5, expected: true},
+		// Neither overfull nor is any store underfull.
+		{threshold: 0.25, deviation: 0.5, expected: false},
+		// Moving a replica wouldn't reduce the deviation from the mean enough.
+		{threshold: 0.05, deviation: 2, expected: false},
+	}
+	for i, c := range testCases {
+		func() {
+			defer settings.TestingSetFloat(RebalanceThreshold, c.threshold)()
+			defer settings.TestingSetFloat(rangeCountDeviation, c.deviation)()
+			if actual := (rangeCountBalancer{}).shouldRebalance(overfull, sl); actual != c.expected {
+				t.Errorf("%d: expected shouldRebalance=%t, got %t", i, c.expected, actual)
+			}
+		}()
+	}
+}
+
+// TestRangeCountRebalanceSmoothed verifies that whether to rebalance away
+// from a store is decided on the moving averages of the range counts rather
+// than the latest ones.
+func TestRangeCountRebalanceSmoothed(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	makeStoreList := func(smoothed []float64) StoreList {
+		var sl StoreList
+		for i, rangeCount := range []int32{8, 10, 10, 12} {
+			sl.addSmoothed(roachpb.StoreDescriptor{
+				StoreID:  roachpb.StoreID(i + 1),
+				Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, RangeCount: rangeCount},
+			}, smoothed[i], 0)
+		}
+		return sl
+	}
+
+	// The latest range counts are a spike; on average the stores are balanced.
+	sl := makeStoreList([]float64{10, 10, 10, 10})
+	if (rangeCountBalancer{}).shouldRebalance(sl.stores[3], sl) {
+		t.Errorf("expected no rebalancing away from a store balanced on average: %s", sl)
+	}
+	sl = makeStoreList([]float64{8, 10, 10, 12})
+	if !(rangeCountBalancer{}).shouldRebalance(sl.stores[3], sl) {
+		t.Errorf("expected rebalancing away from an overfull store: %s", sl)
+	}
+}
+
 // TestAllocatorRebalanceThrashing tests that the rebalancer does not thrash
 // when replica counts are balanced, within the appropriate thresholds, across
 // stores.
@@ -443,7 +548,7 @@ func TestAllocatorRebalanceThrashing(t *testing.T) {
 		for i := range stores {
 			stores[i].rangeCount = mean
 		}
-		surplus := int32(math.Ceil(float64(mean)*RebalanceThreshold + 1))
+		surplus := int32(math.Ceil(float64(mean)*RebalanceThreshold.Get() + 1))
 		stores[0].rangeCount += surplus
 		stores[0].shouldRebalanceFrom = true
 		for i := 1; i < len(stores); i++ {
@@ -462,7 +567,7 @@ func TestAllocatorRebalanceThrashing(t *testing.T) {
 		// Subtract enough ranges from the first store to make it a suitable
 		// rebalance target. To maintain the specified mean, we then add that delta
 		// back to the rest of the replicas.
-		deficit := int32(math.Ceil(float64(mean)*RebalanceThreshold + 1))
+		deficit := int32(math.Ceil(float64(mean)*RebalanceThreshold.Get() + 1))
 		stores[0].rangeCount -= deficit
 		for i := 1; i < len(stores); i++ {
 			stores[i].rangeCount += int32(math.Ceil(float64(deficit) / float64(len(stores)-1)))
@@ -523,7 +628,7 @@ func TestAllocatorRebalanceThrashing(t *testing.T) {
 
 		// Ensure gossiped store descriptor changes have propagated.
 		util.SucceedsSoon(t, func() error {
-			sl, _, _ := a.storePool.getStoreList(config.Constraints{}, true)
+			sl, _, _ := a.storePool.getStoreList(config.Constraints{}, nil, storeFilterNone, true)
 			for j, s := range sl.stores {
 				if a, e := s.Capacity.RangeCount, tc[j].rangeCount; a != e {
 					return errors.Errorf("tc %d: range count for %d = %d != expected %d", i, j, a, e)
@@ -531,7 +636,7 @@ func TestAllocatorRebalanceThrashing(t *testing.T) {
 			}
 			return nil
 		})
-		sl, _, _ := a.storePool.getStoreList(config.Constraints{}, true)
+		sl, _, _ := a.storePool.getStoreList(config.Constraints{}, nil, storeFilterNone, true)
 
 		// Verify shouldRebalance returns the expected value.
 		for j, store := range stores {
@@ -594,7 +699,7 @@ func TestAllocatorRebalanceByCount(t *testing.T) {
 		if !ok {
 			t.Fatalf("%d: unable to get store %d descriptor", i, store.StoreID)
 		}
-		sl, _, _ := a.storePool.getStoreList(config.Constraints{}, true)
+		sl, _, _ := a.storePool.getStoreList(config.Constraints{}, nil, storeFilterNone, true)
 		result := a.shouldRebalance(desc, sl)
 		if expResult := (i < 3); expResult != result {
 			t.Errorf("%d: expected rebalance %t; got %t", i, expResult, result)
@@ -602,6 +707,328 @@ func TestAllocatorRebalanceByCount(t *testing.T) {
 	}
 }
 
+func TestAllocatorRebalanceByWriteLoad(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, a, _ := createTestAllocator()
+	defer stopper.Stop()
+	defer settings.TestingSetInt(rebalanceMode, int64(RebalanceByWriteLoad))()
+
+	// Setup the stores so that range counts are balanced but store 1 serves
+	// most of the writes and store 4 serves almost none.
+	stores := []*roachpb.StoreDescriptor{
+		{
+			StoreID: 1,
+			Node:    roachpb.NodeDescriptor{NodeID: 1},
+			Capacity: roachpb.StoreCapacity{
+				Capacity: 100, Available: 100, RangeCount: 10, WritesPerSecond: 500,
+			},
+		},
+		{
+			StoreID: 2,
+			Node:    roachpb.NodeDescriptor{NodeID: 2},
+			Capacity: roachpb.StoreCapacity{
+				Capacity: 100, Available: 100, RangeCount: 10, WritesPerSecond: 100,
+			},
+		},
+		{
+			StoreID: 3,
+			Node:    roachpb.NodeDescriptor{NodeID: 3},
+			Capacity: roachpb.StoreCapacity{
+				Capacity: 100, Available: 100, RangeCount: 10, WritesPerSecond: 100,
+			},
+		},
+		{
+			StoreID: 4,
+			Node:    roachpb.NodeDescriptor{NodeID: 4},
+			Capacity: roachpb.StoreCapacity{
+				Capacity: 100, Available: 100, RangeCount: 10, WritesPerSecond: 20,
+			},
+		},
+	}
+	gossiputil.NewStoreGossiper(g).GossipStores(stores, t)
+
+	// Every rebalance target must be store 4 (or nil for case of missing the only option).
+	for i := 0; i < 10; i++ {
+		result := a.RebalanceTarget(config.Constraints{}, []roachpb.ReplicaDescriptor{{StoreID: 1}}, 0)
+		if result != nil && result.StoreID != 4 {
+			t.Errorf("expected store 4; got %d", result.StoreID)
+		}
+	}
+
+	// Only the hotspot should shed replicas.
+	a.options.Deterministic = true
+	for i, store := range stores {
+		desc, ok := a.storePool.getStoreDescriptor(store.StoreID)
+		if !ok {
+			t.Fatalf("%d: unable to get store %d descriptor", i, store.StoreID)
+		}
+		sl, _, _ := a.storePool.getStoreList(config.Constraints{}, nil, storeFilterNone, true)
+		result := a.shouldRebalance(desc, sl)
+		if expResult := (i == 0); expResult != result {
+			t.Errorf("%d: expected rebalance %t; got %t", i, expResult, result)
+		}
+	}
+
+	// The hotspot should be the one selected for removal.
+	sl, _, _ := a.storePool.getStoreList(config.Constraints{}, nil, storeFilterNone, true)
+	if bad := a.selectBad(sl); bad == nil || bad.StoreID != 1 {
+		t.Errorf("expected store 1 to be selected for removal; got %v", bad)
+	}
+}
+
+func TestAllocatorRebalanceByLogicalBytes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, a, _ := createTestAllocator()
+	defer stopper.Stop()
+	defer settings.TestingSetInt(rebalanceMode, int64(RebalanceByLogicalBytes))()
+
+	// Setup the stores so that range counts are balanced but store 1 holds
+	// most of the data and store 4 almost none.
+	logicalBytes := []int64{4 << 30, 1 << 30, 1 << 30, 100 << 20}
+	var stores []*roachpb.StoreDescriptor
+	for i, bytes := range logicalBytes {
+		stores = append(stores, &roachpb.StoreDescriptor{
+			StoreID: roachpb.StoreID(i + 1),
+			Node:    roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i + 1)},
+			Capacity: roachpb.StoreCapacity{
+				Capacity: 100, Available: 100, RangeCount: 10, LogicalBytes: bytes,
+			},
+		})
+	}
+	gossiputil.NewStoreGossiper(g).GossipStores(stores, t)
+
+	// Every rebalance target must be store 4 (or nil for case of missing the only option).
+	for i := 0; i < 10; i++ {
+		result := a.RebalanceTarget(config.Constraints{}, []roachpb.ReplicaDescriptor{{StoreID: 1}}, 0)
+		if result != nil && result.StoreID != 4 {
+			t.Errorf("expected store 4; got %d", result.StoreID)
+		}
+	}
+
+	// Only the store holding most of the data should shed replicas.
+	a.options.Deterministic = true
+	for i, store := range stores {
+		desc, ok := a.storePool.getStoreDescriptor(store.StoreID)
+		if !ok {
+			t.Fatalf("%d: unable to get store %d descriptor", i, store.StoreID)
+		}
+		sl, _, _ := a.storePool.getStoreList(config.Constraints{}, nil, storeFilterNone, true)
+		result := a.shouldRebalance(desc, sl)
+		if expResult := (i == 0); expResult != result {
+			t.Errorf("%d: expected rebalance %t; got %t", i, expResult, result)
+		}
+	}
+}
+
+func TestAllocatorTransferLeaseTarget(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, a, _ := createTestAllocator()
+	defer stopper.Stop()
+
+	// Set up stores with an equal number of ranges but a skewed number of
+	// leases.
+	var stores []*roachpb.StoreDescriptor
+	for i, leases := range []int32{100, 10, 50} {
+		stores = append(stores, &roachpb.StoreDescriptor{
+			StoreID: roachpb.StoreID(i + 1),
+			Node:    roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i + 1)},
+			Capacity: roachpb.StoreCapacity{
+				Capacity: 100, Available: 100, RangeCount: 100, LeaseCount: leases,
+			},
+		})
+	}
+	gossiputil.NewStoreGossiper(g).GossipStores(stores, t)
+
+	existing := []roachpb.ReplicaDescriptor{
+		{NodeID: 1, StoreID: 1},
+		{NodeID: 2, StoreID: 2},
+		{NodeID: 3, StoreID: 3},
+	}
+
+	testCases := []struct {
+		leaseholder roachpb.StoreID
+		expected    roachpb.StoreID
+	}{
+		// Store 1 holds far more leases than the mean, and store 2 the fewest.
+		{leaseholder: 1, expected: 2},
+		// Stores 2 and 3 are at or below the mean.
+		{leaseholder: 2, expected: 0},
+		{leaseholder: 3, expected: 0},
+	}
+	for _, c := range testCases {
+		target := a.TransferLeaseTarget(config.ZoneConfig{}, existing, c.leaseholder)
+		var targetStoreID roachpb.StoreID
+		if target != nil {
+			targetStoreID = target.StoreID
+		}
+		if targetStoreID != c.expected {
+			t.Errorf("leaseholder s%d: expected target s%d, got s%d", c.leaseholder, c.expected, targetStoreID)
+		}
+	}
+}
+
+func TestAllocatorTransferLeaseTargetPreferences(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, a, _ := createTestAllocator()
+	defer stopper.Stop()
+	defer func(enabled bool) { EnableLeaseRebalancing = enabled }(EnableLeaseRebalancing)
+	EnableLeaseRebalancing = false
+
+	// Stores 1 and 2 are in "us", store 3 is in "eu". Store 1 holds the most
+	// leases.
+	var stores []*roachpb.StoreDescriptor
+	for i, region := range []string{"us", "us", "eu"} {
+		stores = append(stores, &roachpb.StoreDescriptor{
+			StoreID:  roachpb.StoreID(i + 1),
+			Attrs:    roachpb.Attributes{Attrs: []string{region}},
+			Node:     roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i + 1)},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, LeaseCount: int32(10 - i)},
+		})
+	}
+	gossiputil.NewStoreGossiper(g).GossipStores(stores, t)
+
+	existing := []roachpb.ReplicaDescriptor{
+		{NodeID: 1, StoreID: 1},
+		{NodeID: 2, StoreID: 2},
+		{NodeID: 3, StoreID: 3},
+	}
+	preferEU := config.ZoneConfig{
+		LeasePreferences: []config.Constraints{
+			{Constraints: []config.Constraint{{Value: "asia"}}},
+			{Constraints: []config.Constraint{{Value: "eu"}}},
+		},
+	}
+	preferUS := config.ZoneConfig{
+		LeasePreferences: []config.Constraints{
+			{Constraints: []config.Constraint{{Value: "us"}}},
+		},
+	}
+
+	testCases := []struct {
+		zone        config.ZoneConfig
+		leaseholder roachpb.StoreID
+		expected    roachpb.StoreID
+	}{
+		// "asia" can't be satisfied, so the lease belongs in "eu".
+		{zone: preferEU, leaseholder: 1, expected: 3},
+		{zone: preferEU, leaseholder: 3, expected: 0},
+		// The lease belongs in "us"; prefer the store with fewer leases.
+		{zone: preferUS, leaseholder: 3, expected: 2},
+		{zone: preferUS, leaseholder: 1, expected: 0},
+		// Without preferences (and lease rebalancing) the lease stays put.
+		{zone: config.ZoneConfig{}, leaseholder: 3, expected: 0},
+	}
+	for i, c := range testCases {
+		target := a.TransferLeaseTarget(c.zone, existing, c.leaseholder)
+		var targetStoreID roachpb.StoreID
+		if target != nil {
+			targetStoreID = target.StoreID
+		}
+		if targetStoreID != c.expected {
+			t.Errorf("%d: leaseholder s%d: expected target s%d, got s%d",
+				i, c.leaseholder, c.expected, targetStoreID)
+		}
+	}
+}
+
+// TestAllocatorShedLeaseTarget verifies that an overloaded store sheds its
+// leases to stores which aren't overloaded.
+func TestAllocatorShedLeaseTarget(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, a, _ := createTestAllocator()
+	defer stopper.Stop()
+
+	// Stores 1 and 4 are overloaded. Store 2 satisfies the lease preference
+	// below, and store 3 holds the fewest leases of the other stores.
+	overloads := []float64{1.5, 0.2, 0.3, 1}
+	leases := []int32{10, 10, 5, 2}
+	var stores []*roachpb.StoreDescriptor
+	for i := range overloads {
+		stores = append(stores, &roachpb.StoreDescriptor{
+			StoreID: roachpb.StoreID(i + 1),
+			Attrs:   roachpb.Attributes{Attrs: []string{fmt.Sprintf("s%d", i+1)}},
+			Node:    roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i + 1)},
+			Capacity: roachpb.StoreCapacity{
+				Capacity:   100,
+				Available:  100,
+				LeaseCount: leases[i],
+				Overload:   overloads[i],
+			},
+		})
+	}
+	gossiputil.NewStoreGossiper(g).GossipStores(stores, t)
+
+	existing := []roachpb.ReplicaDescriptor{
+		{NodeID: 1, StoreID: 1},
+		{NodeID: 2, StoreID: 2},
+		{NodeID: 3, StoreID: 3},
+		{NodeID: 4, StoreID: 4},
+	}
+	preferS2 := config.ZoneConfig{
+		LeasePreferences: []config.Constraints{
+			{Constraints: []config.Constraint{{Value: "s2"}}},
+		},
+	}
+
+	testCases := []struct {
+		zone        config.ZoneConfig
+		leaseholder roachpb.StoreID
+		enabled     bool
+		expected    roachpb.StoreID
+	}{
+		// Store 4 holds fewer leases, but is overloaded.
+		{leaseholder: 1, enabled: true, expected: 3},
+		{zone: preferS2, leaseholder: 1, enabled: true, expected: 2},
+		{leaseholder: 4, enabled: true, expected: 3},
+		// Stores which aren't overloaded keep their leases.
+		{leaseholder: 2, enabled: true, expected: 0},
+		// Shedding is disabled.
+		{leaseholder: 1, enabled: false, expected: 0},
+	}
+	for i, c := range testCases {
+		func() {
+			defer settings.TestingSetBool(leaseSheddingEnabled, c.enabled)()
+			target := a.ShedLeaseTarget(c.zone, existing, c.leaseholder)
+			var targetStoreID roachpb.StoreID
+			if target != nil {
+				targetStoreID = target.StoreID
+			}
+			if targetStoreID != c.expected {
+				t.Errorf("%d: leaseholder s%d: expected target s%d, got s%d",
+					i, c.leaseholder, c.expected, targetStoreID)
+			}
+		}()
+	}
+
+	// Draining stores hand their leases over whether or not they are
+	// overloaded, to the same targets.
+	drainCases := []struct {
+		zone        config.ZoneConfig
+		existing    []roachpb.ReplicaDescriptor
+		leaseholder roachpb.StoreID
+		expected    roachpb.StoreID
+	}{
+		{existing: existing, leaseholder: 1, expected: 3},
+		{existing: existing, leaseholder: 2, expected: 3},
+		{zone: preferS2, existing: existing, leaseholder: 3, expected: 2},
+		// The preferred replica is the draining one.
+		{zone: preferS2, existing: existing, leaseholder: 2, expected: 3},
+		// The other replica is on an overloaded store.
+		{existing: []roachpb.ReplicaDescriptor{existing[0], existing[3]}, leaseholder: 1, expected: 0},
+	}
+	for i, c := range drainCases {
+		target := a.DrainLeaseTarget(c.zone, c.existing, c.leaseholder)
+		var targetStoreID roachpb.StoreID
+		if target != nil {
+			targetStoreID = target.StoreID
+		}
+		if targetStoreID != c.expected {
+			t.Errorf("drain %d: leaseholder s%d: expected target s%d, got s%d",
+				i, c.leaseholder, c.expected, targetStoreID)
+		}
+	}
+}
+
 // TestAllocatorRemoveTarget verifies that the replica chosen by RemoveTarget is
 // the one with the lowest capacity.
 func TestAllocatorRemoveTarget(t *testing.T) {
@@ -679,6 +1106,231 @@ func TestAllocatorRemoveTarget(t *testing.T) {
 	}
 }
 
+// TestAllocatorRemoveTargetStoreStatus verifies that replicas on dead and
+// throttled stores are removed before those on the most loaded live store.
+func TestAllocatorRemoveTargetStoreStatus(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, sp, a, _ := createTestAllocator()
+	defer stopper.Stop()
+
+	replicas := []roachpb.ReplicaDescriptor{
+		{StoreID: 1, NodeID: 1, ReplicaID: 1},
+		{StoreID: 2, NodeID: 2, ReplicaID: 2},
+		{StoreID: 3, NodeID: 3, ReplicaID: 3},
+		{StoreID: 4, NodeID: 4, ReplicaID: 4},
+	}
+	// Store 3 is the most loaded store.
+	stores := []*roachpb.StoreDescriptor{
+		{
+			StoreID:  1,
+			Node:     roachpb.NodeDescriptor{NodeID: 1},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, RangeCount: 10},
+		},
+		{
+			StoreID:  2,
+			Node:     roachpb.NodeDescriptor{NodeID: 2},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 65, RangeCount: 12},
+		},
+		{
+			StoreID:  3,
+			Node:     roachpb.NodeDescriptor{NodeID: 3},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 60, RangeCount: 15},
+		},
+		{
+			StoreID:  4,
+			Node:     roachpb.NodeDescriptor{NodeID: 4},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 65, RangeCount: 10},
+		},
+	}
+	sg := gossiputil.NewStoreGossiper(g)
+	sg.GossipStores(stores, t)
+
+	expectRemoved := func(leaseStoreID roachpb.StoreID, e roachpb.ReplicaDescriptor) {
+		targetRepl, err := a.RemoveTarget(replicas, leaseStoreID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if targetRepl != e {
+			t.Errorf("lease on s%d: expected to remove %+v, got %+v", leaseStoreID, e, targetRepl)
+		}
+	}
+
+	expectRemoved(1, replicas[2])
+
+	// A throttled store is preferred over the most loaded one.
+	sp.mu.Lock()
+	sp.mu.storeDetails[1].throttledUntil = sp.clock.Now().GoTime().Add(time.Hour)
+	sp.invalidateStoreListsLocked()
+	sp.mu.Unlock()
+	expectRemoved(4, replicas[0])
+
+	// A dead store is preferred over a throttled one, unless it holds the
+	// lease.
+	sp.mu.Lock()
+	sp.mu.storeDetails[2].markDead(sp.clock.Now())
+	sp.invalidateStoreListsLocked()
+	sp.mu.Unlock()
+	expectRemoved(4, replicas[1])
+	expectRemoved(2, replicas[0])
+
+	if e, a := []storeStatus{
+		storeStatusThrottled, storeStatusDead, storeStatusLive, storeStatusLive,
+	}, sp.replicaStatuses(replicas); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected statuses %v, got %v", e, a)
+	}
+}
+
+// TestAllocatorRebalanceReversal verifies that an allocator made for a range
+// doesn't reverse the range's recent rebalancing moves.
+func TestAllocatorRebalanceReversal(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, sp, a, manualClock := createTestAllocator()
+	defer stopper.Stop()
+
+	// Store 1 is the best rebalance target, and store 4 the best removal
+	// candidate.
+	stores := []*roachpb.StoreDescriptor{
+		{
+			StoreID:  1,
+			Node:     roachpb.NodeDescriptor{NodeID: 1},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, RangeCount: 1},
+		},
+		{
+			StoreID:  2,
+			Node:     roachpb.NodeDescriptor{NodeID: 2},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 90, RangeCount: 2},
+		},
+		{
+			StoreID:  3,
+			Node:     roachpb.NodeDescriptor{NodeID: 3},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 50, RangeCount: 10},
+		},
+		{
+			StoreID:  4,
+			Node:     roachpb.NodeDescriptor{NodeID: 4},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 40, RangeCount: 12},
+		},
+	}
+	gossiputil.NewStoreGossiper(g).GossipStores(stores, t)
+
+	// The range was just moved from store 1 to store 4.
+	const rangeID = 7
+	sp.rebalanceHistory.recordAdd(rangeID, 4, sp.clock.Now().GoTime())
+	sp.rebalanceHistory.recordRemove(rangeID, 1, sp.clock.Now().GoTime())
+	ra := a.forRange(rangeID)
+
+	existing := []roachpb.ReplicaDescriptor{{NodeID: 4, StoreID: 4, ReplicaID: 1}}
+	for i := 0; i < 10; i++ {
+		if target := ra.RebalanceTarget(config.Constraints{}, existing, 0); target == nil {
+			t.Fatal("nil result")
+		} else if target.StoreID == 1 {
+			t.Fatalf("%d: expected the move from s1 not to be reversed", i)
+		}
+	}
+
+	replicas := []roachpb.ReplicaDescriptor{
+		{NodeID: 2, StoreID: 2, ReplicaID: 1},
+		{NodeID: 3, StoreID: 3, ReplicaID: 2},
+		{NodeID: 4, StoreID: 4, ReplicaID: 3},
+	}
+	if repl, err := a.RemoveTarget(replicas, 2); err != nil {
+		t.Fatal(err)
+	} else if repl.StoreID != 4 {
+		t.Fatalf("expected the replica on s4 to be removed, got %+v", repl)
+	}
+	if repl, err := ra.RemoveTarget(replicas, 2); err != nil {
+		t.Fatal(err)
+	} else if repl.StoreID != 3 {
+		t.Fatalf("expected the replica on s3 to be removed, got %+v", repl)
+	}
+
+	// Once the window has passed, the move may be reversed.
+	manualClock.Increment(rebalanceReversalWindow.Get().Nanoseconds())
+	if repl, err := ra.RemoveTarget(replicas, 2); err != nil {
+		t.Fatal(err)
+	} else if repl.StoreID != 4 {
+		t.Fatalf("expected the replica on s4 to be removed, got %+v", repl)
+	}
+}
+
+// TestAllocatorDiversity verifies that locality diversity takes precedence
+// over range counts when adding and removing replicas.
+func TestAllocatorDiversity(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, a, _ := createTestAllocator()
+	defer stopper.Stop()
+
+	locality := func(s string) roachpb.Locality {
+		var l roachpb.Locality
+		if err := l.Set(s); err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+	stores := []*roachpb.StoreDescriptor{
+		{
+			StoreID:  1,
+			Node:     roachpb.NodeDescriptor{NodeID: 1, Locality: locality("region=a,zone=1")},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, RangeCount: 10},
+		},
+		{
+			StoreID:  2,
+			Node:     roachpb.NodeDescriptor{NodeID: 2, Locality: locality("region=a,zone=2")},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, RangeCount: 0},
+		},
+		{
+			StoreID:  3,
+			Node:     roachpb.NodeDescriptor{NodeID: 3, Locality: locality("region=b,zone=1")},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, RangeCount: 50},
+		},
+		{
+			StoreID:  4,
+			Node:     roachpb.NodeDescriptor{NodeID: 4, Locality: locality("region=b,zone=1")},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, RangeCount: 5},
+		},
+	}
+	gossiputil.NewStoreGossiper(g).GossipStores(stores, t)
+
+	replicas := make([]roachpb.ReplicaDescriptor, len(stores))
+	for i, store := range stores {
+		replicas[i] = roachpb.ReplicaDescriptor{
+			NodeID:    store.Node.NodeID,
+			StoreID:   store.StoreID,
+			ReplicaID: roachpb.ReplicaID(i + 1),
+		}
+	}
+
+	allocTestCases := []struct {
+		existing []roachpb.ReplicaDescriptor
+		expected roachpb.StoreID
+	}{
+		// Store 2 holds the fewest ranges, but stores 3 and 4 are in another
+		// region.
+		{replicas[:1], 4},
+		// Store 4 shares a zone with store 3 while store 2 is in a different
+		// zone than store 1.
+		{[]roachpb.ReplicaDescriptor{replicas[0], replicas[2]}, 2},
+	}
+	for i, tc := range allocTestCases {
+		result, err := a.AllocateTarget(config.Constraints{}, tc.existing, false)
+		if err != nil {
+			t.Fatalf("%d: %s", i, err)
+		}
+		if result.StoreID != tc.expected {
+			t.Errorf("%d: expected store %d; got %d", i, tc.expected, result.StoreID)
+		}
+	}
+
+	// Stores 3 and 4 share a zone; of the two, store 3 holds more ranges.
+	targetRepl, err := a.RemoveTarget(replicas, stores[0].StoreID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, e := targetRepl, replicas[2]; a != e {
+		t.Fatalf("RemoveTarget did not select expected replica; expected %v, got %v", e, a)
+	}
+}
+
 func TestAllocatorComputeAction(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	stopper, _, sp, a, _ := createTestAllocator()
@@ -1036,6 +1688,179 @@ func TestAllocatorComputeAction(t *testing.T) {
 	}
 }
 
+// TestAllocatorComputeActionCorrelatedDeadReplicas verifies that a range
+// which lost several replicas to the failure of a single node is repaired
+// before one which lost as many replicas on different nodes.
+func TestAllocatorComputeActionCorrelatedDeadReplicas(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, _, sp, a, _ := createTestAllocator()
+	defer stopper.Stop()
+
+	mockStorePool(sp, []roachpb.StoreID{1, 2, 3}, []roachpb.StoreID{4, 5, 6}, nil)
+
+	// makeDesc returns the descriptor of a range with replicas on stores one
+	// to three and on the given dead stores, which are on the given nodes.
+	makeDesc := func(deadNodes ...roachpb.NodeID) roachpb.RangeDescriptor {
+		var desc roachpb.RangeDescriptor
+		for i := 1; i <= 3+len(deadNodes); i++ {
+			nodeID := roachpb.NodeID(i)
+			if i > 3 {
+				nodeID = deadNodes[i-4]
+			}
+			desc.Replicas = append(desc.Replicas, roachpb.ReplicaDescriptor{
+				NodeID:    nodeID,
+				StoreID:   roachpb.StoreID(i),
+				ReplicaID: roachpb.ReplicaID(i),
+			})
+		}
+		return desc
+	}
+	zone := config.ZoneConfig{NumReplicas: 5}
+	uncorrelated, correlated := makeDesc(4, 5), makeDesc(4, 4)
+	uncorrelatedAction, uncorrelatedPriority := a.ComputeAction(zone, &uncorrelated)
+	correlatedAction, correlatedPriority := a.ComputeAction(zone, &correlated)
+	if uncorrelatedAction != AllocatorRemoveDead || correlatedAction != AllocatorRemoveDead {
+		t.Fatalf("expected AllocatorRemoveDead, got %v and %v", uncorrelatedAction, correlatedAction)
+	}
+	if correlatedPriority <= uncorrelatedPriority {
+		t.Errorf("expected the range which lost two replicas on one node to have a higher "+
+			"priority than %f, got %f", uncorrelatedPriority, correlatedPriority)
+	}
+
+	if n := correlatedDeadReplicas(correlated.Replicas[3:]); n != 2 {
+		t.Errorf("expected 2 correlated dead replicas, got %d", n)
+	}
+	if n := correlatedDeadReplicas(uncorrelated.Replicas[3:]); n != 0 {
+		t.Errorf("expected no correlated dead replicas, got %d", n)
+	}
+}
+
+// TestAllocatorComputeActionQuorumAtRisk verifies that a range which would
+// lose its quorum to one more failure is repaired before a range which is
+// further below its replication factor but can still tolerate a failure.
+func TestAllocatorComputeActionQuorumAtRisk(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, _, sp, a, _ := createTestAllocator()
+	defer stopper.Stop()
+
+	mockStorePool(sp, []roachpb.StoreID{1, 2, 3, 4, 5}, []roachpb.StoreID{6, 7}, nil)
+
+	// makeDesc returns the descriptor of a range with replicas on the given
+	// stores.
+	makeDesc := func(storeIDs ...roachpb.StoreID) roachpb.RangeDescriptor {
+		var desc roachpb.RangeDescriptor
+		for _, storeID := range storeIDs {
+			desc.Replicas = append(desc.Replicas, roachpb.ReplicaDescriptor{
+				NodeID:    roachpb.NodeID(storeID),
+				StoreID:   storeID,
+				ReplicaID: roachpb.ReplicaID(storeID),
+			})
+		}
+		return desc
+	}
+	// Five of seven replicas are live: one more failure leaves a quorum.
+	safe := makeDesc(1, 2, 3, 4, 5, 6, 7)
+	// Two of three replicas are live: one more failure loses the quorum.
+	atRisk := makeDesc(1, 2, 6)
+	safeAction, safePriority := a.ComputeAction(config.ZoneConfig{NumReplicas: 7}, &safe)
+	atRiskAction, atRiskPriority := a.ComputeAction(config.ZoneConfig{NumReplicas: 3}, &atRisk)
+	if safeAction != AllocatorRemoveDead || atRiskAction != AllocatorRemoveDead {
+		t.Fatalf("expected AllocatorRemoveDead, got %v and %v", safeAction, atRiskAction)
+	}
+	if atRiskPriority <= safePriority {
+		t.Errorf("expected the range at risk of losing its quorum to have a higher priority "+
+			"than %f, got %f", safePriority, atRiskPriority)
+	}
+
+	// The same holds for under-replicated ranges.
+	safe, atRisk = makeDesc(1, 2, 3, 4), makeDesc(1, 2)
+	_, safePriority = a.ComputeAction(config.ZoneConfig{NumReplicas: 7}, &safe)
+	_, atRiskPriority = a.ComputeAction(config.ZoneConfig{NumReplicas: 3}, &atRisk)
+	if atRiskPriority <= safePriority {
+		t.Errorf("expected the under-replicated range at risk of losing its quorum to have "+
+			"a higher priority than %f, got %f", safePriority, atRiskPriority)
+	}
+}
+
+// TestAllocatorReplaceDeadTarget verifies that a replacement for a dead
+// replica is added before the dead replica is removed only when the range
+// would otherwise drop below its replication factor and a target exists.
+func TestAllocatorReplaceDeadTarget(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, a, _ := createTestAllocator()
+	defer stopper.Stop()
+	// Store five is dead, and thus isn't gossiped.
+	gossiputil.NewStoreGossiper(g).GossipStores(sameDCStores[:4], t)
+
+	// makeReplicas returns replicas on the given stores.
+	makeReplicas := func(storeIDs ...roachpb.StoreID) []roachpb.ReplicaDescriptor {
+		var replicas []roachpb.ReplicaDescriptor
+		for _, storeID := range storeIDs {
+			replicas = append(replicas, roachpb.ReplicaDescriptor{
+				NodeID:    roachpb.NodeID(storeID),
+				StoreID:   storeID,
+				ReplicaID: roachpb.ReplicaID(storeID),
+			})
+		}
+		return replicas
+	}
+
+	existing := makeReplicas(1, 2, 5)
+	target := a.ReplaceDeadTarget(config.ZoneConfig{NumReplicas: 3}, existing, existing[2:])
+	if target == nil {
+		t.Fatal("expected a replacement target")
+	}
+	if target.StoreID != 3 && target.StoreID != 4 {
+		t.Errorf("expected a replacement on store 3 or 4, got s%d", target.StoreID)
+	}
+
+	// The range is already back at its replication factor.
+	existing = makeReplicas(1, 2, 3, 5)
+	if target := a.ReplaceDeadTarget(
+		config.ZoneConfig{NumReplicas: 3}, existing, existing[3:],
+	); target != nil {
+		t.Errorf("expected the dead replica to be removed, got a replacement on s%d", target.StoreID)
+	}
+
+	// No live store is available for the replacement.
+	existing = makeReplicas(1, 2, 3, 4, 5)
+	if target := a.ReplaceDeadTarget(
+		config.ZoneConfig{NumReplicas: 5}, existing, existing[4:],
+	); target != nil {
+		t.Errorf("expected the dead replica to be removed, got a replacement on s%d", target.StoreID)
+	}
+}
+
+// TestAllocatorRandSeed verifies that allocators seeded alike make the same
+// random choices, and that an explicit seed overrides the deterministic one.
+func TestAllocatorRandSeed(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	perms := func(a Allocator) [][]int {
+		var perms [][]int
+		for i := 0; i < 5; i++ {
+			perms = append(perms, a.randGen.Perm(10))
+		}
+		return perms
+	}
+
+	a1 := MakeAllocator(nil /* storePool */, AllocatorOptions{RandSeed: 42})
+	a2 := MakeAllocator(nil /* storePool */, AllocatorOptions{RandSeed: 42, Deterministic: true})
+	if a1.randSeed != 42 || a2.randSeed != 42 {
+		t.Fatalf("expected seed 42, got %d and %d", a1.randSeed, a2.randSeed)
+	}
+	if p1, p2 := perms(a1), perms(a2); !reflect.DeepEqual(p1, p2) {
+		t.Errorf("expected allocators with the same seed to agree, got %v and %v", p1, p2)
+	}
+
+	if a := MakeAllocator(nil /* storePool */, AllocatorOptions{Deterministic: true}); a.randSeed != 777 {
+		t.Errorf("expected the deterministic seed, got %d", a.randSeed)
+	}
+	if a := MakeAllocator(nil /* storePool */, AllocatorOptions{}); a.randSeed == 0 {
+		t.Errorf("expected a random seed to be picked")
+	}
+}
+
 // TestAllocatorComputeActionNoStorePool verifies that
 // ComputeAction returns AllocatorNoop when storePool is nil.
 func TestAllocatorComputeActionNoStorePool(t *testing.T) {
@@ -1090,7 +1915,7 @@ func TestAllocatorError(t *testing.T) {
 }
 
 // TestAllocatorThrottled ensures that when a store is throttled, the replica
-// will not be sent to purgatory.
+// is sent to purgatory as throttled rather than as lacking a target.
 func TestAllocatorThrottled(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	stopper, g, _, a, _ := createTestAllocator()
@@ -1101,8 +1926,8 @@ func TestAllocatorThrottled(t *testing.T) {
 		simpleZoneConfig.Constraints,
 		[]roachpb.ReplicaDescriptor{},
 		false)
-	if _, ok := err.(purgatoryError); !ok {
-		t.Fatalf("expected a purgatory error, got: %v", err)
+	if pErr, ok := err.(purgatoryError); !ok || pErr.purgatoryClass() != purgatoryNoTarget {
+		t.Fatalf("expected a %s purgatory error, got: %v", purgatoryNoTarget, err)
 	}
 
 	// Second, test the normal case in which we can allocate to the store.
@@ -1118,21 +1943,22 @@ func TestAllocatorThrottled(t *testing.T) {
 		t.Errorf("expected NodeID 1 and StoreID 1: %+v", result)
 	}
 
-	// Finally, set that store to be throttled and ensure we don't send the
-	// replica to purgatory.
+	// Finally, set that store to be throttled and ensure we send the replica
+	// to purgatory as throttled.
 	a.storePool.mu.Lock()
 	storeDetail, ok := a.storePool.mu.storeDetails[singleStore[0].StoreID]
 	if !ok {
 		t.Fatalf("store:%d was not found in the store pool", singleStore[0].StoreID)
 	}
 	storeDetail.throttledUntil = timeutil.Now().Add(24 * time.Hour)
+	a.storePool.invalidateStoreListsLocked()
 	a.storePool.mu.Unlock()
 	_, err = a.AllocateTarget(
 		simpleZoneConfig.Constraints,
 		[]roachpb.ReplicaDescriptor{},
 		false)
-	if _, ok := err.(purgatoryError); ok {
-		t.Fatalf("expected a non purgatory error, got: %v", err)
+	if pErr, ok := err.(purgatoryError); !ok || pErr.purgatoryClass() != purgatoryStoreThrottled {
+		t.Fatalf("expected a %s purgatory error, got: %v", purgatoryStoreThrottled, err)
 	}
 }
 
@@ -1171,7 +1997,8 @@ func Example_rebalancing() {
 		g,
 		hlc.NewClock(hlc.UnixNano),
 		nil,
-		TestTimeUntilStoreDeadOff,
+		nil, /* nodeLivenessFn */
+		settings.TestingDurationSetting(TestTimeUntilStoreDeadOff),
 		stopper,
 	)
 	alloc := MakeAllocator(sp, AllocatorOptions{AllowRebalance: true, Deterministic: true})
@@ -24,7 +24,9 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 )
 
@@ -32,8 +34,73 @@ const allocatorRandomCount = 10
 
 type nodeIDSet map[roachpb.NodeID]struct{}
 
+// balancer is implemented by the strategies the allocator uses to choose
+// among candidate stores.
+type balancer interface {
+	selectGood(sl StoreList, excluded nodeIDSet) *roachpb.StoreDescriptor
+	selectBad(sl StoreList) *roachpb.StoreDescriptor
+	improve(sl StoreList, excluded nodeIDSet) *roachpb.StoreDescriptor
+	shouldRebalance(store roachpb.StoreDescriptor, sl StoreList) bool
+}
+
+var _ balancer = rangeCountBalancer{}
+var _ balancer = loadBalancer{}
+
+// RebalanceMode selects the statistic which the allocator attempts to even
+// out across stores.
+type RebalanceMode int
+
+const (
+	// RebalanceByRangeCount balances the number of replicas on each store.
+	RebalanceByRangeCount RebalanceMode = iota
+	// RebalanceByWriteLoad balances the write load (write batches per second)
+	// served by each store, moving replicas away from load hotspots.
+	RebalanceByWriteLoad
+	// RebalanceByLogicalBytes balances the logical bytes (the size of the keys
+	// and values) of the replicas on each store, which unlike balancing range
+	// counts evens out the data when range sizes differ widely.
+	RebalanceByLogicalBytes
+)
+
+// defaultRebalanceMode is the default of kv.allocator.rebalance_mode. It is
+// controlled by the COCKROACH_REBALANCE_MODE environment variable, which may
+// be set to "range-count", "write-load" or "logical-bytes". Unknown values
+// balance range counts.
+var defaultRebalanceMode = func() RebalanceMode {
+	switch mode := envutil.EnvOrDefaultString("COCKROACH_REBALANCE_MODE", "range-count"); mode {
+	case "range-count":
+		return RebalanceByRangeCount
+	case "write-load":
+		return RebalanceByWriteLoad
+	case "logical-bytes":
+		return RebalanceByLogicalBytes
+	default:
+		log.Warningf(context.TODO(), "unknown COCKROACH_REBALANCE_MODE %q, balancing range counts", mode)
+		return RebalanceByRangeCount
+	}
+}()
+
+// rebalanceMode is the RebalanceMode used by the allocator. Unknown values
+// balance range counts.
+var rebalanceMode = settings.RegisterIntSetting(
+	"kv.allocator.rebalance_mode",
+	"the statistic the allocator balances across stores "+
+		"(0 = range count, 1 = write load, 2 = logical bytes)",
+	int64(defaultRebalanceMode),
+)
+
 func formatCandidates(
 	selected *roachpb.StoreDescriptor, candidates []roachpb.StoreDescriptor,
+) string {
+	return formatCandidatesBy(selected, candidates, func(desc *roachpb.StoreDescriptor) string {
+		return fmt.Sprintf("%d", desc.Capacity.RangeCount)
+	})
+}
+
+func formatCandidatesBy(
+	selected *roachpb.StoreDescriptor,
+	candidates []roachpb.StoreDescriptor,
+	value func(*roachpb.StoreDescriptor) string,
 ) string {
 	var buf bytes.Buffer
 	_, _ = buf.WriteString("[")
@@ -42,7 +109,7 @@ func formatCandidates(
 		if i > 0 {
 			_, _ = buf.WriteString(" ")
 		}
-		fmt.Fprintf(&buf, "%d:%d", candidate.StoreID, candidate.Capacity.RangeCount)
+		fmt.Fprintf(&buf, "%d:%s", candidate.StoreID, value(candidate))
 		if candidate == selected {
 			_, _ = buf.WriteString("*")
 		}
@@ -124,7 +191,8 @@ func (rcb rangeCountBalancer) improve(sl StoreList, excluded nodeIDSet) *roachpb
 
 	// Adding a replica to the candidate must make its range count converge on the
 	// mean range count.
-	rebalanceConvergesOnMean := float64(candidate.Capacity.RangeCount) < sl.candidateCount.mean-0.5
+	rebalanceConvergesOnMean :=
+		float64(candidate.Capacity.RangeCount) < sl.candidateCount.mean-rangeCountDeviation.Get()
 	if !rebalanceConvergesOnMean {
 		if log.V(2) {
 			log.Infof(context.TODO(), "not rebalancing: %s wouldn't converge on the mean %.1f",
@@ -141,28 +209,53 @@ func (rcb rangeCountBalancer) improve(sl StoreList, excluded nodeIDSet) *roachpb
 }
 
 // RebalanceThreshold is the minimum ratio of a store's range surplus to the
-// mean range count that permits rebalances away from that store.
-var RebalanceThreshold = envutil.EnvOrDefaultFloat("COCKROACH_REBALANCE_THRESHOLD", 0.05)
+// mean range count that permits rebalances away from that store. It applies
+// to write loads and lease counts in the same way.
+var RebalanceThreshold = settings.RegisterFloatSetting(
+	"kv.allocator.rebalance_threshold",
+	"minimum fraction away from the mean a store's range count, write load or lease count must be "+
+		"for it to be considered overfull or underfull",
+	0.05,
+)
+
+// rangeCountDeviation is the number of ranges by which a store's range count
+// must exceed (fall short of) the mean for a replica to be moved off (onto)
+// it. The default of half a range only requires a move to make the range
+// counts converge on the mean, which matters in clusters with few ranges;
+// raising it dampens rebalancing between stores whose range counts are close.
+var rangeCountDeviation = settings.RegisterFloatSetting(
+	"kv.allocator.range_count_deviation",
+	"minimum number of ranges by which a store's range count must differ from the mean "+
+		"for replicas to be moved off or onto it",
+	0.5,
+)
 
 func (rangeCountBalancer) shouldRebalance(store roachpb.StoreDescriptor, sl StoreList) bool {
 	// TODO(peter,bram,cuong): The FractionUsed check seems suspicious. When a
 	// node becomes fuller than maxFractionUsedThreshold we will always select it
 	// for rebalancing. This is currently utilized by tests.
-	maxCapacityUsed := store.Capacity.FractionUsed() >= maxFractionUsedThreshold
+	maxCapacityUsed := store.Capacity.FractionUsed() >= maxFractionUsedThreshold.Get()
+
+	// The range counts are compared as moving averages so that a store isn't
+	// rebalanced away from on the strength of a single noisy sample. See
+	// kv.allocator.capacity_stats_half_life.
+	rangeCount := sl.smoothedRangeCount(store)
+	mean := sl.candidateSmoothedCount.mean
 
 	// Rebalance if we're above the rebalance target, which is
 	// mean*(1+RebalanceThreshold).
-	target := int32(math.Ceil(sl.candidateCount.mean * (1 + RebalanceThreshold)))
-	rangeCountAboveTarget := store.Capacity.RangeCount > target
+	threshold := RebalanceThreshold.Get()
+	target := int32(math.Ceil(mean * (1 + threshold)))
+	rangeCountAboveTarget := rangeCount > float64(target)
 
 	// Rebalance if the candidate store has a range count above the mean, and
 	// there exists another store that is underfull: its range count is smaller
 	// than mean*(1-RebalanceThreshold).
 	var rebalanceToUnderfullStore bool
-	if float64(store.Capacity.RangeCount) > sl.candidateCount.mean {
-		underfullThreshold := int32(math.Floor(sl.candidateCount.mean * (1 - RebalanceThreshold)))
+	if rangeCount > mean {
+		underfullThreshold := int32(math.Floor(mean * (1 - threshold)))
 		for _, desc := range sl.stores {
-			if desc.Capacity.RangeCount < underfullThreshold {
+			if sl.smoothedRangeCount(desc) < float64(underfullThreshold) {
 				rebalanceToUnderfullStore = true
 				break
 			}
@@ -172,21 +265,211 @@ func (rangeCountBalancer) shouldRebalance(store roachpb.StoreDescriptor, sl Stor
 	// Require that moving a replica from the given store makes its range count
 	// converge on the mean range count. This only affects clusters with a
 	// small number of ranges.
-	rebalanceConvergesOnMean := float64(store.Capacity.RangeCount) > sl.candidateCount.mean+0.5
+	rebalanceConvergesOnMean := rangeCount > mean+rangeCountDeviation.Get()
 
 	shouldRebalance :=
 		(maxCapacityUsed || rangeCountAboveTarget || rebalanceToUnderfullStore) && rebalanceConvergesOnMean
 	if log.V(2) {
 		log.Infof(context.TODO(),
-			"%d: should-rebalance=%t: fraction-used=%.2f range-count=%d "+
+			"%d: should-rebalance=%t: fraction-used=%.2f range-count=%.1f "+
 				"(mean=%.1f, target=%d, fraction-used=%t, above-target=%t, underfull=%t, converges=%t)",
 			store.StoreID, shouldRebalance, store.Capacity.FractionUsed(),
-			store.Capacity.RangeCount, sl.candidateCount.mean, target,
+			rangeCount, mean, target,
 			maxCapacityUsed, rangeCountAboveTarget, rebalanceToUnderfullStore, rebalanceConvergesOnMean)
 	}
 	return shouldRebalance
 }
 
+// minRebalanceWritesPerSecond is the mean write load below which the
+// write load balancer falls back to balancing range counts. Below this level
+// the measured rates are too noisy to be worth acting on.
+var minRebalanceWritesPerSecond = envutil.EnvOrDefaultFloat(
+	"COCKROACH_MIN_REBALANCE_WRITES_PER_SECOND", 10)
+
+// minRebalanceLogicalBytes is the mean logical bytes per store below which
+// the logical bytes balancer falls back to balancing range counts, as there
+// is too little data for moving it around to matter.
+var minRebalanceLogicalBytes = envutil.EnvOrDefaultFloat(
+	"COCKROACH_MIN_REBALANCE_LOGICAL_BYTES", 64<<20)
+
+// loadDimension is a per-store statistic which a loadBalancer evens out
+// across stores.
+type loadDimension struct {
+	name string
+	// value returns the store's value of the statistic.
+	value func(*roachpb.StoreDescriptor) float64
+	// mean returns the mean of the statistic over the candidate stores of the
+	// list.
+	mean func(StoreList) float64
+	// min is the mean below which the statistic is too small to balance on.
+	min float64
+	// format formats a value of the statistic for logging.
+	format func(float64) string
+}
+
+var writeLoadDimension = loadDimension{
+	name:   "writes-per-second",
+	value:  func(desc *roachpb.StoreDescriptor) float64 { return desc.Capacity.WritesPerSecond },
+	mean:   func(sl StoreList) float64 { return sl.candidateWrites.mean },
+	min:    minRebalanceWritesPerSecond,
+	format: func(v float64) string { return fmt.Sprintf("%.1f", v) },
+}
+
+var logicalBytesDimension = loadDimension{
+	name:   "logical-bytes",
+	value:  func(desc *roachpb.StoreDescriptor) float64 { return float64(desc.Capacity.LogicalBytes) },
+	mean:   func(sl StoreList) float64 { return sl.candidateLogicalBytes.mean },
+	min:    minRebalanceLogicalBytes,
+	format: func(v float64) string { return humanizeutil.IBytes(int64(v)) },
+}
+
+// loadBalancer attempts to balance a load dimension, such as the write load
+// served by each store, by moving replicas off of stores which have
+// considerably more of it than the mean. Ties, and clusters in which the
+// dimension is too small to matter, are handled by balancing range counts.
+type loadBalancer struct {
+	rangeCountBalancer
+	dim loadDimension
+}
+
+func (lb loadBalancer) formatCandidates(
+	selected *roachpb.StoreDescriptor, candidates []roachpb.StoreDescriptor,
+) string {
+	return formatCandidatesBy(selected, candidates, func(desc *roachpb.StoreDescriptor) string {
+		return lb.dim.format(lb.dim.value(desc))
+	})
+}
+
+// lessLoaded returns whether a has less load than b, breaking ties by range
+// count.
+func (lb loadBalancer) lessLoaded(a, b *roachpb.StoreDescriptor) bool {
+	if va, vb := lb.dim.value(a), lb.dim.value(b); va != vb {
+		return va < vb
+	}
+	return a.Capacity.RangeCount < b.Capacity.RangeCount
+}
+
+// idle returns whether the stores in the list have too little load to
+// balance on.
+func (lb loadBalancer) idle(sl StoreList) bool {
+	return lb.dim.mean(sl) < lb.dim.min
+}
+
+func (lb loadBalancer) selectBest(sl StoreList) *roachpb.StoreDescriptor {
+	var best *roachpb.StoreDescriptor
+	for i := range sl.stores {
+		candidate := &sl.stores[i]
+		if best == nil || lb.lessLoaded(candidate, best) {
+			best = candidate
+		}
+	}
+	return best
+}
+
+func (lb loadBalancer) selectGood(sl StoreList, excluded nodeIDSet) *roachpb.StoreDescriptor {
+	if lb.idle(sl) {
+		return lb.rangeCountBalancer.selectGood(sl, excluded)
+	}
+	sl.stores = selectRandom(lb.rand, allocatorRandomCount, sl, excluded)
+	good := lb.selectBest(sl)
+
+	if log.V(2) {
+		log.Infof(context.TODO(), "selected good: mean-%s=%s %s",
+			lb.dim.name, lb.dim.format(lb.dim.mean(sl)), lb.formatCandidates(good, sl.stores))
+	}
+	return good
+}
+
+func (lb loadBalancer) selectBad(sl StoreList) *roachpb.StoreDescriptor {
+	if lb.idle(sl) {
+		return lb.rangeCountBalancer.selectBad(sl)
+	}
+	var worst *roachpb.StoreDescriptor
+	for i := range sl.stores {
+		candidate := &sl.stores[i]
+		if worst == nil || lb.lessLoaded(worst, candidate) {
+			worst = candidate
+		}
+	}
+
+	if log.V(2) {
+		log.Infof(context.TODO(), "selected bad: mean-%s=%s %s",
+			lb.dim.name, lb.dim.format(lb.dim.mean(sl)), lb.formatCandidates(worst, sl.stores))
+	}
+	return worst
+}
+
+// improve returns a candidate StoreDescriptor to rebalance a replica to. The
+// candidate must have less load than the mean by more than
+// RebalanceThreshold; otherwise no candidate is returned.
+func (lb loadBalancer) improve(sl StoreList, excluded nodeIDSet) *roachpb.StoreDescriptor {
+	if lb.idle(sl) {
+		return lb.rangeCountBalancer.improve(sl, excluded)
+	}
+	sl.stores = selectRandom(lb.rand, allocatorRandomCount, sl, excluded)
+	candidate := lb.selectBest(sl)
+	if candidate == nil {
+		if log.V(2) {
+			log.Infof(context.TODO(), "not rebalancing: no valid candidate targets: %s",
+				lb.formatCandidates(nil, sl.stores))
+		}
+		return nil
+	}
+
+	mean := lb.dim.mean(sl)
+	underfullThreshold := mean * (1 - RebalanceThreshold.Get())
+	if lb.dim.value(candidate) >= underfullThreshold {
+		if log.V(2) {
+			log.Infof(context.TODO(), "not rebalancing: %s isn't below the %s threshold %s",
+				lb.formatCandidates(candidate, sl.stores), lb.dim.name, lb.dim.format(underfullThreshold))
+		}
+		return nil
+	}
+
+	if log.V(2) {
+		log.Infof(context.TODO(), "rebalancing: mean-%s=%s %s",
+			lb.dim.name, lb.dim.format(mean), lb.formatCandidates(candidate, sl.stores))
+	}
+	return candidate
+}
+
+func (lb loadBalancer) shouldRebalance(store roachpb.StoreDescriptor, sl StoreList) bool {
+	if lb.idle(sl) {
+		return lb.rangeCountBalancer.shouldRebalance(store, sl)
+	}
+
+	maxCapacityUsed := store.Capacity.FractionUsed() >= maxFractionUsedThreshold.Get()
+
+	// Rebalance if the store is a hotspot: its load is above
+	// mean*(1+RebalanceThreshold) and there exists another store whose load is
+	// below mean*(1-RebalanceThreshold) which can absorb some of it.
+	mean := lb.dim.mean(sl)
+	threshold := RebalanceThreshold.Get()
+	target := mean * (1 + threshold)
+	value := lb.dim.value(&store)
+	aboveTarget := value > target
+
+	var underloadedStore bool
+	underloadedThreshold := mean * (1 - threshold)
+	for i := range sl.stores {
+		if lb.dim.value(&sl.stores[i]) < underloadedThreshold {
+			underloadedStore = true
+			break
+		}
+	}
+
+	shouldRebalance := maxCapacityUsed || (aboveTarget && underloadedStore)
+	if log.V(2) {
+		log.Infof(context.TODO(),
+			"%d: should-rebalance=%t: fraction-used=%.2f %s=%s "+
+				"(mean=%s, target=%s, fraction-used=%t, above-target=%t, underloaded=%t)",
+			store.StoreID, shouldRebalance, store.Capacity.FractionUsed(),
+			lb.dim.name, lb.dim.format(value), lb.dim.format(mean), lb.dim.format(target),
+			maxCapacityUsed, aboveTarget, underloadedStore)
+	}
+	return shouldRebalance
+}
+
 // selectRandom chooses up to count random store descriptors from the given
 // store list, excluding any stores that are too full to accept more replicas.
 func selectRandom(
@@ -204,7 +487,7 @@ func selectRandom(
 		}
 
 		// Don't overfill stores.
-		if desc.Capacity.FractionUsed() > maxFractionUsedThreshold {
+		if desc.Capacity.FractionUsed() > maxFractionUsedThreshold.Get() {
 			continue
 		}
 
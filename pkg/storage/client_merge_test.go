@@ -22,6 +22,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -365,6 +366,54 @@ func TestStoreRangeMergeNonCollocated(t *testing.T) {
 	}
 }
 
+// TestStoreRangeMergeStickySplit verifies that ranges which start at a
+// sticky split point are not merged until the sticky bit expires.
+func TestStoreRangeMergeStickySplit(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	storeCfg := storage.TestStoreConfig()
+	storeCfg.TestingKnobs.DisableSplitQueue = true
+	store, stopper, manual := createTestStoreWithConfig(t, storeCfg)
+	defer stopper.Stop()
+
+	// Split the range at "b", without a sticky bit.
+	if _, _, err := createSplitRanges(store); err != nil {
+		t.Fatal(err)
+	}
+	if desc := store.LookupReplica([]byte("c"), nil).Desc(); desc.StickyBit != nil {
+		t.Fatalf("expected no sticky bit, got %s", desc.StickyBit)
+	}
+
+	// Mark the existing split point as sticky. Doing so again without
+	// extending the sticky bit fails.
+	expiration := store.Clock().Now().Add(time.Hour.Nanoseconds(), 0)
+	splitArgs := adminSplitArgs(roachpb.KeyMin, []byte("b"))
+	splitArgs.Sticky = true
+	splitArgs.ExpirationTime = expiration
+	if _, pErr := client.SendWrapped(context.Background(), rg1(store), &splitArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+	if desc := store.LookupReplica([]byte("c"), nil).Desc(); desc.StickyBit == nil || !desc.StickyBit.Equal(expiration) {
+		t.Fatalf("expected sticky bit %s, got %v", expiration, desc.StickyBit)
+	}
+	if _, pErr := client.SendWrapped(context.Background(), rg1(store), &splitArgs); !testutils.IsPError(pErr, "range is already split") {
+		t.Fatalf("expected 'range is already split' error; got %v", pErr)
+	}
+
+	mergeArgs := adminMergeArgs(roachpb.KeyMin)
+	if _, pErr := client.SendWrapped(context.Background(), rg1(store), &mergeArgs); !testutils.IsPError(pErr, "sticky split point") {
+		t.Fatalf("expected 'sticky split point' error; got %v", pErr)
+	}
+
+	// Once the sticky bit expired, the ranges can be merged.
+	manual.Increment(time.Hour.Nanoseconds() + 1)
+	if _, pErr := client.SendWrapped(context.Background(), rg1(store), &mergeArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+	if a, c := store.LookupReplica([]byte("a"), nil), store.LookupReplica([]byte("c"), nil); a != c {
+		t.Fatalf("ranges were not merged %s!=%s", a, c)
+	}
+}
+
 // TestStoreRangeMergeStats starts by splitting a range, then writing random data
 // to both sides of the split. It then merges the ranges and verifies the merged
 // range has stats consistent with recomputations.
@@ -37,8 +37,10 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
 	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util"
@@ -1818,10 +1820,7 @@ func TestStoreRangeRebalance(t *testing.T) {
 
 	// TODO(peter,bram): clean up this test so this isn't required and unexport
 	// storage.RebalanceThreshold.
-	defer func(threshold float64) {
-		storage.RebalanceThreshold = threshold
-	}(storage.RebalanceThreshold)
-	storage.RebalanceThreshold = 0
+	defer settings.TestingSetFloat(storage.RebalanceThreshold, 0)()
 
 	// Start multiTestContext with replica rebalancing enabled.
 	sc := storage.TestStoreConfig()
@@ -2408,6 +2407,90 @@ func TestCheckConsistencyMultiStore(t *testing.T) {
 	}
 }
 
+// TestDiscardPoisonedEntryRangeWide verifies that discarding a poisoned raft
+// entry through one replica resumes the range on all of its replicas.
+func TestDiscardPoisonedEntryRangeWide(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer storage.SetCommandContainmentEnabled(true)()
+
+	poisonKey := roachpb.Key("poison")
+	var poison int32 = 1
+	sc := storage.TestStoreConfig()
+	sc.TestingKnobs.TestingCommandFilter = func(filterArgs storagebase.FilterArgs) *roachpb.Error {
+		if filterArgs.CmdID != "" && filterArgs.Req.Header().Key.Equal(poisonKey) &&
+			atomic.LoadInt32(&poison) == 1 {
+			panic("poisoned command")
+		}
+		return nil
+	}
+	const numStores = 3
+	mtc := &multiTestContext{storeConfig: &sc}
+	mtc.Start(t, numStores)
+	defer mtc.Stop()
+	mtc.replicateRange(1, 1, 2)
+
+	errCh := make(chan *roachpb.Error, 1)
+	go func() {
+		pArgs := putArgs(poisonKey, []byte("value"))
+		_, pErr := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &pArgs)
+		errCh <- pErr
+	}()
+
+	var entries [numStores]*storage.PoisonedEntry
+	util.SucceedsSoon(t, func() error {
+		for i, s := range mtc.stores {
+			repl, err := s.GetReplica(1)
+			if err != nil {
+				return err
+			}
+			if entries[i] = repl.PoisonedEntry(); entries[i] == nil {
+				return errors.Errorf("range not halted on store %d yet", s.StoreID())
+			}
+		}
+		return nil
+	})
+	index := entries[0].Index
+	for i, entry := range entries {
+		if entry.Index != index {
+			t.Fatalf("store %d halted on raft entry %d, expected %d", i, entry.Index, index)
+		}
+	}
+
+	atomic.StoreInt32(&poison, 0)
+	repl, err := mtc.stores[0].GetReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repl.DiscardPoisonedEntry(context.Background(), index, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if pErr := <-errCh; !testutils.IsPError(pErr, "was discarded") {
+		t.Fatalf("expected the poisoned command to be discarded, got %v", pErr)
+	}
+	for i, s := range mtc.stores {
+		repl, err := s.GetReplica(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry := repl.PoisonedEntry(); entry != nil {
+			t.Fatalf("store %d is still halted on %+v", i, entry)
+		}
+	}
+
+	// The range isn't halted anymore, so there is nothing left to discard.
+	if _, err := repl.DiscardPoisonedEntry(context.Background(), index, "test"); !testutils.IsError(err, "not halted") {
+		t.Fatalf("expected the range not to be halted, got %v", err)
+	}
+
+	// All replicas apply commands again.
+	key := roachpb.Key("a")
+	incArgs := incrementArgs(key, 5)
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+		t.Fatal(err)
+	}
+	mtc.waitForValues(key, []int64{5, 5, 5})
+}
+
 func TestCheckInconsistent(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -2491,6 +2574,68 @@ func TestCheckInconsistent(t *testing.T) {
 	}
 }
 
+// TestCheckConsistencyRepairsStats verifies that a consistency check which
+// only finds diverged MVCCStats repairs them in place.
+func TestCheckConsistencyRepairsStats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	const numStores = 3
+	mtc := startMultiTestContext(t, numStores)
+	defer mtc.Stop()
+	// Setup replication of range 1 on store 0 to stores 1 and 2.
+	mtc.replicateRange(1, 1, 2)
+
+	incArgs := incrementArgs([]byte("a"), 5)
+	if _, err := client.SendWrapped(context.Background(), rg1(mtc.stores[0]), &incArgs); err != nil {
+		t.Fatal(err)
+	}
+	mtc.waitForValues(roachpb.Key("a"), []int64{5, 5, 5})
+
+	// Corrupt the persisted stats of the replica on store 1.
+	ctx := context.Background()
+	var ms enginepb.MVCCStats
+	if err := engine.MVCCGetRangeStats(ctx, mtc.stores[1].Engine(), 1, &ms); err != nil {
+		t.Fatal(err)
+	}
+	ms.LiveBytes += 1000
+	ms.KeyCount += 10
+	if err := engine.MVCCSetRangeStats(ctx, mtc.stores[1].Engine(), 1, &ms); err != nil {
+		t.Fatal(err)
+	}
+
+	checkArgs := roachpb.CheckConsistencyRequest{
+		Span: roachpb.Span{
+			Key:    []byte("a"),
+			EndKey: []byte("z"),
+		},
+	}
+	if _, err := client.SendWrapped(ctx, rg1(mtc.stores[0]), &checkArgs); err != nil {
+		t.Fatal(err)
+	}
+	if c := mtc.stores[0].Metrics().RangeStatsRepairs.Count(); c != 1 {
+		t.Fatalf("expected 1 stats repair, got %d", c)
+	}
+
+	// Store 1 recomputed its stats when applying the repair.
+	util.SucceedsSoon(t, func() error {
+		r, err := mtc.stores[1].GetReplica(1)
+		if err != nil {
+			return err
+		}
+		if err := engine.MVCCGetRangeStats(ctx, mtc.stores[1].Engine(), 1, &ms); err != nil {
+			return err
+		}
+		expMS, err := storage.ComputeStatsForRange(r.Desc(), mtc.stores[1].Engine(), ms.LastUpdateNanos)
+		if err != nil {
+			return err
+		}
+		if ms.LiveBytes != expMS.LiveBytes || ms.KeyCount != expMS.KeyCount {
+			return errors.Errorf("expected stats %+v, got %+v", expMS, ms)
+		}
+		return nil
+	})
+}
+
 func TestTransferRaftLeadership(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -2592,6 +2737,41 @@ func TestFailedPreemptiveSnapshot(t *testing.T) {
 	}
 }
 
+// TestFailedPreemptiveSnapshotToSomeTargets verifies that when a range adds
+// several replicas, the targets which received their preemptive snapshot
+// are added even though the snapshot to another one failed, and that the
+// failure is reported.
+func TestFailedPreemptiveSnapshotToSomeTargets(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	mtc := startMultiTestContext(t, 3)
+	defer mtc.Stop()
+
+	// Replicate the range onto two stores so that it keeps its quorum.
+	mtc.replicateRange(1, 1)
+
+	rep, err := mtc.stores[0].GetReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The snapshot to store 4 fails: there is no such store.
+	targets := []roachpb.ReplicaDescriptor{
+		{NodeID: 4, StoreID: 4},
+		{NodeID: 3, StoreID: 3},
+	}
+	const expErr = "1 of 2 replicas not added: .*unknown peer 4"
+	if err := rep.AddReplicas(context.Background(), targets, rep.Desc()); !testutils.IsError(err, expErr) {
+		t.Fatalf("expected %s; got %v", expErr, err)
+	}
+	desc := rep.Desc()
+	if _, ok := desc.GetReplicaDescriptor(3); !ok {
+		t.Errorf("expected a replica on store 3 in %+v", desc)
+	}
+	if _, ok := desc.GetReplicaDescriptor(4); ok {
+		t.Errorf("expected no replica on store 4 in %+v", desc)
+	}
+}
+
 // Test that a single blocked replica does not block other replicas.
 func TestRaftBlockedReplica(t *testing.T) {
 	defer leaktest.AfterTest(t)()
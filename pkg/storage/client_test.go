@@ -52,6 +52,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/kv"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlbase"
 	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
@@ -146,7 +147,8 @@ func createTestStoreWithEngine(
 		storeCfg.Gossip,
 		clock,
 		rpcContext,
-		storage.TestTimeUntilStoreDeadOff,
+		nil, /* nodeLivenessFn */
+		settings.TestingDurationSetting(storage.TestTimeUntilStoreDeadOff),
 		stopper,
 	)
 	storeCfg.Transport = storage.NewDummyRaftTransport()
@@ -565,12 +567,16 @@ func (m *multiTestContext) FirstRange() (*roachpb.RangeDescriptor, error) {
 // RangeLookup implements the RangeDescriptorDB interface. It looks up the
 // descriptors for the given (meta) key.
 func (m *multiTestContext) RangeLookup(
-	ctx context.Context, key roachpb.RKey, desc *roachpb.RangeDescriptor, useReverseScan bool,
+	ctx context.Context,
+	key roachpb.RKey,
+	desc *roachpb.RangeDescriptor,
+	useReverseScan bool,
+	readUncommitted bool,
 ) ([]roachpb.RangeDescriptor, []roachpb.RangeDescriptor, *roachpb.Error) {
 	// DistSender's RangeLookup function will work correctly, as long as
 	// multiTestContext's FirstRange() method returns the correct descriptor for the
 	// first range.
-	return m.distSenders[0].RangeLookup(ctx, key, desc, useReverseScan)
+	return m.distSenders[0].RangeLookup(ctx, key, desc, useReverseScan, readUncommitted)
 }
 
 func (m *multiTestContext) makeStoreConfig(i int) storage.StoreConfig {
@@ -612,7 +618,8 @@ func (m *multiTestContext) populateStorePool(idx int, stopper *stop.Stopper) {
 		m.gossips[idx],
 		m.clock,
 		m.rpcContext,
-		m.timeUntilStoreDead,
+		nil, /* nodeLivenessFn */
+		settings.TestingDurationSetting(m.timeUntilStoreDead),
 		stopper,
 	)
 }
@@ -723,6 +730,10 @@ func (m *multiTestContext) addStore(idx int) {
 	storesServer := storage.MakeServer(m.nodeDesc(nodeID), stores)
 	storage.RegisterConsistencyServer(grpcServer, storesServer)
 	storage.RegisterFreezeServer(grpcServer, storesServer)
+	storage.RegisterStoreJobsServer(grpcServer, storesServer)
+	storage.RegisterStoreAttributesServer(grpcServer, storesServer)
+	storage.RegisterRaftRepairServer(grpcServer, storesServer)
+	storage.RegisterStoreQueuesServer(grpcServer, storesServer)
 
 	// Add newly created objects to the multiTestContext's collections.
 	// (these must be populated before the store is started so that
@@ -16,13 +16,22 @@
 
 package engine
 
-import "github.com/cockroachdb/cockroach/pkg/util/hlc"
+import (
+	"encoding/binary"
 
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+)
+
+// The types of the records of a RocksDB batch representation.
 const (
-	batchTypeDeletion byte = 0x0
-	batchTypeValue         = 0x1
-	batchTypeMerge         = 0x2
+	BatchTypeDeletion byte = 0x0
+	BatchTypeValue    byte = 0x1
+	BatchTypeMerge    byte = 0x2
+)
 
+const (
 	// The batch header is composed of an 8-byte sequence number (all zeroes) and
 	// 4-byte count of the number of entries in the batch.
 	headerSize       int = 12
@@ -51,8 +60,8 @@ const (
 //      data: uint8[len]
 //
 // The rocksDBBatchBuilder code currently only supports kTypeValue
-// (batchTypeValue), kTypeDeletion (batchTypeDeletion)and kTypeMerge
-// (batchTypeMerge) operations. Before a batch is written to the RocksDB
+// (BatchTypeValue), kTypeDeletion (BatchTypeDeletion)and kTypeMerge
+// (BatchTypeMerge) operations. Before a batch is written to the RocksDB
 // write-ahead-log, the sequence number is 0. The "fixed32" format is little
 // endian.
 //
@@ -193,11 +202,11 @@ func (b *rocksDBBatchBuilder) encodeKeyValue(key MVCCKey, value []byte, tag byte
 }
 
 func (b *rocksDBBatchBuilder) Put(key MVCCKey, value []byte) {
-	b.encodeKeyValue(key, value, batchTypeValue)
+	b.encodeKeyValue(key, value, BatchTypeValue)
 }
 
 func (b *rocksDBBatchBuilder) Merge(key MVCCKey, value []byte) {
-	b.encodeKeyValue(key, value, batchTypeMerge)
+	b.encodeKeyValue(key, value, BatchTypeMerge)
 }
 
 func (b *rocksDBBatchBuilder) Clear(key MVCCKey) {
@@ -205,5 +214,123 @@ func (b *rocksDBBatchBuilder) Clear(key MVCCKey) {
 	b.count++
 	pos := len(b.repr)
 	b.encodeKey(key, 0)
-	b.repr[pos] = batchTypeDeletion
+	b.repr[pos] = BatchTypeDeletion
+}
+
+// A RocksDBBatchReader iterates over the records of a RocksDB batch
+// representation, as built by rocksDBBatchBuilder. Only the record types it
+// builds are supported.
+type RocksDBBatchReader struct {
+	repr  []byte
+	count int
+	err   error
+
+	typ   byte
+	key   MVCCKey
+	value []byte
+}
+
+// NewRocksDBBatchReader creates a RocksDBBatchReader for the given batch
+// representation. Call Next before reading the first record.
+func NewRocksDBBatchReader(repr []byte) (*RocksDBBatchReader, error) {
+	if len(repr) < headerSize {
+		return nil, errors.Errorf("batch representation too small: %d < %d", len(repr), headerSize)
+	}
+	return &RocksDBBatchReader{
+		repr:  repr[headerSize:],
+		count: int(binary.LittleEndian.Uint32(repr[8:headerSize])),
+	}, nil
+}
+
+// Next advances the reader to the next record, returning false once the
+// records are exhausted or an error occurred; see Error.
+func (r *RocksDBBatchReader) Next() bool {
+	if r.err != nil || r.count == 0 {
+		return false
+	}
+	r.count--
+	if len(r.repr) == 0 {
+		r.err = errors.New("batch representation truncated")
+		return false
+	}
+	r.typ = r.repr[0]
+	r.repr = r.repr[1:]
+	var rawKey []byte
+	if rawKey, r.err = r.varstring(); r.err != nil {
+		return false
+	}
+	if r.key, r.err = decodeMVCCKey(rawKey); r.err != nil {
+		return false
+	}
+	switch r.typ {
+	case BatchTypeDeletion:
+		r.value = nil
+	case BatchTypeValue, BatchTypeMerge:
+		if r.value, r.err = r.varstring(); r.err != nil {
+			return false
+		}
+	default:
+		r.err = errors.Errorf("unexpected batch record type %d", r.typ)
+		return false
+	}
+	return true
+}
+
+// BatchType returns the type of the current record: BatchTypeDeletion,
+// BatchTypeValue or BatchTypeMerge.
+func (r *RocksDBBatchReader) BatchType() byte {
+	return r.typ
+}
+
+// Key returns the key of the current record. The key points into the batch
+// representation.
+func (r *RocksDBBatchReader) Key() MVCCKey {
+	return r.key
+}
+
+// Value returns the value of the current record, which is nil for
+// deletions. The value points into the batch representation.
+func (r *RocksDBBatchReader) Value() []byte {
+	return r.value
+}
+
+// Error returns the error, if any, which stopped the iteration.
+func (r *RocksDBBatchReader) Error() error {
+	return r.err
+}
+
+func (r *RocksDBBatchReader) varstring() ([]byte, error) {
+	n, l := binary.Uvarint(r.repr)
+	if l <= 0 || uint64(len(r.repr)-l) < n {
+		return nil, errors.New("batch representation truncated")
+	}
+	s := r.repr[l : l+int(n)]
+	r.repr = r.repr[l+int(n):]
+	return s, nil
+}
+
+// decodeMVCCKey decodes an MVCC key encoded by
+// rocksDBBatchBuilder.encodeKey.
+func decodeMVCCKey(buf []byte) (MVCCKey, error) {
+	if len(buf) == 0 {
+		return MVCCKey{}, errors.New("empty MVCC key")
+	}
+	tsLen := int(buf[len(buf)-1])
+	keyLen := len(buf) - 1 - tsLen
+	if keyLen < 0 {
+		return MVCCKey{}, errors.Errorf("invalid MVCC key: %x", buf)
+	}
+	key := MVCCKey{Key: buf[:keyLen]}
+	ts := buf[keyLen : len(buf)-1]
+	switch len(ts) {
+	case 0:
+	case 1 + 8, 1 + 8 + 4:
+		key.Timestamp.WallTime = int64(binary.BigEndian.Uint64(ts[1:]))
+		if len(ts) > 1+8 {
+			key.Timestamp.Logical = int32(binary.BigEndian.Uint32(ts[1+8:]))
+		}
+	default:
+		return MVCCKey{}, errors.Errorf("invalid MVCC key timestamp length %d", len(ts))
+	}
+	return key, nil
 }
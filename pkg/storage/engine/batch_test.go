@@ -125,6 +125,63 @@ func TestBatchBasics(t *testing.T) {
 	})
 }
 
+func TestRocksDBBatchReader(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	e := NewInMem(roachpb.Attributes{}, 1<<20, stopper)
+
+	b := e.NewBatch()
+	defer b.Close()
+
+	type record struct {
+		typ   byte
+		key   MVCCKey
+		value []byte
+	}
+	expected := []record{
+		{BatchTypeValue, mvccKey("a"), []byte("value")},
+		{BatchTypeValue, MVCCKey{Key: roachpb.Key("b"), Timestamp: hlc.Timestamp{WallTime: 1}}, []byte("value")},
+		{BatchTypeValue, MVCCKey{Key: roachpb.Key("c"), Timestamp: hlc.Timestamp{WallTime: 2, Logical: 3}}, []byte{}},
+		{BatchTypeDeletion, mvccKey("d"), nil},
+		{BatchTypeMerge, mvccKey("e"), appender("bar")},
+	}
+	for _, r := range expected {
+		var err error
+		switch r.typ {
+		case BatchTypeValue:
+			err = b.Put(r.key, r.value)
+		case BatchTypeDeletion:
+			err = b.Clear(r.key)
+		case BatchTypeMerge:
+			err = b.Merge(r.key, r.value)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader, err := NewRocksDBBatchReader(b.Repr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []record
+	for reader.Next() {
+		records = append(records, record{reader.BatchType(), reader.Key(), reader.Value()})
+	}
+	if err := reader.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, records) {
+		t.Fatalf("expected %v, but got %v", expected, records)
+	}
+
+	if _, err := NewRocksDBBatchReader(nil); err == nil {
+		t.Fatal("expected an error reading an empty batch representation")
+	}
+}
+
 func TestBatchRepr(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	testBatchBasics(t, func(e Engine, b Batch) error {
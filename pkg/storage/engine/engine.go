@@ -171,6 +171,16 @@ type Engine interface {
 	Flush() error
 	// GetStats retrieves stats from the engine.
 	GetStats() (*Stats, error)
+	// GetAuxiliaryDir returns a directory, next to the engine's data, in
+	// which temporary files such as SSTables to be ingested can be written.
+	// The directory may not exist yet. It is empty for in-memory engines.
+	GetAuxiliaryDir() string
+	// IngestExternalFile links the sstable at the given path, as written by a
+	// RocksDBSstFileWriter, into the engine. Its keys shadow the ones already
+	// in the engine, including those deleted by committed batches. The file
+	// is copied, and may be removed once ingested. In-memory engines don't
+	// support ingestion.
+	IngestExternalFile(path string) error
 	// NewBatch returns a new instance of a batched engine which wraps
 	// this engine. Batched engines accumulate all mutations and apply
 	// them atomically on a call to Commit().
@@ -50,6 +50,27 @@ func (ms MVCCStats) GCByteAge(nowNanos int64) int64 {
 	return ms.GCBytesAge
 }
 
+// AvgGCBytesAge returns the average age, in seconds, of the outstanding
+// gc'able bytes, based on current wall time specified via nowNanos. It
+// estimates how long ago the garbage was created.
+func (ms MVCCStats) AvgGCBytesAge(nowNanos int64) float64 {
+	gcBytes := ms.GCBytes()
+	if gcBytes <= 0 {
+		return 0
+	}
+	return float64(ms.GCByteAge(nowNanos)) / float64(gcBytes)
+}
+
+// GCByteFraction returns the fraction of the key and value bytes which are
+// gc'able, i.e. not live.
+func (ms MVCCStats) GCByteFraction() float64 {
+	total := ms.Total()
+	if total <= 0 {
+		return 0
+	}
+	return float64(ms.GCBytes()) / float64(total)
+}
+
 // AgeTo encapsulates the complexity of computing the increment in age
 // quantities contained in MVCCStats. Two MVCCStats structs only add and
 // subtract meaningfully if their LastUpdateNanos matches, so aging them to
@@ -1477,9 +1477,26 @@ func getReverseScanMeta(
 	return metaKey, nil
 }
 
+// IteratorStats counts the keys an MVCC scan surfaced and the keys it
+// stepped over because they had no value visible at the scan's timestamp:
+// their visible version is a deletion tombstone, or all their versions are
+// more recent than the scan. Many skipped keys for each surfaced one
+// indicate that the scan is slowed down by MVCC garbage which hasn't been
+// garbage collected yet.
+type IteratorStats struct {
+	KeysSurfaced int64
+	KeysSkipped  int64
+}
+
+// Add adds the counts of other to the stats.
+func (s *IteratorStats) Add(other IteratorStats) {
+	s.KeysSurfaced += other.KeysSurfaced
+	s.KeysSkipped += other.KeysSkipped
+}
+
 // mvccScanInternal scans the key range [start,end) up to some maximum number
 // of results. Specify reverse=true to scan in descending instead of ascending
-// order.
+// order. If stats is not nil, the keys surfaced and skipped are added to it.
 func mvccScanInternal(
 	ctx context.Context,
 	engine Reader,
@@ -1490,6 +1507,7 @@ func mvccScanInternal(
 	consistent bool,
 	txn *roachpb.Transaction,
 	reverse bool,
+	stats *IteratorStats,
 ) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
 	var res []roachpb.KeyValue
 	if max == 0 {
@@ -1497,7 +1515,7 @@ func mvccScanInternal(
 	}
 
 	var resumeSpan *roachpb.Span
-	intents, err := MVCCIterate(ctx, engine, key, endKey, timestamp, consistent, txn, reverse,
+	intents, err := mvccIterateInternal(ctx, engine, key, endKey, timestamp, consistent, txn, reverse, stats,
 		func(kv roachpb.KeyValue) (bool, error) {
 			if int64(len(res)) == max {
 				// Another key was found beyond the max limit.
@@ -1532,7 +1550,24 @@ func MVCCScan(
 	txn *roachpb.Transaction,
 ) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
 	return mvccScanInternal(ctx, engine, key, endKey, max, timestamp,
-		consistent, txn, false /* !reverse */)
+		consistent, txn, false /* !reverse */, nil /* stats */)
+}
+
+// MVCCScanWithStats is like MVCCScan, but also adds the number of keys it
+// surfaced and skipped to the given stats.
+func MVCCScanWithStats(
+	ctx context.Context,
+	engine Reader,
+	key,
+	endKey roachpb.Key,
+	max int64,
+	timestamp hlc.Timestamp,
+	consistent bool,
+	txn *roachpb.Transaction,
+	stats *IteratorStats,
+) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
+	return mvccScanInternal(ctx, engine, key, endKey, max, timestamp,
+		consistent, txn, false /* !reverse */, stats)
 }
 
 // MVCCReverseScan scans the key range [start,end) key up to some maximum
@@ -1549,7 +1584,24 @@ func MVCCReverseScan(
 	txn *roachpb.Transaction,
 ) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
 	return mvccScanInternal(ctx, engine, key, endKey, max, timestamp,
-		consistent, txn, true /* reverse */)
+		consistent, txn, true /* reverse */, nil /* stats */)
+}
+
+// MVCCReverseScanWithStats is like MVCCReverseScan, but also adds the number
+// of keys it surfaced and skipped to the given stats.
+func MVCCReverseScanWithStats(
+	ctx context.Context,
+	engine Reader,
+	key,
+	endKey roachpb.Key,
+	max int64,
+	timestamp hlc.Timestamp,
+	consistent bool,
+	txn *roachpb.Transaction,
+	stats *IteratorStats,
+) ([]roachpb.KeyValue, *roachpb.Span, []roachpb.Intent, error) {
+	return mvccScanInternal(ctx, engine, key, endKey, max, timestamp,
+		consistent, txn, true /* reverse */, stats)
 }
 
 // MVCCIterate iterates over the key range [start,end). At each step of the
@@ -1566,6 +1618,24 @@ func MVCCIterate(
 	txn *roachpb.Transaction,
 	reverse bool,
 	f func(roachpb.KeyValue) (bool, error),
+) ([]roachpb.Intent, error) {
+	return mvccIterateInternal(ctx, engine, startKey, endKey, timestamp, consistent, txn, reverse,
+		nil /* stats */, f)
+}
+
+// mvccIterateInternal implements MVCCIterate. If stats is not nil, the keys
+// surfaced and skipped are added to it.
+func mvccIterateInternal(
+	ctx context.Context,
+	engine Reader,
+	startKey,
+	endKey roachpb.Key,
+	timestamp hlc.Timestamp,
+	consistent bool,
+	txn *roachpb.Transaction,
+	reverse bool,
+	stats *IteratorStats,
+	f func(roachpb.KeyValue) (bool, error),
 ) ([]roachpb.Intent, error) {
 	if !consistent && txn != nil {
 		return nil, errors.Errorf("cannot allow inconsistent reads within a transaction")
@@ -1645,6 +1715,13 @@ func MVCCIterate(
 		value, newIntents, valueSafety, err := mvccGetInternal(
 			ctx, iter, metaKey, timestamp, consistent, unsafeValue, txn, buf)
 		intents = append(intents, newIntents...)
+		if stats != nil && err == nil {
+			if value != nil {
+				stats.KeysSurfaced++
+			} else {
+				stats.KeysSkipped++
+			}
+		}
 		if value != nil {
 			if valueSafety == unsafeValue {
 				// Copy the unsafe value into our allocation buffer.
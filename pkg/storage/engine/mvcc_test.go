@@ -1319,6 +1319,59 @@ func TestMVCCScanWithKeyPrefix(t *testing.T) {
 	}
 }
 
+// TestMVCCScanWithStats verifies that scans count the keys they surface and
+// the keys they skip for lack of a visible value.
+func TestMVCCScanWithStats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	engine := createTestEngine(stopper)
+
+	// "/a" is live, "/b" is deleted, "/c" was written after the scans' timestamp
+	// and "/d" is live again after having been deleted.
+	for _, kv := range []struct {
+		key     string
+		ts      int64
+		deleted bool
+	}{
+		{"/a", 1, false},
+		{"/b", 1, false},
+		{"/b", 2, true},
+		{"/c", 4, false},
+		{"/d", 1, true},
+		{"/d", 2, false},
+	} {
+		var err error
+		if kv.deleted {
+			err = MVCCDelete(context.Background(), engine, nil, roachpb.Key(kv.key), makeTS(kv.ts, 0), nil)
+		} else {
+			err = MVCCPut(context.Background(), engine, nil, roachpb.Key(kv.key), makeTS(kv.ts, 0), value1, nil)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, reverse := range []bool{false, true} {
+		var stats IteratorStats
+		scan := MVCCScanWithStats
+		if reverse {
+			scan = MVCCReverseScanWithStats
+		}
+		kvs, _, _, err := scan(context.Background(), engine, roachpb.Key("/a"), roachpb.Key("/e"),
+			math.MaxInt64, makeTS(3, 0), true, nil, &stats)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kvs) != 2 {
+			t.Errorf("reverse=%t: expected 2 keys, got %v", reverse, kvs)
+		}
+		if e := (IteratorStats{KeysSurfaced: 2, KeysSkipped: 2}); stats != e {
+			t.Errorf("reverse=%t: expected %+v, got %+v", reverse, e, stats)
+		}
+	}
+}
+
 func TestMVCCScanInTxn(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	stopper := stop.NewStopper()
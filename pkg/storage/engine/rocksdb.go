@@ -566,6 +566,22 @@ func (r *RocksDB) Checkpoint(dir string) error {
 	return statusToError(C.DBCheckpoint(r.rdb, goToCSlice([]byte(dir))))
 }
 
+// GetAuxiliaryDir returns the "auxiliary" subdirectory of the data directory.
+func (r *RocksDB) GetAuxiliaryDir() string {
+	if len(r.dir) == 0 {
+		return ""
+	}
+	return filepath.Join(r.dir, "auxiliary")
+}
+
+// IngestExternalFile links the sstable at the given path into the engine.
+func (r *RocksDB) IngestExternalFile(path string) error {
+	if len(r.dir) == 0 {
+		return errors.Errorf("unable to ingest a file into in-memory rocksdb instance")
+	}
+	return statusToError(C.DBIngestExternalFile(r.rdb, goToCSlice([]byte(path))))
+}
+
 // NewIterator returns an iterator over this rocksdb engine.
 func (r *RocksDB) NewIterator(prefix bool) Iterator {
 	return newRocksDBIterator(r.rdb, prefix, r)
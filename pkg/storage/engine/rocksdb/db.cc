@@ -2032,6 +2032,21 @@ DBStatus DBEngineAddFile(DBEngine* db, DBSlice path) {
   return kSuccess;
 }
 
+DBStatus DBIngestExternalFile(DBEngine* db, DBSlice path) {
+  rocksdb::IngestExternalFileOptions ingest_options;
+  ingest_options.move_files = false;
+  // Assign the file a sequence number newer than the existing keys, flushing
+  // the memtable if it overlaps with the file, so that the keys of the file
+  // shadow the existing ones.
+  ingest_options.allow_global_seqno = true;
+  ingest_options.allow_blocking_flush = true;
+  rocksdb::Status status = db->rep->IngestExternalFile({ToString(path)}, ingest_options);
+  if (!status.ok()) {
+    return ToDBStatus(status);
+  }
+  return kSuccess;
+}
+
 struct DBSstFileWriter {
   std::unique_ptr<rocksdb::Options> options;
   rocksdb::ImmutableCFOptions ioptions;
@@ -236,6 +236,12 @@ DBSSTable* DBGetSSTables(DBEngine* db, int* n);
 // documentation on `AddFile` for the various restrictions on what can be added.
 DBStatus DBEngineAddFile(DBEngine* db, DBSlice path);
 
+// Ingests the sstable at the given path into the database. Unlike
+// DBEngineAddFile, the keys of the file may overlap with the ones already in
+// the database, which they then shadow. The file is copied into the
+// database, so it may reside on another filesystem.
+DBStatus DBIngestExternalFile(DBEngine* db, DBSlice path);
+
 typedef struct DBSstFileWriter DBSstFileWriter;
 
 // Creates a new SstFileWriter with the default configuration.
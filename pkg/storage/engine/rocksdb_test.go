@@ -418,6 +418,76 @@ func TestReadAmplification(t *testing.T) {
 	}
 }
 
+func TestRocksDBIngestExternalFile(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	dir, err := ioutil.TempDir("", "TestRocksDBIngestExternalFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	db := NewRocksDB(roachpb.Attributes{}, filepath.Join(dir, "db"), RocksDBCache{},
+		0, DefaultMaxOpenFiles, stopper)
+	if err := db.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Overwrite "a" and delete it before ingesting a file containing it: the
+	// ingested value must shadow both. "b" isn't in the file.
+	for _, k := range []string{"a", "b"} {
+		if err := db.Put(mvccKey(k), []byte("old")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Clear(mvccKey("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	sstPath := filepath.Join(dir, "sst")
+	sst := MakeRocksDBSstFileWriter()
+	if err := sst.Open(sstPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"a", "c"} {
+		if err := sst.Add(MVCCKeyValue{Key: mvccKey(k), Value: []byte("new")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.IngestExternalFile(sstPath); err != nil {
+		t.Fatal(err)
+	}
+	kvs, err := Scan(db, NilKey, MVCCKeyMax, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []MVCCKeyValue{
+		{Key: mvccKey("a"), Value: []byte("new")},
+		{Key: mvccKey("b"), Value: []byte("old")},
+		{Key: mvccKey("c"), Value: []byte("new")},
+	}
+	if !reflect.DeepEqual(expected, kvs) {
+		t.Fatalf("expected %v, but got %v", expected, kvs)
+	}
+
+	// In-memory engines don't support ingestion.
+	mem := NewInMem(roachpb.Attributes{}, 1<<20, stopper)
+	if err := mem.IngestExternalFile(sstPath); !testutils.IsError(err, "in-memory") {
+		t.Fatalf("expected an in-memory error, but got %v", err)
+	}
+}
+
 func TestConcurrentBatch(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
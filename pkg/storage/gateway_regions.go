@@ -0,0 +1,98 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/gossip"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// regionTierKey is the key of the locality tier naming the region of a node.
+const regionTierKey = "region"
+
+// localityRegion returns the region of the locality, or an empty string if
+// the locality has no region tier.
+func localityRegion(l roachpb.Locality) string {
+	for _, tier := range l.Tiers {
+		if tier.Key == regionTierKey {
+			return tier.Value
+		}
+	}
+	return ""
+}
+
+// gatewayRegions tracks the region of every node, as found in their gossiped
+// descriptors, so that the store can tell which of the batches it serves
+// come from gateways in other regions without consulting gossip for each of
+// them.
+type gatewayRegions struct {
+	mu struct {
+		syncutil.RWMutex
+		regions map[roachpb.NodeID]string
+	}
+}
+
+func newGatewayRegions() *gatewayRegions {
+	g := &gatewayRegions{}
+	g.mu.regions = make(map[roachpb.NodeID]string)
+	return g
+}
+
+// update records the region of the node whose descriptor was gossiped.
+func (g *gatewayRegions) update(ctx context.Context, content roachpb.Value) {
+	var desc roachpb.NodeDescriptor
+	if err := content.GetProto(&desc); err != nil {
+		log.Error(ctx, err)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.mu.regions[desc.NodeID] = localityRegion(desc.Locality)
+}
+
+// region returns the region of the node, or an empty string if it is
+// unknown.
+func (g *gatewayRegions) region(nodeID roachpb.NodeID) string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.mu.regions[nodeID]
+}
+
+// registerGatewayRegions keeps the store's gatewayRegions up to date with the
+// node descriptors gossiped by the cluster.
+func (s *Store) registerGatewayRegions(g *gossip.Gossip) {
+	g.RegisterCallback(gossip.MakePrefixPattern(gossip.KeyNodeIDPrefix),
+		func(_ string, content roachpb.Value) {
+			s.gatewayRegions.update(s.AnnotateCtx(context.TODO()), content)
+		})
+}
+
+// isRemoteGateway returns whether the gateway node of a batch is in another
+// region than the store. It returns false if either region is unknown.
+func (s *Store) isRemoteGateway(nodeID roachpb.NodeID) bool {
+	if nodeID == 0 || nodeID == s.Ident.NodeID {
+		return false
+	}
+	local := localityRegion(s.locality())
+	if local == "" {
+		return false
+	}
+	remote := s.gatewayRegions.region(nodeID)
+	return remote != "" && remote != local
+}
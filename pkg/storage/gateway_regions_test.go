@@ -0,0 +1,78 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestIsRemoteGateway(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	locality := func(region string) roachpb.Locality {
+		if region == "" {
+			return roachpb.Locality{}
+		}
+		return roachpb.Locality{Tiers: []roachpb.Tier{
+			{Key: regionTierKey, Value: region},
+			{Key: "zone", Value: region + "-a"},
+		}}
+	}
+
+	s := &Store{
+		nodeDesc:       &roachpb.NodeDescriptor{NodeID: 1, Locality: locality("us-east")},
+		gatewayRegions: newGatewayRegions(),
+	}
+	s.Ident.NodeID = 1
+	for _, desc := range []roachpb.NodeDescriptor{
+		{NodeID: 2, Locality: locality("us-east")},
+		{NodeID: 3, Locality: locality("eu-west")},
+		{NodeID: 4, Locality: locality("")},
+	} {
+		var v roachpb.Value
+		if err := v.SetProto(&desc); err != nil {
+			t.Fatal(err)
+		}
+		s.gatewayRegions.update(context.Background(), v)
+	}
+
+	testCases := []struct {
+		nodeID roachpb.NodeID
+		remote bool
+	}{
+		{0, false}, // unknown gateway
+		{1, false}, // local node
+		{2, false}, // same region
+		{3, true},  // other region
+		{4, false}, // gateway without a region
+		{5, false}, // gateway not gossiped yet
+	}
+	for _, c := range testCases {
+		if remote := s.isRemoteGateway(c.nodeID); remote != c.remote {
+			t.Errorf("node %d: expected remote=%t, got %t", c.nodeID, c.remote, remote)
+		}
+	}
+
+	// A store without a region doesn't consider any gateway remote.
+	s.nodeDesc.Locality = locality("")
+	if s.isRemoteGateway(3) {
+		t.Errorf("expected no remote gateway for a store without a region")
+	}
+}
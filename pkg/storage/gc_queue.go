@@ -82,12 +82,12 @@ const (
 // entirety using the MVCC versions iterator. The gc queue manages the
 // following tasks:
 //
-//  - GC of version data via TTL expiration (and more complex schemes
-//    as implemented going forward).
-//  - Resolve extant write intents (pushing their transactions).
-//  - GC of old transaction and abort cache entries. This should include
-//    most committed entries almost immediately and, after a threshold on
-//    inactivity, all others.
+//   - GC of version data via TTL expiration (and more complex schemes
+//     as implemented going forward).
+//   - Resolve extant write intents (pushing their transactions).
+//   - GC of old transaction and abort cache entries. This should include
+//     most committed entries almost immediately and, after a threshold on
+//     inactivity, all others.
 //
 // The shouldQueue function combines the need for the above tasks into a
 // single priority. If any task is overdue, shouldQueue returns true.
@@ -102,12 +102,16 @@ func newGCQueue(store *Store, gossip *gossip.Gossip) *gcQueue {
 		"gc", gcq, store, gossip,
 		queueConfig{
 			maxSize:              gcQueueMaxSize,
+			enabled:              gcQueueEnabled,
 			needsLease:           true,
+			paced:                true,
 			acceptsUnsplitRanges: false,
 			successes:            store.metrics.GCQueueSuccesses,
 			failures:             store.metrics.GCQueueFailures,
 			pending:              store.metrics.GCQueuePending,
 			processingNanos:      store.metrics.GCQueueProcessingNanos,
+			purgatory:            store.metrics.GCQueuePurgatory,
+			processingLatency:    store.metrics.GCQueueProcessingLatency,
 		},
 	)
 	return gcq
@@ -130,23 +134,94 @@ func (gcq *gcQueue) shouldQueue(
 		return
 	}
 
-	ms := repl.GetMVCCStats()
+	r := makeGCQueueScore(repl.GetMVCCStats(), now, zone.GC.TTLSeconds)
+	// Outside the maintenance window, only the replicas with the most
+	// garbage or the oldest intents are GC'ed.
+	if r.ShouldQueue && outsideMaintenanceWindow(now.GoTime()) &&
+		r.FinalScore < maintenanceWindowGCMinScore.Get() {
+		return false, 0
+	}
+	return r.ShouldQueue, r.FinalScore
+}
+
+// gcQueueScore holds the estimates of the garbage and intents of a range
+// which determine whether, and at what priority, it is queued for GC.
+type gcQueueScore struct {
+	TTL time.Duration
+	// GCBytes is the number of gc'able bytes, GCByteFraction their fraction
+	// of the range's bytes and TTLElapsed their average age as a multiple of
+	// the TTL.
+	GCBytes        int64
+	GCByteFraction float64
+	TTLElapsed     float64
+	// ReclaimableBytes estimates the gc'able bytes which are older than the
+	// TTL, assuming that the ages of the garbage are evenly spread.
+	ReclaimableBytes int64
+	IntentCount      int64
+	AvgIntentAge     float64
+
+	// GCScore is the total GC'able bytes age normalized by 1 MB * the
+	// TTL in seconds, and IntentScore the average age of the outstanding
+	// intents normalized by intentAgeNormalization. A range is queued
+	// when either of them reaches considerThreshold.
+	GCScore     float64
+	IntentScore float64
+
+	// FinalScore is the priority of the range. The GC score is weighted by
+	// the fraction of the garbage which is reclaimable, since garbage younger
+	// than the TTL can't be collected yet, and by the fraction of garbage of
+	// the range, since a range which is mostly garbage reclaims more space
+	// per byte scanned. The intent score is weighted by the number of
+	// intents.
+	FinalScore  float64
+	ShouldQueue bool
+}
+
+// makeGCQueueScore computes the gcQueueScore of a range with the given stats
+// and GC TTL, at the given time.
+func makeGCQueueScore(ms enginepb.MVCCStats, now hlc.Timestamp, gcTTLSeconds int32) gcQueueScore {
+	r := gcQueueScore{
+		TTL:            time.Duration(gcTTLSeconds) * time.Second,
+		GCBytes:        ms.GCBytes(),
+		GCByteFraction: ms.GCByteFraction(),
+		IntentCount:    ms.IntentCount,
+		AvgIntentAge:   ms.AvgIntentAge(now.WallTime),
+	}
+	if gcTTLSeconds > 0 {
+		r.TTLElapsed = ms.AvgGCBytesAge(now.WallTime) / float64(gcTTLSeconds)
+	}
+	switch {
+	case r.TTLElapsed >= 2:
+		r.ReclaimableBytes = r.GCBytes
+	case r.TTLElapsed > 0:
+		// With ages evenly spread over [0, 2*TTLElapsed), the garbage
+		// older than the TTL is the fraction 1 - 1/(2*TTLElapsed) of it.
+		if f := 1 - 1/(2*r.TTLElapsed); f > 0 {
+			r.ReclaimableBytes = int64(f * float64(r.GCBytes))
+		}
+	}
+
 	// GC score is the total GC'able bytes age normalized by 1 MB * the replica's TTL in seconds.
-	gcScore := float64(ms.GCByteAge(now.WallTime)) / float64(zone.GC.TTLSeconds) / float64(gcByteCountNormalization)
+	r.GCScore = float64(ms.GCByteAge(now.WallTime)) / float64(gcTTLSeconds) / float64(gcByteCountNormalization)
 
 	// Intent score. This computes the average age of outstanding intents
 	// and normalizes.
-	intentScore := ms.AvgIntentAge(now.WallTime) / float64(intentAgeNormalization.Nanoseconds()/1E9)
-
-	// Compute priority.
-	if gcScore >= considerThreshold {
-		priority += gcScore
+	r.IntentScore = r.AvgIntentAge / float64(intentAgeNormalization.Nanoseconds()/1e9)
+
+	// Compute priority. A range without reclaimable garbage isn't worth
+	// scanning for it. The weight of the garbage fraction ranges from 1/2
+	// for a range whose bytes are mostly live to 1 for a range made of
+	// garbage only, and the weight of the intents grows with the order of
+	// magnitude of their count.
+	if r.GCScore >= considerThreshold && r.ReclaimableBytes > 0 {
+		reclaimableFraction := float64(r.ReclaimableBytes) / float64(r.GCBytes)
+		r.FinalScore += r.GCScore * reclaimableFraction * (1 + r.GCByteFraction) / 2
 	}
-	if intentScore >= considerThreshold {
-		priority += intentScore
+	if r.IntentScore >= considerThreshold {
+		r.FinalScore += r.IntentScore * (1 + math.Log10(float64(r.IntentCount)))
 	}
-	shouldQ = priority > 0
-	return
+	r.ShouldQueue = r.FinalScore > 0
+	return r
 }
 
 // processTransactionTable scans the transaction table and updates txnMap with
@@ -284,15 +359,15 @@ func processAbortCache(
 // * obtaining the transaction for a abort cache entry requires a Push
 //
 // The following order is taken below:
-// 1) collect all intents with sufficiently old txn record
-// 2) collect these intents' transactions
-// 3) scan the transaction table, collecting abandoned or completed txns
-// 4) push all of these transactions (possibly recreating entries)
-// 5) resolve all intents (unless the txn is still PENDING), which will recreate
-//    abort cache entries (but with the txn timestamp; i.e. likely gc'able)
-// 6) scan the abort cache table for old entries
-// 7) push these transactions (again, recreating txn entries).
-// 8) send a GCRequest.
+//  1. collect all intents with sufficiently old txn record
+//  2. collect these intents' transactions
+//  3. scan the transaction table, collecting abandoned or completed txns
+//  4. push all of these transactions (possibly recreating entries)
+//  5. resolve all intents (unless the txn is still PENDING), which will recreate
+//     abort cache entries (but with the txn timestamp; i.e. likely gc'able)
+//  6. scan the abort cache table for old entries
+//  7. push these transactions (again, recreating txn entries).
+//  8. send a GCRequest.
 func (gcq *gcQueue) process(
 	ctx context.Context, now hlc.Timestamp, repl *Replica, sysCfg config.SystemConfig,
 ) error {
@@ -98,7 +98,8 @@ func TestGCQueueShouldQueue(t *testing.T) {
 		// No GC'able bytes, with (abs and avg) intent age=1.5*normalization.
 		{0, 0, 1, 3 * ia / 2, now, true, 1.5},
 		// No GC'able bytes, 2 intents, with avg intent age=3.5*normalization.
-		{0, 0, 2, 7 * ia, now, true, 3.5},
+		// The intent score is weighted by the count of intents.
+		{0, 0, 2, 7 * ia, now, true, 3.5 * (1 + math.Log10(2))},
 		// GC'able bytes, no time elapsed.
 		{bc, 0, 0, 0, now, false, 0},
 		// GC'able bytes, avg age = just below TTLSeconds.
@@ -110,8 +111,8 @@ func TestGCQueueShouldQueue(t *testing.T) {
 		// GC'able bytes, intent bytes, and intent normalization * 2 elapsed.
 		// Queues solely because of gc'able bytes.
 		{bc, 5 * bc * ttl, 10 * ia, 0, now, true, 5},
-		// A contribution of 1 from gc, 10/5 from intents.
-		{bc, bc * ttl, 5, 10 * ia, now, true, (1 + 2)},
+		// A contribution of 1 from gc, 10/5 from 5 intents.
+		{bc, bc * ttl, 5, 10 * ia, now, true, (1 + 2*(1+math.Log10(5)))},
 
 		// Some tests where the ages increase since we call shouldNow with
 		// a later timestamp.
@@ -121,7 +122,7 @@ func TestGCQueueShouldQueue(t *testing.T) {
 
 		// 2 intents aging from zero to now (which is exactly the intent age
 		// normalization).
-		{0, 0, 2, 0, hlc.ZeroTimestamp, true, 1},
+		{0, 0, 2, 0, hlc.ZeroTimestamp, true, 1 + math.Log10(2)},
 	}
 
 	gcQ := newGCQueue(tc.store, tc.gossip)
@@ -158,6 +159,56 @@ func TestGCQueueShouldQueue(t *testing.T) {
 	}
 }
 
+// TestMakeGCQueueScore verifies that the GC score of a range is weighted by
+// its fraction of garbage, and the estimate of its reclaimable bytes.
+func TestMakeGCQueueScore(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	const ttl = 100
+	bc := int64(gcByteCountNormalization)
+	now := makeTS(1000*1E9, 0)
+
+	testCases := []struct {
+		liveBytes, gcBytes, gcBytesAge int64
+		reclaimable                    int64
+		shouldQ                        bool
+		priority                       float64
+	}{
+		// No garbage.
+		{bc, 0, 0, 0, false, 0},
+		// Garbage with an average age of half the TTL; none of it is
+		// reclaimable yet, so the range isn't queued.
+		{0, 20 * bc, 10 * bc * ttl, 0, false, 0},
+		// Garbage with an average age of the TTL; half of it is reclaimable.
+		{0, 20 * bc, 20 * bc * ttl, 10 * bc, true, 10},
+		// Garbage with an average age of twice the TTL, all reclaimable.
+		{0, 10 * bc, 20 * bc * ttl, 10 * bc, true, 20},
+		// The same garbage in a range which is mostly live scores lower.
+		{30 * bc, 10 * bc, 20 * bc * ttl, 10 * bc, true, 20 * (1 + 0.25) / 2},
+	}
+	for i, c := range testCases {
+		ms := enginepb.MVCCStats{
+			LiveBytes:       c.liveBytes,
+			KeyBytes:        c.liveBytes + c.gcBytes,
+			GCBytesAge:      c.gcBytesAge,
+			LastUpdateNanos: now.WallTime,
+		}
+		r := makeGCQueueScore(ms, now, ttl)
+		if r.GCBytes != c.gcBytes {
+			t.Errorf("%d: expected %d gc'able bytes; got %d", i, c.gcBytes, r.GCBytes)
+		}
+		if r.ReclaimableBytes != c.reclaimable {
+			t.Errorf("%d: expected %d reclaimable bytes; got %d", i, c.reclaimable, r.ReclaimableBytes)
+		}
+		if r.ShouldQueue != c.shouldQ {
+			t.Errorf("%d: should queue expected %t; got %t", i, c.shouldQ, r.ShouldQueue)
+		}
+		if math.Abs(r.FinalScore-c.priority) > 0.00001 {
+			t.Errorf("%d: priority expected %f; got %f", i, c.priority, r.FinalScore)
+		}
+	}
+}
+
 // TestGCQueueProcess creates test data in the range over various time
 // scales and verifies that scan queue process properly GCs test data.
 func TestGCQueueProcess(t *testing.T) {
@@ -30,6 +30,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/config"
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 )
@@ -177,6 +178,13 @@ func (r *Replica) RaftUnlock() {
 	r.raftMu.Unlock()
 }
 
+// AddReplicas exposes replica.addReplicas for tests.
+func (r *Replica) AddReplicas(
+	ctx context.Context, targets []roachpb.ReplicaDescriptor, desc *roachpb.RangeDescriptor,
+) error {
+	return r.addReplicas(ctx, targets, desc)
+}
+
 // GetLastIndex is the same function as LastIndex but it does not require
 // that the replica lock is held.
 func (r *Replica) GetLastIndex() (uint64, error) {
@@ -203,7 +211,7 @@ func (r *Replica) GetTimestampCacheLowWater() hlc.Timestamp {
 func (sp *StorePool) GetStoreList(
 	constraints config.Constraints, deterministic bool,
 ) (StoreList, int, int) {
-	return sp.getStoreList(constraints, deterministic)
+	return sp.getStoreList(constraints, nil, storeFilterNone, deterministic)
 }
 
 // IsQuiescent returns whether the replica is quiescent or not.
@@ -217,6 +225,12 @@ func GetGCQueueTxnCleanupThreshold() time.Duration {
 	return txnCleanupThreshold
 }
 
+// SetCommandContainmentEnabled enables or disables raft command containment
+// and returns a function which restores the previous setting.
+func SetCommandContainmentEnabled(enabled bool) func() {
+	return settings.TestingSetBool(commandContainmentEnabled, enabled)
+}
+
 // StopHeartbeat ends the heartbeat loop.
 func (nl *NodeLiveness) StopHeartbeat() {
 	close(nl.stopHeartbeat)
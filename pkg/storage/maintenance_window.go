@@ -0,0 +1,90 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/settings"
+)
+
+// The following settings define a daily maintenance window, in UTC, to
+// which an operator can confine the heavy background work of the stores, so
+// that data movement happens off-hours. Outside the window, replicas aren't
+// rebalanced (missing or dead replicas are still replaced), consistency
+// checks and time series rollups don't run, and only the replicas with the
+// most garbage are GC'ed. Within the window, the queues and snapshots run
+// unpaced. Without a window, which is the default, the work runs at all
+// times, paced as configured.
+var (
+	maintenanceWindowStart = settings.RegisterDurationSetting(
+		"kv.maintenance_window.start",
+		"time of the day, as an offset from midnight UTC, at which the daily maintenance window opens",
+		0,
+	)
+	maintenanceWindowDuration = settings.RegisterDurationSetting(
+		"kv.maintenance_window.duration",
+		"length of the daily maintenance window outside which rebalancing, consistency checks, "+
+			"time series rollups and non-urgent GC are held off; 0 disables the window",
+		0,
+	)
+	maintenanceWindowGCMinScore = settings.RegisterFloatSetting(
+		"kv.maintenance_window.gc_min_score",
+		"minimum GC queue score of the replicas garbage collected outside the maintenance window",
+		10*considerThreshold,
+	)
+)
+
+// maintenanceWindowAt returns whether a maintenance window is configured,
+// and if so whether the given time is within it.
+func maintenanceWindowAt(now time.Time) (configured, inside bool) {
+	length := maintenanceWindowDuration.Get()
+	if length <= 0 {
+		return false, false
+	}
+	return true, withinDailyWindow(now, maintenanceWindowStart.Get(), length)
+}
+
+// withinDailyWindow returns whether the time is within the daily window
+// opening at the given offset from midnight UTC, for the given length. A
+// window may span midnight.
+func withinDailyWindow(now time.Time, start, length time.Duration) bool {
+	const day = 24 * time.Hour
+	if length >= day {
+		return true
+	}
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	offset := (now.Sub(midnight) - start) % day
+	if offset < 0 {
+		offset += day
+	}
+	return offset < length
+}
+
+// inMaintenanceWindow returns whether a maintenance window is configured and
+// the time is within it, in which case background work runs unpaced.
+func inMaintenanceWindow(now time.Time) bool {
+	configured, inside := maintenanceWindowAt(now)
+	return configured && inside
+}
+
+// outsideMaintenanceWindow returns whether a maintenance window is
+// configured and the time is outside of it, in which case heavy background
+// work is held off.
+func outsideMaintenanceWindow(now time.Time) bool {
+	configured, inside := maintenanceWindowAt(now)
+	return configured && !inside
+}
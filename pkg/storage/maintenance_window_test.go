@@ -0,0 +1,76 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestWithinDailyWindow(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	at := func(hour, min int) time.Time {
+		return time.Date(2017, 3, 14, hour, min, 0, 0, time.UTC)
+	}
+	testCases := []struct {
+		now           time.Time
+		start, length time.Duration
+		expected      bool
+	}{
+		{at(1, 0), 2 * time.Hour, 4 * time.Hour, false},
+		{at(2, 0), 2 * time.Hour, 4 * time.Hour, true},
+		{at(5, 59), 2 * time.Hour, 4 * time.Hour, true},
+		{at(6, 0), 2 * time.Hour, 4 * time.Hour, false},
+		// A window spanning midnight.
+		{at(21, 59), 22 * time.Hour, 6 * time.Hour, false},
+		{at(23, 0), 22 * time.Hour, 6 * time.Hour, true},
+		{at(3, 0), 22 * time.Hour, 6 * time.Hour, true},
+		{at(4, 0), 22 * time.Hour, 6 * time.Hour, false},
+		// A window of a day or more is always open.
+		{at(12, 0), 22 * time.Hour, 24 * time.Hour, true},
+		// The time zone of the time doesn't matter.
+		{at(3, 0).In(time.FixedZone("UTC+5", 5*3600)), 2 * time.Hour, 4 * time.Hour, true},
+	}
+	for i, c := range testCases {
+		if within := withinDailyWindow(c.now, c.start, c.length); within != c.expected {
+			t.Errorf("%d: expected %s within the window opening at %s for %s to be %t",
+				i, c.now, c.start, c.length, c.expected)
+		}
+	}
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	now := time.Date(2017, 3, 14, 12, 0, 0, 0, time.UTC)
+	// Without a window, background work is neither held off nor boosted.
+	if inMaintenanceWindow(now) || outsideMaintenanceWindow(now) {
+		t.Fatalf("expected no maintenance window by default")
+	}
+
+	defer settings.TestingSetDuration(maintenanceWindowStart, 22*time.Hour)()
+	defer settings.TestingSetDuration(maintenanceWindowDuration, 6*time.Hour)()
+	if inMaintenanceWindow(now) || !outsideMaintenanceWindow(now) {
+		t.Errorf("expected %s to be outside the maintenance window", now)
+	}
+	night := now.Add(12 * time.Hour)
+	if !inMaintenanceWindow(night) || outsideMaintenanceWindow(night) {
+		t.Errorf("expected %s to be within the maintenance window", night)
+	}
+}
@@ -50,6 +50,17 @@ var (
 	// Lease request metrics.
 	metaLeaseRequestSuccessCount = metric.Metadata{Name: "leases.success"}
 	metaLeaseRequestErrorCount   = metric.Metadata{Name: "leases.error"}
+	metaLeaseShedCount           = metric.Metadata{
+		Name: "leases.shed",
+		Help: "Number of leases transferred away because the store was overloaded"}
+
+	// Scan metrics.
+	metaScanKeysSurfaced = metric.Metadata{
+		Name: "scan.keys.surfaced",
+		Help: "Number of keys with a visible value read by scans"}
+	metaScanKeysSkipped = metric.Metadata{
+		Name: "scan.keys.skipped",
+		Help: "Number of keys without a visible value stepped over by scans, such as deleted keys"}
 
 	// Storage metrics.
 	metaLiveBytes       = metric.Metadata{Name: "livebytes"}
@@ -68,6 +79,8 @@ var (
 	metaReserved        = metric.Metadata{Name: "capacity.reserved"}
 	metaSysBytes        = metric.Metadata{Name: "sysbytes"}
 	metaSysCount        = metric.Metadata{Name: "syscount"}
+	metaOverload        = metric.Metadata{Name: "overload",
+		Help: "Overload score of the store; 1 or more means a resource is saturated"}
 
 	// RocksDB metrics.
 	metaRdbBlockCacheHits           = metric.Metadata{Name: "rocksdb.block.cache.hits"}
@@ -87,6 +100,10 @@ var (
 		Name: "rocksdb.num-sstables",
 		Help: "Number of rocksdb SSTables",
 	}
+	metaRdbL0SSTables = metric.Metadata{
+		Name: "rocksdb.l0-sstables",
+		Help: "Number of rocksdb SSTables in level 0",
+	}
 
 	// Range event metrics.
 	metaRangeSplits                     = metric.Metadata{Name: "range.splits"}
@@ -95,6 +112,16 @@ var (
 	metaRangeSnapshotsGenerated         = metric.Metadata{Name: "range.snapshots.generated"}
 	metaRangeSnapshotsNormalApplied     = metric.Metadata{Name: "range.snapshots.normal-applied"}
 	metaRangeSnapshotsPreemptiveApplied = metric.Metadata{Name: "range.snapshots.preemptive-applied"}
+	metaRangeSnapshotsSending           = metric.Metadata{Name: "range.snapshots.sending",
+		Help: "Number of snapshots being sent by the store"}
+	metaRangeSnapshotsReceiving = metric.Metadata{Name: "range.snapshots.receiving",
+		Help: "Number of snapshots being received by the store"}
+	metaRangeSnapshotsSendRate = metric.Metadata{Name: "range.snapshots.send-rate",
+		Help: "Combined rate, in bytes per second, at which the snapshots being sent are streamed"}
+	metaRangeSnapshotsReceiveRate = metric.Metadata{Name: "range.snapshots.receive-rate",
+		Help: "Combined rate, in bytes per second, at which the snapshots being received are streamed"}
+	metaRangeStatsRepairs = metric.Metadata{Name: "range.stats-repairs",
+		Help: "Number of ranges whose diverged MVCC stats were repaired after a consistency check"}
 
 	// Raft processing metrics.
 	metaRaftTicks = metric.Metadata{
@@ -107,6 +134,30 @@ var (
 	metaRaftTickingDurationNanos = metric.Metadata{Name: "raft.process.tickingnanos",
 		Help: "Nanoseconds spent in store.processRaft() processing replica.Tick()",
 	}
+	metaRaftSchedulerLatency = metric.Metadata{Name: "raft.scheduler.latency",
+		Help: "Latency between queueing a range on the Raft scheduler and a worker processing it",
+	}
+	metaRaftLogCommitLatency = metric.Metadata{Name: "raft.process.logcommit.latency",
+		Help: "Latency of committing Raft log entries to disk",
+	}
+	metaRaftCommandsAbandoned = metric.Metadata{Name: "raft.commands.abandoned",
+		Help: "Number of Raft commands whose clients gave up waiting for them",
+	}
+	metaRaftCommandsAbandonedDropped = metric.Metadata{Name: "raft.commands.abandoned.dropped",
+		Help: "Number of Raft commands of cancelled clients which were dropped before being (re)proposed",
+	}
+	metaRaftCommandsAbandonedApplied = metric.Metadata{Name: "raft.commands.abandoned.applied",
+		Help: "Number of Raft commands applied after their clients gave up waiting for them",
+	}
+	metaRaftCommandsMalformed = metric.Metadata{Name: "raft.commands.malformed",
+		Help: "Number of Raft commands rejected before being proposed because they failed validation",
+	}
+	metaRaftCommandsPoisoned = metric.Metadata{Name: "raft.commands.poisoned",
+		Help: "Number of Raft entries which could not be applied and halted their range",
+	}
+	metaRaftCommandsDiscarded = metric.Metadata{Name: "raft.commands.discarded",
+		Help: "Number of poisoned Raft entries discarded by an operator",
+	}
 
 	// Raft message metrics.
 	metaRaftRcvdProp = metric.Metadata{
@@ -162,6 +213,28 @@ var (
 		Help: "Number of pending heartbeats and responses waiting to be coalesced",
 	}
 
+	// Raft log growth backpressure metrics.
+	metaRaftLogTotalBytes = metric.Metadata{Name: "raftlog.bytes",
+		Help: "Approximate total size of the raft logs on this store"}
+	metaRaftLogBackpressureActive = metric.Metadata{Name: "raftlog.backpressure.active",
+		Help: "Set to 1 while writes are delayed because the raft logs are outgrowing truncation"}
+	metaRaftLogBackpressureDelayNanos = metric.Metadata{Name: "raftlog.backpressure.delaynanos",
+		Help: "Nanoseconds by which each write is currently delayed by raft log backpressure"}
+	metaRaftLogBackpressureThrottled = metric.Metadata{Name: "raftlog.backpressure.throttled",
+		Help: "Number of write batches delayed by raft log backpressure"}
+	metaRaftLogBackpressureShed = metric.Metadata{Name: "raftlog.backpressure.shed",
+		Help: "Number of write batches rejected with a suggested backoff by raft log backpressure"}
+
+	// Range size backpressure metrics.
+	metaRangeSizeBackpressureThrottled = metric.Metadata{Name: "range.backpressure.throttled",
+		Help: "Number of write batches delayed because their range exceeded its maximum size"}
+	metaRangeSizeBackpressureTimeouts = metric.Metadata{Name: "range.backpressure.timeouts",
+		Help: "Number of delayed write batches which proceeded before their range was split"}
+
+	// Queue pacing metrics.
+	metaQueuePacingWaitNanos = metric.Metadata{Name: "queue.pacing.waitnanos",
+		Help: "Nanoseconds spent by queues and snapshots waiting for the store's pacing budgets"}
+
 	// Replica queue metrics.
 	metaGCQueueSuccesses = metric.Metadata{Name: "queue.gc.process.success",
 		Help: "Number of replicas successfully processed by the GC queue"}
@@ -171,6 +244,10 @@ var (
 		Help: "Number of pending replicas in the GC queue"}
 	metaGCQueueProcessingNanos = metric.Metadata{Name: "queue.gc.processingnanos",
 		Help: "Nanoseconds spent processing replicas in the GC queue"}
+	metaGCQueuePurgatory = metric.Metadata{Name: "queue.gc.purgatory",
+		Help: "Number of replicas in the GC queue's purgatory"}
+	metaGCQueueProcessingLatency = metric.Metadata{Name: "queue.gc.processinglatency",
+		Help: "Latency of processing a replica in the GC queue"}
 	metaRaftLogQueueSuccesses = metric.Metadata{Name: "queue.raftlog.process.success",
 		Help: "Number of replicas successfully processed by the raft log queue"}
 	metaRaftLogQueueFailures = metric.Metadata{Name: "queue.raftlog.process.failure",
@@ -179,6 +256,10 @@ var (
 		Help: "Number of pending replicas in the raft log queue"}
 	metaRaftLogQueueProcessingNanos = metric.Metadata{Name: "queue.raftlog.processingnanos",
 		Help: "Nanoseconds spent processing replicas in the raft log queue"}
+	metaRaftLogQueuePurgatory = metric.Metadata{Name: "queue.raftlog.purgatory",
+		Help: "Number of replicas in the raft log queue's purgatory"}
+	metaRaftLogQueueProcessingLatency = metric.Metadata{Name: "queue.raftlog.processinglatency",
+		Help: "Latency of processing a replica in the raft log queue"}
 	metaConsistencyQueueSuccesses = metric.Metadata{Name: "queue.consistency.process.success",
 		Help: "Number of replicas successfully processed by the consistency checker queue"}
 	metaConsistencyQueueFailures = metric.Metadata{Name: "queue.consistency.process.failure",
@@ -187,6 +268,10 @@ var (
 		Help: "Number of pending replicas in the consistency checker queue"}
 	metaConsistencyQueueProcessingNanos = metric.Metadata{Name: "queue.consistency.processingnanos",
 		Help: "Nanoseconds spent processing replicas in the consistency checker queue"}
+	metaConsistencyQueuePurgatory = metric.Metadata{Name: "queue.consistency.purgatory",
+		Help: "Number of replicas in the consistency checker queue's purgatory"}
+	metaConsistencyQueueProcessingLatency = metric.Metadata{Name: "queue.consistency.processinglatency",
+		Help: "Latency of processing a replica in the consistency checker queue"}
 	metaReplicaGCQueueSuccesses = metric.Metadata{Name: "queue.replicagc.process.success",
 		Help: "Number of replicas successfully processed by the replica GC queue"}
 	metaReplicaGCQueueFailures = metric.Metadata{Name: "queue.replicagc.process.failure",
@@ -195,6 +280,10 @@ var (
 		Help: "Number of pending replicas in the replica GC queue"}
 	metaReplicaGCQueueProcessingNanos = metric.Metadata{Name: "queue.replicagc.processingnanos",
 		Help: "Nanoseconds spent processing replicas in the replica GC queue"}
+	metaReplicaGCQueuePurgatory = metric.Metadata{Name: "queue.replicagc.purgatory",
+		Help: "Number of replicas in the replica GC queue's purgatory"}
+	metaReplicaGCQueueProcessingLatency = metric.Metadata{Name: "queue.replicagc.processinglatency",
+		Help: "Latency of processing a replica in the replica GC queue"}
 	metaReplicateQueueSuccesses = metric.Metadata{Name: "queue.replicate.process.success",
 		Help: "Number of replicas successfully processed by the replicate queue"}
 	metaReplicateQueueFailures = metric.Metadata{Name: "queue.replicate.process.failure",
@@ -205,6 +294,14 @@ var (
 		Help: "Nanoseconds spent processing replicas in the replicate queue"}
 	metaReplicateQueuePurgatory = metric.Metadata{Name: "queue.replicate.purgatory",
 		Help: "Number of replicas in the replicate queue's purgatory, awaiting allocation options"}
+	metaReplicateQueuePurgatoryNoTarget = metric.Metadata{Name: "queue.replicate.purgatory.no_target",
+		Help: "Number of replicas in the replicate queue's purgatory for which no store satisfies the zone constraints"}
+	metaReplicateQueuePurgatoryThrottled = metric.Metadata{Name: "queue.replicate.purgatory.throttled",
+		Help: "Number of replicas in the replicate queue's purgatory for which all suitable stores are throttled"}
+	metaReplicateQueuePurgatoryLeaseNotHeld = metric.Metadata{Name: "queue.replicate.purgatory.lease_not_held",
+		Help: "Number of replicas in the replicate queue's purgatory which could not obtain the range lease"}
+	metaReplicateQueueProcessingLatency = metric.Metadata{Name: "queue.replicate.processinglatency",
+		Help: "Latency of processing a replica in the replicate queue"}
 	metaSplitQueueSuccesses = metric.Metadata{Name: "queue.split.process.success",
 		Help: "Number of replicas successfully processed by the split queue"}
 	metaSplitQueueFailures = metric.Metadata{Name: "queue.split.process.failure",
@@ -213,6 +310,10 @@ var (
 		Help: "Number of pending replicas in the split queue"}
 	metaSplitQueueProcessingNanos = metric.Metadata{Name: "queue.split.processingnanos",
 		Help: "Nanoseconds spent processing replicas in the split queue"}
+	metaSplitQueuePurgatory = metric.Metadata{Name: "queue.split.purgatory",
+		Help: "Number of replicas in the split queue's purgatory"}
+	metaSplitQueueProcessingLatency = metric.Metadata{Name: "queue.split.processinglatency",
+		Help: "Latency of processing a replica in the split queue"}
 
 	metaTimeSeriesMaintenanceQueueSuccesses = metric.Metadata{Name: "queue.tsmaintenance.process.success",
 		Help: "Number of replicas successfully processed by the time series maintenance queue"}
@@ -222,6 +323,10 @@ var (
 		Help: "Number of pending replicas in the time series maintenance queue"}
 	metaTimeSeriesMaintenanceQueueProcessingNanos = metric.Metadata{Name: "queue.tsmaintenance.processingnanos",
 		Help: "Nanoseconds spent processing replicas in the time series maintenance queue"}
+	metaTimeSeriesMaintenanceQueuePurgatory = metric.Metadata{Name: "queue.tsmaintenance.purgatory",
+		Help: "Number of replicas in the time series maintenance queue's purgatory"}
+	metaTimeSeriesMaintenanceQueueProcessingLatency = metric.Metadata{Name: "queue.tsmaintenance.processinglatency",
+		Help: "Latency of processing a replica in the time series maintenance queue"}
 
 	// GCInfo cumulative totals.
 	metaGCNumKeysAffected = metric.Metadata{Name: "queue.gc.info.numkeysaffected",
@@ -287,6 +392,14 @@ type StoreMetrics struct {
 	// lease).
 	LeaseRequestSuccessCount *metric.Counter
 	LeaseRequestErrorCount   *metric.Counter
+	// LeaseShedCount counts the leases the store transferred away because it
+	// was overloaded.
+	LeaseShedCount *metric.Counter
+
+	// Scan metrics. Many skipped keys for each surfaced one indicate that
+	// scans are slowed down by MVCC garbage.
+	ScanKeysSurfaced *metric.Counter
+	ScanKeysSkipped  *metric.Counter
 
 	// Storage metrics.
 	LiveBytes       *metric.Gauge
@@ -305,6 +418,7 @@ type StoreMetrics struct {
 	Reserved        *metric.Counter
 	SysBytes        *metric.Gauge
 	SysCount        *metric.Gauge
+	Overload        *metric.GaugeFloat64
 
 	// RocksDB metrics.
 	RdbBlockCacheHits           *metric.Gauge
@@ -321,6 +435,7 @@ type StoreMetrics struct {
 	RdbTableReadersMemEstimate  *metric.Gauge
 	RdbReadAmplification        *metric.Gauge
 	RdbNumSSTables              *metric.Gauge
+	RdbL0SSTables               *metric.Gauge
 
 	// TODO(mrtracy): This should be removed as part of #4465. This is only
 	// maintained to keep the current structure of StatusSummaries; it would be
@@ -334,11 +449,36 @@ type StoreMetrics struct {
 	RangeSnapshotsGenerated         *metric.Counter
 	RangeSnapshotsNormalApplied     *metric.Counter
 	RangeSnapshotsPreemptiveApplied *metric.Counter
+	RangeSnapshotsSending           *metric.Gauge
+	RangeSnapshotsReceiving         *metric.Gauge
+	RangeSnapshotsSendRate          *metric.Gauge
+	RangeSnapshotsReceiveRate       *metric.Gauge
+	RangeStatsRepairs               *metric.Counter
 
 	// Raft processing metrics.
 	RaftTicks                *metric.Counter
 	RaftWorkingDurationNanos *metric.Counter
 	RaftTickingDurationNanos *metric.Counter
+	RaftSchedulerLatency     *metric.Histogram
+	RaftLogCommitLatency     *metric.Histogram
+
+	// Metrics for the work done on behalf of cancelled requests: the
+	// commands whose clients stopped waiting, those of them (and of other
+	// cancelled requests) which never made it into Raft, and those which
+	// were applied nonetheless.
+	RaftCommandsAbandoned        *metric.Counter
+	RaftCommandsAbandonedDropped *metric.Counter
+	RaftCommandsAbandonedApplied *metric.Counter
+
+	// RaftCommandsMalformed counts the commands which failed validation
+	// before being proposed; see Replica.validateCommandLocked.
+	RaftCommandsMalformed *metric.Counter
+
+	// RaftCommandsPoisoned counts the raft entries which halted their range
+	// because they could not be applied, and RaftCommandsDiscarded those
+	// which were discarded to resume it; see commandContainmentEnabled.
+	RaftCommandsPoisoned  *metric.Counter
+	RaftCommandsDiscarded *metric.Counter
 
 	// Raft message metrics.
 	RaftRcvdMsgProp           *metric.Counter
@@ -362,36 +502,66 @@ type StoreMetrics struct {
 	RaftEnqueuedPending            *metric.Gauge
 	RaftCoalescedHeartbeatsPending *metric.Gauge
 
+	// Raft log growth backpressure metrics.
+	RaftLogTotalBytes             *metric.Gauge
+	RaftLogBackpressureActive     *metric.Gauge
+	RaftLogBackpressureDelayNanos *metric.Gauge
+	RaftLogBackpressureThrottled  *metric.Counter
+	RaftLogBackpressureShed       *metric.Counter
+
+	// Range size backpressure metrics.
+	RangeSizeBackpressureThrottled *metric.Counter
+	RangeSizeBackpressureTimeouts  *metric.Counter
+
+	// Queue pacing metrics.
+	QueuePacingWaitNanos *metric.Counter
+
 	// Replica queue metrics.
-	GCQueueSuccesses                          *metric.Counter
-	GCQueueFailures                           *metric.Counter
-	GCQueuePending                            *metric.Gauge
-	GCQueueProcessingNanos                    *metric.Counter
-	RaftLogQueueSuccesses                     *metric.Counter
-	RaftLogQueueFailures                      *metric.Counter
-	RaftLogQueuePending                       *metric.Gauge
-	RaftLogQueueProcessingNanos               *metric.Counter
-	ConsistencyQueueSuccesses                 *metric.Counter
-	ConsistencyQueueFailures                  *metric.Counter
-	ConsistencyQueuePending                   *metric.Gauge
-	ConsistencyQueueProcessingNanos           *metric.Counter
-	ReplicaGCQueueSuccesses                   *metric.Counter
-	ReplicaGCQueueFailures                    *metric.Counter
-	ReplicaGCQueuePending                     *metric.Gauge
-	ReplicaGCQueueProcessingNanos             *metric.Counter
-	ReplicateQueueSuccesses                   *metric.Counter
-	ReplicateQueueFailures                    *metric.Counter
-	ReplicateQueuePending                     *metric.Gauge
-	ReplicateQueueProcessingNanos             *metric.Counter
-	ReplicateQueuePurgatory                   *metric.Gauge
-	SplitQueueSuccesses                       *metric.Counter
-	SplitQueueFailures                        *metric.Counter
-	SplitQueuePending                         *metric.Gauge
-	SplitQueueProcessingNanos                 *metric.Counter
-	TimeSeriesMaintenanceQueueSuccesses       *metric.Counter
-	TimeSeriesMaintenanceQueueFailures        *metric.Counter
-	TimeSeriesMaintenanceQueuePending         *metric.Gauge
-	TimeSeriesMaintenanceQueueProcessingNanos *metric.Counter
+	GCQueueSuccesses                            *metric.Counter
+	GCQueueFailures                             *metric.Counter
+	GCQueuePending                              *metric.Gauge
+	GCQueueProcessingNanos                      *metric.Counter
+	GCQueuePurgatory                            *metric.Gauge
+	GCQueueProcessingLatency                    *metric.Histogram
+	RaftLogQueueSuccesses                       *metric.Counter
+	RaftLogQueueFailures                        *metric.Counter
+	RaftLogQueuePending                         *metric.Gauge
+	RaftLogQueueProcessingNanos                 *metric.Counter
+	RaftLogQueuePurgatory                       *metric.Gauge
+	RaftLogQueueProcessingLatency               *metric.Histogram
+	ConsistencyQueueSuccesses                   *metric.Counter
+	ConsistencyQueueFailures                    *metric.Counter
+	ConsistencyQueuePending                     *metric.Gauge
+	ConsistencyQueueProcessingNanos             *metric.Counter
+	ConsistencyQueuePurgatory                   *metric.Gauge
+	ConsistencyQueueProcessingLatency           *metric.Histogram
+	ReplicaGCQueueSuccesses                     *metric.Counter
+	ReplicaGCQueueFailures                      *metric.Counter
+	ReplicaGCQueuePending                       *metric.Gauge
+	ReplicaGCQueueProcessingNanos               *metric.Counter
+	ReplicaGCQueuePurgatory                     *metric.Gauge
+	ReplicaGCQueueProcessingLatency             *metric.Histogram
+	ReplicateQueueSuccesses                     *metric.Counter
+	ReplicateQueueFailures                      *metric.Counter
+	ReplicateQueuePending                       *metric.Gauge
+	ReplicateQueueProcessingNanos               *metric.Counter
+	ReplicateQueuePurgatory                     *metric.Gauge
+	ReplicateQueuePurgatoryNoTarget             *metric.Gauge
+	ReplicateQueuePurgatoryThrottled            *metric.Gauge
+	ReplicateQueuePurgatoryLeaseNotHeld         *metric.Gauge
+	ReplicateQueueProcessingLatency             *metric.Histogram
+	SplitQueueSuccesses                         *metric.Counter
+	SplitQueueFailures                          *metric.Counter
+	SplitQueuePending                           *metric.Gauge
+	SplitQueueProcessingNanos                   *metric.Counter
+	SplitQueuePurgatory                         *metric.Gauge
+	SplitQueueProcessingLatency                 *metric.Histogram
+	TimeSeriesMaintenanceQueueSuccesses         *metric.Counter
+	TimeSeriesMaintenanceQueueFailures          *metric.Counter
+	TimeSeriesMaintenanceQueuePending           *metric.Gauge
+	TimeSeriesMaintenanceQueueProcessingNanos   *metric.Counter
+	TimeSeriesMaintenanceQueuePurgatory         *metric.Gauge
+	TimeSeriesMaintenanceQueueProcessingLatency *metric.Histogram
 
 	// GCInfo cumulative totals.
 	GCNumKeysAffected            *metric.Counter
@@ -446,6 +616,11 @@ func newStoreMetrics(sampleInterval time.Duration) *StoreMetrics {
 		// Lease request metrics.
 		LeaseRequestSuccessCount: metric.NewCounter(metaLeaseRequestSuccessCount),
 		LeaseRequestErrorCount:   metric.NewCounter(metaLeaseRequestErrorCount),
+		LeaseShedCount:           metric.NewCounter(metaLeaseShedCount),
+
+		// Scan metrics.
+		ScanKeysSurfaced: metric.NewCounter(metaScanKeysSurfaced),
+		ScanKeysSkipped:  metric.NewCounter(metaScanKeysSkipped),
 
 		// Storage metrics.
 		LiveBytes:       metric.NewGauge(metaLiveBytes),
@@ -464,6 +639,7 @@ func newStoreMetrics(sampleInterval time.Duration) *StoreMetrics {
 		Reserved:        metric.NewCounter(metaReserved),
 		SysBytes:        metric.NewGauge(metaSysBytes),
 		SysCount:        metric.NewGauge(metaSysCount),
+		Overload:        metric.NewGaugeFloat64(metaOverload),
 
 		// RocksDB metrics.
 		RdbBlockCacheHits:           metric.NewGauge(metaRdbBlockCacheHits),
@@ -480,6 +656,7 @@ func newStoreMetrics(sampleInterval time.Duration) *StoreMetrics {
 		RdbTableReadersMemEstimate:  metric.NewGauge(metaRdbTableReadersMemEstimate),
 		RdbReadAmplification:        metric.NewGauge(metaRdbReadAmplification),
 		RdbNumSSTables:              metric.NewGauge(metaRdbNumSSTables),
+		RdbL0SSTables:               metric.NewGauge(metaRdbL0SSTables),
 
 		// Range event metrics.
 		RangeSplits:                     metric.NewCounter(metaRangeSplits),
@@ -488,11 +665,25 @@ func newStoreMetrics(sampleInterval time.Duration) *StoreMetrics {
 		RangeSnapshotsGenerated:         metric.NewCounter(metaRangeSnapshotsGenerated),
 		RangeSnapshotsNormalApplied:     metric.NewCounter(metaRangeSnapshotsNormalApplied),
 		RangeSnapshotsPreemptiveApplied: metric.NewCounter(metaRangeSnapshotsPreemptiveApplied),
+		RangeSnapshotsSending:           metric.NewGauge(metaRangeSnapshotsSending),
+		RangeSnapshotsReceiving:         metric.NewGauge(metaRangeSnapshotsReceiving),
+		RangeSnapshotsSendRate:          metric.NewGauge(metaRangeSnapshotsSendRate),
+		RangeSnapshotsReceiveRate:       metric.NewGauge(metaRangeSnapshotsReceiveRate),
+		RangeStatsRepairs:               metric.NewCounter(metaRangeStatsRepairs),
 
 		// Raft processing metrics.
 		RaftTicks:                metric.NewCounter(metaRaftTicks),
 		RaftWorkingDurationNanos: metric.NewCounter(metaRaftWorkingDurationNanos),
 		RaftTickingDurationNanos: metric.NewCounter(metaRaftTickingDurationNanos),
+		RaftSchedulerLatency:     metric.NewLatency(metaRaftSchedulerLatency, sampleInterval),
+		RaftLogCommitLatency:     metric.NewLatency(metaRaftLogCommitLatency, sampleInterval),
+
+		RaftCommandsAbandoned:        metric.NewCounter(metaRaftCommandsAbandoned),
+		RaftCommandsAbandonedDropped: metric.NewCounter(metaRaftCommandsAbandonedDropped),
+		RaftCommandsAbandonedApplied: metric.NewCounter(metaRaftCommandsAbandonedApplied),
+		RaftCommandsMalformed:        metric.NewCounter(metaRaftCommandsMalformed),
+		RaftCommandsPoisoned:         metric.NewCounter(metaRaftCommandsPoisoned),
+		RaftCommandsDiscarded:        metric.NewCounter(metaRaftCommandsDiscarded),
 
 		// Raft message metrics.
 		RaftRcvdMsgProp:           metric.NewCounter(metaRaftRcvdProp),
@@ -514,36 +705,66 @@ func newStoreMetrics(sampleInterval time.Duration) *StoreMetrics {
 		// the queue is cleared, to avoid flapping wildly.
 		RaftCoalescedHeartbeatsPending: metric.NewGauge(metaRaftCoalescedHeartbeatsPending),
 
+		// Raft log growth backpressure metrics.
+		RaftLogTotalBytes:             metric.NewGauge(metaRaftLogTotalBytes),
+		RaftLogBackpressureActive:     metric.NewGauge(metaRaftLogBackpressureActive),
+		RaftLogBackpressureDelayNanos: metric.NewGauge(metaRaftLogBackpressureDelayNanos),
+		RaftLogBackpressureThrottled:  metric.NewCounter(metaRaftLogBackpressureThrottled),
+		RaftLogBackpressureShed:       metric.NewCounter(metaRaftLogBackpressureShed),
+
+		// Range size backpressure metrics.
+		RangeSizeBackpressureThrottled: metric.NewCounter(metaRangeSizeBackpressureThrottled),
+		RangeSizeBackpressureTimeouts:  metric.NewCounter(metaRangeSizeBackpressureTimeouts),
+
+		// Queue pacing metrics.
+		QueuePacingWaitNanos: metric.NewCounter(metaQueuePacingWaitNanos),
+
 		// Replica queue metrics.
-		GCQueueSuccesses:                          metric.NewCounter(metaGCQueueSuccesses),
-		GCQueueFailures:                           metric.NewCounter(metaGCQueueFailures),
-		GCQueuePending:                            metric.NewGauge(metaGCQueuePending),
-		GCQueueProcessingNanos:                    metric.NewCounter(metaGCQueueProcessingNanos),
-		RaftLogQueueSuccesses:                     metric.NewCounter(metaRaftLogQueueSuccesses),
-		RaftLogQueueFailures:                      metric.NewCounter(metaRaftLogQueueFailures),
-		RaftLogQueuePending:                       metric.NewGauge(metaRaftLogQueuePending),
-		RaftLogQueueProcessingNanos:               metric.NewCounter(metaRaftLogQueueProcessingNanos),
-		ConsistencyQueueSuccesses:                 metric.NewCounter(metaConsistencyQueueSuccesses),
-		ConsistencyQueueFailures:                  metric.NewCounter(metaConsistencyQueueFailures),
-		ConsistencyQueuePending:                   metric.NewGauge(metaConsistencyQueuePending),
-		ConsistencyQueueProcessingNanos:           metric.NewCounter(metaConsistencyQueueProcessingNanos),
-		ReplicaGCQueueSuccesses:                   metric.NewCounter(metaReplicaGCQueueSuccesses),
-		ReplicaGCQueueFailures:                    metric.NewCounter(metaReplicaGCQueueFailures),
-		ReplicaGCQueuePending:                     metric.NewGauge(metaReplicaGCQueuePending),
-		ReplicaGCQueueProcessingNanos:             metric.NewCounter(metaReplicaGCQueueProcessingNanos),
-		ReplicateQueueSuccesses:                   metric.NewCounter(metaReplicateQueueSuccesses),
-		ReplicateQueueFailures:                    metric.NewCounter(metaReplicateQueueFailures),
-		ReplicateQueuePending:                     metric.NewGauge(metaReplicateQueuePending),
-		ReplicateQueueProcessingNanos:             metric.NewCounter(metaReplicateQueueProcessingNanos),
-		ReplicateQueuePurgatory:                   metric.NewGauge(metaReplicateQueuePurgatory),
-		SplitQueueSuccesses:                       metric.NewCounter(metaSplitQueueSuccesses),
-		SplitQueueFailures:                        metric.NewCounter(metaSplitQueueFailures),
-		SplitQueuePending:                         metric.NewGauge(metaSplitQueuePending),
-		SplitQueueProcessingNanos:                 metric.NewCounter(metaSplitQueueProcessingNanos),
-		TimeSeriesMaintenanceQueueSuccesses:       metric.NewCounter(metaTimeSeriesMaintenanceQueueFailures),
-		TimeSeriesMaintenanceQueueFailures:        metric.NewCounter(metaTimeSeriesMaintenanceQueueSuccesses),
-		TimeSeriesMaintenanceQueuePending:         metric.NewGauge(metaTimeSeriesMaintenanceQueuePending),
-		TimeSeriesMaintenanceQueueProcessingNanos: metric.NewCounter(metaTimeSeriesMaintenanceQueueProcessingNanos),
+		GCQueueSuccesses:                            metric.NewCounter(metaGCQueueSuccesses),
+		GCQueueFailures:                             metric.NewCounter(metaGCQueueFailures),
+		GCQueuePending:                              metric.NewGauge(metaGCQueuePending),
+		GCQueueProcessingNanos:                      metric.NewCounter(metaGCQueueProcessingNanos),
+		GCQueuePurgatory:                            metric.NewGauge(metaGCQueuePurgatory),
+		GCQueueProcessingLatency:                    metric.NewLatency(metaGCQueueProcessingLatency, sampleInterval),
+		RaftLogQueueSuccesses:                       metric.NewCounter(metaRaftLogQueueSuccesses),
+		RaftLogQueueFailures:                        metric.NewCounter(metaRaftLogQueueFailures),
+		RaftLogQueuePending:                         metric.NewGauge(metaRaftLogQueuePending),
+		RaftLogQueueProcessingNanos:                 metric.NewCounter(metaRaftLogQueueProcessingNanos),
+		RaftLogQueuePurgatory:                       metric.NewGauge(metaRaftLogQueuePurgatory),
+		RaftLogQueueProcessingLatency:               metric.NewLatency(metaRaftLogQueueProcessingLatency, sampleInterval),
+		ConsistencyQueueSuccesses:                   metric.NewCounter(metaConsistencyQueueSuccesses),
+		ConsistencyQueueFailures:                    metric.NewCounter(metaConsistencyQueueFailures),
+		ConsistencyQueuePending:                     metric.NewGauge(metaConsistencyQueuePending),
+		ConsistencyQueueProcessingNanos:             metric.NewCounter(metaConsistencyQueueProcessingNanos),
+		ConsistencyQueuePurgatory:                   metric.NewGauge(metaConsistencyQueuePurgatory),
+		ConsistencyQueueProcessingLatency:           metric.NewLatency(metaConsistencyQueueProcessingLatency, sampleInterval),
+		ReplicaGCQueueSuccesses:                     metric.NewCounter(metaReplicaGCQueueSuccesses),
+		ReplicaGCQueueFailures:                      metric.NewCounter(metaReplicaGCQueueFailures),
+		ReplicaGCQueuePending:                       metric.NewGauge(metaReplicaGCQueuePending),
+		ReplicaGCQueueProcessingNanos:               metric.NewCounter(metaReplicaGCQueueProcessingNanos),
+		ReplicaGCQueuePurgatory:                     metric.NewGauge(metaReplicaGCQueuePurgatory),
+		ReplicaGCQueueProcessingLatency:             metric.NewLatency(metaReplicaGCQueueProcessingLatency, sampleInterval),
+		ReplicateQueueSuccesses:                     metric.NewCounter(metaReplicateQueueSuccesses),
+		ReplicateQueueFailures:                      metric.NewCounter(metaReplicateQueueFailures),
+		ReplicateQueuePending:                       metric.NewGauge(metaReplicateQueuePending),
+		ReplicateQueueProcessingNanos:               metric.NewCounter(metaReplicateQueueProcessingNanos),
+		ReplicateQueuePurgatory:                     metric.NewGauge(metaReplicateQueuePurgatory),
+		ReplicateQueuePurgatoryNoTarget:             metric.NewGauge(metaReplicateQueuePurgatoryNoTarget),
+		ReplicateQueuePurgatoryThrottled:            metric.NewGauge(metaReplicateQueuePurgatoryThrottled),
+		ReplicateQueuePurgatoryLeaseNotHeld:         metric.NewGauge(metaReplicateQueuePurgatoryLeaseNotHeld),
+		ReplicateQueueProcessingLatency:             metric.NewLatency(metaReplicateQueueProcessingLatency, sampleInterval),
+		SplitQueueSuccesses:                         metric.NewCounter(metaSplitQueueSuccesses),
+		SplitQueueFailures:                          metric.NewCounter(metaSplitQueueFailures),
+		SplitQueuePending:                           metric.NewGauge(metaSplitQueuePending),
+		SplitQueueProcessingNanos:                   metric.NewCounter(metaSplitQueueProcessingNanos),
+		SplitQueuePurgatory:                         metric.NewGauge(metaSplitQueuePurgatory),
+		SplitQueueProcessingLatency:                 metric.NewLatency(metaSplitQueueProcessingLatency, sampleInterval),
+		TimeSeriesMaintenanceQueueSuccesses:         metric.NewCounter(metaTimeSeriesMaintenanceQueueSuccesses),
+		TimeSeriesMaintenanceQueueFailures:          metric.NewCounter(metaTimeSeriesMaintenanceQueueFailures),
+		TimeSeriesMaintenanceQueuePending:           metric.NewGauge(metaTimeSeriesMaintenanceQueuePending),
+		TimeSeriesMaintenanceQueueProcessingNanos:   metric.NewCounter(metaTimeSeriesMaintenanceQueueProcessingNanos),
+		TimeSeriesMaintenanceQueuePurgatory:         metric.NewGauge(metaTimeSeriesMaintenanceQueuePurgatory),
+		TimeSeriesMaintenanceQueueProcessingLatency: metric.NewLatency(metaTimeSeriesMaintenanceQueueProcessingLatency, sampleInterval),
 
 		// GCInfo cumulative totals.
 		GCNumKeysAffected:            metric.NewCounter(metaGCNumKeysAffected),
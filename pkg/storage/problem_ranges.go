@@ -0,0 +1,71 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+)
+
+// ProblemRange is a range with replicas on dead stores, as seen by one of its
+// replicas.
+type ProblemRange struct {
+	RangeID  roachpb.RangeID
+	Replicas int
+	// DeadReplicas are the range's replicas which are on dead stores or were
+	// reported dead by their store.
+	DeadReplicas []roachpb.ReplicaDescriptor
+	// CorrelatedDeadReplicas is the number of dead replicas which are on the
+	// same node as another dead replica of the range, and were thus most
+	// likely lost together to the failure of that node.
+	CorrelatedDeadReplicas int
+	// Unavailable is set if the range has lost its quorum.
+	Unavailable bool
+}
+
+type problemRangesByID []ProblemRange
+
+func (p problemRangesByID) Len() int           { return len(p) }
+func (p problemRangesByID) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p problemRangesByID) Less(i, j int) bool { return p[i].RangeID < p[j].RangeID }
+
+// ProblemRanges returns the ranges of the store's replicas which have
+// replicas on dead stores, sorted by range ID.
+func (s *Store) ProblemRanges() []ProblemRange {
+	sp := s.cfg.StorePool
+	if sp == nil {
+		return nil
+	}
+	var ranges []ProblemRange
+	newStoreReplicaVisitor(s).Visit(func(r *Replica) bool {
+		desc := r.Desc()
+		deadReplicas := sp.deadReplicas(desc.RangeID, desc.Replicas)
+		if len(deadReplicas) == 0 {
+			return true // more
+		}
+		liveReplicas := len(desc.Replicas) - len(deadReplicas)
+		ranges = append(ranges, ProblemRange{
+			RangeID:                desc.RangeID,
+			Replicas:               len(desc.Replicas),
+			DeadReplicas:           deadReplicas,
+			CorrelatedDeadReplicas: correlatedDeadReplicas(deadReplicas),
+			Unavailable:            liveReplicas < computeQuorum(len(desc.Replicas)),
+		})
+		return true // more
+	})
+	sort.Sort(problemRangesByID(ranges))
+	return ranges
+}
@@ -18,6 +18,8 @@ package storage
 
 import (
 	"container/heap"
+	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
@@ -27,6 +29,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/config"
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/metric"
@@ -50,7 +53,121 @@ const (
 // failure condition changes.
 type purgatoryError interface {
 	error
-	purgatoryErrorMarker() // dummy method for unique interface
+	// purgatoryClass returns why the replica is stuck.
+	purgatoryClass() purgatoryClass
+}
+
+// purgatoryClass classifies the replicas in purgatory by why they are stuck.
+// Each class has its own purgatory metric and retry interval.
+type purgatoryClass int
+
+const (
+	// purgatoryNoTarget is the class of replicas for which no store
+	// satisfies the constraints of their zone.
+	purgatoryNoTarget purgatoryClass = iota
+	// purgatoryStoreThrottled is the class of replicas for which the stores
+	// satisfying the constraints of their zone are all throttled.
+	purgatoryStoreThrottled
+	// purgatoryLeaseNotHeld is the class of replicas which couldn't obtain
+	// the range lease the queue needs.
+	purgatoryLeaseNotHeld
+	numPurgatoryClasses
+)
+
+var purgatoryClassNames = [numPurgatoryClasses]string{
+	purgatoryNoTarget:       "no-suitable-target",
+	purgatoryStoreThrottled: "store-throttled",
+	purgatoryLeaseNotHeld:   "lease-not-held",
+}
+
+func (c purgatoryClass) String() string {
+	if c >= 0 && c < numPurgatoryClasses {
+		return purgatoryClassNames[c]
+	}
+	return fmt.Sprintf("purgatoryClass(%d)", int(c))
+}
+
+// purgatoryRetryIntervals are the intervals after which the replicas in
+// purgatory are first retried, by class, if the queue's purgatoryChan isn't
+// signaled before; the intervals back off as the retries keep failing. Replicas without a suitable target mostly wait for new
+// stores, which signal purgatoryChan; throttled stores become available
+// again after a few seconds, and leases can be obtained again as soon as
+// the range is available.
+var purgatoryRetryIntervals = [numPurgatoryClasses]time.Duration{
+	purgatoryNoTarget:       time.Minute,
+	purgatoryStoreThrottled: 10 * time.Second,
+	purgatoryLeaseNotHeld:   30 * time.Second,
+}
+
+var (
+	// purgatorySignalBackoff is the minimum time a replica stays in purgatory
+	// after its first failure, even if purgatoryChan is signaled before. This
+	// keeps frequent signals, such as gossip updates, from retrying the
+	// replicas in a tight loop.
+	purgatorySignalBackoff = time.Second
+	// purgatoryMaxBackoff caps the exponential backoff of the replicas which
+	// keep failing in purgatory.
+	purgatoryMaxBackoff = 10 * time.Minute
+)
+
+// purgatoryBackoffJitter is the fraction of a purgatory backoff which is
+// randomized, so that the replicas which failed together aren't all
+// retried together.
+const purgatoryBackoffJitter = 0.25
+
+// purgatoryBackoff returns the backoff of a replica in purgatory which
+// failed the given number of retries: the base duration doubles with every
+// retry up to purgatoryMaxBackoff, minus a random jitter.
+func purgatoryBackoff(base time.Duration, retries int) time.Duration {
+	backoff := base
+	for i := 0; i < retries && backoff < purgatoryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > purgatoryMaxBackoff {
+		backoff = purgatoryMaxBackoff
+	}
+	return backoff - time.Duration(purgatoryBackoffJitter*rand.Float64()*float64(backoff))
+}
+
+// leaseNotHeldError is returned when a queue which needs the range lease
+// fails to obtain it for a reason other than another replica holding it.
+type leaseNotHeldError struct {
+	cause error
+}
+
+func (e *leaseNotHeldError) Error() string {
+	return fmt.Sprintf("could not obtain lease: %s", e.cause)
+}
+
+func (*leaseNotHeldError) purgatoryClass() purgatoryClass {
+	return purgatoryLeaseNotHeld
+}
+
+var _ purgatoryError = &leaseNotHeldError{}
+
+// purgatoryItem is a replica in purgatory.
+type purgatoryItem struct {
+	err purgatoryError
+	// retries is the number of times the replica was retried in purgatory
+	// and failed again.
+	retries int
+	// retryAt is when the replica is retried if the queue's purgatoryChan
+	// isn't signaled before.
+	retryAt time.Time
+	// minRetryAt is the earliest the replica is retried once the queue's
+	// purgatoryChan was signaled.
+	minRetryAt time.Time
+	// signaled is set when purgatoryChan is signaled while the replica is
+	// in purgatory.
+	signaled bool
+}
+
+// nextRetry returns when the replica in purgatory is due for a retry.
+func (pItem purgatoryItem) nextRetry() time.Time {
+	if pItem.signaled && pItem.minRetryAt.Before(pItem.retryAt) {
+		return pItem.minRetryAt
+	}
+	return pItem.retryAt
 }
 
 // A replicaItem holds a replica and its priority for use with a priority queue.
@@ -147,8 +264,15 @@ type queueConfig struct {
 	// want to try to replicate a range until we know which zone it is in and
 	// therefore how many replicas are required).
 	acceptsUnsplitRanges bool
+	// enabled, if set, is the cluster setting which turns the queue on and
+	// off at runtime. While it is off, replicas are neither added to nor
+	// processed by the queue.
+	enabled *settings.BoolSetting
 	// processTimeout is the timeout for processing a replica.
 	processTimeout time.Duration
+	// paced controls whether the queue waits for the store's queue pacing
+	// budget before processing a replica; see queuePacingRangesPerSecond.
+	paced bool
 	// successes is a counter of replicas processed successfully.
 	successes *metric.Counter
 	// failures is a counter of replicas which failed processing.
@@ -157,8 +281,14 @@ type queueConfig struct {
 	pending *metric.Gauge
 	// processingNanos is a counter measuring total nanoseconds spent processing replicas.
 	processingNanos *metric.Counter
+	// processingLatency is a histogram of the time spent processing a
+	// replica. It is optional.
+	processingLatency *metric.Histogram
 	// purgatory is a gauge measuring current replica count in purgatory.
 	purgatory *metric.Gauge
+	// purgatoryClasses are gauges measuring the current replica count in
+	// purgatory, by purgatory class. They are optional.
+	purgatoryClasses [numPurgatoryClasses]*metric.Gauge
 }
 
 // baseQueue is the base implementation of the replicaQueue interface.
@@ -187,10 +317,10 @@ type baseQueue struct {
 	queueConfig
 	incoming chan struct{} // Channel signaled when a new replica is added to the queue.
 	mu       struct {
-		sync.Locker                                  // Protects all variables in the mu struct
-		priorityQ   priorityQueue                    // The priority queue
-		replicas    map[roachpb.RangeID]*replicaItem // Map from RangeID to replicaItem (for updating priority)
-		purgatory   map[roachpb.RangeID]error        // Map of replicas to processing errors
+		sync.Locker                                   // Protects all variables in the mu struct
+		priorityQ   priorityQueue                     // The priority queue
+		replicas    map[roachpb.RangeID]*replicaItem  // Map from RangeID to replicaItem (for updating priority)
+		purgatory   map[roachpb.RangeID]purgatoryItem // Map of replicas to processing errors
 		stopped     bool
 		// Some tests in this package disable queues.
 		disabled bool
@@ -265,6 +395,12 @@ func (bq *baseQueue) Disabled() bool {
 	return bq.mu.disabled
 }
 
+// enabledBySetting returns false if the queue has been turned off through
+// its cluster setting.
+func (bq *baseQueue) enabledBySetting() bool {
+	return bq.enabled == nil || bq.enabled.Get()
+}
+
 // Start launches a goroutine to process entries in the queue. The
 // provided stopper is used to finish processing.
 func (bq *baseQueue) Start(clock *hlc.Clock, stopper *stop.Stopper) {
@@ -289,8 +425,15 @@ func (bq *baseQueue) Add(repl *Replica, priority float64) (bool, error) {
 // should be queued. Replicas are added to the queue using the priority
 // returned by bq.shouldQueue. If the queue is too full, the replica may
 // not be added, as the replica with the lowest priority will be
-// dropped.
-func (bq *baseQueue) MaybeAdd(repl *Replica, now hlc.Timestamp) {
+// dropped. It returns whether bq.shouldQueue asked for the replica to be
+// queued. Nothing is evaluated while the queue is turned off through its
+// cluster setting, so that turning off a queue whose shouldQueue is
+// expensive relieves the store right away.
+func (bq *baseQueue) MaybeAdd(repl *Replica, now hlc.Timestamp) bool {
+	if !bq.enabledBySetting() {
+		return false
+	}
+
 	// Load the system config.
 	cfg, cfgOk := bq.gossip.GetSystemConfig()
 	requiresSplit := cfgOk && bq.requiresSplit(cfg, repl)
@@ -299,31 +442,32 @@ func (bq *baseQueue) MaybeAdd(repl *Replica, now hlc.Timestamp) {
 	defer bq.mu.Unlock()
 
 	if bq.mu.stopped {
-		return
+		return false
 	}
 
 	if !repl.IsInitialized() {
-		return
+		return false
 	}
 
 	ctx := bq.AnnotateCtx(context.TODO())
 
 	if !cfgOk {
 		log.VEvent(ctx, 1, "no system config available. skipping")
-		return
+		return false
 	}
 
 	if requiresSplit {
 		// Range needs to be split due to zone configs, but queue does
 		// not accept unsplit ranges.
 		log.VEventf(ctx, 1, "%s: split needed; not adding", repl)
-		return
+		return false
 	}
 
 	should, priority := bq.impl.shouldQueue(ctx, now, repl, cfg)
 	if _, err := bq.addInternal(ctx, repl.Desc(), should, priority); !isExpectedQueueError(err) {
 		log.Errorf(ctx, "unable to add %s: %s", repl, err)
 	}
+	return should
 }
 
 func (bq *baseQueue) requiresSplit(cfg config.SystemConfig, repl *Replica) bool {
@@ -355,6 +499,11 @@ func (bq *baseQueue) addInternal(
 		return false, errQueueDisabled
 	}
 
+	if !bq.enabledBySetting() {
+		log.Event(ctx, "queue disabled by cluster setting")
+		return false, errQueueDisabled
+	}
+
 	if !desc.IsInitialized() {
 		// We checked this above in MaybeAdd(), but we need to check it
 		// again for Add().
@@ -458,11 +607,16 @@ func (bq *baseQueue) processLoop(clock *hlc.Clock, stopper *stop.Stopper) {
 			// Process replicas as the timer expires.
 			case <-nextTime:
 				repl := bq.pop()
+				if repl != nil && bq.paced {
+					if err := bq.store.waitForQueuePacing(ctx); err != nil {
+						return
+					}
+				}
 				if repl != nil {
 					if stopper.RunTask(func() {
 						if err := bq.processReplica(ctx, repl, clock); err != nil {
 							// Maybe add failing replica to purgatory if the queue supports it.
-							bq.maybeAddToPurgatory(ctx, repl, err, clock, stopper)
+							bq.maybeAddToPurgatory(ctx, repl, err, 0 /* retries */, clock, stopper)
 						}
 					}) != nil {
 						return
@@ -487,6 +641,11 @@ func (bq *baseQueue) processReplica(
 	bq.processMu.Lock()
 	defer bq.processMu.Unlock()
 
+	if !bq.enabledBySetting() {
+		log.VEventf(queueCtx, 3, "queue disabled by cluster setting; skipping")
+		return nil
+	}
+
 	// Load the system config.
 	cfg, ok := bq.gossip.GetSystemConfig()
 	if !ok {
@@ -521,7 +680,7 @@ func (bq *baseQueue) processReplica(
 				log.VEventf(queueCtx, 3, "not holding lease; skipping")
 				return nil
 			}
-			return errors.Wrapf(err.GoError(), "%s: could not obtain lease", repl)
+			return errors.Wrapf(&leaseNotHeldError{cause: err.GoError()}, "%s", repl)
 		}
 		log.Event(ctx, "got range lease")
 	}
@@ -531,6 +690,9 @@ func (bq *baseQueue) processReplica(
 	err := bq.impl.process(ctx, clock.Now(), repl, cfg)
 	duration := timeutil.Since(start)
 	bq.processingNanos.Inc(duration.Nanoseconds())
+	if bq.processingLatency != nil {
+		bq.processingLatency.RecordValue(duration.Nanoseconds())
+	}
 	if err != nil {
 		return err
 	}
@@ -540,21 +702,54 @@ func (bq *baseQueue) processReplica(
 	return nil
 }
 
+// processManually has the queue process the replica right away, bypassing
+// the queue, unless shouldQueue says the replica doesn't need to be processed
+// and skipShouldQueue isn't set. It returns what shouldQueue returned,
+// whether the replica was processed, and the error processing it returned.
+// Failures are counted, but the replica isn't put in purgatory. This is
+// meant for diagnosing why the queue does or doesn't act on a replica; the
+// caller typically collects the trace of ctx.
+func (bq *baseQueue) processManually(
+	ctx context.Context, repl *Replica, clock *hlc.Clock, skipShouldQueue bool,
+) (should bool, priority float64, processed bool, err error) {
+	cfg, ok := bq.gossip.GetSystemConfig()
+	if !ok {
+		return false, 0, false, errors.Errorf("no system config available")
+	}
+	should, priority = bq.impl.shouldQueue(ctx, clock.Now(), repl, cfg)
+	log.Eventf(ctx, "shouldQueue=%t, priority=%.2f", should, priority)
+	if !should && !skipShouldQueue {
+		return should, priority, false, nil
+	}
+	if err := bq.processReplica(ctx, repl, clock); err != nil {
+		bq.failures.Inc(1)
+		return should, priority, true, err
+	}
+	return should, priority, true, nil
+}
+
 // maybeAddToPurgatory possibly adds the specified replica to the
 // purgatory queue, which holds replicas which have failed
 // processing. To be added, the failing error must implement
 // purgatoryError and the queue implementation must have its own
 // mechanism for signaling re-processing of replicas held in
-// purgatory.
+// purgatory. The replica's retries in purgatory back off exponentially
+// with the number of retries it already failed.
 func (bq *baseQueue) maybeAddToPurgatory(
-	ctx context.Context, repl *Replica, triggeringErr error, clock *hlc.Clock, stopper *stop.Stopper,
+	ctx context.Context,
+	repl *Replica,
+	triggeringErr error,
+	retries int,
+	clock *hlc.Clock,
+	stopper *stop.Stopper,
 ) {
 	// Increment failures metric here to capture all error returns from
 	// process().
 	bq.failures.Inc(1)
 
 	// Check whether the failure is a purgatory error and whether the queue supports it.
-	if _, ok := triggeringErr.(purgatoryError); !ok || bq.impl.purgatoryChan() == nil {
+	pErr, ok := errors.Cause(triggeringErr).(purgatoryError)
+	if !ok || bq.impl.purgatoryChan() == nil {
 		log.Errorf(ctx, "on %s: %s", repl, triggeringErr)
 		return
 	}
@@ -566,81 +761,143 @@ func (bq *baseQueue) maybeAddToPurgatory(
 		return
 	}
 
-	log.Errorf(ctx, "(purgatory) on %s: %s", repl, triggeringErr)
+	log.Errorf(ctx, "(purgatory: %s) on %s: %s", pErr.purgatoryClass(), repl, triggeringErr)
 
 	item := &replicaItem{value: repl.RangeID}
 	bq.mu.replicas[repl.RangeID] = item
 
-	defer func() {
-		bq.purgatory.Update(int64(len(bq.mu.purgatory)))
-	}()
+	defer bq.updatePurgatoryMetricsLocked()
+
+	now := timeutil.Now()
+	pItem := purgatoryItem{
+		err:        pErr,
+		retries:    retries,
+		retryAt:    now.Add(purgatoryBackoff(purgatoryRetryIntervals[pErr.purgatoryClass()], retries)),
+		minRetryAt: now.Add(purgatoryBackoff(purgatorySignalBackoff, retries)),
+	}
 
 	// If purgatory already exists, just add to the map and we're done.
 	if bq.mu.purgatory != nil {
-		bq.mu.purgatory[repl.RangeID] = triggeringErr
+		bq.mu.purgatory[repl.RangeID] = pItem
 		return
 	}
 
 	// Otherwise, create purgatory and start processing.
-	bq.mu.purgatory = map[roachpb.RangeID]error{
-		repl.RangeID: triggeringErr,
+	bq.mu.purgatory = map[roachpb.RangeID]purgatoryItem{
+		repl.RangeID: pItem,
 	}
 
 	stopper.RunWorker(func() {
 		ctx := bq.AnnotateCtx(context.Background())
 		ticker := time.NewTicker(purgatoryReportInterval)
+		defer ticker.Stop()
+		var retryTimer timeutil.Timer
+		defer retryTimer.Stop()
 		for {
+			retryTimer.Reset(bq.nextPurgatoryRetry())
 			select {
 			case <-bq.impl.purgatoryChan():
-				// Remove all items from purgatory into a copied slice.
-				bq.mu.Lock()
-				ranges := make([]roachpb.RangeID, 0, len(bq.mu.purgatory))
-				for rangeID := range bq.mu.purgatory {
-					item := bq.mu.replicas[rangeID]
-					ranges = append(ranges, item.value)
-					bq.remove(item)
-				}
-				bq.mu.Unlock()
-				for _, id := range ranges {
-					repl, err := bq.store.GetReplica(id)
-					if err != nil {
-						log.Errorf(ctx, "range %s no longer exists on store: %s", id, err)
-						return
-					}
-					if stopper.RunTask(func() {
-						if err := bq.processReplica(ctx, repl, clock); err != nil {
-							bq.maybeAddToPurgatory(ctx, repl, err, clock, stopper)
-						}
-					}) != nil {
-						return
-					}
-				}
+				// Mark the replicas currently in purgatory for a retry as soon as
+				// their backoff allows it.
 				bq.mu.Lock()
-				if len(bq.mu.purgatory) == 0 {
-					log.Infof(ctx, "purgatory is now empty")
-					bq.mu.purgatory = nil
-					bq.mu.Unlock()
-					return
+				for rangeID, pItem := range bq.mu.purgatory {
+					pItem.signaled = true
+					bq.mu.purgatory[rangeID] = pItem
 				}
 				bq.mu.Unlock()
+			case <-retryTimer.C:
+				retryTimer.Read = true
 			case <-ticker.C:
 				// Report purgatory status.
 				bq.mu.Lock()
 				errMap := map[string]int{}
-				for _, err := range bq.mu.purgatory {
-					errMap[err.Error()]++
+				for _, item := range bq.mu.purgatory {
+					errMap[fmt.Sprintf("(%s) %s", item.err.purgatoryClass(), item.err)]++
 				}
 				bq.mu.Unlock()
 				for errStr, count := range errMap {
 					log.Errorf(ctx, "%d replicas failing with %q", count, errStr)
 				}
+				continue
 			case <-stopper.ShouldStop():
 				return
 			}
+
+			// Remove the items due for a retry from purgatory into a copied map,
+			// along with the number of retries they already failed.
+			now := timeutil.Now()
+			bq.mu.Lock()
+			ranges := map[roachpb.RangeID]int{}
+			for rangeID, pItem := range bq.mu.purgatory {
+				if pItem.nextRetry().After(now) {
+					continue
+				}
+				ranges[rangeID] = pItem.retries
+				bq.remove(bq.mu.replicas[rangeID])
+			}
+			bq.mu.Unlock()
+			for id, retries := range ranges {
+				repl, err := bq.store.GetReplica(id)
+				if err != nil {
+					log.Errorf(ctx, "range %s no longer exists on store: %s", id, err)
+					continue
+				}
+				if bq.paced {
+					if err := bq.store.waitForQueuePacing(ctx); err != nil {
+						return
+					}
+				}
+				if stopper.RunTask(func() {
+					if err := bq.processReplica(ctx, repl, clock); err != nil {
+						bq.maybeAddToPurgatory(ctx, repl, err, retries+1, clock, stopper)
+					}
+				}) != nil {
+					return
+				}
+			}
+			bq.mu.Lock()
+			if len(bq.mu.purgatory) == 0 {
+				log.Infof(ctx, "purgatory is now empty")
+				bq.mu.purgatory = nil
+				bq.mu.Unlock()
+				return
+			}
+			bq.mu.Unlock()
 		}
 	})
 }
 
+// nextPurgatoryRetry returns the duration until the earliest retry of a
+// replica in purgatory.
+func (bq *baseQueue) nextPurgatoryRetry() time.Duration {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	var next time.Time
+	for _, item := range bq.mu.purgatory {
+		if retryAt := item.nextRetry(); next.IsZero() || retryAt.Before(next) {
+			next = retryAt
+		}
+	}
+	return next.Sub(timeutil.Now())
+}
+
+// updatePurgatoryMetricsLocked updates the purgatory gauges. Expects mutex to
+// be locked.
+func (bq *baseQueue) updatePurgatoryMetricsLocked() {
+	bq.purgatory.Update(int64(len(bq.mu.purgatory)))
+	var counts [numPurgatoryClasses]int64
+	for _, item := range bq.mu.purgatory {
+		if c := item.err.purgatoryClass(); c >= 0 && c < numPurgatoryClasses {
+			counts[c]++
+		}
+	}
+	for c, gauge := range bq.purgatoryClasses {
+		if gauge != nil {
+			gauge.Update(counts[c])
+		}
+	}
+}
+
 // pop dequeues the highest priority replica, if any, in the queue. Expects
 // mutex to be locked.
 func (bq *baseQueue) pop() *Replica {
@@ -673,7 +930,7 @@ func (bq *baseQueue) add(item *replicaItem) {
 func (bq *baseQueue) remove(item *replicaItem) {
 	if _, ok := bq.mu.purgatory[item.value]; ok {
 		delete(bq.mu.purgatory, item.value)
-		bq.purgatory.Update(int64(len(bq.mu.purgatory)))
+		bq.updatePurgatoryMetricsLocked()
 	} else {
 		heap.Remove(&bq.mu.priorityQ, item.index)
 		bq.pending.Update(int64(bq.mu.priorityQ.Len()))
@@ -0,0 +1,157 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/settings"
+)
+
+// The following settings turn the store queues and the replica scanner on
+// and off across the cluster. They allow an operator to freeze automatic
+// replica movement temporarily, e.g. during a controlled recovery or
+// migration. A queue or scanner disabled on a store through
+// StoreConfig.DisabledQueues stays disabled regardless of these settings.
+var (
+	gcQueueEnabled = settings.RegisterBoolSetting(
+		"kv.gc_queue.enabled", "if set, the GC queue is enabled", true)
+	splitQueueEnabled = settings.RegisterBoolSetting(
+		"kv.split_queue.enabled", "if set, the split queue is enabled", true)
+	replicateQueueEnabled = settings.RegisterBoolSetting(
+		"kv.replicate_queue.enabled", "if set, the replicate queue is enabled", true)
+	replicaGCQueueEnabled = settings.RegisterBoolSetting(
+		"kv.replica_gc_queue.enabled", "if set, the replica GC queue is enabled", true)
+	raftLogQueueEnabled = settings.RegisterBoolSetting(
+		"kv.raft_log_queue.enabled", "if set, the Raft log truncation queue is enabled", true)
+	timeSeriesMaintenanceQueueEnabled = settings.RegisterBoolSetting(
+		"kv.timeseries_maintenance_queue.enabled",
+		"if set, the time series maintenance queue is enabled", true)
+	consistencyQueueEnabled = settings.RegisterBoolSetting(
+		"kv.consistency_queue.enabled", "if set, the consistency checker queue is enabled", true)
+	scannerEnabled = settings.RegisterBoolSetting(
+		"kv.scanner.enabled", "if set, the replica scanner offers replicas to the store queues", true)
+)
+
+// Names of the store queues and of the replica scanner, as accepted by
+// StoreConfig.DisabledQueues and the --disable-queues flag.
+const (
+	gcQueueName                    = "gc"
+	splitQueueName                 = "split"
+	replicateQueueName             = "replicate"
+	replicaGCQueueName             = "replicagc"
+	raftLogQueueName               = "raftlog"
+	timeSeriesMaintenanceQueueName = "tsmaintenance"
+	consistencyQueueName           = "consistency"
+	scannerName                    = "scanner"
+)
+
+var queueNames = []string{
+	gcQueueName,
+	splitQueueName,
+	replicateQueueName,
+	replicaGCQueueName,
+	raftLogQueueName,
+	timeSeriesMaintenanceQueueName,
+	consistencyQueueName,
+	scannerName,
+}
+
+// QueueNames returns the sorted names of the queues which can be disabled
+// through StoreConfig.DisabledQueues.
+func QueueNames() []string {
+	names := append([]string(nil), queueNames...)
+	sort.Strings(names)
+	return names
+}
+
+// ParseDisabledQueues parses a comma-separated list of queue names, as
+// passed to the --disable-queues flag. Names are case-insensitive and
+// surrounding whitespace is ignored.
+func ParseDisabledQueues(s string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !isQueueName(name) {
+			return nil, errors.Errorf("unknown queue %q; valid queues are: %s",
+				name, strings.Join(QueueNames(), ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func isQueueName(name string) bool {
+	for _, n := range queueNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setQueueActive turns the named queue, or the replica scanner, on or off on
+// the store. It returns an error if the name is unknown. Queues which the
+// store doesn't run are ignored.
+func (s *Store) setQueueActive(name string, active bool) error {
+	var q *baseQueue
+	switch name {
+	case gcQueueName:
+		if s.gcQueue != nil {
+			q = s.gcQueue.baseQueue
+		}
+	case splitQueueName:
+		if s.splitQueue != nil {
+			q = s.splitQueue.baseQueue
+		}
+	case replicateQueueName:
+		if s.replicateQueue != nil {
+			q = s.replicateQueue.baseQueue
+		}
+	case replicaGCQueueName:
+		if s.replicaGCQueue != nil {
+			q = s.replicaGCQueue.baseQueue
+		}
+	case raftLogQueueName:
+		if s.raftLogQueue != nil {
+			q = s.raftLogQueue.baseQueue
+		}
+	case timeSeriesMaintenanceQueueName:
+		if s.tsMaintenanceQueue != nil {
+			q = s.tsMaintenanceQueue.baseQueue
+		}
+	case consistencyQueueName:
+		if s.replicaConsistencyQueue != nil {
+			q = s.replicaConsistencyQueue.baseQueue
+		}
+	case scannerName:
+		if s.scanner != nil {
+			s.setScannerActive(active)
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown queue %q", name)
+	}
+	if q != nil {
+		q.SetDisabled(!active)
+	}
+	return nil
+}
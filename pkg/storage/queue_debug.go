@@ -0,0 +1,110 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"strings"
+
+	basictracer "github.com/opentracing/basictracer-go"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+)
+
+// queues returns the store's queues. Queues which weren't created, such as
+// the time series maintenance queue of a store without a time series data
+// store, are left out.
+func (s *Store) queues() []*baseQueue {
+	var queues []*baseQueue
+	if s.gcQueue != nil {
+		queues = append(queues, s.gcQueue.baseQueue)
+	}
+	if s.splitQueue != nil {
+		queues = append(queues, s.splitQueue.baseQueue)
+	}
+	if s.replicateQueue != nil {
+		queues = append(queues, s.replicateQueue.baseQueue)
+	}
+	if s.replicaGCQueue != nil {
+		queues = append(queues, s.replicaGCQueue.baseQueue)
+	}
+	if s.raftLogQueue != nil {
+		queues = append(queues, s.raftLogQueue.baseQueue)
+	}
+	if s.tsMaintenanceQueue != nil {
+		queues = append(queues, s.tsMaintenanceQueue.baseQueue)
+	}
+	if s.replicaConsistencyQueue != nil {
+		queues = append(queues, s.replicaConsistencyQueue.baseQueue)
+	}
+	return queues
+}
+
+// ManuallyEnqueue has the named queue process the range's replica right away,
+// bypassing the queue and the replica scanner, and returns what the queue
+// made of it along with the collected trace; see
+// baseQueue.processManually. Queue names are matched case-insensitively.
+func (s *Store) ManuallyEnqueue(
+	ctx context.Context, queueName string, rangeID roachpb.RangeID, skipShouldQueue bool,
+) (EnqueueRangeResponse, error) {
+	var queue *baseQueue
+	var names []string
+	for _, bq := range s.queues() {
+		if strings.EqualFold(bq.name, queueName) {
+			queue = bq
+		}
+		names = append(names, bq.name)
+	}
+	if queue == nil {
+		return EnqueueRangeResponse{}, errors.Errorf(
+			"unknown queue %q; the queues are: %s", queueName, strings.Join(names, ", "))
+	}
+	repl, err := s.GetReplica(rangeID)
+	if err != nil {
+		return EnqueueRangeResponse{}, err
+	}
+
+	var mu struct {
+		syncutil.Mutex
+		spans []basictracer.RawSpan
+	}
+	sp, err := tracing.JoinOrNewSnowball("manual enqueue", nil, func(rawSpan basictracer.RawSpan) {
+		mu.Lock()
+		mu.spans = append(mu.spans, rawSpan)
+		mu.Unlock()
+	})
+	if err != nil {
+		return EnqueueRangeResponse{}, err
+	}
+	ctx = opentracing.ContextWithSpan(queue.AnnotateCtx(ctx), sp)
+
+	var resp EnqueueRangeResponse
+	var processErr error
+	resp.ShouldQueue, resp.Priority, resp.Processed, processErr = queue.processManually(
+		ctx, repl, s.cfg.Clock, skipShouldQueue)
+	if processErr != nil {
+		resp.Error = processErr.Error()
+	}
+	sp.Finish()
+
+	mu.Lock()
+	resp.Trace = tracing.FormatRawSpans(mu.spans)
+	mu.Unlock()
+	return resp, nil
+}
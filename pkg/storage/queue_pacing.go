@@ -0,0 +1,133 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// queuePacingRangesPerSecond is the rate at which the paced queues of a
+// store, namely the replicate, GC and raft log queues, process replicas
+// altogether. The queues share the budget, so that background maintenance
+// can't starve foreground traffic however many of them have work to do.
+var queuePacingRangesPerSecond = settings.RegisterFloatSetting(
+	"kv.queue.pacing.ranges_per_second",
+	"rate at which the replicate, GC and raft log queues of a store process replicas "+
+		"altogether; 0 disables the pacing",
+	0,
+)
+
+// queuePacingSnapshotBytesPerSecond is the rate at which a store sends
+// snapshots altogether. Unlike kv.snapshot.max_rate, which limits the rate
+// of each snapshot stream, it bounds the bandwidth used by the snapshots
+// the store sends concurrently.
+var queuePacingSnapshotBytesPerSecond = settings.RegisterIntSetting(
+	"kv.queue.pacing.snapshot_bytes_per_second",
+	"rate at which a store sends snapshots altogether; 0 disables the pacing",
+	0,
+)
+
+// pacingBudget paces the consumption of a resource by several consumers to
+// a shared rate. Consumers reserve the resource before using it, and wait
+// until the resource reserved before them has been paid off.
+type pacingBudget struct {
+	syncutil.Mutex
+	// next is the time at which the resource reserved so far is paid off.
+	next time.Time
+}
+
+// reserve charges cost units of the resource to the budget, at the given
+// rate per second, and returns how long the caller has to wait before using
+// them. Nothing is charged if the rate isn't positive.
+func (b *pacingBudget) reserve(now time.Time, cost, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	wait := b.next.Sub(now)
+	b.next = b.next.Add(time.Duration(cost / rate * float64(time.Second)))
+	return wait
+}
+
+// queuePacing holds the pacing budgets shared by the paced queues of a
+// store.
+type queuePacing struct {
+	ranges        pacingBudget
+	snapshotBytes pacingBudget
+}
+
+// waitForQueuePacing waits until a paced queue may process a replica. The
+// queues aren't paced within the maintenance window.
+func (s *Store) waitForQueuePacing(ctx context.Context) error {
+	now := timeutil.Now()
+	if inMaintenanceWindow(now) {
+		return nil
+	}
+	return s.waitForPacing(ctx, s.queuePacing.ranges.reserve(
+		now, 1, queuePacingRangesPerSecond.Get()))
+}
+
+// waitForSnapshotPacing waits until a snapshot of the given type and size
+// may be sent. Snapshots aren't paced within the maintenance window. Only
+// rebalancing snapshots wait for their turn: recovery and raft snapshots are
+// charged to the budget, which holds off the rebalancing snapshots sent after
+// them, but are sent right away so that repairs don't queue behind routine
+// moves.
+func (s *Store) waitForSnapshotPacing(
+	ctx context.Context, typ ReplicaMovementType, bytes int64,
+) error {
+	now := timeutil.Now()
+	if inMaintenanceWindow(now) {
+		return nil
+	}
+	wait := s.queuePacing.snapshotBytes.reserve(
+		now, float64(bytes), float64(queuePacingSnapshotBytesPerSecond.Get()))
+	if typ != MovementRebalance {
+		return nil
+	}
+	return s.waitForPacing(ctx, wait)
+}
+
+func (s *Store) waitForPacing(ctx context.Context, wait time.Duration) error {
+	if wait <= 0 {
+		return nil
+	}
+	s.metrics.QueuePacingWaitNanos.Inc(wait.Nanoseconds())
+	log.Eventf(ctx, "paced for %s", wait)
+	var timer timeutil.Timer
+	defer timer.Stop()
+	timer.Reset(wait)
+	select {
+	case <-timer.C:
+		timer.Read = true
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.stopper.ShouldQuiesce():
+		return &roachpb.NodeUnavailableError{}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestPacingBudget(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var b pacingBudget
+	now := time.Unix(0, 0)
+	testCases := []struct {
+		at         time.Duration
+		cost, rate float64
+		expected   time.Duration
+	}{
+		// Nothing is reserved while the pacing is disabled.
+		{0, 10, 0, 0},
+		// The first reservation proceeds right away, the next ones wait for the
+		// previous ones to be paid off.
+		{0, 10, 10, 0},
+		{0, 5, 10, time.Second},
+		{500 * time.Millisecond, 1, 10, time.Second},
+		// The budget doesn't accumulate while it's unused.
+		{5 * time.Second, 10, 10, 0},
+		{5 * time.Second, 1, 10, time.Second},
+		// A higher rate only applies to the new reservations.
+		{5 * time.Second, 100, 100, 1100 * time.Millisecond},
+	}
+	for i, c := range testCases {
+		if wait := b.reserve(now.Add(c.at), c.cost, c.rate); wait != c.expected {
+			t.Errorf("%d: expected wait %s, got %s", i, c.expected, wait)
+		}
+	}
+}
@@ -19,6 +19,8 @@ package storage
 import (
 	"container/heap"
 	"fmt"
+	"reflect"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -30,6 +32,8 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
@@ -277,6 +281,82 @@ func TestBaseQueueAdd(t *testing.T) {
 	}
 }
 
+// TestBaseQueueEnabledSetting verifies that a queue turned off through its
+// cluster setting doesn't accept replicas until the setting is turned back
+// on.
+func TestBaseQueueEnabledSetting(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	r, err := tc.store.GetReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var evaluated int32
+	testQueue := &testQueueImpl{
+		shouldQueueFn: func(now hlc.Timestamp, r *Replica) (shouldQueue bool, priority float64) {
+			atomic.AddInt32(&evaluated, 1)
+			return true, 1.0
+		},
+	}
+	bq := makeTestBaseQueue("test", testQueue, tc.store, tc.gossip,
+		queueConfig{maxSize: 1, enabled: replicateQueueEnabled})
+
+	resetEnabled := settings.TestingSetBool(replicateQueueEnabled, false)
+	defer resetEnabled()
+	if _, err := bq.Add(r, 1.0); errors.Cause(err) != errQueueDisabled {
+		t.Fatalf("expected %q, got %v", errQueueDisabled, err)
+	}
+	bq.MaybeAdd(r, hlc.ZeroTimestamp)
+	if bq.Length() != 0 {
+		t.Fatalf("expected length 0; got %d", bq.Length())
+	}
+	if n := atomic.LoadInt32(&evaluated); n != 0 {
+		t.Fatalf("expected shouldQueue not to be evaluated while disabled; got %d calls", n)
+	}
+
+	resetEnabled()
+	if added, err := bq.Add(r, 1.0); err != nil || !added {
+		t.Fatalf("expected Add to succeed: %t, %s", added, err)
+	}
+	if bq.Length() != 1 {
+		t.Fatalf("expected length 1; got %d", bq.Length())
+	}
+}
+
+func TestParseDisabledQueues(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		in       string
+		expected []string
+		err      string
+	}{
+		{"", nil, ""},
+		{"replicate", []string{"replicate"}, ""},
+		{" Replicate, gc ,,scanner", []string{"replicate", "gc", "scanner"}, ""},
+		{"replicate,rebalance", nil, `unknown queue "rebalance"`},
+	}
+	for _, c := range testCases {
+		names, err := ParseDisabledQueues(c.in)
+		if c.err != "" {
+			if !testutils.IsError(err, c.err) {
+				t.Errorf("%q: expected error %q, got %v", c.in, c.err, err)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(names, c.expected) {
+			t.Errorf("%q: expected %v, got %v", c.in, c.expected, names)
+		}
+	}
+}
+
 // TestBaseQueueProcess verifies that items from the queue are
 // processed according to the timer function.
 func TestBaseQueueProcess(t *testing.T) {
@@ -360,6 +440,74 @@ func TestBaseQueueProcess(t *testing.T) {
 	close(testQueue.blocker)
 }
 
+// TestBaseQueueProcessManually verifies that a replica is processed right
+// away by processManually if shouldQueue says so or if it is told to skip
+// shouldQueue.
+func TestBaseQueueProcessManually(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	r, err := tc.store.GetReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var should bool
+	testQueue := &testQueueImpl{
+		shouldQueueFn: func(now hlc.Timestamp, r *Replica) (bool, float64) {
+			return should, 1
+		},
+	}
+	bq := makeTestBaseQueue("test", testQueue, tc.store, tc.gossip, queueConfig{})
+
+	testCases := []struct {
+		should, skipShouldQueue bool
+		err                     error
+		expProcessed            bool
+	}{
+		{should: false, skipShouldQueue: false, expProcessed: false},
+		{should: true, skipShouldQueue: false, expProcessed: true},
+		{should: false, skipShouldQueue: true, expProcessed: true},
+		{should: true, err: errors.New("boom"), expProcessed: true},
+	}
+	var expProcessed int
+	for i, c := range testCases {
+		should = c.should
+		testQueue.err = c.err
+		failures := bq.failures.Count()
+		resShould, _, processed, err := bq.processManually(
+			context.Background(), r, tc.clock, c.skipShouldQueue)
+		if resShould != c.should || processed != c.expProcessed || !testutils.IsError(err, "boom") != (c.err == nil) {
+			t.Errorf("%d: expected should=%t processed=%t err=%v; got %t, %t, %v",
+				i, c.should, c.expProcessed, c.err, resShould, processed, err)
+		}
+		if processed {
+			expProcessed++
+		}
+		if pc := testQueue.getProcessed(); pc != expProcessed {
+			t.Errorf("%d: expected %d processed replicas; got %d", i, expProcessed, pc)
+		}
+		if c.err != nil && bq.failures.Count() != failures+1 {
+			t.Errorf("%d: expected the failure to be counted", i)
+		}
+	}
+
+	// Store.ManuallyEnqueue finds queues by name and returns the trace.
+	if _, err := tc.store.ManuallyEnqueue(
+		context.Background(), "nonexistent", r.RangeID, false,
+	); !testutils.IsError(err, "unknown queue") {
+		t.Errorf("expected unknown queue error; got %v", err)
+	}
+	resp, err := tc.store.ManuallyEnqueue(context.Background(), "RaftLog", r.RangeID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ShouldQueue || resp.Processed || !strings.Contains(resp.Trace, "shouldQueue=false") {
+		t.Errorf("unexpected response %+v", resp)
+	}
+}
+
 // TestBaseQueueAddRemove adds then removes a range; ensure range is
 // not processed.
 func TestBaseQueueAddRemove(t *testing.T) {
@@ -516,13 +664,16 @@ func TestAcceptsUnsplitRanges(t *testing.T) {
 	})
 }
 
-type testError struct{}
+type testError struct {
+	class purgatoryClass
+}
 
 func (*testError) Error() string {
 	return "test error"
 }
 
-func (*testError) purgatoryErrorMarker() {
+func (e *testError) purgatoryClass() purgatoryClass {
+	return e.class
 }
 
 // TestBaseQueuePurgatory verifies that if error is set on the test
@@ -667,6 +818,98 @@ func TestBaseQueuePurgatory(t *testing.T) {
 	}
 }
 
+// TestBaseQueuePurgatoryRetryInterval verifies that replicas in purgatory are
+// retried once the retry interval of their purgatory class elapses, without
+// the purgatory channel being signaled, and that they are counted by class.
+func TestBaseQueuePurgatoryRetryInterval(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer func(intervals [numPurgatoryClasses]time.Duration) {
+		purgatoryRetryIntervals = intervals
+	}(purgatoryRetryIntervals)
+	purgatoryRetryIntervals[purgatoryStoreThrottled] = time.Millisecond
+
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	testQueue := &testQueueImpl{
+		shouldQueueFn: func(now hlc.Timestamp, r *Replica) (shouldQueue bool, priority float64) {
+			return true, float64(r.RangeID)
+		},
+		pChan: make(chan struct{}, 1),
+		err:   &testError{class: purgatoryStoreThrottled},
+	}
+
+	// Remove replica for range 1 since it encompasses the entire keyspace.
+	rng1, err := tc.store.GetReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.store.RemoveReplica(rng1, *rng1.Desc(), true); err != nil {
+		t.Fatal(err)
+	}
+
+	const replicaCount = 3
+	cfg := queueConfig{maxSize: replicaCount}
+	for c := range cfg.purgatoryClasses {
+		cfg.purgatoryClasses[c] = metric.NewGauge(metric.Metadata{Name: "test"})
+	}
+	bq := makeTestBaseQueue("test", testQueue, tc.store, tc.gossip, cfg)
+	bq.Start(tc.clock, tc.stopper)
+
+	for i := 1; i <= replicaCount; i++ {
+		r := createReplica(tc.store, roachpb.RangeID(i+1000),
+			roachpb.RKey(fmt.Sprintf("%d", i)), roachpb.RKey(fmt.Sprintf("%d/end", i)))
+		if err := tc.store.AddReplica(r); err != nil {
+			t.Fatal(err)
+		}
+		bq.MaybeAdd(r, hlc.ZeroTimestamp)
+	}
+
+	util.SucceedsSoon(t, func() error {
+		if pc := testQueue.getProcessed(); pc < replicaCount*3 {
+			return errors.Errorf("expected at least %d processed replicas; got %d", replicaCount*3, pc)
+		}
+		if l := bq.PurgatoryLength(); l != replicaCount {
+			return errors.Errorf("expected purgatory size of %d; got %d", replicaCount, l)
+		}
+		for c, gauge := range bq.purgatoryClasses {
+			expected := int64(0)
+			if purgatoryClass(c) == purgatoryStoreThrottled {
+				expected = replicaCount
+			}
+			if v := gauge.Value(); v != expected {
+				return errors.Errorf("expected %d %s purgatory replicas; got %d", expected, purgatoryClass(c), v)
+			}
+		}
+		return nil
+	})
+}
+
+func TestPurgatoryBackoff(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		base     time.Duration
+		retries  int
+		expected time.Duration
+	}{
+		{time.Second, 0, time.Second},
+		{time.Second, 1, 2 * time.Second},
+		{time.Second, 5, 32 * time.Second},
+		{time.Minute, 3, 8 * time.Minute},
+		{time.Minute, 4, purgatoryMaxBackoff},
+		{time.Minute, 1000, purgatoryMaxBackoff},
+	}
+	for i, c := range testCases {
+		backoff := purgatoryBackoff(c.base, c.retries)
+		min := c.expected - time.Duration(purgatoryBackoffJitter*float64(c.expected))
+		if backoff < min || backoff > c.expected {
+			t.Errorf("%d: expected backoff in [%s, %s], got %s", i, min, c.expected, backoff)
+		}
+	}
+}
+
 type processTimeoutQueueImpl struct {
 	testQueueImpl
 }
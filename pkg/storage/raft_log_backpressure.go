@@ -0,0 +1,216 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+)
+
+const (
+	// raftLogGrowthTimescale is the timescale of the moving averages of the
+	// rates at which raft log bytes are appended and truncated. It determines
+	// how long the raft logs have to outgrow truncation before writes are
+	// delayed.
+	raftLogGrowthTimescale = 10 * time.Second
+
+	// raftLogBackpressureInterval is the interval at which the total size of
+	// the raft logs on a store is recomputed.
+	raftLogBackpressureInterval = time.Second
+)
+
+// raftLogBackpressureThreshold is the total size of the raft logs on a store
+// above which writes start to be delayed, as long as the logs are growing
+// faster than they are truncated. The delay increases linearly until the
+// logs reach twice this size.
+var raftLogBackpressureThreshold = settings.RegisterIntSetting(
+	"kv.raft_log.backpressure_threshold",
+	"total size of the raft logs on a store above which writes are delayed if the logs outgrow truncation",
+	1<<30, // 1 GiB
+)
+
+// raftLogBackpressureMaxDelay is the delay applied to each write when the
+// backpressure is fully engaged. Setting it to zero disables the
+// backpressure.
+var raftLogBackpressureMaxDelay = settings.RegisterDurationSetting(
+	"kv.raft_log.backpressure_max_delay",
+	"maximum delay applied to writes by raft log growth backpressure; 0 disables the backpressure",
+	250*time.Millisecond,
+)
+
+// raftLogBackpressureShedding controls whether writes are rejected with a
+// suggested backoff, rather than delayed, once the raft logs on a store have
+// reached twice the backpressure threshold. Rejected writes don't tie up the
+// store while they wait, and are retried by the client once the backoff has
+// passed.
+var raftLogBackpressureShedding = settings.RegisterBoolSetting(
+	"kv.raft_log.backpressure_shedding.enabled",
+	"reject writes with a suggested backoff instead of delaying them once the raft logs "+
+		"on a store reach twice the backpressure threshold",
+	false,
+)
+
+// raftLogBackpressure tracks the rates at which raft log bytes are appended
+// and truncated on a store and derives the delay applied to new writes when
+// the raft logs are growing faster than they can be truncated.
+type raftLogBackpressure struct {
+	delayNanos   int64 // accessed atomically
+	saturated    int32 // accessed atomically
+	appendRate   *metric.Rate
+	truncateRate *metric.Rate
+}
+
+func newRaftLogBackpressure() *raftLogBackpressure {
+	return &raftLogBackpressure{
+		appendRate:   metric.NewRate(raftLogGrowthTimescale),
+		truncateRate: metric.NewRate(raftLogGrowthTimescale),
+	}
+}
+
+// recordAppend records bytes appended to a raft log.
+func (b *raftLogBackpressure) recordAppend(bytes int64) {
+	if bytes > 0 {
+		b.appendRate.Add(float64(bytes))
+	}
+}
+
+// recordTruncate records bytes removed from a raft log by a truncation.
+func (b *raftLogBackpressure) recordTruncate(bytes int64) {
+	if bytes > 0 {
+		b.truncateRate.Add(float64(bytes))
+	}
+}
+
+// delay returns the delay currently applied to writes.
+func (b *raftLogBackpressure) delay() time.Duration {
+	return time.Duration(atomic.LoadInt64(&b.delayNanos))
+}
+
+// isSaturated returns true if the backpressure is fully engaged, that is if
+// writes are delayed and the raft logs have reached twice the threshold.
+func (b *raftLogBackpressure) isSaturated() bool {
+	return atomic.LoadInt32(&b.saturated) == 1
+}
+
+// update recomputes the write delay given the total size of the raft logs
+// on the store and returns it.
+func (b *raftLogBackpressure) update(logBytes int64) time.Duration {
+	threshold := raftLogBackpressureThreshold.Get()
+	delay := computeRaftLogBackpressure(
+		logBytes, threshold, b.appendRate.Value(), b.truncateRate.Value(),
+		raftLogBackpressureMaxDelay.Get(),
+	)
+	var saturated int32
+	if delay > 0 && logBytes >= 2*threshold {
+		saturated = 1
+	}
+	atomic.StoreInt64(&b.delayNanos, int64(delay))
+	atomic.StoreInt32(&b.saturated, saturated)
+	return delay
+}
+
+// computeRaftLogBackpressure returns the delay to apply to writes. No delay
+// is applied while the raft logs are below threshold or are being truncated
+// at least as fast as they grow. Beyond that, the delay is proportional both
+// to how far the logs exceed the threshold and to the fraction of the
+// appended bytes which truncation fails to keep up with.
+func computeRaftLogBackpressure(
+	logBytes, threshold int64, appendRate, truncateRate float64, maxDelay time.Duration,
+) time.Duration {
+	if maxDelay <= 0 || threshold <= 0 || logBytes <= threshold || appendRate <= truncateRate {
+		return 0
+	}
+	excess := float64(logBytes-threshold) / float64(threshold)
+	if excess > 1 {
+		excess = 1
+	}
+	deficit := (appendRate - truncateRate) / appendRate
+	return time.Duration(float64(maxDelay) * excess * deficit)
+}
+
+// maybeBackpressureRaftLog delays the write batch if the raft logs on the
+// store are outgrowing truncation. Once the backpressure is saturated, the
+// batch is instead rejected with a ThrottledError if
+// kv.raft_log.backpressure_shedding.enabled is set. The suggested backoff is
+// the interval at which the backpressure is recomputed, since retrying any
+// sooner would be rejected again. Batches which are exempt from throttling,
+// such as the truncations which relieve the backpressure and any request to
+// the meta or system keys (including node liveness), are never delayed.
+func (s *Store) maybeBackpressureRaftLog(ctx context.Context, ba roachpb.BatchRequest) error {
+	delay := s.raftLogBackpressure.delay()
+	if delay == 0 || ba.IsReadOnly() || isThrottleExempt(ba) {
+		return nil
+	}
+	if raftLogBackpressureShedding.Get() && s.raftLogBackpressure.isSaturated() {
+		s.metrics.RaftLogBackpressureShed.Inc(1)
+		return roachpb.NewThrottledError(raftLogBackpressureInterval,
+			"raft logs on the store are outgrowing truncation")
+	}
+	s.metrics.RaftLogBackpressureThrottled.Inc(1)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.stopper.ShouldQuiesce():
+		return &roachpb.NodeUnavailableError{}
+	}
+}
+
+// updateRaftLogBackpressure recomputes the total size of the raft logs on the
+// store and the resulting write delay.
+func (s *Store) updateRaftLogBackpressure() {
+	var logBytes int64
+	newStoreReplicaVisitor(s).Visit(func(r *Replica) bool {
+		r.mu.Lock()
+		logBytes += r.mu.raftLogSize
+		r.mu.Unlock()
+		return true
+	})
+	delay := s.raftLogBackpressure.update(logBytes)
+
+	s.metrics.RaftLogTotalBytes.Update(logBytes)
+	s.metrics.RaftLogBackpressureDelayNanos.Update(int64(delay))
+	if delay > 0 {
+		s.metrics.RaftLogBackpressureActive.Update(1)
+	} else {
+		s.metrics.RaftLogBackpressureActive.Update(0)
+	}
+}
+
+// startRaftLogBackpressureLoop periodically updates the raft log growth
+// backpressure.
+func (s *Store) startRaftLogBackpressureLoop() {
+	s.stopper.RunWorker(func() {
+		ticker := time.NewTicker(raftLogBackpressureInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.updateRaftLogBackpressure()
+			case <-s.stopper.ShouldStop():
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestComputeRaftLogBackpressure(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	const threshold = 1000
+	const maxDelay = 100 * time.Millisecond
+	testCases := []struct {
+		logBytes                 int64
+		appendRate, truncateRate float64
+		maxDelay                 time.Duration
+		expected                 time.Duration
+	}{
+		// Below the threshold.
+		{500, 100, 0, maxDelay, 0},
+		{threshold, 100, 0, maxDelay, 0},
+		// Truncation keeps up with the appends.
+		{1500, 100, 100, maxDelay, 0},
+		{1500, 100, 200, maxDelay, 0},
+		// Backpressure disabled.
+		{1500, 100, 0, 0, 0},
+		// Nothing is truncated: the delay scales with the excess.
+		{1500, 100, 0, maxDelay, 50 * time.Millisecond},
+		{2000, 100, 0, maxDelay, maxDelay},
+		{5000, 100, 0, maxDelay, maxDelay},
+		// Truncation keeps up with half of the appends.
+		{2000, 100, 50, maxDelay, 50 * time.Millisecond},
+		{1500, 100, 50, maxDelay, 25 * time.Millisecond},
+	}
+	for i, c := range testCases {
+		if delay := computeRaftLogBackpressure(
+			c.logBytes, threshold, c.appendRate, c.truncateRate, c.maxDelay,
+		); delay != c.expected {
+			t.Errorf("%d: expected delay %s, got %s", i, c.expected, delay)
+		}
+	}
+}
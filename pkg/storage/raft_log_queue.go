@@ -27,6 +27,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 )
@@ -44,6 +45,16 @@ const (
 	RaftLogQueueStaleThreshold = 100
 )
 
+// raftLogSlowFollowerMultiplier is the multiple of the size of a range up to
+// which its Raft log is kept for a follower on a live store which is behind.
+// Catching such a follower up from the log avoids sending it a snapshot.
+var raftLogSlowFollowerMultiplier = settings.RegisterFloatSetting(
+	"kv.raft_log.slow_follower_size_multiplier",
+	"multiple of the range size up to which the Raft log is kept for a follower on a live "+
+		"store which is behind, so that it can catch up without a snapshot",
+	2,
+)
+
 // raftLogQueue manages a queue of replicas slated to have their raft logs
 // truncated by removing unneeded entries.
 type raftLogQueue struct {
@@ -60,12 +71,16 @@ func newRaftLogQueue(store *Store, db *client.DB, gossip *gossip.Gossip) *raftLo
 		"raftlog", rlq, store, gossip,
 		queueConfig{
 			maxSize:              raftLogQueueMaxSize,
+			enabled:              raftLogQueueEnabled,
 			needsLease:           false,
+			paced:                true,
 			acceptsUnsplitRanges: true,
 			successes:            store.metrics.RaftLogQueueSuccesses,
 			failures:             store.metrics.RaftLogQueueFailures,
 			pending:              store.metrics.RaftLogQueuePending,
 			processingNanos:      store.metrics.RaftLogQueueProcessingNanos,
+			purgatory:            store.metrics.RaftLogQueuePurgatory,
+			processingLatency:    store.metrics.RaftLogQueueProcessingLatency,
 		},
 	)
 	return rlq
@@ -105,13 +120,29 @@ func getTruncatableIndexes(ctx context.Context, r *Replica) (uint64, uint64, err
 	}
 	firstIndex, err := r.FirstIndex()
 	pendingSnapshotIndex := r.mu.pendingSnapshotIndex
+	desc := r.mu.state.Desc
 	r.mu.Unlock()
 	if err != nil {
 		return 0, 0, errors.Errorf("error retrieving first index for range %d: %s", rangeID, err)
 	}
+	// Behind followers on live stores are worth a larger log than the range.
+	if m := raftLogSlowFollowerMultiplier.Get(); m > 1 {
+		targetSize = int64(float64(targetSize) * m)
+	}
+	// Followers on dead stores are not waited for: they are going to be
+	// replaced, not caught up.
+	var deadReplicas map[uint64]bool
+	if sp := r.store.cfg.StorePool; sp != nil {
+		for _, repl := range sp.deadReplicas(rangeID, desc.Replicas) {
+			if deadReplicas == nil {
+				deadReplicas = make(map[uint64]bool)
+			}
+			deadReplicas[uint64(repl.ReplicaID)] = true
+		}
+	}
 
 	truncatableIndex := computeTruncatableIndex(
-		raftStatus, raftLogSize, targetSize, firstIndex, pendingSnapshotIndex)
+		raftStatus, raftLogSize, targetSize, firstIndex, pendingSnapshotIndex, deadReplicas)
 	// Return the number of truncatable indexes.
 	return truncatableIndex - firstIndex, truncatableIndex, nil
 }
@@ -121,8 +152,9 @@ func getTruncatableIndexes(ctx context.Context, r *Replica) (uint64, uint64, err
 // can catch up without having to send a full snapshot. However, if a node down
 // is down long enough, sending a snapshot is more efficient and we should
 // truncate the log to the next behind node or the quorum committed index. We
-// currently truncate when the raft log size is bigger than the range
-// size.
+// currently truncate when the raft log size is bigger than the target size.
+// The followers in deadReplicas, which are on dead stores, are never waited
+// for.
 //
 // Note that when a node is behind we continue to let the raft log build up
 // instead of truncating to the commit index. Consider what would happen if we
@@ -134,14 +166,17 @@ func getTruncatableIndexes(ctx context.Context, r *Replica) (uint64, uint64, err
 // and thus require another snapshot, likely entering a never ending loop of
 // snapshots. See #8629.
 func computeTruncatableIndex(
-	raftStatus *raft.Status, raftLogSize, targetSize int64, firstIndex, pendingSnapshotIndex uint64,
+	raftStatus *raft.Status,
+	raftLogSize, targetSize int64,
+	firstIndex, pendingSnapshotIndex uint64,
+	deadReplicas map[uint64]bool,
 ) uint64 {
 	truncatableIndex := raftStatus.Commit
 	if raftLogSize <= targetSize {
 		// Only truncate to one of the behind indexes if the raft log is less than
 		// the target size. If the raft log is greater than the target size we
 		// always truncate to the quorum commit index.
-		truncatableIndex = getBehindIndex(raftStatus)
+		truncatableIndex = getBehindIndex(raftStatus, deadReplicas)
 		// The pending snapshot index acts as a placeholder for a replica that is
 		// about to be added to the range. We don't want to truncate the log in a
 		// way that will require that new replica to be caught up via a Raft
@@ -161,12 +196,20 @@ func computeTruncatableIndex(
 	return truncatableIndex
 }
 
-// getBehindIndex returns the raft log index of the oldest node or the quorum
-// commit index if all nodes are caught up.
-func getBehindIndex(raftStatus *raft.Status) uint64 {
+// getBehindIndex returns the raft log index of the oldest node which isn't in
+// deadReplicas, or the quorum commit index if all those nodes are caught up. A
+// node which is being sent a Raft snapshot counts at the index of the
+// snapshot, the oldest entry it needs once it has applied it.
+func getBehindIndex(raftStatus *raft.Status, deadReplicas map[uint64]bool) uint64 {
 	behind := raftStatus.Commit
-	for _, progress := range raftStatus.Progress {
+	for id, progress := range raftStatus.Progress {
+		if deadReplicas[id] {
+			continue
+		}
 		index := progress.Match
+		if progress.State == raft.ProgressStateSnapshot && progress.PendingSnapshot > index {
+			index = progress.PendingSnapshot
+		}
 		if behind > index {
 			behind = index
 		}
@@ -174,9 +217,25 @@ func getBehindIndex(raftStatus *raft.Status) uint64 {
 	return behind
 }
 
+// needsAppliedStateMigration returns whether the range should be migrated to
+// the range applied state key, which the raft leader does through the
+// truncation of its log.
+func needsAppliedStateMigration(r *Replica) bool {
+	if !appliedStateKeyEnabled.Get() {
+		return false
+	}
+	if raftStatus := r.RaftStatus(); raftStatus == nil || raftStatus.RaftState != raft.StateLeader {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !r.mu.state.UsingAppliedStateKey
+}
+
 // shouldQueue determines whether a range should be queued for truncating. This
 // is true only if the replica is the raft leader and if the total number of
-// the range's raft log's stale entries exceeds RaftLogQueueStaleThreshold.
+// the range's raft log's stale entries exceeds RaftLogQueueStaleThreshold, or
+// if the range is to be migrated to the range applied state key.
 func (rlq *raftLogQueue) shouldQueue(
 	ctx context.Context, now hlc.Timestamp, r *Replica, _ config.SystemConfig,
 ) (shouldQ bool, priority float64) {
@@ -186,12 +245,15 @@ func (rlq *raftLogQueue) shouldQueue(
 		return false, 0
 	}
 
-	return truncatableIndexes >= RaftLogQueueStaleThreshold, float64(truncatableIndexes)
+	shouldQ = truncatableIndexes >= RaftLogQueueStaleThreshold || needsAppliedStateMigration(r)
+	return shouldQ, float64(truncatableIndexes)
 }
 
 // process truncates the raft log of the range if the replica is the raft
 // leader and if the total number of the range's raft log's stale entries
-// exceeds RaftLogQueueStaleThreshold.
+// exceeds RaftLogQueueStaleThreshold. A range which is to be migrated to the
+// range applied state key is migrated along with the truncation, or on its
+// own if there is nothing to truncate.
 func (rlq *raftLogQueue) process(
 	ctx context.Context, now hlc.Timestamp, r *Replica, _ config.SystemConfig,
 ) error {
@@ -199,16 +261,21 @@ func (rlq *raftLogQueue) process(
 	if err != nil {
 		return err
 	}
+	migrate := needsAppliedStateMigration(r)
 
 	// Can and should the raft logs be truncated?
-	if truncatableIndexes >= RaftLogQueueStaleThreshold {
+	if truncatableIndexes >= RaftLogQueueStaleThreshold || migrate {
+		if migrate {
+			log.VEventf(ctx, 1, "migrating to the range applied state key")
+		}
 		log.VEventf(ctx, 1, "truncating raft log %d-%d",
 			oldestIndex-truncatableIndexes, oldestIndex)
 		b := &client.Batch{}
 		b.AddRawRequest(&roachpb.TruncateLogRequest{
-			Span:    roachpb.Span{Key: r.Desc().StartKey.AsRawKey()},
-			Index:   oldestIndex,
-			RangeID: r.RangeID,
+			Span:                roachpb.Span{Key: r.Desc().StartKey.AsRawKey()},
+			Index:               oldestIndex,
+			RangeID:             r.RangeID,
+			MigrateAppliedState: migrate,
 		})
 		return rlq.db.Run(ctx, b)
 	}
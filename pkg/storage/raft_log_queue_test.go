@@ -55,7 +55,7 @@ func TestGetBehindIndex(t *testing.T) {
 		for j, v := range c.progress {
 			status.Progress[uint64(j)] = raft.Progress{Match: v}
 		}
-		out := getBehindIndex(status)
+		out := getBehindIndex(status, nil /* deadReplicas */)
 		if !reflect.DeepEqual(c.expected, out) {
 			t.Errorf("%d: getBehindIndex(...) expected %d, but got %d", i, c.expected, out)
 		}
@@ -98,13 +98,45 @@ func TestComputeTruncatableIndex(t *testing.T) {
 		for j, v := range c.progress {
 			status.Progress[uint64(j)] = raft.Progress{Match: v}
 		}
-		out := computeTruncatableIndex(status, c.raftLogSize, targetSize, c.firstIndex, c.pendingSnapshot)
+		out := computeTruncatableIndex(
+			status, c.raftLogSize, targetSize, c.firstIndex, c.pendingSnapshot, nil /* deadReplicas */)
 		if !reflect.DeepEqual(c.expected, out) {
 			t.Errorf("%d: computeTruncatableIndex(...) expected %d, but got %d", i, c.expected, out)
 		}
 	}
 }
 
+// TestGetBehindIndexFollowerState verifies that followers on dead stores are
+// not waited for, and that followers being sent a snapshot are waited for up
+// to the index of the snapshot.
+func TestGetBehindIndexFollowerState(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	status := &raft.Status{
+		Progress: map[uint64]raft.Progress{
+			1: {Match: 10},
+			2: {Match: 7},
+			3: {Match: 2, State: raft.ProgressStateSnapshot, PendingSnapshot: 5},
+		},
+	}
+	status.Commit = 10
+
+	testCases := []struct {
+		dead     map[uint64]bool
+		expected uint64
+	}{
+		{nil, 5},
+		{map[uint64]bool{3: true}, 7},
+		{map[uint64]bool{2: true}, 5},
+		{map[uint64]bool{2: true, 3: true}, 10},
+	}
+	for i, c := range testCases {
+		if out := getBehindIndex(status, c.dead); out != c.expected {
+			t.Errorf("%d: getBehindIndex(...) expected %d, but got %d", i, c.expected, out)
+		}
+	}
+}
+
 // TestGetTruncatableIndexes verifies that old raft log entries are correctly
 // removed.
 func TestGetTruncatableIndexes(t *testing.T) {
@@ -601,8 +601,69 @@ func (t *RaftTransport) SendSnapshot(
 	snap *OutgoingSnapshot,
 	newBatch func() engine.Batch,
 ) error {
-	var stream MultiRaft_RaftSnapshotClient
 	nodeID := header.RaftMessageRequest.ToReplica.NodeID
+	stream, err := t.openSnapshotStream(ctx, nodeID)
+	if err != nil {
+		return err
+	}
+	defer t.closeSnapshotStream(ctx, stream)
+	return sendSnapshot(ctx, stream, storePool, header, snap, newBatch)
+}
+
+// DelegateSnapshot asks the replica the header is addressed to to send its
+// own snapshot of the range to the header's DelegatedTarget, and waits until
+// the target has applied it.
+func (t *RaftTransport) DelegateSnapshot(ctx context.Context, header SnapshotRequest_Header) error {
+	nodeID := header.RaftMessageRequest.ToReplica.NodeID
+	stream, err := t.openSnapshotStream(ctx, nodeID)
+	if err != nil {
+		return err
+	}
+	defer t.closeSnapshotStream(ctx, stream)
+	return requestDelegatedSnapshot(stream, header)
+}
+
+// SendSnapshots streams the given outgoing snapshot to each of the recipients
+// described by headers, reading the snapshot only once. It returns the outcome
+// for each recipient. The caller is responsible for closing the
+// OutgoingSnapshot with snap.Close.
+func (t *RaftTransport) SendSnapshots(
+	ctx context.Context,
+	storePool *StorePool,
+	headers []SnapshotRequest_Header,
+	snap *OutgoingSnapshot,
+	newBatch func() engine.Batch,
+) []error {
+	errs := make([]error, len(headers))
+	var streams []OutgoingSnapshotStream
+	var streamHeaders []SnapshotRequest_Header
+	var streamIdxs []int
+	for i, header := range headers {
+		stream, err := t.openSnapshotStream(ctx, header.RaftMessageRequest.ToReplica.NodeID)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		defer t.closeSnapshotStream(ctx, stream)
+		streams = append(streams, stream)
+		streamHeaders = append(streamHeaders, header)
+		streamIdxs = append(streamIdxs, i)
+	}
+	if len(streams) == 0 {
+		return errs
+	}
+	for j, err := range sendSnapshotToAll(ctx, streams, storePool, streamHeaders, snap, newBatch) {
+		errs[streamIdxs[j]] = err
+	}
+	return errs
+}
+
+// openSnapshotStream dials the given node and opens a snapshot stream to it,
+// guarded by the node's circuit breaker.
+func (t *RaftTransport) openSnapshotStream(
+	ctx context.Context, nodeID roachpb.NodeID,
+) (snapshotClientWithBreaker, error) {
+	var stream MultiRaft_RaftSnapshotClient
 	breaker := t.GetCircuitBreaker(nodeID)
 	if err := breaker.Call(func() error {
 		addr, err := t.resolver(nodeID)
@@ -617,17 +678,17 @@ func (t *RaftTransport) SendSnapshot(
 		stream, err = client.RaftSnapshot(ctx)
 		return err
 	}, 0); err != nil {
-		return err
+		return snapshotClientWithBreaker{}, err
+	}
+	return snapshotClientWithBreaker{
+		MultiRaft_RaftSnapshotClient: stream,
+		breaker:                      breaker,
+	}, nil
+}
+
+func (t *RaftTransport) closeSnapshotStream(ctx context.Context, stream snapshotClientWithBreaker) {
+	if err := stream.CloseSend(); err != nil {
+		log.Warningf(ctx, "failed to close snapshot stream: %s", err)
+		stream.breaker.Fail()
 	}
-	defer func() {
-		if err := stream.CloseSend(); err != nil {
-			log.Warningf(ctx, "failed to close snapshot stream: %s", err)
-			breaker.Fail()
-		}
-	}()
-	return sendSnapshot(ctx,
-		snapshotClientWithBreaker{
-			MultiRaft_RaftSnapshotClient: stream,
-			breaker: breaker,
-		}, storePool, header, snap, newBatch)
 }
@@ -0,0 +1,158 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/cache"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// rebalanceReversalWindow is how long the allocator refuses to reverse a
+// rebalancing move, that is to move a replica back to the store it was
+// moved away from. Without it, replicas of ranges on stores whose range
+// counts are close to the mean can ping-pong between stores as the counts
+// fluctuate. Zero disables the check.
+var rebalanceReversalWindow = settings.RegisterDurationSetting(
+	"kv.allocator.rebalance_reversal_window",
+	"minimum time before the allocator moves a replica back to the store it was rebalanced away from",
+	5*time.Minute,
+)
+
+// rebalanceHistorySize is the number of ranges whose most recent move a
+// rebalanceHistory remembers.
+const rebalanceHistorySize = 10000
+
+// maxRebalanceOperations is the number of most recent moves a
+// rebalanceHistory reports on as RebalanceOperations.
+const maxRebalanceOperations = 100
+
+// rebalanceMove is a rebalancing move of a replica of a range from one store
+// to another. A move is made of the addition of the replica on the target
+// store followed by the removal of the replica on the source store; until
+// the latter happens, from is zero.
+type rebalanceMove struct {
+	from, to roachpb.StoreID
+	at       time.Time
+}
+
+// RebalanceOperation reports on a rebalancing move started by the replicate
+// queue of one of the node's stores.
+type RebalanceOperation struct {
+	RangeID roachpb.RangeID
+	// From is zero until the replica has been removed from the source store,
+	// which completes the move.
+	From, To  roachpb.StoreID
+	Started   time.Time
+	Completed time.Time
+}
+
+// FractionCompleted returns the progress of the move: the addition of the
+// replica on the target store is half of it.
+func (o RebalanceOperation) FractionCompleted() float64 {
+	if o.Completed.IsZero() {
+		return 0.5
+	}
+	return 1
+}
+
+// rebalanceHistory remembers the most recent rebalancing move of each range,
+// for a bounded number of ranges.
+type rebalanceHistory struct {
+	mu    syncutil.Mutex
+	cache *cache.UnorderedCache
+	// ops holds the most recent moves, oldest first.
+	ops []RebalanceOperation
+}
+
+func newRebalanceHistory(size int) *rebalanceHistory {
+	return &rebalanceHistory{
+		cache: cache.NewUnorderedCache(cache.Config{
+			Policy: cache.CacheLRU,
+			ShouldEvict: func(s int, key, value interface{}) bool {
+				return s > size
+			},
+		}),
+	}
+}
+
+// recordAdd records the start of a move of a replica of the range to the
+// given store.
+func (h *rebalanceHistory) recordAdd(rangeID roachpb.RangeID, to roachpb.StoreID, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cache.Add(rangeID, rebalanceMove{to: to, at: now})
+	h.ops = append(h.ops, RebalanceOperation{RangeID: rangeID, To: to, Started: now})
+	if len(h.ops) > maxRebalanceOperations {
+		h.ops = h.ops[len(h.ops)-maxRebalanceOperations:]
+	}
+}
+
+// recordRemove records the removal of a replica of the range from the given
+// store. It completes the range's move if one was started and not yet
+// completed, and is ignored otherwise: the removal isn't part of a
+// rebalancing move.
+func (h *rebalanceHistory) recordRemove(
+	rangeID roachpb.RangeID, from roachpb.StoreID, now time.Time,
+) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	v, ok := h.cache.Get(rangeID)
+	if !ok {
+		return
+	}
+	move := v.(rebalanceMove)
+	if move.from != 0 || move.to == from {
+		return
+	}
+	move.from = from
+	h.cache.Add(rangeID, move)
+	for i := len(h.ops) - 1; i >= 0; i-- {
+		if op := &h.ops[i]; op.RangeID == rangeID {
+			if op.Completed.IsZero() && op.To == move.to {
+				op.From, op.Completed = from, now
+			}
+			break
+		}
+	}
+}
+
+// operations returns the most recent moves, oldest first.
+func (h *rebalanceHistory) operations() []RebalanceOperation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]RebalanceOperation(nil), h.ops...)
+}
+
+// recent returns the most recent move of the range if it was started within
+// the given window before now.
+func (h *rebalanceHistory) recent(
+	rangeID roachpb.RangeID, now time.Time, window time.Duration,
+) (rebalanceMove, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	v, ok := h.cache.Get(rangeID)
+	if !ok {
+		return rebalanceMove{}, false
+	}
+	move := v.(rebalanceMove)
+	if now.Sub(move.at) >= window {
+		return rebalanceMove{}, false
+	}
+	return move, true
+}
@@ -0,0 +1,104 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestRebalanceHistory(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	h := newRebalanceHistory(2)
+	now := time.Unix(1000, 0)
+	const window = time.Minute
+
+	// A removal which isn't part of a move is ignored.
+	h.recordRemove(1, 1, now)
+	if move, ok := h.recent(1, now, window); ok {
+		t.Fatalf("expected no move, got %+v", move)
+	}
+
+	h.recordAdd(1, 2, now)
+	if move, ok := h.recent(1, now, window); !ok || move.from != 0 || move.to != 2 {
+		t.Fatalf("expected a move to s2, got %+v", move)
+	}
+	// Removing the replica which was just added doesn't complete the move.
+	h.recordRemove(1, 2, now)
+	h.recordRemove(1, 3, now)
+	// Only the first removal after the addition completes the move.
+	h.recordRemove(1, 4, now)
+	if move, ok := h.recent(1, now.Add(window-1), window); !ok || move.from != 3 || move.to != 2 {
+		t.Fatalf("expected a move from s3 to s2, got %+v", move)
+	}
+	if move, ok := h.recent(1, now.Add(window), window); ok {
+		t.Fatalf("expected the move to have expired, got %+v", move)
+	}
+
+	// The least recently used range is forgotten.
+	h.recordAdd(2, 1, now)
+	h.recordAdd(3, 1, now)
+	if _, ok := h.recent(1, now, window); ok {
+		t.Fatal("expected the move of r1 to have been evicted")
+	}
+	for _, rangeID := range []roachpb.RangeID{2, 3} {
+		if _, ok := h.recent(rangeID, now, window); !ok {
+			t.Errorf("expected a move of r%d", rangeID)
+		}
+	}
+}
+
+func TestRebalanceHistoryOperations(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	h := newRebalanceHistory(rebalanceHistorySize)
+	start := time.Unix(1000, 0)
+	end := start.Add(time.Minute)
+
+	for i := 0; i < maxRebalanceOperations+1; i++ {
+		h.recordAdd(roachpb.RangeID(i+1), 2, start)
+	}
+	h.recordRemove(2, 1, end)
+	// Removing the replica which was just added doesn't complete the move.
+	h.recordRemove(3, 2, end)
+
+	ops := h.operations()
+	if len(ops) != maxRebalanceOperations {
+		t.Fatalf("expected %d operations, got %d", maxRebalanceOperations, len(ops))
+	}
+	// The oldest move was forgotten.
+	if ops[0].RangeID != 2 {
+		t.Fatalf("expected the first operation to move r2, got %+v", ops[0])
+	}
+	expected := RebalanceOperation{RangeID: 2, From: 1, To: 2, Started: start, Completed: end}
+	if ops[0] != expected {
+		t.Errorf("expected %+v, got %+v", expected, ops[0])
+	}
+	if f := ops[0].FractionCompleted(); f != 1 {
+		t.Errorf("expected the completed move to be done, got %.2f", f)
+	}
+	for _, op := range ops[1:] {
+		if !op.Completed.IsZero() || op.From != 0 {
+			t.Errorf("expected r%d's move to be in progress, got %+v", op.RangeID, op)
+		}
+		if f := op.FractionCompleted(); f != 0.5 {
+			t.Errorf("expected r%d's move to be half done, got %.2f", op.RangeID, f)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"math"
+	"time"
+)
+
+// rebalanceProgressWindow is the period over which the StorePool measures
+// how fast the cluster converges towards a balanced state. Rebalancing moves
+// which haven't completed within it are no longer considered in progress.
+const rebalanceProgressWindow = 10 * time.Minute
+
+// ClusterBalance describes how evenly the replicas and leases of the cluster
+// are spread across its alive stores. Ephemeral stores are left out.
+type ClusterBalance struct {
+	Stores         int
+	MeanRangeCount float64
+	MeanLeaseCount float64
+	// RangeImbalance and LeaseImbalance are the largest deviation of a
+	// store's range and lease count from the mean, as a fraction of the mean.
+	RangeImbalance float64
+	LeaseImbalance float64
+	// ExcessReplicas is the number of replicas which have to move for no
+	// store to hold more than mean*(1+RebalanceThreshold) replicas, beyond
+	// which the allocator rebalances a store's replicas away. The cluster
+	// has converged once it is zero.
+	ExcessReplicas int64
+}
+
+// clusterBalanceLocked computes the balance of the stores known to the
+// StorePool. sp.mu must be held, for reading at least.
+func (sp *StorePool) clusterBalanceLocked() ClusterBalance {
+	var b ClusterBalance
+	var ranges, leases float64
+	for _, detail := range sp.mu.storeDetails {
+		if detail.dead || detail.desc == nil || detail.desc.Ephemeral {
+			continue
+		}
+		b.Stores++
+		ranges += float64(detail.desc.Capacity.RangeCount)
+		leases += float64(detail.desc.Capacity.LeaseCount)
+	}
+	if b.Stores == 0 {
+		return b
+	}
+	b.MeanRangeCount = ranges / float64(b.Stores)
+	b.MeanLeaseCount = leases / float64(b.Stores)
+	target := int64(math.Ceil(b.MeanRangeCount * (1 + RebalanceThreshold.Get())))
+	for _, detail := range sp.mu.storeDetails {
+		if detail.dead || detail.desc == nil || detail.desc.Ephemeral {
+			continue
+		}
+		c := detail.desc.Capacity
+		b.RangeImbalance = math.Max(b.RangeImbalance,
+			relativeDeviation(float64(c.RangeCount), b.MeanRangeCount))
+		b.LeaseImbalance = math.Max(b.LeaseImbalance,
+			relativeDeviation(float64(c.LeaseCount), b.MeanLeaseCount))
+		if excess := int64(c.RangeCount) - target; excess > 0 {
+			b.ExcessReplicas += excess
+		}
+	}
+	return b
+}
+
+// relativeDeviation returns the deviation of the value from the mean as a
+// fraction of the mean, or zero if the mean is zero.
+func relativeDeviation(value, mean float64) float64 {
+	if mean == 0 {
+		return 0
+	}
+	return math.Abs(value-mean) / mean
+}
+
+// balanceSample is the number of excess replicas in the cluster at a point
+// in time.
+type balanceSample struct {
+	at     time.Time
+	excess int64
+}
+
+// recordBalance records the number of excess replicas in the cluster and
+// forgets about the samples older than rebalanceProgressWindow.
+func (sp *StorePool) recordBalance(now time.Time, b ClusterBalance) {
+	sp.balanceSamples.Lock()
+	defer sp.balanceSamples.Unlock()
+	samples := append(sp.balanceSamples.samples, balanceSample{at: now, excess: b.ExcessReplicas})
+	for len(samples) > 1 && now.Sub(samples[0].at) > rebalanceProgressWindow {
+		samples = samples[1:]
+	}
+	sp.balanceSamples.samples = samples
+}
+
+// estimateConvergence returns the number of excess replicas by which the
+// cluster became more balanced per second over the recorded samples, which
+// is negative if it became less balanced, and the estimated time until it
+// has converged at that rate. The estimate is zero if the cluster has
+// converged, and negative if it isn't converging.
+func (sp *StorePool) estimateConvergence(now time.Time, excess int64) (float64, time.Duration) {
+	sp.balanceSamples.Lock()
+	defer sp.balanceSamples.Unlock()
+	var rate float64
+	if samples := sp.balanceSamples.samples; len(samples) > 0 {
+		if elapsed := now.Sub(samples[0].at); elapsed > 0 {
+			rate = float64(samples[0].excess-excess) / elapsed.Seconds()
+		}
+	}
+	switch {
+	case excess == 0:
+		return rate, 0
+	case rate <= 0:
+		return rate, -1
+	default:
+		return rate, time.Duration(float64(excess) / rate * float64(time.Second))
+	}
+}
+
+// RebalanceProgress reports on whether the cluster is converging towards a
+// balanced state and on the rebalancing moves made by the node's stores.
+type RebalanceProgress struct {
+	ClusterBalance
+	// ConvergenceRate is the number of excess replicas by which the cluster
+	// became more balanced per second over the last rebalanceProgressWindow.
+	ConvergenceRate float64
+	// ETA is the estimated time until the cluster has converged. It is zero
+	// if it has converged, and negative if it isn't converging.
+	ETA time.Duration
+	// Operations are the most recent rebalancing moves started by the
+	// replicate queues of the node's stores, oldest first.
+	Operations []RebalanceOperation
+}
+
+// GetRebalanceProgress returns the RebalanceProgress of the cluster as seen by
+// the StorePool.
+func (sp *StorePool) GetRebalanceProgress() RebalanceProgress {
+	sp.mu.RLock()
+	balance := sp.clusterBalanceLocked()
+	sp.mu.RUnlock()
+
+	p := RebalanceProgress{
+		ClusterBalance: balance,
+		Operations:     sp.rebalanceHistory.operations(),
+	}
+	p.ConvergenceRate, p.ETA = sp.estimateConvergence(
+		sp.clock.Now().GoTime(), balance.ExcessReplicas)
+	return p
+}
+
+// rebalancesInProgress returns the number of the given moves which were
+// started within rebalanceProgressWindow and haven't completed.
+func rebalancesInProgress(ops []RebalanceOperation, now time.Time) int64 {
+	var n int64
+	for _, op := range ops {
+		if op.Completed.IsZero() && now.Sub(op.Started) < rebalanceProgressWindow {
+			n++
+		}
+	}
+	return n
+}
+
+// updateBalanceMetrics updates the StorePool's balance gauges and records
+// the balance of the cluster to estimate its convergence.
+func (sp *StorePool) updateBalanceMetrics(now time.Time, balance ClusterBalance) {
+	_, eta := sp.estimateConvergence(now, balance.ExcessReplicas)
+	sp.recordBalance(now, balance)
+	sp.metrics.RangeImbalance.Update(balance.RangeImbalance)
+	sp.metrics.LeaseImbalance.Update(balance.LeaseImbalance)
+	sp.metrics.ExcessReplicas.Update(balance.ExcessReplicas)
+	sp.metrics.RebalanceETA.Update(eta.Nanoseconds())
+	sp.metrics.RebalancesInProgress.Update(
+		rebalancesInProgress(sp.rebalanceHistory.operations(), now))
+}
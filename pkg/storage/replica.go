@@ -164,6 +164,10 @@ type replicaChecksum struct {
 	notify chan struct{}
 	// Some debug output that can be added to the CollectChecksumResponse.
 	snapshot *roachpb.RaftSnapshotData
+	// The MVCCStats persisted by the replica at the snapshot, and the stats
+	// recomputed from the replica's data at the same time. The persisted stats
+	// are not part of the checksum and are compared separately.
+	persisted, recomputed enginepb.MVCCStats
 }
 
 type atomicDescString struct {
@@ -220,6 +224,9 @@ type Replica struct {
 	// via a raft message.
 	creatingReplica *roachpb.ReplicaDescriptor
 
+	// load tracks the batches served by the replica.
+	load *replicaLoad
+
 	// Held in read mode during read-only commands. Held in exclusive mode to
 	// prevent read-only commands from executing. Acquired before the embedded
 	// RWMutex.
@@ -249,6 +256,13 @@ type Replica struct {
 		//
 		// TODO(tschottdorf): remove/refactor this field.
 		corrupted bool
+		// The raft entry the range is halted on, if any. See
+		// commandContainmentEnabled. Persisted under RangePoisonedEntryKey.
+		poisoned *PoisonedEntry
+		// The index of a poisoned raft entry which was discarded by an
+		// operator and is to be applied as a no-op. Also persisted under
+		// RangePoisonedEntryKey until the replica is halted again.
+		discardIndex uint64
 		// Is the range quiescent? Quiescent ranges are not Tick()'d and unquiesce
 		// whenever a Raft operation is performed.
 		quiescent bool
@@ -289,6 +303,12 @@ type Replica struct {
 		// The ID of the leader replica within the Raft group. Used to determine
 		// when the leadership changes.
 		leaderID roachpb.ReplicaID
+		// removedDesc, if set, is the range descriptor which removed the
+		// replica with ID removedReplicaID from the range, as applied by the
+		// replica itself. It is definite evidence that the replica can be
+		// garbage collected; see confirmedRemoval.
+		removedDesc      *roachpb.RangeDescriptor
+		removedReplicaID roachpb.ReplicaID
 
 		// The last seen replica descriptors from incoming Raft messages. These are
 		// stored so that the replica still knows the replica descriptors for itself
@@ -484,6 +504,7 @@ func newReplica(rangeID roachpb.RangeID, store *Store) *Replica {
 		RangeID:        rangeID,
 		store:          store,
 		abortCache:     NewAbortCache(rangeID),
+		load:           newReplicaLoad(),
 	}
 
 	// Init rangeStr with the range ID.
@@ -583,6 +604,18 @@ func (r *Replica) initLocked(
 	r.mu.destroyed = pErr.GetDetail()
 	r.mu.corrupted = r.mu.destroyed != nil
 
+	poisoned, err := loadPoisonedEntry(ctx, r.store.Engine(), r.RangeID)
+	if err != nil {
+		return err
+	}
+	if poisoned != nil {
+		if !poisoned.Discarded {
+			r.haltLocked(poisoned)
+		} else if poisoned.Index > r.mu.state.RaftAppliedIndex {
+			r.mu.discardIndex = poisoned.Index
+		}
+	}
+
 	if replicaID == 0 {
 		repDesc, ok := desc.GetReplicaDescriptor(r.store.StoreID())
 		if !ok {
@@ -704,6 +737,13 @@ func (r *Replica) getLease() (*roachpb.Lease, *roachpb.Lease) {
 	return r.mu.state.Lease, nil
 }
 
+// OwnsValidLease returns whether this replica holds a lease which is valid at
+// the given timestamp.
+func (r *Replica) OwnsValidLease(ts hlc.Timestamp) bool {
+	lease, _ := r.getLease()
+	return lease != nil && lease.OwnedBy(r.store.StoreID()) && lease.Covers(ts)
+}
+
 // newNotLeaseHolderError returns a NotLeaseHolderError initialized with the
 // replica for the holder (if any) of the given lease.
 //
@@ -1048,6 +1088,7 @@ func (r *Replica) Send(
 	if err := r.checkBatchRequest(ba); err != nil {
 		return nil, roachpb.NewError(err)
 	}
+	r.load.record(ba, r.store.isRemoteGateway(ba.GatewayNodeID))
 	// Add the range log tag.
 	ctx = r.AnnotateCtx(ctx)
 	ctx, cleanup := tracing.EnsureContext(ctx, r.AmbientContext.Tracer)
@@ -1127,13 +1168,62 @@ func (r *Replica) checkBatchRequest(ba roachpb.BatchRequest) error {
 		if ba.ReadConsistency == roachpb.CONSENSUS {
 			return errors.Errorf("consensus reads not implemented")
 		}
-	} else if ba.ReadConsistency == roachpb.INCONSISTENT {
+		if ba.ReadConsistency == roachpb.READ_UNCOMMITTED {
+			if ba.Txn != nil {
+				return errors.Errorf("cannot allow read uncommitted reads within a transaction")
+			}
+			for _, union := range ba.Requests {
+				if _, ok := union.GetInner().(*roachpb.RangeLookupRequest); !ok {
+					return errors.Errorf("read uncommitted mode is only available to range lookups")
+				}
+			}
+		}
+	} else if ba.ReadConsistency.IsInconsistent() {
 		return errors.Errorf("inconsistent mode is only available to reads")
 	}
 
 	return nil
 }
 
+// validateCommandLocked verifies that a batch is well-formed before it is
+// proposed to Raft: its keys must be ordered and lie within the bounds of the
+// range, and its timestamp must be set and not ahead of the local clock by
+// more than the maximum clock offset. A command failing these checks would
+// fail (or worse) on every replica once applied, so it is rejected with a
+// MalformedCommandError instead. The replica lock must be held.
+func (r *Replica) validateCommandLocked(ba roachpb.BatchRequest) error {
+	if ba.Timestamp == hlc.ZeroTimestamp {
+		return roachpb.NewMalformedCommandError("batch has no timestamp")
+	}
+	clock := r.store.Clock()
+	if maxOffset := clock.MaxOffset(); maxOffset > 0 {
+		if offset := time.Duration(ba.Timestamp.WallTime - clock.PhysicalNow()); offset > maxOffset {
+			return roachpb.NewMalformedCommandError("batch timestamp %s is %s in the future",
+				ba.Timestamp, offset)
+		}
+	}
+	desc := r.mu.state.Desc
+	for i, union := range ba.Requests {
+		arg := union.GetInner()
+		if _, ok := arg.(*roachpb.NoopRequest); ok {
+			continue
+		}
+		header := arg.Header()
+		if err := verifyKeys(header.Key, header.EndKey, roachpb.IsRange(arg)); err != nil {
+			return roachpb.NewMalformedCommandError("request %d (%s): %s", i, arg.Method(), err)
+		}
+		span, err := keys.Range(roachpb.BatchRequest{Requests: ba.Requests[i : i+1]})
+		if err != nil {
+			return roachpb.NewMalformedCommandError("request %d (%s): %s", i, arg.Method(), err)
+		}
+		if !desc.ContainsKeyRange(span.Key, span.EndKey) {
+			return roachpb.NewMalformedCommandError("request %d (%s): span [%s,%s) is outside of range %s",
+				i, arg.Method(), span.Key, span.EndKey, desc)
+		}
+	}
+	return nil
+}
+
 // beginCmds waits for any overlapping, already-executing commands via
 // the command queue and adds itself to queues based on keys affected by the
 // batched commands. This gates subsequent commands with overlapping keys or
@@ -1146,7 +1236,7 @@ func (r *Replica) beginCmds(
 ) (func(*roachpb.BatchResponse, *roachpb.Error) *roachpb.Error, error) {
 	var cmd *cmd
 	// Don't use the command queue for inconsistent reads.
-	if ba.ReadConsistency != roachpb.INCONSISTENT {
+	if !ba.ReadConsistency.IsInconsistent() {
 		readOnly := ba.IsReadOnly()
 		spans := make([]roachpb.Span, len(ba.Requests))
 		for i, union := range ba.Requests {
@@ -1225,7 +1315,7 @@ func (r *Replica) endCmds(
 
 	// Only update the timestamp cache if the command succeeded and is
 	// marked as affecting the cache. Inconsistent reads are excluded.
-	if pErr == nil && ba.ReadConsistency != roachpb.INCONSISTENT {
+	if pErr == nil && !ba.ReadConsistency.IsInconsistent() {
 		cr := cacheRequest{
 			timestamp: ba.Timestamp,
 			txnID:     ba.GetTxnID(),
@@ -1385,6 +1475,10 @@ func (r *Replica) addAdminCmd(
 		var reply roachpb.AdminMergeResponse
 		reply, pErr = r.AdminMerge(ctx, *tArgs, r.Desc())
 		resp = &reply
+	case *roachpb.AdminUnsplitRequest:
+		var reply roachpb.AdminUnsplitResponse
+		reply, pErr = r.AdminUnsplit(ctx, *tArgs, r.Desc())
+		resp = &reply
 	case *roachpb.AdminTransferLeaseRequest:
 		pErr = roachpb.NewError(r.AdminTransferLease(tArgs.Target))
 		resp = &roachpb.AdminTransferLeaseResponse{}
@@ -1412,7 +1506,7 @@ func (r *Replica) addReadOnlyCmd(
 	ctx context.Context, ba roachpb.BatchRequest,
 ) (br *roachpb.BatchResponse, pErr *roachpb.Error) {
 	// If the read is consistent, the read requires the range lease.
-	if ba.ReadConsistency != roachpb.INCONSISTENT {
+	if !ba.ReadConsistency.IsInconsistent() {
 		if pErr = r.redirectOnOrAcquireLease(ctx); pErr != nil {
 			return nil, pErr
 		}
@@ -1528,6 +1622,14 @@ func (r *Replica) addWriteCmd(
 		}
 	}
 
+	// Only the leaseholder delays writes to an oversized range, since it's
+	// the one which splits it. Other replicas have redirected the batch to
+	// it above. The delay precedes the timestamp cache checks, so that the
+	// write isn't evaluated at a stale timestamp.
+	if err := r.maybeBackpressureWriteBatch(ctx, ba); err != nil {
+		return nil, roachpb.NewError(err)
+	}
+
 	if !isNonKV {
 		// Examine the read and write timestamp caches for preceding
 		// commands which require this command to move its timestamp
@@ -1661,11 +1763,29 @@ func (r *Replica) propose(
 	if r.mu.destroyed != nil {
 		return nil, nil, r.mu.destroyed
 	}
+	// Don't bother proposing the command if the client has given up on it
+	// while we waited for the locks.
+	if err := ctx.Err(); err != nil {
+		r.store.metrics.RaftCommandsAbandonedDropped.Inc(1)
+		return nil, nil, err
+	}
 	repDesc, err := r.getReplicaDescriptorLocked()
 	if err != nil {
 		return nil, nil, err
 	}
+	if err := r.validateCommandLocked(ba); err != nil {
+		r.store.metrics.RaftCommandsMalformed.Inc(1)
+		log.Warningf(ctx, "rejecting %s: %s", ba.Summary(), err)
+		return nil, nil, err
+	}
 	pCmd := r.evaluateProposalLocked(ctx, makeIDKey(), repDesc, ba)
+	if maxSize := storagebase.MaxCommandSize.Get(); maxSize > 0 {
+		// The DistSender splits oversized batches where it can, so a command
+		// above the limit can't be split any further.
+		if size := int64(pCmd.RaftCommand.Size()); size > maxSize {
+			return nil, nil, roachpb.NewCommandTooLargeError(size, maxSize)
+		}
+	}
 	r.insertProposalLocked(pCmd)
 
 	if err := r.submitProposalLocked(pCmd); err != nil {
@@ -1674,9 +1794,17 @@ func (r *Replica) propose(
 	}
 	tryAbandon := func() bool {
 		r.mu.Lock()
-		_, ok := r.mu.proposals[pCmd.idKey]
-		delete(r.mu.proposals, pCmd.idKey)
-		r.mu.Unlock()
+		defer r.mu.Unlock()
+		p, ok := r.mu.proposals[pCmd.idKey]
+		if ok && !p.abandoned {
+			// The command stays pending so that we know it was abandoned when
+			// it applies, or drop it when it would have to be proposed again.
+			// It must not refer to the client's context any more, whose trace
+			// is finished when the client returns.
+			p.abandoned = true
+			p.ctx = r.AnnotateCtx(context.TODO())
+			r.store.metrics.RaftCommandsAbandoned.Inc(1)
+		}
 		return ok
 	}
 	return pCmd.done, tryAbandon, nil
@@ -1837,6 +1965,7 @@ func (r *Replica) handleRaftReadyRaftMuLocked(inSnap IncomingSnapshot) error {
 
 	lastIndex := r.mu.lastIndex // used for append below
 	raftLogSize := r.mu.raftLogSize
+	prevRaftLogSize := raftLogSize
 	leaderID := r.mu.leaderID
 	err := r.withRaftGroupLocked(false, func(raftGroup *raft.RawNode) (bool, error) {
 		if hasReady = raftGroup.HasReady(); hasReady {
@@ -1939,9 +2068,11 @@ func (r *Replica) handleRaftReadyRaftMuLocked(inSnap IncomingSnapshot) error {
 			return err
 		}
 	}
+	commitStart := timeutil.Now()
 	if err := batch.Commit(); err != nil {
 		return err
 	}
+	r.store.metrics.RaftLogCommitLatency.RecordValue(timeutil.Since(commitStart).Nanoseconds())
 
 	// Update protected state (last index, raft log size and raft leader
 	// ID) and set raft log entry cache. We clear any older, uncommitted
@@ -1952,6 +2083,7 @@ func (r *Replica) handleRaftReadyRaftMuLocked(inSnap IncomingSnapshot) error {
 	r.mu.raftLogSize = raftLogSize
 	r.mu.leaderID = leaderID
 	r.mu.Unlock()
+	r.store.raftLogBackpressure.recordAppend(raftLogSize - prevRaftLogSize)
 
 	sendingSnapshot := false
 	for _, msg := range rd.Messages {
@@ -1964,7 +2096,17 @@ func (r *Replica) handleRaftReadyRaftMuLocked(inSnap IncomingSnapshot) error {
 		r.maybeAbandonSnapshot(ctx)
 	}
 
+	r.mu.Lock()
+	appliedIndex := r.mu.state.RaftAppliedIndex
+	r.mu.Unlock()
+
 	for _, e := range rd.CommittedEntries {
+		if e.Index <= appliedIndex {
+			// The entry was applied while handling a Ready which was cut short
+			// by a poisoned entry. Since that Ready was never advanced, its
+			// committed entries are handed to us again.
+			continue
+		}
 		switch e.Type {
 		case raftpb.EntryNormal:
 
@@ -1997,6 +2139,10 @@ func (r *Replica) handleRaftReadyRaftMuLocked(inSnap IncomingSnapshot) error {
 			// Discard errors from processRaftCommand. The error has been sent
 			// to the client that originated it, where it will be handled.
 			_ = r.processRaftCommand(ctx, commandID, e.Index, command)
+			if r.isPoisoned() {
+				// The range is halted; leave the Ready unadvanced.
+				return nil
+			}
 
 		case raftpb.EntryConfChange:
 			var cc raftpb.ConfChange
@@ -2011,9 +2157,11 @@ func (r *Replica) handleRaftReadyRaftMuLocked(inSnap IncomingSnapshot) error {
 			if err := command.Unmarshal(ccCtx.Payload); err != nil {
 				return err
 			}
-			if pErr := r.processRaftCommand(
-				ctx, storagebase.CmdIDKey(ccCtx.CommandID), e.Index, command,
-			); pErr != nil {
+			pErr := r.processRaftCommand(ctx, storagebase.CmdIDKey(ccCtx.CommandID), e.Index, command)
+			if r.isPoisoned() {
+				return nil
+			}
+			if pErr != nil {
 				// If processRaftCommand failed, tell raft that the config change was aborted.
 				cc = raftpb.ConfChange{}
 			}
@@ -2316,6 +2464,18 @@ func (r *Replica) refreshPendingCmdsLocked(reason refreshRaftReason, refreshAtDe
 	refurbished := 0
 	var reproposals pendingCmdSlice
 	for idKey, p := range r.mu.proposals {
+		if p.abandoned || p.ctx.Err() != nil {
+			// Nobody is waiting for the command (or will be much longer), so
+			// rather than proposing it again, drop it. If it makes it into
+			// the log nonetheless, it applies like a command proposed by
+			// another replica.
+			delete(r.mu.proposals, idKey)
+			if !p.abandoned {
+				p.done <- roachpb.ResponseWithError{Err: roachpb.NewError(p.ctx.Err())}
+			}
+			r.store.metrics.RaftCommandsAbandonedDropped.Inc(1)
+			continue
+		}
 		if p.proposedAtTicks > refreshAtTicks {
 			// The command was proposed too recently, don't bother reproprosing or
 			// refurbishing it yet. Note that if refreshAtDelta is 0, refreshAtTicks
@@ -2456,6 +2616,30 @@ func (r *Replica) sendRaftMessage(ctx context.Context, msg raftpb.Message) {
 			beganStreaming = true
 			r.store.Stopper().RunWorker(func() {
 				defer r.CloseOutSnap()
+				// Don't send the range's data to a recipient which the
+				// replicate queue is already sending a preemptive snapshot
+				// to; raft retries once that one is done with.
+				done, err := r.store.snapshotsInFlight.register(r.RangeID, toReplica.StoreID)
+				if err != nil {
+					log.VEventf(ctx, 1, "not sending snapshot: %s", err)
+					r.reportSnapshotStatus(msg.To, err)
+					return
+				}
+				defer done()
+				snap.movementType = MovementRaft
+				if err := r.store.waitForSnapshotPacing(
+					ctx, snap.movementType, r.GetMVCCStats().Total()); err != nil {
+					log.Warningf(ctx, "failed to send snapshot: %s", err)
+					r.reportSnapshotStatus(msg.To, err)
+					return
+				}
+				defer r.store.replicaMovements.start(ReplicaMovement{
+					RangeID: r.RangeID,
+					From:    r.store.StoreID(),
+					To:      []roachpb.StoreID{toReplica.StoreID},
+					Type:    snap.movementType,
+					Bytes:   r.GetMVCCStats().Total(),
+				}, snap)()
 				if err := r.store.cfg.Transport.SendSnapshot(
 					ctx,
 					r.store.allocator.storePool,
@@ -2470,6 +2654,7 @@ func (r *Replica) sendRaftMessage(ctx context.Context, msg raftpb.Message) {
 						},
 						RangeSize:  r.GetMVCCStats().Total(),
 						CanDecline: false,
+						Type:       snap.movementType.snapshotType(),
 					}, snap, r.store.Engine().NewBatch); err != nil {
 					log.Warningf(ctx, "failed to send snapshot: %s", err)
 				}
@@ -2621,6 +2806,14 @@ func (r *Replica) processRaftCommand(
 		return false
 	}
 
+	if cmdProposedLocally && cmd.abandoned {
+		// Nobody is waiting for the result. The command applies like one
+		// proposed by another replica, and isn't refurbished if it fails to.
+		delete(r.mu.proposals, idKey)
+		cmdProposedLocally = false
+		r.store.metrics.RaftCommandsAbandonedApplied.Inc(1)
+	}
+
 	// TODO(tschottdorf): consider the Trace situation here.
 	if cmdProposedLocally {
 		// We initiated this command, so use the caller-supplied context.
@@ -2706,6 +2899,20 @@ func (r *Replica) processRaftCommand(
 			}
 		}
 	}
+	if discardErr := r.maybeDiscardLocked(index); discardErr != nil {
+		log.Warningf(ctx, "applying discarded raft entry %d (command %x) as a no-op", index, idKey)
+		if forcedErr == nil {
+			forcedErr = discardErr
+			// Consume the lease index of the command, so that a reproposal of
+			// it can't apply later.
+			if !raftCmd.Cmd.IsLeaseRequest() {
+				leaseIndex = r.mu.state.LeaseAppliedIndex
+				if leaseIndex < raftCmd.MaxLeaseIndex {
+					leaseIndex = raftCmd.MaxLeaseIndex
+				}
+			}
+		}
+	}
 	r.mu.Unlock()
 
 	if splitMergeUnlock := r.maybeAcquireSplitMergeLock(raftCmd.Cmd); splitMergeUnlock != nil {
@@ -2724,7 +2931,18 @@ func (r *Replica) processRaftCommand(
 	}
 	var response roachpb.ResponseWithError
 	{
-		pd := r.applyRaftCommand(ctx, idKey, index, leaseIndex, raftCmd.Cmd, forcedErr)
+		pd, poisonErr := r.applyRaftCommandContained(ctx, idKey, index, leaseIndex, raftCmd.Cmd, forcedErr)
+		if poisonErr != nil {
+			if sendToClient {
+				// The client keeps waiting for the entry to be applied, which
+				// happens either when the range resumes or when it is discarded.
+				r.mu.Lock()
+				r.insertProposalLocked(cmd)
+				r.mu.Unlock()
+			}
+			r.haltPoisonedEntry(ctx, idKey, index, raftCmd, poisonErr)
+			return roachpb.NewError(poisonErr)
+		}
 		pd.Err = r.maybeSetCorrupt(ctx, pd.Err)
 
 		// TODO(tschottdorf): this field should be zeroed earlier.
@@ -2854,6 +3072,7 @@ func (r *Replica) applyRaftCommand(
 	index, leaseIndex uint64,
 	ba roachpb.BatchRequest,
 	forcedError *roachpb.Error,
+	contain bool,
 ) ProposalData {
 	if index <= 0 {
 		log.Fatalf(ctx, "raft command index is <= 0")
@@ -2867,6 +3086,8 @@ func (r *Replica) applyRaftCommand(
 		forcedError = roachpb.NewError(roachpb.NewRangeFrozenError(*r.mu.state.Desc))
 	}
 	ms := r.mu.state.Stats
+	usingAppliedStateKey := r.mu.state.UsingAppliedStateKey
+	truncState := *r.mu.state.TruncatedState
 	r.mu.Unlock()
 
 	if index != oldIndex+1 {
@@ -2885,6 +3106,8 @@ func (r *Replica) applyRaftCommand(
 	if forcedError != nil {
 		pd.Batch = r.store.Engine().NewBatch()
 		pd.Err = forcedError
+	} else if contain {
+		pd = r.applyRaftCommandInBatchContained(ctx, idKey, ba)
 	} else {
 		pd = r.applyRaftCommandInBatch(ctx, idKey, ba)
 	}
@@ -2894,6 +3117,14 @@ func (r *Replica) applyRaftCommand(
 			ba, pd.Err)
 	}
 
+	// A contained command which corrupted the replica is not committed, so
+	// that neither its writes nor the applied index reach the engine.
+	if _, ok := pd.Err.GetDetail().(*roachpb.ReplicaCorruptionError); ok && contain {
+		pd.Batch.Close()
+		pd.Batch = nil
+		return pd
+	}
+
 	defer func() {
 		pd.Batch.Close()
 		pd.Batch = nil
@@ -2901,12 +3132,31 @@ func (r *Replica) applyRaftCommand(
 
 	// The only remaining use of the batch is for range-local keys which we know
 	// have not been previously written within this batch. Currently the only
-	// remaining writes are the raft applied index and the updated MVCC stats.
+	// remaining writes are the raft applied index (or the range applied state)
+	// and the updated MVCC stats.
 	//
 	writer := pd.Batch.Distinct()
 
-	// Advance the last applied index.
-	if err := setAppliedIndex(ctx, writer, &pd.delta, r.RangeID, index, leaseIndex); err != nil {
+	// Advance the last applied index. Ranges on the range applied state key
+	// write it in one go, together with the truncated state of the Raft log,
+	// which the command may have updated.
+	if usingAppliedStateKey || pd.State.UsingAppliedStateKey {
+		if pd.State.TruncatedState != nil {
+			truncState = *pd.State.TruncatedState
+		}
+		var err error
+		if usingAppliedStateKey {
+			err = setRangeAppliedState(
+				ctx, writer, &pd.delta, r.RangeID, index, leaseIndex, truncState)
+		} else {
+			log.Event(ctx, "migrating to the range applied state key")
+			err = migrateToRangeAppliedStateKey(
+				ctx, writer, &pd.delta, r.RangeID, index, leaseIndex, truncState)
+		}
+		if err != nil {
+			log.Fatalf(ctx, "setting range applied state in a batch should never fail: %s", err)
+		}
+	} else if err := setAppliedIndex(ctx, writer, &pd.delta, r.RangeID, index, leaseIndex); err != nil {
 		log.Fatalf(ctx, "setting applied index in a batch should never fail: %s", err)
 	}
 
@@ -0,0 +1,116 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// rangeSizeBackpressureInterval is the interval at which a delayed write
+// checks whether its range has been split.
+const rangeSizeBackpressureInterval = 50 * time.Millisecond
+
+// rangeSizeBackpressureMultiplier is the multiple of the maximum size of a
+// range beyond which writes to it are delayed until it has been split. When
+// the split queue falls behind, this keeps ranges from growing so large that
+// they stall on huge snapshots.
+var rangeSizeBackpressureMultiplier = settings.RegisterFloatSetting(
+	"kv.range.backpressure_range_size_multiplier",
+	"multiple of the maximum range size beyond which writes to a range are delayed "+
+		"until it is split; 0 disables the backpressure",
+	2,
+)
+
+// rangeSizeBackpressureMaxWait bounds the time a write waits for its range to
+// be split. The write proceeds once it expires, so that a range which can't
+// be split, e.g. because it holds a single huge row, remains writable.
+var rangeSizeBackpressureMaxWait = settings.RegisterDurationSetting(
+	"kv.range.backpressure_max_wait",
+	"maximum time a write to a range above the backpressure size waits for the range to be split",
+	5*time.Second,
+)
+
+// canBackpressureBatch returns true if the batch grows the user data of the
+// range. Range-local writes, like the ones of the split itself, and requests
+// such as intent resolution, which let pending writes complete, are never
+// delayed.
+func canBackpressureBatch(ba roachpb.BatchRequest) bool {
+	for _, union := range ba.Requests {
+		switch arg := union.GetInner(); arg.(type) {
+		case *roachpb.PutRequest, *roachpb.ConditionalPutRequest, *roachpb.InitPutRequest,
+			*roachpb.IncrementRequest, *roachpb.MergeRequest:
+			if arg.Header().Key.Compare(keys.LocalMax) >= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exceedsBackpressureSize returns true if the range is larger than the
+// multiple of its maximum size beyond which writes to it are delayed.
+func (r *Replica) exceedsBackpressureSize() bool {
+	multiplier := rangeSizeBackpressureMultiplier.Get()
+	if multiplier <= 0 {
+		return false
+	}
+	r.mu.Lock()
+	maxBytes := r.mu.maxBytes
+	size := r.mu.state.Stats.Total()
+	r.mu.Unlock()
+	return maxBytes > 0 && float64(size) > float64(maxBytes)*multiplier
+}
+
+// maybeBackpressureWriteBatch delays the write batch while the range exceeds
+// the backpressure size, making sure that the split queue considers the
+// range in the meantime. It must only be called on the leaseholder. The batch proceeds once the range has been split,
+// or after kv.range.backpressure_max_wait. Nothing is delayed while the
+// split queue is disabled, since the range wouldn't be split, nor are
+// batches which are exempt from throttling.
+func (r *Replica) maybeBackpressureWriteBatch(ctx context.Context, ba roachpb.BatchRequest) error {
+	if !ba.IsWrite() || !canBackpressureBatch(ba) || isThrottleExempt(ba) ||
+		r.store.splitQueue.Disabled() || !r.exceedsBackpressureSize() {
+		return nil
+	}
+	r.store.metrics.RangeSizeBackpressureThrottled.Inc(1)
+	r.store.splitQueue.MaybeAdd(r, r.store.Clock().Now())
+	log.Event(ctx, "delaying write until the range is split")
+
+	deadline := timeutil.Now().Add(rangeSizeBackpressureMaxWait.Get())
+	ticker := time.NewTicker(rangeSizeBackpressureInterval)
+	defer ticker.Stop()
+	for r.exceedsBackpressureSize() {
+		if timeutil.Now().After(deadline) {
+			r.store.metrics.RangeSizeBackpressureTimeouts.Inc(1)
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.store.stopper.ShouldQuiesce():
+			return &roachpb.NodeUnavailableError{}
+		}
+	}
+	return nil
+}
@@ -170,6 +170,12 @@ func (r *Replica) executeCmd(
 	case *roachpb.ChangeFrozenRequest:
 		resp := reply.(*roachpb.ChangeFrozenResponse)
 		*resp, pd, err = r.ChangeFrozen(ctx, batch, ms, h, *tArgs)
+	case *roachpb.ClearRangeRequest:
+		resp := reply.(*roachpb.ClearRangeResponse)
+		*resp, err = r.ClearRange(ctx, batch, ms, h, *tArgs)
+	case *roachpb.RecomputeStatsRequest:
+		resp := reply.(*roachpb.RecomputeStatsResponse)
+		*resp, err = r.RecomputeStats(ctx, batch, ms, h, *tArgs)
 	default:
 		err = errors.Errorf("unrecognized command %s", args.Method())
 	}
@@ -356,6 +362,97 @@ func (r *Replica) DeleteRange(
 	return reply, resumeSpan, num, err
 }
 
+// ClearRange removes all the versions of all the keys in the span specified
+// by start and end keys without writing deletion tombstones, subtracting
+// their contribution from the range's MVCC stats. It is meant for dropping
+// data nobody reads any more, such as the data of a dropped table, and so it
+// can't be part of a transaction. It fails if the span isn't fully contained
+// in the range or contains intents, since clearing them would pull the rug
+// from under their transactions.
+//
+// The engine doesn't support range tombstones, so the keys are cleared one
+// by one in the batch. This is still far cheaper than a transactional
+// DeleteRange, which has to read and write an MVCC tombstone per key.
+func (r *Replica) ClearRange(
+	ctx context.Context,
+	batch engine.ReadWriter,
+	ms *enginepb.MVCCStats,
+	h roachpb.Header,
+	args roachpb.ClearRangeRequest,
+) (roachpb.ClearRangeResponse, error) {
+	var reply roachpb.ClearRangeResponse
+	if h.Txn != nil {
+		return reply, errors.Errorf("cannot execute ClearRange within a transaction")
+	}
+	start, err := keys.Addr(args.Key)
+	if err != nil {
+		return reply, err
+	}
+	end, err := keys.Addr(args.EndKey)
+	if err != nil {
+		return reply, err
+	}
+	if !bytes.Equal(start, args.Key) || !bytes.Equal(end, args.EndKey) {
+		return reply, errors.Errorf("cannot clear range-local keys")
+	}
+	if desc := r.Desc(); !desc.ContainsKeyRange(start, end) {
+		return reply, errors.Errorf("span %s is not contained in range %s", args.Span, desc)
+	}
+
+	from := engine.MakeMVCCMetadataKey(args.Key)
+	to := engine.MakeMVCCMetadataKey(args.EndKey)
+	iter := batch.NewIterator(false)
+	delta, err := iter.ComputeStats(from, to, h.Timestamp.WallTime)
+	iter.Close()
+	if err != nil {
+		return reply, err
+	}
+	if delta.IntentCount > 0 {
+		// A consistent read returns the intents in the span as a
+		// WriteIntentError, which lets the caller resolve them and retry.
+		if _, err := engine.MVCCIterate(
+			ctx, batch, args.Key, args.EndKey, hlc.MaxTimestamp, true /* consistent */, nil, /* txn */
+			false /* reverse */, func(roachpb.KeyValue) (bool, error) { return false, nil },
+		); err != nil {
+			return reply, err
+		}
+		return reply, errors.Errorf("cannot clear span %s containing %d intents", args.Span, delta.IntentCount)
+	}
+
+	if _, err := engine.ClearRange(batch, from, to); err != nil {
+		return reply, err
+	}
+	ms.Subtract(delta)
+	return reply, nil
+}
+
+// RecomputeStats recomputes the MVCCStats of the range from its data and
+// adjusts the persisted stats by the difference. As the command is evaluated
+// by every replica when it applies, this corrects each replica's stats
+// without touching (or shipping) any of the data.
+func (r *Replica) RecomputeStats(
+	ctx context.Context,
+	batch engine.ReadWriter,
+	ms *enginepb.MVCCStats,
+	h roachpb.Header,
+	args roachpb.RecomputeStatsRequest,
+) (roachpb.RecomputeStatsResponse, error) {
+	var reply roachpb.RecomputeStatsResponse
+	if h.Txn != nil {
+		return reply, errors.Errorf("cannot execute RecomputeStats within a transaction")
+	}
+	persisted := r.GetMVCCStats()
+	actual, err := ComputeStatsForRange(r.Desc(), batch, persisted.LastUpdateNanos)
+	if err != nil {
+		return reply, err
+	}
+	delta := actual
+	delta.Subtract(persisted)
+	ms.Add(delta)
+	reply.AddedDelta = delta
+	return reply, nil
+}
+
 // Scan scans the key range specified by start key through end key in ascending order up to some
 // maximum number of results. maxKeys stores the number of scan results remaining for this
 // batch (MaxInt64 for no limit).
@@ -366,8 +463,10 @@ func (r *Replica) Scan(
 	maxKeys int64,
 	args roachpb.ScanRequest,
 ) (roachpb.ScanResponse, *roachpb.Span, int64, ProposalData, error) {
-	rows, resumeSpan, intents, err := engine.MVCCScan(ctx, batch, args.Key, args.EndKey, maxKeys, h.Timestamp,
-		h.ReadConsistency == roachpb.CONSISTENT, h.Txn)
+	var stats engine.IteratorStats
+	rows, resumeSpan, intents, err := engine.MVCCScanWithStats(ctx, batch, args.Key, args.EndKey, maxKeys,
+		h.Timestamp, h.ReadConsistency == roachpb.CONSISTENT, h.Txn, &stats)
+	r.recordIteratorStats(ctx, stats)
 	return roachpb.ScanResponse{Rows: rows}, resumeSpan, int64(len(rows)), intentsToProposalData(intents, &args), err
 }
 
@@ -381,11 +480,22 @@ func (r *Replica) ReverseScan(
 	maxKeys int64,
 	args roachpb.ReverseScanRequest,
 ) (roachpb.ReverseScanResponse, *roachpb.Span, int64, ProposalData, error) {
-	rows, resumeSpan, intents, err := engine.MVCCReverseScan(ctx, batch, args.Key, args.EndKey, maxKeys,
-		h.Timestamp, h.ReadConsistency == roachpb.CONSISTENT, h.Txn)
+	var stats engine.IteratorStats
+	rows, resumeSpan, intents, err := engine.MVCCReverseScanWithStats(ctx, batch, args.Key, args.EndKey, maxKeys,
+		h.Timestamp, h.ReadConsistency == roachpb.CONSISTENT, h.Txn, &stats)
+	r.recordIteratorStats(ctx, stats)
 	return roachpb.ReverseScanResponse{Rows: rows}, resumeSpan, int64(len(rows)), intentsToProposalData(intents, &args), err
 }
 
+// recordIteratorStats records the keys surfaced and skipped by a scan in the
+// trace of the request and the store's metrics, so that scans slowed down by
+// MVCC garbage can be told apart.
+func (r *Replica) recordIteratorStats(ctx context.Context, stats engine.IteratorStats) {
+	log.Eventf(ctx, "scan surfaced %d keys, skipped %d", stats.KeysSurfaced, stats.KeysSkipped)
+	r.store.metrics.ScanKeysSurfaced.Inc(stats.KeysSurfaced)
+	r.store.metrics.ScanKeysSkipped.Inc(stats.KeysSkipped)
+}
+
 func verifyTransaction(h roachpb.Header, args roachpb.Request) error {
 	if h.Txn == nil {
 		return errors.Errorf("no transaction specified to %s", args.Method())
@@ -851,6 +961,13 @@ func (r *Replica) runCommitTrigger(
 	if crt := ct.GetChangeReplicasTrigger(); crt != nil {
 		return r.changeReplicasTrigger(ctx, batch, crt), nil
 	}
+	if sbt := ct.GetStickyBitTrigger(); sbt != nil {
+		var pd ProposalData
+		newDesc := *r.Desc()
+		newDesc.StickyBit = sbt.StickyBit
+		pd.State.Desc = &newDesc
+		return pd, nil
+	}
 	if ct.GetModifiedSpanTrigger() != nil {
 		var pd ProposalData
 		if ct.ModifiedSpanTrigger.SystemConfigSpan {
@@ -919,7 +1036,9 @@ func (r *Replica) runCommitTrigger(
 // the range to the respective meta prefix.
 //
 // Lookups for range metadata keys usually want to read inconsistently, but
-// some callers need a consistent result; both are supported.
+// some callers need a consistent result; both are supported. READ_UNCOMMITTED
+// lookups are inconsistent lookups which return the descriptor from an
+// intent, if any, ahead of the committed one.
 //
 // This method has an important optimization in the inconsistent case: instead
 // of just returning the request RangeDescriptor, it also returns a slice of
@@ -941,7 +1060,7 @@ func (r *Replica) RangeLookup(
 	if !key.Equal(args.Key) {
 		return reply, ProposalData{}, errors.Errorf("illegal lookup of range-local key %q", args.Key)
 	}
-	ts, txn, consistent, rangeCount := h.Timestamp, h.Txn, h.ReadConsistency != roachpb.INCONSISTENT, int64(args.MaxRanges)
+	ts, txn, consistent, rangeCount := h.Timestamp, h.Txn, !h.ReadConsistency.IsInconsistent(), int64(args.MaxRanges)
 	if rangeCount < 1 {
 		return reply, ProposalData{}, errors.Errorf("range lookup specified invalid maximum range count %d: must be > 0", rangeCount)
 	}
@@ -1115,6 +1234,13 @@ func (r *Replica) RangeLookup(
 		log.Fatalf(ctx, "range lookup of meta key %q found only non-matching ranges: %+v", args.Key, reply.PrefetchedRanges)
 	}
 
+	// A READ_UNCOMMITTED lookup is issued when the caller suspects that the
+	// committed descriptor is being replaced (e.g. by a split), so return
+	// the descriptor from the intent first.
+	if h.ReadConsistency == roachpb.READ_UNCOMMITTED && len(reply.Ranges) == 2 {
+		reply.Ranges[0], reply.Ranges[1] = reply.Ranges[1], reply.Ranges[0]
+	}
+
 	if preCount := int64(len(reply.PrefetchedRanges)); 1+preCount > rangeCount {
 		// We've possibly picked up an extra descriptor if we're in reverse
 		// mode due to the initial forward scan.
@@ -1541,7 +1667,9 @@ func (r *Replica) Merge(
 
 // TruncateLog discards a prefix of the raft log. Truncating part of a log that
 // has already been truncated has no effect. If this range is not the one
-// specified within the request body, the request will also be ignored.
+// specified within the request body, the request will also be ignored. If
+// MigrateAppliedState is set, the range is migrated to the range applied
+// state key whether or not the log is truncated.
 func (r *Replica) TruncateLog(
 	ctx context.Context,
 	batch engine.ReadWriter,
@@ -1566,12 +1694,15 @@ func (r *Replica) TruncateLog(
 		return reply, ProposalData{}, err
 	}
 
+	var pd ProposalData
+	pd.State.UsingAppliedStateKey = args.MigrateAppliedState
+
 	if firstIndex >= args.Index {
 		if log.V(3) {
 			log.Infof(ctx, "attempting to truncate previously truncated raft log. FirstIndex:%d, TruncateFrom:%d",
 				firstIndex, args.Index)
 		}
-		return reply, ProposalData{}, nil
+		return reply, pd, nil
 	}
 
 	// args.Index is the first index to keep.
@@ -1601,10 +1732,18 @@ func (r *Replica) TruncateLog(
 		Term:  term,
 	}
 
-	var pd ProposalData
 	pd.State.TruncatedState = tState
 	pd.raftLogSize = &raftLogSize
 
+	// Ranges on (or migrating to) the range applied state key have the
+	// truncated state written along with the applied indices once the
+	// command applies.
+	r.mu.Lock()
+	usingAppliedStateKey := r.mu.state.UsingAppliedStateKey
+	r.mu.Unlock()
+	if usingAppliedStateKey || args.MigrateAppliedState {
+		return reply, pd, nil
+	}
 	return reply, pd, engine.MVCCPutProto(ctx, batch, ms, keys.RaftTruncatedStateKey(r.RangeID), hlc.ZeroTimestamp, nil, tState)
 }
 
@@ -1787,7 +1926,10 @@ func (r *Replica) applyNewLeaseLocked(
 
 // CheckConsistency runs a consistency check on the range. It first applies a
 // ComputeChecksum command on the range. It then issues CollectChecksum commands
-// to the other replicas.
+// to the other replicas. Unless kv.consistency_check.collect_diff is unset, a
+// failed check is rerun with a diff, which logs the keys, values and
+// timestamps that differ between the replicas, before the inconsistency is
+// handled.
 //
 // TODO(tschottdorf): We should call this AdminCheckConsistency.
 func (r *Replica) CheckConsistency(
@@ -1830,41 +1972,46 @@ func (r *Replica) CheckConsistency(
 		return roachpb.CheckConsistencyResponse{},
 			roachpb.NewError(errors.Wrap(err, "could not get replica descriptor"))
 	}
-	var inconsistencyCount uint32
+	var inconsistencyCount, statsInconsistencyCount uint32
 	var wg sync.WaitGroup
-	sp := r.store.cfg.StorePool
-	for _, replica := range r.Desc().Replicas {
+	replicas := r.Desc().Replicas
+	// results holds the checksum of every replica which could be reached,
+	// indexed like replicas. Each task only writes its own entry.
+	results := make([]replicaChecksumResult, len(replicas))
+	for i, replica := range replicas {
+		results[i].replica = replica
 		if replica == localReplica {
+			results[i].checksum = c.checksum
 			continue
 		}
 		wg.Add(1)
-		replica := replica // per-iteration copy
+		i, replica := i, replica // per-iteration copy
 		if err := r.store.Stopper().RunAsyncTask(ctx, func(ctx context.Context) {
 			defer wg.Done()
-			addr, err := sp.resolver(replica.NodeID)
+			client, err := r.consistencyClient(replica.NodeID)
 			if err != nil {
-				log.Error(ctx, errors.Wrapf(err, "could not resolve node ID %d", replica.NodeID))
+				log.Error(ctx, err)
 				return
 			}
-			conn, err := sp.rpcContext.GRPCDial(addr.String())
-			if err != nil {
-				log.Error(ctx,
-					errors.Wrapf(err, "could not dial node ID %d address %s", replica.NodeID, addr))
-				return
-			}
-			client := NewConsistencyClient(conn)
 			req := &CollectChecksumRequest{
 				StoreRequestHeader{NodeID: replica.NodeID, StoreID: replica.StoreID},
 				r.RangeID,
 				id,
 				c.checksum,
+				false, /* terminate */
 			}
 			resp, err := client.CollectChecksum(ctx, req)
 			if err != nil {
 				log.Error(ctx, errors.Wrapf(err, "could not CollectChecksum from replica %s", replica))
 				return
 			}
+			results[i].checksum = resp.Checksum
 			if bytes.Equal(c.checksum, resp.Checksum) {
+				if statsDiffer(c.persisted, resp.Persisted) {
+					log.Warningf(ctx, "replica %s has diverged stats: expected %+v, got %+v",
+						replica, c.persisted, resp.Persisted)
+					atomic.AddUint32(&statsInconsistencyCount, 1)
+				}
 				return
 			}
 			atomic.AddUint32(&inconsistencyCount, 1)
@@ -1876,6 +2023,7 @@ func (r *Replica) CheckConsistency(
 				if report := r.store.cfg.TestingKnobs.BadChecksumReportDiff; report != nil {
 					report(r.store.Ident, diff)
 				}
+				_, _ = fmt.Fprintf(&buf, "\n%d differing entries:\n", len(diff))
 				_, _ = diff.WriteTo(&buf)
 			}
 			log.Error(ctx, "\n", buf.String())
@@ -1887,14 +2035,17 @@ func (r *Replica) CheckConsistency(
 	wg.Wait()
 
 	if inconsistencyCount == 0 {
-	} else if args.WithDiff {
-		logFunc := log.Errorf
-		if p := r.store.TestingKnobs().BadChecksumPanic; p != nil {
-			p(r.store.Ident)
-		} else if r.store.cfg.ConsistencyCheckPanicOnFailure {
-			logFunc = log.Fatalf
-		}
-		logFunc(ctx, "consistency check failed with %d inconsistent replicas", inconsistencyCount)
+		if statsInconsistencyCount > 0 || statsDiffer(c.persisted, c.recomputed) {
+			// The replicas agree on the data, but not on the stats (or not with
+			// the stats recomputed from the data). There is no need to replace
+			// any replica; have them all correct their stats instead.
+			if err := r.repairStats(ctx); err != nil {
+				log.Error(ctx, errors.Wrap(err, "could not repair diverged stats"))
+			}
+		}
+	} else if args.WithDiff || !consistencyCheckCollectDiff.Get() {
+		log.Errorf(ctx, "consistency check failed with %d inconsistent replicas", inconsistencyCount)
+		r.handleInconsistency(ctx, id, localReplica, results)
 	} else {
 		if err := r.store.stopper.RunAsyncTask(ctx, func(ctx context.Context) {
 			log.Errorf(ctx, "consistency check failed with %d inconsistent replicas; fetching details",
@@ -1914,8 +2065,25 @@ func (r *Replica) CheckConsistency(
 	return roachpb.CheckConsistencyResponse{}, nil
 }
 
+// repairStats proposes a RecomputeStats command, which makes every replica
+// of the range recompute its MVCCStats from its data.
+func (r *Replica) repairStats(ctx context.Context) error {
+	var ba roachpb.BatchRequest
+	ba.RangeID = r.RangeID
+	ba.Timestamp = r.store.Clock().Now()
+	ba.Add(roachpb.NewRecomputeStats(r.Desc().StartKey.AsRawKey()))
+	br, pErr := r.Send(ctx, ba)
+	if pErr != nil {
+		return pErr.GoError()
+	}
+	delta := br.Responses[0].GetInner().(*roachpb.RecomputeStatsResponse).AddedDelta
+	r.store.metrics.RangeStatsRepairs.Inc(1)
+	log.Warningf(ctx, "repaired diverged stats by applying delta %+v", delta)
+	return nil
+}
+
 const (
-	replicaChecksumVersion    = 2
+	replicaChecksumVersion    = 3
 	replicaChecksumGCInterval = time.Hour
 )
 
@@ -1964,7 +2132,11 @@ func (r *Replica) getChecksum(ctx context.Context, id uuid.UUID) (replicaChecksu
 // computeChecksumDone adds the computed checksum, sets a deadline for GCing the
 // checksum, and sends out a notification.
 func (r *Replica) computeChecksumDone(
-	ctx context.Context, id uuid.UUID, sha []byte, snapshot *roachpb.RaftSnapshotData,
+	ctx context.Context,
+	id uuid.UUID,
+	sha []byte,
+	snapshot *roachpb.RaftSnapshotData,
+	persisted, recomputed enginepb.MVCCStats,
 ) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -1972,6 +2144,8 @@ func (r *Replica) computeChecksumDone(
 		c.checksum = sha
 		c.gcTimestamp = timeutil.Now().Add(replicaChecksumGCInterval)
 		c.snapshot = snapshot
+		c.persisted = persisted
+		c.recomputed = recomputed
 		r.mu.checksums[id] = c
 		// Notify
 		close(c.notify)
@@ -2002,12 +2176,14 @@ func (r *Replica) ComputeChecksum(
 	return roachpb.ComputeChecksumResponse{}, pd, nil
 }
 
-// sha512 computes the SHA512 hash of all the replica data at the snapshot.
+// sha512 computes the SHA512 hash of all the replica data at the snapshot,
+// with the exception of the persisted MVCCStats which are compared separately.
 // It will dump all the k:v data into snapshot if it is provided.
 func (r *Replica) sha512(
 	desc roachpb.RangeDescriptor, snap engine.Reader, snapshot *roachpb.RaftSnapshotData,
 ) ([]byte, error) {
 	hasher := sha512.New()
+	statsKey := keys.RangeStatsKey(desc.RangeID)
 	// Iterate over all the data in the range.
 	iter := NewReplicaDataIterator(&desc, snap, true /* replicatedOnly */)
 	defer iter.Close()
@@ -2019,6 +2195,11 @@ func (r *Replica) sha512(
 			// Add the k:v into the debug message.
 			snapshot.KV = append(snapshot.KV, roachpb.RaftSnapshotData_KeyValue{Key: key.Key, Value: value, Timestamp: key.Timestamp})
 		}
+		if key.Key.Equal(statsKey) {
+			// Replicas which only disagree on their stats must not be
+			// mistaken for replicas with diverged data.
+			continue
+		}
 
 		// Encode the length of the key and value.
 		if err := binary.Write(hasher, binary.LittleEndian, int64(len(key.Key))); err != nil {
@@ -2332,6 +2513,16 @@ func (r *Replica) AdminSplit(
 		}
 	}
 
+	// A sticky split at the start key of the range marks the existing split
+	// as sticky instead, unless it already is for at least as long.
+	if stickyBit := splitStickyBit(args); stickyBit != nil && desc.StartKey.Equal(splitKey) &&
+		(desc.StickyBit == nil || desc.StickyBit.Less(*stickyBit)) {
+		if err := r.updateStickyBit(ctx, desc, stickyBit); err != nil {
+			return reply, roachpb.NewErrorf("split at key %s failed: %s", splitKey, err)
+		}
+		return reply, nil
+	}
+
 	// First verify this condition so that it will not return
 	// roachpb.NewRangeKeyMismatchError if splitKey equals to desc.EndKey,
 	// otherwise it will cause infinite retry loop.
@@ -2345,6 +2536,7 @@ func (r *Replica) AdminSplit(
 	if err != nil {
 		return reply, roachpb.NewErrorf("unable to allocate right hand side range descriptor: %s", err)
 	}
+	rightDesc.StickyBit = splitStickyBit(args)
 
 	// Init updated version of existing range descriptor.
 	leftDesc := *desc
@@ -2437,6 +2629,92 @@ func (r *Replica) AdminSplit(
 	return reply, nil
 }
 
+// splitStickyBit returns the sticky bit of the range descriptor starting at
+// the split key of a split, or nil if the split isn't sticky.
+func splitStickyBit(args roachpb.AdminSplitRequest) *hlc.Timestamp {
+	if !args.Sticky {
+		return nil
+	}
+	expiration := args.ExpirationTime
+	if expiration == hlc.ZeroTimestamp {
+		expiration = hlc.MaxTimestamp
+	}
+	return &expiration
+}
+
+// updateStickyBit sets the sticky bit of the range descriptor, or clears it if
+// stickyBit is nil. As with AdminSplit, the supplied descriptor is used as an
+// optimistic lock.
+func (r *Replica) updateStickyBit(
+	ctx context.Context, desc *roachpb.RangeDescriptor, stickyBit *hlc.Timestamp,
+) error {
+	updatedDesc := *desc
+	updatedDesc.StickyBit = stickyBit
+	return r.store.DB().Txn(ctx, func(txn *client.Txn) error {
+		{
+			b := txn.NewBatch()
+			// The range descriptor must be the first thing touched in the
+			// transaction so the transaction record is co-located with the
+			// range being modified.
+			descKey := keys.RangeDescriptorKey(desc.StartKey)
+			if err := updateRangeDescriptor(b, descKey, desc, &updatedDesc); err != nil {
+				return err
+			}
+			if err := txn.Run(b); err != nil {
+				if _, ok := err.(*roachpb.ConditionFailedError); ok {
+					return errors.New(ErrMsgConflictUpdatingRangeDesc)
+				}
+				return err
+			}
+		}
+
+		b := txn.NewBatch()
+		if err := updateRangeAddressing(b, &updatedDesc); err != nil {
+			return err
+		}
+		// The commit trigger updates the in-memory copies of the descriptor.
+		b.AddRawRequest(&roachpb.EndTransactionRequest{
+			Commit: true,
+			InternalCommitTrigger: &roachpb.InternalCommitTrigger{
+				StickyBitTrigger: &roachpb.StickyBitTrigger{
+					StickyBit: stickyBit,
+				},
+			},
+		})
+		return txn.Run(b)
+	})
+}
+
+// AdminUnsplit removes the sticky bit of the range, which must start at the
+// request's key, so that the split point can be removed by a merge again. It
+// is a no-op if the range isn't sticky.
+func (r *Replica) AdminUnsplit(
+	ctx context.Context, args roachpb.AdminUnsplitRequest, desc *roachpb.RangeDescriptor,
+) (roachpb.AdminUnsplitResponse, *roachpb.Error) {
+	var reply roachpb.AdminUnsplitResponse
+
+	// The key is normalized as in AdminSplit, so that the same key which was
+	// used to split the range can be used to unsplit it.
+	safeKey, err := keys.EnsureSafeSplitKey(args.Key)
+	if err != nil {
+		return reply, roachpb.NewErrorf("cannot unsplit range at key %s: %v", args.Key, err)
+	}
+	splitKey, err := keys.Addr(safeKey)
+	if err != nil {
+		return reply, roachpb.NewError(err)
+	}
+	if !desc.StartKey.Equal(splitKey) {
+		return reply, roachpb.NewErrorf("key %s is not the start of a range", splitKey)
+	}
+	if desc.StickyBit == nil {
+		return reply, nil
+	}
+	if err := r.updateStickyBit(ctx, desc, nil); err != nil {
+		return reply, roachpb.NewErrorf("unsplit at key %s failed: %s", splitKey, err)
+	}
+	return reply, nil
+}
+
 // splitTrigger is called on a successful commit of a transaction
 // containing an AdminSplit operation. It copies the abort cache for
 // the new range and recomputes stats for both the existing, left hand
@@ -2753,8 +3031,14 @@ func (r *Replica) splitTrigger(
 		rightLease := leftLease
 		rightLease.Replica = replica
 
+		// The right-hand side uses the range applied state key if and only if
+		// the left-hand side does, which all replicas agree on as of the split.
+		r.mu.Lock()
+		usingAppliedStateKey := r.mu.state.UsingAppliedStateKey
+		r.mu.Unlock()
+
 		rightMS, err = writeInitialState(
-			ctx, batch, rightMS, split.RightDesc, oldHS, rightLease,
+			ctx, batch, rightMS, split.RightDesc, oldHS, rightLease, usingAppliedStateKey,
 		)
 		if err != nil {
 			return enginepb.MVCCStats{}, ProposalData{}, errors.Wrap(err, "unable to write initial state")
@@ -2865,6 +3149,10 @@ func (r *Replica) AdminMerge(
 		if !replicaSetsEqual(origLeftDesc.Replicas, rightDesc.Replicas) {
 			return errors.Errorf("ranges not collocated")
 		}
+		if now := r.store.Clock().Now(); rightDesc.IsStickyAt(now) {
+			return errors.Errorf("r%d starts at a sticky split point until %s",
+				rightDesc.RangeID, rightDesc.StickyBit)
+		}
 
 		b := txn.NewBatch()
 
@@ -3106,6 +3394,236 @@ func (r *Replica) ChangeReplicas(
 	repDesc roachpb.ReplicaDescriptor,
 	desc *roachpb.RangeDescriptor,
 ) error {
+	return r.changeReplicas(ctx, changeType, repDesc, desc, true /* sendSnapshot */)
+}
+
+// addReplicas adds a replica on each of the given targets to the range, one
+// at a time. A single preemptive snapshot is generated and streamed to all of
+// the targets, so that recovering from the loss of several replicas doesn't
+// require scanning the range once per new replica. Only the targets which
+// received the snapshot are added; an error reports the others once they
+// are.
+func (r *Replica) addReplicas(
+	ctx context.Context, targets []roachpb.ReplicaDescriptor, desc *roachpb.RangeDescriptor,
+) error {
+	if len(targets) == 1 {
+		return r.ChangeReplicas(ctx, roachpb.ADD_REPLICA, targets[0], desc)
+	}
+
+	// Prohibit premature raft log truncation until all of the targets have
+	// been added; see changeReplicas.
+	if err := r.setPendingSnapshotIndex(1); err != nil {
+		return err
+	}
+	defer r.clearPendingSnapshotIndex()
+
+	errs := r.sendPreemptiveSnapshots(ctx, targets, *desc)
+	var snapErr error
+	var failed int
+	for i, target := range targets {
+		if errs[i] != nil {
+			log.Warningf(ctx, "%s: not adding replica %+v: %s", r, target, errs[i])
+			if snapErr == nil {
+				snapErr = errs[i]
+			}
+			failed++
+			continue
+		}
+		if err := r.changeReplicas(
+			ctx, roachpb.ADD_REPLICA, target, desc, false /* sendSnapshot */); err != nil {
+			return err
+		}
+		desc = r.Desc()
+	}
+	if snapErr != nil {
+		return errors.Wrapf(snapErr, "%s: %d of %d replicas not added", r, failed, len(targets))
+	}
+	return nil
+}
+
+// sendPreemptiveSnapshots generates a snapshot of the range and streams it to
+// each of the given replicas, which must not yet be part of desc.
+//
+// Note that the replicas to which the snapshot is addressed have not yet had
+// their replica IDs initialized; this is intentional, and serves to avoid the
+// following race with the replica GC queue:
+//
+// - snapshot received, a replica is lazily created with the "real" replica ID
+// - the replica is eligible for GC because it is not yet a member of the range
+// - GC queue runs, creating a raft tombstone with the replica's ID
+// - the replica is added to the range
+// - lazy creation of the replica fails due to the raft tombstone
+//
+// Instead, the replica GC queue will create a tombstone with replica ID
+// zero, which is never legitimately used, and thus never interferes with
+// raft operations. Racing with the replica GC queue can still partially
+// negate the benefits of pre-emptive snapshots, but that is a recoverable
+// degradation, not a catastrophic failure.
+//
+// The snapshot of a replica which is farther away from the leaseholder than
+// from one of the range's followers is delegated to that follower (see
+// snapshotDelegate), falling back to sending it directly if the delegation
+// fails.
+//
+// The returned slice holds the outcome of the snapshot to each of the
+// replicas. The caller must have set a pending snapshot index (see
+// setPendingSnapshotIndex) and is responsible for clearing it.
+func (r *Replica) sendPreemptiveSnapshots(
+	ctx context.Context, repDescs []roachpb.ReplicaDescriptor, desc roachpb.RangeDescriptor,
+) []error {
+	errs := make([]error, len(repDescs))
+	// The delegations go first: they leave the pending snapshot index alone,
+	// whereas a direct snapshot raises it to its own index, which may be
+	// ahead of a delegate's.
+	var direct []int
+	for i, repDesc := range repDescs {
+		if delegate, ok := r.snapshotDelegate(repDesc, desc); ok {
+			err := r.delegateSnapshot(ctx, delegate, repDesc, desc)
+			if err == nil {
+				continue
+			}
+			log.Infof(ctx, "%s: snapshot to %+v delegated to %+v failed, sending it directly: %s",
+				r, repDesc, delegate, err)
+		}
+		direct = append(direct, i)
+	}
+	if len(direct) == 0 {
+		return errs
+	}
+	directDescs := make([]roachpb.ReplicaDescriptor, len(direct))
+	for j, i := range direct {
+		directDescs[j] = repDescs[i]
+	}
+	directErrs, err := r.streamPreemptiveSnapshots(ctx, directDescs, desc)
+	for j, i := range direct {
+		if err != nil {
+			errs[i] = err
+		} else {
+			errs[i] = directErrs[j]
+		}
+	}
+	return errs
+}
+
+// streamPreemptiveSnapshots generates a snapshot of the range and streams it
+// to each of the given replicas. See sendPreemptiveSnapshots. The returned
+// slice holds the outcome of the snapshot to each of the replicas, unless
+// the snapshot couldn't be sent to any of them, which the error reports.
+func (r *Replica) streamPreemptiveSnapshots(
+	ctx context.Context, repDescs []roachpb.ReplicaDescriptor, desc roachpb.RangeDescriptor,
+) ([]error, error) {
+	toStores := make([]roachpb.StoreID, len(repDescs))
+	for i, repDesc := range repDescs {
+		toStores[i] = repDesc.StoreID
+	}
+	// Don't send the range's data to a recipient which raft is already
+	// sending a snapshot to.
+	done, err := r.store.snapshotsInFlight.register(r.RangeID, toStores...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: change replicas aborted", r)
+	}
+	defer done()
+
+	// Hold a reservation on each of the recipients for the whole transfer,
+	// including while it waits to be paced, so that the allocator doesn't
+	// pick them for more snapshots than they accept in the meantime.
+	if sp := r.store.cfg.StorePool; sp != nil {
+		size := r.GetMVCCStats().Total()
+		for _, repDesc := range repDescs {
+			defer sp.reserveSnapshot(repDesc.StoreID, size)()
+		}
+	}
+
+	// The snapshot is streamed to each of the recipients, all of which are
+	// charged to the store's snapshot pacing budget.
+	movementType := r.preemptiveMovementType(desc)
+	if err := r.store.waitForSnapshotPacing(
+		ctx, movementType, r.GetMVCCStats().Total()*int64(len(repDescs))); err != nil {
+		return nil, errors.Wrapf(err, "%s: change replicas failed", r)
+	}
+	snap, err := r.GetSnapshot(ctx)
+	r.mu.Lock()
+	r.mu.outSnap.claimed = true
+	r.mu.Unlock()
+	defer r.CloseOutSnap()
+	log.Event(ctx, "generated snapshot")
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: change replicas failed", r)
+	}
+
+	fromRepDesc, err := r.GetReplicaDescriptor()
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: change replicas failed", r)
+	}
+
+	if err := r.setPendingSnapshotIndex(snap.RaftSnap.Metadata.Index); err != nil {
+		return nil, err
+	}
+
+	snap.movementType = movementType
+	// Send the commands committed while the snapshot is streamed along with
+	// it, so that the recipients don't fall behind the range before they
+	// join it.
+	snap.logTail = r.snapshotLogTail
+	defer r.store.replicaMovements.start(ReplicaMovement{
+		RangeID: r.RangeID,
+		From:    r.store.StoreID(),
+		To:      toStores,
+		Type:    snap.movementType,
+		Bytes:   r.GetMVCCStats().Total(),
+	}, snap)()
+
+	headers := make([]SnapshotRequest_Header, len(repDescs))
+	for i, repDesc := range repDescs {
+		headers[i] = SnapshotRequest_Header{
+			RangeDescriptor: desc,
+			RaftMessageRequest: RaftMessageRequest{
+				RangeID:     r.RangeID,
+				FromReplica: fromRepDesc,
+				ToReplica:   repDesc,
+				Message: raftpb.Message{
+					Type:     raftpb.MsgSnap,
+					To:       0, // special cased ReplicaID for preemptive snapshots
+					From:     uint64(fromRepDesc.ReplicaID),
+					Term:     snap.RaftSnap.Metadata.Term,
+					Snapshot: snap.RaftSnap,
+				},
+			},
+			RangeSize: r.GetMVCCStats().Total(),
+			// Recipients can choose to decline preemptive snapshots.
+			CanDecline: true,
+			Type:       snap.movementType.snapshotType(),
+		}
+	}
+
+	if len(headers) == 1 {
+		if err := r.store.cfg.Transport.SendSnapshot(
+			ctx, r.store.allocator.storePool, headers[0], snap, r.store.Engine().NewBatch); err != nil {
+			return []error{errors.Wrapf(err,
+				"%s: change replicas aborted due to failed preemptive snapshot", r)}, nil
+		}
+		return make([]error, 1), nil
+	}
+	errs := r.store.cfg.Transport.SendSnapshots(
+		ctx, r.store.allocator.storePool, headers, snap, r.store.Engine().NewBatch)
+	for i, err := range errs {
+		if err != nil {
+			errs[i] = errors.Wrapf(err, "%s: change replicas aborted due to failed preemptive snapshot to %+v",
+				r, repDescs[i])
+		}
+	}
+	return errs, nil
+}
+
+// changeReplicas implements ChangeReplicas. If sendSnapshot is false, the
+// caller must already have sent a preemptive snapshot to an added replica.
+func (r *Replica) changeReplicas(
+	ctx context.Context,
+	changeType roachpb.ReplicaChangeType,
+	repDesc roachpb.ReplicaDescriptor,
+	desc *roachpb.RangeDescriptor,
+	sendSnapshot bool,
+) error {
 
 	repDescIdx := -1  // tracks NodeID && StoreID
 	nodeUsed := false // tracks NodeID only
@@ -3132,46 +3650,6 @@ func (r *Replica) ChangeReplicas(
 			return errors.Errorf("%s: unable to add replica %v which is already present", r, repDesc)
 		}
 
-		// Prohibit premature raft log truncation. We set the pending index to 1
-		// here until we determine what it is below. This removes a small window of
-		// opportunity for the raft log to get truncated after the snapshot is
-		// generated.
-		if err := r.setPendingSnapshotIndex(1); err != nil {
-			return err
-		}
-		defer r.clearPendingSnapshotIndex()
-
-		// Send a pre-emptive snapshot. Note that the replica to which this
-		// snapshot is addressed has not yet had its replica ID initialized; this
-		// is intentional, and serves to avoid the following race with the replica
-		// GC queue:
-		//
-		// - snapshot received, a replica is lazily created with the "real" replica ID
-		// - the replica is eligible for GC because it is not yet a member of the range
-		// - GC queue runs, creating a raft tombstone with the replica's ID
-		// - the replica is added to the range
-		// - lazy creation of the replica fails due to the raft tombstone
-		//
-		// Instead, the replica GC queue will create a tombstone with replica ID
-		// zero, which is never legitimately used, and thus never interferes with
-		// raft operations. Racing with the replica GC queue can still partially
-		// negate the benefits of pre-emptive snapshots, but that is a recoverable
-		// degradation, not a catastrophic failure.
-		snap, err := r.GetSnapshot(ctx)
-		r.mu.Lock()
-		r.mu.outSnap.claimed = true
-		r.mu.Unlock()
-		defer r.CloseOutSnap()
-		log.Event(ctx, "generated snapshot")
-		if err != nil {
-			return errors.Wrapf(err, "%s: change replicas failed", r)
-		}
-
-		fromRepDesc, err := r.GetReplicaDescriptor()
-		if err != nil {
-			return errors.Wrapf(err, "%s: change replicas failed", r)
-		}
-
 		if repDesc.ReplicaID != 0 {
 			return errors.Errorf(
 				"must not specify a ReplicaID (%d) for new Replica",
@@ -3179,31 +3657,20 @@ func (r *Replica) ChangeReplicas(
 			)
 		}
 
-		if err := r.setPendingSnapshotIndex(snap.RaftSnap.Metadata.Index); err != nil {
-			return err
-		}
+		if sendSnapshot {
+			// Prohibit premature raft log truncation. We set the pending index to 1
+			// here until we determine what it is below. This removes a small window of
+			// opportunity for the raft log to get truncated after the snapshot is
+			// generated.
+			if err := r.setPendingSnapshotIndex(1); err != nil {
+				return err
+			}
+			defer r.clearPendingSnapshotIndex()
 
-		req := SnapshotRequest_Header{
-			RangeDescriptor: updatedDesc,
-			RaftMessageRequest: RaftMessageRequest{
-				RangeID:     r.RangeID,
-				FromReplica: fromRepDesc,
-				ToReplica:   repDesc,
-				Message: raftpb.Message{
-					Type:     raftpb.MsgSnap,
-					To:       0, // special cased ReplicaID for preemptive snapshots
-					From:     uint64(fromRepDesc.ReplicaID),
-					Term:     snap.RaftSnap.Metadata.Term,
-					Snapshot: snap.RaftSnap,
-				},
-			},
-			RangeSize: r.GetMVCCStats().Total(),
-			// Recipients can choose to decline preemptive snapshots.
-			CanDecline: true,
-		}
-		if err := r.store.cfg.Transport.SendSnapshot(
-			ctx, r.store.allocator.storePool, req, snap, r.store.Engine().NewBatch); err != nil {
-			return errors.Wrapf(err, "%s: change replicas aborted due to failed preemptive snapshot", r)
+			if err := r.sendPreemptiveSnapshots(
+				ctx, []roachpb.ReplicaDescriptor{repDesc}, updatedDesc)[0]; err != nil {
+				return err
+			}
 		}
 
 		repDesc.ReplicaID = updatedDesc.NextReplicaID
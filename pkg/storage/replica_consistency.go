@@ -0,0 +1,165 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
+)
+
+// consistencyCheckCollectDiff controls whether a failed consistency check is
+// rerun to collect the keys, values and timestamps which differ between the
+// replicas. The rerun has the replicas ship a snapshot of their data, which
+// can be expensive for large ranges.
+var consistencyCheckCollectDiff = settings.RegisterBoolSetting(
+	"kv.consistency_check.collect_diff",
+	"if set, a failed consistency check is rerun to collect and log the keys, values and "+
+		"timestamps which differ between the replicas",
+	true,
+)
+
+// consistencyCheckFatalOnFailure controls whether the outliers found by a
+// failed consistency check are terminated or only logged. The store's
+// ConsistencyCheckPanicOnFailure has the same effect.
+var consistencyCheckFatalOnFailure = settings.RegisterBoolSetting(
+	"kv.consistency_check.fatal_on_failure",
+	"if set, the node of a replica which is inconsistent with the majority of the replicas "+
+		"of its range is terminated; otherwise the inconsistency is only logged",
+	false,
+)
+
+// replicaChecksumResult is the checksum a replica reported during a
+// consistency check. The checksum is nil if the replica couldn't be reached.
+type replicaChecksumResult struct {
+	replica  roachpb.ReplicaDescriptor
+	checksum []byte
+}
+
+// consistencyOutliers returns the checksum shared by a majority of the
+// numReplicas replicas of a range, and the replicas which reported a
+// different one. It returns false if no checksum is shared by a majority, in
+// which case the outliers can't be told apart.
+func consistencyOutliers(
+	results []replicaChecksumResult, numReplicas int,
+) ([]byte, []roachpb.ReplicaDescriptor, bool) {
+	counts := make(map[string]int, len(results))
+	for _, res := range results {
+		if res.checksum != nil {
+			counts[string(res.checksum)]++
+		}
+	}
+	var majority []byte
+	for checksum, count := range counts {
+		if count > numReplicas/2 {
+			majority = []byte(checksum)
+			break
+		}
+	}
+	if majority == nil {
+		return nil, nil, false
+	}
+	var outliers []roachpb.ReplicaDescriptor
+	for _, res := range results {
+		if res.checksum != nil && !bytes.Equal(res.checksum, majority) {
+			outliers = append(outliers, res.replica)
+		}
+	}
+	return majority, outliers, true
+}
+
+// consistencyClient returns a ConsistencyClient connected to the given node.
+func (r *Replica) consistencyClient(nodeID roachpb.NodeID) (ConsistencyClient, error) {
+	sp := r.store.cfg.StorePool
+	addr, err := sp.resolver(nodeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not resolve node ID %d", nodeID)
+	}
+	conn, err := sp.rpcContext.GRPCDial(addr.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not dial node ID %d address %s", nodeID, addr)
+	}
+	return NewConsistencyClient(conn), nil
+}
+
+// handleInconsistency acts on the results of a failed consistency check. The
+// outlier replicas are logged, and terminated if
+// kv.consistency_check.fatal_on_failure or the store's
+// ConsistencyCheckPanicOnFailure is set: the nodes of the remote outliers are
+// asked to exit, and the local node exits if the local replica is an outlier,
+// or if the outliers can't be told apart.
+func (r *Replica) handleInconsistency(
+	ctx context.Context,
+	id uuid.UUID,
+	localReplica roachpb.ReplicaDescriptor,
+	results []replicaChecksumResult,
+) {
+	majority, outliers, ok := consistencyOutliers(results, len(r.Desc().Replicas))
+	if ok {
+		log.Errorf(ctx, "replicas %v are inconsistent with the majority of the replicas", outliers)
+	} else {
+		log.Errorf(ctx, "no checksum is shared by a majority of the replicas")
+	}
+	if p := r.store.TestingKnobs().BadChecksumPanic; p != nil {
+		p(r.store.Ident)
+		return
+	}
+	if !r.store.cfg.ConsistencyCheckPanicOnFailure && !consistencyCheckFatalOnFailure.Get() {
+		return
+	}
+	terminateLocal := !ok
+	for _, replica := range outliers {
+		if replica == localReplica {
+			terminateLocal = true
+			continue
+		}
+		r.terminateOutlier(ctx, id, replica, majority)
+	}
+	if terminateLocal {
+		log.Fatalf(ctx, "consistency check failed; terminating the inconsistent replica %s",
+			localReplica)
+	}
+}
+
+// terminateOutlier asks the node of an inconsistent replica to exit, by
+// collecting the replica's checksum again with the majority checksum and
+// CollectChecksumRequest.Terminate set.
+func (r *Replica) terminateOutlier(
+	ctx context.Context, id uuid.UUID, replica roachpb.ReplicaDescriptor, majority []byte,
+) {
+	client, err := r.consistencyClient(replica.NodeID)
+	if err != nil {
+		log.Error(ctx, errors.Wrapf(err, "could not terminate inconsistent replica %s", replica))
+		return
+	}
+	log.Errorf(ctx, "terminating the inconsistent replica %s", replica)
+	req := &CollectChecksumRequest{
+		StoreRequestHeader: StoreRequestHeader{NodeID: replica.NodeID, StoreID: replica.StoreID},
+		RangeID:            r.RangeID,
+		ChecksumID:         id,
+		Checksum:           majority,
+		Terminate:          true,
+	}
+	// The node exits instead of replying, so an error is expected.
+	if _, err := client.CollectChecksum(ctx, req); err == nil {
+		log.Errorf(ctx, "inconsistent replica %s did not terminate", replica)
+	}
+}
@@ -43,20 +43,28 @@ func newReplicaConsistencyQueue(store *Store, gossip *gossip.Gossip) *replicaCon
 		"replica consistency checker", rcq, store, gossip,
 		queueConfig{
 			maxSize:              replicaConsistencyQueueSize,
+			enabled:              consistencyQueueEnabled,
 			needsLease:           true,
 			acceptsUnsplitRanges: true,
 			successes:            store.metrics.ConsistencyQueueSuccesses,
 			failures:             store.metrics.ConsistencyQueueFailures,
 			pending:              store.metrics.ConsistencyQueuePending,
 			processingNanos:      store.metrics.ConsistencyQueueProcessingNanos,
+			purgatory:            store.metrics.ConsistencyQueuePurgatory,
+			processingLatency:    store.metrics.ConsistencyQueueProcessingLatency,
 		},
 	)
 	return rcq
 }
 
 func (*replicaConsistencyQueue) shouldQueue(
-	_ context.Context, _ hlc.Timestamp, _ *Replica, _ config.SystemConfig,
+	_ context.Context, now hlc.Timestamp, _ *Replica, _ config.SystemConfig,
 ) (bool, float64) {
+	// Consistency checks scan whole ranges on every replica; hold them off
+	// outside the maintenance window.
+	if outsideMaintenanceWindow(now.GoTime()) {
+		return false, 0
+	}
 	return true, 1.0
 }
 
@@ -0,0 +1,274 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+)
+
+// commandContainmentEnabled controls what happens when applying a committed
+// raft entry panics or results in a replica corruption error. Since every
+// replica applies the same entry, such a failure is usually deterministic and
+// would crash (or corrupt) every node holding a replica of the range. With
+// containment enabled, the replica instead halts its range without committing
+// anything for the entry and records it, so that an operator can inspect and
+// discard it through the RaftRepair service.
+//
+// Only panics while evaluating the entry's command are contained; fatal
+// errors, and panics while committing the result, still terminate the
+// process.
+var commandContainmentEnabled = settings.RegisterBoolSetting(
+	"kv.raft.command_containment.enabled",
+	"if set, a raft entry which cannot be applied halts its range instead of "+
+		"crashing or corrupting the replica",
+	false,
+)
+
+// applyRaftCommandContained calls applyRaftCommand. If command containment is
+// enabled and applying the entry panicked or resulted in a replica corruption
+// error, it returns that error, which poisoned the entry, instead. Nothing was
+// committed for the entry in that case.
+func (r *Replica) applyRaftCommandContained(
+	ctx context.Context,
+	idKey storagebase.CmdIDKey,
+	index, leaseIndex uint64,
+	ba roachpb.BatchRequest,
+	forcedErr *roachpb.Error,
+) (ProposalData, error) {
+	contain := commandContainmentEnabled.Get()
+	pd := r.applyRaftCommand(ctx, idKey, index, leaseIndex, ba, forcedErr, contain)
+	if cErr, ok := pd.Err.GetDetail().(*roachpb.ReplicaCorruptionError); ok && contain {
+		return ProposalData{}, errors.New(cErr.ErrorMsg)
+	}
+	return pd, nil
+}
+
+// applyRaftCommandInBatchContained calls applyRaftCommandInBatch, turning a
+// panic while evaluating the command into a replica corruption error. The
+// panic may leave the batch the command was evaluated in behind, but nothing
+// in it is committed.
+func (r *Replica) applyRaftCommandInBatchContained(
+	ctx context.Context, idKey storagebase.CmdIDKey, ba roachpb.BatchRequest,
+) (pd ProposalData) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Errorf(ctx, "panic while applying command %x: %v\n%s", idKey, p, debug.Stack())
+			pd = ProposalData{
+				Batch: r.store.Engine().NewBatch(),
+				Err: roachpb.NewError(NewReplicaCorruptionError(
+					errors.Errorf("panic while applying command: %v", p))),
+			}
+		}
+	}()
+	return r.applyRaftCommandInBatch(ctx, idKey, ba)
+}
+
+// haltPoisonedEntry records that the raft entry at the given index could not
+// be applied and halts the range: the replica stops processing raft and
+// refuses requests until the entry is discarded. The entry is persisted, so
+// that the range stays halted across restarts.
+func (r *Replica) haltPoisonedEntry(
+	ctx context.Context,
+	idKey storagebase.CmdIDKey,
+	index uint64,
+	raftCmd storagebase.RaftCommand,
+	poisonErr error,
+) {
+	r.store.metrics.RaftCommandsPoisoned.Inc(1)
+	log.Errorf(ctx, "halting range: raft entry %d (command %x) could not be applied: %s",
+		index, idKey, poisonErr)
+
+	entry := &PoisonedEntry{
+		RangeID:   r.RangeID,
+		Index:     index,
+		CommandID: fmt.Sprintf("%x", idKey),
+		Command:   raftCmd.Cmd.String(),
+		Error:     poisonErr.Error(),
+	}
+	// If the entry can't be persisted, the range is only halted until the
+	// replica is restarted and applies the entry again.
+	if err := setPoisonedEntry(ctx, r.store.Engine(), r.RangeID, entry); err != nil {
+		log.Errorf(ctx, "unable to persist poisoned raft entry %d: %s", index, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.haltLocked(entry)
+}
+
+// haltLocked halts the range on the given poisoned entry.
+//
+// Requires that Replica.mu is held.
+func (r *Replica) haltLocked(entry *PoisonedEntry) {
+	r.mu.poisoned = entry
+	// The replica is marked as corrupted so that it is neither used nor
+	// recreated while it is halted. Unlike other corruption, this is undone
+	// when the entry is discarded.
+	r.mu.destroyed = NewReplicaCorruptionError(
+		errors.Errorf("raft entry %d needs repair: %s", entry.Index, entry.Error))
+	r.mu.corrupted = true
+}
+
+// isPoisoned returns true if the range is halted on a poisoned raft entry.
+func (r *Replica) isPoisoned() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.mu.poisoned != nil
+}
+
+// PoisonedEntry returns the raft entry the range is halted on, or nil if it
+// isn't halted.
+func (r *Replica) PoisonedEntry() *PoisonedEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mu.poisoned == nil {
+		return nil
+	}
+	entry := *r.mu.poisoned
+	return &entry
+}
+
+// DiscardPoisonedEntry resumes a range halted on the poisoned raft entry at
+// the given index by discarding the entry on every replica of the range, so
+// that they all apply it as a no-op, failing the command it carries. The
+// replica must be halted on the entry. The other replicas are reached through
+// the RaftRepair service of their nodes; those which haven't applied the
+// entry yet discard it once they get to it. Replicas which already discarded
+// the entry ignore being asked again, so a failed discard can be retried.
+func (r *Replica) DiscardPoisonedEntry(
+	ctx context.Context, index uint64, reason string,
+) (PoisonedEntry, error) {
+	entry := r.PoisonedEntry()
+	if entry == nil {
+		return PoisonedEntry{}, errors.Errorf("%s is not halted on a poisoned raft entry", r)
+	}
+	if entry.Index != index {
+		return PoisonedEntry{}, errors.Errorf("%s is halted on raft entry %d, not %d",
+			r, entry.Index, index)
+	}
+	for _, replica := range r.Desc().Replicas {
+		if replica.StoreID == r.store.StoreID() {
+			continue
+		}
+		client, err := r.raftRepairClient(replica.NodeID)
+		if err != nil {
+			return PoisonedEntry{}, err
+		}
+		if _, err := client.DiscardPoisonedEntry(ctx, &DiscardPoisonedEntryRequest{
+			StoreRequestHeader: StoreRequestHeader{NodeID: replica.NodeID, StoreID: replica.StoreID},
+			RangeID:            r.RangeID,
+			Index:              index,
+			Reason:             reason,
+			LocalOnly:          true,
+		}); err != nil {
+			return PoisonedEntry{}, errors.Wrapf(err, "could not discard raft entry %d on replica %s",
+				index, replica)
+		}
+	}
+	return r.discardPoisonedEntryLocal(ctx, index, reason)
+}
+
+// discardPoisonedEntryLocal discards the raft entry at the given index on
+// this replica only. The replica must either be halted on the entry or not
+// have applied it yet. The discard is persisted and logged along with the
+// supplied reason.
+func (r *Replica) discardPoisonedEntryLocal(
+	ctx context.Context, index uint64, reason string,
+) (PoisonedEntry, error) {
+	r.mu.Lock()
+	var entry PoisonedEntry
+	switch {
+	case r.mu.poisoned != nil:
+		if r.mu.poisoned.Index != index {
+			r.mu.Unlock()
+			return PoisonedEntry{}, errors.Errorf("%s is halted on raft entry %d, not %d",
+				r, r.mu.poisoned.Index, index)
+		}
+		entry = *r.mu.poisoned
+	case r.mu.state.RaftAppliedIndex < index:
+		if r.mu.discardIndex == index {
+			r.mu.Unlock()
+			return PoisonedEntry{RangeID: r.RangeID, Index: index, Discarded: true}, nil
+		}
+		entry = PoisonedEntry{RangeID: r.RangeID, Index: index}
+	default:
+		r.mu.Unlock()
+		// The entry may have been applied after it was discarded before.
+		prev, err := loadPoisonedEntry(ctx, r.store.Engine(), r.RangeID)
+		if err != nil {
+			return PoisonedEntry{}, err
+		}
+		if prev != nil && prev.Discarded && prev.Index == index {
+			return *prev, nil
+		}
+		return PoisonedEntry{}, errors.Errorf("%s already applied raft entry %d", r, index)
+	}
+	entry.Discarded = true
+	if err := setPoisonedEntry(ctx, r.store.Engine(), r.RangeID, &entry); err != nil {
+		r.mu.Unlock()
+		return PoisonedEntry{}, err
+	}
+	halted := r.mu.poisoned != nil
+	if halted {
+		log.Warningf(ctx, "discarding poisoned raft entry %d (command %s: %s), which failed with %q; reason: %q",
+			entry.Index, entry.CommandID, entry.Command, entry.Error, reason)
+	} else {
+		log.Warningf(ctx, "discarding raft entry %d once it is applied; reason: %q", entry.Index, reason)
+	}
+	r.mu.discardIndex = index
+	r.mu.poisoned = nil
+	r.mu.destroyed = nil
+	r.mu.corrupted = false
+	r.mu.Unlock()
+
+	r.store.metrics.RaftCommandsDiscarded.Inc(1)
+	if halted {
+		r.store.enqueueRaftUpdateCheck(r.RangeID)
+	}
+	return entry, nil
+}
+
+// maybeDiscardLocked returns the error with which the raft entry at the given
+// index is applied if an operator discarded it, and nil otherwise.
+func (r *Replica) maybeDiscardLocked(index uint64) *roachpb.Error {
+	if r.mu.discardIndex == 0 || r.mu.discardIndex != index {
+		return nil
+	}
+	r.mu.discardIndex = 0
+	return roachpb.NewErrorf("raft entry %d was discarded", index)
+}
+
+// raftRepairClient returns a RaftRepairClient connected to the given node.
+func (r *Replica) raftRepairClient(nodeID roachpb.NodeID) (RaftRepairClient, error) {
+	sp := r.store.cfg.StorePool
+	addr, err := sp.resolver(nodeID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not resolve node ID %d", nodeID)
+	}
+	conn, err := sp.rpcContext.GRPCDial(addr.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not dial node ID %d address %s", nodeID, addr)
+	}
+	return NewRaftRepairClient(conn), nil
+}
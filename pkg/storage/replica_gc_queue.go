@@ -78,12 +78,15 @@ func newReplicaGCQueue(store *Store, db *client.DB, gossip *gossip.Gossip) *repl
 		"replicaGC", q, store, gossip,
 		queueConfig{
 			maxSize:              replicaGCQueueMaxSize,
+			enabled:              replicaGCQueueEnabled,
 			needsLease:           false,
 			acceptsUnsplitRanges: true,
 			successes:            store.metrics.ReplicaGCQueueSuccesses,
 			failures:             store.metrics.ReplicaGCQueueFailures,
 			pending:              store.metrics.ReplicaGCQueuePending,
 			processingNanos:      store.metrics.ReplicaGCQueueProcessingNanos,
+			purgatory:            store.metrics.ReplicaGCQueuePurgatory,
+			processingLatency:    store.metrics.ReplicaGCQueueProcessingLatency,
 		},
 	)
 	return q
@@ -156,6 +159,13 @@ func replicaGCShouldQueueImpl(
 func (q *replicaGCQueue) process(
 	ctx context.Context, now hlc.Timestamp, rng *Replica, _ config.SystemConfig,
 ) error {
+	if removedDesc, ok := rng.confirmedRemoval(); ok {
+		// The replica applied the command which removed it from the range, so
+		// there is no need to look up the range descriptor.
+		log.VEventf(ctx, 1, "destroying local data of removed replica")
+		return rng.store.RemoveReplica(rng, removedDesc, true)
+	}
+
 	// Note that the Replicas field of desc is probably out of date, so
 	// we should only use `desc` for its static fields like RangeID and
 	// StartKey (and avoid rng.GetReplica() for the same reason).
@@ -218,6 +228,45 @@ func (q *replicaGCQueue) process(
 	return nil
 }
 
+// handleReplicasRemoved is called when the replica applies an update of its
+// range descriptor from oldDesc to newDesc. Replicas removed by the update are
+// no longer reported as dead by the StorePool, and if the replica itself was
+// removed, it records the removal, so that the replica GC queue, to which the
+// change replicas trigger adds it, can destroy it without further checks.
+func (r *Replica) handleReplicasRemoved(oldDesc, newDesc *roachpb.RangeDescriptor) {
+	storeID := r.store.StoreID()
+	for _, repl := range oldDesc.Replicas {
+		if _, ok := newDesc.GetReplicaDescriptor(repl.StoreID); ok {
+			continue
+		}
+		if sp := r.store.cfg.StorePool; sp != nil {
+			sp.removeDeadReplica(repl.StoreID, newDesc.RangeID, repl.ReplicaID)
+		}
+		if repl.StoreID != storeID {
+			continue
+		}
+		r.mu.Lock()
+		if r.mu.replicaID == repl.ReplicaID {
+			r.mu.removedDesc = newDesc
+			r.mu.removedReplicaID = repl.ReplicaID
+		}
+		r.mu.Unlock()
+	}
+}
+
+// confirmedRemoval returns the range descriptor which removed the replica
+// from its range if the replica applied it, in which case the replica can be
+// garbage collected without further checks. The removal no longer counts if
+// the replica has since been re-added to the range under a new replica ID.
+func (r *Replica) confirmedRemoval() (roachpb.RangeDescriptor, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mu.removedDesc == nil || r.mu.replicaID != r.mu.removedReplicaID {
+		return roachpb.RangeDescriptor{}, false
+	}
+	return *r.mu.removedDesc, true
+}
+
 func (*replicaGCQueue) timer() time.Duration {
 	return replicaGCQueueTimerDuration
 }
@@ -17,9 +17,11 @@
 package storage
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 )
@@ -73,3 +75,45 @@ func TestReplicaGCShouldQueue(t *testing.T) {
 		}
 	}
 }
+
+// TestReplicaGCConfirmedRemoval verifies that a replica which applies a range
+// descriptor without itself records its removal, while the removal of other
+// replicas doesn't.
+func TestReplicaGCConfirmedRemoval(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	oldDesc := *tc.rng.Desc()
+	self, ok := oldDesc.GetReplicaDescriptor(tc.store.StoreID())
+	if !ok {
+		t.Fatalf("replica of store %d not found in %+v", tc.store.StoreID(), oldDesc)
+	}
+	other := roachpb.ReplicaDescriptor{
+		NodeID:    self.NodeID + 1,
+		StoreID:   self.StoreID + 1,
+		ReplicaID: oldDesc.NextReplicaID,
+	}
+	oldDesc.Replicas = append(oldDesc.Replicas, other)
+	oldDesc.NextReplicaID++
+
+	// Removing another replica isn't a removal of this one.
+	newDesc := oldDesc
+	newDesc.Replicas = []roachpb.ReplicaDescriptor{self}
+	tc.rng.handleReplicasRemoved(&oldDesc, &newDesc)
+	if _, ok := tc.rng.confirmedRemoval(); ok {
+		t.Fatal("unexpected confirmed removal")
+	}
+
+	newDesc = oldDesc
+	newDesc.Replicas = []roachpb.ReplicaDescriptor{other}
+	tc.rng.handleReplicasRemoved(&oldDesc, &newDesc)
+	removedDesc, ok := tc.rng.confirmedRemoval()
+	if !ok {
+		t.Fatal("expected a confirmed removal")
+	}
+	if !reflect.DeepEqual(removedDesc, newDesc) {
+		t.Fatalf("expected removal by %+v, got %+v", newDesc, removedDesc)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+)
+
+// ReplicaLoad is the load on a replica, as moving averages over
+// storeLoadTimescale.
+type ReplicaLoad struct {
+	// QueriesPerSecond and WritesPerSecond count the batches (respectively
+	// the write batches) served by the replica, except for the ones the
+	// client marked as COLD.
+	QueriesPerSecond float64
+	WritesPerSecond  float64
+	// ColdQueriesPerSecond counts the batches marked as COLD, which are part
+	// of a known, transient workload.
+	ColdQueriesPerSecond float64
+	// RemoteQueriesPerSecond is the part of QueriesPerSecond sent by gateways
+	// in another region than the replica's store.
+	RemoteQueriesPerSecond float64
+}
+
+// RemoteFraction returns the fraction of the queries served by the replica
+// which come from gateways in other regions.
+func (l ReplicaLoad) RemoteFraction() float64 {
+	if l.QueriesPerSecond <= 0 {
+		return 0
+	}
+	return l.RemoteQueriesPerSecond / l.QueriesPerSecond
+}
+
+// priority maps the write load of the replica to [0, 1). The split and
+// replicate queues add it to the priority of a range, so that the ranges
+// serving the most writes are split and rebalanced first. Since COLD batches
+// don't count, a known batch workload doesn't move its ranges ahead.
+func (l ReplicaLoad) priority() float64 {
+	return l.WritesPerSecond / (1 + l.WritesPerSecond)
+}
+
+// replicaLoad tracks the load on a replica. Batches marked as COLD by their
+// client are tracked separately, so that a known batch workload, like a
+// nightly job, doesn't make the range look hot.
+type replicaLoad struct {
+	queries       *metric.Rate
+	writes        *metric.Rate
+	coldQueries   *metric.Rate
+	remoteQueries *metric.Rate
+}
+
+func newReplicaLoad() *replicaLoad {
+	return &replicaLoad{
+		queries:       metric.NewRate(storeLoadTimescale),
+		writes:        metric.NewRate(storeLoadTimescale),
+		coldQueries:   metric.NewRate(storeLoadTimescale),
+		remoteQueries: metric.NewRate(storeLoadTimescale),
+	}
+}
+
+// record accounts for a batch served by the replica. remote is set if the
+// batch was sent by a gateway in another region than the replica's store.
+func (l *replicaLoad) record(ba roachpb.BatchRequest, remote bool) {
+	if ba.Temperature == roachpb.COLD {
+		l.coldQueries.Add(1)
+		return
+	}
+	l.queries.Add(1)
+	if remote {
+		l.remoteQueries.Add(1)
+	}
+	if !ba.IsReadOnly() {
+		l.writes.Add(1)
+	}
+}
+
+// Load returns the load on the replica.
+func (r *Replica) Load() ReplicaLoad {
+	return ReplicaLoad{
+		QueriesPerSecond:     r.load.queries.Value(),
+		WritesPerSecond:      r.load.writes.Value(),
+		ColdQueriesPerSecond: r.load.coldQueries.Value(),
+
+		RemoteQueriesPerSecond: r.load.remoteQueries.Value(),
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// ReplicaMovementType classifies the snapshots streamed by a store by why a
+// replica is moving.
+type ReplicaMovementType int
+
+const (
+	// MovementRebalance is a preemptive snapshot adding a replica to a range
+	// which has all of its replicas.
+	MovementRebalance ReplicaMovementType = iota
+	// MovementRecovery is a preemptive snapshot adding a replica to a range
+	// which is missing replicas or has replicas on dead stores.
+	MovementRecovery
+	// MovementRaft is a snapshot requested by raft to catch up a replica which
+	// fell behind the range's truncated log.
+	MovementRaft
+)
+
+var replicaMovementTypeNames = []string{
+	MovementRebalance: "rebalance",
+	MovementRecovery:  "recovery",
+	MovementRaft:      "raft",
+}
+
+func (t ReplicaMovementType) String() string {
+	if t >= 0 && int(t) < len(replicaMovementTypeNames) {
+		return replicaMovementTypeNames[t]
+	}
+	return fmt.Sprintf("ReplicaMovementType(%d)", int(t))
+}
+
+// ReplicaMovement reports on a snapshot being streamed by or to a store.
+type ReplicaMovement struct {
+	RangeID roachpb.RangeID
+	// From is the sending store; To are the recipients of the snapshot.
+	From roachpb.StoreID
+	To   []roachpb.StoreID
+	Type ReplicaMovementType
+	// Incoming is set on the snapshots the store receives, of which it is
+	// the only recipient.
+	Incoming bool
+	// Bytes is the estimated size of the snapshot, and SentBytes the size of
+	// the data streamed so far.
+	Bytes, SentBytes int64
+	Started          time.Time
+}
+
+// Rate returns the rate, in bytes per second, at which the snapshot has
+// been streamed so far.
+func (m ReplicaMovement) Rate(now time.Time) float64 {
+	elapsed := now.Sub(m.Started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(m.SentBytes) / elapsed
+}
+
+// ETA returns the estimated time until the snapshot is streamed, at the rate
+// it was streamed so far. It is negative if unknown.
+func (m ReplicaMovement) ETA(now time.Time) time.Duration {
+	rate := m.Rate(now)
+	if rate <= 0 {
+		return -1
+	}
+	remaining := m.Bytes - m.SentBytes
+	if remaining < 0 {
+		remaining = 0
+	}
+	return time.Duration(float64(remaining) / rate * float64(time.Second))
+}
+
+// replicaMovement is an in-flight snapshot tracked by replicaMovements.
+type replicaMovement struct {
+	ReplicaMovement
+	// streamedBytes is the size of the data streamed so far, which is
+	// updated atomically.
+	streamedBytes *int64
+}
+
+// replicaMovements tracks the snapshots being streamed by and to a store.
+type replicaMovements struct {
+	mu struct {
+		syncutil.Mutex
+		inFlight map[*replicaMovement]struct{}
+	}
+}
+
+func newReplicaMovements() *replicaMovements {
+	m := &replicaMovements{}
+	m.mu.inFlight = make(map[*replicaMovement]struct{})
+	return m
+}
+
+// start tracks the streaming of the snapshot, until the returned function is
+// called.
+func (m *replicaMovements) start(mv ReplicaMovement, snap *OutgoingSnapshot) func() {
+	return m.track(mv, &snap.sentBytes)
+}
+
+// startIncoming tracks the receipt of a snapshot, of which receivedBytes is
+// the size of the data received so far, until the returned function is
+// called.
+func (m *replicaMovements) startIncoming(mv ReplicaMovement, receivedBytes *int64) func() {
+	mv.Incoming = true
+	return m.track(mv, receivedBytes)
+}
+
+func (m *replicaMovements) track(mv ReplicaMovement, streamedBytes *int64) func() {
+	mv.Started = timeutil.Now()
+	entry := &replicaMovement{ReplicaMovement: mv, streamedBytes: streamedBytes}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mu.inFlight[entry] = struct{}{}
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.mu.inFlight, entry)
+	}
+}
+
+// list returns the snapshots being streamed.
+func (m *replicaMovements) list() []ReplicaMovement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	movements := make([]ReplicaMovement, 0, len(m.mu.inFlight))
+	for entry := range m.mu.inFlight {
+		mv := entry.ReplicaMovement
+		mv.SentBytes = atomic.LoadInt64(entry.streamedBytes)
+		movements = append(movements, mv)
+	}
+	return movements
+}
+
+// ReplicaMovements returns the snapshots the store is streaming to other
+// stores and receiving from them.
+func (s *Store) ReplicaMovements() []ReplicaMovement {
+	return s.replicaMovements.list()
+}
+
+// updateSnapshotGauges updates the gauges of the snapshots being sent and
+// received by the store, and of the rates at which they are streamed.
+func (s *Store) updateSnapshotGauges() {
+	now := timeutil.Now()
+	var sending, receiving int64
+	var sendRate, receiveRate float64
+	for _, m := range s.replicaMovements.list() {
+		if m.Incoming {
+			receiving++
+			receiveRate += m.Rate(now)
+		} else {
+			sending++
+			sendRate += m.Rate(now)
+		}
+	}
+	s.metrics.RangeSnapshotsSending.Update(sending)
+	s.metrics.RangeSnapshotsReceiving.Update(receiving)
+	s.metrics.RangeSnapshotsSendRate.Update(int64(sendRate))
+	s.metrics.RangeSnapshotsReceiveRate.Update(int64(receiveRate))
+}
+
+// snapshotType returns the type which tags the snapshots of the movement.
+func (t ReplicaMovementType) snapshotType() SnapshotRequest_Type {
+	switch t {
+	case MovementRecovery:
+		return SnapshotRequest_RECOVERY
+	case MovementRaft:
+		return SnapshotRequest_RAFT
+	default:
+		return SnapshotRequest_REBALANCE
+	}
+}
+
+// incomingMovementType classifies a snapshot received by the store. Only
+// preemptive snapshots can be declined, which tells raft snapshots apart
+// from the untagged snapshots of older senders.
+func incomingMovementType(header *SnapshotRequest_Header) ReplicaMovementType {
+	if !header.CanDecline {
+		return MovementRaft
+	}
+	if header.Type == SnapshotRequest_RECOVERY {
+		return MovementRecovery
+	}
+	return MovementRebalance
+}
+
+// preemptiveMovementType classifies a preemptive snapshot of the range as a
+// recovery if the range is missing replicas or has replicas on dead stores,
+// and as a rebalance otherwise.
+func (r *Replica) preemptiveMovementType(desc roachpb.RangeDescriptor) ReplicaMovementType {
+	if sp := r.store.cfg.StorePool; sp != nil && len(sp.deadReplicas(desc.RangeID, desc.Replicas)) > 0 {
+		return MovementRecovery
+	}
+	if g := r.store.Gossip(); g != nil {
+		if sysCfg, ok := g.GetSystemConfig(); ok {
+			if zone, err := sysCfg.GetZoneConfigForKey(desc.StartKey); err == nil &&
+				len(desc.Replicas) < int(zone.NumReplicas) {
+				return MovementRecovery
+			}
+		}
+	}
+	return MovementRebalance
+}
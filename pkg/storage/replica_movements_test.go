@@ -0,0 +1,121 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestReplicaMovementRate(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	start := time.Unix(0, 0)
+	m := ReplicaMovement{Bytes: 100, Started: start}
+	if eta := m.ETA(start.Add(time.Second)); eta >= 0 {
+		t.Errorf("expected an unknown ETA before any data is sent, got %s", eta)
+	}
+	m.SentBytes = 20
+	now := start.Add(2 * time.Second)
+	if rate := m.Rate(now); rate != 10 {
+		t.Errorf("expected a rate of 10 B/s, got %f", rate)
+	}
+	if eta := m.ETA(now); eta != 8*time.Second {
+		t.Errorf("expected an ETA of 8s, got %s", eta)
+	}
+}
+
+func TestReplicaMovementsTracking(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	movements := newReplicaMovements()
+	snap := &OutgoingSnapshot{}
+	done := movements.start(ReplicaMovement{
+		RangeID: 1,
+		From:    1,
+		To:      []roachpb.StoreID{2, 3},
+		Type:    MovementRecovery,
+		Bytes:   100,
+	}, snap)
+	atomic.AddInt64(&snap.sentBytes, 40)
+
+	list := movements.list()
+	if len(list) != 1 {
+		t.Fatalf("expected 1 movement, got %d", len(list))
+	}
+	if m := list[0]; m.RangeID != 1 || m.Type != MovementRecovery || m.SentBytes != 40 || m.Started.IsZero() {
+		t.Errorf("unexpected movement %+v", m)
+	}
+
+	var receivedBytes int64
+	doneIncoming := movements.startIncoming(ReplicaMovement{
+		RangeID: 2,
+		From:    3,
+		To:      []roachpb.StoreID{1},
+		Type:    MovementRebalance,
+		Bytes:   50,
+	}, &receivedBytes)
+	atomic.AddInt64(&receivedBytes, 30)
+	list = movements.list()
+	if len(list) != 2 {
+		t.Fatalf("expected 2 movements, got %d", len(list))
+	}
+	for _, m := range list {
+		if m.RangeID == 2 && (!m.Incoming || m.SentBytes != 30) {
+			t.Errorf("unexpected incoming movement %+v", m)
+		} else if m.RangeID == 1 && m.Incoming {
+			t.Errorf("unexpected outgoing movement %+v", m)
+		}
+	}
+
+	done()
+	doneIncoming()
+	if list := movements.list(); len(list) != 0 {
+		t.Errorf("expected no movements once done, got %+v", list)
+	}
+}
+
+func TestIncomingMovementType(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		header   SnapshotRequest_Header
+		expected ReplicaMovementType
+	}{
+		{SnapshotRequest_Header{CanDecline: true}, MovementRebalance},
+		{SnapshotRequest_Header{CanDecline: true, Type: SnapshotRequest_REBALANCE}, MovementRebalance},
+		{SnapshotRequest_Header{CanDecline: true, Type: SnapshotRequest_RECOVERY}, MovementRecovery},
+		{SnapshotRequest_Header{Type: SnapshotRequest_RAFT}, MovementRaft},
+		// Snapshots which can't be declined are raft snapshots, even if they
+		// aren't tagged as such.
+		{SnapshotRequest_Header{}, MovementRaft},
+	}
+	for i, c := range testCases {
+		if typ := incomingMovementType(&c.header); typ != c.expected {
+			t.Errorf("%d: expected a %s snapshot, got %s", i, c.expected, typ)
+		}
+	}
+
+	for _, typ := range []ReplicaMovementType{MovementRebalance, MovementRecovery, MovementRaft} {
+		header := SnapshotRequest_Header{CanDecline: typ != MovementRaft, Type: typ.snapshotType()}
+		if incoming := incomingMovementType(&header); incoming != typ {
+			t.Errorf("expected a %s snapshot to be received as such, got %s", typ, incoming)
+		}
+	}
+}
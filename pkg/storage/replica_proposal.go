@@ -22,6 +22,7 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
@@ -48,6 +49,11 @@ type LocalProposalData struct {
 	idKey           storagebase.CmdIDKey
 	proposedAtTicks int
 	ctx             context.Context
+	// abandoned is set when the client stopped waiting for the command. An
+	// abandoned command is neither reproposed nor refurbished, and its
+	// result isn't sent anywhere; ctx no longer refers to the client's
+	// context then.
+	abandoned bool
 
 	Err   *roachpb.Error
 	Reply *roachpb.BatchResponse
@@ -142,6 +148,7 @@ func (p *ProposalData) MergeAndDestroy(q ProposalData) error {
 	if (q.State.Stats != enginepb.MVCCStats{}) {
 		return errors.New("must not specify Stats")
 	}
+	coalesceBool(&p.State.UsingAppliedStateKey, q.State.UsingAppliedStateKey)
 	if p.State.Frozen == storagebase.ReplicaState_FROZEN_UNSPECIFIED {
 		p.State.Frozen = q.State.Frozen
 	} else if q.State.Frozen != storagebase.ReplicaState_FROZEN_UNSPECIFIED {
@@ -258,12 +265,17 @@ func (r *Replica) computeChecksumPostApply(
 			log.Errorf(ctx, "%v", err)
 			sha = nil
 		}
-		r.computeChecksumDone(ctx, id, sha, snapshot)
+		persisted, recomputed, err := computeChecksumStats(ctx, desc, snap)
+		if err != nil {
+			log.Errorf(ctx, "%v", err)
+			sha = nil
+		}
+		r.computeChecksumDone(ctx, id, sha, snapshot, persisted, recomputed)
 	}); err != nil {
 		defer snap.Close()
 		log.Error(ctx, errors.Wrapf(err, "could not run async checksum computation (ID = %s)", id))
 		// Set checksum to nil.
-		r.computeChecksumDone(ctx, id, nil, nil)
+		r.computeChecksumDone(ctx, id, nil, nil, enginepb.MVCCStats{}, enginepb.MVCCStats{})
 	}
 }
 
@@ -300,6 +312,13 @@ func (r *Replica) leasePostApply(
 		if r.IsFirstRange() && newLease.Covers(r.store.Clock().Now()) {
 			r.gossipFirstRange(ctx)
 		}
+
+		// Let clients which haven't yet learned about the new lease holder find
+		// it through the meta addressing records. As above, the lease must be
+		// active so that a trailing replica doesn't record a stale hint.
+		if newLease.Covers(r.store.Clock().Now()) {
+			r.maybeUpdateLeaseHolderHint(newLease.Replica)
+		}
 	}
 	if leaseChangingHands && !iAmTheLeaseHolder {
 		// We're not the lease holder, reset our timestamp cache, releasing
@@ -327,6 +346,35 @@ func (r *Replica) leasePostApply(
 	}
 }
 
+// leaseHolderHintsEnabled controls whether new lease holders record
+// themselves in the meta addressing records of their range.
+var leaseHolderHintsEnabled = settings.RegisterBoolSetting(
+	"kv.range_descriptor.lease_holder_hints.enabled",
+	"if set, the lease holder of a range is recorded in its meta addressing records "+
+		"when the lease changes hands",
+	true,
+)
+
+// maybeUpdateLeaseHolderHint asynchronously records leaseHolder as the lease
+// holder hint in the meta addressing records of the range, unless hints are
+// disabled by kv.range_descriptor.lease_holder_hints.enabled. A failure to
+// do so is not an error: the hint is only used to route requests of clients
+// with cold caches and is refreshed on the next lease change.
+func (r *Replica) maybeUpdateLeaseHolderHint(leaseHolder roachpb.ReplicaDescriptor) {
+	if !leaseHolderHintsEnabled.Get() {
+		return
+	}
+	desc := r.Desc()
+	ctx := r.AnnotateCtx(context.Background())
+	if err := r.store.Stopper().RunAsyncTask(ctx, func(ctx context.Context) {
+		if err := updateLeaseHolderHint(ctx, r.store.DB(), desc, leaseHolder); err != nil {
+			log.VEventf(ctx, 1, "unable to update lease holder hint: %s", err)
+		}
+	}); err != nil {
+		log.VEventf(ctx, 1, "unable to update lease holder hint: %s", err)
+	}
+}
+
 // maybeTransferRaftLeadership attempts to transfer the leadership away from
 // this node to target, if this node is the current raft leader.
 // The transfer might silently fail, particularly (only?) if the transferee is
@@ -435,6 +483,7 @@ func (r *Replica) handleProposalData(
 	if newDesc := pd.State.Desc; newDesc != nil {
 		pd.State.Desc = nil // for assertion
 
+		oldDesc := r.Desc()
 		if err := r.setDesc(newDesc); err != nil {
 			// Log the error. There's not much we can do because the commit may
 			// have already occurred at this point.
@@ -443,6 +492,8 @@ func (r *Replica) handleProposalData(
 				"failed to update range descriptor to %+v: %s",
 				newDesc, err,
 			)
+		} else {
+			r.handleReplicasRemoved(oldDesc, newDesc)
 		}
 	}
 
@@ -468,6 +519,13 @@ func (r *Replica) handleProposalData(
 		r.store.raftEntryCache.clearTo(r.RangeID, newTruncState.Index+1)
 	}
 
+	if pd.State.UsingAppliedStateKey {
+		r.mu.Lock()
+		r.mu.state.UsingAppliedStateKey = true
+		r.mu.Unlock()
+		pd.State.UsingAppliedStateKey = false
+	}
+
 	if newThresh := pd.State.GCThreshold; newThresh != hlc.ZeroTimestamp {
 		r.mu.Lock()
 		r.mu.state.GCThreshold = newThresh
@@ -510,8 +568,10 @@ func (r *Replica) handleProposalData(
 
 	if pd.raftLogSize != nil {
 		r.mu.Lock()
+		truncated := r.mu.raftLogSize - *pd.raftLogSize
 		r.mu.raftLogSize = *pd.raftLogSize
 		r.mu.Unlock()
+		r.store.raftLogBackpressure.recordTruncate(truncated)
 		pd.raftLogSize = nil
 	}
 
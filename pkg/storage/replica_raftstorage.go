@@ -320,11 +320,30 @@ func (r *Replica) SnapshotWithContext(ctx context.Context) (*OutgoingSnapshot, e
 	}
 	log.Event(ctx, "snapshot generated")
 	r.store.metrics.RangeSnapshotsGenerated.Inc(1)
+	snapData.maxRate = r.zoneSnapshotMaxRate(startKey)
 	r.mu.outSnap = snapData
 	r.mu.outSnapDone = make(chan struct{})
 	return &r.mu.outSnap, nil
 }
 
+// zoneSnapshotMaxRate returns the snapshot rate limit set by the zone config
+// of the range starting at startKey, or zero if the zone doesn't set one.
+func (r *Replica) zoneSnapshotMaxRate(startKey roachpb.RKey) int64 {
+	g := r.store.Gossip()
+	if g == nil {
+		return 0
+	}
+	sysCfg, ok := g.GetSystemConfig()
+	if !ok {
+		return 0
+	}
+	zone, err := sysCfg.GetZoneConfigForKey(startKey)
+	if err != nil {
+		return 0
+	}
+	return zone.SnapshotMaxRate
+}
+
 // GetSnapshot wraps Snapshot() but does not require the replica lock
 // to be held and it will block instead of returning
 // ErrSnapshotTemporaryUnavailable. The caller is directly responsible for
@@ -366,6 +385,38 @@ type OutgoingSnapshot struct {
 	Iter *ReplicaDataIterator
 	// True if a goroutine has scheduled a call to CloseOutSnap for this snap.
 	claimed bool
+	// The size of the key-value batches streamed so far. Accessed atomically.
+	sentBytes int64
+	// The rate limit of the snapshot's stream, in bytes per second, set by
+	// the zone config of the range. Zero defers to the cluster settings.
+	maxRate int64
+	// Why the snapshot is sent, which picks the cluster setting limiting
+	// its rate.
+	movementType ReplicaMovementType
+	// If set, logTail returns the log entries from the given index which
+	// were committed while the snapshot was streamed. They are sent after the
+	// snapshot's own log entries; see snapshotLogTail.
+	logTail func(ctx context.Context, lo uint64) ([][]byte, error)
+}
+
+// rateLimit returns the rate limit of the snapshot's stream, in bytes per
+// second, or zero if it isn't limited. The zone config of the range takes
+// precedence over the limit of the snapshot's movement type, which itself
+// falls back to kv.snapshot.max_rate if unset.
+func (snap *OutgoingSnapshot) rateLimit() int64 {
+	if snap.maxRate != 0 {
+		return snap.maxRate
+	}
+	var rate int64
+	if snap.movementType == MovementRebalance {
+		rate = rebalanceSnapshotMaxRate.Get()
+	} else {
+		rate = recoverySnapshotMaxRate.Get()
+	}
+	if rate == 0 {
+		rate = snapshotMaxRate.Get()
+	}
+	return rate
 }
 
 // IncomingSnapshot contains the data for an incoming streaming snapshot message.
@@ -373,9 +424,12 @@ type IncomingSnapshot struct {
 	SnapUUID uuid.UUID
 	// The target RangeDescriptor for this snapshot.
 	RangeDescriptor roachpb.RangeDescriptor
-	// The RocksDB BatchReprs that make up this snapshot.
+	// The RocksDB BatchReprs that make up this snapshot, followed by those
+	// which were spilled to disk as they were received.
 	Batches [][]byte
-	// The Raft log entries for this snapshot.
+	spill   *snapshotSpill
+	// The Raft log entries for this snapshot, possibly followed by entries
+	// past the snapshot's index which were committed while it was streamed.
 	LogEntries [][]byte
 }
 
@@ -550,7 +604,7 @@ func (r *Replica) updateRangeInfo(desc *roachpb.RangeDescriptor) error {
 // r.store.processRangeDescriptorUpdate(r) after a successful applySnapshot.
 func (r *Replica) applySnapshot(
 	ctx context.Context, inSnap IncomingSnapshot, snap raftpb.Snapshot, hs raftpb.HardState,
-) error {
+) (retErr error) {
 	// Extract the updated range descriptor.
 	desc := inSnap.RangeDescriptor
 	// Fill the reservation if there was one for this range, regardless of
@@ -574,12 +628,33 @@ func (r *Replica) applySnapshot(
 	log.Infof(ctx, "%s: with replicaID %s, applying %s snapshot at index %d "+
 		"(id=%s, encoded size=%d, %d rocksdb batches, %d log entries)",
 		r, replicaIDStr, snapType, snap.Metadata.Index, inSnap.SnapUUID.Short(),
-		len(snap.Data), len(inSnap.Batches), len(inSnap.LogEntries))
+		len(snap.Data), len(inSnap.Batches)+inSnap.spill.len(), len(inSnap.LogEntries))
 	defer func(start time.Time) {
 		log.Infof(ctx, "%s: with replicaID %s, applied %s snapshot in %.3fs",
 			r, replicaIDStr, snapType, timeutil.Since(start).Seconds())
 	}(timeutil.Now())
 
+	// The SSTable of an ingested snapshot is built before anything is
+	// written to the engine, so that a failure leaves the replica untouched.
+	var sst *snapshotSST
+	if canIngestSnapshots(r.store.Engine()) {
+		dir, err := snapshotTempDir(r.store.Engine())
+		if err != nil {
+			return err
+		}
+		if sst, err = writeSnapshotSST(dir, inSnap); err != nil {
+			return err
+		}
+		defer sst.close()
+	}
+
+	logEntries := make([]raftpb.Entry, len(inSnap.LogEntries))
+	for i, bytes := range inSnap.LogEntries {
+		if err := logEntries[i].Unmarshal(bytes); err != nil {
+			return err
+		}
+	}
+
 	batch := r.store.Engine().NewBatch()
 	defer batch.Close()
 
@@ -600,9 +675,60 @@ func (r *Replica) applySnapshot(
 
 	distinctBatch.Close()
 
-	// Write the snapshot into the range.
-	for _, batchRepr := range inSnap.Batches {
-		if err := batch.ApplyBatchRepr(batchRepr); err != nil {
+	// The batch clearing the range is committed on its own before the data
+	// of the snapshot is written, in several steps: an ingested SSTable would
+	// otherwise be shadowed by the keys the batch clears, and the data isn't
+	// held in memory at once. The HardState and the Raft log of the snapshot
+	// are written last, so that each step leaves a state the replica can
+	// restart from:
+	// - once the range is cleared, the replica is uninitialized. It keeps
+	//   the term and vote of its HardState, but commits nothing.
+	// - the data is then written without the range descriptor, so that the
+	//   replica remains uninitialized. The next snapshot of the span clears
+	//   the data left behind if the store crashes meanwhile.
+	// - once the range descriptor is written, the replica is initialized. If
+	//   the SSTable was ingested, the HardState and the Raft log may not have
+	//   been written yet: the replica has no Raft log past its truncated
+	//   state, and the store synthesizes its HardState from the applied state
+	//   when it restarts (see migrate7310And6991).
+	oldHS, err := loadHardState(ctx, r.store.Engine(), r.RangeID)
+	if err != nil {
+		return err
+	}
+	if err := setHardState(ctx, batch, r.RangeID, raftpb.HardState{
+		Term: oldHS.Term,
+		Vote: oldHS.Vote,
+	}); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	// The replica's data no longer matches r.mu.state, which can't be rolled
+	// back: failing to apply the rest of the snapshot is fatal, and the
+	// replica restarts from the state on disk.
+	defer func() {
+		if retErr != nil {
+			log.Fatalf(ctx, "%s: unable to apply snapshot after clearing the range: %s", r, retErr)
+		}
+	}()
+	batch = r.store.Engine().NewBatch()
+	defer batch.Close()
+
+	if sst != nil {
+		if err := sst.ingest(r.store.Engine()); err != nil {
+			return errors.Wrap(err, "unable to ingest snapshot SSTable")
+		}
+	} else {
+		// Each of the snapshot's KV batches is committed on its own, except
+		// for the range descriptor which is written with the Raft log. Besides
+		// the batches which were held in memory as they were received (see
+		// snapshotSpillThreshold), the batches are read back from the spill
+		// file one at a time.
+		descKey := keys.RangeDescriptorKey(desc.StartKey)
+		if err := inSnap.iterateBatches(func(repr []byte) error {
+			return applySnapshotBatch(r.store.Engine(), batch, descKey, repr)
+		}); err != nil {
 			return err
 		}
 	}
@@ -611,14 +737,8 @@ func (r *Replica) applySnapshot(
 	// distinct batch.
 	distinctBatch = batch.Distinct()
 
-	logEntries := make([]raftpb.Entry, len(inSnap.LogEntries))
-	for i, bytes := range inSnap.LogEntries {
-		if err := logEntries[i].Unmarshal(bytes); err != nil {
-			return err
-		}
-	}
 	// Write the snapshot's Raft log into the range.
-	_, raftLogSize, err := r.append(ctx, distinctBatch, 0, raftLogSize, logEntries)
+	lastIndex, raftLogSize, err := r.append(ctx, distinctBatch, 0, raftLogSize, logEntries)
 	if err != nil {
 		return err
 	}
@@ -668,7 +788,14 @@ func (r *Replica) applySnapshot(
 	// performance implications are not likely to be drastic. If our
 	// feelings about this ever change, we can add a LastIndex field to
 	// raftpb.SnapshotMetadata.
+	//
+	// The exception are the entries committed while a preemptive snapshot
+	// was streamed, which the replica keeps past its applied index so that it
+	// doesn't need them from the leader once it becomes a member of the range.
 	r.mu.lastIndex = s.RaftAppliedIndex
+	if isPreemptive && lastIndex > s.RaftAppliedIndex {
+		r.mu.lastIndex = lastIndex
+	}
 	r.mu.raftLogSize = raftLogSize
 	// Update the range and store stats.
 	r.store.metrics.subtractMVCCStats(r.mu.state.Stats)
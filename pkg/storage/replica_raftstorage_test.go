@@ -17,16 +17,19 @@
 package storage
 
 import (
+	"fmt"
 	"math/rand"
 	"testing"
 
 	"github.com/coreos/etcd/raft"
+	"github.com/coreos/etcd/raft/raftpb"
 	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/pkg/config"
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/randutil"
 )
@@ -98,3 +101,87 @@ func TestSkipLargeReplicaSnapshot(t *testing.T) {
 		)
 	}
 }
+
+// TestOutgoingSnapshotRateLimit verifies that the rate limit of a snapshot is
+// picked by its movement type, unless its zone config overrides it.
+func TestOutgoingSnapshotRateLimit(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer settings.TestingSetInt(snapshotMaxRate, 100)()
+	defer settings.TestingSetInt(rebalanceSnapshotMaxRate, 10)()
+	defer settings.TestingSetInt(recoverySnapshotMaxRate, 0)()
+
+	testCases := []struct {
+		movementType ReplicaMovementType
+		maxRate      int64
+		expected     int64
+	}{
+		{MovementRebalance, 0, 10},
+		{MovementRecovery, 0, 100},
+		{MovementRaft, 0, 100},
+		{MovementRebalance, 1000, 1000},
+		{MovementRecovery, 1000, 1000},
+	}
+	for i, c := range testCases {
+		snap := &OutgoingSnapshot{movementType: c.movementType, maxRate: c.maxRate}
+		if rate := snap.rateLimit(); rate != c.expected {
+			t.Errorf("%d: expected rate limit %d, got %d", i, c.expected, rate)
+		}
+	}
+}
+
+// TestSnapshotLogTail verifies that the log tail of a preemptive snapshot
+// holds the committed entries directly following the snapshot's index, within
+// the size limit.
+func TestSnapshotLogTail(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	for i := 0; i < 10; i++ {
+		pArgs := putArgs(roachpb.Key(fmt.Sprintf("a%d", i)), []byte("value"))
+		if _, pErr := tc.SendWrapped(&pArgs); pErr != nil {
+			t.Fatal(pErr)
+		}
+	}
+	ctx := context.Background()
+	commit := tc.rng.RaftStatus().Commit
+	lo := commit - 4
+
+	tail, err := tc.rng.snapshotLogTail(ctx, lo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tail) != 5 {
+		t.Fatalf("expected 5 entries in the log tail, got %d", len(tail))
+	}
+	for i, bytes := range tail {
+		var ent raftpb.Entry
+		if err := ent.Unmarshal(bytes); err != nil {
+			t.Fatal(err)
+		}
+		if ent.Index != lo+uint64(i) {
+			t.Errorf("expected entry %d to have index %d, got %d", i, lo+uint64(i), ent.Index)
+		}
+	}
+
+	// A tail which doesn't directly follow the snapshot is useless.
+	if tail, err := tc.rng.snapshotLogTail(ctx, 0); err != nil {
+		t.Fatal(err)
+	} else if len(tail) != 0 {
+		t.Errorf("expected no log tail before the first index, got %d entries", len(tail))
+	}
+	if tail, err := tc.rng.snapshotLogTail(ctx, commit+1); err != nil {
+		t.Fatal(err)
+	} else if len(tail) != 0 {
+		t.Errorf("expected no log tail past the commit index, got %d entries", len(tail))
+	}
+
+	// The tail is cut short at the size limit.
+	defer settings.TestingSetInt(snapshotLogTailMaxSize, int64(len(tail[0])+1))()
+	if tail, err := tc.rng.snapshotLogTail(ctx, lo); err != nil {
+		t.Fatal(err)
+	} else if len(tail) != 1 {
+		t.Errorf("expected the size limit to leave 1 entry in the log tail, got %d", len(tail))
+	}
+}
@@ -20,15 +20,28 @@
 package storage
 
 import (
+	"github.com/coreos/etcd/raft"
 	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
 	"github.com/pkg/errors"
 )
 
+// leaseTransferMaxRaftLag is the number of committed Raft log entries a
+// replica may be missing and still receive a lease transfer. A replica which
+// is further behind has to catch up before it can serve requests under its
+// new lease, leaving the range unavailable in the meantime.
+var leaseTransferMaxRaftLag = settings.RegisterIntSetting(
+	"kv.lease_transfer.max_raft_lag",
+	"maximum number of committed Raft log entries a replica may be missing to receive "+
+		"a lease transfer; 0 disables the check",
+	100,
+)
+
 // pendingLeaseRequest coalesces RequestLease requests and lets callers
 // join an in-progress one and wait for the result.
 // The actual execution of the RequestLease Raft request is delegated to a
@@ -215,7 +228,7 @@ func (r *Replica) requestLeaseLocked(timestamp hlc.Timestamp) <-chan *roachpb.Er
 			newNotLeaseHolderError(&transferLease, r.store.StoreID(), r.mu.state.Desc))
 		return llChan
 	}
-	if r.store.IsDrainingLeases() {
+	if r.store.IsDrainingLeases() || r.store.IsReadOnly() {
 		// We've retired from active duty.
 		llChan := make(chan *roachpb.Error, 1)
 		llChan <- roachpb.NewError(newNotLeaseHolderError(nil, r.store.StoreID(), r.mu.state.Desc))
@@ -236,6 +249,11 @@ func (r *Replica) requestLeaseLocked(timestamp hlc.Timestamp) <-chan *roachpb.Er
 // comments on the stasis period in the Lease proto). We could, in principle,
 // serve reads more than the maximum clock offset in the past.
 //
+// The transfer is refused if the target lags too far behind to serve requests
+// right away; see leaseTransferTargetBehindLocked. Once it is done, the
+// StorePool accounts for it in its estimates of the lease counts of the two
+// stores, which the allocator balances.
+//
 // The method waits for any in-progress lease extension to be done, and it also
 // blocks until the transfer is done. If a transfer is already in progress,
 // this method joins in waiting for it to complete if it's transferring to the
@@ -267,6 +285,9 @@ func (r *Replica) AdminTransferLease(target roachpb.StoreID) error {
 		if nextLeaseHolder, ok = desc.GetReplicaDescriptor(target); !ok {
 			return nil, nil, errors.Errorf("unable to find store %d in range %+v", target, desc)
 		}
+		if err := r.leaseTransferTargetBehindLocked(nextLeaseHolder); err != nil {
+			return nil, nil, err
+		}
 
 		if nextLease, ok := r.mu.pendingLeaseRequest.RequestPending(); ok &&
 			nextLease.Replica != nextLeaseHolder {
@@ -308,7 +329,13 @@ func (r *Replica) AdminTransferLease(target roachpb.StoreID) error {
 				// The target is us and we're the lease holder.
 				return nil
 			}
-			return (<-transfer).GoError()
+			if pErr := <-transfer; pErr != nil {
+				return pErr.GoError()
+			}
+			if sp := r.store.cfg.StorePool; sp != nil {
+				sp.updateLeaseTransferEstimate(r.store.StoreID(), target)
+			}
+			return nil
 		}
 		// Wait for the in-progress extension without holding the mutex.
 		if r.store.TestingKnobs().LeaseTransferBlockedOnExtensionEvent != nil {
@@ -317,3 +344,48 @@ func (r *Replica) AdminTransferLease(target roachpb.StoreID) error {
 		<-extension
 	}
 }
+
+// leaseTransferTargetBehindLocked returns an error if the target replica lags
+// too far behind to receive the lease: if it is waiting for a Raft snapshot,
+// or if it has acknowledged fewer than all but kv.lease_transfer.max_raft_lag
+// of the committed Raft log entries. The progress of the followers is only
+// known to the Raft leader, so the target is assumed to be caught up if this
+// replica isn't the leader. r.mu must be held.
+func (r *Replica) leaseTransferTargetBehindLocked(target roachpb.ReplicaDescriptor) error {
+	maxLag := leaseTransferMaxRaftLag.Get()
+	if maxLag <= 0 {
+		return nil
+	}
+	status := r.raftStatusLocked()
+	if status == nil || status.RaftState != raft.StateLeader {
+		return nil
+	}
+	progress, ok := status.Progress[uint64(target.ReplicaID)]
+	if !ok {
+		return errors.Errorf("lease transfer target %s is unknown to the Raft group", target)
+	}
+	if progress.State == raft.ProgressStateSnapshot {
+		return errors.Errorf("lease transfer target %s is waiting for a Raft snapshot", target)
+	}
+	if progress.Match+uint64(maxLag) < status.Commit {
+		return errors.Errorf("lease transfer target %s is behind: it has entries up to %d of %d",
+			target, progress.Match, status.Commit)
+	}
+	return nil
+}
+
+// filterBehindLeaseTargets returns the replicas, minus those which lag too far
+// behind to receive a lease transfer.
+func (r *Replica) filterBehindLeaseTargets(
+	replicas []roachpb.ReplicaDescriptor,
+) []roachpb.ReplicaDescriptor {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	candidates := make([]roachpb.ReplicaDescriptor, 0, len(replicas))
+	for _, repl := range replicas {
+		if r.leaseTransferTargetBehindLocked(repl) == nil {
+			candidates = append(candidates, repl)
+		}
+	}
+	return candidates
+}
@@ -19,6 +19,7 @@ package storage
 import (
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
@@ -30,6 +31,19 @@ import (
 	"golang.org/x/net/context"
 )
 
+// appliedStateKeyEnabled controls whether ranges are migrated to the range
+// applied state key, which combines the Raft applied index, the lease applied
+// index and the truncated state of the Raft log into a single record that is
+// written once per applied command. Nodes which predate the key would diverge
+// from the migrated replicas, so it must only be enabled once all nodes have
+// been upgraded.
+var appliedStateKeyEnabled = settings.RegisterBoolSetting(
+	"kv.raft.applied_state_key.enabled",
+	"migrate ranges to a single key holding their applied indices and Raft log truncated state; "+
+		"only enable once all nodes are running a version which supports it",
+	false,
+)
+
 // loadState loads a ReplicaState from disk. The exception is the Desc field,
 // which is updated transactionally, and is populated from the supplied
 // RangeDescriptor under the convention that that is the latest committed
@@ -59,19 +73,31 @@ func loadState(
 		return storagebase.ReplicaState{}, err
 	}
 
-	if s.RaftAppliedIndex, s.LeaseAppliedIndex, err = loadAppliedIndex(
-		ctx, reader, desc.RangeID,
-	); err != nil {
+	if s.Stats, err = loadMVCCStats(ctx, reader, desc.RangeID); err != nil {
 		return storagebase.ReplicaState{}, err
 	}
 
-	if s.Stats, err = loadMVCCStats(ctx, reader, desc.RangeID); err != nil {
+	as, err := loadRangeAppliedState(ctx, reader, desc.RangeID)
+	if err != nil {
+		return storagebase.ReplicaState{}, err
+	}
+	if as != nil {
+		s.UsingAppliedStateKey = true
+		s.RaftAppliedIndex = as.RaftAppliedIndex
+		s.LeaseAppliedIndex = as.LeaseAppliedIndex
+		s.TruncatedState = &as.TruncatedState
+		return s, nil
+	}
+
+	if s.RaftAppliedIndex, s.LeaseAppliedIndex, err = loadLegacyAppliedIndex(
+		ctx, reader, desc.RangeID,
+	); err != nil {
 		return storagebase.ReplicaState{}, err
 	}
 
 	// The truncated state should not be optional (i.e. the pointer is
 	// pointless), but it is and the migration is not worth it.
-	truncState, err := loadTruncatedState(ctx, reader, desc.RangeID)
+	truncState, err := loadLegacyTruncatedState(ctx, reader, desc.RangeID)
 	if err != nil {
 		return storagebase.ReplicaState{}, err
 	}
@@ -97,10 +123,21 @@ func saveState(
 	if err := setLease(ctx, eng, ms, rangeID, state.Lease); err != nil {
 		return enginepb.MVCCStats{}, err
 	}
-	if err := setAppliedIndex(
-		ctx, eng, ms, rangeID, state.RaftAppliedIndex, state.LeaseAppliedIndex,
-	); err != nil {
-		return enginepb.MVCCStats{}, err
+	if state.UsingAppliedStateKey {
+		if err := setRangeAppliedState(
+			ctx, eng, ms, rangeID, state.RaftAppliedIndex, state.LeaseAppliedIndex, *state.TruncatedState,
+		); err != nil {
+			return enginepb.MVCCStats{}, err
+		}
+	} else {
+		if err := setAppliedIndex(
+			ctx, eng, ms, rangeID, state.RaftAppliedIndex, state.LeaseAppliedIndex,
+		); err != nil {
+			return enginepb.MVCCStats{}, err
+		}
+		if err := setTruncatedState(ctx, eng, ms, rangeID, *state.TruncatedState); err != nil {
+			return enginepb.MVCCStats{}, err
+		}
 	}
 	if err := setFrozenStatus(ctx, eng, ms, rangeID, state.Frozen); err != nil {
 		return enginepb.MVCCStats{}, err
@@ -111,9 +148,6 @@ func saveState(
 	if err := setTxnSpanGCThreshold(ctx, eng, ms, rangeID, &state.TxnSpanGCThreshold); err != nil {
 		return enginepb.MVCCStats{}, err
 	}
-	if err := setTruncatedState(ctx, eng, ms, rangeID, *state.TruncatedState); err != nil {
-		return enginepb.MVCCStats{}, err
-	}
 	if err := setMVCCStats(ctx, eng, rangeID, state.Stats); err != nil {
 		return enginepb.MVCCStats{}, err
 	}
@@ -149,9 +183,86 @@ func setLease(
 		hlc.ZeroTimestamp, nil, lease)
 }
 
+// loadRangeAppliedState returns the RangeAppliedState of the range, or nil if
+// the range hasn't been migrated to the range applied state key.
+func loadRangeAppliedState(
+	ctx context.Context, reader engine.Reader, rangeID roachpb.RangeID,
+) (*storagebase.RangeAppliedState, error) {
+	var as storagebase.RangeAppliedState
+	found, err := engine.MVCCGetProto(ctx, reader, keys.RangeAppliedStateKey(rangeID),
+		hlc.ZeroTimestamp, true, nil, &as)
+	if !found || err != nil {
+		return nil, err
+	}
+	return &as, nil
+}
+
+// setRangeAppliedState writes the Raft applied index, the lease applied index
+// and the truncated state of the range to the range applied state key, which
+// takes a single write in place of the three keys it supersedes.
+func setRangeAppliedState(
+	ctx context.Context,
+	eng engine.ReadWriter,
+	ms *enginepb.MVCCStats,
+	rangeID roachpb.RangeID,
+	appliedIndex, leaseAppliedIndex uint64,
+	truncState roachpb.RaftTruncatedState,
+) error {
+	if (truncState == roachpb.RaftTruncatedState{}) {
+		return errors.New("cannot persist empty RaftTruncatedState")
+	}
+	as := storagebase.RangeAppliedState{
+		RaftAppliedIndex:  appliedIndex,
+		LeaseAppliedIndex: leaseAppliedIndex,
+		TruncatedState:    truncState,
+	}
+	return engine.MVCCPutProto(ctx, eng, ms,
+		keys.RangeAppliedStateKey(rangeID), hlc.ZeroTimestamp, nil, &as)
+}
+
+// migrateToRangeAppliedStateKey moves the range from the separate Raft
+// applied index, lease applied index and truncated state keys to the range
+// applied state key. The migration is part of the replicated state, so it
+// must be carried out at the same log position on all replicas; see
+// TruncateLogRequest.MigrateAppliedState.
+func migrateToRangeAppliedStateKey(
+	ctx context.Context,
+	eng engine.ReadWriter,
+	ms *enginepb.MVCCStats,
+	rangeID roachpb.RangeID,
+	appliedIndex, leaseAppliedIndex uint64,
+	truncState roachpb.RaftTruncatedState,
+) error {
+	for _, key := range []roachpb.Key{
+		keys.RaftAppliedIndexKey(rangeID),
+		keys.LeaseAppliedIndexKey(rangeID),
+		keys.RaftTruncatedStateKey(rangeID),
+	} {
+		if err := engine.MVCCDelete(ctx, eng, ms, key, hlc.ZeroTimestamp, nil); err != nil {
+			return err
+		}
+	}
+	return setRangeAppliedState(ctx, eng, ms, rangeID, appliedIndex, leaseAppliedIndex, truncState)
+}
+
 // loadAppliedIndex returns the Raft applied index and the lease applied index.
 func loadAppliedIndex(
 	ctx context.Context, reader engine.Reader, rangeID roachpb.RangeID,
+) (uint64, uint64, error) {
+	as, err := loadRangeAppliedState(ctx, reader, rangeID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if as != nil {
+		return as.RaftAppliedIndex, as.LeaseAppliedIndex, nil
+	}
+	return loadLegacyAppliedIndex(ctx, reader, rangeID)
+}
+
+// loadLegacyAppliedIndex returns the Raft applied index and the lease applied
+// index of a range which hasn't been migrated to the range applied state key.
+func loadLegacyAppliedIndex(
+	ctx context.Context, reader engine.Reader, rangeID roachpb.RangeID,
 ) (uint64, uint64, error) {
 	var appliedIndex uint64
 	v, _, err := engine.MVCCGet(ctx, reader, keys.RaftAppliedIndexKey(rangeID),
@@ -210,8 +321,24 @@ func setAppliedIndex(
 		nil /* txn */)
 }
 
+// loadTruncatedState returns the truncated state of the range's Raft log.
 func loadTruncatedState(
 	ctx context.Context, reader engine.Reader, rangeID roachpb.RangeID,
+) (roachpb.RaftTruncatedState, error) {
+	as, err := loadRangeAppliedState(ctx, reader, rangeID)
+	if err != nil {
+		return roachpb.RaftTruncatedState{}, err
+	}
+	if as != nil {
+		return as.TruncatedState, nil
+	}
+	return loadLegacyTruncatedState(ctx, reader, rangeID)
+}
+
+// loadLegacyTruncatedState returns the truncated state of the Raft log of a
+// range which hasn't been migrated to the range applied state key.
+func loadLegacyTruncatedState(
+	ctx context.Context, reader engine.Reader, rangeID roachpb.RangeID,
 ) (roachpb.RaftTruncatedState, error) {
 	var truncState roachpb.RaftTruncatedState
 	if _, err := engine.MVCCGetProto(ctx, reader,
@@ -408,6 +535,33 @@ func setReplicaDestroyedError(
 		keys.RangeReplicaDestroyedErrorKey(rangeID), hlc.ZeroTimestamp, nil /* txn */, err)
 }
 
+// loadPoisonedEntry returns the poisoned raft entry recorded for the
+// replica, or nil if there is none.
+func loadPoisonedEntry(
+	ctx context.Context, reader engine.Reader, rangeID roachpb.RangeID,
+) (*PoisonedEntry, error) {
+	var entry PoisonedEntry
+	found, err := engine.MVCCGetProto(ctx, reader,
+		keys.RangePoisonedEntryKey(rangeID),
+		hlc.ZeroTimestamp, true /* consistent */, nil, &entry)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, nil
+	}
+	return &entry, nil
+}
+
+// setPoisonedEntry records the raft entry the replica is halted on, or which
+// was discarded.
+func setPoisonedEntry(
+	ctx context.Context, eng engine.ReadWriter, rangeID roachpb.RangeID, entry *PoisonedEntry,
+) error {
+	return engine.MVCCPutProto(ctx, eng, nil,
+		keys.RangePoisonedEntryKey(rangeID), hlc.ZeroTimestamp, nil /* txn */, entry)
+}
+
 func loadHardState(
 	ctx context.Context, reader engine.Reader, rangeID roachpb.RangeID,
 ) (raftpb.HardState, error) {
@@ -471,6 +625,8 @@ func synthesizeHardState(
 // applied.
 // The supplied MVCCStats are used for the Stats field after adjusting for
 // persisting the state itself, and the updated stats are returned.
+// usingAppliedStateKey specifies whether the state is written to the range
+// applied state key.
 func writeInitialState(
 	ctx context.Context,
 	eng engine.ReadWriter,
@@ -478,6 +634,7 @@ func writeInitialState(
 	desc roachpb.RangeDescriptor,
 	oldHS raftpb.HardState,
 	lease *roachpb.Lease,
+	usingAppliedStateKey bool,
 ) (enginepb.MVCCStats, error) {
 	var s storagebase.ReplicaState
 
@@ -492,6 +649,7 @@ func writeInitialState(
 	s.Frozen = storagebase.ReplicaState_UNFROZEN
 	s.Stats = ms
 	s.Lease = lease
+	s.UsingAppliedStateKey = usingAppliedStateKey
 
 	if existingLease, err := loadLease(ctx, eng, desc.RangeID); err != nil {
 		return enginepb.MVCCStats{}, errors.Wrap(err, "error reading lease")
@@ -45,6 +45,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
@@ -59,6 +60,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
 
@@ -210,6 +212,7 @@ func (tc *testContext) StartWithStoreConfig(t testing.TB, cfg StoreConfig) {
 				*testDesc,
 				raftpb.HardState{},
 				&roachpb.Lease{},
+				false, /* usingAppliedStateKey */
 			); err != nil {
 				t.Fatal(err)
 			}
@@ -4248,6 +4251,84 @@ func TestReplicaResolveIntentRange(t *testing.T) {
 	}
 }
 
+// TestReplicaClearRange verifies that ClearRange removes all versions of
+// the keys in its span, keeps the range stats accurate and refuses to clear
+// intents.
+func TestReplicaClearRange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	for _, kv := range []struct{ key, value string }{
+		{"a", "value1"}, {"a", "value2"}, {"b", "value1"}, {"c", "value1"},
+	} {
+		pArgs := putArgs(roachpb.Key(kv.key), []byte(kv.value))
+		if _, pErr := tc.SendWrapped(&pArgs); pErr != nil {
+			t.Fatal(pErr)
+		}
+	}
+	txn := newTransaction("test", roachpb.Key("d"), 1, enginepb.SERIALIZABLE, tc.clock)
+	pArgs := putArgs(roachpb.Key("d"), []byte("value1"))
+	if _, pErr := tc.SendWrappedWith(roachpb.Header{Txn: txn}, &pArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+
+	// ClearRange can't be part of a transaction.
+	cArgs := roachpb.NewClearRange(roachpb.Key("a"), roachpb.Key("c"))
+	if _, pErr := tc.SendWrappedWith(roachpb.Header{Txn: txn}, cArgs); !testutils.IsPError(
+		pErr, "within a transaction",
+	) {
+		t.Fatalf("unexpected error: %v", pErr)
+	}
+
+	// The intent on "d" prevents clearing a span containing it.
+	cArgs = roachpb.NewClearRange(roachpb.Key("a"), roachpb.Key("e"))
+	if _, pErr := tc.SendWrapped(cArgs); pErr == nil {
+		t.Fatal("expected an error clearing an intent")
+	} else if _, ok := pErr.GetDetail().(*roachpb.WriteIntentError); !ok {
+		t.Fatalf("expected a WriteIntentError, got %v", pErr)
+	}
+
+	cArgs = roachpb.NewClearRange(roachpb.Key("a"), roachpb.Key("c"))
+	if _, pErr := tc.SendWrapped(cArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+
+	// Only "c" remains, and no trace of the cleared keys is left behind.
+	kvs, err := engine.Scan(tc.engine,
+		engine.MakeMVCCMetadataKey(roachpb.Key("a")), engine.MakeMVCCMetadataKey(roachpb.Key("c")), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 0 {
+		t.Fatalf("expected the span to be cleared, found %d entries", len(kvs))
+	}
+	sArgs := scanArgs(roachpb.Key("a"), roachpb.Key("c\x00"))
+	reply, pErr := tc.SendWrapped(&sArgs)
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+	if rows := reply.(*roachpb.ScanResponse).Rows; len(rows) != 1 || !rows[0].Key.Equal(roachpb.Key("c")) {
+		t.Fatalf("expected only c to remain; got %v", rows)
+	}
+
+	// The stats must match a recomputation.
+	var ms enginepb.MVCCStats
+	if err := engine.MVCCGetRangeStats(context.Background(), tc.engine, tc.rng.RangeID, &ms); err != nil {
+		t.Fatal(err)
+	}
+	expMS, err := ComputeStatsForRange(tc.rng.Desc(), tc.engine, ms.LastUpdateNanos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms.LiveBytes != expMS.LiveBytes || ms.KeyBytes != expMS.KeyBytes ||
+		ms.ValBytes != expMS.ValBytes || ms.KeyCount != expMS.KeyCount ||
+		ms.ValCount != expMS.ValCount || ms.IntentCount != expMS.IntentCount {
+		t.Fatalf("expected and actual stats differ:\n%s", pretty.Diff(expMS, ms))
+	}
+}
+
 func verifyRangeStats(
 	eng engine.Engine, rangeID roachpb.RangeID, expMS enginepb.MVCCStats, t *testing.T,
 ) {
@@ -4538,6 +4619,86 @@ func TestTruncateLog(t *testing.T) {
 	}
 }
 
+// TestTruncateLogMigratesAppliedState verifies that a TruncateLogRequest
+// which asks for it migrates the range to the range applied state key, and
+// that the range keeps its applied indices and truncated state there.
+func TestTruncateLogMigratesAppliedState(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+	tc.rng.store.SetRaftLogQueueActive(false)
+
+	ctx := context.Background()
+	rangeID := tc.rng.RangeID
+	legacyKeys := []roachpb.Key{
+		keys.RaftAppliedIndexKey(rangeID),
+		keys.LeaseAppliedIndexKey(rangeID),
+		keys.RaftTruncatedStateKey(rangeID),
+	}
+	writeLog := func() uint64 {
+		for i := 0; i < 5; i++ {
+			args := incrementArgs([]byte("a"), int64(i))
+			if _, pErr := tc.SendWrapped(&args); pErr != nil {
+				t.Fatal(pErr)
+			}
+		}
+		idx, err := tc.rng.GetLastIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return idx
+	}
+
+	if as, err := loadRangeAppliedState(ctx, tc.engine, rangeID); err != nil {
+		t.Fatal(err)
+	} else if as != nil {
+		t.Fatalf("expected no range applied state, found %+v", as)
+	}
+
+	truncateArgs := truncateLogArgs(writeLog(), rangeID)
+	truncateArgs.MigrateAppliedState = true
+	if _, pErr := tc.SendWrapped(&truncateArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+
+	for _, key := range legacyKeys {
+		if v, _, err := engine.MVCCGet(ctx, tc.engine, key, hlc.ZeroTimestamp, true, nil); err != nil {
+			t.Fatal(err)
+		} else if v != nil {
+			t.Errorf("expected %s to be removed by the migration", key)
+		}
+	}
+
+	// Truncations and applied commands now go to the range applied state key.
+	truncateArgs = truncateLogArgs(writeLog(), rangeID)
+	if _, pErr := tc.SendWrapped(&truncateArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+	tc.rng.mu.Lock()
+	state := tc.rng.mu.state
+	tc.rng.mu.Unlock()
+	if !state.UsingAppliedStateKey {
+		t.Fatal("expected the replica to use the range applied state key")
+	}
+	as, err := loadRangeAppliedState(ctx, tc.engine, rangeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expAS := storagebase.RangeAppliedState{
+		RaftAppliedIndex:  state.RaftAppliedIndex,
+		LeaseAppliedIndex: state.LeaseAppliedIndex,
+		TruncatedState:    *state.TruncatedState,
+	}
+	if as == nil || *as != expAS {
+		t.Fatalf("expected range applied state %+v, got %+v", expAS, as)
+	}
+	if expIndex := truncateArgs.Index - 1; as.TruncatedState.Index != expIndex {
+		t.Errorf("expected truncated index %d, got %d", expIndex, as.TruncatedState.Index)
+	}
+	tc.rng.assertState(tc.engine)
+}
+
 // TestConditionFailedError tests that a ConditionFailedError correctly
 // bubbles up from MVCC to Range.
 func TestConditionFailedError(t *testing.T) {
@@ -4828,6 +4989,30 @@ func testRangeDanglingMetaIntent(t *testing.T, isReverse bool) {
 	if !origSeen || !newSeen {
 		t.Errorf("expected to see both original and new descriptor; saw original = %t, saw new = %t", origSeen, newSeen)
 	}
+
+	// A READ_UNCOMMITTED lookup returns the descriptor from the intent first.
+	clonedRLArgs = *rlArgs
+	reply, pErr = tc.SendWrappedWith(roachpb.Header{
+		ReadConsistency: roachpb.READ_UNCOMMITTED,
+	}, &clonedRLArgs)
+	if pErr != nil {
+		t.Fatal(pErr)
+	}
+	rlReply = reply.(*roachpb.RangeLookupResponse)
+	if len(rlReply.Ranges) != 2 {
+		t.Fatalf("expected original and new descriptor; got %+v", rlReply.Ranges)
+	}
+	if !reflect.DeepEqual(rlReply.Ranges[0], newDesc) || !reflect.DeepEqual(rlReply.Ranges[1], origDesc) {
+		t.Errorf("expected new descriptor %s before original %s; got %+v", &newDesc, &origDesc, rlReply.Ranges)
+	}
+
+	// READ_UNCOMMITTED is only available to range lookups.
+	gArgs := getArgs(key)
+	if _, pErr := tc.SendWrappedWith(roachpb.Header{
+		ReadConsistency: roachpb.READ_UNCOMMITTED,
+	}, &gArgs); !testutils.IsPError(pErr, "only available to range lookups") {
+		t.Errorf("unexpected error for READ_UNCOMMITTED get: %v", pErr)
+	}
 }
 
 // TestReplicaLookupUseReverseScan verifies the correctness of the results which are retrieved
@@ -5592,6 +5777,351 @@ func TestReplicaCancelRaft(t *testing.T) {
 	}
 }
 
+// TestReplicaAbandonedProposal verifies that a proposal whose client gave up
+// waiting for it stays pending, marked as abandoned, and is dropped rather
+// than proposed again.
+func TestReplicaAbandonedProposal(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	// Acquire the lease before commands start to disappear.
+	key := roachpb.Key("acdfg")
+	pArgs := putArgs(key, []byte("value"))
+	if _, pErr := tc.SendWrapped(&pArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+
+	// Swallow the proposals for the key, so that they stay pending.
+	tc.rng.mu.Lock()
+	tc.rng.mu.submitProposalFn = func(p *ProposalData) error {
+		if ba := p.RaftCommand.Cmd; len(ba.Requests) > 0 && ba.Requests[0].GetInner().Header().Key.Equal(key) {
+			return nil
+		}
+		return defaultSubmitProposalLocked(tc.rng, p)
+	}
+	tc.rng.mu.Unlock()
+
+	abandoned := tc.store.metrics.RaftCommandsAbandoned.Count()
+	dropped := tc.store.metrics.RaftCommandsAbandonedDropped.Count()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan *roachpb.Error, 1)
+	go func() {
+		var ba roachpb.BatchRequest
+		ba.Add(&pArgs)
+		if err := ba.SetActiveTimestamp(tc.clock.Now); err != nil {
+			errCh <- roachpb.NewError(err)
+			return
+		}
+		_, pErr := tc.rng.addWriteCmd(ctx, ba)
+		errCh <- pErr
+	}()
+
+	pending := func() []*ProposalData {
+		tc.rng.mu.Lock()
+		defer tc.rng.mu.Unlock()
+		var ps []*ProposalData
+		for _, p := range tc.rng.mu.proposals {
+			if p.RaftCommand.Cmd.Requests[0].GetInner().Header().Key.Equal(key) {
+				ps = append(ps, p)
+			}
+		}
+		return ps
+	}
+	util.SucceedsSoon(t, func() error {
+		if n := len(pending()); n != 1 {
+			return errors.Errorf("expected 1 pending proposal, got %d", n)
+		}
+		return nil
+	})
+
+	cancel()
+	if pErr := <-errCh; !testutils.IsPError(pErr, context.Canceled.Error()) {
+		t.Fatalf("unexpected error: %v", pErr)
+	}
+	ps := pending()
+	tc.rng.mu.Lock()
+	isAbandoned := len(ps) == 1 && ps[0].abandoned
+	tc.rng.mu.Unlock()
+	if !isAbandoned {
+		t.Fatal("expected the proposal to remain pending as abandoned")
+	}
+	if n := tc.store.metrics.RaftCommandsAbandoned.Count() - abandoned; n != 1 {
+		t.Errorf("expected 1 abandoned command, got %d", n)
+	}
+
+	// The abandoned proposal is dropped instead of being reproposed.
+	tc.rng.mu.Lock()
+	err := tc.rng.refreshPendingCmdsLocked(reasonTicks, 0)
+	tc.rng.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(pending()); n != 0 {
+		t.Fatalf("expected the abandoned proposal to be dropped, %d remain", n)
+	}
+	if n := tc.store.metrics.RaftCommandsAbandonedDropped.Count() - dropped; n != 1 {
+		t.Errorf("expected 1 dropped command, got %d", n)
+	}
+}
+
+// TestReplicaCommandTooLarge verifies that commands exceeding the maximum
+// command size aren't proposed, and that smaller ones still are.
+func TestReplicaCommandTooLarge(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	const maxSize = 8 << 10
+	defer settings.TestingSetInt(storagebase.MaxCommandSize, maxSize)()
+
+	pArgs := putArgs(roachpb.Key("a"), make([]byte, maxSize))
+	_, pErr := tc.SendWrapped(&pArgs)
+	if detail, ok := pErr.GetDetail().(*roachpb.CommandTooLargeError); !ok {
+		t.Fatalf("expected CommandTooLargeError, got %v", pErr)
+	} else if detail.MaxSize != maxSize || detail.Size_ <= maxSize {
+		t.Fatalf("unexpected error detail %+v", detail)
+	}
+	tc.rng.mu.Lock()
+	numProposals := len(tc.rng.mu.proposals)
+	tc.rng.mu.Unlock()
+	if numProposals != 0 {
+		t.Fatalf("expected no pending proposals, got %d", numProposals)
+	}
+
+	pArgs = putArgs(roachpb.Key("a"), make([]byte, maxSize/2))
+	if _, pErr := tc.SendWrapped(&pArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+}
+
+// TestReplicaValidateCommand verifies that malformed batches are rejected
+// before being proposed to Raft.
+func TestReplicaValidateCommand(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+	tc.clock.SetMaxOffset(maxClockOffset)
+
+	put := putArgs(roachpb.Key("a"), []byte("value"))
+	badPut := putArgs(roachpb.Key("a"), []byte("value"))
+	badPut.EndKey = roachpb.Key("b")
+	badScan := scanArgs(roachpb.Key("b"), roachpb.Key("a"))
+
+	testCases := []struct {
+		ts     hlc.Timestamp
+		req    roachpb.Request
+		expErr bool
+	}{
+		{tc.clock.Now(), &put, false},
+		{hlc.ZeroTimestamp, &put, true},
+		{tc.clock.Now().Add(int64(time.Hour), 0), &put, true},
+		{tc.clock.Now(), &badPut, true},
+		{tc.clock.Now(), &badScan, true},
+	}
+	for i, c := range testCases {
+		var ba roachpb.BatchRequest
+		ba.Timestamp = c.ts
+		ba.Add(c.req)
+		tc.rng.mu.Lock()
+		err := tc.rng.validateCommandLocked(ba)
+		tc.rng.mu.Unlock()
+		if !c.expErr {
+			if err != nil {
+				t.Errorf("%d: unexpected error %v", i, err)
+			}
+			continue
+		}
+		if _, ok := err.(*roachpb.MalformedCommandError); !ok {
+			t.Errorf("%d: expected MalformedCommandError, got %v", i, err)
+		}
+	}
+}
+
+// TestReplicaCommandContainment verifies that, with command containment
+// enabled, a raft entry which corrupts the replica when applied halts the
+// range until it is discarded, and that nothing is committed for it.
+func TestReplicaCommandContainment(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer settings.TestingSetBool(commandContainmentEnabled, true)()
+
+	poisonKey := roachpb.Key("poison")
+	var poison int32 = 1
+	tc := testContext{}
+	tsc := TestStoreConfig()
+	tsc.TestingKnobs.TestingCommandFilter =
+		func(filterArgs storagebase.FilterArgs) *roachpb.Error {
+			if filterArgs.CmdID != "" && filterArgs.Req.Header().Key.Equal(poisonKey) &&
+				atomic.LoadInt32(&poison) == 1 {
+				return roachpb.NewError(NewReplicaCorruptionError(errors.New("poisoned command")))
+			}
+			return nil
+		}
+	tc.StartWithStoreConfig(t, tsc)
+	defer tc.Stop()
+
+	errCh := make(chan *roachpb.Error, 1)
+	go func() {
+		pArgs := putArgs(poisonKey, []byte("value"))
+		_, pErr := tc.SendWrapped(&pArgs)
+		errCh <- pErr
+	}()
+
+	var entry *PoisonedEntry
+	util.SucceedsSoon(t, func() error {
+		if entry = tc.rng.PoisonedEntry(); entry == nil {
+			return errors.New("range not halted yet")
+		}
+		return nil
+	})
+	if !strings.Contains(entry.Error, "poisoned command") {
+		t.Fatalf("unexpected poisoned entry %+v", entry)
+	}
+	if n := tc.store.metrics.RaftCommandsPoisoned.Count(); n != 1 {
+		t.Fatalf("expected 1 poisoned command, got %d", n)
+	}
+	tc.rng.mu.Lock()
+	applied := tc.rng.mu.state.RaftAppliedIndex
+	tc.rng.mu.Unlock()
+	if applied != entry.Index-1 {
+		t.Fatalf("expected applied index %d, got %d", entry.Index-1, applied)
+	}
+	ctx := context.Background()
+	if persisted, err := loadPoisonedEntry(ctx, tc.engine, tc.rng.RangeID); err != nil {
+		t.Fatal(err)
+	} else if persisted == nil || persisted.Index != entry.Index || persisted.Discarded {
+		t.Fatalf("expected poisoned entry %d to be persisted, found %+v", entry.Index, persisted)
+	}
+
+	// The range refuses writes while it is halted.
+	pArgs := putArgs(roachpb.Key("a"), []byte("value"))
+	if _, pErr := tc.SendWrapped(&pArgs); !testutils.IsPError(pErr, "needs repair") {
+		t.Fatalf("expected the range to be halted, got %v", pErr)
+	}
+
+	atomic.StoreInt32(&poison, 0)
+	if _, err := tc.rng.DiscardPoisonedEntry(ctx, entry.Index+1, "test"); !testutils.IsError(err, "is halted on raft entry") {
+		t.Fatalf("expected discarding the wrong entry to fail, got %v", err)
+	}
+	if _, err := tc.rng.DiscardPoisonedEntry(ctx, entry.Index, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if pErr := <-errCh; !testutils.IsPError(pErr, "was discarded") {
+		t.Fatalf("expected the poisoned command to be discarded, got %v", pErr)
+	}
+	if persisted, err := loadPoisonedEntry(ctx, tc.engine, tc.rng.RangeID); err != nil {
+		t.Fatal(err)
+	} else if persisted == nil || !persisted.Discarded {
+		t.Fatalf("expected the discard to be persisted, found %+v", persisted)
+	}
+	if _, pErr := tc.SendWrapped(&pArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+}
+
+// TestReplicaDiscardEntryAhead verifies that a replica which hasn't applied a
+// discarded raft entry yet applies it as a no-op once it gets to it, and that
+// it ignores being asked to discard the entry again afterwards.
+func TestReplicaDiscardEntryAhead(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	// Write once so that the next raft entry carries the write below rather
+	// than a lease request.
+	pArgs := putArgs(roachpb.Key("a"), []byte("value"))
+	if _, pErr := tc.SendWrapped(&pArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+
+	ctx := context.Background()
+	tc.rng.mu.Lock()
+	index := tc.rng.mu.state.RaftAppliedIndex + 1
+	tc.rng.mu.Unlock()
+	if _, err := tc.rng.discardPoisonedEntryLocal(ctx, index, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, pErr := tc.SendWrapped(&pArgs); !testutils.IsPError(pErr, "was discarded") {
+		t.Fatalf("expected the command to be discarded, got %v", pErr)
+	}
+
+	if _, err := tc.rng.discardPoisonedEntryLocal(ctx, index, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tc.rng.discardPoisonedEntryLocal(ctx, index-1, "test"); !testutils.IsError(err, "already applied") {
+		t.Fatalf("expected discarding an applied entry to fail, got %v", err)
+	}
+	if _, pErr := tc.SendWrapped(&pArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+}
+
+// TestReplicaCommandContainmentPanic verifies that, with command containment
+// enabled, a raft entry which panics when applied halts the range instead of
+// crashing the node, and that nothing is committed for it.
+func TestReplicaCommandContainmentPanic(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer settings.TestingSetBool(commandContainmentEnabled, true)()
+
+	poisonKey := roachpb.Key("poison")
+	var poison int32 = 1
+	tc := testContext{}
+	tsc := TestStoreConfig()
+	tsc.TestingKnobs.TestingCommandFilter =
+		func(filterArgs storagebase.FilterArgs) *roachpb.Error {
+			if filterArgs.CmdID != "" && filterArgs.Req.Header().Key.Equal(poisonKey) &&
+				atomic.LoadInt32(&poison) == 1 {
+				panic("poisoned command")
+			}
+			return nil
+		}
+	tc.StartWithStoreConfig(t, tsc)
+	defer tc.Stop()
+
+	errCh := make(chan *roachpb.Error, 1)
+	go func() {
+		pArgs := putArgs(poisonKey, []byte("value"))
+		_, pErr := tc.SendWrapped(&pArgs)
+		errCh <- pErr
+	}()
+
+	var entry *PoisonedEntry
+	util.SucceedsSoon(t, func() error {
+		if entry = tc.rng.PoisonedEntry(); entry == nil {
+			return errors.New("range not halted yet")
+		}
+		return nil
+	})
+	if !strings.Contains(entry.Error, "panic while applying command: poisoned command") {
+		t.Fatalf("unexpected poisoned entry %+v", entry)
+	}
+	tc.rng.mu.Lock()
+	applied := tc.rng.mu.state.RaftAppliedIndex
+	tc.rng.mu.Unlock()
+	if applied != entry.Index-1 {
+		t.Fatalf("expected applied index %d, got %d", entry.Index-1, applied)
+	}
+	if value, _, err := engine.MVCCGet(context.Background(), tc.engine, poisonKey,
+		hlc.MaxTimestamp, true, nil); err != nil {
+		t.Fatal(err)
+	} else if value != nil {
+		t.Fatalf("expected the poisoned write not to be committed, found %s", value)
+	}
+
+	atomic.StoreInt32(&poison, 0)
+	if _, err := tc.rng.DiscardPoisonedEntry(context.Background(), entry.Index, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if pErr := <-errCh; !testutils.IsPError(pErr, "was discarded") {
+		t.Fatalf("expected the poisoned command to be discarded, got %v", pErr)
+	}
+}
+
 // TestComputeChecksumVersioning checks that the ComputeChecksum post-commit
 // trigger is called if and only if the checksum version is right.
 func TestComputeChecksumVersioning(t *testing.T) {
@@ -5753,6 +6283,50 @@ func TestDiffRange(t *testing.T) {
 	}
 }
 
+// TestConsistencyOutliers verifies that the replicas which disagree with the
+// majority checksum are reported as outliers, and that no outlier is
+// reported without a majority.
+func TestConsistencyOutliers(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	r1 := roachpb.ReplicaDescriptor{NodeID: 1, StoreID: 1, ReplicaID: 1}
+	r2 := roachpb.ReplicaDescriptor{NodeID: 2, StoreID: 2, ReplicaID: 2}
+	r3 := roachpb.ReplicaDescriptor{NodeID: 3, StoreID: 3, ReplicaID: 3}
+	good, bad, worse := []byte("good"), []byte("bad"), []byte("worse")
+
+	testCases := []struct {
+		results     []replicaChecksumResult
+		numReplicas int
+		majority    []byte
+		outliers    []roachpb.ReplicaDescriptor
+	}{
+		// A single follower is inconsistent.
+		{[]replicaChecksumResult{{r1, good}, {r2, bad}, {r3, good}}, 3,
+			good, []roachpb.ReplicaDescriptor{r2}},
+		// The leaseholder is inconsistent.
+		{[]replicaChecksumResult{{r1, bad}, {r2, good}, {r3, good}}, 3,
+			good, []roachpb.ReplicaDescriptor{r1}},
+		// An unreachable replica is neither counted nor reported.
+		{[]replicaChecksumResult{{r1, good}, {r2, bad}, {r3, nil}}, 3, nil, nil},
+		{[]replicaChecksumResult{{r1, good}, {r2, good}, {r3, nil}}, 3, good, nil},
+		// No checksum is shared by a majority.
+		{[]replicaChecksumResult{{r1, good}, {r2, bad}, {r3, worse}}, 3, nil, nil},
+		{[]replicaChecksumResult{{r1, good}, {r2, bad}}, 2, nil, nil},
+	}
+	for i, c := range testCases {
+		majority, outliers, ok := consistencyOutliers(c.results, c.numReplicas)
+		if ok != (c.majority != nil) {
+			t.Errorf("%d: expected majority %t, got %t", i, c.majority != nil, ok)
+		}
+		if !bytes.Equal(majority, c.majority) {
+			t.Errorf("%d: expected majority checksum %q, got %q", i, c.majority, majority)
+		}
+		if !reflect.DeepEqual(outliers, c.outliers) {
+			t.Errorf("%d: expected outliers %v, got %v", i, c.outliers, outliers)
+		}
+	}
+}
+
 func TestSyncSnapshot(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -6438,3 +7012,159 @@ func TestDeprecatedRequests(t *testing.T) {
 		t.Fatalf("expected %T but got %T", &roachpb.DeprecatedVerifyChecksumResponse{}, reply)
 	}
 }
+
+// TestReplicaLoadColdRequests verifies that batches marked as COLD are
+// tracked apart from the replica's regular load, and don't raise the
+// priority of the range in the split and replicate queues.
+func TestReplicaLoadColdRequests(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	manual := hlc.NewManualClock(timeutil.Now().UnixNano())
+	defer metric.TestingSetNow(func() time.Time {
+		return time.Unix(0, manual.UnixNano())
+	})()
+
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	sendPuts := func(temperature roachpb.AccessTemperature) {
+		for i := 0; i < 10; i++ {
+			key := roachpb.Key(fmt.Sprintf("%s-%d", temperature, i))
+			pArgs := putArgs(key, []byte("value"))
+			if _, pErr := tc.SendWrappedWith(roachpb.Header{
+				Temperature: temperature,
+			}, &pArgs); pErr != nil {
+				t.Fatal(pErr)
+			}
+		}
+		// Let the moving averages warm up.
+		manual.Increment(time.Minute.Nanoseconds())
+	}
+
+	sendPuts(roachpb.COLD)
+	if load := tc.rng.Load(); load.WritesPerSecond != 0 || load.ColdQueriesPerSecond == 0 ||
+		load.priority() != 0 {
+		t.Fatalf("expected only cold queries after cold writes, got %+v", load)
+	}
+
+	sendPuts(roachpb.NORMAL)
+	if load := tc.rng.Load(); load.WritesPerSecond == 0 || load.QueriesPerSecond == 0 ||
+		load.priority() <= 0 {
+		t.Fatalf("expected writes to count towards the load, got %+v", load)
+	}
+}
+
+func TestCanBackpressureBatch(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	key := roachpb.Key("a")
+	localKey := keys.RangeDescriptorKey(roachpb.RKey(key))
+	put := putArgs(key, []byte("value"))
+	localPut := putArgs(localKey, []byte("value"))
+	cput := cPutArgs(key, []byte("value"), nil)
+	get := getArgs(key)
+	resolve := roachpb.ResolveIntentRequest{Span: roachpb.Span{Key: key}}
+
+	testCases := []struct {
+		reqs     []roachpb.Request
+		expected bool
+	}{
+		{[]roachpb.Request{&put}, true},
+		{[]roachpb.Request{&cput}, true},
+		{[]roachpb.Request{&get, &put}, true},
+		{[]roachpb.Request{&localPut}, false},
+		{[]roachpb.Request{&resolve}, false},
+		{[]roachpb.Request{&get}, false},
+	}
+	for i, c := range testCases {
+		var ba roachpb.BatchRequest
+		ba.Add(c.reqs...)
+		if a := canBackpressureBatch(ba); a != c.expected {
+			t.Errorf("%d: expected %t, got %t", i, c.expected, a)
+		}
+	}
+}
+
+// TestReplicaBackpressureRangeSize verifies that writes to a range much
+// larger than its maximum size are delayed, for at most the maximum wait.
+func TestReplicaBackpressureRangeSize(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer settings.TestingSetDuration(rangeSizeBackpressureMaxWait, time.Millisecond)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+	// Writes are only delayed while the split queue is enabled. The test
+	// store can't split the range, so they are delayed for the maximum wait.
+	tc.store.splitQueue.SetDisabled(false)
+
+	put := func(key string) {
+		pArgs := putArgs(roachpb.Key(key), []byte("value"))
+		if _, pErr := tc.SendWrapped(&pArgs); pErr != nil {
+			t.Fatal(pErr)
+		}
+	}
+
+	put("a")
+	if a := tc.store.metrics.RangeSizeBackpressureThrottled.Count(); a != 0 {
+		t.Fatalf("expected no delayed writes, got %d", a)
+	}
+
+	// Shrink the maximum size of the range far below its current size.
+	tc.rng.SetMaxBytes(1)
+	put("b")
+	if a := tc.store.metrics.RangeSizeBackpressureThrottled.Count(); a != 1 {
+		t.Fatalf("expected 1 delayed write, got %d", a)
+	}
+
+	// Reads are never delayed.
+	gArgs := getArgs(roachpb.Key("a"))
+	if _, pErr := tc.SendWrapped(&gArgs); pErr != nil {
+		t.Fatal(pErr)
+	}
+	defer settings.TestingSetFloat(rangeSizeBackpressureMultiplier, 0)()
+	put("c")
+	if a := tc.store.metrics.RangeSizeBackpressureThrottled.Count(); a != 1 {
+		t.Fatalf("expected the backpressure to be disabled, got %d delayed writes", a)
+	}
+}
+
+// TestLeaseTransferTargetBehind verifies that a lease transfer is refused to
+// a replica which the Raft leader doesn't know to be caught up.
+func TestLeaseTransferTargetBehind(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+
+	// Make sure the Raft group is up and the replica leads it.
+	put := putArgs(roachpb.Key("a"), []byte("value"))
+	if _, pErr := tc.SendWrapped(&put); pErr != nil {
+		t.Fatal(pErr)
+	}
+	local, err := tc.rng.GetReplicaDescriptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := roachpb.ReplicaDescriptor{NodeID: 2, StoreID: 2, ReplicaID: 2}
+
+	check := func(target roachpb.ReplicaDescriptor) error {
+		tc.rng.mu.Lock()
+		defer tc.rng.mu.Unlock()
+		return tc.rng.leaseTransferTargetBehindLocked(target)
+	}
+	if err := check(local); err != nil {
+		t.Errorf("expected the leader to be caught up, got %v", err)
+	}
+	if err := check(unknown); !testutils.IsError(err, "unknown to the Raft group") {
+		t.Errorf("expected an unknown replica to be behind, got %v", err)
+	}
+	if candidates := tc.rng.filterBehindLeaseTargets(
+		[]roachpb.ReplicaDescriptor{local, unknown},
+	); !reflect.DeepEqual(candidates, []roachpb.ReplicaDescriptor{local}) {
+		t.Errorf("expected only the caught up replica as candidate, got %v", candidates)
+	}
+
+	defer settings.TestingSetInt(leaseTransferMaxRaftLag, 0)()
+	if err := check(unknown); err != nil {
+		t.Errorf("expected no check with kv.lease_transfer.max_raft_lag = 0, got %v", err)
+	}
+}
@@ -25,8 +25,12 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/config"
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
 
 const (
@@ -38,6 +42,15 @@ const (
 	replicateQueueTimerDuration = 0 // zero duration to process replication greedily
 )
 
+// leaseSheddingInterval is the minimum time between two leases shed by an
+// overloaded store, so that the store hands off its leases gradually rather
+// than all at once.
+var leaseSheddingInterval = settings.RegisterDurationSetting(
+	"kv.allocator.lease_shedding_interval",
+	"minimum time between two leases shed by an overloaded store",
+	time.Second,
+)
+
 // replicateQueue manages a queue of replicas which may need to add an
 // additional replica to their range.
 type replicateQueue struct {
@@ -45,6 +58,12 @@ type replicateQueue struct {
 	allocator  Allocator
 	clock      *hlc.Clock
 	updateChan chan struct{}
+
+	// lastLeaseShed records when the queue last shed a lease.
+	lastLeaseShed struct {
+		syncutil.Mutex
+		at time.Time
+	}
 }
 
 // newReplicateQueue returns a new instance of replicateQueue.
@@ -60,13 +79,21 @@ func newReplicateQueue(
 		"replicate", rq, store, g,
 		queueConfig{
 			maxSize:              replicateQueueMaxSize,
+			enabled:              replicateQueueEnabled,
 			needsLease:           true,
+			paced:                true,
 			acceptsUnsplitRanges: store.TestingKnobs().ReplicateQueueAcceptsUnsplit,
 			successes:            store.metrics.ReplicateQueueSuccesses,
 			failures:             store.metrics.ReplicateQueueFailures,
 			pending:              store.metrics.ReplicateQueuePending,
 			processingNanos:      store.metrics.ReplicateQueueProcessingNanos,
+			processingLatency:    store.metrics.ReplicateQueueProcessingLatency,
 			purgatory:            store.metrics.ReplicateQueuePurgatory,
+			purgatoryClasses: [numPurgatoryClasses]*metric.Gauge{
+				purgatoryNoTarget:       store.metrics.ReplicateQueuePurgatoryNoTarget,
+				purgatoryStoreThrottled: store.metrics.ReplicateQueuePurgatoryThrottled,
+				purgatoryLeaseNotHeld:   store.metrics.ReplicateQueuePurgatoryLeaseNotHeld,
+			},
 		},
 	)
 
@@ -84,6 +111,21 @@ func newReplicateQueue(
 	return rq
 }
 
+// allocatorForPass returns an allocator which makes all the decisions of a
+// single pass over the range against the same snapshot of the StorePool, and
+// which doesn't reverse the range's recent rebalancing moves.
+func (rq *replicateQueue) allocatorForPass(
+	ctx context.Context, desc *roachpb.RangeDescriptor,
+) Allocator {
+	if rq.allocator.storePool == nil {
+		// The StorePool is nil for some unittests.
+		return rq.allocator
+	}
+	snap := rq.allocator.storePool.snapshot(desc.Replicas)
+	log.VEventf(ctx, 3, "store pool %s", snap)
+	return rq.allocator.withSnapshot(snap).forRange(desc.RangeID)
+}
+
 func (rq *replicateQueue) shouldQueue(
 	ctx context.Context, now hlc.Timestamp, repl *Replica, sysCfg config.SystemConfig,
 ) (shouldQ bool, priority float64) {
@@ -107,28 +149,56 @@ func (rq *replicateQueue) shouldQueue(
 		return
 	}
 
-	action, priority := rq.allocator.ComputeAction(zone, desc)
+	allocator := rq.allocatorForPass(ctx, desc)
+	action, priority := allocator.ComputeAction(zone, desc)
 	if action != AllocatorNoop {
 		if log.V(2) {
 			log.Infof(ctx, "%s repair needed (%s), enqueuing", repl, action)
 		}
 		return true, priority
 	}
-	// See if there is a rebalancing opportunity present.
+	// See if there is a rebalancing opportunity present. Replicas are only
+	// rebalanced within the maintenance window, if one is configured.
 	leaseStoreID := repl.store.StoreID()
 	if lease, _ := repl.getLease(); lease != nil {
 		leaseStoreID = lease.Replica.StoreID
 	}
-	target := rq.allocator.RebalanceTarget(
-		zone.Constraints, desc.Replicas, leaseStoreID)
-	if log.V(2) {
-		if target != nil {
+	var target *roachpb.StoreDescriptor
+	if !outsideMaintenanceWindow(now.GoTime()) {
+		target = allocator.RebalanceTarget(
+			zone.Constraints, desc.Replicas, leaseStoreID)
+	}
+	if target != nil {
+		if log.V(2) {
 			log.Infof(ctx, "%s rebalance target found, enqueuing", repl)
-		} else {
-			log.Infof(ctx, "%s no rebalance target found, not enqueuing", repl)
 		}
+		// Rebalance the ranges serving the most writes first, as moving them
+		// relieves their stores the most.
+		return true, repl.Load().priority()
+	}
+	// Replicas which lag too far behind aren't considered for the lease.
+	leaseCandidates := repl.filterBehindLeaseTargets(desc.Replicas)
+	// See if the lease should be shed because the lease-holder is overloaded.
+	if shedTarget := allocator.ShedLeaseTarget(
+		zone, leaseCandidates, leaseStoreID); shedTarget != nil {
+		if log.V(2) {
+			log.Infof(ctx, "%s lease shedding target found, enqueuing", repl)
+		}
+		return true, 0
+	}
+	// See if the lease should be moved to a preferred store or to a store
+	// with fewer leases.
+	if leaseTarget := allocator.TransferLeaseTarget(
+		zone, leaseCandidates, leaseStoreID); leaseTarget != nil {
+		if log.V(2) {
+			log.Infof(ctx, "%s lease transfer target found, enqueuing", repl)
+		}
+		return true, 0
 	}
-	return target != nil, 0
+	if log.V(2) {
+		log.Infof(ctx, "%s no rebalance target found, not enqueuing", repl)
+	}
+	return false, 0
 }
 
 func (rq *replicateQueue) process(
@@ -140,11 +210,12 @@ func (rq *replicateQueue) process(
 	if err != nil {
 		return err
 	}
-	action, _ := rq.allocator.ComputeAction(zone, desc)
+	allocator := rq.allocatorForPass(ctx, desc)
+	action, _ := allocator.ComputeAction(zone, desc)
 
 	// Avoid taking action if the range has too many dead replicas to make
 	// quorum.
-	deadReplicas := rq.allocator.storePool.deadReplicas(repl.RangeID, desc.Replicas)
+	deadReplicas := allocator.stores().deadReplicas(repl.RangeID, desc.Replicas)
 	quorum := computeQuorum(len(desc.Replicas))
 	liveReplicaCount := len(desc.Replicas) - len(deadReplicas)
 	if liveReplicaCount < quorum {
@@ -154,24 +225,39 @@ func (rq *replicateQueue) process(
 	switch action {
 	case AllocatorAdd:
 		log.Event(ctx, "adding a new replica")
-		newStore, err := rq.allocator.AllocateTarget(zone.Constraints, desc.Replicas, true)
+		newStore, err := allocator.AllocateTarget(zone.Constraints, desc.Replicas, true)
 		if err != nil {
 			return err
 		}
-		newReplica := roachpb.ReplicaDescriptor{
+		newReplicas := []roachpb.ReplicaDescriptor{{
 			NodeID:  newStore.Node.NodeID,
 			StoreID: newStore.StoreID,
+		}}
+
+		// If the range is missing several replicas (e.g. after losing more than
+		// one node), add as many as possible from a single snapshot rather than
+		// scanning the range once per new replica.
+		for missing := int(zone.NumReplicas) - len(desc.Replicas); len(newReplicas) < missing; {
+			existing := append(append([]roachpb.ReplicaDescriptor(nil), desc.Replicas...), newReplicas...)
+			nextStore, err := allocator.AllocateTarget(zone.Constraints, existing, true)
+			if err != nil {
+				break
+			}
+			newReplicas = append(newReplicas, roachpb.ReplicaDescriptor{
+				NodeID:  nextStore.Node.NodeID,
+				StoreID: nextStore.StoreID,
+			})
 		}
 
-		log.VEventf(ctx, 1, "adding replica to %+v due to under-replication", newReplica)
-		if err = repl.ChangeReplicas(ctx, roachpb.ADD_REPLICA, newReplica, desc); err != nil {
+		log.VEventf(ctx, 1, "adding replicas to %+v due to under-replication", newReplicas)
+		if err = repl.addReplicas(ctx, newReplicas, desc); err != nil {
 			return err
 		}
 	case AllocatorRemove:
 		log.Event(ctx, "removing a replica")
 		// We require the lease in order to process replicas, so
 		// repl.store.StoreID() corresponds to the lease-holder's store ID.
-		removeReplica, err := rq.allocator.RemoveTarget(desc.Replicas, repl.store.StoreID())
+		removeReplica, err := allocator.RemoveTarget(desc.Replicas, repl.store.StoreID())
 		if err != nil {
 			return err
 		}
@@ -179,6 +265,10 @@ func (rq *replicateQueue) process(
 		if err = repl.ChangeReplicas(ctx, roachpb.REMOVE_REPLICA, removeReplica, desc); err != nil {
 			return err
 		}
+		if sp := rq.allocator.storePool; sp != nil {
+			sp.rebalanceHistory.recordRemove(
+				desc.RangeID, removeReplica.StoreID, sp.clock.Now().GoTime())
+		}
 		// Do not requeue if we removed ourselves.
 		if removeReplica.StoreID == repl.store.StoreID() {
 			return nil
@@ -191,24 +281,66 @@ func (rq *replicateQueue) process(
 			}
 			break
 		}
+		if newStore := allocator.ReplaceDeadTarget(zone, desc.Replicas, deadReplicas); newStore != nil {
+			newReplica := roachpb.ReplicaDescriptor{
+				NodeID:  newStore.Node.NodeID,
+				StoreID: newStore.StoreID,
+			}
+			log.VEventf(ctx, 1, "adding replica %+v to replace dead replica %+v",
+				newReplica, deadReplicas[0])
+			if err = repl.ChangeReplicas(ctx, roachpb.ADD_REPLICA, newReplica, desc); err != nil {
+				return err
+			}
+			// The dead replica is removed on the next pass.
+			break
+		}
 		deadReplica := deadReplicas[0]
 		log.VEventf(ctx, 1, "removing dead replica %+v from store", deadReplica)
 		if err = repl.ChangeReplicas(ctx, roachpb.REMOVE_REPLICA, deadReplica, desc); err != nil {
 			return err
 		}
 	case AllocatorNoop:
+		// Replicas which lag too far behind aren't considered for the lease.
+		leaseCandidates := repl.filterBehindLeaseTargets(desc.Replicas)
+		// An overloaded store moves its leases away before anything else.
+		//
+		// We require the lease in order to process replicas, so
+		// repl.store.StoreID() corresponds to the lease-holder's store ID.
+		if shedTarget := allocator.ShedLeaseTarget(
+			zone, leaseCandidates, repl.store.StoreID()); shedTarget != nil && rq.allowLeaseShed() {
+			log.Infof(ctx, "shedding lease to s%d as the store is overloaded", shedTarget.StoreID)
+			if err := repl.AdminTransferLease(shedTarget.StoreID); err != nil {
+				return errors.Wrapf(err, "%s: unable to shed lease to s%d", repl, shedTarget.StoreID)
+			}
+			repl.store.metrics.LeaseShedCount.Inc(1)
+			return nil
+		}
 		log.Event(ctx, "considering a rebalance")
 		// The Noop case will result if this replica was queued in order to
 		// rebalance. Attempt to find a rebalancing target.
 		//
 		// We require the lease in order to process replicas, so
 		// repl.store.StoreID() corresponds to the lease-holder's store ID.
-		rebalanceStore := rq.allocator.RebalanceTarget(
-			zone.Constraints, desc.Replicas, repl.store.StoreID())
+		var rebalanceStore *roachpb.StoreDescriptor
+		if outsideMaintenanceWindow(now.GoTime()) {
+			log.VEventf(ctx, 1, "not rebalancing outside the maintenance window")
+		} else {
+			rebalanceStore = allocator.RebalanceTarget(
+				zone.Constraints, desc.Replicas, repl.store.StoreID())
+		}
 		if rebalanceStore == nil {
 			log.VEventf(ctx, 1, "no suitable rebalance target")
-			// No action was necessary and no rebalance target was found. Return
-			// without re-queuing this replica.
+			// No replica needs to move; see whether the lease should.
+			if leaseTarget := allocator.TransferLeaseTarget(
+				zone, leaseCandidates, repl.store.StoreID()); leaseTarget != nil {
+				log.VEventf(ctx, 1, "transferring lease to s%d", leaseTarget.StoreID)
+				if err := repl.AdminTransferLease(leaseTarget.StoreID); err != nil {
+					return errors.Wrapf(err, "%s: unable to transfer lease to s%d", repl, leaseTarget.StoreID)
+				}
+			}
+			// No further action is possible from this store: either nothing
+			// needed doing or the lease now lives elsewhere. Return without
+			// re-queuing this replica.
 			return nil
 		}
 		rebalanceReplica := roachpb.ReplicaDescriptor{
@@ -219,6 +351,9 @@ func (rq *replicateQueue) process(
 		if err = repl.ChangeReplicas(ctx, roachpb.ADD_REPLICA, rebalanceReplica, desc); err != nil {
 			return err
 		}
+		if sp := rq.allocator.storePool; sp != nil {
+			sp.rebalanceHistory.recordAdd(desc.RangeID, rebalanceReplica.StoreID, sp.clock.Now().GoTime())
+		}
 	}
 
 	// Enqueue this replica again to see if there are more changes to be made.
@@ -226,6 +361,19 @@ func (rq *replicateQueue) process(
 	return nil
 }
 
+// allowLeaseShed returns whether enough time has passed since the queue last
+// shed a lease for it to shed another one, and if so records that it does.
+func (rq *replicateQueue) allowLeaseShed() bool {
+	rq.lastLeaseShed.Lock()
+	defer rq.lastLeaseShed.Unlock()
+	now := timeutil.Now()
+	if now.Sub(rq.lastLeaseShed.at) < leaseSheddingInterval.Get() {
+		return false
+	}
+	rq.lastLeaseShed.at = now
+	return true
+}
+
 func (*replicateQueue) timer() time.Duration {
 	return replicateQueueTimerDuration
 }
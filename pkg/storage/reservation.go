@@ -41,6 +41,9 @@ type ReservationRequest struct {
 	StoreRequestHeader
 	RangeID   roachpb.RangeID
 	RangeSize int64
+	// Recovery is set for the replicas which repair an under-replicated
+	// range, whose reservations only need the disk space.
+	Recovery bool
 }
 
 // ReservationResponse represents a response from the reservation system.
@@ -118,6 +121,9 @@ func newBookie(
 
 // Reserve a new replica. Reservations can be rejected due to having too many
 // outstanding reservations already or not having enough free disk space.
+// Recovery reservations aren't subject to the limits on the number and size
+// of the outstanding reservations, so that repairs aren't turned away by the
+// rebalancing snapshots a store is receiving.
 // Accepted reservations return a ReservationResponse with Reserved set to true.
 func (b *bookie) Reserve(
 	ctx context.Context, req ReservationRequest, deadReplicas []roachpb.ReplicaIdent,
@@ -150,7 +156,7 @@ func (b *bookie) Reserve(
 	}
 
 	// Do we have too many current reservations?
-	if len(b.mu.reservationsByRangeID) >= b.maxReservations {
+	if !req.Recovery && len(b.mu.reservationsByRangeID) >= b.maxReservations {
 		if log.V(1) {
 			log.Infof(ctx, "could not book reservation %+v, too many reservations already (current:%d, max:%d)",
 				req, len(b.mu.reservationsByRangeID), b.maxReservations)
@@ -172,7 +178,7 @@ func (b *bookie) Reserve(
 	}
 
 	// Do we have enough reserved space free for the reservation?
-	if b.mu.size+req.RangeSize > b.maxReservedBytes {
+	if !req.Recovery && b.mu.size+req.RangeSize > b.maxReservedBytes {
 		if log.V(1) {
 			log.Infof(ctx, "could not book reservation %+v, not enough available reservation space (requested:%d, reserved:%d, maxReserved:%d)",
 				req, req.RangeSize, b.mu.size, b.maxReservedBytes)
@@ -227,6 +233,17 @@ func (b *bookie) Fill(rangeID roachpb.RangeID) bool {
 	return true
 }
 
+// fillCapacity sets the reservation fields of the store capacity to the
+// bookie's outstanding reservations and limits.
+func (b *bookie) fillCapacity(capacity *roachpb.StoreCapacity) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	capacity.ReservedBytes = b.mu.size
+	capacity.MaxReservedBytes = b.maxReservedBytes
+	capacity.Reservations = int32(len(b.mu.reservationsByRangeID))
+	capacity.MaxReservations = int32(b.maxReservations)
+}
+
 // fillReservationLocked fills a reservation. It requires that the bookie's
 // lock is held. This should only be called internally.
 func (b *bookie) fillReservationLocked(res *reservation) {
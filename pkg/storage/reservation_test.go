@@ -216,6 +216,69 @@ func TestBookieReserveMaxRanges(t *testing.T) {
 	}
 	// The same numbers from the last call to verifyBookie.
 	verifyBookie(t, b, previousReserved, previousReserved, int64(previousReserved))
+
+	// Recovery reservations aren't held back by the reservations already
+	// booked, but still need the disk space.
+	recoveryReq := overbookedReq
+	recoveryReq.Recovery = true
+	if !b.Reserve(context.Background(), recoveryReq, nil).Reserved {
+		t.Errorf("expected recovery reservation to succeed despite too many already existing reservations")
+	}
+	verifyBookie(t, b, previousReserved+1, previousReserved+1, int64(previousReserved+1))
+
+	fullReq := recoveryReq
+	fullReq.RangeID++
+	fullReq.RangeSize = b.metrics.Available.Value()
+	if b.Reserve(context.Background(), fullReq, nil).Reserved {
+		t.Errorf("expected recovery reservation to fail due to disk space constraints, but it succeeded")
+	}
+	verifyBookie(t, b, previousReserved+1, previousReserved+1, int64(previousReserved+1))
+}
+
+// TestBookieFillCapacity verifies that the bookie reports its outstanding
+// reservations and limits in the store capacity, and that the budget is
+// exhausted once either limit is reached.
+func TestBookieFillCapacity(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper, _, b := createTestBookie(time.Hour, 2, 100)
+	defer stopper.Stop()
+
+	reserve := func(rangeID roachpb.RangeID, size int64) {
+		req := ReservationRequest{
+			StoreRequestHeader: StoreRequestHeader{StoreID: 1, NodeID: 1},
+			RangeID:            rangeID,
+			RangeSize:          size,
+		}
+		if !b.Reserve(context.Background(), req, nil).Reserved {
+			t.Fatalf("r%d: could not add reservation", rangeID)
+		}
+	}
+	expectCapacity := func(reservations int32, reservedBytes int64, exhausted bool) {
+		var capacity roachpb.StoreCapacity
+		b.fillCapacity(&capacity)
+		if capacity.MaxReservations != 2 || capacity.MaxReservedBytes != 100 {
+			t.Errorf("unexpected limits in %+v", capacity)
+		}
+		if capacity.Reservations != reservations || capacity.ReservedBytes != reservedBytes {
+			t.Errorf("expected %d reservations of %d bytes, got %+v", reservations, reservedBytes, capacity)
+		}
+		if a := capacity.ReservationsExhausted(); a != exhausted {
+			t.Errorf("expected exhausted=%t, got %t for %+v", exhausted, a, capacity)
+		}
+	}
+
+	expectCapacity(0, 0, false)
+	reserve(1, 100)
+	expectCapacity(1, 100, true)
+	b.Fill(1)
+	reserve(2, 10)
+	expectCapacity(1, 10, false)
+	reserve(3, 10)
+	expectCapacity(2, 20, true)
+	b.Fill(2)
+	b.Fill(3)
+	expectCapacity(0, 0, false)
 }
 
 // TestBookieReserveMaxBytes ensures that over-booking doesn't occur when trying
@@ -22,6 +22,7 @@ import (
 	"golang.org/x/net/context"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
@@ -40,8 +41,8 @@ type replicaQueue interface {
 	Start(*hlc.Clock, *stop.Stopper)
 	// MaybeAdd adds the replica to the queue if the replica meets
 	// the queue's inclusion criteria and the queue is not already
-	// too full, etc.
-	MaybeAdd(*Replica, hlc.Timestamp)
+	// too full, etc. It returns whether the replica met the criteria.
+	MaybeAdd(*Replica, hlc.Timestamp) bool
 	// MaybeRemove removes the replica from the queue if it is present.
 	MaybeRemove(roachpb.RangeID)
 }
@@ -58,26 +59,43 @@ type replicaSet interface {
 	EstimatedCount() int
 }
 
+// scannerBacklogSpeedup is how many times faster than its target interval
+// the scanner completes a scan after a scan in which every replica was
+// queued. When many replicas need work, e.g. after a node died, scanning
+// faster finds the remaining ones sooner.
+const scannerBacklogSpeedup = 4
+
 // A replicaScanner iterates over replicas at a measured pace in order to
 // complete approximately one full scan per target interval in a large
 // store (in small stores it may complete faster than the target
 // interval).  Each replica is tested for inclusion in a sequence of
-// prioritized replica queues.
+// prioritized replica queues. The pace adapts to the number of replicas
+// left to scan and speeds up with the fraction of the replicas which were
+// queued during the previous scan.
 type replicaScanner struct {
 	log.AmbientContext
 
 	targetInterval time.Duration  // Target duration interval for scan loop
 	maxIdleTime    time.Duration  // Max idle time for scan loop
+	minIdleTime    time.Duration  // Min idle time for scan loop
 	waitTimer      timeutil.Timer // Shared timer to avoid allocations.
 	replicas       replicaSet     // Replicas to be scanned
 	queues         []replicaQueue // Replica queues managed by this scanner
 	removed        chan *Replica  // Replicas to remove from queues
+	// enabled, if set, is the cluster setting which turns the scanner on and
+	// off at runtime. While it is off, replicas aren't offered to the queues.
+	enabled *settings.BoolSetting
 	// Count of times and total duration through the scanning loop.
 	mu struct {
 		syncutil.Mutex
 		scanCount        int64
 		waitEnabledCount int64
 		total            time.Duration
+		// queued is the number of replicas queued during the current scan,
+		// and queuedFraction the fraction of the replicas queued during the
+		// previous one.
+		queued         int
+		queuedFraction float64
 		// Some tests in this package disable scanning.
 		disabled bool
 	}
@@ -90,7 +108,9 @@ type replicaScanner struct {
 // nil, after a complete loop that function will be called. If the
 // targetInterval is 0, the scanner is disabled.
 func newReplicaScanner(
-	ambient log.AmbientContext, targetInterval, maxIdleTime time.Duration, replicas replicaSet,
+	ambient log.AmbientContext,
+	targetInterval, maxIdleTime, minIdleTime time.Duration,
+	replicas replicaSet,
 ) *replicaScanner {
 	if targetInterval < 0 {
 		panic("scanner interval must be greater than or equal to zero")
@@ -99,6 +119,7 @@ func newReplicaScanner(
 		AmbientContext: ambient,
 		targetInterval: targetInterval,
 		maxIdleTime:    maxIdleTime,
+		minIdleTime:    minIdleTime,
 		replicas:       replicas,
 		removed:        make(chan *Replica, 10),
 		setDisabledCh:  make(chan struct{}, 1),
@@ -173,10 +194,18 @@ func (rs *replicaScanner) RemoveReplica(repl *Replica) {
 }
 
 // paceInterval returns a duration between iterations to allow us to pace
-// the scan.
+// the scan. The time left until the end of the scan is spread over the
+// replicas which remain to be scanned; the scan is shortened when many
+// replicas were queued during the previous scan.
 func (rs *replicaScanner) paceInterval(start, now time.Time) time.Duration {
+	rs.mu.Lock()
+	queuedFraction := rs.mu.queuedFraction
+	rs.mu.Unlock()
+	targetNanos := float64(rs.targetInterval.Nanoseconds()) /
+		(1 + (scannerBacklogSpeedup-1)*queuedFraction)
+
 	elapsed := now.Sub(start)
-	remainingNanos := rs.targetInterval.Nanoseconds() - elapsed.Nanoseconds()
+	remainingNanos := int64(targetNanos) - elapsed.Nanoseconds()
 	if remainingNanos < 0 {
 		remainingNanos = 0
 	}
@@ -185,6 +214,9 @@ func (rs *replicaScanner) paceInterval(start, now time.Time) time.Duration {
 		count = 1
 	}
 	interval := time.Duration(remainingNanos / int64(count))
+	if interval < rs.minIdleTime {
+		interval = rs.minIdleTime
+	}
 	if rs.maxIdleTime > 0 && interval > rs.maxIdleTime {
 		interval = rs.maxIdleTime
 	}
@@ -210,15 +242,23 @@ func (rs *replicaScanner) waitAndProcess(
 				log.Infof(ctx, "wait timer fired")
 			}
 			rs.waitTimer.Read = true
-			if repl == nil {
+			if repl == nil || (rs.enabled != nil && !rs.enabled.Get()) {
 				return false
 			}
 
 			if log.V(2) {
 				log.Infof(ctx, "replica scanner processing %s", repl)
 			}
+			var queued bool
 			for _, q := range rs.queues {
-				q.MaybeAdd(repl, clock.Now())
+				if q.MaybeAdd(repl, clock.Now()) {
+					queued = true
+				}
+			}
+			if queued {
+				rs.mu.Lock()
+				rs.mu.queued++
+				rs.mu.Unlock()
 			}
 			return false
 
@@ -280,6 +320,11 @@ func (rs *replicaScanner) scanLoop(clock *hlc.Clock, stopper *stop.Stopper) {
 				defer rs.mu.Unlock()
 				rs.mu.scanCount++
 				rs.mu.total += timeutil.Since(start)
+				rs.mu.queuedFraction = 0
+				if count > 0 {
+					rs.mu.queuedFraction = float64(rs.mu.queued) / float64(count)
+				}
+				rs.mu.queued = 0
 				if log.V(6) {
 					log.Infof(ctx, "reset replica scan iteration")
 				}
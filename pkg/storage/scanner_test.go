@@ -147,12 +147,15 @@ func (tq *testQueue) Start(clock *hlc.Clock, stopper *stop.Stopper) {
 	})
 }
 
-func (tq *testQueue) MaybeAdd(rng *Replica, now hlc.Timestamp) {
+func (tq *testQueue) MaybeAdd(rng *Replica, now hlc.Timestamp) bool {
 	tq.Lock()
 	defer tq.Unlock()
 	if index := tq.indexOf(rng.RangeID); index == -1 {
 		tq.ranges = append(tq.ranges, rng)
 	}
+	// Don't let the queued replicas speed up the scanner, which would throw
+	// off the tests of its timing.
+	return false
 }
 
 func (tq *testQueue) MaybeRemove(rangeID roachpb.RangeID) {
@@ -194,7 +197,7 @@ func TestScannerAddToQueues(t *testing.T) {
 	// We don't want to actually consume entries from the queues during this test.
 	q1.setDisabled(true)
 	q2.setDisabled(true)
-	s := newReplicaScanner(log.AmbientContext{}, 1*time.Millisecond, 0, ranges)
+	s := newReplicaScanner(log.AmbientContext{}, 1*time.Millisecond, 0, 0, ranges)
 	s.AddQueues(q1, q2)
 	mc := hlc.NewManualClock(0)
 	clock := hlc.NewClock(mc.UnixNano)
@@ -246,7 +249,7 @@ func TestScannerTiming(t *testing.T) {
 		util.SucceedsSoon(t, func() error {
 			ranges := newTestRangeSet(count, t)
 			q := &testQueue{}
-			s := newReplicaScanner(log.AmbientContext{}, duration, 0, ranges)
+			s := newReplicaScanner(log.AmbientContext{}, duration, 0, 0, ranges)
 			s.AddQueues(q)
 			mc := hlc.NewManualClock(0)
 			clock := hlc.NewClock(mc.UnixNano)
@@ -286,19 +289,35 @@ func TestScannerPaceInterval(t *testing.T) {
 	for _, duration := range durations {
 		startTime := timeutil.Now()
 		ranges := newTestRangeSet(count, t)
-		s := newReplicaScanner(log.AmbientContext{}, duration, 0, ranges)
+		s := newReplicaScanner(log.AmbientContext{}, duration, 0, 0, ranges)
 		interval := s.paceInterval(startTime, startTime)
 		logErrorWhenNotCloseTo(duration/count, interval)
 		// The range set is empty
 		ranges = newTestRangeSet(0, t)
-		s = newReplicaScanner(log.AmbientContext{}, duration, 0, ranges)
+		s = newReplicaScanner(log.AmbientContext{}, duration, 0, 0, ranges)
 		interval = s.paceInterval(startTime, startTime)
 		logErrorWhenNotCloseTo(duration, interval)
 		ranges = newTestRangeSet(count, t)
-		s = newReplicaScanner(log.AmbientContext{}, duration, 0, ranges)
+		s = newReplicaScanner(log.AmbientContext{}, duration, 0, 0, ranges)
 		// Move the present to duration time into the future
 		interval = s.paceInterval(startTime, startTime.Add(duration))
 		logErrorWhenNotCloseTo(0, interval)
+		// The minimum idle time applies once the scan has fallen behind, but
+		// doesn't override the maximum idle time.
+		s = newReplicaScanner(log.AmbientContext{}, duration, 0, time.Millisecond, ranges)
+		interval = s.paceInterval(startTime, startTime.Add(duration))
+		logErrorWhenNotCloseTo(time.Millisecond, interval)
+		s = newReplicaScanner(log.AmbientContext{}, duration, time.Microsecond, time.Millisecond, ranges)
+		interval = s.paceInterval(startTime, startTime.Add(duration))
+		logErrorWhenNotCloseTo(time.Microsecond, interval)
+		// The scan speeds up when replicas were queued during the previous one.
+		s = newReplicaScanner(log.AmbientContext{}, duration, 0, 0, ranges)
+		s.mu.queuedFraction = 1
+		interval = s.paceInterval(startTime, startTime)
+		logErrorWhenNotCloseTo(duration/scannerBacklogSpeedup/count, interval)
+		s.mu.queuedFraction = 0.5
+		interval = s.paceInterval(startTime, startTime)
+		logErrorWhenNotCloseTo(duration*2/(scannerBacklogSpeedup+1)/count, interval)
 	}
 }
 
@@ -309,7 +328,7 @@ func TestScannerDisabled(t *testing.T) {
 	const count = 3
 	ranges := newTestRangeSet(count, t)
 	q := &testQueue{}
-	s := newReplicaScanner(log.AmbientContext{}, 1*time.Millisecond, 0, ranges)
+	s := newReplicaScanner(log.AmbientContext{}, 1*time.Millisecond, 0, 0, ranges)
 	s.AddQueues(q)
 	mc := hlc.NewManualClock(0)
 	clock := hlc.NewClock(mc.UnixNano)
@@ -361,7 +380,7 @@ func TestScannerDisabled(t *testing.T) {
 func TestScannerDisabledWithZeroInterval(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	ranges := newTestRangeSet(1, t)
-	s := newReplicaScanner(log.AmbientContext{}, 0*time.Millisecond, 0, ranges)
+	s := newReplicaScanner(log.AmbientContext{}, 0*time.Millisecond, 0, 0, ranges)
 	if !s.GetDisabled() {
 		t.Errorf("expected scanner to be disabled")
 	}
@@ -372,7 +391,7 @@ func TestScannerEmptyRangeSet(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	ranges := newTestRangeSet(0, t)
 	q := &testQueue{}
-	s := newReplicaScanner(log.AmbientContext{}, time.Hour, 0, ranges)
+	s := newReplicaScanner(log.AmbientContext{}, time.Hour, 0, 0, ranges)
 	s.AddQueues(q)
 	mc := hlc.NewManualClock(0)
 	clock := hlc.NewClock(mc.UnixNano)
@@ -26,6 +26,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
 
 const rangeIDChunkSize = 1000
@@ -126,27 +127,47 @@ const (
 	stateRaftTick
 )
 
+// raftScheduleEntry is the scheduling state of a range ID.
+type raftScheduleEntry struct {
+	state raftScheduleState
+	// queued is the time at which the range ID was last pushed onto the queue.
+	// It is used to measure how long ranges wait for a worker.
+	queued time.Time
+}
+
 type raftScheduler struct {
-	processor  raftProcessor
-	numWorkers int
+	processor     raftProcessor
+	metrics       *StoreMetrics
+	numWorkers    int
+	tickBatchSize int
 
 	mu struct {
 		syncutil.TimedMutex
 		cond    *sync.Cond
 		queue   rangeIDQueue
-		state   map[roachpb.RangeID]raftScheduleState
+		state   map[roachpb.RangeID]raftScheduleEntry
 		stopped bool
 	}
 
 	done sync.WaitGroup
 }
 
+// newRaftScheduler creates a scheduler which processes ranges on numWorkers
+// goroutines. Ticks are queued tickBatchSize ranges at a time, waking
+// workers after each batch; a tickBatchSize of zero queues all of the ticks
+// in a single batch. metrics may be nil.
 func newRaftScheduler(
-	ambient log.AmbientContext, metrics *StoreMetrics, processor raftProcessor, numWorkers int,
+	ambient log.AmbientContext,
+	metrics *StoreMetrics,
+	processor raftProcessor,
+	numWorkers int,
+	tickBatchSize int,
 ) *raftScheduler {
 	s := &raftScheduler{
-		processor:  processor,
-		numWorkers: numWorkers,
+		processor:     processor,
+		metrics:       metrics,
+		numWorkers:    numWorkers,
+		tickBatchSize: tickBatchSize,
 	}
 	muLogger := syncutil.ThresholdLogger(
 		ambient.AnnotateCtx(context.Background()),
@@ -162,7 +183,7 @@ func newRaftScheduler(
 	)
 	s.mu.TimedMutex = syncutil.MakeTimedMutex(muLogger)
 	s.mu.cond = sync.NewCond(&s.mu.TimedMutex)
-	s.mu.state = make(map[roachpb.RangeID]raftScheduleState)
+	s.mu.state = make(map[roachpb.RangeID]raftScheduleEntry)
 	return s
 }
 
@@ -215,10 +236,16 @@ func (s *raftScheduler) worker(stopper *stop.Stopper) {
 		// Grab and clear the existing state for the range ID. Note that we leave
 		// the range ID marked as "queued" so that a concurrent Enqueue* will not
 		// queue the range ID again.
-		state := s.mu.state[id]
-		s.mu.state[id] = stateQueued
+		entry := s.mu.state[id]
+		s.mu.state[id] = raftScheduleEntry{state: stateQueued}
 		s.mu.Unlock()
 
+		if s.metrics != nil {
+			s.metrics.RaftSchedulerLatency.RecordValue(timeutil.Since(entry.queued).Nanoseconds())
+		}
+
+		state := entry.state
+
 		if state&stateRaftTick != 0 {
 			// processRaftTick returns true if the range should perform ready
 			// processing. Do not reorder this below the call to processReady.
@@ -242,39 +269,45 @@ func (s *raftScheduler) worker(stopper *stop.Stopper) {
 		}
 
 		s.mu.Lock()
-		state = s.mu.state[id]
-		if state == stateQueued {
+		entry = s.mu.state[id]
+		if entry.state == stateQueued {
 			// No further processing required by the range ID, clear it from the
 			// state map.
 			delete(s.mu.state, id)
 		} else {
 			// There was a concurrent call to one of the Enqueue* methods. Queue the
 			// range ID for further processing.
+			entry.queued = timeutil.Now()
+			s.mu.state[id] = entry
 			s.mu.queue.PushBack(id)
 			s.mu.cond.Signal()
 		}
 	}
 }
 
-func (s *raftScheduler) enqueue1Locked(addState raftScheduleState, id roachpb.RangeID) int {
-	prevState := s.mu.state[id]
-	if prevState&addState == addState {
+func (s *raftScheduler) enqueue1Locked(
+	addState raftScheduleState, id roachpb.RangeID, now time.Time,
+) int {
+	entry := s.mu.state[id]
+	if entry.state&addState == addState {
 		return 0
 	}
 	var queued int
-	newState := prevState | addState
-	if newState&stateQueued == 0 {
-		newState |= stateQueued
+	entry.state |= addState
+	if entry.state&stateQueued == 0 {
+		entry.state |= stateQueued
+		entry.queued = now
 		queued++
 		s.mu.queue.PushBack(id)
 	}
-	s.mu.state[id] = newState
+	s.mu.state[id] = entry
 	return queued
 }
 
 func (s *raftScheduler) enqueue1(addState raftScheduleState, id roachpb.RangeID) int {
+	now := timeutil.Now()
 	s.mu.Lock()
-	count := s.enqueue1Locked(addState, id)
+	count := s.enqueue1Locked(addState, id, now)
 	s.mu.Unlock()
 	return count
 }
@@ -284,11 +317,13 @@ func (s *raftScheduler) enqueueN(addState raftScheduleState, ids ...roachpb.Rang
 	const enqueueChunkSize = 128
 
 	var count int
+	now := timeutil.Now()
 	s.mu.Lock()
 	for i, id := range ids {
-		count += s.enqueue1Locked(addState, id)
+		count += s.enqueue1Locked(addState, id, now)
 		if (i+1)%enqueueChunkSize == 0 {
 			s.mu.Unlock()
+			now = timeutil.Now()
 			s.mu.Lock()
 		}
 	}
@@ -315,5 +350,16 @@ func (s *raftScheduler) EnqueueRaftRequest(id roachpb.RangeID) {
 }
 
 func (s *raftScheduler) EnqueueRaftTick(ids ...roachpb.RangeID) {
-	s.signal(s.enqueueN(stateRaftTick, ids...))
+	batchSize := s.tickBatchSize
+	if batchSize <= 0 {
+		batchSize = len(ids)
+	}
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		s.signal(s.enqueueN(stateRaftTick, batch...))
+		ids = ids[len(batch):]
+	}
 }
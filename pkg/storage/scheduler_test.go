@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/util"
@@ -193,7 +194,7 @@ func TestSchedulerLoop(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
 	p := newTestProcessor()
-	s := newRaftScheduler(log.AmbientContext{}, nil, p, 1)
+	s := newRaftScheduler(log.AmbientContext{}, nil, p, 1, 0)
 	stopper := stop.NewStopper()
 	defer stopper.Stop()
 	s.Start(stopper)
@@ -214,7 +215,7 @@ func TestSchedulerBuffering(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
 	p := newTestProcessor()
-	s := newRaftScheduler(log.AmbientContext{}, nil, p, 1)
+	s := newRaftScheduler(log.AmbientContext{}, nil, p, 1, 0)
 	stopper := stop.NewStopper()
 	defer stopper.Stop()
 	s.Start(stopper)
@@ -240,3 +241,28 @@ func TestSchedulerBuffering(t *testing.T) {
 		})
 	}
 }
+
+// Verify that ticks queued in batches are all processed and that the
+// scheduler records how long ranges waited to be processed.
+func TestSchedulerTickBatching(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	p := newTestProcessor()
+	metrics := newStoreMetrics(time.Minute)
+	s := newRaftScheduler(log.AmbientContext{}, metrics, p, 1, 2)
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	s.Start(stopper)
+	s.EnqueueRaftTick(1, 2, 3, 4, 5)
+
+	util.SucceedsSoon(t, func() error {
+		const expected = "ready=[] request=[] tick=[1:1,2:1,3:1,4:1,5:1]"
+		if s := p.String(); expected != s {
+			return errors.Errorf("expected %s, but got %s", expected, s)
+		}
+		if n := metrics.RaftSchedulerLatency.TotalCount(); n != 5 {
+			return errors.Errorf("expected 5 latency samples, but got %d", n)
+		}
+		return nil
+	})
+}
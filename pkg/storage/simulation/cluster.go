@@ -30,6 +30,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/testutils/gossiputil"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
@@ -89,7 +90,8 @@ func createCluster(
 		g,
 		clock,
 		rpcContext,
-		storage.TestTimeUntilStoreDeadOff,
+		nil, /* nodeLivenessFn */
+		settings.TestingDurationSetting(storage.TestTimeUntilStoreDeadOff),
 		stopper,
 	)
 	c := &Cluster{
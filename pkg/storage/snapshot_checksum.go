@@ -0,0 +1,79 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"hash/crc32"
+
+	"github.com/pkg/errors"
+)
+
+// snapshotChecksumTable is the CRC-32C table used for the checksums of
+// snapshots, which most CPUs compute in hardware.
+var snapshotChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// snapshotMessageChecksum returns the checksum of the data a snapshot
+// message carries: its kv_batch as sent, followed by its log entries.
+func snapshotMessageChecksum(req *SnapshotRequest) uint32 {
+	crc := crc32.Update(0, snapshotChecksumTable, req.KVBatch)
+	for _, entry := range req.LogEntries {
+		crc = crc32.Update(crc, snapshotChecksumTable, entry)
+	}
+	return crc
+}
+
+// withChecksum sets the checksum of the snapshot message and returns it.
+func withChecksum(req *SnapshotRequest) *SnapshotRequest {
+	req.Checksum = snapshotMessageChecksum(req)
+	return req
+}
+
+// verifySnapshotMessage returns an error if the data of the snapshot message
+// doesn't match its checksum.
+func verifySnapshotMessage(req *SnapshotRequest) error {
+	if crc := snapshotMessageChecksum(req); crc != req.Checksum {
+		return errors.Errorf("snapshot message checksum mismatch: expected %08x, computed %08x",
+			req.Checksum, crc)
+	}
+	return nil
+}
+
+// snapshotChecksum is the checksum of a whole snapshot, which covers its
+// decoded key/value batches followed by its log entries. Since it doesn't
+// depend on the snapshot format, the sender computes it once for all of the
+// recipients of a snapshot.
+type snapshotChecksum uint32
+
+// add extends the checksum with the next piece of the snapshot.
+func (c *snapshotChecksum) add(data []byte) {
+	*c = snapshotChecksum(crc32.Update(uint32(*c), snapshotChecksumTable, data))
+}
+
+// addLogEntries extends the checksum with the log entries of the snapshot.
+func (c *snapshotChecksum) addLogEntries(logEntries [][]byte) {
+	for _, entry := range logEntries {
+		c.add(entry)
+	}
+}
+
+// verify returns an error if the checksum doesn't match the one the sender
+// computed.
+func (c snapshotChecksum) verify(expected uint32) error {
+	if uint32(c) != expected {
+		return errors.Errorf("snapshot checksum mismatch: expected %08x, computed %08x",
+			expected, uint32(c))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestSnapshotMessageChecksum(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []*SnapshotRequest{
+		{},
+		{KVBatch: []byte("batch")},
+		{LogEntries: [][]byte{[]byte("entry 1"), []byte("entry 2")}},
+		{KVBatch: []byte("batch"), LogEntries: [][]byte{[]byte("entry")}, Final: true},
+	}
+	for i, req := range testCases {
+		if err := verifySnapshotMessage(withChecksum(req)); err != nil {
+			t.Errorf("%d: %s", i, err)
+		}
+		// Flipping a bit of the data is detected.
+		if len(req.KVBatch) > 0 {
+			req.KVBatch[0] ^= 1
+		} else if len(req.LogEntries) > 0 {
+			req.LogEntries[len(req.LogEntries)-1][0] ^= 1
+		} else {
+			continue
+		}
+		if err := verifySnapshotMessage(req); !testutils.IsError(err, "checksum mismatch") {
+			t.Errorf("%d: expected checksum mismatch, got %v", i, err)
+		}
+	}
+}
+
+func TestSnapshotChecksum(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	batches := [][]byte{[]byte("batch 1"), []byte("batch 2")}
+	logEntries := [][]byte{[]byte("entry 1"), []byte("entry 2")}
+	var expected snapshotChecksum
+	for _, b := range batches {
+		expected.add(b)
+	}
+	expected.addLogEntries(logEntries)
+
+	// The checksum covers the order of the pieces of the snapshot.
+	var reordered snapshotChecksum
+	reordered.add(batches[1])
+	reordered.add(batches[0])
+	reordered.addLogEntries(logEntries)
+	if err := reordered.verify(uint32(expected)); !testutils.IsError(err, "checksum mismatch") {
+		t.Errorf("expected checksum mismatch for reordered batches, got %v", err)
+	}
+
+	// A missing log entry is detected.
+	var truncated snapshotChecksum
+	for _, b := range batches {
+		truncated.add(b)
+	}
+	truncated.addLogEntries(logEntries[:1])
+	if err := truncated.verify(uint32(expected)); !testutils.IsError(err, "checksum mismatch") {
+		t.Errorf("expected checksum mismatch for missing log entry, got %v", err)
+	}
+
+	if err := expected.verify(uint32(expected)); err != nil {
+		t.Error(err)
+	}
+}
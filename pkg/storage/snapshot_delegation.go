@@ -0,0 +1,204 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"reflect"
+
+	"github.com/coreos/etcd/raft"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+)
+
+// snapshotDelegationEnabled controls whether the leaseholder delegates the
+// preemptive snapshot of a new replica to a follower in the new replica's
+// locality, when it is farther away from it than the follower is. Streaming
+// the snapshot from a nearby follower saves cross-region bandwidth.
+var snapshotDelegationEnabled = settings.RegisterBoolSetting(
+	"kv.snapshot_delegation.enabled",
+	"send the preemptive snapshots of new replicas from a follower closer to them than the leaseholder",
+	true,
+)
+
+// snapshotDelegateCandidate is a follower which could send a snapshot in
+// the leaseholder's stead.
+type snapshotDelegateCandidate struct {
+	repDesc  roachpb.ReplicaDescriptor
+	locality roachpb.Locality
+}
+
+// pickSnapshotDelegate returns the candidate whose locality is the most
+// similar to the target's, provided that it is more similar to it than the
+// sender's. Ties go to the first such candidate.
+func pickSnapshotDelegate(
+	sender, target roachpb.Locality, candidates []snapshotDelegateCandidate,
+) (roachpb.ReplicaDescriptor, bool) {
+	best := sender.DiversityScore(target)
+	var delegate roachpb.ReplicaDescriptor
+	var found bool
+	for _, c := range candidates {
+		if score := c.locality.DiversityScore(target); score < best {
+			best = score
+			delegate = c.repDesc
+			found = true
+		}
+	}
+	return delegate, found
+}
+
+// snapshotDelegate returns the follower of the range, if any, to which the
+// replica delegates the preemptive snapshot of the given target. Only live
+// followers which are being replicated to normally are considered, and the
+// localities of the stores are taken from the StorePool.
+func (r *Replica) snapshotDelegate(
+	target roachpb.ReplicaDescriptor, desc roachpb.RangeDescriptor,
+) (roachpb.ReplicaDescriptor, bool) {
+	sp := r.store.cfg.StorePool
+	if sp == nil || !snapshotDelegationEnabled.Get() {
+		return roachpb.ReplicaDescriptor{}, false
+	}
+	targetDesc, ok := sp.getStoreDescriptor(target.StoreID)
+	if !ok {
+		return roachpb.ReplicaDescriptor{}, false
+	}
+	raftStatus := r.RaftStatus()
+	if raftStatus == nil {
+		return roachpb.ReplicaDescriptor{}, false
+	}
+
+	var candidates []snapshotDelegateCandidate
+	statuses := sp.replicaStatuses(desc.Replicas)
+	for i, repDesc := range desc.Replicas {
+		if repDesc.StoreID == r.store.StoreID() || statuses[i] != storeStatusLive {
+			continue
+		}
+		if progress, ok := raftStatus.Progress[uint64(repDesc.ReplicaID)]; !ok ||
+			progress.State != raft.ProgressStateReplicate {
+			continue
+		}
+		storeDesc, ok := sp.getStoreDescriptor(repDesc.StoreID)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, snapshotDelegateCandidate{
+			repDesc:  repDesc,
+			locality: storeDesc.Node.Locality,
+		})
+	}
+	return pickSnapshotDelegate(r.store.nodeDesc.Locality, targetDesc.Node.Locality, candidates)
+}
+
+// delegateSnapshot asks the delegate to send its preemptive snapshot of the
+// range to the target, and waits until the target has applied it.
+func (r *Replica) delegateSnapshot(
+	ctx context.Context,
+	delegate, target roachpb.ReplicaDescriptor,
+	desc roachpb.RangeDescriptor,
+) error {
+	// The target may not receive another snapshot of the range meanwhile,
+	// though the delegate sends this one.
+	done, err := r.store.snapshotsInFlight.register(r.RangeID, target.StoreID)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if sp := r.store.cfg.StorePool; sp != nil {
+		defer sp.reserveSnapshot(target.StoreID, r.GetMVCCStats().Total())()
+	}
+	fromRepDesc, err := r.GetReplicaDescriptor()
+	if err != nil {
+		return err
+	}
+	header := SnapshotRequest_Header{
+		RangeDescriptor: desc,
+		RaftMessageRequest: RaftMessageRequest{
+			RangeID:     r.RangeID,
+			FromReplica: fromRepDesc,
+			ToReplica:   delegate,
+		},
+		RangeSize:       r.GetMVCCStats().Total(),
+		CanDecline:      true,
+		DelegatedTarget: &target,
+		Type:            r.preemptiveMovementType(desc).snapshotType(),
+	}
+	return r.store.cfg.Transport.DelegateSnapshot(ctx, header)
+}
+
+// requestDelegatedSnapshot sends the header of a delegated snapshot on the
+// stream and waits for the delegate to report its outcome.
+func requestDelegatedSnapshot(stream OutgoingSnapshotStream, header SnapshotRequest_Header) error {
+	if err := stream.Send(&SnapshotRequest{Header: &header}); err != nil {
+		return err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	switch resp.Status {
+	case SnapshotResponse_APPLIED:
+		return nil
+	case SnapshotResponse_ERROR:
+		return errors.Errorf("range=%s: delegated snapshot to %+v failed: %s",
+			header.RangeDescriptor.RangeID, *header.DelegatedTarget, resp.Message)
+	default:
+		return errors.Errorf("range=%s: delegate sent an invalid status: %s",
+			header.RangeDescriptor.RangeID, resp.Status)
+	}
+}
+
+// handleDelegatedSnapshot sends the preemptive snapshot the leaseholder
+// delegated to the store, and reports the outcome on the stream. The
+// store's replica must have the descriptor the leaseholder is changing, so
+// that the snapshot matches the header the target receives.
+func (s *Store) handleDelegatedSnapshot(
+	ctx context.Context, header *SnapshotRequest_Header, stream MultiRaft_RaftSnapshotServer,
+) error {
+	err := func() error {
+		repl, err := s.GetReplica(header.RangeDescriptor.RangeID)
+		if err != nil {
+			return err
+		}
+		desc := *repl.Desc()
+		if !reflect.DeepEqual(desc, header.RangeDescriptor) {
+			return errors.Errorf("%s: descriptor %s doesn't match the delegated one %s",
+				repl, &desc, &header.RangeDescriptor)
+		}
+		// Prohibit premature raft log truncation, as the leaseholder does
+		// when it sends the snapshot itself; see changeReplicas.
+		if err := repl.setPendingSnapshotIndex(1); err != nil {
+			return err
+		}
+		defer repl.clearPendingSnapshotIndex()
+		log.Eventf(ctx, "sending snapshot delegated by %+v to %+v",
+			header.RaftMessageRequest.FromReplica, *header.DelegatedTarget)
+		errs, err := repl.streamPreemptiveSnapshots(
+			ctx, []roachpb.ReplicaDescriptor{*header.DelegatedTarget}, desc)
+		if err != nil {
+			return err
+		}
+		return errs[0]
+	}()
+	if err != nil {
+		return stream.Send(&SnapshotResponse{
+			Status:  SnapshotResponse_ERROR,
+			Message: err.Error(),
+		})
+	}
+	return stream.Send(&SnapshotResponse{Status: SnapshotResponse_APPLIED})
+}
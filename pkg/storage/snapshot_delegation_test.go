@@ -0,0 +1,104 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestPickSnapshotDelegate(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	locality := func(region, zone string) roachpb.Locality {
+		return roachpb.Locality{Tiers: []roachpb.Tier{
+			{Key: "region", Value: region},
+			{Key: "zone", Value: zone},
+		}}
+	}
+	candidate := func(storeID roachpb.StoreID, region, zone string) snapshotDelegateCandidate {
+		return snapshotDelegateCandidate{
+			repDesc:  roachpb.ReplicaDescriptor{NodeID: roachpb.NodeID(storeID), StoreID: storeID},
+			locality: locality(region, zone),
+		}
+	}
+
+	testCases := []struct {
+		sender, target roachpb.Locality
+		candidates     []snapshotDelegateCandidate
+		expected       roachpb.StoreID // 0 if the sender sends the snapshot itself
+	}{
+		// No followers.
+		{locality("us", "a"), locality("eu", "a"), nil, 0},
+		// The sender is in the target's region.
+		{locality("eu", "b"), locality("eu", "a"),
+			[]snapshotDelegateCandidate{candidate(2, "eu", "c")}, 0},
+		// A follower in the target's region.
+		{locality("us", "a"), locality("eu", "a"),
+			[]snapshotDelegateCandidate{candidate(2, "us", "b"), candidate(3, "eu", "b")}, 3},
+		// The follower in the target's zone beats the one in its region.
+		{locality("us", "a"), locality("eu", "a"),
+			[]snapshotDelegateCandidate{candidate(2, "eu", "b"), candidate(3, "eu", "a")}, 3},
+		// Ties go to the first follower.
+		{locality("us", "a"), locality("eu", "a"),
+			[]snapshotDelegateCandidate{candidate(2, "eu", "b"), candidate(3, "eu", "c")}, 2},
+		// Followers no closer than the sender.
+		{locality("us", "a"), locality("eu", "a"),
+			[]snapshotDelegateCandidate{candidate(2, "us", "b"), candidate(3, "ap", "a")}, 0},
+		// Without localities, snapshots are never delegated.
+		{roachpb.Locality{}, roachpb.Locality{},
+			[]snapshotDelegateCandidate{{repDesc: roachpb.ReplicaDescriptor{StoreID: 2}}}, 0},
+	}
+	for i, c := range testCases {
+		delegate, ok := pickSnapshotDelegate(c.sender, c.target, c.candidates)
+		if ok != (c.expected != 0) || delegate.StoreID != c.expected {
+			t.Errorf("%d: expected delegate s%d, got s%d (found=%t)", i, c.expected, delegate.StoreID, ok)
+		}
+	}
+}
+
+func TestRequestDelegatedSnapshot(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	header := SnapshotRequest_Header{
+		RangeDescriptor: roachpb.RangeDescriptor{RangeID: 1},
+		DelegatedTarget: &roachpb.ReplicaDescriptor{NodeID: 3, StoreID: 3},
+	}
+	testCases := []struct {
+		stream   fakeSnapshotStream
+		expected string
+	}{
+		{fakeSnapshotStream{nextResp: &SnapshotResponse{Status: SnapshotResponse_APPLIED}}, ""},
+		{fakeSnapshotStream{nextResp: &SnapshotResponse{
+			Status: SnapshotResponse_ERROR, Message: "descriptor mismatch"}}, "descriptor mismatch"},
+		{fakeSnapshotStream{nextResp: &SnapshotResponse{Status: SnapshotResponse_ACCEPTED}}, "invalid status"},
+		{fakeSnapshotStream{nextErr: errors.New("stream broken")}, "stream broken"},
+	}
+	for i, c := range testCases {
+		err := requestDelegatedSnapshot(c.stream, header)
+		if c.expected == "" {
+			if err != nil {
+				t.Errorf("%d: unexpected error: %s", i, err)
+			}
+		} else if !testutils.IsError(err, c.expected) {
+			t.Errorf("%d: expected error %q, got %v", i, c.expected, err)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/settings"
+)
+
+// Snapshot format versions. The format of a snapshot's data is negotiated
+// when the recipient accepts the snapshot: the sender advertises the highest
+// version it supports and the recipient picks the highest version both of
+// them support. Nodes which predate the negotiation neither advertise nor
+// pick a version, which both sides treat as snapshotFormatKVBatch, so new
+// formats can be introduced without breaking snapshots between the nodes of
+// a cluster in the middle of a rolling upgrade.
+//
+// Format versions are persisted in the wire protocol; they must never be
+// renumbered.
+const (
+	// snapshotFormatKVBatch streams the snapshot's key/value pairs as RocksDB
+	// batch representations of roughly 1MB each. All nodes support it.
+	snapshotFormatKVBatch uint32 = 0
+	// snapshotFormatCompressedKVBatch is snapshotFormatKVBatch with each
+	// batch representation compressed with DEFLATE.
+	snapshotFormatCompressedKVBatch uint32 = 1
+	// snapshotFormatSnappyKVBatch is snapshotFormatKVBatch with each batch
+	// representation compressed with Snappy, which compresses less than
+	// DEFLATE but is several times cheaper in CPU.
+	snapshotFormatSnappyKVBatch uint32 = 2
+
+	// snapshotFormatLatest is the highest format version this node supports.
+	snapshotFormatLatest = snapshotFormatSnappyKVBatch
+)
+
+// snapshotCompression caps the format versions a node offers and picks for
+// the snapshots it sends and receives. Since every format version supersedes
+// the previous ones, limiting it to snapshotFormatKVBatch turns compression
+// off, e.g. for clusters whose nodes are short on CPU rather than network.
+var snapshotCompression = settings.RegisterIntSetting(
+	"kv.snapshot.compression",
+	"the compression of snapshots on the wire (0 = none, 1 = DEFLATE, 2 = Snappy)",
+	int64(snapshotFormatSnappyKVBatch),
+)
+
+// maxSnapshotFormat returns the highest format version this node uses, as
+// capped by kv.snapshot.compression.
+func maxSnapshotFormat() uint32 {
+	max := snapshotCompression.Get()
+	if max < 0 {
+		return snapshotFormatKVBatch
+	}
+	if max > int64(snapshotFormatLatest) {
+		return snapshotFormatLatest
+	}
+	return uint32(max)
+}
+
+// pickSnapshotFormat returns the format version a recipient uses for a
+// snapshot whose sender supports versions up to senderVersion.
+func pickSnapshotFormat(senderVersion uint32) uint32 {
+	if max := maxSnapshotFormat(); senderVersion > max {
+		return max
+	}
+	return senderVersion
+}
+
+// encodeSnapshotBatch returns the representation of a batch of a snapshot's
+// key/value pairs in the given format.
+func encodeSnapshotBatch(format uint32, repr []byte) ([]byte, error) {
+	switch format {
+	case snapshotFormatKVBatch:
+		return repr, nil
+	case snapshotFormatCompressedKVBatch:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(repr); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case snapshotFormatSnappyKVBatch:
+		return snappy.Encode(nil, repr), nil
+	default:
+		return nil, errors.Errorf("unknown snapshot format version %d", format)
+	}
+}
+
+// decodeSnapshotBatch is the inverse of encodeSnapshotBatch.
+func decodeSnapshotBatch(format uint32, data []byte) ([]byte, error) {
+	switch format {
+	case snapshotFormatKVBatch:
+		return data, nil
+	case snapshotFormatCompressedKVBatch:
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case snapshotFormatSnappyKVBatch:
+		return snappy.Decode(nil, data)
+	default:
+		return nil, errors.Errorf("unknown snapshot format version %d", format)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine"
+)
+
+// snapshotSSTIngestion controls whether the receiving store writes the data
+// of a snapshot into an SSTable which it ingests into RocksDB, instead of
+// writing it through the memtable and the write-ahead log. Ingestion writes
+// the data of a large range transfer once rather than several times.
+var snapshotSSTIngestion = settings.RegisterBoolSetting(
+	"kv.snapshot.sst_ingestion.enabled",
+	"apply snapshots by ingesting an SSTable built from their data instead of writing it to the engine in a batch",
+	true,
+)
+
+// canIngestSnapshots returns whether snapshots applied to the engine are
+// ingested as SSTables, which in-memory engines don't support.
+func canIngestSnapshots(eng engine.Engine) bool {
+	if !snapshotSSTIngestion.Get() {
+		return false
+	}
+	_, inMem := eng.(engine.InMem)
+	return !inMem
+}
+
+// snapshotTempDir returns the directory in which the store writes the
+// temporary files of incoming snapshots. It is under the engine's auxiliary
+// directory, so that the files are on the same device as the store's data,
+// and empty, i.e. the OS temp directory, for in-memory engines.
+func snapshotTempDir(eng engine.Engine) (string, error) {
+	aux := eng.GetAuxiliaryDir()
+	if aux == "" {
+		return "", nil
+	}
+	dir := filepath.Join(aux, "snapshots")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.Wrap(err, "unable to create snapshot directory")
+	}
+	return dir, nil
+}
+
+// removeSnapshotTempFiles removes the temporary files of the snapshots which
+// were being received or applied when the store last stopped.
+func removeSnapshotTempFiles(eng engine.Engine) error {
+	if aux := eng.GetAuxiliaryDir(); aux != "" {
+		return os.RemoveAll(filepath.Join(aux, "snapshots"))
+	}
+	return nil
+}
+
+// snapshotSST is a temporary SSTable holding the data of an incoming
+// snapshot.
+type snapshotSST struct {
+	dir  string
+	path string
+	// count is the number of keys in the SSTable.
+	count int
+}
+
+// writeSnapshotSST writes the KV batches of the snapshot into an SSTable in
+// a temporary directory created in dir (see snapshotTempDir), which the
+// caller must remove using close. The
+// batches must only contain puts, in increasing key order, which is how
+// snapshots are sent.
+func writeSnapshotSST(dir string, inSnap IncomingSnapshot) (_ *snapshotSST, err error) {
+	dir, err = ioutil.TempDir(dir, "cockroach-snapshot-sst")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create snapshot SSTable directory")
+	}
+	sst := &snapshotSST{dir: dir, path: filepath.Join(dir, "snapshot.sst")}
+	defer func() {
+		if err != nil {
+			sst.close()
+		}
+	}()
+
+	fw := engine.MakeRocksDBSstFileWriter()
+	add := func(repr []byte) error {
+		r, err := engine.NewRocksDBBatchReader(repr)
+		if err != nil {
+			return err
+		}
+		for r.Next() {
+			if typ := r.BatchType(); typ != engine.BatchTypeValue {
+				return errors.Errorf("unexpected snapshot batch record type %d", typ)
+			}
+			if err := fw.Add(engine.MVCCKeyValue{Key: r.Key(), Value: r.Value()}); err != nil {
+				return err
+			}
+			sst.count++
+		}
+		return r.Error()
+	}
+	if err := func() error {
+		if err := fw.Open(sst.path); err != nil {
+			return err
+		}
+		return inSnap.iterateBatches(add)
+	}(); err != nil {
+		_ = fw.Close()
+		return nil, err
+	}
+	// An SSTable without keys can't be finished, but then there is nothing
+	// to ingest either. Snapshots always contain the range descriptor.
+	if err := fw.Close(); err != nil && sst.count > 0 {
+		return nil, err
+	}
+	return sst, nil
+}
+
+// ingest ingests the SSTable into the engine, unless it is empty.
+func (s *snapshotSST) ingest(eng engine.Engine) error {
+	if s.count == 0 {
+		return nil
+	}
+	return eng.IngestExternalFile(s.path)
+}
+
+// close removes the SSTable and its directory.
+func (s *snapshotSST) close() {
+	_ = os.RemoveAll(s.dir)
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+func TestWriteSnapshotSST(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	eng := engine.NewInMem(roachpb.Attributes{}, 1<<20, stopper)
+
+	// In-memory engines can't ingest snapshots.
+	if canIngestSnapshots(eng) {
+		t.Fatal("expected in-memory engines not to ingest snapshots")
+	}
+
+	// Build a snapshot of three batches, the last of which is spilled.
+	var expected []engine.MVCCKeyValue
+	var inSnap IncomingSnapshot
+	spill, err := newSnapshotSpill("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.close()
+	for i := 0; i < 3; i++ {
+		b := eng.NewBatch()
+		for j := 0; j < 10; j++ {
+			kv := engine.MVCCKeyValue{
+				Key: engine.MVCCKey{
+					Key:       roachpb.Key(fmt.Sprintf("%d%02d", i, j)),
+					Timestamp: hlc.Timestamp{WallTime: int64(j)},
+				},
+				Value: []byte(fmt.Sprintf("value %d-%d", i, j)),
+			}
+			if err := b.Put(kv.Key, kv.Value); err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, kv)
+		}
+		if i < 2 {
+			inSnap.Batches = append(inSnap.Batches, b.Repr())
+		} else if err := spill.add(b.Repr()); err != nil {
+			t.Fatal(err)
+		}
+		b.Close()
+	}
+	inSnap.spill = spill
+
+	sst, err := writeSnapshotSST("", inSnap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sst.close()
+	if sst.count != len(expected) {
+		t.Fatalf("expected %d keys in the SSTable, got %d", len(expected), sst.count)
+	}
+
+	reader, err := engine.MakeRocksDBSstFileReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if err := reader.AddFile(sst.path); err != nil {
+		t.Fatal(err)
+	}
+	var kvs []engine.MVCCKeyValue
+	if err := reader.Iterate(
+		engine.MVCCKey{Key: keys.MinKey}, engine.MVCCKey{Key: keys.MaxKey},
+		func(kv engine.MVCCKeyValue) (bool, error) {
+			kvs = append(kvs, kv)
+			return false, nil
+		},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(expected, kvs) {
+		t.Fatalf("expected %v, got %v", expected, kvs)
+	}
+
+	sst.close()
+	if _, err := os.Stat(sst.dir); !os.IsNotExist(err) {
+		t.Errorf("expected the SSTable directory to be removed, got %v", err)
+	}
+
+	// Snapshots must be sent in key order.
+	unordered := IncomingSnapshot{Batches: [][]byte{inSnap.Batches[1], inSnap.Batches[0]}}
+	if _, err := writeSnapshotSST("", unordered); err == nil {
+		t.Fatal("expected an error writing an SSTable from unordered batches")
+	}
+
+	defer settings.TestingSetBool(snapshotSSTIngestion, false)()
+	if canIngestSnapshots(nil) {
+		t.Fatal("expected snapshots not to be ingested with the setting disabled")
+	}
+}
+
+func TestSnapshotTempDir(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+
+	// In-memory engines use the OS temp directory.
+	if dir, err := snapshotTempDir(engine.NewInMem(roachpb.Attributes{}, 1<<20, stopper)); err != nil {
+		t.Fatal(err)
+	} else if dir != "" {
+		t.Fatalf("expected the OS temp directory, got %s", dir)
+	}
+
+	base, err := ioutil.TempDir("", "TestSnapshotTempDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(base); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	eng := engine.NewRocksDB(roachpb.Attributes{}, base, engine.RocksDBCache{},
+		0, engine.DefaultMaxOpenFiles, stopper)
+
+	// Temporary files are written under the store's directory, and removed
+	// when the store starts.
+	dir, err := snapshotTempDir(eng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rel, err := filepath.Rel(base, dir); err != nil || rel != filepath.Join("auxiliary", "snapshots") {
+		t.Fatalf("expected a directory under %s, got %s", base, dir)
+	}
+	sst, err := writeSnapshotSST(dir, IncomingSnapshot{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := removeSnapshotTempFiles(eng); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sst.dir); !os.IsNotExist(err) {
+		t.Errorf("expected the snapshot files to be removed, got %v", err)
+	}
+}
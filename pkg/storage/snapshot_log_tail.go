@@ -0,0 +1,85 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"github.com/coreos/etcd/raft/raftpb"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
+)
+
+// snapshotLogTailMaxSize bounds the raft log tail which accompanies a
+// preemptive snapshot. By the time the snapshot of a hot range has been
+// streamed, the range has committed many more commands; sending them along
+// with the snapshot lets the new replica join the range nearly caught up
+// instead of having to be sent all of them by raft, or even a raft snapshot
+// if the log is truncated in the meantime.
+var snapshotLogTailMaxSize = settings.RegisterIntSetting(
+	"kv.snapshot_preemptive.log_tail_max_size",
+	"maximum size, in bytes, of the raft log entries committed while a preemptive snapshot is streamed "+
+		"which are sent along with it; 0 disables sending them",
+	16<<20, // 16 MiB
+)
+
+// snapshotLogTail returns the raft log entries of the replica from index lo
+// up to its commit index, bounded by snapshotLogTailMaxSize. It returns no
+// entries if the log was truncated past lo: the tail must directly follow
+// the log entries of the snapshot.
+//
+// Only committed entries are returned, since they are part of the log of
+// every replica which catches up past them; an uncommitted entry could be
+// replaced by another leader.
+func (r *Replica) snapshotLogTail(ctx context.Context, lo uint64) ([][]byte, error) {
+	maxSize := snapshotLogTailMaxSize.Get()
+	if maxSize <= 0 {
+		return nil, nil
+	}
+	raftStatus := r.RaftStatus()
+	if raftStatus == nil || raftStatus.Commit < lo {
+		return nil, nil
+	}
+	hi := raftStatus.Commit + 1
+
+	var entries [][]byte
+	var size int64
+	if err := iterateEntries(ctx, r.store.Engine(), r.RangeID, lo, hi, func(kv roachpb.KeyValue) (bool, error) {
+		bytes, err := kv.Value.GetBytes()
+		if err != nil {
+			return false, err
+		}
+		if size += int64(len(bytes)); size > maxSize {
+			return true, nil
+		}
+		entries = append(entries, bytes)
+		return false, nil
+	}); err != nil {
+		return nil, err
+	}
+	// The log may have been truncated past lo since the snapshot was taken.
+	// Truncations only remove a prefix of the log, so the entries read are
+	// contiguous and only the first one needs checking.
+	if len(entries) > 0 {
+		var first raftpb.Entry
+		if err := first.Unmarshal(entries[0]); err != nil {
+			return nil, err
+		}
+		if first.Index != lo {
+			return nil, nil
+		}
+	}
+	return entries, nil
+}
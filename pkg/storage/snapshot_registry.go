@@ -0,0 +1,71 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// snapshotTarget identifies the recipient of a snapshot of a range.
+type snapshotTarget struct {
+	rangeID roachpb.RangeID
+	storeID roachpb.StoreID
+}
+
+// inFlightSnapshots is the registry of the snapshots a store is sending.
+// Raft and the replicate queue decide independently to send a snapshot of
+// a range to a store, and only the first of them to register proceeds, so
+// that the recipient doesn't receive the same data twice.
+type inFlightSnapshots struct {
+	mu struct {
+		syncutil.Mutex
+		targets map[snapshotTarget]struct{}
+	}
+}
+
+func newInFlightSnapshots() *inFlightSnapshots {
+	s := &inFlightSnapshots{}
+	s.mu.targets = make(map[snapshotTarget]struct{})
+	return s
+}
+
+// register registers snapshots of the range to each of the stores, and
+// returns the function unregistering them once they are done with. If a
+// snapshot of the range to any of the stores is already in flight, none is
+// registered and an error is returned.
+func (s *inFlightSnapshots) register(
+	rangeID roachpb.RangeID, storeIDs ...roachpb.StoreID,
+) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, storeID := range storeIDs {
+		if _, ok := s.mu.targets[snapshotTarget{rangeID, storeID}]; ok {
+			return nil, errors.Errorf("r%d: a snapshot to s%d is already in flight", rangeID, storeID)
+		}
+	}
+	for _, storeID := range storeIDs {
+		s.mu.targets[snapshotTarget{rangeID, storeID}] = struct{}{}
+	}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, storeID := range storeIDs {
+			delete(s.mu.targets, snapshotTarget{rangeID, storeID})
+		}
+	}, nil
+}
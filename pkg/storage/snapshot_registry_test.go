@@ -0,0 +1,56 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestInFlightSnapshots(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	s := newInFlightSnapshots()
+	done, err := s.register(1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second snapshot of the range to either store doesn't proceed, and
+	// doesn't register the other stores either.
+	if _, err := s.register(1, 4, 3); !testutils.IsError(err, "r1: a snapshot to s3 is already in flight") {
+		t.Fatalf("expected in-flight snapshot error, got %v", err)
+	}
+	doneOther, err := s.register(1, 4)
+	if err != nil {
+		t.Fatalf("expected a snapshot to s4 to proceed: %s", err)
+	}
+	doneOther()
+
+	// Snapshots of other ranges to the same stores proceed.
+	doneOther, err = s.register(2, 2, 3)
+	if err != nil {
+		t.Fatalf("expected a snapshot of another range to proceed: %s", err)
+	}
+	doneOther()
+
+	done()
+	if done, err = s.register(1, 2, 3); err != nil {
+		t.Fatalf("expected a snapshot to proceed once the previous one is done: %s", err)
+	}
+	done()
+}
@@ -0,0 +1,157 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+)
+
+// snapshotSpillThreshold is the size of the KV batches of an incoming
+// snapshot which are held in memory. The following batches are spilled to a
+// temporary file as they are received and read back one at a time when the
+// snapshot is applied, so that neither receiving nor applying the snapshot
+// of a large range exhausts the memory of the store.
+var snapshotSpillThreshold = envutil.EnvOrDefaultBytes(
+	"COCKROACH_SNAPSHOT_SPILL_THRESHOLD", 32<<20)
+
+// snapshotSpill holds the KV batches of an incoming snapshot which were
+// spilled to a temporary file. Each batch is written prefixed by its length.
+type snapshotSpill struct {
+	file  *os.File
+	w     *bufio.Writer
+	count int
+}
+
+// newSnapshotSpill creates a spill file in dir (see snapshotTempDir).
+func newSnapshotSpill(dir string) (*snapshotSpill, error) {
+	file, err := ioutil.TempFile(dir, "cockroach-snapshot")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create snapshot spill file")
+	}
+	return &snapshotSpill{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// add appends the batch to the spill file.
+func (s *snapshotSpill) add(repr []byte) error {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(len(repr)))
+	if _, err := s.w.Write(buf[:n]); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(repr); err != nil {
+		return err
+	}
+	s.count++
+	return nil
+}
+
+// len returns the number of batches in the spill file. It is zero for a nil
+// snapshotSpill.
+func (s *snapshotSpill) len() int {
+	if s == nil {
+		return 0
+	}
+	return s.count
+}
+
+// iterate calls f with each of the spilled batches, in the order they were
+// added. The batch passed to f is only valid until f returns.
+func (s *snapshotSpill) iterate(f func(repr []byte) error) error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(s.file)
+	var repr []byte
+	for i := 0; i < s.count; i++ {
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read spilled snapshot batch %d", i)
+		}
+		if uint64(cap(repr)) < size {
+			repr = make([]byte, size)
+		}
+		repr = repr[:size]
+		if _, err := io.ReadFull(r, repr); err != nil {
+			return errors.Wrapf(err, "unable to read spilled snapshot batch %d", i)
+		}
+		if err := f(repr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close closes and removes the spill file.
+func (s *snapshotSpill) close() {
+	_ = s.file.Close()
+	_ = os.Remove(s.file.Name())
+}
+
+// iterateBatches calls f with each of the KV batches of the snapshot, those
+// held in memory followed by those which were spilled.
+func (s IncomingSnapshot) iterateBatches(f func(repr []byte) error) error {
+	for _, repr := range s.Batches {
+		if err := f(repr); err != nil {
+			return err
+		}
+	}
+	if s.spill != nil {
+		return s.spill.iterate(f)
+	}
+	return nil
+}
+
+// applySnapshotBatch commits the KV batch of a snapshot to the engine on its
+// own, except for the versions of the range descriptor, which are written to
+// descBatch instead.
+func applySnapshotBatch(
+	eng engine.Engine, descBatch engine.Batch, descKey roachpb.Key, repr []byte,
+) error {
+	r, err := engine.NewRocksDBBatchReader(repr)
+	if err != nil {
+		return err
+	}
+	batch := eng.NewBatch()
+	defer batch.Close()
+	for r.Next() {
+		if typ := r.BatchType(); typ != engine.BatchTypeValue {
+			return errors.Errorf("unexpected snapshot batch record type %d", typ)
+		}
+		var w engine.Writer = batch
+		if r.Key().Key.Equal(descKey) {
+			w = descBatch
+		}
+		if err := w.Put(r.Key(), r.Value()); err != nil {
+			return err
+		}
+	}
+	if err := r.Error(); err != nil {
+		return err
+	}
+	return batch.Commit()
+}
@@ -0,0 +1,137 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+func TestSnapshotSpill(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	spill, err := newSnapshotSpill("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	batches := [][]byte{
+		[]byte("a"),
+		{},
+		bytes.Repeat([]byte("b"), 1<<16),
+		[]byte("c"),
+	}
+	for _, repr := range batches {
+		if err := spill.add(repr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if l := spill.len(); l != len(batches) {
+		t.Fatalf("expected %d spilled batches, got %d", len(batches), l)
+	}
+
+	// The batches can be read back several times, e.g. if the application of
+	// the snapshot is retried.
+	for pass := 0; pass < 2; pass++ {
+		var i int
+		if err := spill.iterate(func(repr []byte) error {
+			if !bytes.Equal(repr, batches[i]) {
+				t.Errorf("%d: batch %d: expected %d bytes, got %d", pass, i, len(batches[i]), len(repr))
+			}
+			i++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if i != len(batches) {
+			t.Errorf("%d: expected %d batches, got %d", pass, len(batches), i)
+		}
+	}
+
+	name := spill.file.Name()
+	spill.close()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("expected the spill file to be removed, got %v", err)
+	}
+}
+
+func TestApplySnapshotBatch(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	eng := engine.NewInMem(roachpb.Attributes{}, 1<<20, stopper)
+
+	descKey := keys.RangeDescriptorKey(roachpb.RKey("a"))
+	kvs := []engine.MVCCKeyValue{
+		{Key: engine.MVCCKey{Key: descKey, Timestamp: hlc.Timestamp{WallTime: 1}}, Value: []byte("desc")},
+		{Key: engine.MVCCKey{Key: roachpb.Key("a")}, Value: []byte("a")},
+		{Key: engine.MVCCKey{Key: roachpb.Key("b")}, Value: []byte("b")},
+	}
+	b := eng.NewBatch()
+	for _, kv := range kvs {
+		if err := b.Put(kv.Key, kv.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repr := b.Repr()
+	b.Close()
+
+	descBatch := eng.NewBatch()
+	defer descBatch.Close()
+	if err := applySnapshotBatch(eng, descBatch, descKey, repr); err != nil {
+		t.Fatal(err)
+	}
+
+	// The batch is committed, except for the range descriptor which is only
+	// written once descBatch is.
+	for _, kv := range kvs {
+		v, err := eng.Get(kv.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isDesc := kv.Key.Key.Equal(descKey); isDesc != (v == nil) {
+			t.Errorf("%s: unexpected value %q before committing the descriptor", kv.Key, v)
+		}
+	}
+	if err := descBatch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range kvs {
+		if v, err := eng.Get(kv.Key); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(v, kv.Value) {
+			t.Errorf("%s: expected %q, got %q", kv.Key, kv.Value, v)
+		}
+	}
+
+	// Snapshot batches only contain puts.
+	b = eng.NewBatch()
+	if err := b.Clear(engine.MVCCKey{Key: roachpb.Key("a")}); err != nil {
+		t.Fatal(err)
+	}
+	repr = b.Repr()
+	b.Close()
+	if err := applySnapshotBatch(eng, descBatch, descKey, repr); err == nil {
+		t.Fatal("expected an error applying a batch with a deletion")
+	}
+}
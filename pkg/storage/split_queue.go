@@ -53,12 +53,15 @@ func newSplitQueue(store *Store, db *client.DB, gossip *gossip.Gossip) *splitQue
 		"split", sq, store, gossip,
 		queueConfig{
 			maxSize:              splitQueueMaxSize,
+			enabled:              splitQueueEnabled,
 			needsLease:           true,
 			acceptsUnsplitRanges: true,
 			successes:            store.metrics.SplitQueueSuccesses,
 			failures:             store.metrics.SplitQueueFailures,
 			pending:              store.metrics.SplitQueuePending,
 			processingNanos:      store.metrics.SplitQueueProcessingNanos,
+			purgatory:            store.metrics.SplitQueuePurgatory,
+			processingLatency:    store.metrics.SplitQueueProcessingLatency,
 		},
 	)
 	return sq
@@ -89,6 +92,10 @@ func (sq *splitQueue) shouldQueue(
 		priority += ratio
 		shouldQ = true
 	}
+	if shouldQ {
+		// Among the ranges which need splitting, split the busiest first.
+		priority += rng.Load().priority()
+	}
 	return
 }
 
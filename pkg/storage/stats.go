@@ -17,6 +17,8 @@
 package storage
 
 import (
+	"golang.org/x/net/context"
+
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
@@ -41,3 +43,32 @@ func ComputeStatsForRange(
 	}
 	return ms, nil
 }
+
+// computeChecksumStats returns the MVCCStats persisted in the given snapshot
+// of the range's data, along with the stats recomputed from the data as of the
+// time the persisted stats were last updated.
+func computeChecksumStats(
+	ctx context.Context, desc roachpb.RangeDescriptor, snap engine.Reader,
+) (enginepb.MVCCStats, enginepb.MVCCStats, error) {
+	persisted, err := loadMVCCStats(ctx, snap, desc.RangeID)
+	if err != nil {
+		return enginepb.MVCCStats{}, enginepb.MVCCStats{}, err
+	}
+	recomputed, err := ComputeStatsForRange(&desc, snap, persisted.LastUpdateNanos)
+	if err != nil {
+		return enginepb.MVCCStats{}, enginepb.MVCCStats{}, err
+	}
+	return persisted, recomputed, nil
+}
+
+// statsDiffer returns whether the two stats disagree once aged to the same
+// time. The system counts are disregarded as they include the range stats key
+// itself, whose size the persisted stats don't keep track of, and so is the
+// ContainsEstimates flag, which a recomputation cannot clear.
+func statsDiffer(a, b enginepb.MVCCStats) bool {
+	a.AgeTo(b.LastUpdateNanos)
+	b.AgeTo(a.LastUpdateNanos)
+	a.SysBytes, a.SysCount, a.ContainsEstimates = 0, 0, false
+	b.SysBytes, b.SysCount, b.ContainsEstimates = 0, 0, false
+	return a != b
+}
@@ -18,9 +18,20 @@ package storagebase
 
 import (
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"golang.org/x/net/context"
 )
 
+// MaxCommandSize is the maximum size of a Raft command. Larger commands cause
+// followers to run out of memory and stall the Raft log, so the DistSender
+// splits write batches which would exceed it, and replicas refuse to propose
+// commands which still do.
+var MaxCommandSize = settings.RegisterIntSetting(
+	"kv.raft.command.max_size",
+	"maximum size of a raft command; larger write batches are split and unsplittable ones rejected; 0 disables the limit",
+	64<<20, // 64 MiB
+)
+
 // CmdIDKey is a Raft command id.
 type CmdIDKey string
 
@@ -22,6 +22,7 @@ import (
 	"math"
 	"math/rand"
 	"runtime"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -40,6 +41,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/internal/client"
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlutil"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
@@ -88,6 +90,10 @@ const (
 	replicaRequestQueueSize = 100
 
 	defaultStoreMutexWarnThreshold = 100 * time.Millisecond
+
+	// storeLoadTimescale is the timescale of the moving averages used to
+	// compute the queries and writes per second gossiped by a store.
+	storeLoadTimescale = time.Minute
 )
 
 var changeTypeInternalToRaft = map[roachpb.ReplicaChangeType]raftpb.ConfChangeType{
@@ -98,6 +104,69 @@ var changeTypeInternalToRaft = map[roachpb.ReplicaChangeType]raftpb.ConfChangeTy
 var storeSchedulerConcurrency = envutil.EnvOrDefaultInt(
 	"COCKROACH_SCHEDULER_CONCURRENCY", 2*runtime.NumCPU())
 
+// storeRaftTickBatchSize is the default for StoreConfig.RaftTickBatchSize.
+var storeRaftTickBatchSize = envutil.EnvOrDefaultInt(
+	"COCKROACH_RAFT_TICK_BATCH_SIZE", 0)
+
+// gossipCapacityChangeThreshold is the relative change in a store's range
+// count or fraction of capacity used, since its descriptor was last
+// gossiped, which causes the descriptor to be gossiped again before the
+// next periodic gossip.
+var gossipCapacityChangeThreshold = settings.RegisterFloatSetting(
+	"kv.store_gossip.capacity_delta_fraction",
+	"fraction by which a store's range count or fraction of capacity used must change "+
+		"since it was last gossiped for it to be gossiped again early; 0 disables",
+	0.05,
+)
+
+// gossipCapacityChangeMinInterval is the minimum time between the gossip of a
+// store's descriptor and an early gossip due to a change in its capacity. It
+// damps early gossip so that a store whose capacity changes quickly, e.g.
+// during a bulk ingestion, doesn't flood the gossip network.
+var gossipCapacityChangeMinInterval = settings.RegisterDurationSetting(
+	"kv.store_gossip.capacity_change_min_interval",
+	"minimum time between two gossips of a store's descriptor caused by changes in its capacity",
+	time.Second,
+)
+
+// snapshotMaxRate is the rate at which a store streams a snapshot to another
+// store. Besides sparing the foreground traffic of both stores, it lets the
+// StorePool estimate how long recovering the replicas of a dead store takes.
+var snapshotMaxRate = settings.RegisterIntSetting(
+	"kv.snapshot.max_rate",
+	"maximum rate, in bytes per second, at which a snapshot is streamed to another store; 0 disables the limit",
+	8<<20, // 8 MiB/s
+)
+
+// rebalanceSnapshotMaxRate and recoverySnapshotMaxRate limit the rate of the
+// snapshots sent respectively to rebalance replicas, and to recover missing
+// replicas or catch up replicas which fell behind. Rebalancing isn't urgent,
+// so it is limited more strictly by default so as not to saturate the
+// network and disks of the stores. Zero defers to kv.snapshot.max_rate.
+var (
+	rebalanceSnapshotMaxRate = settings.RegisterIntSetting(
+		"kv.snapshot_rebalance.max_rate",
+		"maximum rate, in bytes per second, at which a rebalancing snapshot is streamed; 0 defers to kv.snapshot.max_rate",
+		2<<20, // 2 MiB/s
+	)
+	recoverySnapshotMaxRate = settings.RegisterIntSetting(
+		"kv.snapshot_recovery.max_rate",
+		"maximum rate, in bytes per second, at which a recovery or raft snapshot is streamed; 0 defers to kv.snapshot.max_rate",
+		0,
+	)
+)
+
+// deadReplicasMaxGossiped is the maximum number of dead replicas a store
+// gossips at once. A store with mass corruption can have a dead replica for
+// most of its ranges; gossiping them all at once would bloat the gossip
+// network.
+var deadReplicasMaxGossiped = settings.RegisterIntSetting(
+	"kv.dead_replicas.max_gossiped",
+	"maximum number of dead replicas a store gossips at once; a store with more dead replicas "+
+		"gossips them in pages, starting with those of the ranges closest to losing quorum; 0 disables the limit",
+	1000,
+)
+
 // RaftElectionTimeout returns the raft election timeout, as computed
 // from the specified tick interval and number of election timeout
 // ticks. If raftElectionTimeoutTicks is 0, uses the value of
@@ -127,6 +196,11 @@ func RangeLeaseDurations(
 var enableCoalescedHeartbeats = envutil.EnvOrDefaultBool(
 	"COCKROACH_ENABLE_COALESCED_HEARBEATS", true)
 
+// defaultMaxReplicasPerStore is the maximum number of replicas a store will
+// hold before declining new ones. Zero means unlimited.
+var defaultMaxReplicasPerStore = envutil.EnvOrDefaultInt(
+	"COCKROACH_MAX_REPLICAS_PER_STORE", 0)
+
 // TestStoreConfig has some fields initialized with values relevant in tests.
 func TestStoreConfig() StoreConfig {
 	return StoreConfig{
@@ -332,6 +406,36 @@ type Store struct {
 	metrics                 *StoreMetrics
 	intentResolver          *intentResolver
 	raftEntryCache          *raftEntryCache
+	jobs                    *storeJobRegistry  // Long-running operations on the store
+	replicaMovements        *replicaMovements  // Snapshots being streamed
+	snapshotsInFlight       *inFlightSnapshots // Snapshots being sent, by range and recipient
+
+	// queryRate and writeRate track exponentially weighted moving averages of
+	// the batches (respectively the write batches) served by this store. They
+	// are gossiped as part of the store's capacity for load-based rebalancing.
+	// Batches marked as COLD by their client are left out of both.
+	queryRate *metric.Rate
+	writeRate *metric.Rate
+	// remoteQueryRate tracks the part of queryRate sent by gateways in other
+	// regions, as told by gatewayRegions. It is gossiped so that the
+	// rebalancer can weigh the latency saved by moving leases closer to their
+	// clients.
+	remoteQueryRate *metric.Rate
+	gatewayRegions  *gatewayRegions
+	// latencyRate tracks the time spent serving batches, in nanoseconds per
+	// second. Divided by queryRate, it yields the mean latency of a batch,
+	// which is gossiped for diagnostic purposes.
+	latencyRate *metric.Rate
+	// overload tracks the store's overload score, which is gossiped as part
+	// of its capacity; see storeOverload.
+	overload storeOverload
+
+	// raftLogBackpressure delays writes when the raft logs on this store grow
+	// faster than they are truncated.
+	raftLogBackpressure *raftLogBackpressure
+	// queuePacing paces the work of the replicate, GC and raft log queues and
+	// the snapshots sent by the store.
+	queuePacing queuePacing
 
 	coalescedMu struct {
 		syncutil.Mutex
@@ -366,6 +470,42 @@ type Store struct {
 	// has likely improved).
 	drainLeases atomic.Value
 
+	// readOnly holds a bool which indicates whether the store is in read-only
+	// mode; see SetReadOnly().
+	readOnly atomic.Value
+
+	// gossipedCapacity is the capacity in the store descriptor most recently
+	// gossiped, against which changes are measured to decide whether to
+	// gossip early; see maybeGossipOnCapacityChange.
+	// deadReplicasGossips counts the gossips of the store's dead replicas,
+	// to page through them when they don't fit in a single gossip; see
+	// GossipDeadReplicas. Accessed atomically.
+	deadReplicasGossips uint32
+
+	gossipedCapacity struct {
+		syncutil.Mutex
+		gossiped     bool
+		at           time.Time
+		rangeCount   int32
+		fractionUsed float64
+		// reservationsExhausted is whether the store declined new snapshots
+		// for lack of reservation budget.
+		reservationsExhausted bool
+		// overloaded is whether the store was overloaded.
+		overloaded bool
+	}
+	// attrsOverride holds the attributes and locality set by
+	// UpdateAttributes, which replace the ones the store was started with
+	// until the node restarts.
+	attrsOverride struct {
+		syncutil.Mutex
+		attrs    *roachpb.Attributes
+		locality *roachpb.Locality
+	}
+	// This is 1 while an early gossip of the store descriptor is pending. This
+	// field must be checked and set atomically.
+	gossipOnCapacityChangePending int32
+
 	// Locking notes: To avoid deadlocks, the following lock order must be
 	// obeyed: Replica.raftMu < < Replica.readOnlyCmdMu < Store.mu.Mutex <
 	// Replica.mu.Mutex < Store.scheduler.mu. (It is not required to acquire
@@ -509,6 +649,11 @@ type StoreConfig struct {
 	// maintenance queue to dispatch individual maintenance tasks.
 	TimeSeriesDataStore TimeSeriesDataStore
 
+	// EphemeralEngines are the engines whose stores only hold non-essential
+	// data. Such stores advertise themselves as ephemeral in their
+	// descriptors, and the allocator never places replicas on them.
+	EphemeralEngines map[engine.Engine]struct{}
+
 	// RangeRetryOptions are the retry options when retryable errors are
 	// encountered sending commands to ranges.
 	RangeRetryOptions retry.Options
@@ -554,6 +699,10 @@ type StoreConfig struct {
 	// stores.
 	ScanMaxIdleTime time.Duration
 
+	// ScanMinIdleTime is the minimum time the scanner will be idle between
+	// ranges, unless ScanMaxIdleTime is lower.
+	ScanMinIdleTime time.Duration
+
 	// ConsistencyCheckInterval is the default time period in between consecutive
 	// consistency checks on a range.
 	ConsistencyCheckInterval time.Duration
@@ -562,6 +711,11 @@ type StoreConfig struct {
 	// replication consistency check failure.
 	ConsistencyCheckPanicOnFailure bool
 
+	// DisabledQueues names the store queues, and possibly the replica
+	// scanner, which are disabled when the store starts. See QueueNames for
+	// the valid names.
+	DisabledQueues []string
+
 	// AllocatorOptions configures how the store will attempt to rebalance its
 	// replicas to other stores.
 	AllocatorOptions AllocatorOptions
@@ -579,6 +733,23 @@ type StoreConfig struct {
 	// shared by all Raft groups managed by the store.
 	RaftEntryCacheSize uint64
 
+	// RaftSchedulerWorkers is the number of goroutines the store uses to
+	// process Raft ticks, messages and ready state. Defaults to twice the
+	// number of CPUs.
+	RaftSchedulerWorkers int
+
+	// RaftTickBatchSize is the number of ranges whose ticks are queued on the
+	// Raft scheduler at a time. Workers are woken after each batch, so smaller
+	// batches let processing of the first ranges overlap with queueing the
+	// rest. Zero queues all of the store's ranges in a single batch.
+	RaftTickBatchSize int
+
+	// MaxReplicas is the maximum number of replicas the store will hold. Once
+	// reached, the store declines preemptive snapshots for new replicas and
+	// advertises itself as full so that the allocator skips it. Zero means
+	// unlimited.
+	MaxReplicas int
+
 	TestingKnobs StoreTestingKnobs
 
 	// RangeLeaseActiveDuration is the duration of the active period of leader
@@ -602,7 +773,7 @@ type StoreTestingKnobs struct {
 	// ReplayProtectionFilterWrapper.
 	TestingCommandFilter storagebase.ReplicaCommandFilter
 	// If non-nil, BadChecksumPanic is called by CheckConsistency() instead of
-	// panicking on a checksum mismatch.
+	// terminating the inconsistent replicas on a checksum mismatch.
 	BadChecksumPanic func(roachpb.StoreIdent)
 	// If non-nil, BadChecksumReportDiff is called by CheckConsistency() on a
 	// checksum mismatch to report the diff between snapshots.
@@ -645,6 +816,11 @@ type StoreTestingKnobs struct {
 	// NumKeysEvaluatedForRangeIntentResolution is set by the stores to the
 	// number of keys evaluated for range intent resolution.
 	NumKeysEvaluatedForRangeIntentResolution *int64
+	// AllocatorRandSeed, if non-zero, seeds the random number generator of
+	// the store's allocator, overriding AllocatorOptions.RandSeed. Failures
+	// of tests which depend on replica placement can be replayed by setting
+	// it to the seed logged by the failed run.
+	AllocatorRandSeed int64
 }
 
 var _ base.ModuleTestingKnobs = &StoreTestingKnobs{}
@@ -689,6 +865,15 @@ func (sc *StoreConfig) SetDefaults() {
 	if sc.RaftEntryCacheSize == 0 {
 		sc.RaftEntryCacheSize = defaultRaftEntryCacheSize
 	}
+	if sc.MaxReplicas == 0 {
+		sc.MaxReplicas = defaultMaxReplicasPerStore
+	}
+	if sc.RaftSchedulerWorkers == 0 {
+		sc.RaftSchedulerWorkers = storeSchedulerConcurrency
+	}
+	if sc.RaftTickBatchSize == 0 {
+		sc.RaftTickBatchSize = storeRaftTickBatchSize
+	}
 
 	rangeLeaseActiveDuration, rangeLeaseRenewalDuration :=
 		RangeLeaseDurations(time.Duration(sc.RaftElectionTimeoutTicks) * sc.RaftTickInterval)
@@ -708,19 +893,34 @@ func NewStore(cfg StoreConfig, eng engine.Engine, nodeDesc *roachpb.NodeDescript
 	if !cfg.Valid() {
 		panic(fmt.Sprintf("invalid store configuration: %+v", &cfg))
 	}
+	if seed := cfg.TestingKnobs.AllocatorRandSeed; seed != 0 {
+		cfg.AllocatorOptions.RandSeed = seed
+	}
 	s := &Store{
-		cfg:       cfg,
-		db:        cfg.DB, // TODO(tschottdorf) remove redundancy.
-		engine:    eng,
-		allocator: MakeAllocator(cfg.StorePool, cfg.AllocatorOptions),
-		nodeDesc:  nodeDesc,
-		metrics:   newStoreMetrics(cfg.MetricsSampleInterval),
+		cfg:         cfg,
+		db:          cfg.DB, // TODO(tschottdorf) remove redundancy.
+		engine:      eng,
+		allocator:   MakeAllocator(cfg.StorePool, cfg.AllocatorOptions),
+		nodeDesc:    nodeDesc,
+		metrics:     newStoreMetrics(cfg.MetricsSampleInterval),
+		queryRate:   metric.NewRate(storeLoadTimescale),
+		writeRate:   metric.NewRate(storeLoadTimescale),
+		latencyRate: metric.NewRate(storeLoadTimescale),
+
+		remoteQueryRate: metric.NewRate(storeLoadTimescale),
+		gatewayRegions:  newGatewayRegions(),
+
+		raftLogBackpressure: newRaftLogBackpressure(),
+		jobs:                newStoreJobRegistry(),
+		replicaMovements:    newReplicaMovements(),
+		snapshotsInFlight:   newInFlightSnapshots(),
 	}
-
 	s.intentResolver = newIntentResolver(s)
 	s.raftEntryCache = newRaftEntryCache(cfg.RaftEntryCacheSize)
 	s.drainLeases.Store(false)
-	s.scheduler = newRaftScheduler(s.cfg.AmbientCtx, s.metrics, s, storeSchedulerConcurrency)
+	s.readOnly.Store(false)
+	s.scheduler = newRaftScheduler(
+		s.cfg.AmbientCtx, s.metrics, s, s.cfg.RaftSchedulerWorkers, s.cfg.RaftTickBatchSize)
 
 	storeMuLogger := syncutil.ThresholdLogger(
 		s.AnnotateCtx(context.Background()),
@@ -748,10 +948,14 @@ func NewStore(cfg StoreConfig, eng engine.Engine, nodeDesc *roachpb.NodeDescript
 	s.mu.Unlock()
 
 	if s.cfg.Gossip != nil {
+		s.registerGatewayRegions(s.cfg.Gossip)
+
 		// Add range scanner and configure with queues.
 		s.scanner = newReplicaScanner(
-			s.cfg.AmbientCtx, cfg.ScanInterval, cfg.ScanMaxIdleTime, newStoreReplicaVisitor(s),
+			s.cfg.AmbientCtx, cfg.ScanInterval, cfg.ScanMaxIdleTime, cfg.ScanMinIdleTime,
+			newStoreReplicaVisitor(s),
 		)
+		s.scanner.enabled = scannerEnabled
 		s.gcQueue = newGCQueue(s, s.cfg.Gossip)
 		s.splitQueue = newSplitQueue(s, s.db, s.cfg.Gossip)
 		s.replicateQueue = newReplicateQueue(
@@ -763,7 +967,7 @@ func NewStore(cfg StoreConfig, eng engine.Engine, nodeDesc *roachpb.NodeDescript
 
 		// Add consistency check scanner.
 		s.consistencyScanner = newReplicaScanner(
-			s.cfg.AmbientCtx, cfg.ConsistencyCheckInterval, 0, newStoreReplicaVisitor(s),
+			s.cfg.AmbientCtx, cfg.ConsistencyCheckInterval, 0, 0, newStoreReplicaVisitor(s),
 		)
 		s.replicaConsistencyQueue = newReplicaConsistencyQueue(s, s.cfg.Gossip)
 		s.consistencyScanner.AddQueues(s.replicaConsistencyQueue)
@@ -788,6 +992,11 @@ func NewStore(cfg StoreConfig, eng engine.Engine, nodeDesc *roachpb.NodeDescript
 	if cfg.TestingKnobs.DisableScanner {
 		s.setScannerActive(false)
 	}
+	for _, name := range cfg.DisabledQueues {
+		if err := s.setQueueActive(name, false); err != nil {
+			panic(fmt.Sprintf("invalid store configuration: %s", err))
+		}
+	}
 
 	return s
 }
@@ -810,8 +1019,9 @@ func (s *Store) AnnotateCtxWithSpan(
 }
 
 // DrainLeases (when called with 'true') prevents all of the Store's
-// Replicas from acquiring or extending range leases and waits until all of
-// them have expired. If an error is returned, the draining state is still
+// Replicas from acquiring or extending range leases, transfers the leases
+// they hold to other replicas and waits until all of them have moved or
+// expired. If an error is returned, the draining state is still
 // active, but there may be active leases held by some of the Store's Replicas.
 // When called with 'false', returns to the normal mode of operation.
 func (s *Store) DrainLeases(drain bool) error {
@@ -819,6 +1029,9 @@ func (s *Store) DrainLeases(drain bool) error {
 	if !drain {
 		return nil
 	}
+	// Hand the leases over rather than letting them expire, which leaves
+	// their ranges unavailable until then.
+	s.transferLeasesForDrain(s.AnnotateCtx(context.Background()))
 
 	return util.RetryForDuration(10*s.cfg.RangeLeaseActiveDuration, func() error {
 		var drainingLease *roachpb.Lease
@@ -844,6 +1057,80 @@ func (s *Store) DrainLeases(drain bool) error {
 	})
 }
 
+// drainLeaseTransferConcurrency is the number of lease transfers a draining
+// store runs concurrently.
+const drainLeaseTransferConcurrency = 16
+
+// transferLeasesForDrain transfers the active range leases held by the
+// store's replicas to other replicas of their ranges; see
+// Allocator.DrainLeaseTarget. Replicas lagging behind don't receive leases,
+// and the leases which can't be transferred are left to expire.
+func (s *Store) transferLeasesForDrain(ctx context.Context) {
+	sysCfg, ok := s.cfg.Gossip.GetSystemConfig()
+	if !ok {
+		log.Warningf(ctx, "not transferring leases: system config not yet available")
+		return
+	}
+	sem := make(chan struct{}, drainLeaseTransferConcurrency)
+	var wg sync.WaitGroup
+	var transferred int64 // updated atomically
+	now := s.Clock().Now()
+	newStoreReplicaVisitor(s).Visit(func(r *Replica) bool {
+		if lease, _ := r.getLease(); !lease.OwnedBy(s.StoreID()) || !lease.Covers(now) {
+			return true
+		}
+		desc := r.Desc()
+		zone, err := sysCfg.GetZoneConfigForKey(desc.StartKey)
+		if err != nil {
+			log.Warningf(ctx, "%s: unable to look up zone config: %s", r, err)
+			return true
+		}
+		target := s.allocator.DrainLeaseTarget(
+			zone, r.filterBehindLeaseTargets(desc.Replicas), s.StoreID())
+		if target == nil {
+			return true
+		}
+		wg.Add(1)
+		if s.stopper.RunLimitedAsyncTask(ctx, sem, func(ctx context.Context) {
+			defer wg.Done()
+			if err := r.AdminTransferLease(target.StoreID); err != nil {
+				log.VEventf(ctx, 1, "%s: unable to transfer lease to s%d: %s", r, target.StoreID, err)
+				return
+			}
+			atomic.AddInt64(&transferred, 1)
+		}) != nil {
+			wg.Done()
+		}
+		return true
+	})
+	wg.Wait()
+	if transferred > 0 {
+		log.Infof(ctx, "transferred %d leases while draining", transferred)
+	}
+}
+
+// SetReadOnly puts the store into read-only mode, or takes it out of it, and
+// gossips the store's descriptor so that the allocators throughout the cluster
+// take it into account. A read-only store keeps serving reads and
+// participating in Raft, but its Replicas neither acquire nor extend range
+// leases, and it isn't a target for new replicas, rebalances or lease
+// transfers. This minimizes the writes to a store whose disk is failing while
+// its data is moved away. The mode lasts until the node restarts.
+func (s *Store) SetReadOnly(ctx context.Context, readOnly bool) (*roachpb.StoreDescriptor, error) {
+	s.readOnly.Store(readOnly)
+	log.Infof(ctx, "set read-only mode to %t", readOnly)
+
+	select {
+	case <-s.cfg.Gossip.Connected:
+	default:
+		return nil, errors.Errorf("%s: not connected to gossip", s)
+	}
+	if err := s.GossipStore(ctx); err != nil {
+		return nil, err
+	}
+	return s.Descriptor()
+}
+
 // IsStarted returns true if the Store has been started.
 func (s *Store) IsStarted() bool {
 	return atomic.LoadInt32(&s.started) == 1
@@ -929,6 +1216,10 @@ func (s *Store) Start(ctx context.Context, stopper *stop.Stopper) error {
 	}
 	log.Event(ctx, "read store identity")
 
+	if err := removeSnapshotTempFiles(s.engine); err != nil {
+		return errors.Wrap(err, "unable to remove leftover snapshot files")
+	}
+
 	// If the nodeID is 0, it has not be assigned yet.
 	if s.nodeDesc.NodeID != 0 && s.Ident.NodeID != s.nodeDesc.NodeID {
 		return errors.Errorf("node id:%d does not equal the one in node descriptor:%d", s.Ident.NodeID, s.nodeDesc.NodeID)
@@ -941,6 +1232,10 @@ func (s *Store) Start(ctx context.Context, stopper *stop.Stopper) error {
 	// Set the store ID for logging.
 	s.cfg.AmbientCtx.AddLogTagInt("s", int(s.StoreID()))
 
+	// Log the allocator's seed so that its placement decisions can be
+	// replayed; see StoreTestingKnobs.AllocatorRandSeed.
+	log.Infof(s.AnnotateCtx(ctx), "allocator random seed: %d", s.allocator.randSeed)
+
 	// Create ID allocators.
 	idAlloc, err := newIDAllocator(
 		s.cfg.AmbientCtx, keys.RangeIDGenerator, s.db, 2 /* min ID */, rangeIDAllocCount, s.stopper,
@@ -958,6 +1253,7 @@ func (s *Store) Start(ctx context.Context, stopper *stop.Stopper) error {
 	// due to a split crashing halfway will simply be resolved on the
 	// next split attempt. They can otherwise be ignored.
 	s.mu.Lock()
+	var repls []*Replica
 
 	// TODO(peter): While we have to iterate to find the replica descriptors
 	// serially, we can perform the migrations and replica creation
@@ -978,6 +1274,7 @@ func (s *Store) Start(ctx context.Context, stopper *stop.Stopper) error {
 			if err = s.addReplicaInternalLocked(rep); err != nil {
 				return false, err
 			}
+			repls = append(repls, rep)
 			// Add this range and its stats to our counter.
 			s.metrics.ReplicaCount.Inc(1)
 			s.metrics.addMVCCStats(rep.GetMVCCStats())
@@ -1007,9 +1304,18 @@ func (s *Store) Start(ctx context.Context, stopper *stop.Stopper) error {
 		return err
 	}
 
+	// Validate the replicas before serving them, within a time budget so
+	// that stores with many replicas start quickly. The deferred replicas
+	// and the expensive checks are validated in the background.
+	deferred := s.validateReplicasAtStartup(ctx, repls)
+
 	// Start Raft processing goroutines.
 	s.cfg.Transport.Listen(s.StoreID(), s)
 	s.processRaft()
+	s.startRaftLogBackpressureLoop()
+	if err := s.startReplicaValidation(s.AnnotateCtx(context.Background()), repls, deferred); err != nil {
+		return err
+	}
 
 	doneUnfreezing := make(chan struct{})
 	if s.stopper.RunAsyncTask(ctx, func(ctx context.Context) {
@@ -1269,6 +1575,14 @@ func (s *Store) GossipStore(ctx context.Context) error {
 	if err := s.cfg.Gossip.AddInfoProto(gossipStoreKey, storeDesc, ttlStoreGossip); err != nil {
 		return err
 	}
+	s.gossipedCapacity.Lock()
+	s.gossipedCapacity.gossiped = true
+	s.gossipedCapacity.at = timeutil.Now()
+	s.gossipedCapacity.rangeCount = storeDesc.Capacity.RangeCount
+	s.gossipedCapacity.fractionUsed = storeDesc.Capacity.FractionUsed()
+	s.gossipedCapacity.reservationsExhausted = storeDesc.Capacity.ReservationsExhausted()
+	s.gossipedCapacity.overloaded = storeDesc.Capacity.Overloaded()
+	s.gossipedCapacity.Unlock()
 	// Once we have gossiped the store descriptor the first time, other nodes
 	// will know that this node has restarted and will start sending Raft
 	// heartbeats for active ranges. We compute the time in the future where a
@@ -1298,6 +1612,77 @@ func (s *Store) GossipStore(ctx context.Context) error {
 	return nil
 }
 
+// capacityChanged returns whether cur differs from prev by more than the
+// given fraction of prev.
+func capacityChanged(prev, cur, threshold float64) bool {
+	if prev == 0 {
+		return cur != 0
+	}
+	return math.Abs(cur-prev)/prev > threshold
+}
+
+// maybeGossipOnCapacityChange asynchronously gossips the store descriptor if
+// the store's range count or fraction of capacity used has changed by more
+// than kv.store_gossip.capacity_delta_fraction since it was last gossiped,
+// or if it has run out of snapshot reservation budget or has budget again.
+// This keeps the other stores' view of this store's capacity current while
+// ranges are rapidly added to or removed from it, which would otherwise only
+// be refreshed by the periodic gossip. Early gossip is damped by
+// kv.store_gossip.capacity_change_min_interval: the changes made until then
+// are gossiped together. It is safe to call with Store.mu held.
+func (s *Store) maybeGossipOnCapacityChange(ctx context.Context) {
+	threshold := gossipCapacityChangeThreshold.Get()
+	if threshold <= 0 {
+		return
+	}
+	s.gossipedCapacity.Lock()
+	gossiped := s.gossipedCapacity.gossiped
+	s.gossipedCapacity.Unlock()
+	if !gossiped {
+		// The store will be gossiped once it has started.
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&s.gossipOnCapacityChangePending, 0, 1) {
+		return
+	}
+	if err := s.stopper.RunAsyncTask(ctx, func(ctx context.Context) {
+		defer atomic.StoreInt32(&s.gossipOnCapacityChangePending, 0)
+		// Further changes are ignored while this one is pending, so they
+		// will be picked up by the descriptor retrieved after the wait.
+		s.gossipedCapacity.Lock()
+		wait := gossipCapacityChangeMinInterval.Get() - timeutil.Since(s.gossipedCapacity.at)
+		s.gossipedCapacity.Unlock()
+		if wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-s.stopper.ShouldQuiesce():
+				return
+			}
+		}
+		storeDesc, err := s.Descriptor()
+		if err != nil {
+			log.Warningf(ctx, "problem getting store descriptor: %s", err)
+			return
+		}
+		s.gossipedCapacity.Lock()
+		changed := capacityChanged(float64(s.gossipedCapacity.rangeCount),
+			float64(storeDesc.Capacity.RangeCount), threshold) ||
+			capacityChanged(s.gossipedCapacity.fractionUsed,
+				storeDesc.Capacity.FractionUsed(), threshold) ||
+			s.gossipedCapacity.reservationsExhausted != storeDesc.Capacity.ReservationsExhausted() ||
+			s.gossipedCapacity.overloaded != storeDesc.Capacity.Overloaded()
+		s.gossipedCapacity.Unlock()
+		if !changed {
+			return
+		}
+		if err := s.GossipStore(ctx); err != nil {
+			log.Warningf(ctx, "error gossiping store descriptor: %s", err)
+		}
+	}); err != nil {
+		atomic.StoreInt32(&s.gossipOnCapacityChangePending, 0)
+	}
+}
+
 func (s *Store) canCampaignIdleReplica() bool {
 	s.idleReplicaElectionTime.Lock()
 	defer s.idleReplicaElectionTime.Unlock()
@@ -1308,12 +1693,34 @@ func (s *Store) canCampaignIdleReplica() bool {
 }
 
 // GossipDeadReplicas broadcasts the stores dead replicas on the gossip network.
+// When the store has more dead replicas than kv.dead_replicas.max_gossiped,
+// each call gossips the next page of them, the replicas of the ranges
+// closest to losing quorum coming first. The total number of dead replicas
+// is gossiped along with each page.
 func (s *Store) GossipDeadReplicas(ctx context.Context) error {
 	deadReplicas := s.deadReplicas()
 	// Don't gossip if there's nothing to gossip.
 	if len(deadReplicas.Replicas) == 0 {
 		return nil
 	}
+	deadReplicas.TotalCount = int32(len(deadReplicas.Replicas))
+	if max := int(deadReplicasMaxGossiped.Get()); max > 0 && len(deadReplicas.Replicas) > max {
+		replicas := deadReplicas.Replicas
+		spare := make(map[roachpb.RangeID]int, len(replicas))
+		for _, r := range replicas {
+			if repl, err := s.GetReplica(r.RangeID); err == nil {
+				spare[r.RangeID] = s.spareReplicas(repl.Desc())
+			}
+		}
+		sort.Sort(deadReplicasByRisk{replicas: replicas, spare: spare})
+		pages := uint32((len(replicas) + max - 1) / max)
+		start := int((atomic.AddUint32(&s.deadReplicasGossips, 1)-1)%pages) * max
+		end := start + max
+		if end > len(replicas) {
+			end = len(replicas)
+		}
+		deadReplicas.Replicas = replicas[start:end]
+	}
 	// Unique gossip key per store.
 	key := gossip.MakeDeadReplicasKey(s.StoreID())
 	// Gossip dead replicas.
@@ -1531,7 +1938,12 @@ func (s *Store) BootstrapRange(initialValues []roachpb.KeyValue) error {
 		return err
 	}
 
-	updatedMS, err := writeInitialState(ctx, batch, *ms, *desc, raftpb.HardState{}, &roachpb.Lease{})
+	// The new cluster's ranges start out on the legacy applied state keys and
+	// are migrated like all others once kv.raft.applied_state_key.enabled is
+	// set.
+	updatedMS, err := writeInitialState(
+		ctx, batch, *ms, *desc, raftpb.HardState{}, &roachpb.Lease{}, false, /* usingAppliedStateKey */
+	)
 	if err != nil {
 		return err
 	}
@@ -1572,6 +1984,11 @@ func (s *Store) IsDrainingLeases() bool {
 	return s.drainLeases.Load().(bool)
 }
 
+// IsReadOnly accessor.
+func (s *Store) IsReadOnly() bool {
+	return s.readOnly.Load().(bool)
+}
+
 // NewRangeDescriptor creates a new descriptor based on start and end
 // keys and the supplied roachpb.Replicas slice. It allocates a new
 // range ID and returns a RangeDescriptor whose Replicas are a copy
@@ -1771,6 +2188,7 @@ func (s *Store) addReplicaInternalLocked(rng *Replica) error {
 			exRngItem.(KeyRange).endKey())
 	}
 
+	s.maybeGossipOnCapacityChange(s.AnnotateCtx(context.TODO()))
 	return nil
 }
 
@@ -1908,6 +2326,7 @@ func (s *Store) removeReplicaImpl(
 	}
 	s.scanner.RemoveReplica(rep)
 	s.consistencyScanner.RemoveReplica(rep)
+	s.maybeGossipOnCapacityChange(s.AnnotateCtx(context.TODO()))
 	return nil
 }
 
@@ -1967,15 +2386,77 @@ func (s *Store) ReleaseRaftSnapshot() {
 	atomic.SwapInt32(&s.hasActiveRaftSnapshot, 0)
 }
 
-// Attrs returns the attributes of the underlying store.
+// Attrs returns the attributes of the underlying store, unless they have
+// been replaced by UpdateAttributes.
 func (s *Store) Attrs() roachpb.Attributes {
+	s.attrsOverride.Lock()
+	defer s.attrsOverride.Unlock()
+	if s.attrsOverride.attrs != nil {
+		return *s.attrsOverride.attrs
+	}
 	return s.engine.Attrs()
 }
 
+// UpdateAttributes replaces the attributes of the store and the locality of
+// the node in its descriptor, leaving either unchanged if nil, and gossips
+// the new descriptor so that the allocators throughout the cluster take
+// them into account. The change lasts until the node restarts.
+func (s *Store) UpdateAttributes(
+	ctx context.Context, attrs *roachpb.Attributes, locality *roachpb.Locality,
+) (*roachpb.StoreDescriptor, error) {
+	s.attrsOverride.Lock()
+	if attrs != nil {
+		s.attrsOverride.attrs = &roachpb.Attributes{
+			Attrs: append([]string(nil), attrs.Attrs...),
+		}
+	}
+	if locality != nil {
+		s.attrsOverride.locality = &roachpb.Locality{
+			Tiers: append([]roachpb.Tier(nil), locality.Tiers...),
+		}
+	}
+	s.attrsOverride.Unlock()
+	log.Infof(ctx, "updated store attributes to %s and locality to %s", s.Attrs(), s.locality())
+
+	select {
+	case <-s.cfg.Gossip.Connected:
+	default:
+		return nil, errors.Errorf("%s: not connected to gossip", s)
+	}
+	if err := s.GossipStore(ctx); err != nil {
+		return nil, err
+	}
+	return s.Descriptor()
+}
+
+// locality returns the locality of the store's node, unless it has been
+// replaced by UpdateAttributes.
+func (s *Store) locality() roachpb.Locality {
+	s.attrsOverride.Lock()
+	defer s.attrsOverride.Unlock()
+	if s.attrsOverride.locality != nil {
+		return *s.attrsOverride.locality
+	}
+	return s.nodeDesc.Locality
+}
+
 // Capacity returns the capacity of the underlying storage engine. Note that
 // this does not include reservations.
 func (s *Store) Capacity() (roachpb.StoreCapacity, error) {
-	return s.engine.Capacity()
+	capacity, err := s.engine.Capacity()
+	if err != nil {
+		return capacity, err
+	}
+	s.bookie.fillCapacity(&capacity)
+	capacity.QueriesPerSecond = s.queryRate.Value()
+	capacity.WritesPerSecond = s.writeRate.Value()
+	capacity.RemoteQueriesPerSecond = s.remoteQueryRate.Value()
+	capacity.LogicalBytes = s.MVCCStats().Total()
+	capacity.Overload = s.overload.score()
+	if capacity.QueriesPerSecond > 0 {
+		capacity.RequestLatencyNanos = s.latencyRate.Value() / capacity.QueriesPerSecond
+	}
+	return capacity, nil
 }
 
 // Registry returns the store registry.
@@ -2005,15 +2486,27 @@ func (s *Store) Descriptor() (*roachpb.StoreDescriptor, error) {
 		return nil, err
 	}
 	capacity.RangeCount = int32(s.ReplicaCount())
+	capacity.LeaseCount = int32(s.LeaseCount())
+	capacity.MaxRangeCount = int32(s.cfg.MaxReplicas)
+	nodeDesc := *s.nodeDesc
+	nodeDesc.Locality = s.locality()
 	// Initialize the store descriptor.
 	return &roachpb.StoreDescriptor{
-		StoreID:  s.Ident.StoreID,
-		Attrs:    s.Attrs(),
-		Node:     *s.nodeDesc,
-		Capacity: capacity,
+		StoreID:   s.Ident.StoreID,
+		Attrs:     s.Attrs(),
+		Node:      nodeDesc,
+		Capacity:  capacity,
+		Ephemeral: s.Ephemeral(),
+		ReadOnly:  s.IsReadOnly(),
 	}, nil
 }
 
+// Ephemeral returns true if the store only holds non-essential data.
+func (s *Store) Ephemeral() bool {
+	_, ok := s.cfg.EphemeralEngines[s.engine]
+	return ok
+}
+
 func (s *Store) deadReplicas() roachpb.StoreDeadReplicas {
 	sid := s.StoreID()
 
@@ -2042,6 +2535,66 @@ func (s *Store) deadReplicas() roachpb.StoreDeadReplicas {
 	}
 }
 
+// spareReplicas returns how many more replicas the range can lose before it
+// loses quorum, given that its replica on the store is dead. The other
+// replicas are considered lost if the StorePool considers them dead. The
+// result is negative if the range has already lost quorum.
+func (s *Store) spareReplicas(desc *roachpb.RangeDescriptor) int {
+	var others []roachpb.ReplicaDescriptor
+	for _, repl := range desc.Replicas {
+		if repl.StoreID != s.StoreID() {
+			others = append(others, repl)
+		}
+	}
+	live := len(others)
+	if sp := s.cfg.StorePool; sp != nil {
+		dead := make(map[roachpb.ReplicaID]struct{})
+		for _, repl := range sp.deadReplicas(desc.RangeID, others) {
+			dead[repl.ReplicaID] = struct{}{}
+		}
+		for i, status := range sp.replicaStatuses(others) {
+			if _, ok := dead[others[i].ReplicaID]; ok || status == storeStatusDead {
+				live--
+			}
+		}
+	}
+	return live - (len(desc.Replicas)/2 + 1)
+}
+
+// deadReplicasByRisk sorts dead replicas by the number of spare replicas of
+// their ranges, ascending, so that the replicas of the ranges closest to
+// losing quorum come first. The replicas of ranges which have already lost
+// quorum come last: replacing them can't make progress until quorum is
+// restored. Ranges without a spare count are treated as having lost quorum.
+type deadReplicasByRisk struct {
+	replicas []roachpb.ReplicaIdent
+	spare    map[roachpb.RangeID]int
+}
+
+func (d deadReplicasByRisk) Len() int {
+	return len(d.replicas)
+}
+
+func (d deadReplicasByRisk) Swap(i, j int) {
+	d.replicas[i], d.replicas[j] = d.replicas[j], d.replicas[i]
+}
+
+func (d deadReplicasByRisk) Less(i, j int) bool {
+	ri, rj := d.rank(d.replicas[i].RangeID), d.rank(d.replicas[j].RangeID)
+	if ri != rj {
+		return ri < rj
+	}
+	return d.replicas[i].RangeID < d.replicas[j].RangeID
+}
+
+// rank returns the key by which the replicas of the range are sorted.
+func (d deadReplicasByRisk) rank(rangeID roachpb.RangeID) int {
+	if spare, ok := d.spare[rangeID]; ok && spare >= 0 {
+		return spare
+	}
+	return math.MaxInt32
+}
+
 // ReplicaCount returns the number of replicas contained by this store.
 func (s *Store) ReplicaCount() int {
 	s.mu.Lock()
@@ -2049,6 +2602,23 @@ func (s *Store) ReplicaCount() int {
 	return len(s.mu.replicas)
 }
 
+// LeaseCount returns the number of replicas on this store which currently
+// hold a valid range lease.
+func (s *Store) LeaseCount() int {
+	var count int
+	now := s.Clock().Now()
+	newStoreReplicaVisitor(s).Visit(func(r *Replica) bool {
+		r.mu.Lock()
+		lease := r.mu.state.Lease
+		r.mu.Unlock()
+		if lease.Covers(now) && lease.OwnedBy(s.StoreID()) {
+			count++
+		}
+		return true // more
+	})
+	return count
+}
+
 // Send fetches a range based on the header's replica, assembles method, args &
 // reply into a Raft Cmd struct and executes the command using the fetched
 // range.
@@ -2070,6 +2640,21 @@ func (s *Store) Send(
 	// Attach any log tags from the store to the context (which normally
 	// comes from gRPC).
 	ctx = s.AnnotateCtx(ctx)
+	// Batches which the client marked as COLD are part of a transient workload
+	// and shouldn't cause the store's replicas to be rebalanced away.
+	if ba.Temperature != roachpb.COLD {
+		s.queryRate.Add(1)
+		if s.isRemoteGateway(ba.GatewayNodeID) {
+			s.remoteQueryRate.Add(1)
+		}
+		if !ba.IsReadOnly() {
+			s.writeRate.Add(1)
+		}
+	}
+	start := timeutil.Now()
+	defer func() {
+		s.latencyRate.Add(float64(timeutil.Since(start).Nanoseconds()))
+	}()
 	for _, union := range ba.Requests {
 		arg := union.GetInner()
 		header := arg.Header()
@@ -2077,6 +2662,9 @@ func (s *Store) Send(
 			return nil, roachpb.NewError(err)
 		}
 	}
+	if err := s.maybeBackpressureRaftLog(ctx, ba); err != nil {
+		return nil, roachpb.NewError(err)
+	}
 
 	if err := ba.SetActiveTimestamp(s.Clock().Now); err != nil {
 		return nil, roachpb.NewError(err)
@@ -2383,7 +2971,32 @@ func (s *Store) HandleSnapshot(
 
 	ctx := s.AnnotateCtx(stream.Context())
 
+	// The store isn't receiving a snapshot, but sending one in the
+	// leaseholder's stead.
+	if header.DelegatedTarget != nil {
+		return s.handleDelegatedSnapshot(ctx, header, stream)
+	}
+
 	if header.CanDecline {
+		// A read-only store doesn't take new replicas.
+		if s.IsReadOnly() {
+			log.VEventf(ctx, 1, "declining snapshot for r%d: store is read-only",
+				header.RangeDescriptor.RangeID)
+			return stream.Send(&SnapshotResponse{
+				Status:        SnapshotResponse_DECLINED,
+				StoreCapacity: capacity,
+			})
+		}
+		// Decline new replicas once the store holds as many as it is
+		// configured to.
+		if max := s.cfg.MaxReplicas; max > 0 && s.ReplicaCount() >= max {
+			log.VEventf(ctx, 1, "declining snapshot for r%d: store is at its maximum of %d replicas",
+				header.RangeDescriptor.RangeID, max)
+			return stream.Send(&SnapshotResponse{
+				Status:        SnapshotResponse_DECLINED,
+				StoreCapacity: capacity,
+			})
+		}
 		// Check the bookie to see if we can apply the snapshot.
 		resp := s.Reserve(ctx, ReservationRequest{
 			StoreRequestHeader: StoreRequestHeader{
@@ -2392,6 +3005,7 @@ func (s *Store) HandleSnapshot(
 			},
 			RangeSize: header.RangeSize,
 			RangeID:   header.RangeDescriptor.RangeID,
+			Recovery:  header.Type == SnapshotRequest_RECOVERY,
 		})
 		if !resp.Reserved {
 			return stream.Send(&SnapshotResponse{
@@ -2399,6 +3013,16 @@ func (s *Store) HandleSnapshot(
 				StoreCapacity: capacity,
 			})
 		}
+		// Release the reservation once the snapshot is done with, whether
+		// or not it was applied, rather than holding it until it expires.
+		// Applying the snapshot fills it already, in which case this is a
+		// no-op. Other stores learn through gossip when the store runs out
+		// of reservation budget and when it has some again.
+		s.maybeGossipOnCapacityChange(ctx)
+		defer func() {
+			s.bookie.Fill(header.RangeDescriptor.RangeID)
+			s.maybeGossipOnCapacityChange(ctx)
+		}()
 	}
 
 	// Check to see if the snapshot can be applied but don't attempt to add
@@ -2413,12 +3037,39 @@ func (s *Store) HandleSnapshot(
 		)
 	}
 
-	if err := stream.Send(&SnapshotResponse{Status: SnapshotResponse_ACCEPTED, StoreCapacity: capacity}); err != nil {
+	format := pickSnapshotFormat(header.FormatVersion)
+	if err := stream.Send(&SnapshotResponse{
+		Status:        SnapshotResponse_ACCEPTED,
+		StoreCapacity: capacity,
+		FormatVersion: format,
+	}); err != nil {
 		return err
 	}
 
+	var receivedBytes int64
+	defer s.replicaMovements.startIncoming(ReplicaMovement{
+		RangeID: header.RangeDescriptor.RangeID,
+		From:    header.RaftMessageRequest.FromReplica.StoreID,
+		To:      []roachpb.StoreID{s.StoreID()},
+		Type:    incomingMovementType(header),
+		Bytes:   header.RangeSize,
+	}, &receivedBytes)()
+
+	// The batches are held in memory up to snapshotSpillThreshold, and
+	// spilled to disk beyond.
 	var batches [][]byte
+	var batchesSize int64
+	var spill *snapshotSpill
+	defer func() {
+		if spill != nil {
+			spill.close()
+		}
+	}()
 	var logEntries [][]byte
+	// The checksums are verified before the snapshot is applied, so that a
+	// transfer corrupted on the way is rejected rather than creating a
+	// replica inconsistent with the others.
+	var checksum snapshotChecksum
 	for {
 		req, err := stream.Recv()
 		if err != nil {
@@ -2427,14 +3078,47 @@ func (s *Store) HandleSnapshot(
 		if req.Header != nil {
 			return sendSnapError(errors.New("client error: provided a header mid-stream"))
 		}
+		if header.Checksummed {
+			if err := verifySnapshotMessage(req); err != nil {
+				return sendSnapError(errors.Wrap(err, "corrupt snapshot"))
+			}
+		}
 
 		if req.KVBatch != nil {
-			batches = append(batches, req.KVBatch)
+			repr, err := decodeSnapshotBatch(format, req.KVBatch)
+			if err != nil {
+				return sendSnapError(errors.Wrap(err, "invalid snapshot batch"))
+			}
+			checksum.add(repr)
+			atomic.AddInt64(&receivedBytes, int64(len(repr)))
+			if batchesSize < snapshotSpillThreshold {
+				batches = append(batches, repr)
+				batchesSize += int64(len(repr))
+			} else {
+				if spill == nil {
+					dir, err := snapshotTempDir(s.engine)
+					if err != nil {
+						return sendSnapError(err)
+					}
+					if spill, err = newSnapshotSpill(dir); err != nil {
+						return sendSnapError(err)
+					}
+				}
+				if err := spill.add(repr); err != nil {
+					return sendSnapError(errors.Wrap(err, "unable to spill snapshot batch"))
+				}
+			}
 		}
 		if req.LogEntries != nil {
 			logEntries = append(logEntries, req.LogEntries...)
+			checksum.addLogEntries(req.LogEntries)
 		}
 		if req.Final {
+			if header.Checksummed {
+				if err := checksum.verify(req.SnapshotChecksum); err != nil {
+					return sendSnapError(errors.Wrap(err, "corrupt snapshot"))
+				}
+			}
 			snapUUID, err := uuid.FromBytes(header.RaftMessageRequest.Message.Snapshot.Data)
 			if err != nil {
 				return sendSnapError(errors.Wrap(err, "invalid snapshot"))
@@ -2444,6 +3128,7 @@ func (s *Store) HandleSnapshot(
 				SnapUUID:        *snapUUID,
 				RangeDescriptor: header.RangeDescriptor,
 				Batches:         batches,
+				spill:           spill,
 				LogEntries:      logEntries,
 			}
 
@@ -2857,15 +3542,171 @@ func sendSnapshot(
 	snap *OutgoingSnapshot,
 	newBatch func() engine.Batch,
 ) error {
+	format, err := negotiateSnapshot(stream, storePool, header)
+	if err != nil {
+		return err
+	}
 	storeID := header.RaftMessageRequest.ToReplica.StoreID
-	if err := stream.Send(&SnapshotRequest{Header: &header}); err != nil {
+	rangeID := header.RangeDescriptor.RangeID
+	var checksum snapshotChecksum
+	n, err := iterateSnapshotBatches(snap, rangeID, newBatch, limitSnapshotRate(ctx, snap.rateLimit, func(repr []byte) error {
+		data, err := encodeSnapshotBatch(format, repr)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(withChecksum(&SnapshotRequest{KVBatch: data})); err != nil {
+			storePool.throttle(throttleFailed, storeID)
+			return err
+		}
+		checksum.add(repr)
+		return nil
+	}))
+	if err != nil {
+		return err
+	}
+	logEntries, err := snapshotLogEntries(ctx, snap, rangeID)
+	if err != nil {
+		return err
+	}
+	if err := finalizeSnapshot(stream, header, logEntries, checksum); err != nil {
+		storePool.throttle(throttleFailed, storeID)
 		return err
 	}
+	log.Infof(ctx, "streamed snapshot: kv pairs: %d, log entries: %d",
+		n, len(logEntries))
+	return nil
+}
+
+// sendSnapshotToAll sends an outgoing snapshot to several recipients via
+// pre-opened GRPC streams, one per header. The snapshot's key stream is
+// iterated only once and each batch is fanned out to every recipient which
+// is still accepting it, so that recovering from the loss of several
+// replicas doesn't require scanning the range once per new replica. The
+// returned slice holds the outcome for each recipient. Each batch is encoded
+// once per snapshot format negotiated by the recipients.
+func sendSnapshotToAll(
+	ctx context.Context,
+	streams []OutgoingSnapshotStream,
+	storePool SnapshotStorePool,
+	headers []SnapshotRequest_Header,
+	snap *OutgoingSnapshot,
+	newBatch func() engine.Batch,
+) []error {
+	errs := make([]error, len(streams))
+	formats := make([]uint32, len(streams))
+	live := 0
+	for i, stream := range streams {
+		if formats[i], errs[i] = negotiateSnapshot(stream, storePool, headers[i]); errs[i] == nil {
+			live++
+		}
+	}
+	if live == 0 {
+		return errs
+	}
+
+	rangeID := headers[0].RangeDescriptor.RangeID
+	var checksum snapshotChecksum
+	n, err := iterateSnapshotBatches(snap, rangeID, newBatch, limitSnapshotRate(ctx, snap.rateLimit, func(repr []byte) error {
+		checksum.add(repr)
+		live = 0
+		encoded := make(map[uint32][]byte)
+		for i, stream := range streams {
+			if errs[i] != nil {
+				continue
+			}
+			data, ok := encoded[formats[i]]
+			if !ok {
+				var err error
+				if data, err = encodeSnapshotBatch(formats[i], repr); err != nil {
+					return err
+				}
+				encoded[formats[i]] = data
+			}
+			if errs[i] = stream.Send(withChecksum(&SnapshotRequest{KVBatch: data})); errs[i] != nil {
+				storePool.throttle(throttleFailed, headers[i].RaftMessageRequest.ToReplica.StoreID)
+			} else {
+				live++
+			}
+		}
+		if live == 0 {
+			return errors.Errorf("range=%s: no recipients left for snapshot", rangeID)
+		}
+		return nil
+	}))
+	if err == nil {
+		var logEntries [][]byte
+		if logEntries, err = snapshotLogEntries(ctx, snap, rangeID); err == nil {
+			for i, stream := range streams {
+				if errs[i] == nil {
+					if errs[i] = finalizeSnapshot(stream, headers[i], logEntries, checksum); errs[i] != nil {
+						storePool.throttle(throttleFailed, headers[i].RaftMessageRequest.ToReplica.StoreID)
+					}
+				}
+			}
+			log.Infof(ctx, "streamed snapshot to %d recipients: kv pairs: %d, log entries: %d",
+				live, n, len(logEntries))
+		}
+	}
+	if err != nil {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+	}
+	return errs
+}
+
+// limitSnapshotRate wraps the function sending the batches of a snapshot so
+// that the snapshot is streamed no faster than the rate returned by maxRate,
+// which is called for every batch so that changes to the limit take effect
+// on the snapshots being streamed.
+func limitSnapshotRate(
+	ctx context.Context, maxRate func() int64, send func(repr []byte) error,
+) func([]byte) error {
+	start := timeutil.Now()
+	var sent int64
+	return func(repr []byte) error {
+		if err := send(repr); err != nil {
+			return err
+		}
+		rate := maxRate()
+		if rate <= 0 {
+			return nil
+		}
+		sent += int64(len(repr))
+		wait := time.Duration(float64(sent)/float64(rate)*float64(time.Second)) - timeutil.Since(start)
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-time.After(wait):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// negotiateSnapshot sends the snapshot header on the stream and waits for the
+// recipient to accept it, returning the snapshot format version the
+// recipient picked. The header announces that the snapshot's messages are
+// checksummed. The store pool is informed of the recipient's capacity
+// and throttled if the snapshot is declined or fails.
+func negotiateSnapshot(
+	stream OutgoingSnapshotStream, storePool SnapshotStorePool, header SnapshotRequest_Header,
+) (uint32, error) {
+	storeID := header.RaftMessageRequest.ToReplica.StoreID
+	header.FormatVersion = maxSnapshotFormat()
+	header.Checksummed = true
+	if err := stream.Send(&SnapshotRequest{Header: &header}); err != nil {
+		return 0, err
+	}
 	// Wait until we get a response from the server.
 	resp, err := stream.Recv()
 	if err != nil {
 		storePool.throttle(throttleFailed, storeID)
-		return err
+		return 0, err
 	}
 	if resp.StoreCapacity != nil {
 		storePool.updateRemoteCapacityEstimate(storeID, *resp.StoreCapacity)
@@ -2874,30 +3715,50 @@ func sendSnapshot(
 	case SnapshotResponse_DECLINED:
 		if header.CanDecline {
 			storePool.throttle(throttleDeclined, storeID)
-			return errors.Errorf("range=%s: remote declined snapshot: %s",
+			return 0, errors.Errorf("range=%s: remote declined snapshot: %s",
 				header.RangeDescriptor.RangeID, resp.Message)
 		}
 		storePool.throttle(throttleFailed, storeID)
-		return errors.Errorf("range=%s: programming error: remote declined required snapshot: %s",
+		return 0, errors.Errorf("range=%s: programming error: remote declined required snapshot: %s",
 			header.RangeDescriptor.RangeID, resp.Message)
 	case SnapshotResponse_ERROR:
 		storePool.throttle(throttleFailed, storeID)
-		return errors.Errorf("range=%s: remote couldn't accept snapshot with error: %s",
+		return 0, errors.Errorf("range=%s: remote couldn't accept snapshot with error: %s",
 			header.RangeDescriptor.RangeID, resp.Message)
 	case SnapshotResponse_ACCEPTED:
-	// This is the response we're expecting. Continue with snapshot sending.
+		// This is the response we're expecting. Continue with snapshot sending.
+		if resp.FormatVersion > header.FormatVersion {
+			storePool.throttle(throttleFailed, storeID)
+			return 0, errors.Errorf("range=%s: remote picked unsupported snapshot format version %d",
+				header.RangeDescriptor.RangeID, resp.FormatVersion)
+		}
+		return resp.FormatVersion, nil
 	default:
 		storePool.throttle(throttleFailed, storeID)
-		return errors.Errorf("range=%s: server sent an invalid status during negotiation: %s",
+		return 0, errors.Errorf("range=%s: server sent an invalid status during negotiation: %s",
 			header.RangeDescriptor.RangeID, resp.Status)
 	}
+}
 
+// snapshotBatchSize is the size of the batches of key/value pairs, and of
+// the chunks of log entries, a snapshot is streamed in.
+// TODO(jordan) make this configurable. For now, 1MB.
+const snapshotBatchSize = 1 << 20
+
+// iterateSnapshotBatches consumes the snapshot's iterator, packing its
+// replicated key/value pairs into batches of roughly 1MB and passing the
+// representation of each to send. It returns the number of key/value pairs
+// sent.
+func iterateSnapshotBatches(
+	snap *OutgoingSnapshot,
+	rangeID roachpb.RangeID,
+	newBatch func() engine.Batch,
+	send func(repr []byte) error,
+) (int, error) {
 	// Determine the unreplicated key prefix so we can drop any
 	// unreplicated keys from the snapshot.
-	unreplicatedPrefix := keys.MakeRangeIDUnreplicatedPrefix(header.RangeDescriptor.RangeID)
+	unreplicatedPrefix := keys.MakeRangeIDUnreplicatedPrefix(rangeID)
 	var alloc bufalloc.ByteAllocator
-	// TODO(jordan) make this configurable. For now, 1MB.
-	const batchSize = 1 << 20
 	n := 0
 	var b engine.Batch
 	for ; snap.Iter.Valid(); snap.Iter.Next() {
@@ -2917,13 +3778,14 @@ func sendSnapshot(
 		}
 		if err := b.Put(mvccKey, value); err != nil {
 			b.Close()
-			return err
+			return n, err
 		}
 
-		if len(b.Repr()) >= batchSize {
-			if err := sendBatch(stream, b); err != nil {
-				return err
+		if size := len(b.Repr()); size >= snapshotBatchSize {
+			if err := sendBatch(send, b); err != nil {
+				return n, err
 			}
+			atomic.AddInt64(&snap.sentBytes, int64(size))
 			b = nil
 			// We no longer need the keys and values in the batch we just sent,
 			// so reset alloc and allow them to be garbage collected.
@@ -2931,16 +3793,23 @@ func sendSnapshot(
 		}
 	}
 	if b != nil {
-		if err := sendBatch(stream, b); err != nil {
-			return err
+		size := len(b.Repr())
+		if err := sendBatch(send, b); err != nil {
+			return n, err
 		}
+		atomic.AddInt64(&snap.sentBytes, int64(size))
 	}
+	return n, nil
+}
 
-	rangeID := header.RangeDescriptor.RangeID
-
+// snapshotLogEntries loads the raft log entries which accompany the snapshot,
+// followed by its log tail if it has one.
+func snapshotLogEntries(
+	ctx context.Context, snap *OutgoingSnapshot, rangeID roachpb.RangeID,
+) ([][]byte, error) {
 	truncState, err := loadTruncatedState(ctx, snap.EngineSnap, rangeID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	firstIndex := truncState.Index + 1
 
@@ -2956,15 +3825,54 @@ func sendSnapshot(
 	}
 
 	if err := iterateEntries(ctx, snap.EngineSnap, rangeID, firstIndex, endIndex, scanFunc); err != nil {
-		return err
+		return nil, err
 	}
-	if err := stream.Send(&SnapshotRequest{LogEntries: logEntries, Final: true}); err != nil {
+	if snap.logTail != nil {
+		tail, err := snap.logTail(ctx, endIndex)
+		if err != nil {
+			return nil, err
+		}
+		logEntries = append(logEntries, tail...)
+	}
+	return logEntries, nil
+}
+
+// finalizeSnapshot sends the snapshot's log entries and waits for the
+// recipient to report that it applied the snapshot. The final message holds
+// the checksum of the whole snapshot, which checksum holds up to the log
+// entries.
+func finalizeSnapshot(
+	stream OutgoingSnapshotStream,
+	header SnapshotRequest_Header,
+	logEntries [][]byte,
+	checksum snapshotChecksum,
+) error {
+	checksum.addLogEntries(logEntries)
+	// Send the log entries in chunks of about snapshotBatchSize, so that a
+	// long log isn't sent as a single message.
+	for {
+		n, size := 0, 0
+		for n < len(logEntries) && (n == 0 || size+len(logEntries[n]) <= snapshotBatchSize) {
+			size += len(logEntries[n])
+			n++
+		}
+		if n == len(logEntries) {
+			break
+		}
+		if err := stream.Send(withChecksum(&SnapshotRequest{LogEntries: logEntries[:n]})); err != nil {
+			return err
+		}
+		logEntries = logEntries[n:]
+	}
+	if err := stream.Send(withChecksum(&SnapshotRequest{
+		LogEntries:       logEntries,
+		Final:            true,
+		SnapshotChecksum: uint32(checksum),
+	})); err != nil {
 		return err
 	}
-	log.Infof(ctx, "streamed snapshot: kv pairs: %d, log entries: %d",
-		n, len(logEntries))
 
-	resp, err = stream.Recv()
+	resp, err := stream.Recv()
 	if err != nil {
 		return errors.Wrapf(err, "range=%s: remote failed to apply snapshot", header.RangeDescriptor.RangeID)
 	}
@@ -2980,10 +3888,10 @@ func sendSnapshot(
 	}
 }
 
-func sendBatch(stream OutgoingSnapshotStream, batch engine.Batch) error {
+func sendBatch(send func(repr []byte) error, batch engine.Batch) error {
 	repr := batch.Repr()
 	batch.Close()
-	return stream.Send(&SnapshotRequest{KVBatch: repr})
+	return send(repr)
 }
 
 // enqueueRaftUpdateCheck asynchronously registers the given range ID to be
@@ -3521,13 +4429,22 @@ func (s *Store) updateReplicationGauges() error {
 // cannot be computed incrementally. This method should be invoked periodically
 // by a higher-level system which records store metrics.
 func (s *Store) ComputeMetrics(tick int) error {
+	s.updateOverload()
 	if err := s.updateCapacityGauges(); err != nil {
 		return err
 	}
+	// The fraction of capacity used changes as data is written, so check
+	// whether it has changed enough to be gossiped.
+	s.maybeGossipOnCapacityChange(s.AnnotateCtx(context.TODO()))
+
+	if s.cfg.StorePool != nil {
+		s.cfg.StorePool.updateMetrics()
+	}
 
 	if err := s.updateReplicationGauges(); err != nil {
 		return err
 	}
+	s.updateSnapshotGauges()
 
 	// Get the latest RocksDB stats.
 	stats, err := s.engine.GetStats()
@@ -3540,6 +4457,7 @@ func (s *Store) ComputeMetrics(tick int) error {
 	if rocksdb, ok := s.engine.(*engine.RocksDB); ok {
 		sstables := rocksdb.GetSSTables()
 		s.metrics.RdbNumSSTables.Update(int64(sstables.Len()))
+		s.metrics.RdbL0SSTables.Update(int64(numL0SSTables(sstables)))
 		readAmp := sstables.ReadAmplification()
 		s.metrics.RdbReadAmplification.Update(int64(readAmp))
 		// Log this metric infrequently.
@@ -3551,6 +4469,31 @@ func (s *Store) ComputeMetrics(tick int) error {
 	return nil
 }
 
+// updateOverload recomputes the store's overload score from the current
+// CPU usage, disk latency, L0 file count and Raft scheduler lag.
+func (s *Store) updateOverload() {
+	in := storeOverloadInputs{
+		cpu:          s.overload.sampleCPU(),
+		diskLatency:  windowedP99(s.metrics.RaftLogCommitLatency),
+		schedulerLag: windowedP99(s.metrics.RaftSchedulerLatency),
+	}
+	if rocksdb, ok := s.engine.(*engine.RocksDB); ok {
+		in.l0Files = numL0SSTables(rocksdb.GetSSTables())
+	}
+	s.metrics.Overload.Update(s.overload.update(in))
+}
+
+// numL0SSTables returns the number of sstables in level 0.
+func numL0SSTables(sstables engine.SSTableInfos) int {
+	var n int
+	for _, t := range sstables {
+		if t.Level == 0 {
+			n++
+		}
+	}
+	return n
+}
+
 // ComputeStatsForKeySpan computes the aggregated MVCCStats for all replicas on
 // this store which contain any keys in the supplied range.
 func (s *Store) ComputeStatsForKeySpan(startKey, endKey roachpb.RKey) (enginepb.MVCCStats, int) {
@@ -0,0 +1,333 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+)
+
+// The statuses of a storeJob, as reported in StoreJob.Status.
+const (
+	storeJobRunning   = "running"
+	storeJobPaused    = "paused"
+	storeJobCanceled  = "canceled"
+	storeJobSucceeded = "succeeded"
+	storeJobFailed    = "failed"
+)
+
+// maxFinishedStoreJobs is the number of finished jobs a storeJobRegistry
+// keeps around to report on.
+const maxFinishedStoreJobs = 100
+
+// storeJob is a long-running operation on a store, such as a manual
+// compaction or a consistency sweep, which can be paused, resumed and
+// canceled. The operation cooperates by calling checkpoint regularly.
+type storeJob struct {
+	id          int64
+	description string
+	cancel      func()
+
+	mu struct {
+		syncutil.Mutex
+		status            string
+		fractionCompleted float64
+		err               error
+		// resume is set while the job is paused, and closed when it is
+		// resumed.
+		resume chan struct{}
+	}
+}
+
+// checkpoint records the progress of the job as a fraction between 0 and 1.
+// While the job is paused, checkpoint blocks until it is resumed. It returns
+// an error once the job is canceled or the store is stopping, which the job
+// should return without doing any more work.
+func (j *storeJob) checkpoint(ctx context.Context, fractionCompleted float64) error {
+	j.mu.Lock()
+	j.mu.fractionCompleted = fractionCompleted
+	resume := j.mu.resume
+	j.mu.Unlock()
+	if resume != nil {
+		log.VEventf(ctx, 2, "job %d paused", j.id)
+		select {
+		case <-resume:
+		case <-ctx.Done():
+		}
+	}
+	return ctx.Err()
+}
+
+// proto returns the StoreJob describing the job.
+func (j *storeJob) proto() StoreJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job := StoreJob{
+		ID:                j.id,
+		Description:       j.description,
+		Status:            j.mu.status,
+		FractionCompleted: j.mu.fractionCompleted,
+	}
+	if j.mu.err != nil {
+		job.Error = j.mu.err.Error()
+	}
+	return job
+}
+
+// storeJobRegistry tracks the jobs run on a store.
+type storeJobRegistry struct {
+	mu struct {
+		syncutil.Mutex
+		nextID int64
+		jobs   map[int64]*storeJob
+		// finished holds the IDs of the finished jobs, oldest first.
+		finished []int64
+	}
+}
+
+func newStoreJobRegistry() *storeJobRegistry {
+	r := &storeJobRegistry{}
+	r.mu.jobs = map[int64]*storeJob{}
+	return r
+}
+
+// start runs fn as a new job with the given description, returning the ID
+// of the job. The job's context is canceled when the job is canceled or the
+// stopper quiesces.
+func (r *storeJobRegistry) start(
+	ctx context.Context,
+	stopper *stop.Stopper,
+	description string,
+	fn func(context.Context, *storeJob) error,
+) (int64, error) {
+	job := &storeJob{description: description}
+	job.mu.status = storeJobRunning
+	ctx, job.cancel = context.WithCancel(stopper.WithCancel(ctx))
+	r.mu.Lock()
+	r.mu.nextID++
+	job.id = r.mu.nextID
+	r.mu.jobs[job.id] = job
+	r.mu.Unlock()
+
+	if err := stopper.RunAsyncTask(ctx, func(ctx context.Context) {
+		log.Infof(ctx, "job %d started: %s", job.id, description)
+		err := fn(ctx, job)
+		job.cancel()
+		r.finish(ctx, job, err)
+	}); err != nil {
+		job.cancel()
+		r.finish(ctx, job, err)
+		return 0, err
+	}
+	return job.id, nil
+}
+
+// finish records the outcome of the job and forgets about the oldest
+// finished jobs beyond maxFinishedStoreJobs.
+func (r *storeJobRegistry) finish(ctx context.Context, job *storeJob, err error) {
+	job.mu.Lock()
+	switch {
+	case job.mu.status == storeJobCanceled:
+	case err != nil:
+		job.mu.status = storeJobFailed
+		job.mu.err = err
+	default:
+		job.mu.status = storeJobSucceeded
+		job.mu.fractionCompleted = 1
+	}
+	status := job.mu.status
+	job.mu.Unlock()
+	if err != nil && status == storeJobFailed {
+		log.Warningf(ctx, "job %d failed: %s", job.id, err)
+	} else {
+		log.Infof(ctx, "job %d %s", job.id, status)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mu.finished = append(r.mu.finished, job.id)
+	for len(r.mu.finished) > maxFinishedStoreJobs {
+		delete(r.mu.jobs, r.mu.finished[0])
+		r.mu.finished = r.mu.finished[1:]
+	}
+}
+
+// list returns the jobs the registry knows about, sorted by ID.
+func (r *storeJobRegistry) list() []StoreJob {
+	r.mu.Lock()
+	jobs := make([]*storeJob, 0, len(r.mu.jobs))
+	for _, job := range r.mu.jobs {
+		jobs = append(jobs, job)
+	}
+	r.mu.Unlock()
+
+	result := make([]StoreJob, len(jobs))
+	for i, job := range jobs {
+		result[i] = job.proto()
+	}
+	sort.Sort(storeJobsByID(result))
+	return result
+}
+
+type storeJobsByID []StoreJob
+
+func (s storeJobsByID) Len() int           { return len(s) }
+func (s storeJobsByID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s storeJobsByID) Less(i, j int) bool { return s[i].ID < s[j].ID }
+
+func (r *storeJobRegistry) get(id int64) (*storeJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.mu.jobs[id]
+	if !ok {
+		return nil, errors.Errorf("job %d not found", id)
+	}
+	return job, nil
+}
+
+// pause pauses the running job with the given ID at its next checkpoint.
+func (r *storeJobRegistry) pause(id int64) (StoreJob, error) {
+	job, err := r.get(id)
+	if err != nil {
+		return StoreJob{}, err
+	}
+	job.mu.Lock()
+	if job.mu.status != storeJobRunning {
+		defer job.mu.Unlock()
+		return StoreJob{}, errors.Errorf("job %d is %s, not %s", id, job.mu.status, storeJobRunning)
+	}
+	job.mu.status = storeJobPaused
+	job.mu.resume = make(chan struct{})
+	job.mu.Unlock()
+	return job.proto(), nil
+}
+
+// resume resumes the paused job with the given ID.
+func (r *storeJobRegistry) resume(id int64) (StoreJob, error) {
+	job, err := r.get(id)
+	if err != nil {
+		return StoreJob{}, err
+	}
+	job.mu.Lock()
+	if job.mu.status != storeJobPaused {
+		defer job.mu.Unlock()
+		return StoreJob{}, errors.Errorf("job %d is %s, not %s", id, job.mu.status, storeJobPaused)
+	}
+	job.mu.status = storeJobRunning
+	close(job.mu.resume)
+	job.mu.resume = nil
+	job.mu.Unlock()
+	return job.proto(), nil
+}
+
+// cancel cancels the running or paused job with the given ID. The job stops
+// at its next checkpoint.
+func (r *storeJobRegistry) cancel(id int64) (StoreJob, error) {
+	job, err := r.get(id)
+	if err != nil {
+		return StoreJob{}, err
+	}
+	job.mu.Lock()
+	if status := job.mu.status; status != storeJobRunning && status != storeJobPaused {
+		defer job.mu.Unlock()
+		return StoreJob{}, errors.Errorf("job %d has already %s", id, status)
+	}
+	job.mu.status = storeJobCanceled
+	job.mu.Unlock()
+	job.cancel()
+	return job.proto(), nil
+}
+
+// Jobs returns the jobs run on the store, sorted by ID. Finished jobs are
+// only reported until maxFinishedStoreJobs more jobs have finished.
+func (s *Store) Jobs() []StoreJob {
+	return s.jobs.list()
+}
+
+// PauseJob pauses the running job with the given ID.
+func (s *Store) PauseJob(id int64) (StoreJob, error) {
+	return s.jobs.pause(id)
+}
+
+// ResumeJob resumes the paused job with the given ID.
+func (s *Store) ResumeJob(id int64) (StoreJob, error) {
+	return s.jobs.resume(id)
+}
+
+// CancelJob cancels the running or paused job with the given ID.
+func (s *Store) CancelJob(id int64) (StoreJob, error) {
+	return s.jobs.cancel(id)
+}
+
+// StartCompaction starts a job compacting the store's engine, returning the
+// ID of the job. The job can only be paused or canceled before the
+// compaction begins.
+func (s *Store) StartCompaction() (int64, error) {
+	compactor, ok := s.engine.(interface {
+		Compact() error
+	})
+	if !ok {
+		return 0, errors.Errorf("%s: engine does not support compactions", s)
+	}
+	ctx := s.AnnotateCtx(context.Background())
+	return s.jobs.start(ctx, s.stopper, "manual compaction",
+		func(ctx context.Context, job *storeJob) error {
+			if err := job.checkpoint(ctx, 0); err != nil {
+				return err
+			}
+			return compactor.Compact()
+		})
+}
+
+// StartConsistencySweep starts a job running a consistency check on every
+// range for which the store holds the lease, returning the ID of the job.
+// Unlike the consistency queue, which paces its checks over the
+// ConsistencyCheckInterval, the sweep checks the ranges one after the other.
+func (s *Store) StartConsistencySweep() (int64, error) {
+	ctx := s.AnnotateCtx(context.Background())
+	return s.jobs.start(ctx, s.stopper, "consistency sweep",
+		func(ctx context.Context, job *storeJob) error {
+			var repls []*Replica
+			newStoreReplicaVisitor(s).Visit(func(r *Replica) bool {
+				repls = append(repls, r)
+				return true
+			})
+			var failures int
+			for i, r := range repls {
+				if err := job.checkpoint(ctx, float64(i)/float64(len(repls))); err != nil {
+					return err
+				}
+				if pErr := r.redirectOnOrAcquireLease(ctx); pErr != nil {
+					log.VEventf(ctx, 2, "%s: skipping consistency check: %s", r, pErr)
+					continue
+				}
+				if _, pErr := r.CheckConsistency(ctx, roachpb.CheckConsistencyRequest{}, r.Desc()); pErr != nil {
+					log.Warningf(ctx, "%s: consistency check failed: %s", r, pErr)
+					failures++
+				}
+			}
+			if failures > 0 {
+				return errors.Errorf("consistency checks failed on %d of %d ranges", failures, len(repls))
+			}
+			return nil
+		})
+}
@@ -0,0 +1,169 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
+)
+
+func expectStoreJob(t *testing.T, r *storeJobRegistry, id int64, status string, fraction float64) {
+	util.SucceedsSoon(t, func() error {
+		for _, job := range r.list() {
+			if job.ID != id {
+				continue
+			}
+			if job.Status != status || job.FractionCompleted != fraction {
+				return errors.Errorf("expected job %d to be %s at %.2f, got %+v", id, status, fraction, job)
+			}
+			return nil
+		}
+		return errors.Errorf("job %d not found", id)
+	})
+}
+
+// TestStoreJobRegistry verifies that jobs can be paused, resumed and
+// canceled at their checkpoints, and that their progress is reported.
+func TestStoreJobRegistry(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	r := newStoreJobRegistry()
+	ctx := context.Background()
+
+	// The job advances to the next checkpoint whenever it receives from
+	// step.
+	step := make(chan struct{})
+	steps := func(ctx context.Context, job *storeJob) error {
+		for i := 0; i < 4; i++ {
+			if err := job.checkpoint(ctx, float64(i)/4); err != nil {
+				return err
+			}
+			select {
+			case <-step:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+
+	id, err := r.start(ctx, stopper, "test", steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step <- struct{}{}
+	expectStoreJob(t, r, id, storeJobRunning, 0.25)
+
+	// A paused job stops at its next checkpoint until it is resumed.
+	if _, err := r.pause(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.pause(id); !testutils.IsError(err, "is paused, not running") {
+		t.Fatalf("expected pausing a paused job to fail, got %v", err)
+	}
+	step <- struct{}{}
+	expectStoreJob(t, r, id, storeJobPaused, 0.5)
+	select {
+	case step <- struct{}{}:
+		t.Fatal("paused job made progress")
+	default:
+	}
+	if _, err := r.resume(id); err != nil {
+		t.Fatal(err)
+	}
+	step <- struct{}{}
+	step <- struct{}{}
+	expectStoreJob(t, r, id, storeJobSucceeded, 1)
+	if _, err := r.cancel(id); !testutils.IsError(err, "has already succeeded") {
+		t.Fatalf("expected canceling a finished job to fail, got %v", err)
+	}
+
+	// Canceling a job stops it, even while it is paused.
+	id, err = r.start(ctx, stopper, "test", steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.pause(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.cancel(id); err != nil {
+		t.Fatal(err)
+	}
+	expectStoreJob(t, r, id, storeJobCanceled, 0)
+
+	// Errors are reported.
+	id, err = r.start(ctx, stopper, "test", func(context.Context, *storeJob) error {
+		return errors.New("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStoreJob(t, r, id, storeJobFailed, 0)
+	if jobs := r.list(); len(jobs) != 3 || jobs[2].Error != "boom" {
+		t.Errorf("expected the last of 3 jobs to have failed with boom, got %+v", jobs)
+	}
+
+	if _, err := r.pause(42); !testutils.IsError(err, "job 42 not found") {
+		t.Errorf("expected unknown job to be reported, got %v", err)
+	}
+}
+
+// TestStoreJobRegistryForgetsFinishedJobs verifies that only the most
+// recently finished jobs are kept.
+func TestStoreJobRegistryForgetsFinishedJobs(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper := stop.NewStopper()
+	defer stopper.Stop()
+	r := newStoreJobRegistry()
+
+	for i := 0; i < maxFinishedStoreJobs+10; i++ {
+		if _, err := r.start(context.Background(), stopper, "test",
+			func(context.Context, *storeJob) error { return nil },
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	util.SucceedsSoon(t, func() error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if len(r.mu.finished) != maxFinishedStoreJobs || len(r.mu.jobs) != maxFinishedStoreJobs {
+			return errors.Errorf("expected %d finished jobs, got %d of %d",
+				maxFinishedStoreJobs, len(r.mu.finished), len(r.mu.jobs))
+		}
+		return nil
+	})
+}
+
+// TestStoreConsistencySweep verifies that a consistency sweep checks the
+// store's ranges to completion.
+func TestStoreConsistencySweep(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	id, err := store.StartConsistencySweep()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStoreJob(t, store.jobs, id, storeJobSucceeded, 1)
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"math"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/elastic/gosigar"
+
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// The saturation levels of the resources accounted for by a store's
+// overload score. A resource used at its saturation level contributes a
+// score of 1, which marks the store as overloaded.
+var (
+	overloadCPUSaturation = settings.RegisterFloatSetting(
+		"kv.store_overload.cpu_saturation",
+		"fraction of the node's CPUs used by the process at which its stores are overloaded",
+		0.9,
+	)
+	overloadDiskLatencySaturation = settings.RegisterDurationSetting(
+		"kv.store_overload.disk_latency_saturation",
+		"99th percentile Raft log commit latency at which a store is overloaded",
+		500*time.Millisecond,
+	)
+	overloadL0FilesSaturation = settings.RegisterIntSetting(
+		"kv.store_overload.l0_files_saturation",
+		"number of RocksDB L0 files at which a store is overloaded",
+		20,
+	)
+	overloadSchedulerLagSaturation = settings.RegisterDurationSetting(
+		"kv.store_overload.raft_scheduler_lag_saturation",
+		"99th percentile Raft scheduler latency at which a store is overloaded",
+		time.Second,
+	)
+)
+
+// storeOverloadInputs are the measurements a store's overload score is
+// computed from.
+type storeOverloadInputs struct {
+	// cpu is the fraction of the node's CPUs used by the process.
+	cpu float64
+	// diskLatency is the 99th percentile latency of Raft log commits.
+	diskLatency time.Duration
+	// l0Files is the number of RocksDB L0 files.
+	l0Files int
+	// schedulerLag is the 99th percentile time ranges spend queued on the
+	// Raft scheduler.
+	schedulerLag time.Duration
+}
+
+// overloadScore returns the overload score of the inputs: the largest of the
+// resource usages, each as a fraction of its saturation level. Taking the
+// largest rather than, say, the mean means that a single saturated resource
+// is enough to mark the store as overloaded, however idle the others are.
+// Resources whose saturation level is set to zero are ignored.
+func (in storeOverloadInputs) overloadScore() float64 {
+	var score float64
+	add := func(usage, saturation float64) {
+		if saturation > 0 {
+			score = math.Max(score, usage/saturation)
+		}
+	}
+	add(in.cpu, overloadCPUSaturation.Get())
+	add(float64(in.diskLatency), float64(overloadDiskLatencySaturation.Get()))
+	add(float64(in.l0Files), float64(overloadL0FilesSaturation.Get()))
+	add(float64(in.schedulerLag), float64(overloadSchedulerLagSaturation.Get()))
+	return score
+}
+
+// storeOverload tracks a store's overload score, which is gossiped as part
+// of its capacity so that the allocator, the lease rebalancer and the
+// DistSender all act on the same signal.
+type storeOverload struct {
+	mu struct {
+		syncutil.Mutex
+		// lastCPUNanos is the CPU time used by the process as of
+		// lastSample.
+		lastCPUNanos int64
+		lastSample   time.Time
+		score        float64
+	}
+}
+
+// sampleCPU returns the fraction of the node's CPUs the process used since
+// the previous call, or zero on the first call or if the CPU time can't be
+// retrieved.
+func (o *storeOverload) sampleCPU() float64 {
+	cpu := gosigar.ProcTime{}
+	if err := cpu.Get(os.Getpid()); err != nil {
+		return 0
+	}
+	// cpu.{User,Sys} are in milliseconds.
+	cpuNanos := int64(cpu.User+cpu.Sys) * 1e6
+	now := timeutil.Now()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var fraction float64
+	if elapsed := now.Sub(o.mu.lastSample); !o.mu.lastSample.IsZero() && elapsed > 0 {
+		fraction = float64(cpuNanos-o.mu.lastCPUNanos) /
+			(float64(elapsed.Nanoseconds()) * float64(runtime.NumCPU()))
+	}
+	o.mu.lastCPUNanos = cpuNanos
+	o.mu.lastSample = now
+	return fraction
+}
+
+// update recomputes the overload score from the inputs and returns it.
+func (o *storeOverload) update(in storeOverloadInputs) float64 {
+	score := in.overloadScore()
+	o.mu.Lock()
+	o.mu.score = score
+	o.mu.Unlock()
+	return score
+}
+
+// score returns the overload score as of the last update.
+func (o *storeOverload) score() float64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.mu.score
+}
+
+// windowedP99 returns the 99th percentile of the values recorded by the
+// latency histogram over its current window.
+func windowedP99(h *metric.Histogram) time.Duration {
+	hist, _ := h.Windowed()
+	return time.Duration(hist.ValueAtQuantile(99))
+}
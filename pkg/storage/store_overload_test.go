@@ -0,0 +1,54 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/settings"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestStoreOverloadScore(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer settings.TestingSetFloat(overloadCPUSaturation, 0.8)()
+	defer settings.TestingSetDuration(overloadDiskLatencySaturation, 100*time.Millisecond)()
+	defer settings.TestingSetInt(overloadL0FilesSaturation, 20)()
+	defer settings.TestingSetDuration(overloadSchedulerLagSaturation, time.Second)()
+
+	testCases := []struct {
+		in       storeOverloadInputs
+		expected float64
+	}{
+		{storeOverloadInputs{}, 0},
+		{storeOverloadInputs{cpu: 0.4}, 0.5},
+		// The most saturated resource determines the score.
+		{storeOverloadInputs{cpu: 0.4, l0Files: 30}, 1.5},
+		{storeOverloadInputs{cpu: 0.4, diskLatency: 200 * time.Millisecond}, 2},
+		{storeOverloadInputs{l0Files: 5, schedulerLag: time.Second}, 1},
+	}
+	for i, c := range testCases {
+		if score := c.in.overloadScore(); score != c.expected {
+			t.Errorf("%d: expected score %.2f, got %.2f", i, c.expected, score)
+		}
+	}
+
+	// Resources without a saturation level are ignored.
+	defer settings.TestingSetInt(overloadL0FilesSaturation, 0)()
+	if score := (storeOverloadInputs{cpu: 0.4, l0Files: 30}).overloadScore(); score != 0.5 {
+		t.Errorf("expected score 0.50, got %.2f", score)
+	}
+}
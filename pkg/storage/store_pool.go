@@ -20,7 +20,9 @@ import (
 	"bytes"
 	"container/heap"
 	"fmt"
+	"math"
 	"sort"
+	"strings"
 	"time"
 
 	"golang.org/x/net/context"
@@ -29,14 +31,36 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/util/envutil"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 )
 
+// TimeUntilStoreDead is the time after which a store is considered dead once
+// the liveness record of its node has expired or, if the node's liveness is
+// unknown, once the store hasn't been gossiped. Its default on a node can be
+// overridden with the COCKROACH_TIME_UNTIL_STORE_DEAD environment variable.
+var TimeUntilStoreDead = settings.RegisterDurationSetting(
+	"server.time_until_store_dead",
+	"the time after which a store is considered dead once its node's liveness has expired",
+	envutil.EnvOrDefaultDuration("COCKROACH_TIME_UNTIL_STORE_DEAD", 5*time.Minute),
+)
+
+// unknownStoreExpiry is the time after which the StorePool forgets a store
+// which was referenced, e.g. by a replica descriptor, but never gossiped its
+// descriptor. Such stores are typically mistyped or long gone, and would
+// otherwise be counted as dead forever.
+var unknownStoreExpiry = settings.RegisterDurationSetting(
+	"server.store_pool.unknown_store_expiry",
+	"the time after which a store which was referenced but never gossiped is forgotten",
+	time.Hour,
+)
+
 const (
 	// TestTimeUntilStoreDead is the test value for TimeUntilStoreDead to
 	// quickly mark stores as dead.
@@ -46,6 +70,11 @@ const (
 	// prevents the store pool from marking stores as dead.
 	TestTimeUntilStoreDeadOff = 24 * time.Hour
 
+	// maxDeadStoreCheckInterval bounds the time the StorePool waits before
+	// checking for dead stores again, so that changes to TimeUntilStoreDead
+	// take effect promptly.
+	maxDeadStoreCheckInterval = time.Second
+
 	// defaultFailedReservationsTimeout is the amount of time to consider the
 	// store throttled for up-replication after a failed reservation call.
 	defaultFailedReservationsTimeout = 5 * time.Second
@@ -55,6 +84,109 @@ const (
 	defaultDeclinedReservationsTimeout = 0 * time.Second
 )
 
+// Store pool metric names.
+var (
+	metaStorePoolAliveStores = metric.Metadata{
+		Name: "storepool.stores.alive",
+		Help: "Number of stores which are alive and not throttled"}
+	metaStorePoolDeadStores = metric.Metadata{
+		Name: "storepool.stores.dead",
+		Help: "Number of stores considered dead"}
+	metaStorePoolThrottledStores = metric.Metadata{
+		Name: "storepool.stores.throttled",
+		Help: "Number of stores which are currently throttled"}
+	metaStorePoolUnknownStores = metric.Metadata{
+		Name: "storepool.stores.unknown",
+		Help: "Number of stores whose descriptor has not been gossiped yet"}
+	metaStorePoolStoreDeaths = metric.Metadata{
+		Name: "storepool.deaths",
+		Help: "Number of times a store was considered dead"}
+	metaStorePoolThrottleEvents = metric.Metadata{
+		Name: "storepool.throttles",
+		Help: "Number of times a store was throttled"}
+
+	metaStorePoolThrottlesDeclined = metric.Metadata{
+		Name: "storepool.throttles.declined",
+		Help: "Number of times a store was throttled after declining a snapshot"}
+	metaStorePoolThrottlesFailed = metric.Metadata{
+		Name: "storepool.throttles.failed",
+		Help: "Number of times a store was throttled after failing to apply a snapshot"}
+
+	metaStorePoolRangeImbalance = metric.Metadata{
+		Name: "storepool.imbalance.ranges",
+		Help: "Largest deviation of a store's range count from the mean, as a fraction of the mean"}
+	metaStorePoolLeaseImbalance = metric.Metadata{
+		Name: "storepool.imbalance.leases",
+		Help: "Largest deviation of a store's lease count from the mean, as a fraction of the mean"}
+	metaStorePoolExcessReplicas = metric.Metadata{
+		Name: "storepool.rebalance.excess_replicas",
+		Help: "Number of replicas which have to move for no store to be overfull"}
+	metaStorePoolRebalanceETA = metric.Metadata{
+		Name: "storepool.rebalance.eta",
+		Help: "Estimated nanoseconds until no store is overfull, or -1 if the cluster isn't converging"}
+	metaStorePoolRebalancesInProgress = metric.Metadata{
+		Name: "storepool.rebalance.in_progress",
+		Help: "Number of rebalancing moves started by the node's stores which haven't completed"}
+
+	metaStorePoolRecoveryBytesRemaining = metric.Metadata{
+		Name: "storepool.recovery.bytes_remaining",
+		Help: "Estimated logical bytes of the dead stores which remain to be re-replicated"}
+	metaStorePoolRecoveryETA = metric.Metadata{
+		Name: "storepool.recovery.eta",
+		Help: "Estimated nanoseconds until the replicas of the dead stores are re-replicated, or -1 if unknown"}
+)
+
+// StorePoolMetrics holds metrics describing the health of the stores known
+// to a StorePool. Every known store is counted by exactly one of the store
+// gauges: a store is unknown until its descriptor has been gossiped, and
+// throttled stores are not counted as alive.
+type StorePoolMetrics struct {
+	AliveStores     *metric.Gauge
+	DeadStores      *metric.Gauge
+	ThrottledStores *metric.Gauge
+	UnknownStores   *metric.Gauge
+	StoreDeaths     *metric.Counter
+	ThrottleEvents  *metric.Counter
+	// ThrottlesDeclined and ThrottlesFailed break ThrottleEvents down by
+	// reason.
+	ThrottlesDeclined *metric.Counter
+	ThrottlesFailed   *metric.Counter
+
+	// The balance of the cluster; see ClusterBalance and RebalanceProgress.
+	RangeImbalance       *metric.GaugeFloat64
+	LeaseImbalance       *metric.GaugeFloat64
+	ExcessReplicas       *metric.Gauge
+	RebalanceETA         *metric.Gauge
+	RebalancesInProgress *metric.Gauge
+
+	// The recovery of the dead stores; see RecoveryEstimate.
+	RecoveryBytesRemaining *metric.Gauge
+	RecoveryETA            *metric.Gauge
+}
+
+func makeStorePoolMetrics() StorePoolMetrics {
+	return StorePoolMetrics{
+		AliveStores:     metric.NewGauge(metaStorePoolAliveStores),
+		DeadStores:      metric.NewGauge(metaStorePoolDeadStores),
+		ThrottledStores: metric.NewGauge(metaStorePoolThrottledStores),
+		UnknownStores:   metric.NewGauge(metaStorePoolUnknownStores),
+		StoreDeaths:     metric.NewCounter(metaStorePoolStoreDeaths),
+		ThrottleEvents:  metric.NewCounter(metaStorePoolThrottleEvents),
+
+		ThrottlesDeclined: metric.NewCounter(metaStorePoolThrottlesDeclined),
+		ThrottlesFailed:   metric.NewCounter(metaStorePoolThrottlesFailed),
+
+		RangeImbalance:       metric.NewGaugeFloat64(metaStorePoolRangeImbalance),
+		LeaseImbalance:       metric.NewGaugeFloat64(metaStorePoolLeaseImbalance),
+		ExcessReplicas:       metric.NewGauge(metaStorePoolExcessReplicas),
+		RebalanceETA:         metric.NewGauge(metaStorePoolRebalanceETA),
+		RebalancesInProgress: metric.NewGauge(metaStorePoolRebalancesInProgress),
+
+		RecoveryBytesRemaining: metric.NewGauge(metaStorePoolRecoveryBytesRemaining),
+		RecoveryETA:            metric.NewGauge(metaStorePoolRecoveryETA),
+	}
+}
+
 type storeDetail struct {
 	ctx         context.Context
 	desc        *roachpb.StoreDescriptor
@@ -63,10 +195,33 @@ type storeDetail struct {
 	foundDeadOn hlc.Timestamp
 	// throttledUntil is when an throttled store can be considered available
 	// again due to a failed or declined Reserve RPC.
-	throttledUntil  time.Time
-	lastUpdatedTime hlc.Timestamp // This is also the priority for the queue.
-	index           int           // index of the item in the heap, required for heap.Interface
-	deadReplicas    map[roachpb.RangeID][]roachpb.ReplicaDescriptor
+	throttledUntil time.Time
+	// throttleReason is the reason the store was last throttled, and
+	// lastThrottled the time it was.
+	throttleReason throttleReason
+	lastThrottled  time.Time
+	// throttleCounts counts the times the store was throttled, by reason.
+	throttleCounts  [numThrottleReasons]int
+	lastUpdatedTime hlc.Timestamp
+	// deadAsOf is the time after which the store was last determined to be
+	// dead. It is the priority for the queue.
+	deadAsOf     time.Time
+	index        int // index of the item in the heap, required for heap.Interface
+	deadReplicas map[roachpb.RangeID][]roachpb.ReplicaDescriptor
+	// deadReplicaCount is the number of dead replicas the store last
+	// reported having. It exceeds the number of deadReplicas while a store
+	// with many dead replicas is still gossiping them page by page.
+	deadReplicaCount int
+	// rangeCount and fractionUsed are moving averages of the range count and
+	// fraction used of the store's gossiped descriptors.
+	rangeCount, fractionUsed ewma
+	// recovery is the state of the cluster when the store was last found
+	// dead; see RecoveryEstimate.
+	recovery *recoveryBaseline
+	// pendingSnapshots and pendingSnapshotBytes account for the preemptive
+	// snapshots this node is sending to the store; see reserveSnapshot.
+	pendingSnapshots     int32
+	pendingSnapshotBytes int64
 }
 
 // markDead sets the storeDetail to dead(inactive).
@@ -88,7 +243,39 @@ func (sd *storeDetail) markDead(foundDeadOn hlc.Timestamp) {
 func (sd *storeDetail) markAlive(foundAliveOn hlc.Timestamp, storeDesc *roachpb.StoreDescriptor) {
 	sd.desc = storeDesc
 	sd.dead = false
+	sd.recovery = nil
 	sd.lastUpdatedTime = foundAliveOn
+	if storeDesc != nil {
+		now, halfLife := foundAliveOn.GoTime(), capacityStatsHalfLife.Get()
+		sd.rangeCount.update(float64(storeDesc.Capacity.RangeCount), now, halfLife)
+		sd.fractionUsed.update(storeDesc.Capacity.FractionUsed(), now, halfLife)
+	}
+}
+
+// throttled returns whether the store should not be sent snapshots as of
+// now: either it declined or failed one recently, or the last capacity it
+// reported shows it has used up its reservation budget and would decline
+// them. The latter lasts until the store reports that it has budget again,
+// through gossip or in its response to a snapshot.
+//
+// The snapshots this node is sending to the store hold reservations on it
+// which it may not have reported yet, so its reservations are taken to be
+// at least those.
+func (sd *storeDetail) throttled(now time.Time) bool {
+	if sd.throttledUntil.After(now) {
+		return true
+	}
+	if sd.desc == nil {
+		return false
+	}
+	capacity := sd.desc.Capacity
+	if capacity.Reservations < sd.pendingSnapshots {
+		capacity.Reservations = sd.pendingSnapshots
+	}
+	if capacity.ReservedBytes < sd.pendingSnapshotBytes {
+		capacity.ReservedBytes = sd.pendingSnapshotBytes
+	}
+	return capacity.ReservationsExhausted()
 }
 
 // storeMatch is the return value for match().
@@ -98,6 +285,7 @@ type storeMatch int
 const (
 	storeMatchDead      storeMatch = iota // The store is not yet available or has been timed out.
 	storeMatchAlive                       // The store is alive, but its attributes didn't match the required ones.
+	storeMatchFull                        // The store is alive and its attributes matched, but it is too full to accept more replicas.
 	storeMatchThrottled                   // The store is alive and its attributes matched, but it is throttled.
 	storeMatchAvailable                   // The store is alive, available and its attributes matched.
 )
@@ -122,8 +310,17 @@ func (sd *storeDetail) match(now time.Time, constraints config.Constraints) stor
 		}
 	}
 
+	// The store must have room for another replica to be available: it must
+	// hold fewer than its maximum number of replicas and its disk must not be
+	// fuller than maxFractionUsedThreshold. Full stores are still valid
+	// sources when removing replicas, which doesn't consult match.
+	if sd.desc.Capacity.AtMaxRangeCount() ||
+		sd.desc.Capacity.FractionUsed() > maxFractionUsedThreshold.Get() {
+		return storeMatchFull
+	}
+
 	// The store must not have a recent declined reservation to be available.
-	if sd.throttledUntil.After(now) {
+	if sd.throttled(now) {
 		return storeMatchThrottled
 	}
 
@@ -141,7 +338,7 @@ func (pq storePoolPQ) Len() int {
 
 // Less implements the sort.Interface.
 func (pq storePoolPQ) Less(i, j int) bool {
-	return pq[i].lastUpdatedTime.Less(pq[j].lastUpdatedTime)
+	return pq[i].deadAsOf.Before(pq[j].deadAsOf)
 }
 
 // Swap implements the sort.Interface.
@@ -186,6 +383,13 @@ func (pq *storePoolPQ) enqueue(detail *storeDetail) {
 	}
 }
 
+// remove removes the detail from the priority queue, if it's queued.
+func (pq *storePoolPQ) remove(detail *storeDetail) {
+	if detail.index >= 0 {
+		heap.Remove(pq, detail.index)
+	}
+}
+
 // dequeue removes the next detail from the priority queue.
 func (pq *storePoolPQ) dequeue() *storeDetail {
 	if len(*pq) == 0 {
@@ -194,47 +398,85 @@ func (pq *storePoolPQ) dequeue() *storeDetail {
 	return heap.Pop(pq).(*storeDetail)
 }
 
+// NodeLivenessFunc returns the liveness record of the given node. The
+// StorePool uses it to determine when the stores of a node are dead.
+type NodeLivenessFunc func(roachpb.NodeID) (Liveness, error)
+
 // StorePool maintains a list of all known stores in the cluster and
 // information on their health.
 type StorePool struct {
 	ctx                         context.Context
 	clock                       *hlc.Clock
-	timeUntilStoreDead          time.Duration
+	nodeLivenessFn              NodeLivenessFunc
+	timeUntilStoreDead          *settings.DurationSetting
 	rpcContext                  *rpc.Context
 	failedReservationsTimeout   time.Duration
 	declinedReservationsTimeout time.Duration
 	resolver                    NodeAddressResolver
-	mu                          struct {
+	metrics                     StorePoolMetrics
+	// rebalanceHistory remembers the recent rebalancing moves of the ranges
+	// of the node's stores; see rebalanceReversalWindow.
+	rebalanceHistory *rebalanceHistory
+	// balanceSamples holds the excess replicas of the cluster over the last
+	// rebalanceProgressWindow, oldest first; see estimateConvergence.
+	balanceSamples struct {
+		syncutil.Mutex
+		samples []balanceSample
+	}
+	mu struct {
 		syncutil.RWMutex
 		// Each storeDetail is contained in both a map and a priorityQueue;
 		// pointers are used so that data can be kept in sync.
 		storeDetails map[roachpb.StoreID]*storeDetail
 		queue        storePoolPQ
+		// attrIndex indexes the stores by the attributes of their latest
+		// descriptors.
+		attrIndex storeAttrIndex
+		// storeListGeneration is incremented whenever the stores change in a
+		// way which can change the lists returned by getStoreList, which
+		// invalidates the cached lists.
+		storeListGeneration int64
+	}
+	// storeListCache holds the store lists computed by getStoreList for the
+	// current storeListGeneration. It is only accessed while holding mu (for
+	// reading, at least), so that the generation can't change under it.
+	storeListCache struct {
+		syncutil.Mutex
+		generation int64
+		entries    map[storeListCacheKey]storeListCacheEntry
 	}
 }
 
 // NewStorePool creates a StorePool and registers the store updating callback
-// with gossip.
+// with gossip. If nodeLivenessFn is nil, stores are considered dead once they
+// haven't been gossiped for timeUntilStoreDead. The value of timeUntilStoreDead
+// is read whenever it is used, so that it can be changed at runtime; outside of
+// tests it is TimeUntilStoreDead.
 func NewStorePool(
 	ctx context.Context,
 	g *gossip.Gossip,
 	clock *hlc.Clock,
 	rpcContext *rpc.Context,
-	timeUntilStoreDead time.Duration,
+	nodeLivenessFn NodeLivenessFunc,
+	timeUntilStoreDead *settings.DurationSetting,
 	stopper *stop.Stopper,
 ) *StorePool {
 	sp := &StorePool{
 		ctx:                ctx,
 		clock:              clock,
+		nodeLivenessFn:     nodeLivenessFn,
 		timeUntilStoreDead: timeUntilStoreDead,
 		rpcContext:         rpcContext,
 		failedReservationsTimeout: envutil.EnvOrDefaultDuration("COCKROACH_FAILED_RESERVATION_TIMEOUT",
 			defaultFailedReservationsTimeout),
 		declinedReservationsTimeout: envutil.EnvOrDefaultDuration("COCKROACH_DECLINED_RESERVATION_TIMEOUT",
 			defaultDeclinedReservationsTimeout),
-		resolver: GossipAddressResolver(g),
+		resolver:         GossipAddressResolver(g),
+		metrics:          makeStorePoolMetrics(),
+		rebalanceHistory: newRebalanceHistory(rebalanceHistorySize),
 	}
 	sp.mu.storeDetails = make(map[roachpb.StoreID]*storeDetail)
+	sp.mu.attrIndex = storeAttrIndex{}
 	heap.Init(&sp.mu.queue)
 	storeRegex := gossip.MakePrefixPattern(gossip.KeyStorePrefix)
 	g.RegisterCallback(storeRegex, sp.storeGossipUpdate)
@@ -264,17 +506,66 @@ func (sp *StorePool) String() string {
 		if detail.dead {
 			_, _ = buf.WriteString("*")
 		}
-		fmt.Fprintf(&buf, ": range-count=%d fraction-used=%.2f",
-			detail.desc.Capacity.RangeCount, detail.desc.Capacity.FractionUsed())
+		fmt.Fprintf(&buf, ": range-count=%d lease-count=%d fraction-used=%.2f "+
+			"writes-per-second=%.1f queries-per-second=%.1f",
+			detail.desc.Capacity.RangeCount, detail.desc.Capacity.LeaseCount,
+			detail.desc.Capacity.FractionUsed(),
+			detail.desc.Capacity.WritesPerSecond, detail.desc.Capacity.QueriesPerSecond)
+		if detail.desc.Capacity.AtMaxRangeCount() {
+			_, _ = buf.WriteString(" [full]")
+		}
 		throttled := detail.throttledUntil.Sub(now)
 		if throttled > 0 {
-			fmt.Fprintf(&buf, " [throttled=%.1fs]", throttled.Seconds())
+			fmt.Fprintf(&buf, " [throttled=%.1fs reason=%s]", throttled.Seconds(), detail.throttleReason)
+		}
+		if c := detail.desc.Capacity; c.ReservationsExhausted() {
+			fmt.Fprintf(&buf, " [reservations=%d/%d reserved-bytes=%d/%d]",
+				c.Reservations, c.MaxReservations, c.ReservedBytes, c.MaxReservedBytes)
+		}
+		if !detail.lastThrottled.IsZero() {
+			fmt.Fprintf(&buf, " throttles(declined=%d failed=%d last=%s)",
+				detail.throttleCounts[throttleDeclined], detail.throttleCounts[throttleFailed],
+				detail.lastThrottled.Format(time.RFC3339))
 		}
 		_, _ = buf.WriteString("\n")
 	}
 	return buf.String()
 }
 
+// Metrics returns the StorePool's metrics.
+func (sp *StorePool) Metrics() StorePoolMetrics {
+	return sp.metrics
+}
+
+// updateMetrics recomputes the StorePool's store, balance and recovery gauges.
+// Throttling expires with time rather than through an event, so this is
+// called periodically.
+func (sp *StorePool) updateMetrics() {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+
+	now := sp.clock.Now().GoTime()
+	var alive, dead, throttled, unknown int64
+	for _, detail := range sp.mu.storeDetails {
+		switch {
+		case detail.dead:
+			dead++
+		case detail.desc == nil:
+			unknown++
+		case detail.throttled(now):
+			throttled++
+		default:
+			alive++
+		}
+	}
+	sp.metrics.AliveStores.Update(alive)
+	sp.metrics.DeadStores.Update(dead)
+	sp.metrics.ThrottledStores.Update(throttled)
+	sp.metrics.UnknownStores.Update(unknown)
+	sp.updateBalanceMetrics(now, sp.clusterBalanceLocked())
+	sp.updateRecoveryMetricsLocked()
+}
+
 // storeGossipUpdate is the gossip callback used to keep the StorePool up to date.
 func (sp *StorePool) storeGossipUpdate(_ string, content roachpb.Value) {
 	var storeDesc roachpb.StoreDescriptor
@@ -287,8 +578,29 @@ func (sp *StorePool) storeGossipUpdate(_ string, content roachpb.Value) {
 	defer sp.mu.Unlock()
 	// Does this storeDetail exist yet?
 	detail := sp.getStoreDetailLocked(storeDesc.StoreID)
+	if detail.desc != nil {
+		sp.mu.attrIndex.remove(storeDesc.StoreID, detail.desc.CombinedAttrs())
+	}
+	sp.mu.attrIndex.add(storeDesc.StoreID, storeDesc.CombinedAttrs())
 	detail.markAlive(sp.clock.Now(), &storeDesc)
+	detail.deadAsOf = sp.deadAsOf(detail)
 	sp.mu.queue.enqueue(detail)
+	sp.invalidateStoreListsLocked()
+}
+
+// deadAsOf returns the time after which the store is to be considered dead.
+// When the liveness record of the store's node is known, the store is dead
+// once that record has been expired for timeUntilStoreDead, regardless of how
+// recently the store was gossiped. Otherwise, the store is dead once it
+// hasn't been gossiped for timeUntilStoreDead.
+func (sp *StorePool) deadAsOf(detail *storeDetail) time.Time {
+	timeUntilStoreDead := sp.timeUntilStoreDead.Get()
+	if sp.nodeLivenessFn != nil && detail.desc != nil {
+		if liveness, err := sp.nodeLivenessFn(detail.desc.Node.NodeID); err == nil {
+			return liveness.Expiration.GoTime().Add(timeUntilStoreDead)
+		}
+	}
+	return detail.lastUpdatedTime.GoTime().Add(timeUntilStoreDead)
 }
 
 // deadReplicasGossipUpdate is the gossip callback used to keep the StorePool up to date.
@@ -303,14 +615,69 @@ func (sp *StorePool) deadReplicasGossipUpdate(_ string, content roachpb.Value) {
 	defer sp.mu.Unlock()
 	detail := sp.getStoreDetailLocked(replicas.StoreID)
 	deadReplicas := make(map[roachpb.RangeID][]roachpb.ReplicaDescriptor)
+	total := int(replicas.TotalCount)
+	if total > len(replicas.Replicas) {
+		// The store gossiped a page of its dead replicas, which adds to those
+		// of the pages it gossiped before.
+		for rangeID, repls := range detail.deadReplicas {
+			deadReplicas[rangeID] = repls
+		}
+	} else {
+		// The store gossiped all of its dead replicas. Stores which don't
+		// page through their dead replicas leave the total count unset.
+		total = len(replicas.Replicas)
+	}
 	for _, r := range replicas.Replicas {
-		deadReplicas[r.RangeID] = append(deadReplicas[r.RangeID], r.Replica)
+		repls := deadReplicas[r.RangeID]
+		known := false
+		for _, repl := range repls {
+			if repl.ReplicaID == r.Replica.ReplicaID {
+				known = true
+				break
+			}
+		}
+		if !known {
+			deadReplicas[r.RangeID] = append(repls[:len(repls):len(repls)], r.Replica)
+		}
 	}
 	detail.deadReplicas = deadReplicas
+	detail.deadReplicaCount = total
+}
+
+// removeDeadReplica forgets that the given replica of the range, which is on
+// the store, is dead. It is called once the replica has been removed from the
+// range, so that the StorePool doesn't keep reporting it until the store
+// gossips its dead replicas again.
+func (sp *StorePool) removeDeadReplica(
+	storeID roachpb.StoreID, rangeID roachpb.RangeID, replicaID roachpb.ReplicaID,
+) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	detail, ok := sp.mu.storeDetails[storeID]
+	if !ok {
+		return
+	}
+	repls := detail.deadReplicas[rangeID]
+	for i, repl := range repls {
+		if repl.ReplicaID == replicaID {
+			repls = append(repls[:i:i], repls[i+1:]...)
+			break
+		}
+	}
+	if len(repls) == 0 {
+		delete(detail.deadReplicas, rangeID)
+	} else {
+		detail.deadReplicas[rangeID] = repls
+	}
 }
 
-// start will run continuously and mark stores as offline if they haven't been
-// heard from in longer than timeUntilStoreDead.
+// start will run continuously and mark stores as offline once their deadAsOf
+// time has passed. Stores are queued by the deadline computed when they were
+// last gossiped; as node liveness heartbeats or a change to timeUntilStoreDead
+// may have moved it since, the deadline of the store at the head of the queue
+// is recomputed before the store is marked dead. The loop never sleeps for more
+// than maxDeadStoreCheckInterval so that a shortened timeUntilStoreDead is
+// noticed promptly.
 func (sp *StorePool) start(stopper *stop.Stopper) {
 	stopper.RunWorker(func() {
 		var timeoutTimer timeutil.Timer
@@ -318,17 +685,28 @@ func (sp *StorePool) start(stopper *stop.Stopper) {
 		for {
 			var timeout time.Duration
 			sp.mu.Lock()
+			sp.expireUnknownStoresLocked(sp.clock.Now())
 			detail := sp.mu.queue.peek()
 			if detail == nil {
-				// No stores yet, wait the full timeout.
-				timeout = sp.timeUntilStoreDead
+				// No stores yet.
+				timeout = maxDeadStoreCheckInterval
 			} else {
 				// Check to see if the store should be marked as dead.
-				deadAsOf := detail.lastUpdatedTime.GoTime().Add(sp.timeUntilStoreDead)
+				deadAsOf := sp.deadAsOf(detail)
 				now := sp.clock.Now()
-				if now.GoTime().After(deadAsOf) {
+				if !deadAsOf.Equal(detail.deadAsOf) {
+					// The deadline moved; requeue the store and look at the
+					// head of the queue again.
+					detail.deadAsOf = deadAsOf
+					sp.mu.queue.enqueue(detail)
+					timeout = 0
+				} else if now.GoTime().After(deadAsOf) {
 					deadDetail := sp.mu.queue.dequeue()
 					deadDetail.markDead(now)
+					sp.recordRecoveryBaselineLocked(deadDetail)
+					sp.metrics.StoreDeaths.Inc(1)
+					sp.markNodeStoresDeadLocked(deadDetail, now)
+					sp.invalidateStoreListsLocked()
 					// The next store might be dead as well, set the timeout to
 					// 0 to process it immediately.
 					timeout = 0
@@ -339,6 +717,9 @@ func (sp *StorePool) start(stopper *stop.Stopper) {
 				}
 			}
 			sp.mu.Unlock()
+			if timeout > maxDeadStoreCheckInterval {
+				timeout = maxDeadStoreCheckInterval
+			}
 			timeoutTimer.Reset(timeout)
 			select {
 			case <-timeoutTimer.C:
@@ -350,6 +731,80 @@ func (sp *StorePool) start(stopper *stop.Stopper) {
 	})
 }
 
+// markNodeStoresDeadLocked marks the other stores of the node of the given
+// store, which was just found dead, as dead too if they have stopped being
+// gossiped as well, that is if they are suspect. The stores of a node fail
+// together when the node does; treating them as a group lets the replicate
+// queues repair the ranges of all of them at once instead of waiting for each
+// store to time out on its own. sp.mu must be held.
+func (sp *StorePool) markNodeStoresDeadLocked(dead *storeDetail, now hlc.Timestamp) {
+	if dead.desc == nil {
+		return
+	}
+	timeUntilStoreDead := sp.timeUntilStoreDead.Get()
+	for _, detail := range sp.mu.storeDetails {
+		if detail == dead || detail.desc == nil || detail.desc.Node.NodeID != dead.desc.Node.NodeID {
+			continue
+		}
+		if detail.status(now.GoTime(), timeUntilStoreDead) != storeStatusSuspect {
+			continue
+		}
+		sp.mu.queue.remove(detail)
+		detail.markDead(now)
+		sp.recordRecoveryBaselineLocked(detail)
+		sp.metrics.StoreDeaths.Inc(1)
+	}
+}
+
+// removeStoreDetailLocked forgets the store. sp.mu must be held.
+func (sp *StorePool) removeStoreDetailLocked(storeID roachpb.StoreID) {
+	detail, ok := sp.mu.storeDetails[storeID]
+	if !ok {
+		return
+	}
+	sp.mu.queue.remove(detail)
+	if detail.desc != nil {
+		sp.mu.attrIndex.remove(storeID, detail.desc.CombinedAttrs())
+	}
+	delete(sp.mu.storeDetails, storeID)
+	sp.invalidateStoreListsLocked()
+}
+
+// expireUnknownStoresLocked forgets the stores which have never been gossiped
+// since they were first referenced, more than unknownStoreExpiry ago. Should
+// they be referenced again, they start over as if they had never been seen.
+// sp.mu must be held.
+func (sp *StorePool) expireUnknownStoresLocked(now hlc.Timestamp) {
+	expiry := unknownStoreExpiry.Get()
+	for storeID, detail := range sp.mu.storeDetails {
+		if detail.desc == nil && now.GoTime().Sub(detail.lastUpdatedTime.GoTime()) > expiry {
+			log.Infof(sp.ctx, "forgetting store %d, which was never gossiped", storeID)
+			sp.removeStoreDetailLocked(storeID)
+		}
+	}
+}
+
+// PurgeUnknownStores forgets the stores which have been found dead without
+// ever being gossiped, without waiting for unknownStoreExpiry. If storeID is
+// non-zero, only that store is considered. It returns the IDs of the
+// forgotten stores.
+func (sp *StorePool) PurgeUnknownStores(storeID roachpb.StoreID) roachpb.StoreIDSlice {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	var purged roachpb.StoreIDSlice
+	for id, detail := range sp.mu.storeDetails {
+		if (storeID == 0 || id == storeID) && detail.dead && detail.desc == nil {
+			purged = append(purged, id)
+		}
+	}
+	sort.Sort(purged)
+	for _, id := range purged {
+		sp.removeStoreDetailLocked(id)
+	}
+	return purged
+}
+
 // newStoreDetail makes a new storeDetail struct. It sets index to be -1 to
 // ensure that it will be processed by a queue immediately.
 func newStoreDetail(ctx context.Context) *storeDetail {
@@ -374,6 +829,7 @@ func (sp *StorePool) getStoreDetailLocked(storeID roachpb.StoreID) *storeDetail
 		detail = newStoreDetail(sp.ctx)
 		sp.mu.storeDetails[storeID] = detail
 		detail.markAlive(sp.clock.Now(), nil)
+		detail.deadAsOf = sp.deadAsOf(detail)
 		sp.mu.queue.enqueue(detail)
 	}
 
@@ -386,12 +842,180 @@ func (sp *StorePool) getStoreDescriptor(storeID roachpb.StoreID) (roachpb.StoreD
 	sp.mu.RLock()
 	defer sp.mu.RUnlock()
 
-	if detail, ok := sp.mu.storeDetails[storeID]; ok && detail.desc != nil {
+	return getStoreDescriptor(sp.mu.storeDetails, storeID)
+}
+
+func getStoreDescriptor(
+	details map[roachpb.StoreID]*storeDetail, storeID roachpb.StoreID,
+) (roachpb.StoreDescriptor, bool) {
+	if detail, ok := details[storeID]; ok && detail.desc != nil {
 		return *detail.desc, true
 	}
 	return roachpb.StoreDescriptor{}, false
 }
 
+// StoreHealth is the StorePool's view of a single store.
+type StoreHealth struct {
+	Desc      roachpb.StoreDescriptor
+	Dead      bool
+	TimesDied int
+	// Throttled is true if the store is not currently considered for new
+	// replicas after a failed or declined reservation, which it will not be
+	// until ThrottledUntil.
+	Throttled      bool
+	ThrottledUntil time.Time
+	// LastUpdated is when the store's descriptor was last received.
+	LastUpdated hlc.Timestamp
+	// DeadAsOf is the time after which the store will be (or was) considered
+	// dead.
+	DeadAsOf time.Time
+	// DeadReplicas is the number of replicas on the store which have been
+	// reported as dead.
+	DeadReplicas int
+	// TotalDeadReplicas is the number of dead replicas the store last
+	// reported having. It exceeds DeadReplicas while a store with many dead
+	// replicas is still gossiping them page by page.
+	TotalDeadReplicas int
+	// Recovery estimates the re-replication of the store's replicas if it
+	// is dead, and is nil otherwise.
+	Recovery *RecoveryEstimate
+}
+
+// GetStores returns the StorePool's view of every store for which it has
+// received a descriptor, sorted by store ID.
+func (sp *StorePool) GetStores() []StoreHealth {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+
+	var storeIDs roachpb.StoreIDSlice
+	for storeID, detail := range sp.mu.storeDetails {
+		if detail.desc != nil {
+			storeIDs = append(storeIDs, storeID)
+		}
+	}
+	sort.Sort(storeIDs)
+	now := sp.clock.Now().GoTime()
+	stores := make([]StoreHealth, 0, len(storeIDs))
+	for _, storeID := range storeIDs {
+		detail := sp.mu.storeDetails[storeID]
+		deadReplicas := detail.knownDeadReplicas()
+		totalDeadReplicas := detail.deadReplicaCount
+		if totalDeadReplicas < deadReplicas {
+			totalDeadReplicas = deadReplicas
+		}
+		stores = append(stores, StoreHealth{
+			Desc:              *detail.desc,
+			Dead:              detail.dead,
+			TimesDied:         detail.timesDied,
+			Throttled:         detail.throttled(now),
+			ThrottledUntil:    detail.throttledUntil,
+			LastUpdated:       detail.lastUpdatedTime,
+			DeadAsOf:          detail.deadAsOf,
+			DeadReplicas:      deadReplicas,
+			TotalDeadReplicas: totalDeadReplicas,
+			Recovery:          sp.recoveryEstimateLocked(storeID, detail),
+		})
+	}
+	return stores
+}
+
+// LocalityStats aggregates the alive stores of a single locality.
+type LocalityStats struct {
+	// Locality holds the tiers shared by all the stores of the locality.
+	Locality   roachpb.Locality
+	Nodes      int
+	Stores     int
+	Capacity   int64
+	Available  int64
+	RangeCount int64
+}
+
+// GetLocalityStats buckets the alive stores by the first numTiers tiers of
+// their localities and returns the aggregated stats of every bucket, sorted
+// by locality. For example, with numTiers = 1 the stores are bucketed by
+// region if that is the first tier of the localities, and with numTiers = 2
+// by zone within a region. Stores with fewer tiers are bucketed by the tiers
+// they have; in particular, stores without a locality form a single bucket
+// with an empty locality.
+func (sp *StorePool) GetLocalityStats(numTiers int) []LocalityStats {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+
+	buckets := map[string]*LocalityStats{}
+	nodes := map[string]map[roachpb.NodeID]struct{}{}
+	for _, detail := range sp.mu.storeDetails {
+		if detail.dead || detail.desc == nil {
+			continue
+		}
+		tiers := detail.desc.Node.Locality.Tiers
+		if len(tiers) > numTiers {
+			tiers = tiers[:numTiers]
+		}
+		locality := roachpb.Locality{Tiers: tiers}
+		key := locality.String()
+		stats, ok := buckets[key]
+		if !ok {
+			stats = &LocalityStats{
+				Locality: roachpb.Locality{Tiers: append([]roachpb.Tier(nil), tiers...)},
+			}
+			buckets[key] = stats
+			nodes[key] = map[roachpb.NodeID]struct{}{}
+		}
+		nodes[key][detail.desc.Node.NodeID] = struct{}{}
+		stats.Stores++
+		stats.Capacity += detail.desc.Capacity.Capacity
+		stats.Available += detail.desc.Capacity.Available
+		stats.RangeCount += int64(detail.desc.Capacity.RangeCount)
+	}
+
+	keys := make([]string, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]LocalityStats, 0, len(keys))
+	for _, key := range keys {
+		stats := buckets[key]
+		stats.Nodes = len(nodes[key])
+		result = append(result, *stats)
+	}
+	return result
+}
+
+// diversityScore returns a score in the interval [0, 1] describing how
+// diverse the locality of the given store is relative to the stores holding
+// the existing replicas: the lowest roachpb.Locality.DiversityScore between
+// the store and any of them. The store's own replica, if any, is ignored. A
+// store scores 1 when there are no other replicas to compare against.
+func (sp *StorePool) diversityScore(
+	store roachpb.StoreDescriptor, existing []roachpb.ReplicaDescriptor,
+) float64 {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return diversityScore(sp.mu.storeDetails, store, existing)
+}
+
+func diversityScore(
+	details map[roachpb.StoreID]*storeDetail,
+	store roachpb.StoreDescriptor,
+	existing []roachpb.ReplicaDescriptor,
+) float64 {
+	score := 1.0
+	for _, repl := range existing {
+		if repl.StoreID == store.StoreID {
+			continue
+		}
+		detail, ok := details[repl.StoreID]
+		if !ok || detail.desc == nil {
+			continue
+		}
+		if s := store.Node.Locality.DiversityScore(detail.desc.Node.Locality); s < score {
+			score = s
+		}
+	}
+	return score
+}
+
 // deadReplicas returns any replicas from the supplied slice that are
 // located on dead stores or dead replicas for the provided rangeID.
 func (sp *StorePool) deadReplicas(
@@ -401,23 +1025,101 @@ func (sp *StorePool) deadReplicas(
 	defer sp.mu.Unlock()
 
 	var deadReplicas []roachpb.ReplicaDescriptor
-outer:
 	for _, repl := range repls {
-		detail := sp.getStoreDetailLocked(repl.StoreID)
-		// Mark replica as dead if store is dead.
-		if detail.dead {
+		if sp.getStoreDetailLocked(repl.StoreID).isReplicaDead(rangeID, repl) {
 			deadReplicas = append(deadReplicas, repl)
-			continue
 		}
+	}
+	return deadReplicas
+}
 
-		for _, deadRepl := range detail.deadReplicas[rangeID] {
-			if deadRepl.ReplicaID == repl.ReplicaID {
-				deadReplicas = append(deadReplicas, repl)
-				continue outer
-			}
+// knownDeadReplicas returns the number of the store's dead replicas the
+// StorePool knows about.
+func (sd *storeDetail) knownDeadReplicas() int {
+	var n int
+	for _, repls := range sd.deadReplicas {
+		n += len(repls)
+	}
+	return n
+}
+
+// isReplicaDead returns whether the given replica of the range, which is on
+// the store, is dead, either because the store is or because the store
+// reported it to be.
+func (sd *storeDetail) isReplicaDead(rangeID roachpb.RangeID, repl roachpb.ReplicaDescriptor) bool {
+	// Mark replica as dead if store is dead.
+	if sd.dead {
+		return true
+	}
+	for _, deadRepl := range sd.deadReplicas[rangeID] {
+		if deadRepl.ReplicaID == repl.ReplicaID {
+			return true
 		}
 	}
-	return deadReplicas
+	return false
+}
+
+// storeStatus classifies a store by how desirable it is to keep a replica on
+// it. The statuses are ordered from the least to the most desirable.
+type storeStatus int
+
+const (
+	// storeStatusDead is the status of a store which is considered dead.
+	storeStatusDead storeStatus = iota
+	// storeStatusSuspect is the status of a store which has never been
+	// gossiped, or not for more than half the time until it is considered
+	// dead.
+	storeStatusSuspect
+	// storeStatusThrottled is the status of a store which recently declined
+	// or failed a reservation.
+	storeStatusThrottled
+	// storeStatusLive is the status of any other store.
+	storeStatusLive
+)
+
+func (s storeStatus) String() string {
+	switch s {
+	case storeStatusDead:
+		return "dead"
+	case storeStatusSuspect:
+		return "suspect"
+	case storeStatusThrottled:
+		return "throttled"
+	case storeStatusLive:
+		return "live"
+	default:
+		return fmt.Sprintf("storeStatus(%d)", int(s))
+	}
+}
+
+// status returns the status of the store as of now.
+func (sd *storeDetail) status(now time.Time, timeUntilStoreDead time.Duration) storeStatus {
+	if sd.dead {
+		return storeStatusDead
+	}
+	if sd.desc == nil || now.Sub(sd.lastUpdatedTime.GoTime()) > timeUntilStoreDead/2 {
+		return storeStatusSuspect
+	}
+	if sd.throttled(now) {
+		return storeStatusThrottled
+	}
+	return storeStatusLive
+}
+
+// replicaStatuses returns the statuses of the stores of the given replicas.
+// Stores the StorePool doesn't know about yet start being tracked, as they
+// are by deadReplicas.
+func (sp *StorePool) replicaStatuses(repls []roachpb.ReplicaDescriptor) []storeStatus {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	now := sp.clock.Now().GoTime()
+	timeUntilStoreDead := sp.timeUntilStoreDead.Get()
+	statuses := make([]storeStatus, len(repls))
+	for i, repl := range repls {
+		statuses[i] = sp.getStoreDetailLocked(repl.StoreID).status(now, timeUntilStoreDead)
+	}
+	return statuses
 }
 
 // stat provides a running sample size and running stats.
@@ -436,99 +1138,648 @@ func (s *stat) update(x float64) {
 	s.s = s.s + (x-oldMean)*(x-s.mean)
 }
 
+// capacityStatsHalfLife is the half-life of the moving averages of the range
+// counts and fractions used of the stores which the allocator uses to decide
+// whether to rebalance replicas away from a store. Zero makes the averages
+// the latest gossiped values.
+var capacityStatsHalfLife = settings.RegisterDurationSetting(
+	"kv.allocator.capacity_stats_half_life",
+	"half-life of the moving averages of store range counts and disk usage considered "+
+		"when rebalancing; zero uses the latest gossiped values",
+	0,
+)
+
+// ewma is an exponentially weighted moving average of a sampled value. The
+// weight of the previous samples decays with the time elapsed since the last
+// one rather than with the number of samples, as stores are gossiped at
+// irregular intervals.
+type ewma struct {
+	value float64
+	// at is when the last sample was taken; it is zero before the first.
+	at time.Time
+}
+
+// update adds a sample taken at now. The weight of a sample in the average
+// halves every halfLife; a half-life of zero makes the average the latest
+// sample.
+func (e *ewma) update(x float64, now time.Time, halfLife time.Duration) {
+	if e.at.IsZero() || halfLife <= 0 {
+		e.value = x
+	} else if elapsed := now.Sub(e.at); elapsed > 0 {
+		alpha := 1 - math.Exp2(-float64(elapsed)/float64(halfLife))
+		e.value += alpha * (x - e.value)
+	}
+	e.at = now
+}
+
 // StoreList holds a list of store descriptors and associated count and used
 // stats for those stores.
 type StoreList struct {
 	stores      []roachpb.StoreDescriptor
 	count, used stat
 
+	// smoothedCount and smoothedUsed track the same stats as count and used
+	// over the moving averages of the stores' range counts and fractions used
+	// (see kv.allocator.capacity_stats_half_life) rather than their latest
+	// gossiped values.
+	smoothedCount, smoothedUsed stat
+
+	// smoothedRangeCounts holds the moving average of the range count of each
+	// store in the list.
+	smoothedRangeCounts map[roachpb.StoreID]float64
+
 	// candidateCount tracks range count stats for stores that are eligible to
 	// be rebalance targets (their used capacity percentage must be lower than
 	// maxFractionUsedThreshold).
 	candidateCount stat
+
+	// candidateWrites tracks writes per second stats for the same set of
+	// stores as candidateCount.
+	candidateWrites stat
+
+	// candidateLogicalBytes tracks logical bytes stats for the same set of
+	// stores as candidateCount.
+	candidateLogicalBytes stat
+
+	// candidateLeases tracks lease count stats for the same set of stores as
+	// candidateCount.
+	candidateLeases stat
+
+	// candidateSmoothedCount tracks the moving averages of the range counts of
+	// the same set of stores as candidateCount.
+	candidateSmoothedCount stat
+
+	// existingLocalities holds the localities of the stores of the existing
+	// replicas of the range being placed, by store.
+	existingLocalities map[roachpb.StoreID]roachpb.Locality
+
+	// localityReplicaCounts holds the number of existing replicas of the range
+	// being placed in each locality, keyed by every prefix of the tiers of the
+	// replicas' localities (e.g. "region=us" and "region=us,zone=a").
+	localityReplicaCounts map[string]int
 }
 
 func (sl StoreList) String() string {
 	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "  candidate-count: mean=%v\n", sl.candidateCount.mean)
+	fmt.Fprintf(&buf, "  candidate-count: mean=%v smoothed-mean=%.1f\n",
+		sl.candidateCount.mean, sl.candidateSmoothedCount.mean)
+	fmt.Fprintf(&buf, "  candidate-writes: mean=%.1f\n", sl.candidateWrites.mean)
+	fmt.Fprintf(&buf, "  candidate-logical-bytes: mean=%.1f\n", sl.candidateLogicalBytes.mean)
+	fmt.Fprintf(&buf, "  candidate-leases: mean=%v\n", sl.candidateLeases.mean)
 	for _, desc := range sl.stores {
-		fmt.Fprintf(&buf, "  %d: range-count=%d fraction-used=%.2f\n",
-			desc.StoreID, desc.Capacity.RangeCount, desc.Capacity.FractionUsed())
+		fmt.Fprintf(&buf, "  %d: range-count=%d lease-count=%d fraction-used=%.2f writes-per-second=%.1f "+
+			"logical-bytes=%d\n",
+			desc.StoreID, desc.Capacity.RangeCount, desc.Capacity.LeaseCount,
+			desc.Capacity.FractionUsed(), desc.Capacity.WritesPerSecond, desc.Capacity.LogicalBytes)
 	}
 	return buf.String()
 }
 
 // add includes the store descriptor to the list of stores and updates
-// maintained statistics.
+// maintained statistics. The store's latest values stand in for its moving
+// averages.
 func (sl *StoreList) add(s roachpb.StoreDescriptor) {
+	sl.addSmoothed(s, float64(s.Capacity.RangeCount), s.Capacity.FractionUsed())
+}
+
+// addSmoothed is like add, but also takes the moving averages of the store's
+// range count and fraction used.
+func (sl *StoreList) addSmoothed(s roachpb.StoreDescriptor, rangeCount, fractionUsed float64) {
 	sl.stores = append(sl.stores, s)
 	sl.count.update(float64(s.Capacity.RangeCount))
 	sl.used.update(s.Capacity.FractionUsed())
-	if s.Capacity.FractionUsed() <= maxFractionUsedThreshold {
+	sl.smoothedCount.update(rangeCount)
+	sl.smoothedUsed.update(fractionUsed)
+	if sl.smoothedRangeCounts == nil {
+		sl.smoothedRangeCounts = make(map[roachpb.StoreID]float64)
+	}
+	sl.smoothedRangeCounts[s.StoreID] = rangeCount
+	if s.Capacity.FractionUsed() <= maxFractionUsedThreshold.Get() {
 		sl.candidateCount.update(float64(s.Capacity.RangeCount))
+		sl.candidateWrites.update(s.Capacity.WritesPerSecond)
+		sl.candidateLogicalBytes.update(float64(s.Capacity.LogicalBytes))
+		sl.candidateLeases.update(float64(s.Capacity.LeaseCount))
+		sl.candidateSmoothedCount.update(rangeCount)
+	}
+}
+
+// setExisting records the localities of the stores of the existing replicas
+// of the range being placed, and the number of replicas in each locality.
+// Replicas on stores without a descriptor are left out.
+func (sl *StoreList) setExisting(
+	details map[roachpb.StoreID]*storeDetail, existing []roachpb.ReplicaDescriptor,
+) {
+	sl.existingLocalities = make(map[roachpb.StoreID]roachpb.Locality, len(existing))
+	sl.localityReplicaCounts = make(map[string]int)
+	for _, repl := range existing {
+		detail, ok := details[repl.StoreID]
+		if !ok || detail.desc == nil {
+			continue
+		}
+		locality := detail.desc.Node.Locality
+		sl.existingLocalities[repl.StoreID] = locality
+		for i := 1; i <= len(locality.Tiers); i++ {
+			sl.localityReplicaCounts[roachpb.Locality{Tiers: locality.Tiers[:i]}.String()]++
+		}
+	}
+}
+
+// localityReplicaCount returns the number of existing replicas of the range
+// being placed within the given locality, i.e. on stores whose localities
+// start with its tiers, so that limits on the number of replicas per region,
+// zone etc. can be checked without looking at the stores again. An empty
+// locality contains all the replicas.
+func (sl StoreList) localityReplicaCount(locality roachpb.Locality) int {
+	if len(locality.Tiers) == 0 {
+		return len(sl.existingLocalities)
+	}
+	return sl.localityReplicaCounts[locality.String()]
+}
+
+// diversityScore is like StorePool.diversityScore, comparing the store
+// against the existing replicas of the range being placed.
+func (sl StoreList) diversityScore(store roachpb.StoreDescriptor) float64 {
+	score := 1.0
+	for storeID, locality := range sl.existingLocalities {
+		if storeID == store.StoreID {
+			continue
+		}
+		if s := store.Node.Locality.DiversityScore(locality); s < score {
+			score = s
+		}
+	}
+	return score
+}
+
+// smoothedRangeCount returns the moving average of the range count of the
+// store, or its latest range count if the store isn't in the list.
+func (sl StoreList) smoothedRangeCount(s roachpb.StoreDescriptor) float64 {
+	if rangeCount, ok := sl.smoothedRangeCounts[s.StoreID]; ok {
+		return rangeCount
+	}
+	return float64(s.Capacity.RangeCount)
+}
+
+// storeAttrIndex maps each attribute to the stores whose latest descriptors
+// have it, so that the stores satisfying a set of constraints can be found
+// without matching every store against them. Sets which become empty are
+// removed, so that attributes no store has any more don't accumulate.
+type storeAttrIndex map[string]map[roachpb.StoreID]struct{}
+
+func (idx storeAttrIndex) add(storeID roachpb.StoreID, attrs *roachpb.Attributes) {
+	for _, attr := range attrs.Attrs {
+		stores, ok := idx[attr]
+		if !ok {
+			stores = make(map[roachpb.StoreID]struct{})
+			idx[attr] = stores
+		}
+		stores[storeID] = struct{}{}
+	}
+}
+
+func (idx storeAttrIndex) remove(storeID roachpb.StoreID, attrs *roachpb.Attributes) {
+	for _, attr := range attrs.Attrs {
+		if stores, ok := idx[attr]; ok {
+			delete(stores, storeID)
+			if len(stores) == 0 {
+				delete(idx, attr)
+			}
+		}
+	}
+}
+
+// candidates returns the stores which may satisfy the constraints: those
+// having the constraint value with the fewest stores. The caller still needs
+// to match them against all the constraints. It returns false if the
+// constraints don't narrow down the stores.
+func (idx storeAttrIndex) candidates(
+	constraints config.Constraints,
+) (map[roachpb.StoreID]struct{}, bool) {
+	if idx == nil || len(constraints.Constraints) == 0 {
+		return nil, false
+	}
+	var smallest map[roachpb.StoreID]struct{}
+	for i, c := range constraints.Constraints {
+		stores := idx[c.Value]
+		if i == 0 || len(stores) < len(smallest) {
+			smallest = stores
+		}
+	}
+	return smallest, true
+}
+
+// clone returns a deep copy of the index.
+func (idx storeAttrIndex) clone() storeAttrIndex {
+	c := make(storeAttrIndex, len(idx))
+	for attr, stores := range idx {
+		storesCopy := make(map[roachpb.StoreID]struct{}, len(stores))
+		for storeID := range stores {
+			storesCopy[storeID] = struct{}{}
+		}
+		c[attr] = storesCopy
 	}
+	return c
 }
 
+// storeFilter selects which of the stores matching the constraints are
+// included in the list returned by getStoreList, so that each caller gets the
+// candidates appropriate to its operation. All filters but storeFilterNone
+// exclude ephemeral stores.
+type storeFilter int
+
+const (
+	// storeFilterNone includes all the matching stores, throttled and suspect
+	// ones alike. Removing replicas and moving leases isn't affected by a
+	// store's snapshot throttling.
+	storeFilterNone storeFilter = iota
+	// storeFilterThrottled excludes throttled stores, which won't accept the
+	// snapshot needed to add a replica.
+	storeFilterThrottled
+	// storeFilterSuspect excludes suspect stores, which haven't been gossiped
+	// recently and may be about to be considered dead.
+	storeFilterSuspect
+)
+
 // getStoreList returns a storeList that contains all active stores that
-// contain the required attributes and their associated stats. It also returns
-// the total number of alive and throttled stores.
-// TODO(embark, spencer): consider using a reverse index map from
-// Attr->stores, for efficiency. Ensure that entries in this map still
-// have an opportunity to be garbage collected.
+// contain the required attributes and their associated stats, minus those
+// excluded by the filter. It also returns the total number of alive and
+// throttled stores. The list also describes the localities of the existing
+// replicas of the range being placed; see StoreList.localityReplicaCount.
+//
+// The lists are cached until the stores change, a store's throttling or
+// gossip runs out, or the settings they depend on change, so that the
+// allocator doesn't recompute them for every range it looks at. Callers are
+// free to modify the returned list.
 func (sp *StorePool) getStoreList(
-	constraints config.Constraints, deterministic bool,
+	constraints config.Constraints,
+	existing []roachpb.ReplicaDescriptor,
+	filter storeFilter,
+	deterministic bool,
 ) (StoreList, int, int) {
 	sp.mu.RLock()
 	defer sp.mu.RUnlock()
 
+	now := sp.clock.Now().GoTime()
+	timeUntilStoreDead := sp.timeUntilStoreDead.Get()
+	key := storeListCacheKey{
+		constraints:   constraintsKey(constraints),
+		filter:        filter,
+		deterministic: deterministic,
+	}
+	sp.storeListCache.Lock()
+	defer sp.storeListCache.Unlock()
+	if sp.storeListCache.generation != sp.mu.storeListGeneration || sp.storeListCache.entries == nil {
+		sp.storeListCache.generation = sp.mu.storeListGeneration
+		sp.storeListCache.entries = map[storeListCacheKey]storeListCacheEntry{}
+	}
+	entry, ok := sp.storeListCache.entries[key]
+	if !ok || !entry.valid(now, timeUntilStoreDead) {
+		entry = storeListCacheEntry{
+			expiration:         storeListExpiration(sp.mu.storeDetails, now, timeUntilStoreDead),
+			timeUntilStoreDead: timeUntilStoreDead,
+			maxFractionUsed:    maxFractionUsedThreshold.Get(),
+		}
+		entry.sl, entry.aliveStoreCount, entry.throttledStoreCount = makeStoreList(
+			sp.mu.storeDetails, sp.mu.attrIndex, now, timeUntilStoreDead,
+			constraints, filter, deterministic)
+		sp.storeListCache.entries[key] = entry
+	}
+	sl := entry.sl
+	sl.stores = append([]roachpb.StoreDescriptor(nil), sl.stores...)
+	sl.setExisting(sp.mu.storeDetails, existing)
+	return sl, entry.aliveStoreCount, entry.throttledStoreCount
+}
+
+// invalidateStoreListsLocked discards the store lists cached by getStoreList.
+// It must be called whenever the stores change in a way which can change
+// these lists. sp.mu must be held exclusively.
+func (sp *StorePool) invalidateStoreListsLocked() {
+	sp.mu.storeListGeneration++
+}
+
+// storeListCacheKey identifies the arguments a cached store list was
+// computed for.
+type storeListCacheKey struct {
+	constraints   string
+	filter        storeFilter
+	deterministic bool
+}
+
+// constraintsKey returns a string identifying the constraints stores are
+// matched against.
+func constraintsKey(constraints config.Constraints) string {
+	strs := make([]string, len(constraints.Constraints))
+	for i, c := range constraints.Constraints {
+		strs[i] = c.String()
+	}
+	return strings.Join(strs, ",")
+}
+
+// storeListCacheEntry is a store list cached by getStoreList, along with what
+// it depends on beyond the stores themselves.
+type storeListCacheEntry struct {
+	sl                                   StoreList
+	aliveStoreCount, throttledStoreCount int
+	// expiration is when the status of one of the stores changes due to the
+	// passage of time alone; see storeListExpiration.
+	expiration         time.Time
+	timeUntilStoreDead time.Duration
+	maxFractionUsed    float64
+}
+
+// valid returns whether the entry can still be used.
+func (e storeListCacheEntry) valid(now time.Time, timeUntilStoreDead time.Duration) bool {
+	return (e.expiration.IsZero() || now.Before(e.expiration)) &&
+		e.timeUntilStoreDead == timeUntilStoreDead &&
+		e.maxFractionUsed == maxFractionUsedThreshold.Get()
+}
+
+// storeListExpiration returns the earliest time after now at which an alive
+// store stops being throttled or becomes suspect, or the zero time if there
+// is no such time. Stores becoming dead invalidate the store lists
+// explicitly.
+func storeListExpiration(
+	details map[roachpb.StoreID]*storeDetail, now time.Time, timeUntilStoreDead time.Duration,
+) time.Time {
+	var expiration time.Time
+	update := func(t time.Time) {
+		if t.After(now) && (expiration.IsZero() || t.Before(expiration)) {
+			expiration = t
+		}
+	}
+	for _, detail := range details {
+		if detail.dead || detail.desc == nil {
+			continue
+		}
+		update(detail.throttledUntil)
+		update(detail.lastUpdatedTime.GoTime().Add(timeUntilStoreDead / 2))
+	}
+	return expiration
+}
+
+// makeStoreList implements getStoreList. Only the stores found in the index
+// under the constraints' attributes are matched against the constraints; if
+// the index is nil, all stores are.
+func makeStoreList(
+	details map[roachpb.StoreID]*storeDetail,
+	index storeAttrIndex,
+	now time.Time,
+	timeUntilStoreDead time.Duration,
+	constraints config.Constraints,
+	filter storeFilter,
+	deterministic bool,
+) (StoreList, int, int) {
+	// Every live store counts, whether it satisfies the constraints or not,
+	// unless it is ephemeral and can't hold replicas at all.
+	var aliveStoreCount int
+	for _, detail := range details {
+		if !detail.dead && detail.desc != nil && !detail.desc.Ephemeral {
+			aliveStoreCount++
+		}
+	}
+
 	var storeIDs roachpb.StoreIDSlice
-	for storeID := range sp.mu.storeDetails {
-		storeIDs = append(storeIDs, storeID)
+	if candidates, ok := index.candidates(constraints); ok {
+		for storeID := range candidates {
+			if _, ok := details[storeID]; ok {
+				storeIDs = append(storeIDs, storeID)
+			}
+		}
+	} else {
+		for storeID := range details {
+			storeIDs = append(storeIDs, storeID)
+		}
 	}
 	// Sort the stores by key if deterministic is requested. This is only for
 	// unit testing.
 	if deterministic {
 		sort.Sort(storeIDs)
 	}
-	now := sp.clock.Now().GoTime()
 	sl := StoreList{}
-	var aliveStoreCount int
 	var throttledStoreCount int
 	for _, storeID := range storeIDs {
-		detail := sp.mu.storeDetails[storeID]
+		detail := details[storeID]
+		if filter != storeFilterNone && detail.desc != nil &&
+			(detail.desc.Ephemeral || detail.desc.ReadOnly) {
+			// Ephemeral and read-only stores are never targets for replicas or
+			// leases.
+			continue
+		}
 		// TODO(d4l3k): Sort by number of matches.
-		matched := detail.match(now, constraints)
-		switch matched {
-		case storeMatchAlive:
-			aliveStoreCount++
+		switch detail.match(now, constraints) {
 		case storeMatchThrottled:
-			aliveStoreCount++
 			throttledStoreCount++
+			if filter == storeFilterThrottled {
+				continue
+			}
 		case storeMatchAvailable:
-			aliveStoreCount++
-			sl.add(*detail.desc)
+		default:
+			continue
+		}
+		if filter == storeFilterSuspect && detail.status(now, timeUntilStoreDead) == storeStatusSuspect {
+			continue
 		}
+		sl.addSmoothed(*detail.desc, detail.rangeCount.value, detail.fractionUsed.value)
+	}
+	return sl, aliveStoreCount, throttledStoreCount
+}
+
+// storeMatches returns whether the given store is alive and its attributes
+// satisfy the given constraints. Throttled and full stores are considered to
+// match.
+func (sp *StorePool) storeMatches(storeID roachpb.StoreID, constraints config.Constraints) bool {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return storeMatches(sp.mu.storeDetails, sp.clock.Now().GoTime(), storeID, constraints)
+}
+
+func storeMatches(
+	details map[roachpb.StoreID]*storeDetail,
+	now time.Time,
+	storeID roachpb.StoreID,
+	constraints config.Constraints,
+) bool {
+	detail, ok := details[storeID]
+	if !ok {
+		return false
+	}
+	switch detail.match(now, constraints) {
+	case storeMatchFull, storeMatchThrottled, storeMatchAvailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// storePoolSnapshot is an immutable view of the stores known to a StorePool
+// at a point in time: their descriptors, liveness, throttling and dead
+// replicas. Making all the decisions of an allocator pass against a single
+// snapshot keeps them consistent with each other even as gossip updates the
+// StorePool, and the snapshot records what the decisions were based on.
+type storePoolSnapshot struct {
+	// now is when the snapshot was taken; throttling is evaluated as of then.
+	now          time.Time
+	storeDetails map[roachpb.StoreID]*storeDetail
+	attrIndex    storeAttrIndex
+	// timeUntilStoreDead is the value of the setting when the snapshot was
+	// taken.
+	timeUntilStoreDead time.Duration
+}
+
+// snapshot returns a snapshot of the StorePool. Stores holding the given
+// replicas which the StorePool doesn't know about yet start being tracked,
+// as they would be by deadReplicas, so that they will be considered dead if
+// they are never gossiped.
+func (sp *StorePool) snapshot(existing []roachpb.ReplicaDescriptor) *storePoolSnapshot {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for _, repl := range existing {
+		sp.getStoreDetailLocked(repl.StoreID)
+	}
+	snap := &storePoolSnapshot{
+		now:                sp.clock.Now().GoTime(),
+		storeDetails:       make(map[roachpb.StoreID]*storeDetail, len(sp.mu.storeDetails)),
+		attrIndex:          sp.mu.attrIndex.clone(),
+		timeUntilStoreDead: sp.timeUntilStoreDead.Get(),
+	}
+	for storeID, detail := range sp.mu.storeDetails {
+		// The descriptor and dead replicas of a storeDetail are replaced rather
+		// than modified when they are updated, so a shallow copy suffices.
+		detailCopy := *detail
+		snap.storeDetails[storeID] = &detailCopy
 	}
+	return snap
+}
+
+func (snap *storePoolSnapshot) getStoreList(
+	constraints config.Constraints,
+	existing []roachpb.ReplicaDescriptor,
+	filter storeFilter,
+	deterministic bool,
+) (StoreList, int, int) {
+	sl, aliveStoreCount, throttledStoreCount := makeStoreList(
+		snap.storeDetails, snap.attrIndex, snap.now, snap.timeUntilStoreDead,
+		constraints, filter, deterministic)
+	sl.setExisting(snap.storeDetails, existing)
 	return sl, aliveStoreCount, throttledStoreCount
 }
 
+func (snap *storePoolSnapshot) getStoreDescriptor(
+	storeID roachpb.StoreID,
+) (roachpb.StoreDescriptor, bool) {
+	return getStoreDescriptor(snap.storeDetails, storeID)
+}
+
+func (snap *storePoolSnapshot) diversityScore(
+	store roachpb.StoreDescriptor, existing []roachpb.ReplicaDescriptor,
+) float64 {
+	return diversityScore(snap.storeDetails, store, existing)
+}
+
+func (snap *storePoolSnapshot) deadReplicas(
+	rangeID roachpb.RangeID, repls []roachpb.ReplicaDescriptor,
+) []roachpb.ReplicaDescriptor {
+	var deadReplicas []roachpb.ReplicaDescriptor
+	for _, repl := range repls {
+		if detail, ok := snap.storeDetails[repl.StoreID]; ok && detail.isReplicaDead(rangeID, repl) {
+			deadReplicas = append(deadReplicas, repl)
+		}
+	}
+	return deadReplicas
+}
+
+func (snap *storePoolSnapshot) replicaStatuses(repls []roachpb.ReplicaDescriptor) []storeStatus {
+	statuses := make([]storeStatus, len(repls))
+	for i, repl := range repls {
+		// The snapshot tracks the stores of the replicas it was taken for; any
+		// other unknown store is as suspect as a store never gossiped.
+		statuses[i] = storeStatusSuspect
+		if detail, ok := snap.storeDetails[repl.StoreID]; ok {
+			statuses[i] = detail.status(snap.now, snap.timeUntilStoreDead)
+		}
+	}
+	return statuses
+}
+
+func (snap *storePoolSnapshot) storeMatches(
+	storeID roachpb.StoreID, constraints config.Constraints,
+) bool {
+	return storeMatches(snap.storeDetails, snap.now, storeID, constraints)
+}
+
+func (snap *storePoolSnapshot) String() string {
+	var storeIDs roachpb.StoreIDSlice
+	for storeID := range snap.storeDetails {
+		storeIDs = append(storeIDs, storeID)
+	}
+	sort.Sort(storeIDs)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "as of %s:", snap.now.UTC().Format(time.RFC3339Nano))
+	for _, storeID := range storeIDs {
+		detail := snap.storeDetails[storeID]
+		fmt.Fprintf(&buf, "\n  %d:", storeID)
+		switch {
+		case detail.dead:
+			buf.WriteString(" dead")
+		case detail.desc == nil:
+			buf.WriteString(" unknown")
+		default:
+			if detail.throttled(snap.now) {
+				fmt.Fprintf(&buf, " throttled(%s)", detail.throttleReason)
+			}
+			fmt.Fprintf(&buf, " range-count=%d lease-count=%d fraction-used=%.2f writes-per-second=%.1f",
+				detail.desc.Capacity.RangeCount, detail.desc.Capacity.LeaseCount,
+				detail.desc.Capacity.FractionUsed(), detail.desc.Capacity.WritesPerSecond)
+		}
+		if deadReplicas := detail.knownDeadReplicas(); deadReplicas > 0 {
+			fmt.Fprintf(&buf, " dead-replicas=%d", deadReplicas)
+			if detail.deadReplicaCount > deadReplicas {
+				fmt.Fprintf(&buf, "/%d", detail.deadReplicaCount)
+			}
+		}
+	}
+	return buf.String()
+}
+
 type throttleReason int
 
 const (
 	_ throttleReason = iota
 	throttleDeclined
 	throttleFailed
+
+	numThrottleReasons
 )
 
+func (r throttleReason) String() string {
+	switch r {
+	case throttleDeclined:
+		return "declined"
+	case throttleFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
 // throttle informs the store pool that the given remote store declined a
 // snapshot or failed to apply one, ensuring that it will not be considered
 // for up-replication or rebalancing until after the configured timeout period
 // has elapsed. Declined being true indicates that the remote store explicitly
-// declined a snapshot.
+// declined a snapshot. Independently of the timeout, a store which declines
+// snapshots for lack of reservation budget stays throttled until it reports
+// having budget again.
 func (sp *StorePool) throttle(reason throttleReason, toStoreID roachpb.StoreID) {
 	sp.mu.Lock()
 	defer sp.mu.Unlock()
 	detail := sp.getStoreDetailLocked(toStoreID)
+	now := sp.clock.Now().GoTime()
+	detail.throttleReason = reason
+	detail.lastThrottled = now
+	detail.throttleCounts[reason]++
+	sp.metrics.ThrottleEvents.Inc(1)
 
 	// If a snapshot is declined, be it due to an error or because it was
 	// rejected, we mark the store detail as having been declined so it won't
@@ -536,18 +1787,60 @@ func (sp *StorePool) throttle(reason throttleReason, toStoreID roachpb.StoreID)
 	// timeout period has passed.
 	switch reason {
 	case throttleDeclined:
-		detail.throttledUntil = sp.clock.Now().GoTime().Add(sp.declinedReservationsTimeout)
+		sp.metrics.ThrottlesDeclined.Inc(1)
+		detail.throttledUntil = now.Add(sp.declinedReservationsTimeout)
 		if log.V(2) {
 			log.Infof(sp.ctx, "snapshot declined, store:%s will be throttled for %s until %s",
 				toStoreID, sp.declinedReservationsTimeout, detail.throttledUntil)
 		}
 	case throttleFailed:
-		detail.throttledUntil = sp.clock.Now().GoTime().Add(sp.failedReservationsTimeout)
+		sp.metrics.ThrottlesFailed.Inc(1)
+		detail.throttledUntil = now.Add(sp.failedReservationsTimeout)
 		if log.V(2) {
 			log.Infof(sp.ctx, "snapshot failed, store:%s will be throttled for %s until %s",
 				toStoreID, sp.failedReservationsTimeout, detail.throttledUntil)
 		}
 	}
+	sp.invalidateStoreListsLocked()
+}
+
+// reserveSnapshot accounts for a preemptive snapshot of the given size about
+// to be sent to the store, until the returned function is called once the
+// snapshot is applied or has failed. Until then, the snapshot counts against
+// the reservation budget of the store, so that this node doesn't pick the
+// store for more snapshots than it accepts before the store reports its
+// reservations.
+func (sp *StorePool) reserveSnapshot(toStoreID roachpb.StoreID, bytes int64) func() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	detail := sp.getStoreDetailLocked(toStoreID)
+	detail.pendingSnapshots++
+	detail.pendingSnapshotBytes += bytes
+	sp.invalidateStoreListsLocked()
+	return func() {
+		sp.mu.Lock()
+		defer sp.mu.Unlock()
+		detail.pendingSnapshots--
+		detail.pendingSnapshotBytes -= bytes
+		sp.invalidateStoreListsLocked()
+	}
+}
+
+// updateLeaseTransferEstimate updates the StorePool's estimates of the lease
+// counts of the stores a lease was transferred between, until they gossip
+// their new counts. Otherwise, the allocator keeps picking the same store
+// with few leases for the leases of other ranges in the meantime, overshoots,
+// and moves the leases back once the store gossips that it holds too many.
+func (sp *StorePool) updateLeaseTransferEstimate(fromStoreID, toStoreID roachpb.StoreID) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if desc := sp.getStoreDetailLocked(fromStoreID).desc; desc != nil && desc.Capacity.LeaseCount > 0 {
+		desc.Capacity.LeaseCount--
+	}
+	if desc := sp.getStoreDetailLocked(toStoreID).desc; desc != nil {
+		desc.Capacity.LeaseCount++
+	}
+	sp.invalidateStoreListsLocked()
 }
 
 // updateRemoteCapacityEstimate updates the StorePool's estimate of the given
@@ -559,9 +1852,18 @@ func (sp *StorePool) updateRemoteCapacityEstimate(
 	defer sp.mu.Unlock()
 	// During tests, we might not have received a gossip update before trying to
 	// send a snapshot. In that case, desc could be nil here.
-	desc := sp.getStoreDetailLocked(toStoreID).desc
-	if desc != nil {
+	detail := sp.getStoreDetailLocked(toStoreID)
+	if desc := detail.desc; desc != nil {
 		// TODO(jordan,bram): Consider updating the full capacity here.
 		desc.Capacity.RangeCount = capacity.RangeCount
+		detail.rangeCount.update(float64(capacity.RangeCount),
+			sp.clock.Now().GoTime(), capacityStatsHalfLife.Get())
+		// The reservations keep the store throttled for as long as it has no
+		// budget for more snapshots; see storeDetail.throttled.
+		desc.Capacity.ReservedBytes = capacity.ReservedBytes
+		desc.Capacity.MaxReservedBytes = capacity.MaxReservedBytes
+		desc.Capacity.Reservations = capacity.Reservations
+		desc.Capacity.MaxReservations = capacity.MaxReservations
+		sp.invalidateStoreListsLocked()
 	}
 }
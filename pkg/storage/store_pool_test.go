@@ -19,6 +19,7 @@ package storage
 import (
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -29,6 +30,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/gossip"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/testutils/gossiputil"
 	"github.com/cockroachdb/cockroach/pkg/util"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
@@ -36,6 +38,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/metric"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/pkg/errors"
 )
@@ -59,6 +62,14 @@ var uniqueStore = []*roachpb.StoreDescriptor{
 // tests. Stopper must be stopped by the caller.
 func createTestStorePool(
 	timeUntilStoreDead time.Duration,
+) (*stop.Stopper, *gossip.Gossip, *hlc.ManualClock, *StorePool) {
+	return createTestStorePoolWithLiveness(timeUntilStoreDead, nil)
+}
+
+// createTestStorePoolWithLiveness is like createTestStorePool, but the
+// StorePool determines the liveness of stores using nodeLivenessFn.
+func createTestStorePoolWithLiveness(
+	timeUntilStoreDead time.Duration, nodeLivenessFn NodeLivenessFunc,
 ) (*stop.Stopper, *gossip.Gossip, *hlc.ManualClock, *StorePool) {
 	stopper := stop.NewStopper()
 	mc := hlc.NewManualClock(0)
@@ -73,7 +84,8 @@ func createTestStorePool(
 		g,
 		clock,
 		rpcContext,
-		timeUntilStoreDead,
+		nodeLivenessFn,
+		settings.TestingDurationSetting(timeUntilStoreDead),
 		stopper,
 	)
 	return stopper, g, mc, storePool
@@ -213,6 +225,120 @@ func TestStorePoolDies(t *testing.T) {
 	}
 }
 
+// TestStorePoolNodeStoresDieTogether verifies that once a store is found
+// dead, the other stores of its node which stopped being gossiped as well are
+// marked dead with it.
+func TestStorePoolNodeStoresDieTogether(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, mc, sp := createTestStorePool(time.Hour)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+
+	var stores []*roachpb.StoreDescriptor
+	for i, nodeID := range []roachpb.NodeID{1, 1, 1, 2} {
+		stores = append(stores, &roachpb.StoreDescriptor{
+			StoreID: roachpb.StoreID(i + 1),
+			Node:    roachpb.NodeDescriptor{NodeID: nodeID},
+		})
+	}
+	sg.GossipStores(stores, t)
+	// Stores 1, 2 and 4 become suspect, while store 3 keeps being gossiped.
+	mc.Increment((45 * time.Minute).Nanoseconds())
+	sg.GossipStores(stores[2:3], t)
+
+	sp.mu.Lock()
+	now := sp.clock.Now()
+	dead := sp.mu.storeDetails[1]
+	sp.mu.queue.remove(dead)
+	dead.markDead(now)
+	sp.markNodeStoresDeadLocked(dead, now)
+	for storeID, expDead := range map[roachpb.StoreID]bool{1: true, 2: true, 3: false, 4: false} {
+		if detail := sp.mu.storeDetails[storeID]; detail.dead != expDead {
+			t.Errorf("expected store %d to be dead=%t", storeID, expDead)
+		} else if expDead && detail.index != -1 {
+			t.Errorf("dead store %d is still queued", storeID)
+		}
+	}
+	sp.mu.Unlock()
+}
+
+// TestStorePoolNodeLiveness verifies that stores whose node has a liveness
+// record are considered dead based on that record rather than on how recently
+// they were gossiped.
+func TestStorePoolNodeLiveness(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var mu syncutil.Mutex
+	expiration := hlc.Timestamp{WallTime: time.Second.Nanoseconds()}
+	setExpiration := func(ts hlc.Timestamp) {
+		mu.Lock()
+		defer mu.Unlock()
+		expiration = ts
+	}
+	// Only node 1 has a liveness record.
+	livenessFn := func(nodeID roachpb.NodeID) (Liveness, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if nodeID != 1 {
+			return Liveness{}, ErrNoLivenessRecord
+		}
+		return Liveness{NodeID: nodeID, Expiration: expiration}, nil
+	}
+
+	stopper, g, mc, sp := createTestStorePoolWithLiveness(TestTimeUntilStoreDead, livenessFn)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+	sg.GossipStores([]*roachpb.StoreDescriptor{
+		{StoreID: 1, Node: roachpb.NodeDescriptor{NodeID: 1}},
+		{StoreID: 2, Node: roachpb.NodeDescriptor{NodeID: 2}},
+	}, t)
+
+	isDead := func(storeID roachpb.StoreID) bool {
+		sp.mu.RLock()
+		defer sp.mu.RUnlock()
+		return sp.mu.storeDetails[storeID].dead
+	}
+
+	// Store 2 falls back to timing out based on gossip, while store 1 is kept
+	// alive by its node's liveness record.
+	mc.Increment(2 * TestTimeUntilStoreDead.Nanoseconds())
+	waitUntilDead(t, mc, sp, 2)
+	if isDead(1) {
+		t.Fatal("store 1 is dead although its node is live")
+	}
+
+	// A heartbeat extends the deadline of store 1 even though the store isn't
+	// gossiped again.
+	setExpiration(hlc.Timestamp{WallTime: 3 * time.Second.Nanoseconds()})
+	mc.Increment(2 * time.Second.Nanoseconds())
+	extended := expiration.GoTime().Add(TestTimeUntilStoreDead)
+	util.SucceedsSoon(t, func() error {
+		sp.mu.RLock()
+		defer sp.mu.RUnlock()
+		if deadAsOf := sp.mu.storeDetails[1].deadAsOf; !deadAsOf.Equal(extended) {
+			return errors.Errorf("expected store 1 to be dead as of %s, got %s", extended, deadAsOf)
+		}
+		return nil
+	})
+	if isDead(1) {
+		t.Fatal("store 1 is dead although its node is live")
+	}
+
+	// Once the liveness record expires, store 1 dies, and gossiping it again
+	// doesn't revive it.
+	mc.Increment(2 * time.Second.Nanoseconds())
+	waitUntilDead(t, mc, sp, 1)
+	sg.GossipStores([]*roachpb.StoreDescriptor{
+		{StoreID: 1, Node: roachpb.NodeDescriptor{NodeID: 1}},
+	}, t)
+	waitUntilDead(t, mc, sp, 1)
+	sp.mu.RLock()
+	if timesDied := sp.mu.storeDetails[1].timesDied; timesDied != 2 {
+		t.Errorf("expected store 1 to have died twice, got %d", timesDied)
+	}
+	sp.mu.RUnlock()
+}
+
 // verifyStoreList ensures that the returned list of stores is correct.
 func verifyStoreList(
 	sp *StorePool,
@@ -222,7 +348,7 @@ func verifyStoreList(
 	expectedThrottledStoreCount int,
 ) error {
 	var actual []int
-	sl, aliveStoreCount, throttledStoreCount := sp.getStoreList(constraints, false)
+	sl, aliveStoreCount, throttledStoreCount := sp.getStoreList(constraints, nil, storeFilterThrottled, false)
 	if aliveStoreCount != expectedAliveStoreCount {
 		return errors.Errorf("expected AliveStoreCount %d does not match actual %d",
 			expectedAliveStoreCount, aliveStoreCount)
@@ -253,7 +379,7 @@ func TestStorePoolGetStoreList(t *testing.T) {
 	constraints := config.Constraints{Constraints: []config.Constraint{{Value: "ssd"}, {Value: "dc"}}}
 	required := []string{"ssd", "dc"}
 	// Nothing yet.
-	if sl, _, _ := sp.getStoreList(constraints, false); len(sl.stores) != 0 {
+	if sl, _, _ := sp.getStoreList(constraints, nil, storeFilterNone, false); len(sl.stores) != 0 {
 		t.Errorf("expected no stores, instead %+v", sl.stores)
 	}
 
@@ -287,6 +413,18 @@ func TestStorePoolGetStoreList(t *testing.T) {
 		Node:    roachpb.NodeDescriptor{NodeID: 1},
 		Attrs:   roachpb.Attributes{Attrs: required},
 	}
+	fullStore := roachpb.StoreDescriptor{
+		StoreID:  7,
+		Node:     roachpb.NodeDescriptor{NodeID: 1},
+		Attrs:    roachpb.Attributes{Attrs: required},
+		Capacity: roachpb.StoreCapacity{RangeCount: 10, MaxRangeCount: 10},
+	}
+	diskFullStore := roachpb.StoreDescriptor{
+		StoreID:  8,
+		Node:     roachpb.NodeDescriptor{NodeID: 1},
+		Attrs:    roachpb.Attributes{Attrs: required},
+		Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 2},
+	}
 
 	// Mark all alive initially.
 	sg.GossipStores([]*roachpb.StoreDescriptor{
@@ -296,6 +434,8 @@ func TestStorePoolGetStoreList(t *testing.T) {
 		&emptyStore,
 		&deadStore,
 		&declinedStore,
+		&fullStore,
+		&diskFullStore,
 	}, t)
 
 	if err := verifyStoreList(sp, constraints, []int{
@@ -303,7 +443,7 @@ func TestStorePoolGetStoreList(t *testing.T) {
 		int(supersetStore.StoreID),
 		int(deadStore.StoreID),
 		int(declinedStore.StoreID),
-	}, 6, 0); err != nil {
+	}, 8, 0); err != nil {
 		t.Error(err)
 	}
 
@@ -311,14 +451,510 @@ func TestStorePoolGetStoreList(t *testing.T) {
 	sp.mu.Lock()
 	sp.mu.storeDetails[deadStore.StoreID].markDead(sp.clock.Now())
 	sp.mu.storeDetails[declinedStore.StoreID].throttledUntil = sp.clock.Now().GoTime().Add(time.Hour)
+	sp.invalidateStoreListsLocked()
 	sp.mu.Unlock()
 
 	if err := verifyStoreList(sp, constraints, []int{
 		int(matchingStore.StoreID),
 		int(supersetStore.StoreID),
-	}, 5, 1); err != nil {
+	}, 7, 1); err != nil {
 		t.Error(err)
 	}
+
+	// A full store still satisfies constraints, e.g. for lease preferences.
+	for _, storeID := range []roachpb.StoreID{fullStore.StoreID, diskFullStore.StoreID} {
+		if !sp.storeMatches(storeID, constraints) {
+			t.Errorf("expected full store s%d to match constraints", storeID)
+		}
+	}
+
+	// Raising the disk fullness threshold takes effect immediately.
+	defer settings.TestingSetFloat(maxFractionUsedThreshold, 0.99)()
+	if err := verifyStoreList(sp, constraints, []int{
+		int(matchingStore.StoreID),
+		int(supersetStore.StoreID),
+		int(diskFullStore.StoreID),
+	}, 7, 1); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestStorePoolGetStoreListFilter verifies that the store filters exclude
+// throttled and suspect stores respectively.
+func TestStorePoolGetStoreListFilter(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, mc, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+
+	stores := []*roachpb.StoreDescriptor{
+		{StoreID: 1, Node: roachpb.NodeDescriptor{NodeID: 1}},
+		{StoreID: 2, Node: roachpb.NodeDescriptor{NodeID: 2}},
+		{StoreID: 3, Node: roachpb.NodeDescriptor{NodeID: 3}},
+	}
+	sg.GossipStores(stores, t)
+	// Store 1 isn't gossiped for more than half the time until it would be
+	// considered dead, which makes it suspect, and store 2 is throttled.
+	mc.Increment((TestTimeUntilStoreDeadOff/2 + time.Minute).Nanoseconds())
+	sg.GossipStores(stores[1:], t)
+	sp.throttle(throttleDeclined, 2)
+
+	testCases := []struct {
+		filter   storeFilter
+		expected []int
+	}{
+		{storeFilterNone, []int{1, 2, 3}},
+		{storeFilterThrottled, []int{1, 3}},
+		{storeFilterSuspect, []int{2, 3}},
+	}
+	for _, tc := range testCases {
+		sl, _, throttled := sp.getStoreList(config.Constraints{}, nil, tc.filter, true)
+		var actual []int
+		for _, store := range sl.stores {
+			actual = append(actual, int(store.StoreID))
+		}
+		if !reflect.DeepEqual(tc.expected, actual) {
+			t.Errorf("%d: expected stores %v, got %v", tc.filter, tc.expected, actual)
+		}
+		if throttled != 1 {
+			t.Errorf("%d: expected 1 throttled store, got %d", tc.filter, throttled)
+		}
+	}
+}
+
+// TestStorePoolGetStoreListEphemeral verifies that ephemeral stores are only
+// listed when the store list isn't filtered, and that they don't count as
+// alive stores.
+func TestStorePoolGetStoreListEphemeral(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+
+	sg.GossipStores([]*roachpb.StoreDescriptor{
+		{StoreID: 1, Node: roachpb.NodeDescriptor{NodeID: 1}},
+		{StoreID: 2, Node: roachpb.NodeDescriptor{NodeID: 1}, Ephemeral: true},
+		{StoreID: 3, Node: roachpb.NodeDescriptor{NodeID: 2}},
+	}, t)
+
+	testCases := []struct {
+		filter   storeFilter
+		expected []int
+	}{
+		{storeFilterNone, []int{1, 2, 3}},
+		{storeFilterThrottled, []int{1, 3}},
+		{storeFilterSuspect, []int{1, 3}},
+	}
+	for _, tc := range testCases {
+		sl, aliveStoreCount, _ := sp.getStoreList(config.Constraints{}, nil, tc.filter, true)
+		var actual []int
+		for _, store := range sl.stores {
+			actual = append(actual, int(store.StoreID))
+		}
+		if !reflect.DeepEqual(tc.expected, actual) {
+			t.Errorf("%d: expected stores %v, got %v", tc.filter, tc.expected, actual)
+		}
+		if aliveStoreCount != 2 {
+			t.Errorf("%d: expected 2 alive stores, got %d", tc.filter, aliveStoreCount)
+		}
+	}
+}
+
+// TestStorePoolGetStoreListReadOnly verifies that read-only stores are only
+// listed when the store list isn't filtered, but that they still count as
+// alive stores.
+func TestStorePoolGetStoreListReadOnly(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+
+	sg.GossipStores([]*roachpb.StoreDescriptor{
+		{StoreID: 1, Node: roachpb.NodeDescriptor{NodeID: 1}},
+		{StoreID: 2, Node: roachpb.NodeDescriptor{NodeID: 1}, ReadOnly: true},
+		{StoreID: 3, Node: roachpb.NodeDescriptor{NodeID: 2}},
+	}, t)
+
+	testCases := []struct {
+		filter   storeFilter
+		expected []int
+	}{
+		{storeFilterNone, []int{1, 2, 3}},
+		{storeFilterThrottled, []int{1, 3}},
+		{storeFilterSuspect, []int{1, 3}},
+	}
+	for _, tc := range testCases {
+		sl, aliveStoreCount, _ := sp.getStoreList(config.Constraints{}, nil, tc.filter, true)
+		var actual []int
+		for _, store := range sl.stores {
+			actual = append(actual, int(store.StoreID))
+		}
+		if !reflect.DeepEqual(tc.expected, actual) {
+			t.Errorf("%d: expected stores %v, got %v", tc.filter, tc.expected, actual)
+		}
+		if aliveStoreCount != 3 {
+			t.Errorf("%d: expected 3 alive stores, got %d", tc.filter, aliveStoreCount)
+		}
+	}
+}
+
+// TestStorePoolGetLocalityStats verifies that alive stores are aggregated by
+// the requested number of locality tiers.
+func TestStorePoolGetLocalityStats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+
+	makeStore := func(storeID, nodeID int, locality string) *roachpb.StoreDescriptor {
+		desc := &roachpb.StoreDescriptor{
+			StoreID: roachpb.StoreID(storeID),
+			Node:    roachpb.NodeDescriptor{NodeID: roachpb.NodeID(nodeID)},
+			Capacity: roachpb.StoreCapacity{
+				Capacity:   100,
+				Available:  int64(10 * storeID),
+				RangeCount: int32(storeID),
+			},
+		}
+		if locality != "" {
+			if err := desc.Node.Locality.Set(locality); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return desc
+	}
+	sg.GossipStores([]*roachpb.StoreDescriptor{
+		makeStore(1, 1, "region=eu,zone=a"),
+		makeStore(2, 1, "region=eu,zone=a"),
+		makeStore(3, 2, "region=eu,zone=b"),
+		makeStore(4, 3, "region=us,zone=a"),
+		makeStore(5, 4, ""),
+		makeStore(6, 5, "region=us,zone=b"),
+	}, t)
+	// Dead stores are left out.
+	sp.mu.Lock()
+	sp.mu.storeDetails[6].markDead(sp.clock.Now())
+	sp.mu.Unlock()
+
+	type bucket struct {
+		locality                  string
+		nodes, stores             int
+		capacity, available, rngs int64
+	}
+	testCases := []struct {
+		numTiers int
+		expected []bucket
+	}{
+		{0, []bucket{
+			{"", 4, 5, 500, 150, 15},
+		}},
+		{1, []bucket{
+			{"", 1, 1, 100, 50, 5},
+			{"region=eu", 2, 3, 300, 60, 6},
+			{"region=us", 1, 1, 100, 40, 4},
+		}},
+		{2, []bucket{
+			{"", 1, 1, 100, 50, 5},
+			{"region=eu,zone=a", 1, 2, 200, 30, 3},
+			{"region=eu,zone=b", 1, 1, 100, 30, 3},
+			{"region=us,zone=a", 1, 1, 100, 40, 4},
+		}},
+	}
+	for _, tc := range testCases {
+		var actual []bucket
+		for _, stats := range sp.GetLocalityStats(tc.numTiers) {
+			actual = append(actual, bucket{
+				locality:  stats.Locality.String(),
+				nodes:     stats.Nodes,
+				stores:    stats.Stores,
+				capacity:  stats.Capacity,
+				available: stats.Available,
+				rngs:      stats.RangeCount,
+			})
+		}
+		if !reflect.DeepEqual(tc.expected, actual) {
+			t.Errorf("%d tiers: expected %+v, got %+v", tc.numTiers, tc.expected, actual)
+		}
+	}
+}
+
+// TestStorePoolAttrIndex verifies that the attribute index follows the
+// attributes stores gossip and drops attributes no store has any more.
+func TestStorePoolAttrIndex(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+
+	makeStore := func(storeID roachpb.StoreID, attrs ...string) *roachpb.StoreDescriptor {
+		return &roachpb.StoreDescriptor{
+			StoreID: storeID,
+			Node:    roachpb.NodeDescriptor{NodeID: roachpb.NodeID(storeID)},
+			Attrs:   roachpb.Attributes{Attrs: attrs},
+		}
+	}
+	constraint := func(value string) config.Constraints {
+		return config.Constraints{Constraints: []config.Constraint{{Value: value}}}
+	}
+
+	sg.GossipStores([]*roachpb.StoreDescriptor{makeStore(1, "a", "b"), makeStore(2, "a")}, t)
+	if err := verifyStoreList(sp, constraint("a"), []int{1, 2}, 2, 0); err != nil {
+		t.Error(err)
+	}
+	if err := verifyStoreList(sp, constraint("b"), []int{1}, 2, 0); err != nil {
+		t.Error(err)
+	}
+
+	// Store 1 changes its attributes.
+	sg.GossipStores([]*roachpb.StoreDescriptor{makeStore(1, "c")}, t)
+	if err := verifyStoreList(sp, constraint("a"), []int{2}, 2, 0); err != nil {
+		t.Error(err)
+	}
+	if err := verifyStoreList(sp, constraint("b"), nil, 2, 0); err != nil {
+		t.Error(err)
+	}
+	if err := verifyStoreList(sp, constraint("c"), []int{1}, 2, 0); err != nil {
+		t.Error(err)
+	}
+
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	if _, ok := sp.mu.attrIndex["b"]; ok {
+		t.Errorf("expected attribute b to be removed from the index: %v", sp.mu.attrIndex)
+	}
+}
+
+// TestStorePoolTimeUntilStoreDeadChange verifies that a change to the time
+// until a store is considered dead takes effect without restarting the pool.
+func TestStorePoolTimeUntilStoreDeadChange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, mc, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+	sg.GossipStores(uniqueStore, t)
+
+	mc.Increment(time.Second.Nanoseconds())
+	sp.mu.RLock()
+	dead := sp.mu.storeDetails[2].dead
+	sp.mu.RUnlock()
+	if dead {
+		t.Fatal("store 2 is dead before its timeout")
+	}
+
+	defer settings.TestingSetDuration(sp.timeUntilStoreDead, TestTimeUntilStoreDead)()
+	waitUntilDead(t, mc, sp, 2)
+}
+
+// TestStorePoolMetrics verifies the StorePool's store health metrics.
+func TestStorePoolMetrics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, mc, sp := createTestStorePool(TestTimeUntilStoreDead)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+	sg.GossipStores(uniqueStore, t)
+
+	// Timeout store 2 and regossip it, then let it die again.
+	waitUntilDead(t, mc, sp, 2)
+	sg.GossipStores(uniqueStore, t)
+	waitUntilDead(t, mc, sp, 2)
+	if e, a := int64(2), sp.Metrics().StoreDeaths.Count(); e != a {
+		t.Errorf("expected %d store deaths, got %d", e, a)
+	}
+
+	// The manual clock no longer advances, so none of these stores will die.
+	stores := []*roachpb.StoreDescriptor{
+		{StoreID: 3, Node: roachpb.NodeDescriptor{NodeID: 3}},
+		{StoreID: 4, Node: roachpb.NodeDescriptor{NodeID: 4}},
+	}
+	sg.GossipStores(stores, t)
+	sp.throttle(throttleFailed, 4)
+	// Store 5 has never been gossiped.
+	sp.throttle(throttleFailed, 5)
+	if e, a := int64(2), sp.Metrics().ThrottleEvents.Count(); e != a {
+		t.Errorf("expected %d throttle events, got %d", e, a)
+	}
+
+	sp.updateMetrics()
+	metrics := sp.Metrics()
+	for _, c := range []struct {
+		name     string
+		gauge    *metric.Gauge
+		expected int64
+	}{
+		{"alive", metrics.AliveStores, 1},
+		{"dead", metrics.DeadStores, 1},
+		{"throttled", metrics.ThrottledStores, 1},
+		{"unknown", metrics.UnknownStores, 1},
+	} {
+		if a := c.gauge.Value(); a != c.expected {
+			t.Errorf("expected %d %s stores, got %d", c.expected, c.name, a)
+		}
+	}
+}
+
+// TestStorePoolRebalanceProgress verifies that the StorePool measures the
+// balance of the cluster and estimates how long it takes to converge.
+func TestStorePoolRebalanceProgress(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, mc, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+
+	gossipCounts := func(rangeCounts, leaseCounts [3]int32) {
+		stores := []*roachpb.StoreDescriptor{
+			// Ephemeral stores are left out.
+			{
+				StoreID:   4,
+				Node:      roachpb.NodeDescriptor{NodeID: 4},
+				Capacity:  roachpb.StoreCapacity{RangeCount: 100},
+				Ephemeral: true,
+			},
+		}
+		for i := range rangeCounts {
+			stores = append(stores, &roachpb.StoreDescriptor{
+				StoreID: roachpb.StoreID(i + 1),
+				Node:    roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i + 1)},
+				Capacity: roachpb.StoreCapacity{
+					RangeCount: rangeCounts[i],
+					LeaseCount: leaseCounts[i],
+				},
+			})
+		}
+		sg.GossipStores(stores, t)
+	}
+
+	// With a mean of 20 ranges, stores with more than 21 ranges are overfull.
+	gossipCounts([3]int32{40, 10, 10}, [3]int32{30, 0, 0})
+	sp.updateMetrics()
+	p := sp.GetRebalanceProgress()
+	expected := ClusterBalance{
+		Stores:         3,
+		MeanRangeCount: 20,
+		MeanLeaseCount: 10,
+		RangeImbalance: 1,
+		LeaseImbalance: 2,
+		ExcessReplicas: 19,
+	}
+	if p.ClusterBalance != expected {
+		t.Fatalf("expected %+v, got %+v", expected, p.ClusterBalance)
+	}
+	// There is nothing to estimate the rate of convergence from yet.
+	if p.ETA >= 0 {
+		t.Errorf("expected no estimate, got %s", p.ETA)
+	}
+
+	sp.rebalanceHistory.recordAdd(1, 2, sp.clock.Now().GoTime())
+	mc.Increment(time.Minute.Nanoseconds())
+	gossipCounts([3]int32{30, 15, 15}, [3]int32{10, 10, 10})
+	sp.updateMetrics()
+	p = sp.GetRebalanceProgress()
+	if p.ExcessReplicas != 9 || p.LeaseImbalance != 0 {
+		t.Fatalf("unexpected balance %+v", p.ClusterBalance)
+	}
+	// 10 excess replicas moved in a minute, so the 9 left take 54 seconds.
+	if e, a := 54*time.Second, p.ETA; a < e-time.Millisecond || a > e+time.Millisecond {
+		t.Errorf("expected an estimate of %s, got %s", e, a)
+	}
+	if len(p.Operations) != 1 || p.Operations[0].RangeID != 1 {
+		t.Errorf("expected the move of r1, got %+v", p.Operations)
+	}
+
+	metrics := sp.Metrics()
+	if a := metrics.ExcessReplicas.Value(); a != 9 {
+		t.Errorf("expected 9 excess replicas, got %d", a)
+	}
+	if a := time.Duration(metrics.RebalanceETA.Value()); a < 53*time.Second || a > 55*time.Second {
+		t.Errorf("expected an estimate of 54s, got %s", a)
+	}
+	if a := metrics.RebalancesInProgress.Value(); a != 1 {
+		t.Errorf("expected 1 rebalance in progress, got %d", a)
+	}
+	if a := metrics.RangeImbalance.Value(); a != 0.5 {
+		t.Errorf("expected a range imbalance of 0.5, got %f", a)
+	}
+}
+
+func TestStorePoolRecoveryEstimate(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+	defer settings.TestingSetInt(snapshotMaxRate, 100)()
+
+	gossipBytes := func(storeIDs []roachpb.StoreID, logicalBytes int64) {
+		var stores []*roachpb.StoreDescriptor
+		for _, storeID := range storeIDs {
+			stores = append(stores, &roachpb.StoreDescriptor{
+				StoreID: storeID,
+				Node:    roachpb.NodeDescriptor{NodeID: roachpb.NodeID(storeID)},
+				Capacity: roachpb.StoreCapacity{
+					RangeCount:   10,
+					LogicalBytes: logicalBytes,
+				},
+			})
+		}
+		sg.GossipStores(stores, t)
+	}
+	recovery := func(storeID roachpb.StoreID) *RecoveryEstimate {
+		for _, store := range sp.GetStores() {
+			if store.Desc.StoreID == storeID {
+				return store.Recovery
+			}
+		}
+		t.Fatalf("store s%d not found", storeID)
+		return nil
+	}
+
+	gossipBytes([]roachpb.StoreID{1, 2, 3}, 1000)
+	if e := recovery(3); e != nil {
+		t.Fatalf("expected no estimate for an alive store, got %+v", e)
+	}
+
+	sp.mu.Lock()
+	detail := sp.mu.storeDetails[3]
+	detail.markDead(sp.clock.Now())
+	sp.recordRecoveryBaselineLocked(detail)
+	sp.mu.Unlock()
+
+	// The two alive stores stream snapshots at 100 bytes per second each.
+	expected := RecoveryEstimate{Ranges: 10, Bytes: 1000, Rate: 200, ETA: 5 * time.Second}
+	if e := recovery(3); e == nil || *e != expected {
+		t.Fatalf("expected %+v, got %+v", expected, e)
+	}
+
+	// Half of the bytes have been re-replicated onto the alive stores.
+	gossipBytes([]roachpb.StoreID{1, 2}, 1250)
+	expected = RecoveryEstimate{
+		Ranges:            10,
+		Bytes:             1000,
+		RecoveredBytes:    500,
+		FractionCompleted: 0.5,
+		Rate:              200,
+		ETA:               2500 * time.Millisecond,
+	}
+	if e := recovery(3); e == nil || *e != expected {
+		t.Fatalf("expected %+v, got %+v", expected, e)
+	}
+	sp.updateMetrics()
+	metrics := sp.Metrics()
+	if a := metrics.RecoveryBytesRemaining.Value(); a != 500 {
+		t.Errorf("expected 500 bytes remaining, got %d", a)
+	}
+	if a := time.Duration(metrics.RecoveryETA.Value()); a != 2500*time.Millisecond {
+		t.Errorf("expected an estimate of 2.5s, got %s", a)
+	}
+
+	// Without a snapshot rate, the duration can't be estimated.
+	defer settings.TestingSetInt(snapshotMaxRate, 0)()
+	if e := recovery(3); e == nil || e.ETA >= 0 || e.FractionCompleted != 0.5 {
+		t.Fatalf("expected no duration estimate, got %+v", e)
+	}
+
+	// The estimate is dropped once the store comes back.
+	gossipBytes([]roachpb.StoreID{3}, 1000)
+	if e := recovery(3); e != nil {
+		t.Fatalf("expected no estimate for a revived store, got %+v", e)
+	}
 }
 
 func TestStorePoolGetStoreDetails(t *testing.T) {
@@ -414,6 +1050,142 @@ func TestStorePoolFindDeadReplicas(t *testing.T) {
 	}
 }
 
+// TestStorePoolRemoveDeadReplica verifies that replicas removed from their
+// range are no longer reported as dead.
+func TestStorePoolRemoveDeadReplica(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, _, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+
+	replicas := []roachpb.ReplicaDescriptor{
+		{NodeID: 1, StoreID: 1, ReplicaID: 1},
+		{NodeID: 1, StoreID: 1, ReplicaID: 2},
+	}
+	var v roachpb.Value
+	if err := v.SetProto(&roachpb.StoreDeadReplicas{
+		StoreID: 1,
+		Replicas: []roachpb.ReplicaIdent{
+			{RangeID: 1, Replica: replicas[0]},
+			{RangeID: 1, Replica: replicas[1]},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sp.deadReplicasGossipUpdate("", v)
+	if dead := sp.deadReplicas(1, replicas); !reflect.DeepEqual(dead, replicas) {
+		t.Fatalf("expected dead replicas %v, got %v", replicas, dead)
+	}
+
+	sp.removeDeadReplica(1, 1, 1)
+	if dead := sp.deadReplicas(1, replicas); !reflect.DeepEqual(dead, replicas[1:]) {
+		t.Fatalf("expected dead replicas %v, got %v", replicas[1:], dead)
+	}
+	sp.removeDeadReplica(1, 1, 2)
+	if dead := sp.deadReplicas(1, replicas); len(dead) > 0 {
+		t.Fatalf("expected no dead replicas, got %v", dead)
+	}
+}
+
+// TestStorePoolDeadReplicaPages verifies that the pages of dead replicas
+// gossiped by a store with many dead replicas add up, and that a gossip of all
+// of its dead replicas replaces them.
+func TestStorePoolDeadReplicaPages(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, _, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+
+	replicas := []roachpb.ReplicaDescriptor{
+		{NodeID: 1, StoreID: 1, ReplicaID: 1},
+		{NodeID: 1, StoreID: 1, ReplicaID: 2},
+		{NodeID: 1, StoreID: 1, ReplicaID: 3},
+	}
+	gossipDeadReplicas := func(total int32, repls ...roachpb.ReplicaDescriptor) {
+		deadReplicas := roachpb.StoreDeadReplicas{StoreID: 1, TotalCount: total}
+		for _, repl := range repls {
+			deadReplicas.Replicas = append(deadReplicas.Replicas,
+				roachpb.ReplicaIdent{RangeID: roachpb.RangeID(repl.ReplicaID), Replica: repl})
+		}
+		var v roachpb.Value
+		if err := v.SetProto(&deadReplicas); err != nil {
+			t.Fatal(err)
+		}
+		sp.deadReplicasGossipUpdate("", v)
+	}
+	check := func(expectedKnown, expectedTotal int, dead ...roachpb.ReplicaDescriptor) {
+		for _, repl := range replicas {
+			expected := false
+			for _, d := range dead {
+				if d == repl {
+					expected = true
+				}
+			}
+			rangeID := roachpb.RangeID(repl.ReplicaID)
+			if actual := len(sp.deadReplicas(rangeID, []roachpb.ReplicaDescriptor{repl})) > 0; actual != expected {
+				t.Errorf("expected replica %s to be dead: %t, got %t", repl, expected, actual)
+			}
+		}
+		sp.mu.RLock()
+		defer sp.mu.RUnlock()
+		detail := sp.mu.storeDetails[1]
+		if known, total := detail.knownDeadReplicas(), detail.deadReplicaCount; known != expectedKnown || total != expectedTotal {
+			t.Errorf("expected %d of %d dead replicas to be known, got %d of %d",
+				expectedKnown, expectedTotal, known, total)
+		}
+	}
+
+	gossipDeadReplicas(3, replicas[0], replicas[1])
+	check(2, 3, replicas[0], replicas[1])
+	// Pages gossiped again don't count twice.
+	gossipDeadReplicas(3, replicas[1], replicas[2])
+	check(3, 3, replicas...)
+	gossipDeadReplicas(1, replicas[2])
+	check(1, 1, replicas[2])
+	// Stores which don't page through their dead replicas leave the total
+	// count unset.
+	gossipDeadReplicas(0, replicas[0], replicas[1])
+	check(2, 2, replicas[0], replicas[1])
+}
+
+// TestStorePoolUnknownStores verifies that stores which are referenced but
+// never gossiped are forgotten once they expire, or when purged.
+func TestStorePoolUnknownStores(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, _, mc, sp := createTestStorePool(TestTimeUntilStoreDead)
+	defer stopper.Stop()
+
+	known := func(storeID roachpb.StoreID) bool {
+		sp.mu.RLock()
+		defer sp.mu.RUnlock()
+		_, ok := sp.mu.storeDetails[storeID]
+		return ok
+	}
+
+	// Referencing stores creates entries for them, which become dead.
+	sp.deadReplicas(0, []roachpb.ReplicaDescriptor{{StoreID: 8}, {StoreID: 9}})
+	waitUntilDead(t, mc, sp, 8)
+	waitUntilDead(t, mc, sp, 9)
+
+	if purged := sp.PurgeUnknownStores(7); len(purged) != 0 {
+		t.Fatalf("expected no purged stores, got %v", purged)
+	}
+	if purged, e := sp.PurgeUnknownStores(8), (roachpb.StoreIDSlice{8}); !reflect.DeepEqual(purged, e) {
+		t.Fatalf("expected purged stores %v, got %v", e, purged)
+	}
+	if known(8) || !known(9) {
+		t.Fatalf("expected only store 9 to be known")
+	}
+
+	// The remaining store expires.
+	defer settings.TestingSetDuration(unknownStoreExpiry, time.Minute)()
+	mc.Increment(2 * time.Minute.Nanoseconds())
+	util.SucceedsSoon(t, func() error {
+		if known(9) {
+			return errors.New("store 9 not forgotten yet")
+		}
+		return nil
+	})
+}
+
 // TestStorePoolDefaultState verifies that the default state of a
 // store is neither alive nor dead. This is a regression test for a
 // bug in which a call to deadReplicas involving an unknown store
@@ -430,7 +1202,7 @@ func TestStorePoolDefaultState(t *testing.T) {
 		t.Errorf("expected 0 dead replicas; got %v", dead)
 	}
 
-	sl, alive, throttled := sp.getStoreList(config.Constraints{}, true)
+	sl, alive, throttled := sp.getStoreList(config.Constraints{}, nil, storeFilterNone, true)
 	if len(sl.stores) > 0 {
 		t.Errorf("expected no live stores; got list of %v", sl)
 	}
@@ -475,4 +1247,382 @@ func TestStorePoolThrottle(t *testing.T) {
 				expected, detail.throttledUntil)
 		}
 	}
+
+	// The reasons for throttling are recorded.
+	sp.throttle(throttleFailed, 1)
+	sp.mu.Lock()
+	detail := sp.getStoreDetailLocked(1)
+	reason, counts, lastThrottled := detail.throttleReason, detail.throttleCounts, detail.lastThrottled
+	sp.mu.Unlock()
+	if reason != throttleFailed {
+		t.Errorf("expected the last throttle reason to be %s, found %s", throttleFailed, reason)
+	}
+	if e, a := 1, counts[throttleDeclined]; e != a {
+		t.Errorf("expected %d declined throttles, found %d", e, a)
+	}
+	if e, a := 2, counts[throttleFailed]; e != a {
+		t.Errorf("expected %d failed throttles, found %d", e, a)
+	}
+	if e := sp.clock.Now().GoTime(); !lastThrottled.Equal(e) {
+		t.Errorf("expected the store to have last been throttled at %v, found %v", e, lastThrottled)
+	}
+	if e, a := int64(1), sp.metrics.ThrottlesDeclined.Count(); e != a {
+		t.Errorf("expected %d declined throttle events, got %d", e, a)
+	}
+	if e, a := int64(2), sp.metrics.ThrottlesFailed.Count(); e != a {
+		t.Errorf("expected %d failed throttle events, got %d", e, a)
+	}
+	if s := sp.String(); !strings.Contains(s, "throttles(declined=1 failed=2") {
+		t.Errorf("expected the throttles of store 1 in %q", s)
+	}
+}
+
+// TestStorePoolThrottleReservations verifies that a store whose reported
+// capacity shows it has no reservation budget left is throttled until it
+// reports having budget again.
+func TestStorePoolThrottleReservations(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+
+	sg := gossiputil.NewStoreGossiper(g)
+	sg.GossipStores(uniqueStore, t)
+
+	expectThrottled := func(e bool) {
+		sp.mu.Lock()
+		defer sp.mu.Unlock()
+		detail := sp.getStoreDetailLocked(2)
+		now := sp.clock.Now().GoTime()
+		if a := detail.match(now, config.Constraints{}) == storeMatchThrottled; a != e {
+			t.Errorf("expected throttled=%t, got %t", e, a)
+		}
+		if a := detail.status(now, sp.timeUntilStoreDead.Get()) == storeStatusThrottled; a != e {
+			t.Errorf("expected status throttled=%t, got %t", e, a)
+		}
+	}
+
+	expectThrottled(false)
+	capacity := uniqueStore[0].Capacity
+	capacity.Reservations, capacity.MaxReservations = 1, 1
+	sp.updateRemoteCapacityEstimate(2, capacity)
+	sp.throttle(throttleDeclined, 2)
+	expectThrottled(true)
+	if s := sp.String(); !strings.Contains(s, "[reservations=1/1") {
+		t.Errorf("expected the reservations of store 2 in %q", s)
+	}
+
+	capacity.Reservations = 0
+	sp.updateRemoteCapacityEstimate(2, capacity)
+	expectThrottled(false)
+}
+
+// TestStorePoolReserveSnapshot verifies that the preemptive snapshots being
+// sent to a store count against its reservation budget until they're done,
+// unless the store already reported them.
+func TestStorePoolReserveSnapshot(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+
+	sg := gossiputil.NewStoreGossiper(g)
+	sg.GossipStores(uniqueStore, t)
+
+	expectThrottled := func(e bool) {
+		sp.mu.Lock()
+		defer sp.mu.Unlock()
+		detail := sp.getStoreDetailLocked(2)
+		if a := detail.throttled(sp.clock.Now().GoTime()); a != e {
+			t.Errorf("expected throttled=%t, got %t", e, a)
+		}
+	}
+
+	capacity := uniqueStore[0].Capacity
+	capacity.Reservations, capacity.MaxReservations = 0, 2
+	sp.updateRemoteCapacityEstimate(2, capacity)
+	expectThrottled(false)
+
+	release1 := sp.reserveSnapshot(2, 100)
+	expectThrottled(false)
+	release2 := sp.reserveSnapshot(2, 100)
+	expectThrottled(true)
+
+	// Reservations the store reported are not counted twice.
+	capacity.Reservations = 1
+	sp.updateRemoteCapacityEstimate(2, capacity)
+	expectThrottled(true)
+	release2()
+	expectThrottled(false)
+	release1()
+	expectThrottled(false)
+
+	// The bytes of the snapshots count against the store's byte budget.
+	capacity.Reservations, capacity.MaxReservations = 0, 0
+	capacity.ReservedBytes, capacity.MaxReservedBytes = 0, 150
+	sp.updateRemoteCapacityEstimate(2, capacity)
+	release := sp.reserveSnapshot(2, 200)
+	expectThrottled(true)
+	release()
+	expectThrottled(false)
+}
+
+// TestStorePoolUpdateLeaseTransferEstimate verifies that the lease counts of
+// the stores a lease is transferred between are adjusted until they gossip
+// their own, and that the store lists reflect them.
+func TestStorePoolUpdateLeaseTransferEstimate(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+
+	var stores []*roachpb.StoreDescriptor
+	for i, leases := range []int32{10, 0} {
+		stores = append(stores, &roachpb.StoreDescriptor{
+			StoreID:  roachpb.StoreID(i + 1),
+			Node:     roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i + 1)},
+			Capacity: roachpb.StoreCapacity{Capacity: 100, Available: 100, LeaseCount: leases},
+		})
+	}
+	sg := gossiputil.NewStoreGossiper(g)
+	sg.GossipStores(stores, t)
+
+	expectLeases := func(e1, e2 int32) {
+		sl, _, _ := sp.getStoreList(config.Constraints{}, nil, storeFilterNone, true)
+		leases := map[roachpb.StoreID]int32{}
+		for _, s := range sl.stores {
+			leases[s.StoreID] = s.Capacity.LeaseCount
+		}
+		if leases[1] != e1 || leases[2] != e2 {
+			t.Errorf("expected lease counts s1=%d s2=%d, got %v", e1, e2, leases)
+		}
+	}
+
+	sp.updateLeaseTransferEstimate(1, 2)
+	sp.updateLeaseTransferEstimate(1, 2)
+	expectLeases(8, 2)
+	// Lease counts don't drop below zero.
+	sp.updateLeaseTransferEstimate(2, 1)
+	sp.updateLeaseTransferEstimate(2, 1)
+	sp.updateLeaseTransferEstimate(2, 1)
+	expectLeases(11, 0)
+
+	// The counts the stores gossip supersede the estimates.
+	sg.GossipStores(stores, t)
+	expectLeases(10, 0)
+}
+
+func TestEWMA(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	start := time.Unix(0, 0)
+	var e ewma
+	e.update(10, start, time.Minute)
+	if e.value != 10 {
+		t.Errorf("expected the first sample to be the average, got %.2f", e.value)
+	}
+	// After one half-life, the new sample has as much weight as the old ones.
+	e.update(20, start.Add(time.Minute), time.Minute)
+	if e.value != 15 {
+		t.Errorf("expected 15, got %.2f", e.value)
+	}
+	// A sample taken at the same time as the last one has no weight.
+	e.update(100, start.Add(time.Minute), time.Minute)
+	if e.value != 15 {
+		t.Errorf("expected 15, got %.2f", e.value)
+	}
+	// A half-life of zero makes the average the latest sample.
+	e.update(100, start.Add(time.Minute), 0)
+	if e.value != 100 {
+		t.Errorf("expected 100, got %.2f", e.value)
+	}
+}
+
+// TestStorePoolSmoothedStoreList verifies that the store list built by the
+// StorePool tracks moving averages of the gossiped range counts.
+func TestStorePoolSmoothedStoreList(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer settings.TestingSetDuration(capacityStatsHalfLife, time.Minute)()
+	stopper, g, mc, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+
+	desc := *uniqueStore[0]
+	sg := gossiputil.NewStoreGossiper(g)
+	for _, rangeCount := range []int32{10, 20} {
+		desc.Capacity.RangeCount = rangeCount
+		sg.GossipStores([]*roachpb.StoreDescriptor{&desc}, t)
+		mc.Increment(time.Minute.Nanoseconds())
+	}
+
+	sl, _, _ := sp.getStoreList(config.Constraints{}, nil, storeFilterNone, true)
+	if len(sl.stores) != 1 {
+		t.Fatalf("expected one store, got %s", sl)
+	}
+	if e, a := int32(20), sl.stores[0].Capacity.RangeCount; e != a {
+		t.Errorf("expected range count %d, got %d", e, a)
+	}
+	if e, a := 15.0, sl.smoothedRangeCount(sl.stores[0]); e != a {
+		t.Errorf("expected smoothed range count %.1f, got %.1f", e, a)
+	}
+	if e, a := 15.0, sl.candidateSmoothedCount.mean; e != a {
+		t.Errorf("expected smoothed mean %.1f, got %.1f", e, a)
+	}
+}
+
+// TestStorePoolStoreListCache verifies that store lists are cached until the
+// stores change or a store's throttling runs out, and that callers can modify
+// the lists they get.
+func TestStorePoolStoreListCache(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, mc, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+	sp.declinedReservationsTimeout = time.Hour
+
+	stores := []*roachpb.StoreDescriptor{
+		{StoreID: 1, Node: roachpb.NodeDescriptor{NodeID: 1}},
+		{StoreID: 2, Node: roachpb.NodeDescriptor{NodeID: 2}},
+	}
+	sg.GossipStores(stores, t)
+
+	expectStores := func(expected []int) {
+		sl, _, _ := sp.getStoreList(config.Constraints{}, nil, storeFilterThrottled, true)
+		var actual []int
+		for _, store := range sl.stores {
+			actual = append(actual, int(store.StoreID))
+		}
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("expected stores %v, got %v", expected, actual)
+		}
+		// Modifying the list must not affect later lists.
+		for i := range sl.stores {
+			sl.stores[i].StoreID = 0
+		}
+	}
+	expectStores([]int{1, 2})
+
+	// Changing a store behind the StorePool's back isn't noticed while the
+	// list is cached.
+	sp.mu.Lock()
+	sp.mu.storeDetails[2].markDead(sp.clock.Now())
+	sp.mu.Unlock()
+	expectStores([]int{1, 2})
+
+	// Throttling a store invalidates the cached list.
+	sp.throttle(throttleDeclined, 1)
+	expectStores(nil)
+
+	// The cached list expires when the store stops being throttled.
+	mc.Increment(time.Hour.Nanoseconds())
+	expectStores([]int{1})
+
+	// Gossip invalidates the cached list.
+	sg.GossipStores(stores[1:], t)
+	expectStores([]int{1, 2})
+}
+
+// TestStorePoolStoreListExisting verifies that store lists count the existing
+// replicas of the range being placed by locality and score the diversity of
+// the stores relative to them.
+func TestStorePoolStoreListExisting(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+
+	localities := []string{
+		"region=eu,zone=a",
+		"region=eu,zone=a",
+		"region=eu,zone=b",
+		"region=us,zone=a",
+	}
+	var stores []*roachpb.StoreDescriptor
+	for i, locality := range localities {
+		desc := &roachpb.StoreDescriptor{
+			StoreID: roachpb.StoreID(i + 1),
+			Node:    roachpb.NodeDescriptor{NodeID: roachpb.NodeID(i + 1)},
+		}
+		if err := desc.Node.Locality.Set(locality); err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, desc)
+	}
+	sg.GossipStores(stores, t)
+
+	existing := []roachpb.ReplicaDescriptor{
+		{NodeID: 1, StoreID: 1},
+		{NodeID: 3, StoreID: 3},
+		// The StorePool doesn't know about store 5, which is left out.
+		{NodeID: 5, StoreID: 5},
+	}
+	sl, _, _ := sp.getStoreList(config.Constraints{}, existing, storeFilterNone, true)
+
+	for locality, expected := range map[string]int{
+		"":                 2,
+		"region=eu":        2,
+		"region=eu,zone=a": 1,
+		"region=eu,zone=b": 1,
+		"region=us":        0,
+		"region=us,zone=a": 0,
+	} {
+		var l roachpb.Locality
+		if locality != "" {
+			if err := l.Set(locality); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if actual := sl.localityReplicaCount(l); actual != expected {
+			t.Errorf("%q: expected %d replicas, got %d", locality, expected, actual)
+		}
+	}
+
+	for i, expected := range []float64{0.5, 0, 0.5, 1} {
+		if actual := sl.diversityScore(*stores[i]); actual != expected {
+			t.Errorf("s%d: expected diversity score %.2f, got %.2f", i+1, expected, actual)
+		}
+	}
+
+	// Lists made for other ranges don't see these replicas, even when cached.
+	sl, _, _ = sp.getStoreList(config.Constraints{}, nil, storeFilterNone, true)
+	if count := sl.localityReplicaCount(roachpb.Locality{}); count != 0 {
+		t.Errorf("expected no replicas, got %d", count)
+	}
+}
+
+// TestStorePoolSnapshot verifies that a snapshot of the StorePool isn't
+// affected by later updates of the StorePool.
+func TestStorePoolSnapshot(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	stopper, g, _, sp := createTestStorePool(TestTimeUntilStoreDeadOff)
+	defer stopper.Stop()
+	sg := gossiputil.NewStoreGossiper(g)
+	sg.GossipStores(uniqueStore, t)
+
+	// Taking a snapshot starts tracking the stores of the given replicas.
+	snap := sp.snapshot([]roachpb.ReplicaDescriptor{{NodeID: 3, StoreID: 3, ReplicaID: 1}})
+	sp.mu.RLock()
+	_, ok := sp.mu.storeDetails[3]
+	sp.mu.RUnlock()
+	if !ok {
+		t.Fatal("expected store 3 to be tracked")
+	}
+
+	// Update and throttle the store after taking the snapshot.
+	updated := *uniqueStore[0]
+	updated.Capacity.RangeCount = 10
+	sg.GossipStores([]*roachpb.StoreDescriptor{&updated}, t)
+	sp.throttle(throttleDeclined, updated.StoreID)
+
+	if sl, alive, throttled := snap.getStoreList(config.Constraints{}, nil, storeFilterThrottled, true); len(sl.stores) != 1 ||
+		alive != 1 || throttled != 0 {
+		t.Errorf("expected 1 available and alive store and none throttled in the snapshot, got %d, %d, %d",
+			len(sl.stores), alive, throttled)
+	}
+	if sl, _, throttled := sp.getStoreList(config.Constraints{}, nil, storeFilterThrottled, true); len(sl.stores) != 0 || throttled != 1 {
+		t.Errorf("expected no available store and 1 throttled in the StorePool, got %d, %d",
+			len(sl.stores), throttled)
+	}
+	if desc, ok := snap.getStoreDescriptor(updated.StoreID); !ok || desc.Capacity.RangeCount != 0 {
+		t.Errorf("expected the snapshot to have the original descriptor, got %+v", desc)
+	}
+	if desc, ok := sp.getStoreDescriptor(updated.StoreID); !ok || desc.Capacity.RangeCount != 10 {
+		t.Errorf("expected the StorePool to have the updated descriptor, got %+v", desc)
+	}
 }
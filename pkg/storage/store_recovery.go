@@ -0,0 +1,145 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+)
+
+// recoveryBaseline is the state of the cluster when a store was found dead,
+// against which the re-replication of the store's replicas is measured.
+type recoveryBaseline struct {
+	// ranges and bytes are the range count and logical bytes of the dead
+	// store as last gossiped.
+	ranges, bytes int64
+	// aliveBytes is the total of the logical bytes of the other alive stores.
+	aliveBytes int64
+}
+
+// RecoveryEstimate describes the re-replication of the replicas of a dead
+// store onto the other stores of the cluster. It allows operators to decide
+// whether to wait for the store to come back or to let the recovery proceed.
+//
+// The progress is inferred from the growth of the other stores since the
+// store was found dead, so it also accounts for unrelated growth, and for
+// the recovery of other stores which died at about the same time.
+type RecoveryEstimate struct {
+	// Ranges and Bytes are the replicas and logical bytes which were on the
+	// store and have to be re-replicated.
+	Ranges int64
+	Bytes  int64
+	// RecoveredBytes is the estimate of the bytes re-replicated so far.
+	RecoveredBytes    int64
+	FractionCompleted float64
+	// Rate is the rate, in bytes per second, at which the replicas can be
+	// re-replicated at best: every alive store streams one snapshot at a
+	// time, at kv.snapshot.max_rate. It is zero if the snapshot rate isn't
+	// limited.
+	Rate float64
+	// ETA is the estimated time until the replicas have been re-replicated.
+	// It is zero if they have, and negative if the rate is unknown.
+	ETA time.Duration
+}
+
+// aliveTotalsLocked returns the number of alive stores known to the
+// StorePool other than the given one, and their total logical bytes.
+// Ephemeral stores are left out. sp.mu must be held, for reading at least.
+func (sp *StorePool) aliveTotalsLocked(exclude roachpb.StoreID) (stores int, bytes int64) {
+	for storeID, detail := range sp.mu.storeDetails {
+		if storeID == exclude || detail.dead || detail.desc == nil || detail.desc.Ephemeral {
+			continue
+		}
+		stores++
+		bytes += detail.desc.Capacity.LogicalBytes
+	}
+	return stores, bytes
+}
+
+// recordRecoveryBaselineLocked records the baseline against which the
+// recovery of a store which was just found dead is measured. Nothing is
+// recorded if the store's descriptor is unknown. sp.mu must be held.
+func (sp *StorePool) recordRecoveryBaselineLocked(detail *storeDetail) {
+	if detail.desc == nil {
+		return
+	}
+	b := &recoveryBaseline{
+		ranges: int64(detail.desc.Capacity.RangeCount),
+		bytes:  detail.desc.Capacity.LogicalBytes,
+	}
+	_, b.aliveBytes = sp.aliveTotalsLocked(detail.desc.StoreID)
+	detail.recovery = b
+}
+
+// recoveryEstimateLocked returns the RecoveryEstimate of a dead store, or nil
+// if the store isn't dead or its state at the time of death is unknown.
+// sp.mu must be held, for reading at least.
+func (sp *StorePool) recoveryEstimateLocked(
+	storeID roachpb.StoreID, detail *storeDetail,
+) *RecoveryEstimate {
+	b := detail.recovery
+	if !detail.dead || b == nil {
+		return nil
+	}
+	stores, bytes := sp.aliveTotalsLocked(storeID)
+	e := &RecoveryEstimate{
+		Ranges:            b.ranges,
+		Bytes:             b.bytes,
+		FractionCompleted: 1,
+	}
+	if e.RecoveredBytes = bytes - b.aliveBytes; e.RecoveredBytes < 0 {
+		e.RecoveredBytes = 0
+	} else if e.RecoveredBytes > e.Bytes {
+		e.RecoveredBytes = e.Bytes
+	}
+	if e.Bytes > 0 {
+		e.FractionCompleted = float64(e.RecoveredBytes) / float64(e.Bytes)
+	}
+	rate := recoverySnapshotMaxRate.Get()
+	if rate == 0 {
+		rate = snapshotMaxRate.Get()
+	}
+	if rate > 0 {
+		e.Rate = float64(rate) * float64(stores)
+	}
+	switch remaining := e.Bytes - e.RecoveredBytes; {
+	case remaining == 0:
+	case e.Rate == 0:
+		e.ETA = -1
+	default:
+		e.ETA = time.Duration(float64(remaining) / e.Rate * float64(time.Second))
+	}
+	return e
+}
+
+// updateRecoveryMetricsLocked updates the StorePool's recovery gauges from the
+// estimates of the dead stores. sp.mu must be held, for reading at least.
+func (sp *StorePool) updateRecoveryMetricsLocked() {
+	var remaining int64
+	var eta time.Duration
+	for storeID, detail := range sp.mu.storeDetails {
+		e := sp.recoveryEstimateLocked(storeID, detail)
+		if e == nil {
+			continue
+		}
+		remaining += e.Bytes - e.RecoveredBytes
+		if eta >= 0 && (e.ETA < 0 || e.ETA > eta) {
+			eta = e.ETA
+		}
+	}
+	sp.metrics.RecoveryBytesRemaining.Update(remaining)
+	sp.metrics.RecoveryETA.Update(eta.Nanoseconds())
+}
@@ -0,0 +1,214 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/engine"
+	"github.com/cockroachdb/cockroach/pkg/util/envutil"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// startupValidationBudget bounds the time a store spends validating its
+// replicas before it starts serving. The replicas which couldn't be
+// validated in time are validated in the background instead, along with the
+// checks which are too expensive to run at startup.
+var startupValidationBudget = envutil.EnvOrDefaultDuration(
+	"COCKROACH_STARTUP_VALIDATION_BUDGET", 5*time.Second)
+
+// startupValidationConcurrency is the number of replicas validated
+// concurrently at startup.
+const startupValidationConcurrency = 32
+
+// validateReplicaState checks the invariants of the persisted state of the
+// range's replica which only take a few point reads to verify: the replica
+// has an applied state, and its raft log indexes are ordered, from the
+// truncated index to the applied index, the HardState's commit index and
+// the last index. The descriptor itself is known to be present, since the
+// replicas are created from the descriptors found on the store. Overlaps
+// between neighboring replicas are caught as the replicas are added to the
+// store.
+func validateReplicaState(
+	ctx context.Context, reader engine.Reader, desc *roachpb.RangeDescriptor,
+) error {
+	rangeID := desc.RangeID
+	appliedIndex, _, err := loadAppliedIndex(ctx, reader, rangeID)
+	if err != nil {
+		return err
+	}
+	if appliedIndex == 0 {
+		return errors.Errorf("r%d: initialized replica has no applied state", rangeID)
+	}
+	truncState, err := loadTruncatedState(ctx, reader, rangeID)
+	if err != nil {
+		return err
+	}
+	lastIndex, err := loadLastIndex(ctx, reader, rangeID)
+	if err != nil {
+		return err
+	}
+	hs, err := loadHardState(ctx, reader, rangeID)
+	if err != nil {
+		return err
+	}
+	if truncState.Index > appliedIndex {
+		return errors.Errorf("r%d: truncated index %d is beyond the applied index %d",
+			rangeID, truncState.Index, appliedIndex)
+	}
+	if appliedIndex > hs.Commit {
+		return errors.Errorf("r%d: applied index %d is beyond the committed index %d",
+			rangeID, appliedIndex, hs.Commit)
+	}
+	if hs.Commit > lastIndex {
+		return errors.Errorf("r%d: committed index %d is beyond the last index %d",
+			rangeID, hs.Commit, lastIndex)
+	}
+	return nil
+}
+
+// validateReplicaStats recomputes the MVCC stats of the range's replica and
+// compares them to the persisted ones. The reader must be a consistent
+// snapshot, so that concurrent writes don't show up as mismatches.
+func validateReplicaStats(
+	ctx context.Context, reader engine.Reader, desc *roachpb.RangeDescriptor, nowNanos int64,
+) error {
+	ms, err := loadMVCCStats(ctx, reader, desc.RangeID)
+	if err != nil {
+		return err
+	}
+	if ms.ContainsEstimates {
+		return nil
+	}
+	computed, err := ComputeStatsForRange(desc, reader, nowNanos)
+	if err != nil {
+		return err
+	}
+	ms.AgeTo(nowNanos)
+	computed.AgeTo(nowNanos)
+	if ms != computed {
+		return errors.Errorf("r%d: persisted MVCC stats %+v don't match the recomputed %+v",
+			desc.RangeID, ms, computed)
+	}
+	return nil
+}
+
+// validateReplica validates the state of the replica, marking it as corrupt
+// if the validation fails. Replicas which were already destroyed or marked
+// as corrupt are skipped.
+func (s *Store) validateReplica(ctx context.Context, r *Replica) {
+	r.mu.Lock()
+	destroyed := r.mu.destroyed
+	r.mu.Unlock()
+	if destroyed != nil {
+		return
+	}
+	if err := validateReplicaState(ctx, s.engine, r.Desc()); err != nil {
+		r.maybeSetCorrupt(ctx, roachpb.NewError(NewReplicaCorruptionError(err)))
+	}
+}
+
+// validateReplicasAtStartup validates the state of the given replicas
+// concurrently until startupValidationBudget has elapsed, marking the
+// replicas which fail as corrupt. It returns the replicas which weren't
+// validated in time.
+func (s *Store) validateReplicasAtStartup(ctx context.Context, repls []*Replica) []*Replica {
+	deadline := timeutil.Now().Add(startupValidationBudget)
+	validated := make([]bool, len(repls))
+	sem := make(chan struct{}, startupValidationConcurrency)
+	var wg sync.WaitGroup
+	for i := range repls {
+		if timeutil.Now().After(deadline) {
+			break
+		}
+		i := i
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if timeutil.Now().After(deadline) {
+				return
+			}
+			s.validateReplica(ctx, repls[i])
+			validated[i] = true
+		}()
+	}
+	wg.Wait()
+
+	var deferred []*Replica
+	for i, r := range repls {
+		if !validated[i] {
+			deferred = append(deferred, r)
+		}
+	}
+	if len(deferred) > 0 {
+		log.Infof(ctx, "validated %d of %d replicas at startup; deferring the others",
+			len(repls)-len(deferred), len(repls))
+	}
+	return deferred
+}
+
+// startReplicaValidation starts a job validating in the background the state
+// of the replicas which weren't validated at startup, and the MVCC stats of
+// every replica. Replicas which fail the state validation are marked as
+// corrupt; stats mismatches are reported as the job's error.
+func (s *Store) startReplicaValidation(
+	ctx context.Context, repls []*Replica, deferred []*Replica,
+) error {
+	_, err := s.jobs.start(ctx, s.stopper, "replica validation",
+		func(ctx context.Context, job *storeJob) error {
+			total := float64(len(deferred) + len(repls))
+			for i, r := range deferred {
+				if err := job.checkpoint(ctx, float64(i)/total); err != nil {
+					return err
+				}
+				s.validateReplica(ctx, r)
+			}
+			var mismatches int
+			for i, r := range repls {
+				if err := job.checkpoint(ctx, float64(len(deferred)+i)/total); err != nil {
+					return err
+				}
+				r.mu.Lock()
+				destroyed := r.mu.destroyed
+				r.mu.Unlock()
+				if destroyed != nil {
+					continue
+				}
+				snap := s.engine.NewSnapshot()
+				err := validateReplicaStats(ctx, snap, r.Desc(), s.Clock().PhysicalNow())
+				snap.Close()
+				if err != nil {
+					log.Warningf(ctx, "%s: %s", r, err)
+					mismatches++
+				}
+			}
+			if mismatches > 0 {
+				return errors.Errorf("MVCC stats of %d of %d replicas don't match their data",
+					mismatches, len(repls))
+			}
+			return nil
+		})
+	return err
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/coreos/etcd/raft/raftpb"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/testutils"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+// TestValidateReplicaState verifies that the startup validation accepts the
+// state of a freshly bootstrapped replica and catches inconsistent raft
+// HardStates.
+func TestValidateReplicaState(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+	ctx := context.Background()
+
+	repl, err := store.GetReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := repl.Desc()
+	if err := validateReplicaState(ctx, store.Engine(), desc); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := store.Engine().NewSnapshot()
+	defer snap.Close()
+	if err := validateReplicaStats(ctx, snap, desc, store.Clock().PhysicalNow()); err != nil {
+		t.Fatal(err)
+	}
+
+	appliedIndex, _, err := loadAppliedIndex(ctx, store.Engine(), desc.RangeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastIndex, err := loadLastIndex(ctx, store.Engine(), desc.RangeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		hs       raftpb.HardState
+		expected string
+	}{
+		{raftpb.HardState{Commit: appliedIndex - 1}, "beyond the committed index"},
+		{raftpb.HardState{Commit: lastIndex + 1}, "beyond the last index"},
+	}
+	for i, c := range testCases {
+		// Write the HardState to a batch which is discarded, so that the
+		// store's state isn't changed.
+		batch := store.Engine().NewBatch()
+		if err := setHardState(ctx, batch, desc.RangeID, c.hs); err != nil {
+			batch.Close()
+			t.Fatal(err)
+		}
+		err := validateReplicaState(ctx, batch, desc)
+		batch.Close()
+		if !testutils.IsError(err, c.expected) {
+			t.Errorf("%d: expected error %q, got %v", i, c.expected, err)
+		}
+	}
+}
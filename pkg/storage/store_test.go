@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"sort"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -37,6 +38,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/rpc"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine"
 	"github.com/cockroachdb/cockroach/pkg/storage/engine/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/storage/storagebase"
@@ -163,7 +165,8 @@ func createTestStoreWithoutStart(
 		cfg.Gossip,
 		cfg.Clock,
 		rpcContext,
-		TestTimeUntilStoreDeadOff,
+		nil, /* nodeLivenessFn */
+		settings.TestingDurationSetting(TestTimeUntilStoreDeadOff),
 		stopper,
 	)
 	eng := engine.NewInMem(roachpb.Attributes{}, 10<<20, stopper)
@@ -1041,7 +1044,7 @@ func splitTestRange(store *Store, key, splitKey roachpb.RKey, t *testing.T) *Rep
 	// some required Raft keys.
 	if _, err := writeInitialState(
 		context.Background(), store.engine, enginepb.MVCCStats{}, *desc,
-		raftpb.HardState{}, &roachpb.Lease{},
+		raftpb.HardState{}, &roachpb.Lease{}, false, /* usingAppliedStateKey */
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -1977,8 +1980,9 @@ func (fq *fakeRangeQueue) Start(_ *hlc.Clock, _ *stop.Stopper) {
 	// Do nothing
 }
 
-func (fq *fakeRangeQueue) MaybeAdd(_ *Replica, _ hlc.Timestamp) {
+func (fq *fakeRangeQueue) MaybeAdd(_ *Replica, _ hlc.Timestamp) bool {
 	// Do nothing
+	return false
 }
 
 func (fq *fakeRangeQueue) MaybeRemove(rangeID roachpb.RangeID) {
@@ -2400,7 +2404,7 @@ func TestStoreRemovePlaceholderOnRaftIgnored(t *testing.T) {
 
 	if _, err := writeInitialState(
 		ctx, s.Engine(), enginepb.MVCCStats{}, *rng1.Desc(),
-		raftpb.HardState{}, &roachpb.Lease{},
+		raftpb.HardState{}, &roachpb.Lease{}, false, /* usingAppliedStateKey */
 	); err != nil {
 		t.Fatal(err)
 	}
@@ -2508,6 +2512,192 @@ func TestCanCampaignIdleReplica(t *testing.T) {
 	}
 }
 
+// TestStoreUpdateAttributes verifies that updated store attributes and
+// locality are gossiped and matched against constraints without restarting
+// the store.
+func TestStoreUpdateAttributes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+	s := tc.store
+	ctx := context.Background()
+
+	ssd := config.Constraints{
+		Constraints: []config.Constraint{{Type: config.Constraint_REQUIRED, Value: "ssd"}},
+	}
+	desc, err := s.Descriptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := tc.clock.PhysicalTime()
+	if m := (&storeDetail{desc: desc}).match(now, ssd); m != storeMatchAlive {
+		t.Fatalf("expected store not to match %s, got %d", ssd, m)
+	}
+
+	// Leaving the locality unset leaves it unchanged.
+	attrs := roachpb.Attributes{Attrs: []string{"ssd"}}
+	locality := roachpb.Locality{Tiers: []roachpb.Tier{{Key: "region", Value: "us-east"}}}
+	if _, err := s.UpdateAttributes(ctx, nil, &locality); err != nil {
+		t.Fatal(err)
+	}
+	if desc, err = s.UpdateAttributes(ctx, &attrs, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(desc.Attrs, attrs) || !reflect.DeepEqual(desc.Node.Locality, locality) {
+		t.Fatalf("expected attributes %s and locality %s, got %s and %s",
+			attrs, locality, desc.Attrs, desc.Node.Locality)
+	}
+	// The store may be too full to be available, but its attributes match.
+	if m := (&storeDetail{desc: desc}).match(now, ssd); m == storeMatchDead || m == storeMatchAlive {
+		t.Fatalf("expected store to match %s, got %d", ssd, m)
+	}
+
+	var gossiped roachpb.StoreDescriptor
+	if err := s.cfg.Gossip.GetInfoProto(gossip.MakeStoreKey(s.StoreID()), &gossiped); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gossiped.Attrs, attrs) || !reflect.DeepEqual(gossiped.Node.Locality, locality) {
+		t.Fatalf("expected gossiped attributes %s and locality %s, got %s and %s",
+			attrs, locality, gossiped.Attrs, gossiped.Node.Locality)
+	}
+}
+
+// TestStoreSetReadOnly verifies that a read-only store gossips its mode and
+// that its replicas decline to acquire range leases.
+func TestStoreSetReadOnly(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+	s := tc.store
+	ctx := context.Background()
+
+	desc, err := s.SetReadOnly(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !desc.ReadOnly {
+		t.Fatalf("expected a read-only descriptor, got %+v", desc)
+	}
+	var gossiped roachpb.StoreDescriptor
+	if err := s.cfg.Gossip.GetInfoProto(gossip.MakeStoreKey(s.StoreID()), &gossiped); err != nil {
+		t.Fatal(err)
+	}
+	if !gossiped.ReadOnly {
+		t.Fatalf("expected a read-only gossiped descriptor, got %+v", gossiped)
+	}
+
+	tc.rng.mu.Lock()
+	llChan := tc.rng.requestLeaseLocked(s.Clock().Now())
+	tc.rng.mu.Unlock()
+	if pErr := <-llChan; !testutils.IsPError(pErr, "not lease holder") {
+		t.Fatalf("expected the lease request to be declined, got %v", pErr)
+	}
+
+	if desc, err = s.SetReadOnly(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if desc.ReadOnly {
+		t.Fatalf("expected a writable descriptor, got %+v", desc)
+	}
+}
+
+func TestCapacityChanged(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	testCases := []struct {
+		prev, cur float64
+		expected  bool
+	}{
+		{0, 0, false},
+		{0, 1, true},
+		{100, 100, false},
+		{100, 105, false},
+		{100, 95, false},
+		{100, 106, true},
+		{100, 94, true},
+		{0.5, 0.52, false},
+		{0.5, 0.53, true},
+	}
+	for i, c := range testCases {
+		if changed := capacityChanged(c.prev, c.cur, 0.05); changed != c.expected {
+			t.Errorf("%d: capacityChanged(%v, %v) = %t; expected %t", i, c.prev, c.cur, changed, c.expected)
+		}
+	}
+}
+
+// TestStoreGossipOnCapacityChange verifies that the store descriptor is
+// gossiped again when its capacity has changed enough since it was last
+// gossiped, and only then.
+func TestStoreGossipOnCapacityChange(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tc := testContext{}
+	tc.Start(t)
+	defer tc.Stop()
+	s := tc.store
+	ctx := context.Background()
+
+	// Nothing is gossiped before the store has been gossiped once.
+	s.maybeGossipOnCapacityChange(ctx)
+	if _, err := s.cfg.Gossip.GetInfo(gossip.MakeStoreKey(s.StoreID())); err == nil {
+		t.Fatal("store descriptor unexpectedly gossiped")
+	}
+
+	if err := s.GossipStore(ctx); err != nil {
+		t.Fatal(err)
+	}
+	gossipedRangeCount := func() int32 {
+		s.gossipedCapacity.Lock()
+		defer s.gossipedCapacity.Unlock()
+		return s.gossipedCapacity.rangeCount
+	}
+	rangeCount := int32(s.ReplicaCount())
+	if c := gossipedRangeCount(); c != rangeCount {
+		t.Fatalf("expected gossiped range count %d, got %d", rangeCount, c)
+	}
+
+	// Pretend the store had many more ranges when it was last gossiped.
+	s.gossipedCapacity.Lock()
+	s.gossipedCapacity.rangeCount = rangeCount * 10
+	s.gossipedCapacity.Unlock()
+
+	// With early gossip disabled, nothing happens.
+	defer settings.TestingSetFloat(gossipCapacityChangeThreshold, 0)()
+	s.maybeGossipOnCapacityChange(ctx)
+	if c := gossipedRangeCount(); c != rangeCount*10 {
+		t.Fatalf("expected gossiped range count %d, got %d", rangeCount*10, c)
+	}
+
+	defer settings.TestingSetFloat(gossipCapacityChangeThreshold, 0.05)()
+	s.maybeGossipOnCapacityChange(ctx)
+	util.SucceedsSoon(t, func() error {
+		if c := gossipedRangeCount(); c != rangeCount {
+			return errors.Errorf("expected gossiped range count %d, got %d", rangeCount, c)
+		}
+		return nil
+	})
+
+	// Early gossip is damped: a change right after the store was gossiped
+	// is held back until the minimum interval has passed.
+	util.SucceedsSoon(t, func() error {
+		if atomic.LoadInt32(&s.gossipOnCapacityChangePending) != 0 {
+			return errors.New("early gossip still pending")
+		}
+		return nil
+	})
+	defer settings.TestingSetDuration(gossipCapacityChangeMinInterval, time.Hour)()
+	s.gossipedCapacity.Lock()
+	s.gossipedCapacity.rangeCount = rangeCount * 10
+	s.gossipedCapacity.Unlock()
+	s.maybeGossipOnCapacityChange(ctx)
+	if atomic.LoadInt32(&s.gossipOnCapacityChangePending) != 1 {
+		t.Fatal("expected an early gossip to be pending")
+	}
+	if c := gossipedRangeCount(); c != rangeCount*10 {
+		t.Fatalf("expected gossiped range count %d, got %d", rangeCount*10, c)
+	}
+}
+
 type fakeSnapshotStream struct {
 	nextResp *SnapshotResponse
 	nextErr  error
@@ -2631,3 +2821,258 @@ func TestSendSnapshotThrottling(t *testing.T) {
 		}
 	}
 }
+
+// recordingSnapshotStream accepts a snapshot (unless decline is set) in the
+// given format and records the requests sent on it.
+type recordingSnapshotStream struct {
+	decline    bool
+	format     uint32
+	batches    int
+	data       [][]byte
+	logEntries [][]byte
+	finished   bool
+	recvs      int
+	header     *SnapshotRequest_Header
+	// checksumErr is the first message whose checksum didn't match, and
+	// checksum the checksum of the whole snapshot in the final message.
+	checksumErr error
+	checksum    uint32
+}
+
+func (c *recordingSnapshotStream) Recv() (*SnapshotResponse, error) {
+	c.recvs++
+	if c.decline {
+		return &SnapshotResponse{Status: SnapshotResponse_DECLINED}, nil
+	}
+	if c.recvs == 1 {
+		return &SnapshotResponse{Status: SnapshotResponse_ACCEPTED, FormatVersion: c.format}, nil
+	}
+	return &SnapshotResponse{Status: SnapshotResponse_APPLIED}, nil
+}
+
+func (c *recordingSnapshotStream) Send(request *SnapshotRequest) error {
+	if request.Header != nil {
+		c.header = request.Header
+	} else if err := verifySnapshotMessage(request); err != nil && c.checksumErr == nil {
+		c.checksumErr = err
+	}
+	if request.KVBatch != nil {
+		c.batches++
+		c.data = append(c.data, request.KVBatch)
+	}
+	c.logEntries = append(c.logEntries, request.LogEntries...)
+	if request.Final {
+		c.finished = true
+		c.checksum = request.SnapshotChecksum
+	}
+	return nil
+}
+
+// TestSendSnapshotToAll verifies that a single snapshot is streamed in full to
+// every recipient which accepts it, and that a recipient declining the
+// snapshot doesn't affect the others.
+func TestSendSnapshotToAll(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	rep, err := store.GetReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	snap, err := rep.GetSnapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rep.CloseOutSnap()
+
+	header := SnapshotRequest_Header{
+		RangeDescriptor: *rep.Desc(),
+		CanDecline:      true,
+	}
+	streams := []*recordingSnapshotStream{{}, {decline: true}, {}}
+	var outgoing []OutgoingSnapshotStream
+	var headers []SnapshotRequest_Header
+	for _, s := range streams {
+		outgoing = append(outgoing, s)
+		headers = append(headers, header)
+	}
+
+	sp := &fakeStorePool{}
+	errs := sendSnapshotToAll(ctx, outgoing, sp, headers, snap, store.Engine().NewBatch)
+	for i, s := range streams {
+		if s.decline {
+			if errs[i] == nil {
+				t.Errorf("%d: expected error from declining recipient", i)
+			}
+			if s.batches != 0 || s.finished {
+				t.Errorf("%d: declining recipient was sent the snapshot", i)
+			}
+			continue
+		}
+		if errs[i] != nil {
+			t.Errorf("%d: unexpected error: %s", i, errs[i])
+		}
+		if s.batches == 0 || !s.finished {
+			t.Errorf("%d: expected full snapshot, got %d batches (finished=%t)", i, s.batches, s.finished)
+		}
+		if s.batches != streams[0].batches {
+			t.Errorf("%d: expected %d batches, got %d", i, streams[0].batches, s.batches)
+		}
+	}
+	if sp.declinedThrottles != 1 {
+		t.Errorf("expected 1 declined throttle, but found %d", sp.declinedThrottles)
+	}
+}
+
+// TestSendSnapshotFormats verifies that a snapshot is streamed to each
+// recipient in the format it picked, and that a recipient picking a format
+// the sender didn't offer is refused.
+func TestSendSnapshotFormats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	store, _, stopper := createTestStore(t)
+	defer stopper.Stop()
+
+	rep, err := store.GetReplica(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	snap, err := rep.GetSnapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rep.CloseOutSnap()
+
+	header := SnapshotRequest_Header{RangeDescriptor: *rep.Desc()}
+	streams := []*recordingSnapshotStream{
+		{format: snapshotFormatKVBatch},
+		{format: snapshotFormatCompressedKVBatch},
+		{format: snapshotFormatSnappyKVBatch},
+		{format: snapshotFormatLatest + 1},
+	}
+	var outgoing []OutgoingSnapshotStream
+	var headers []SnapshotRequest_Header
+	for _, s := range streams {
+		outgoing = append(outgoing, s)
+		headers = append(headers, header)
+	}
+
+	errs := sendSnapshotToAll(ctx, outgoing, &fakeStorePool{}, headers, snap, store.Engine().NewBatch)
+	for i, s := range streams {
+		if s.header == nil || s.header.FormatVersion != snapshotFormatLatest {
+			t.Errorf("%d: expected the header to offer format %d, got %+v", i, snapshotFormatLatest, s.header)
+		}
+	}
+	if !testutils.IsError(errs[3], "unsupported snapshot format") {
+		t.Errorf("expected unsupported snapshot format error, got %v", errs[3])
+	}
+	for i := range streams[:3] {
+		if errs[i] != nil {
+			t.Fatalf("%d: unexpected error: %s", i, errs[i])
+		}
+	}
+
+	// The recipients verify the checksums of the messages, and that of the
+	// whole snapshot against the decoded batches, which it doesn't depend on.
+	for _, s := range streams[:3] {
+		if !s.header.Checksummed {
+			t.Errorf("format %d: expected the header to announce checksums", s.format)
+		}
+		if s.checksumErr != nil {
+			t.Errorf("format %d: %s", s.format, s.checksumErr)
+		}
+		var checksum snapshotChecksum
+		for _, data := range s.data {
+			repr, err := decodeSnapshotBatch(s.format, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checksum.add(repr)
+		}
+		checksum.addLogEntries(s.logEntries)
+		if err := checksum.verify(s.checksum); err != nil {
+			t.Errorf("format %d: %s", s.format, err)
+		}
+		if s.checksum != streams[0].checksum {
+			t.Errorf("format %d: expected snapshot checksum %08x, got %08x",
+				s.format, streams[0].checksum, s.checksum)
+		}
+	}
+
+	// All the recipients decode the same batches.
+	for _, s := range streams[1:3] {
+		if a, e := len(s.data), len(streams[0].data); a != e || a == 0 {
+			t.Fatalf("format %d: expected %d batches, got %d", s.format, e, a)
+		}
+		for i, data := range s.data {
+			if bytes.Equal(data, streams[0].data[i]) {
+				t.Errorf("format %d: %d: expected compressed batch to differ from the uncompressed one",
+					s.format, i)
+			}
+			repr, err := decodeSnapshotBatch(s.format, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(repr, streams[0].data[i]) {
+				t.Errorf("format %d: %d: decompressed batch does not match the uncompressed one",
+					s.format, i)
+			}
+		}
+	}
+}
+
+// TestPickSnapshotFormat verifies that the snapshot format picked by a
+// recipient is capped by both the sender's and the recipient's
+// kv.snapshot.compression.
+func TestPickSnapshotFormat(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testCases := []struct {
+		compression int64
+		sender      uint32
+		expected    uint32
+	}{
+		{int64(snapshotFormatSnappyKVBatch), snapshotFormatKVBatch, snapshotFormatKVBatch},
+		{int64(snapshotFormatSnappyKVBatch), snapshotFormatCompressedKVBatch, snapshotFormatCompressedKVBatch},
+		{int64(snapshotFormatSnappyKVBatch), snapshotFormatSnappyKVBatch, snapshotFormatSnappyKVBatch},
+		{int64(snapshotFormatSnappyKVBatch), snapshotFormatLatest + 1, snapshotFormatLatest},
+		{int64(snapshotFormatCompressedKVBatch), snapshotFormatSnappyKVBatch, snapshotFormatCompressedKVBatch},
+		{int64(snapshotFormatKVBatch), snapshotFormatSnappyKVBatch, snapshotFormatKVBatch},
+		{-1, snapshotFormatSnappyKVBatch, snapshotFormatKVBatch},
+		{100, snapshotFormatLatest + 1, snapshotFormatLatest},
+	}
+	for i, c := range testCases {
+		func() {
+			defer settings.TestingSetInt(snapshotCompression, c.compression)()
+			if format := pickSnapshotFormat(c.sender); format != c.expected {
+				t.Errorf("%d: expected format %d, got %d", i, c.expected, format)
+			}
+		}()
+	}
+}
+
+// TestDeadReplicasByRisk verifies that dead replicas are ordered so that the
+// replicas of the ranges closest to losing quorum come first, and those of
+// ranges which lost quorum come last.
+func TestDeadReplicasByRisk(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	replicas := []roachpb.ReplicaIdent{
+		{RangeID: 1}, {RangeID: 2}, {RangeID: 3}, {RangeID: 4}, {RangeID: 5},
+	}
+	spare := map[roachpb.RangeID]int{
+		1: 2,
+		2: -1,
+		3: 0,
+		5: 0,
+	}
+	sort.Sort(deadReplicasByRisk{replicas: replicas, spare: spare})
+	var rangeIDs []roachpb.RangeID
+	for _, r := range replicas {
+		rangeIDs = append(rangeIDs, r.RangeID)
+	}
+	if e := []roachpb.RangeID{3, 5, 1, 2, 4}; !reflect.DeepEqual(rangeIDs, e) {
+		t.Errorf("expected dead replicas of ranges %v, got %v", e, rangeIDs)
+	}
+}
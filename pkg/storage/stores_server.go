@@ -34,6 +34,10 @@ type Server struct {
 
 var _ FreezeServer = Server{}
 var _ ConsistencyServer = Server{}
+var _ StoreJobsServer = Server{}
+var _ StoreAttributesServer = Server{}
+var _ RaftRepairServer = Server{}
+var _ StoreQueuesServer = Server{}
 
 // MakeServer returns a new instance of Server.
 func MakeServer(descriptor *roachpb.NodeDescriptor, stores *Stores) Server {
@@ -81,7 +85,12 @@ func (is Server) CollectChecksum(
 				return err
 			}
 			resp.Checksum = c.checksum
+			resp.Persisted = c.persisted
 			if !bytes.Equal(req.Checksum, c.checksum) {
+				if req.Terminate {
+					log.Fatalf(ctx, "replica of range ID %s is inconsistent with the majority of its "+
+						"replicas: expected checksum %x, got %x", req.RangeID, req.Checksum, c.checksum)
+				}
 				log.Errorf(ctx, "consistency check failed on range ID %s: expected checksum %x, got %x",
 					req.RangeID, req.Checksum, c.checksum)
 				resp.Snapshot = c.snapshot
@@ -90,3 +99,144 @@ func (is Server) CollectChecksum(
 		})
 	return resp, err
 }
+
+// ListStoreJobs implements StoreJobsServer.
+func (is Server) ListStoreJobs(
+	ctx context.Context, req *ListStoreJobsRequest,
+) (*ListStoreJobsResponse, error) {
+	resp := &ListStoreJobsResponse{}
+	err := is.execStoreCommand(req.StoreRequestHeader,
+		func(s *Store) error {
+			resp.Jobs = s.Jobs()
+			return nil
+		})
+	return resp, err
+}
+
+// PauseStoreJob implements StoreJobsServer.
+func (is Server) PauseStoreJob(
+	ctx context.Context, req *StoreJobRequest,
+) (*StoreJobResponse, error) {
+	resp := &StoreJobResponse{}
+	err := is.execStoreCommand(req.StoreRequestHeader,
+		func(s *Store) error {
+			var err error
+			resp.Job, err = s.PauseJob(req.JobID)
+			return err
+		})
+	return resp, err
+}
+
+// ResumeStoreJob implements StoreJobsServer.
+func (is Server) ResumeStoreJob(
+	ctx context.Context, req *StoreJobRequest,
+) (*StoreJobResponse, error) {
+	resp := &StoreJobResponse{}
+	err := is.execStoreCommand(req.StoreRequestHeader,
+		func(s *Store) error {
+			var err error
+			resp.Job, err = s.ResumeJob(req.JobID)
+			return err
+		})
+	return resp, err
+}
+
+// CancelStoreJob implements StoreJobsServer.
+func (is Server) CancelStoreJob(
+	ctx context.Context, req *StoreJobRequest,
+) (*StoreJobResponse, error) {
+	resp := &StoreJobResponse{}
+	err := is.execStoreCommand(req.StoreRequestHeader,
+		func(s *Store) error {
+			var err error
+			resp.Job, err = s.CancelJob(req.JobID)
+			return err
+		})
+	return resp, err
+}
+
+// UpdateStoreAttributes implements StoreAttributesServer.
+func (is Server) UpdateStoreAttributes(
+	ctx context.Context, req *UpdateStoreAttributesRequest,
+) (*UpdateStoreAttributesResponse, error) {
+	resp := &UpdateStoreAttributesResponse{}
+	err := is.execStoreCommand(req.StoreRequestHeader,
+		func(s *Store) error {
+			desc, err := s.UpdateAttributes(ctx, req.Attrs, req.Locality)
+			if err != nil {
+				return err
+			}
+			resp.Store = *desc
+			return nil
+		})
+	return resp, err
+}
+
+// SetStoreReadOnly implements StoreAttributesServer.
+func (is Server) SetStoreReadOnly(
+	ctx context.Context, req *SetStoreReadOnlyRequest,
+) (*UpdateStoreAttributesResponse, error) {
+	resp := &UpdateStoreAttributesResponse{}
+	err := is.execStoreCommand(req.StoreRequestHeader,
+		func(s *Store) error {
+			desc, err := s.SetReadOnly(ctx, req.ReadOnly)
+			if err != nil {
+				return err
+			}
+			resp.Store = *desc
+			return nil
+		})
+	return resp, err
+}
+
+// InspectPoisonedEntry implements RaftRepairServer.
+func (is Server) InspectPoisonedEntry(
+	ctx context.Context, req *InspectPoisonedEntryRequest,
+) (*InspectPoisonedEntryResponse, error) {
+	resp := &InspectPoisonedEntryResponse{}
+	err := is.execStoreCommand(req.StoreRequestHeader,
+		func(s *Store) error {
+			r, err := s.GetReplica(req.RangeID)
+			if err != nil {
+				return err
+			}
+			resp.Entry = r.PoisonedEntry()
+			return nil
+		})
+	return resp, err
+}
+
+// DiscardPoisonedEntry implements RaftRepairServer.
+func (is Server) DiscardPoisonedEntry(
+	ctx context.Context, req *DiscardPoisonedEntryRequest,
+) (*DiscardPoisonedEntryResponse, error) {
+	resp := &DiscardPoisonedEntryResponse{}
+	err := is.execStoreCommand(req.StoreRequestHeader,
+		func(s *Store) error {
+			r, err := s.GetReplica(req.RangeID)
+			if err != nil {
+				return err
+			}
+			if req.LocalOnly {
+				resp.Entry, err = r.discardPoisonedEntryLocal(ctx, req.Index, req.Reason)
+			} else {
+				resp.Entry, err = r.DiscardPoisonedEntry(ctx, req.Index, req.Reason)
+			}
+			return err
+		})
+	return resp, err
+}
+
+// EnqueueRange implements StoreQueuesServer.
+func (is Server) EnqueueRange(
+	ctx context.Context, req *EnqueueRangeRequest,
+) (*EnqueueRangeResponse, error) {
+	resp := &EnqueueRangeResponse{}
+	err := is.execStoreCommand(req.StoreRequestHeader,
+		func(s *Store) error {
+			var err error
+			*resp, err = s.ManuallyEnqueue(ctx, req.Queue, req.RangeID, req.SkipShouldQueue)
+			return err
+		})
+	return resp, err
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+)
+
+// throttleExemptSpans are the key spans whose requests are never delayed or
+// rejected by the store's overload protection. The cluster can't recover
+// from an overload if the meta records can't be updated, e.g. to split an
+// oversized range, or if node liveness heartbeats time out, which would in
+// turn expire the epoch-based leases of the node. The span covers all of the
+// system keys, which include node liveness, as the rest of them (e.g. the ID
+// generators and node statuses) see little traffic which the cluster relies
+// on.
+var throttleExemptSpans = []roachpb.Span{
+	{Key: keys.Meta1Prefix, EndKey: keys.SystemMax},
+}
+
+// throttleExemptMethods are the request types which are never delayed or
+// rejected by the store's overload protection: the lease requests, which
+// let a range serve any request at all, and the raft log truncations, which
+// relieve raft log growth.
+var throttleExemptMethods = map[roachpb.Method]struct{}{
+	roachpb.RequestLease:  {},
+	roachpb.TransferLease: {},
+	roachpb.TruncateLog:   {},
+}
+
+// isThrottleExempt returns true if the batch contains a request which is
+// exempt from the store's overload protection, either because of its type
+// or because it touches one of the throttleExemptSpans. The whole batch is
+// exempted, since delaying it would delay the exempt request as well.
+func isThrottleExempt(ba roachpb.BatchRequest) bool {
+	for _, union := range ba.Requests {
+		arg := union.GetInner()
+		if _, ok := throttleExemptMethods[arg.Method()]; ok {
+			return true
+		}
+		span := roachpb.Span{Key: arg.Header().Key, EndKey: arg.Header().EndKey}
+		for _, exempt := range throttleExemptSpans {
+			if span.Overlaps(exempt) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestIsThrottleExempt(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	put := putArgs(roachpb.Key("a"), []byte("value"))
+	metaPut := putArgs(keys.RangeMetaKey(roachpb.RKey("a")), []byte("value"))
+	livenessPut := putArgs(keys.NodeLivenessKey(1), []byte("value"))
+	statusPut := putArgs(keys.NodeStatusKey(1), []byte("value"))
+	tablePut := putArgs(keys.MakeTablePrefix(keys.DescriptorTableID), []byte("value"))
+	metaScan := roachpb.ScanRequest{Span: roachpb.Span{Key: roachpb.KeyMin, EndKey: roachpb.Key("a")}}
+	beforeMetaScan := roachpb.ScanRequest{Span: roachpb.Span{Key: roachpb.KeyMin, EndKey: keys.Meta1Prefix}}
+	truncate := roachpb.TruncateLogRequest{}
+	lease := roachpb.RequestLeaseRequest{}
+	transfer := roachpb.TransferLeaseRequest{}
+
+	testCases := []struct {
+		reqs     []roachpb.Request
+		expected bool
+	}{
+		{[]roachpb.Request{&put}, false},
+		{[]roachpb.Request{&beforeMetaScan}, false},
+		{[]roachpb.Request{&metaPut}, true},
+		{[]roachpb.Request{&livenessPut}, true},
+		{[]roachpb.Request{&statusPut}, true},
+		{[]roachpb.Request{&tablePut}, false},
+		{[]roachpb.Request{&metaScan}, true},
+		{[]roachpb.Request{&put, &livenessPut}, true},
+		{[]roachpb.Request{&truncate}, true},
+		{[]roachpb.Request{&lease}, true},
+		{[]roachpb.Request{&transfer}, true},
+	}
+	for i, c := range testCases {
+		var ba roachpb.BatchRequest
+		ba.Add(c.reqs...)
+		if a := isThrottleExempt(ba); a != c.expected {
+			t.Errorf("%d: expected %t, got %t", i, c.expected, a)
+		}
+	}
+}
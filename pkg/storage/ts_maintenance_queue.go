@@ -47,8 +47,8 @@ type TimeSeriesDataStore interface {
 
 // timeSeriesMaintenanceQueue identifies replicas that contain time series
 // data and performs necessary data maintenance on the time series located in
-// the replica. Currently, maintenance involves pruning time series data older
-// than a certain threshold.
+// the replica. Currently, maintenance involves rolling up time series data
+// older than a certain threshold to a lower resolution, and then pruning it.
 //
 // Logic for time series maintenance is implemented in a higher level time
 // series package; this queue uses the TimeSeriesDataStore interface to call
@@ -89,12 +89,15 @@ func newTimeSeriesMaintenanceQueue(
 		"timeSeriesMaintenance", tsmq, store, g,
 		queueConfig{
 			maxSize:              timeSeriesMaintenanceQueueMaxSize,
+			enabled:              timeSeriesMaintenanceQueueEnabled,
 			needsLease:           true,
 			acceptsUnsplitRanges: true,
 			successes:            store.metrics.TimeSeriesMaintenanceQueueSuccesses,
 			failures:             store.metrics.TimeSeriesMaintenanceQueueFailures,
 			pending:              store.metrics.TimeSeriesMaintenanceQueuePending,
 			processingNanos:      store.metrics.TimeSeriesMaintenanceQueueProcessingNanos,
+			purgatory:            store.metrics.TimeSeriesMaintenanceQueuePurgatory,
+			processingLatency:    store.metrics.TimeSeriesMaintenanceQueueProcessingLatency,
 		},
 	)
 
@@ -102,8 +105,11 @@ func newTimeSeriesMaintenanceQueue(
 }
 
 func (tsmq *timeSeriesMaintenanceQueue) shouldQueue(
-	_ context.Context, _ hlc.Timestamp, repl *Replica, _ config.SystemConfig,
+	_ context.Context, now hlc.Timestamp, repl *Replica, _ config.SystemConfig,
 ) (shouldQ bool, priority float64) {
+	if outsideMaintenanceWindow(now.GoTime()) {
+		return false, 0
+	}
 	desc := repl.Desc()
 	return tsmq.tsData.ContainsTimeSeries(desc.StartKey, desc.EndKey), 0
 }
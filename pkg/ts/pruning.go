@@ -39,7 +39,8 @@ func (tsdb *DB) ContainsTimeSeries(start, end roachpb.RKey) bool {
 }
 
 // PruneTimeSeries prunes old data for any time series found in the supplied
-// key range.
+// key range. Data at a resolution which has a lower rollup resolution is
+// rolled up to it before it is pruned.
 //
 // The snapshot should be supplied by a local store, and is used only to
 // discover the names of time series which are store in that snapshot. The KV
@@ -61,6 +62,9 @@ func (tsdb *DB) PruneTimeSeries(
 	if err != nil {
 		return err
 	}
+	if err := rollupTimeSeries(ctx, db, series, timestamp); err != nil {
+		return err
+	}
 	return pruneTimeSeries(ctx, db, series, timestamp)
 }
 
@@ -0,0 +1,177 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ts
+
+import (
+	"sort"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/internal/client"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+)
+
+// rollupSlab identifies a key of rolled up data: the slab of a source at the
+// rollup resolution.
+type rollupSlab struct {
+	source         string
+	startTimestamp int64
+}
+
+// rollupTimeSeries rolls up the data of the supplied time series which is
+// old enough to be pruned into the lower resolution the series' resolution
+// maps to, if any. It must run before the data is pruned.
+//
+// Pruning deletes whole slabs, and slabs are a multiple of the sample
+// duration of the rollup resolution, so the rolled up samples are computed
+// from complete sets of samples. Each rolled up sample replaces any existing
+// sample at the same offset rather than being merged into it, which makes
+// the rollup idempotent: it is safe to run it concurrently on multiple
+// nodes, or again if pruning failed.
+func rollupTimeSeries(
+	ctx context.Context, db *client.DB, timeSeriesList []timeSeriesResolutionInfo, now hlc.Timestamp,
+) error {
+	thresholds := computeThresholds(now.WallTime)
+
+	for _, timeSeries := range timeSeriesList {
+		target, ok := rollupResolutionByResolution[timeSeries.Resolution]
+		if !ok {
+			continue
+		}
+		threshold, ok := thresholds[timeSeries.Resolution]
+		if !ok {
+			continue
+		}
+		// This is the span pruneTimeSeries deletes.
+		start := makeDataKeySeriesPrefix(timeSeries.Name, timeSeries.Resolution)
+		end := MakeDataKey(timeSeries.Name, "", timeSeries.Resolution, threshold)
+		kvs, err := db.Scan(ctx, start, end, 0)
+		if err != nil {
+			return err
+		}
+
+		rollups := make(map[rollupSlab]map[int32]roachpb.InternalTimeSeriesSample)
+		for _, kv := range kvs {
+			_, source, _, _, err := DecodeDataKey(kv.Key)
+			if err != nil {
+				return err
+			}
+			data, err := kv.Value.GetTimeseries()
+			if err != nil {
+				return err
+			}
+			for _, sample := range data.Samples {
+				timestamp := data.StartTimestampNanos + int64(sample.Offset)*data.SampleDurationNanos
+				slab := rollupSlab{
+					source:         source,
+					startTimestamp: timestamp - timestamp%target.SlabDuration(),
+				}
+				samples, ok := rollups[slab]
+				if !ok {
+					samples = make(map[int32]roachpb.InternalTimeSeriesSample)
+					rollups[slab] = samples
+				}
+				offset := int32((timestamp - slab.startTimestamp) / target.SampleDuration())
+				if rolledUp, ok := samples[offset]; ok {
+					samples[offset] = accumulateSample(rolledUp, sample)
+				} else {
+					samples[offset] = accumulateSample(
+						roachpb.InternalTimeSeriesSample{Offset: offset}, sample)
+				}
+			}
+		}
+
+		for slab, samples := range rollups {
+			key := MakeDataKey(timeSeries.Name, slab.source, target, slab.startTimestamp)
+			existing, err := db.Get(ctx, key)
+			if err != nil {
+				return err
+			}
+			data := roachpb.InternalTimeSeriesData{
+				StartTimestampNanos: slab.startTimestamp,
+				SampleDurationNanos: target.SampleDuration(),
+			}
+			if existing.Value != nil {
+				if data, err = existing.Value.GetTimeseries(); err != nil {
+					return err
+				}
+			}
+			data.Samples = replaceSamples(data.Samples, samples)
+			var value roachpb.Value
+			if err := value.SetProto(&data); err != nil {
+				return err
+			}
+			if err := db.PutInline(ctx, key, &value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// accumulateSample returns the rolled up sample, with the measurements of
+// the sample added to it.
+func accumulateSample(
+	rolledUp, sample roachpb.InternalTimeSeriesSample,
+) roachpb.InternalTimeSeriesSample {
+	count := sample.Count
+	if count == 0 {
+		// Samples are no longer accumulated and may leave the count unset.
+		count = 1
+	}
+	max, min := sample.Maximum(), sample.Minimum()
+	if rolledUp.Count == 0 {
+		rolledUp.Max, rolledUp.Min = &max, &min
+	} else {
+		if max > *rolledUp.Max {
+			rolledUp.Max = &max
+		}
+		if min < *rolledUp.Min {
+			rolledUp.Min = &min
+		}
+	}
+	rolledUp.Count += count
+	rolledUp.Sum += sample.Sum
+	return rolledUp
+}
+
+// replaceSamples returns the existing samples, with the ones at the offsets
+// of the replacements replaced, sorted by offset.
+func replaceSamples(
+	existing []roachpb.InternalTimeSeriesSample,
+	replacements map[int32]roachpb.InternalTimeSeriesSample,
+) []roachpb.InternalTimeSeriesSample {
+	result := make([]roachpb.InternalTimeSeriesSample, 0, len(existing)+len(replacements))
+	for _, sample := range existing {
+		if _, ok := replacements[sample.Offset]; !ok {
+			result = append(result, sample)
+		}
+	}
+	for _, sample := range replacements {
+		result = append(result, sample)
+	}
+	sort.Sort(samplesByOffset(result))
+	return result
+}
+
+// samplesByOffset implements sort.Interface for samples, ordering them by
+// offset.
+type samplesByOffset []roachpb.InternalTimeSeriesSample
+
+func (s samplesByOffset) Len() int           { return len(s) }
+func (s samplesByOffset) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s samplesByOffset) Less(i, j int) bool { return s[i].Offset < s[j].Offset }
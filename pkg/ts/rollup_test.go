@@ -0,0 +1,95 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ts
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/ts/tspb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+)
+
+func TestRollupTimeSeries(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	tm := newTestModel(t)
+	tm.Start()
+	defer tm.Stop()
+
+	// Arbitrary timestamp
+	var now int64 = 1475700000 * 1e9
+
+	// Store 10s data in a 30m slab which is old enough to be pruned: three
+	// datapoints in the first 30m sample and one in the second.
+	day := int64(24 * time.Hour)
+	start := now - 60*day
+	start -= start % day
+	tm.storeTimeSeriesData(Resolution10s, []tspb.TimeSeriesData{
+		{
+			Name:   "metric.a",
+			Source: "source1",
+			Datapoints: []tspb.TimeSeriesDatapoint{
+				{TimestampNanos: start + int64(5*time.Second), Value: 1},
+				{TimestampNanos: start + int64(15*time.Second), Value: 3},
+				{TimestampNanos: start + int64(25*time.Minute), Value: 2},
+				{TimestampNanos: start + int64(35*time.Minute), Value: 10},
+			},
+		},
+	})
+
+	float := func(f float64) *float64 {
+		return &f
+	}
+	expected := roachpb.InternalTimeSeriesData{
+		StartTimestampNanos: start,
+		SampleDurationNanos: Resolution30m.SampleDuration(),
+		Samples: []roachpb.InternalTimeSeriesSample{
+			{Offset: 0, Count: 3, Sum: 6, Max: float(3), Min: float(1)},
+			{Offset: 1, Count: 1, Sum: 10, Max: float(10), Min: float(10)},
+		},
+	}
+
+	// Rolling up twice must not count the samples twice.
+	for i := 0; i < 2; i++ {
+		if err := rollupTimeSeries(
+			context.TODO(),
+			tm.LocalTestCluster.DB,
+			[]timeSeriesResolutionInfo{{Name: "metric.a", Resolution: Resolution10s}},
+			hlc.Timestamp{WallTime: now},
+		); err != nil {
+			t.Fatal(err)
+		}
+		kv, err := tm.LocalTestCluster.DB.Get(
+			context.TODO(), MakeDataKey("metric.a", "source1", Resolution30m, start))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kv.Value == nil {
+			t.Fatalf("%d: no rolled up data found", i)
+		}
+		actual, err := kv.Value.GetTimeseries()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%d: rolled up data %v, expected %v", i, actual, expected)
+		}
+	}
+}
@@ -260,6 +260,36 @@ export default class extends React.Component<IInjectedProps, {}> {
               </Axis>
             </LineGraph>
 
+            <LineGraph title="Queue Pending Count" sources={sources}>
+              <Axis format={ d3.format(".1f") }>
+                <Metric name="cr.store.queue.split.pending" title="Split" />
+                <Metric name="cr.store.queue.replicate.pending" title="Replicate" />
+                <Metric name="cr.store.queue.gc.pending" title="GC" />
+                <Metric name="cr.store.queue.raftlog.pending" title="Raft Log" />
+                <Metric name="cr.store.queue.consistency.pending" title="Consistency" />
+              </Axis>
+            </LineGraph>
+
+            <LineGraph title="Queue Purgatory Count" sources={sources}>
+              <Axis format={ d3.format(".1f") }>
+                <Metric name="cr.store.queue.split.purgatory" title="Split" />
+                <Metric name="cr.store.queue.replicate.purgatory" title="Replicate" />
+                <Metric name="cr.store.queue.gc.purgatory" title="GC" />
+                <Metric name="cr.store.queue.raftlog.purgatory" title="Raft Log" />
+                <Metric name="cr.store.queue.consistency.purgatory" title="Consistency" />
+              </Axis>
+            </LineGraph>
+
+            <LineGraph title="Queue Processing Failures" sources={sources}>
+              <Axis format={ d3.format(".1f") }>
+                <Metric name="cr.store.queue.split.process.failure" title="Split" nonNegativeRate />
+                <Metric name="cr.store.queue.replicate.process.failure" title="Replicate" nonNegativeRate />
+                <Metric name="cr.store.queue.gc.process.failure" title="GC" nonNegativeRate />
+                <Metric name="cr.store.queue.raftlog.process.failure" title="Raft Log" nonNegativeRate />
+                <Metric name="cr.store.queue.consistency.process.failure" title="Consistency" nonNegativeRate />
+              </Axis>
+            </LineGraph>
+
             <LineGraph title="Raft Transport Queue Pending Count" sources={sources}>
               <Axis format={ d3.format(".1f") }>
                 <Metric name="cr.store.raft.enqueued.pending" title="Outstanding message count in the Raft Transport queue to be sent over the network" />
@@ -0,0 +1,171 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package extstorage provides access to files stored outside of the
+// cluster, such as the output of a backup. The location of the files is
+// given as a URI whose scheme selects the implementation. A plain path or a
+// file:// URI refers to a local, possibly NFS mounted, directory. An http://
+// or https:// URI refers to a server supporting GET, PUT, HEAD and DELETE
+// requests. An s3://bucket/path URI refers to Amazon S3 or, if an endpoint is
+// given, any S3-compatible service, and a gs://bucket/path URI refers to
+// Google Cloud Storage through its S3-compatible interface.
+//
+// Credentials are passed as query parameters of the URI (see the S3* and
+// GS* constants). They are never taken from the environment of the process,
+// and they are removed from the URI when it is printed.
+package extstorage
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// ExternalStorage provides access to the files below a location outside of
+// the cluster. Files are identified by their basename, a slash-separated
+// path relative to that location.
+type ExternalStorage interface {
+	io.Closer
+
+	// String returns the URI of the location with any credentials redacted.
+	String() string
+
+	// ReadFile returns a reader for the contents of the named file. The
+	// caller must close it.
+	ReadFile(ctx context.Context, basename string) (io.ReadCloser, error)
+
+	// WriteFile creates or replaces the named file with the given contents.
+	// The contents are read from their start; they may be read more than
+	// once.
+	WriteFile(ctx context.Context, basename string, content io.ReadSeeker) error
+
+	// Delete removes the named file.
+	Delete(ctx context.Context, basename string) error
+
+	// Size returns the size of the named file in bytes.
+	Size(ctx context.Context, basename string) (int64, error)
+}
+
+// URI query parameters holding credentials and settings for the S3 and GCS
+// implementations.
+const (
+	S3AccessKeyParam = "AWS_ACCESS_KEY_ID"
+	S3SecretParam    = "AWS_SECRET_ACCESS_KEY"
+	// S3RegionParam defaults to us-east-1.
+	S3RegionParam = "AWS_REGION"
+	// S3EndpointParam overrides the endpoint of the service, e.g. to use an
+	// S3-compatible service other than Amazon S3. It defaults to
+	// https://s3.amazonaws.com.
+	S3EndpointParam = "AWS_ENDPOINT"
+
+	GSAccessKeyParam = "GS_HMAC_ACCESS_KEY"
+	GSSecretParam    = "GS_HMAC_SECRET"
+)
+
+// secretParams are the query parameters redacted by RedactURI.
+var secretParams = []string{S3SecretParam, GSSecretParam}
+
+// FromURI returns the ExternalStorage for the given URI. If metrics is
+// non-nil, the operations on the storage are recorded in it.
+func FromURI(uri string, metrics *Metrics) (ExternalStorage, error) {
+	es, err := fromURI(uri)
+	if err != nil {
+		return nil, errors.Wrapf(err, "external storage %s", RedactURI(uri))
+	}
+	if metrics != nil {
+		es = &instrumentedStorage{ExternalStorage: es, metrics: metrics}
+	}
+	return es, nil
+}
+
+func fromURI(uri string) (ExternalStorage, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "":
+		return makeLocalStorage(uri)
+	case "file":
+		if u.Host != "" {
+			return nil, errors.Errorf("unexpected host %q", u.Host)
+		}
+		return makeLocalStorage(u.Path)
+	case "http", "https":
+		return makeHTTPStorage(u)
+	case "s3":
+		return makeS3Storage(u)
+	case "gs":
+		return makeGSStorage(u)
+	default:
+		return nil, errors.Errorf("unsupported scheme %q", u.Scheme)
+	}
+}
+
+// RedactURI returns the URI with the values of any credentials replaced.
+// Malformed URIs are returned unmodified, as they cannot be used to access
+// a storage.
+func RedactURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	redacted := false
+	for _, p := range secretParams {
+		if _, ok := q[p]; ok {
+			q.Set(p, "redacted")
+			redacted = true
+		}
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "redacted")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return uri
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// checkBasename returns an error if basename would escape the location of
+// the storage.
+func checkBasename(basename string) error {
+	if basename == "" {
+		return errors.New("empty file name")
+	}
+	for _, part := range strings.Split(basename, "/") {
+		if part == ".." {
+			return errors.Errorf("invalid file name %q", basename)
+		}
+	}
+	return nil
+}
+
+// joinPath joins a prefix and a basename with a single slash.
+func joinPath(prefix, basename string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	basename = strings.TrimPrefix(basename, "/")
+	if prefix == "" {
+		return basename
+	}
+	return fmt.Sprintf("%s/%s", prefix, basename)
+}
@@ -0,0 +1,179 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package extstorage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// httpTimeout bounds the time spent establishing connections and waiting
+// for response headers. Transfers themselves are bounded by the context.
+const httpTimeout = 30 * time.Second
+
+// newHTTPClient returns the client used by the HTTP-based storages.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			TLSHandshakeTimeout:   httpTimeout,
+			ResponseHeaderTimeout: httpTimeout,
+			MaxIdleConnsPerHost:   8,
+		},
+	}
+}
+
+// httpError is returned when a server responds with an unexpected status.
+type httpError struct {
+	method, url string
+	status      string
+	body        string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("%s %s: %s: %s", e.method, e.url, e.status, e.body)
+}
+
+// checkResponse returns an error and closes the response body unless the
+// response has a 2xx status.
+func checkResponse(req *http.Request, resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	u := *req.URL
+	u.RawQuery = ""
+	return &httpError{
+		method: req.Method,
+		url:    u.String(),
+		status: resp.Status,
+		body:   string(body),
+	}
+}
+
+// httpStorage stores files on an HTTP server which supports GET, PUT, HEAD
+// and DELETE requests, such as a WebDAV server.
+type httpStorage struct {
+	base   *url.URL
+	client *http.Client
+}
+
+var _ ExternalStorage = &httpStorage{}
+
+func makeHTTPStorage(u *url.URL) (ExternalStorage, error) {
+	if u.Host == "" {
+		return nil, errors.New("http storage requires a host")
+	}
+	base := *u
+	return &httpStorage{base: &base, client: newHTTPClient()}, nil
+}
+
+func (h *httpStorage) String() string {
+	return RedactURI(h.base.String())
+}
+
+func (h *httpStorage) req(
+	ctx context.Context, method, basename string, body io.ReadSeeker,
+) (*http.Response, error) {
+	if err := checkBasename(basename); err != nil {
+		return nil, err
+	}
+	u := *h.base
+	u.Path = joinPath(u.Path, basename)
+	if u.Path[0] != '/' {
+		u.Path = "/" + u.Path
+	}
+
+	var reqBody io.Reader
+	var contentLength int64
+	if body != nil {
+		var err error
+		if contentLength, err = body.Seek(0, io.SeekEnd); err != nil {
+			return nil, err
+		}
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if contentLength > 0 {
+			reqBody = body
+		}
+	}
+	req, err := http.NewRequest(method, u.String(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = contentLength
+	resp, err := h.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (h *httpStorage) ReadFile(ctx context.Context, basename string) (io.ReadCloser, error) {
+	resp, err := h.req(ctx, "GET", basename, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (h *httpStorage) WriteFile(
+	ctx context.Context, basename string, content io.ReadSeeker,
+) error {
+	resp, err := h.req(ctx, "PUT", basename, content)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (h *httpStorage) Delete(ctx context.Context, basename string) error {
+	resp, err := h.req(ctx, "DELETE", basename, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (h *httpStorage) Size(ctx context.Context, basename string) (int64, error) {
+	resp, err := h.req(ctx, "HEAD", basename, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return 0, errors.Errorf("HEAD %s: unknown size", basename)
+	}
+	return resp.ContentLength, nil
+}
+
+func (h *httpStorage) Close() error {
+	if t, ok := h.client.Transport.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package extstorage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// localStorage stores files in a directory of the local filesystem, which
+// may be a network filesystem shared by all nodes.
+type localStorage struct {
+	base string
+}
+
+var _ ExternalStorage = &localStorage{}
+
+func makeLocalStorage(base string) (ExternalStorage, error) {
+	if base == "" {
+		return nil, errors.New("local storage requires a path")
+	}
+	return &localStorage{base: base}, nil
+}
+
+func (l *localStorage) String() string {
+	return l.base
+}
+
+func (l *localStorage) path(basename string) (string, error) {
+	if err := checkBasename(basename); err != nil {
+		return "", err
+	}
+	return filepath.Join(l.base, filepath.FromSlash(basename)), nil
+}
+
+func (l *localStorage) ReadFile(_ context.Context, basename string) (io.ReadCloser, error) {
+	p, err := l.path(basename)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// WriteFile writes the contents to a temporary file which is then renamed,
+// so that readers never observe a partially written file.
+func (l *localStorage) WriteFile(
+	_ context.Context, basename string, content io.ReadSeeker,
+) (err error) {
+	p, err := l.path(basename)
+	if err != nil {
+		return err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(p)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if _, err := io.Copy(f, content); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (l *localStorage) Delete(_ context.Context, basename string) error {
+	p, err := l.path(basename)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func (l *localStorage) Size(_ context.Context, basename string) (int64, error) {
+	p, err := l.path(basename)
+	if err != nil {
+		return 0, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+func (l *localStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package extstorage
+
+import (
+	"io"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+var (
+	metaReadBytes = metric.Metadata{
+		Name: "extstorage.read.bytes",
+		Help: "Number of bytes read from external storage"}
+	metaWriteBytes = metric.Metadata{
+		Name: "extstorage.write.bytes",
+		Help: "Number of bytes written to external storage"}
+	metaReadLatency = metric.Metadata{
+		Name: "extstorage.read.latency",
+		Help: "Latency of opening files for reading on external storage"}
+	metaWriteLatency = metric.Metadata{
+		Name: "extstorage.write.latency",
+		Help: "Latency of writing files to external storage"}
+	metaErrors = metric.Metadata{
+		Name: "extstorage.errors",
+		Help: "Number of failed external storage operations"}
+)
+
+// Metrics are the metrics recorded for the operations on external storages.
+type Metrics struct {
+	ReadBytes    *metric.Counter
+	WriteBytes   *metric.Counter
+	ReadLatency  *metric.Histogram
+	WriteLatency *metric.Histogram
+	Errors       *metric.Counter
+}
+
+// MakeMetrics returns a Metrics struct whose histograms retain data for
+// approximately sampleInterval.
+func MakeMetrics(sampleInterval time.Duration) Metrics {
+	return Metrics{
+		ReadBytes:    metric.NewCounter(metaReadBytes),
+		WriteBytes:   metric.NewCounter(metaWriteBytes),
+		ReadLatency:  metric.NewLatency(metaReadLatency, sampleInterval),
+		WriteLatency: metric.NewLatency(metaWriteLatency, sampleInterval),
+		Errors:       metric.NewCounter(metaErrors),
+	}
+}
+
+// instrumentedStorage records the operations on the wrapped storage in
+// metrics.
+type instrumentedStorage struct {
+	ExternalStorage
+	metrics *Metrics
+}
+
+func (s *instrumentedStorage) recordErr(err error) error {
+	if err != nil {
+		s.metrics.Errors.Inc(1)
+	}
+	return err
+}
+
+func (s *instrumentedStorage) ReadFile(
+	ctx context.Context, basename string,
+) (io.ReadCloser, error) {
+	start := timeutil.Now()
+	r, err := s.ExternalStorage.ReadFile(ctx, basename)
+	if err != nil {
+		return nil, s.recordErr(err)
+	}
+	s.metrics.ReadLatency.RecordValue(timeutil.Since(start).Nanoseconds())
+	return &countingReader{ReadCloser: r, metrics: s.metrics}, nil
+}
+
+func (s *instrumentedStorage) WriteFile(
+	ctx context.Context, basename string, content io.ReadSeeker,
+) error {
+	start := timeutil.Now()
+	if err := s.ExternalStorage.WriteFile(ctx, basename, content); err != nil {
+		return s.recordErr(err)
+	}
+	s.metrics.WriteLatency.RecordValue(timeutil.Since(start).Nanoseconds())
+	if n, err := content.Seek(0, io.SeekEnd); err == nil {
+		s.metrics.WriteBytes.Inc(n)
+	}
+	return nil
+}
+
+func (s *instrumentedStorage) Delete(ctx context.Context, basename string) error {
+	return s.recordErr(s.ExternalStorage.Delete(ctx, basename))
+}
+
+func (s *instrumentedStorage) Size(ctx context.Context, basename string) (int64, error) {
+	n, err := s.ExternalStorage.Size(ctx, basename)
+	return n, s.recordErr(err)
+}
+
+// countingReader counts the bytes read from a file on external storage.
+type countingReader struct {
+	io.ReadCloser
+	metrics *Metrics
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.metrics.ReadBytes.Inc(int64(n))
+	if err != nil && err != io.EOF {
+		r.metrics.Errors.Inc(1)
+	}
+	return n, err
+}
@@ -0,0 +1,284 @@
+// Copyright 2017 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package extstorage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+const (
+	defaultS3Endpoint = "https://s3.amazonaws.com"
+	defaultS3Region   = "us-east-1"
+
+	// gsEndpoint is the S3-compatible endpoint of Google Cloud Storage. It
+	// accepts requests signed with HMAC keys created for the interoperability
+	// API.
+	gsEndpoint = "https://storage.googleapis.com"
+	gsRegion   = "auto"
+
+	s3SigningAlgorithm = "AWS4-HMAC-SHA256"
+	s3AmzDateFormat    = "20060102T150405Z"
+	s3ScopeDateFormat  = "20060102"
+)
+
+// s3Credentials are the credentials used to sign requests with AWS
+// Signature Version 4.
+type s3Credentials struct {
+	accessKey, secret string
+	region            string
+}
+
+// s3Storage stores files in a bucket of Amazon S3 or an S3-compatible
+// service. Requests use path-style addressing so that any endpoint can be
+// used.
+type s3Storage struct {
+	uri      string
+	endpoint *url.URL
+	bucket   string
+	prefix   string
+	creds    s3Credentials
+	client   *http.Client
+	now      func() time.Time
+}
+
+var _ ExternalStorage = &s3Storage{}
+
+func makeS3Storage(u *url.URL) (ExternalStorage, error) {
+	q := u.Query()
+	creds := s3Credentials{
+		accessKey: q.Get(S3AccessKeyParam),
+		secret:    q.Get(S3SecretParam),
+		region:    q.Get(S3RegionParam),
+	}
+	if creds.region == "" {
+		creds.region = defaultS3Region
+	}
+	endpoint := q.Get(S3EndpointParam)
+	if endpoint == "" {
+		endpoint = defaultS3Endpoint
+	}
+	return newS3Storage(u, endpoint, creds, S3AccessKeyParam, S3SecretParam)
+}
+
+func makeGSStorage(u *url.URL) (ExternalStorage, error) {
+	q := u.Query()
+	creds := s3Credentials{
+		accessKey: q.Get(GSAccessKeyParam),
+		secret:    q.Get(GSSecretParam),
+		region:    gsRegion,
+	}
+	return newS3Storage(u, gsEndpoint, creds, GSAccessKeyParam, GSSecretParam)
+}
+
+func newS3Storage(
+	u *url.URL, endpoint string, creds s3Credentials, accessKeyParam, secretParam string,
+) (ExternalStorage, error) {
+	if u.Host == "" {
+		return nil, errors.New("bucket name is required")
+	}
+	if creds.accessKey == "" {
+		return nil, errors.Errorf("%s is required", accessKeyParam)
+	}
+	if creds.secret == "" {
+		return nil, errors.Errorf("%s is required", secretParam)
+	}
+	ep, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid endpoint")
+	}
+	if ep.Host == "" || (ep.Scheme != "http" && ep.Scheme != "https") {
+		return nil, errors.Errorf("invalid endpoint %q", endpoint)
+	}
+	return &s3Storage{
+		uri:      RedactURI(u.String()),
+		endpoint: ep,
+		bucket:   u.Host,
+		prefix:   strings.Trim(u.Path, "/"),
+		creds:    creds,
+		client:   newHTTPClient(),
+		now:      timeutil.Now,
+	}, nil
+}
+
+func (s *s3Storage) String() string {
+	return s.uri
+}
+
+func (s *s3Storage) req(
+	ctx context.Context, method, basename string, body io.ReadSeeker,
+) (*http.Response, error) {
+	if err := checkBasename(basename); err != nil {
+		return nil, err
+	}
+	u := *s.endpoint
+	u.Path = "/" + joinPath(s.bucket, joinPath(s.prefix, basename))
+	u.RawPath = s3EscapePath(u.Path)
+
+	payloadHash := sha256.New()
+	var reqBody io.Reader
+	var contentLength int64
+	if body != nil {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		n, err := io.Copy(payloadHash, body)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if contentLength = n; contentLength > 0 {
+			reqBody = body
+		}
+	}
+
+	req, err := http.NewRequest(method, u.String(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = contentLength
+	s.creds.sign(req, hex.EncodeToString(payloadHash.Sum(nil)), s.now())
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResponse(req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *s3Storage) ReadFile(ctx context.Context, basename string) (io.ReadCloser, error) {
+	resp, err := s.req(ctx, "GET", basename, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *s3Storage) WriteFile(
+	ctx context.Context, basename string, content io.ReadSeeker,
+) error {
+	resp, err := s.req(ctx, "PUT", basename, content)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3Storage) Delete(ctx context.Context, basename string) error {
+	resp, err := s.req(ctx, "DELETE", basename, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3Storage) Size(ctx context.Context, basename string) (int64, error) {
+	resp, err := s.req(ctx, "HEAD", basename, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength < 0 {
+		return 0, errors.Errorf("HEAD %s: unknown size", basename)
+	}
+	return resp.ContentLength, nil
+}
+
+func (s *s3Storage) Close() error {
+	if t, ok := s.client.Transport.(*http.Transport); ok {
+		t.CloseIdleConnections()
+	}
+	return nil
+}
+
+// sign adds the headers and the Authorization header of AWS Signature
+// Version 4 to the request. The request must not have a query string.
+func (c s3Credentials) sign(req *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(s3AmzDateFormat)
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", now.Format(s3ScopeDateFormat), c.region)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"", // query string
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3SigningAlgorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secret), now.Format(s3ScopeDateFormat))
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgorithm, c.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3EscapePath escapes a path as required by Signature Version 4: every byte
+// except the unreserved characters and the slashes is percent-encoded.
+func s3EscapePath(path string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}